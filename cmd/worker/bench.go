@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	goflag "flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	config "github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/bench"
+	flag "github.com/spf13/pflag"
+)
+
+// benchCommand tells if the worker is run as the benchmark
+// (worker bench --game <file> --rooms N ...) and removes the command from the args.
+func benchCommand() bool {
+	if len(os.Args) < 2 || os.Args[1] != "bench" {
+		return false
+	}
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return true
+}
+
+// runBench runs the rooms of the game without the clients and prints
+// the JSON report (one line) of their frames, encoding time and CPU time.
+// The rooms go in their own worker processes (one game per process).
+func runBench() {
+	conf := config.NewConfig()
+	var opts bench.Options
+	var rooms int
+	flag.StringVar(&opts.Game, "game", "", "The game file of the rooms")
+	flag.IntVar(&rooms, "rooms", 1, "The number of the rooms")
+	flag.DurationVar(&opts.Duration, "duration", 30*time.Second, "The measured time of the rooms")
+	flag.DurationVar(&opts.Warmup, "warmup", 5*time.Second, "The time the rooms run before the measurement")
+	flag.StringVar(&opts.Room, "room", "", "The ID of the room")
+	flag.CommandLine.AddGoFlagSet(goflag.CommandLine)
+	conf.ParseFlags()
+
+	var report bench.Report
+	var err error
+	if rooms <= 1 {
+		report, err = bench.Run(conf, opts)
+	} else {
+		cmds := make([]*exec.Cmd, rooms)
+		for i := range cmds {
+			args := append([]string{"bench"}, os.Args[1:]...)
+			args = append(args, "--rooms=1", fmt.Sprintf("--room=bench%02d", i))
+			cmds[i] = exec.Command(os.Args[0], args...)
+		}
+		report, err = bench.Spawn(cmds)
+	}
+	if err != nil {
+		log.Fatalf("error: the benchmark has failed, %v", err)
+	}
+	// one line after the output of the rooms
+	out, err := json.Marshal(report)
+	if err != nil {
+		log.Fatalf("error: malformed benchmark report, %v", err)
+	}
+	fmt.Println(string(out))
+}
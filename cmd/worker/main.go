@@ -34,12 +34,19 @@ func run() {
 	wrk := worker.New(conf)
 	wrk.Start()
 
-	ctx, cancelCtx := context.WithCancel(context.Background())
-	defer wrk.Shutdown(ctx)
-	<-os.ExpectTermination()
-	cancelCtx()
+	// the worker drains its rooms on shutdown
+	// or stops after the drain requested by the coordinator
+	select {
+	case <-os.ExpectTermination():
+	case <-wrk.Drained():
+	}
+	wrk.Shutdown(context.Background())
 }
 
 func main() {
+	if benchCommand() {
+		thread.Wrap(runBench)
+		return
+	}
 	thread.Wrap(run)
 }
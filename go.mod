@@ -3,31 +3,37 @@ module github.com/giongto35/cloud-game/v2
 go 1.13
 
 require (
+	github.com/aws/aws-sdk-go-v2 v1.16.2
+	github.com/aws/aws-sdk-go-v2/config v1.15.3
+	github.com/aws/aws-sdk-go-v2/service/s3 v1.26.3
 	github.com/cavaliercoder/grab v1.0.1-0.20201108051000-98a5bfe305ec
+	github.com/cespare/xxhash/v2 v2.1.2
 	github.com/fsnotify/fsnotify v1.5.1
 	github.com/go-gl/gl v0.0.0-20211210172815-726fda9656d6
 	github.com/gofrs/flock v0.8.1
 	github.com/gofrs/uuid v4.2.0+incompatible
 	github.com/golang/glog v1.0.0
-	github.com/google/go-cmp v0.5.6 // indirect
 	github.com/gorilla/websocket v1.5.0
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1
 	github.com/kkyr/fig v0.3.0
+	github.com/klauspost/compress v1.15.1
 	github.com/mitchellh/mapstructure v1.4.3 // indirect
 	github.com/pelletier/go-toml v1.9.4 // indirect
 	github.com/pion/ice/v2 v2.2.3 // indirect
 	github.com/pion/interceptor v0.1.10
-	github.com/pion/rtp v1.7.11 // indirect
+	github.com/pion/rtcp v1.2.9
+	github.com/pion/rtp v1.7.11
 	github.com/pion/webrtc/v3 v3.1.27
 	github.com/prometheus/client_golang v1.12.1
 	github.com/prometheus/common v0.33.0 // indirect
 	github.com/rs/xid v1.4.0
 	github.com/spf13/pflag v1.0.5
 	github.com/veandco/go-sdl2 v0.4.20
+	go.uber.org/goleak v1.1.12
 	golang.org/x/crypto v0.0.0-20220408190544-5352b0902921
 	golang.org/x/image v0.0.0-20220321031419-a8550c1d254a
 	golang.org/x/net v0.0.0-20220407224826-aac1ed45d8e3 // indirect
-	golang.org/x/sys v0.0.0-20220408201424-a24fb2fb8a0f // indirect
+	golang.org/x/sys v0.0.0-20220408201424-a24fb2fb8a0f
 	google.golang.org/protobuf v1.28.0 // indirect
 )
@@ -0,0 +1,146 @@
+// Package achievements keeps the RetroAchievements (retroachievements.org)
+// of the games: it gets the achievements of the games from the API
+// and checks their conditions over the memory of the games every frame
+// in the same way as the rcheevos library does, see condition.go for the
+// supported conditions. The achievements are checked only,
+// their unlocks are not sent to the site.
+package achievements
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+)
+
+// flagOfficial is the flag of the official (core) achievements,
+// the unofficial ones are skipped.
+const flagOfficial = 3
+
+// Achievement is the achievement of the game
+// in the format of the API (the patch data).
+type Achievement struct {
+	ID          int    `json:"ID"`
+	Title       string `json:"Title"`
+	Description string `json:"Description"`
+	Points      int    `json:"Points"`
+	// the conditions of the achievement
+	MemAddr   string `json:"MemAddr"`
+	BadgeName string `json:"BadgeName"`
+	Flags     int    `json:"Flags"`
+}
+
+// Game is the achievements of the game.
+type Game struct {
+	ID           int           `json:"ID"`
+	Title        string        `json:"Title"`
+	Achievements []Achievement `json:"Achievements"`
+}
+
+// ErrNoAchievements is the error of the games without the achievements.
+var ErrNoAchievements = errors.New("the game has no achievements")
+
+// ParseGame parses the patch data of the game of the API,
+// i.e. {"Success": true, "PatchData": {"ID": 1, "Achievements": [...]}}.
+func ParseGame(data []byte) (Game, error) {
+	var patch struct {
+		Success   bool   `json:"Success"`
+		Error     string `json:"Error"`
+		PatchData Game   `json:"PatchData"`
+	}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return Game{}, err
+	}
+	if !patch.Success {
+		return Game{}, errors.New(patch.Error)
+	}
+	if patch.PatchData.ID == 0 {
+		return Game{}, ErrNoAchievements
+	}
+	return patch.PatchData, nil
+}
+
+type state int
+
+const (
+	// the conditions of the achievement should be false once before it can be unlocked,
+	// so the achievements are not unlocked right after the load of the game or a state
+	stateWaiting state = iota
+	stateActive
+	stateUnlocked
+)
+
+type tracked struct {
+	Achievement
+	trigger *trigger
+	state   state
+}
+
+// Runtime checks the achievements of the game every frame.
+type Runtime struct {
+	mu   sync.Mutex
+	list []*tracked
+	refs memrefs
+}
+
+// NewRuntime returns the runtime of the official achievements,
+// the achievements with the unsupported or bad conditions are skipped.
+func NewRuntime(list []Achievement) *Runtime {
+	rt := &Runtime{}
+	for _, a := range list {
+		if a.Flags != flagOfficial {
+			continue
+		}
+		t, err := parseTrigger(a.MemAddr, &rt.refs)
+		if err != nil {
+			log.Printf("warn: the achievement %v %q is skipped, %v", a.ID, a.Title, err)
+			continue
+		}
+		rt.list = append(rt.list, &tracked{Achievement: a, trigger: t})
+	}
+	return rt
+}
+
+// Len returns the number of the achievements.
+func (rt *Runtime) Len() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return len(rt.list)
+}
+
+// Frame checks the achievements over the memory of the game after its frame,
+// it returns the achievements unlocked in the frame.
+func (rt *Runtime) Frame(mem []byte) (unlocked []Achievement) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.refs.update(mem)
+	for _, a := range rt.list {
+		if a.state == stateUnlocked {
+			continue
+		}
+		ok := a.trigger.test()
+		switch {
+		case a.state == stateWaiting && ok:
+			a.trigger.reset()
+		case a.state == stateWaiting:
+			a.state = stateActive
+		case ok:
+			a.state = stateUnlocked
+			unlocked = append(unlocked, a.Achievement)
+		}
+	}
+	return
+}
+
+// Reset makes the achievements wait for their conditions to be false
+// and resets their hits, i.e. after the load of a state.
+func (rt *Runtime) Reset() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, a := range rt.list {
+		if a.state != stateUnlocked {
+			a.state = stateWaiting
+			a.trigger.reset()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package achievements
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func testGame(t *testing.T) Game {
+	data, err := ioutil.ReadFile("testdata/game.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game, err := ParseGame(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+func TestParseGame(t *testing.T) {
+	game := testGame(t)
+	if game.ID != 1446 || len(game.Achievements) != 8 {
+		t.Errorf("wrong game %v with %v achievements", game.ID, len(game.Achievements))
+	}
+	if _, err := ParseGame([]byte(`{"Success": false, "Error": "bad token"}`)); err == nil || err.Error() != "bad token" {
+		t.Errorf("wrong error %v", err)
+	}
+	if _, err := ParseGame([]byte(`{"Success": true, "PatchData": {}}`)); err != ErrNoAchievements {
+		t.Errorf("wrong error %v", err)
+	}
+}
+
+// Tests the unlocks of the achievements of the fixture
+// over the memory of the game changed frame by frame.
+func TestRuntime(t *testing.T) {
+	rt := NewRuntime(testGame(t).Achievements)
+	// without the unofficial and unsupported ones
+	if n := rt.Len(); n != 6 {
+		t.Fatalf("wrong number of achievements %v", n)
+	}
+
+	mem := make([]byte, 0x40)
+	frames := []struct {
+		// the memory changes of the frame
+		set      map[int]byte
+		unlocked []int
+	}{
+		// the conditions of the waiting achievements are false at first
+		{},
+		{set: map[int]byte{0x10: 1}, unlocked: []int{1}},
+		{set: map[int]byte{0x11: 1}},
+		{},
+		{unlocked: []int{2}},
+		// 99 -> 100
+		{set: map[int]byte{0x12: 99}},
+		{set: map[int]byte{0x12: 100}, unlocked: []int{3}},
+		// the reset of the hits
+		{set: map[int]byte{0x13: 1}},
+		{},
+		{set: map[int]byte{0x14: 1}},
+		{set: map[int]byte{0x14: 0}},
+		{},
+		{},
+		{unlocked: []int{4}},
+		// paused
+		{set: map[int]byte{0x15: 1, 0x16: 1}},
+		{set: map[int]byte{0x16: 0}, unlocked: []int{5}},
+		// the core group and one of the alternative ones
+		{set: map[int]byte{0x20: 0x34, 0x21: 0x12}},
+		{set: map[int]byte{0x18: 1}, unlocked: []int{6}},
+		{set: map[int]byte{0x10: 0}},
+		{set: map[int]byte{0x10: 1}},
+	}
+	for i, frame := range frames {
+		for addr, v := range frame.set {
+			mem[addr] = v
+		}
+		unlocked := rt.Frame(mem)
+		if len(unlocked) != len(frame.unlocked) {
+			t.Fatalf("frame %v: wrong unlocks %v, expected %v", i, unlocked, frame.unlocked)
+		}
+		for j, a := range unlocked {
+			if a.ID != frame.unlocked[j] {
+				t.Fatalf("frame %v: wrong unlocks %v, expected %v", i, unlocked, frame.unlocked)
+			}
+		}
+	}
+}
+
+// Tests that the achievements true already on the load
+// or after the state load are not unlocked until they are false once.
+func TestRuntimeWaiting(t *testing.T) {
+	rt := NewRuntime([]Achievement{{ID: 1, MemAddr: "0xH0000=1", Flags: flagOfficial}})
+	mem := []byte{1}
+	for i := 0; i < 3; i++ {
+		if unlocked := rt.Frame(mem); len(unlocked) > 0 {
+			t.Fatalf("the achievement has been unlocked on the load")
+		}
+	}
+	mem[0] = 0
+	rt.Frame(mem)
+	rt.Reset()
+	mem[0] = 1
+	if unlocked := rt.Frame(mem); len(unlocked) > 0 {
+		t.Fatalf("the achievement has been unlocked after the reset")
+	}
+	mem[0] = 0
+	rt.Frame(mem)
+	mem[0] = 1
+	if unlocked := rt.Frame(mem); len(unlocked) != 1 {
+		t.Fatalf("the achievement hasn't been unlocked")
+	}
+	// once
+	mem[0] = 0
+	rt.Frame(mem)
+	mem[0] = 1
+	if unlocked := rt.Frame(mem); len(unlocked) > 0 {
+		t.Fatalf("the achievement has been unlocked twice")
+	}
+}
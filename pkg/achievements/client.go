@@ -0,0 +1,141 @@
+package achievements
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// DefaultAPI is the address of the RetroAchievements API server.
+const DefaultAPI = "https://retroachievements.org"
+
+const requestTimeout = 10 * time.Second
+
+// ErrUnknownGame is the error of the games unknown to the API by their hashes.
+var ErrUnknownGame = errors.New("unknown game")
+
+// Client gets the achievements of the games from the API
+// with the token of the user. The achievements are cached on the disk
+// by the hashes of the games if there is the cache dir.
+type Client struct {
+	api, user, token, cache string
+	http                    *http.Client
+}
+
+// NewClient returns the client of the API server, DefaultAPI if it's empty.
+func NewClient(api, user, token, cache string) *Client {
+	if api == "" {
+		api = DefaultAPI
+	}
+	return &Client{
+		api:   strings.TrimSuffix(api, "/"),
+		user:  user,
+		token: token,
+		cache: cache,
+		http:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Game returns the achievements of the game with the hash (see Hash).
+func (c *Client) Game(hash string) (Game, error) {
+	path := filepath.Join(c.cache, hash+".json")
+	if c.cache != "" {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			return ParseGame(data)
+		}
+	}
+
+	id, err := c.gameID(hash)
+	if err != nil {
+		return Game{}, err
+	}
+	data, err := c.get(url.Values{"r": {"patch"}, "u": {c.user}, "t": {c.token}, "g": {strconv.Itoa(id)}})
+	if err != nil {
+		return Game{}, err
+	}
+	game, err := ParseGame(data)
+	if err != nil {
+		return Game{}, err
+	}
+	if c.cache != "" {
+		if err := os.MkdirAll(c.cache, os.ModePerm); err == nil {
+			err = ioutil.WriteFile(path, data, 0644)
+		}
+		if err != nil {
+			log.Printf("warn: the achievements of %v are not cached, %v", hash, err)
+		}
+	}
+	return game, nil
+}
+
+// gameID returns the ID of the game with the hash.
+func (c *Client) gameID(hash string) (int, error) {
+	data, err := c.get(url.Values{"r": {"gameid"}, "m": {hash}})
+	if err != nil {
+		return 0, err
+	}
+	var resp struct {
+		Success bool   `json:"Success"`
+		Error   string `json:"Error"`
+		GameID  int    `json:"GameID"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return 0, err
+	}
+	if !resp.Success {
+		return 0, errors.New(resp.Error)
+	}
+	if resp.GameID == 0 {
+		return 0, fmt.Errorf("%w %v", ErrUnknownGame, hash)
+	}
+	return resp.GameID, nil
+}
+
+func (c *Client) get(query url.Values) ([]byte, error) {
+	resp, err := c.http.Get(c.api + "/dorequest.php?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the %v request has failed, %v", query.Get("r"), resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// inesMagic is the start of the iNES header of the NES games.
+const inesMagic = "NES\x1a"
+
+// Hash returns the RetroAchievements hash of the game file (or the archive member):
+// the MD5 of the file without its iNES header. It's the hash of the
+// cartridge games, the games of the other media have other hashes.
+func Hash(path string) (string, error) {
+	var data []byte
+	var err error
+	if archive, member := emulator.SplitArchivePath(path); member != "" {
+		data, err = emulator.ReadArchiveMember(archive, member)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(data) > 16 && string(data[:4]) == inesMagic {
+		data = data[16:]
+	}
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
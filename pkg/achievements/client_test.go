@@ -0,0 +1,96 @@
+package achievements
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientGame(t *testing.T) {
+	patch, err := ioutil.ReadFile("testdata/game.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		q := r.URL.Query()
+		switch q.Get("r") {
+		case "gameid":
+			if q.Get("m") == "a1b2" {
+				_, _ = w.Write([]byte(`{"Success": true, "GameID": 1446}`))
+			} else {
+				_, _ = w.Write([]byte(`{"Success": true, "GameID": 0}`))
+			}
+		case "patch":
+			if q.Get("u") != "user" || q.Get("t") != "token" || q.Get("g") != "1446" {
+				_, _ = w.Write([]byte(`{"Success": false, "Error": "bad request"}`))
+				return
+			}
+			_, _ = w.Write(patch)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "cloud_game_achievements")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cache := filepath.Join(dir, "cache")
+
+	c := NewClient(srv.URL+"/", "user", "token", cache)
+	game, err := c.Game("a1b2")
+	if err != nil {
+		t.Fatalf("no achievements, %v", err)
+	}
+	if game.ID != 1446 || len(game.Achievements) != 8 {
+		t.Errorf("wrong game %v with %v achievements", game.ID, len(game.Achievements))
+	}
+	if _, err := os.Stat(filepath.Join(cache, "a1b2.json")); err != nil {
+		t.Errorf("the achievements are not cached, %v", err)
+	}
+
+	// from the cache
+	n := atomic.LoadInt32(&requests)
+	if _, err := c.Game("a1b2"); err != nil || atomic.LoadInt32(&requests) != n {
+		t.Errorf("the cached achievements have been requested again, %v", err)
+	}
+
+	if _, err := c.Game("c3d4"); err == nil {
+		t.Errorf("no error of the unknown game")
+	}
+	if _, err := NewClient(srv.URL, "user", "bad", "").Game("a1b2"); err == nil || err.Error() != "bad request" {
+		t.Errorf("wrong error of the bad token %v", err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_achievements")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	rom := []byte("the game of some cartridge")
+	sum := md5.Sum(rom)
+	want := hex.EncodeToString(sum[:])
+	header := append([]byte(inesMagic), make([]byte, 12)...)
+	for name, data := range map[string][]byte{"game.sfc": rom, "game.nes": append(header, rom...)} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if hash, err := Hash(path); err != nil || hash != want {
+			t.Errorf("wrong hash %v of %v, expected %v, %v", hash, name, want, err)
+		}
+	}
+}
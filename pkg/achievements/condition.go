@@ -0,0 +1,489 @@
+package achievements
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The conditions of the achievements in the rcheevos format (MemAddr),
+// i.e. "0xH0010=5_d0xH0010<0xH0010.3._R:0xX0020=0S0xH0030=1S0xH0030=2".
+// The conditions of the core group go with '_', the alternative groups
+// go after 'S'. The supported subset has:
+//   - the memory of 8 (0xH), 16 (0x), 24 (0xW), 32 (0xX) bits,
+//     the nibbles (0xL, 0xU) and the bits (0xM-0xT) little-endian,
+//     the delta (d), prior (p) and BCD (b) values of the memory;
+//   - the decimal and hex (h) constants;
+//   - the comparisons =, !=, <, <=, >, >=;
+//   - the hit counts (.3.) and the ResetIf (R:) and PauseIf (P:) flags.
+
+var (
+	// ErrSyntax is the error of the malformed conditions.
+	ErrSyntax = errors.New("bad condition")
+	// ErrUnsupported is the error of the conditions out of the supported subset.
+	ErrUnsupported = errors.New("unsupported condition")
+)
+
+// size is the memory size of the operand.
+type size int
+
+const (
+	size8 size = iota
+	size16
+	size24
+	size32
+	sizeLow
+	sizeHigh
+	// sizeBit0 + n is the bit n of the byte
+	sizeBit0
+)
+
+// memref is the memory value of the game at the address updated every frame.
+type memref struct {
+	addr uint32
+	size size
+	// the current, previous frame and the last different values
+	value, delta, prior uint32
+}
+
+// update reads the new value of the memory.
+func (m *memref) update(mem []byte) {
+	var v uint32
+	switch m.size {
+	case size8, sizeLow, sizeHigh:
+		v = peek(mem, m.addr, 1)
+	case size16:
+		v = peek(mem, m.addr, 2)
+	case size24:
+		v = peek(mem, m.addr, 3)
+	case size32:
+		v = peek(mem, m.addr, 4)
+	default:
+		v = peek(mem, m.addr, 1)
+	}
+	switch {
+	case m.size == sizeLow:
+		v &= 0x0f
+	case m.size == sizeHigh:
+		v >>= 4
+	case m.size >= sizeBit0:
+		v = v >> uint(m.size-sizeBit0) & 1
+	}
+	m.delta = m.value
+	if v != m.value {
+		m.prior = m.value
+	}
+	m.value = v
+}
+
+// peek returns n little-endian bytes of the memory at the address,
+// the bytes out of the memory are zero.
+func peek(mem []byte, addr uint32, n int) (v uint32) {
+	for i := n - 1; i >= 0; i-- {
+		v <<= 8
+		if a := uint64(addr) + uint64(i); a < uint64(len(mem)) {
+			v |= uint32(mem[a])
+		}
+	}
+	return
+}
+
+// memrefs are the memory values of all the conditions,
+// the same values are read once.
+type memrefs struct {
+	refs []*memref
+}
+
+func (m *memrefs) get(addr uint32, size size) *memref {
+	for _, ref := range m.refs {
+		if ref.addr == addr && ref.size == size {
+			return ref
+		}
+	}
+	ref := &memref{addr: addr, size: size}
+	m.refs = append(m.refs, ref)
+	return ref
+}
+
+func (m *memrefs) update(mem []byte) {
+	for _, ref := range m.refs {
+		ref.update(mem)
+	}
+}
+
+type operandKind int
+
+const (
+	operandConst operandKind = iota
+	operandValue
+	operandDelta
+	operandPrior
+)
+
+type operand struct {
+	kind operandKind
+	ref  *memref
+	// the value of the constants
+	value uint32
+	bcd   bool
+}
+
+func (o operand) get() uint32 {
+	v := o.value
+	switch o.kind {
+	case operandValue:
+		v = o.ref.value
+	case operandDelta:
+		v = o.ref.delta
+	case operandPrior:
+		v = o.ref.prior
+	}
+	if o.bcd {
+		v = fromBCD(v)
+	}
+	return v
+}
+
+func fromBCD(v uint32) (n uint32) {
+	for m := uint32(1); v > 0; v, m = v>>4, m*10 {
+		n += v & 0x0f * m
+	}
+	return
+}
+
+type comparison int
+
+const (
+	cmpEq comparison = iota
+	cmpNe
+	cmpLt
+	cmpLe
+	cmpGt
+	cmpGe
+)
+
+type flag int
+
+const (
+	flagNone flag = iota
+	flagReset
+	flagPause
+)
+
+// condition is the comparison of two operands which may need
+// some number of frames (hits) in which it's true.
+type condition struct {
+	flag        flag
+	left, right operand
+	cmp         comparison
+	// the number of the hits of the condition to be true, 0 -- no hits
+	target, hits uint32
+}
+
+func (c *condition) compare() bool {
+	l, r := c.left.get(), c.right.get()
+	switch c.cmp {
+	case cmpNe:
+		return l != r
+	case cmpLt:
+		return l < r
+	case cmpLe:
+		return l <= r
+	case cmpGt:
+		return l > r
+	case cmpGe:
+		return l >= r
+	default:
+		return l == r
+	}
+}
+
+// test evaluates the condition counting its hits.
+func (c *condition) test() bool {
+	ok := c.compare()
+	if c.target == 0 {
+		return ok
+	}
+	if ok && c.hits < c.target {
+		c.hits++
+	}
+	return c.hits >= c.target
+}
+
+// group is the conditions which should all be true.
+type group []*condition
+
+// test evaluates the group, it tells if the group is true
+// and if some of its ResetIf conditions are true.
+// The paused groups (PauseIf) are false and their conditions don't count hits.
+func (g group) test() (ok, reset bool) {
+	for _, c := range g {
+		if c.flag == flagPause && c.test() {
+			return false, false
+		}
+	}
+	ok = true
+	for _, c := range g {
+		switch c.flag {
+		case flagPause:
+		case flagReset:
+			reset = c.test() || reset
+		default:
+			ok = c.test() && ok
+		}
+	}
+	return ok && !reset, reset
+}
+
+// trigger is the conditions of the achievement:
+// the core group and any of the alternative groups.
+type trigger struct {
+	core group
+	alts []group
+}
+
+// test evaluates the trigger, the ResetIf conditions reset the hits of all the groups.
+func (t *trigger) test() bool {
+	ok, reset := t.core.test()
+	alt := len(t.alts) == 0
+	for _, g := range t.alts {
+		a, r := g.test()
+		alt, reset = alt || a, reset || r
+	}
+	if reset {
+		t.reset()
+		return false
+	}
+	return ok && alt
+}
+
+// reset resets the hits of all the conditions.
+func (t *trigger) reset() {
+	for _, g := range append([]group{t.core}, t.alts...) {
+		for _, c := range g {
+			c.hits = 0
+		}
+	}
+}
+
+// parseTrigger parses the conditions of the achievement,
+// their memory values are added to the refs.
+func parseTrigger(s string, refs *memrefs) (*trigger, error) {
+	p := parser{s: s, refs: refs}
+	core, err := p.group()
+	if err != nil {
+		return nil, err
+	}
+	t := &trigger{core: core}
+	for p.more() && p.peek() == 'S' {
+		p.i++
+		alt, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		t.alts = append(t.alts, alt)
+	}
+	if p.more() {
+		return nil, p.errorf(ErrSyntax, "unexpected %q", p.peek())
+	}
+	return t, nil
+}
+
+type parser struct {
+	s    string
+	i    int
+	refs *memrefs
+}
+
+func (p *parser) more() bool { return p.i < len(p.s) }
+func (p *parser) peek() byte { return p.s[p.i] }
+
+func (p *parser) errorf(err error, format string, args ...interface{}) error {
+	return fmt.Errorf("%w at %v of %q, %v", err, p.i, p.s, fmt.Sprintf(format, args...))
+}
+
+// group parses the conditions until 'S' or the end, the group may be empty.
+func (p *parser) group() (g group, err error) {
+	if !p.more() || p.peek() == 'S' {
+		return nil, nil
+	}
+	for {
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		g = append(g, c)
+		if !p.more() || p.peek() == 'S' {
+			return g, nil
+		}
+		if p.peek() != '_' {
+			return nil, p.errorf(ErrSyntax, "unexpected %q", p.peek())
+		}
+		p.i++
+	}
+}
+
+func (p *parser) condition() (*condition, error) {
+	c := &condition{}
+	if p.i+1 < len(p.s) && p.s[p.i+1] == ':' {
+		switch p.peek() {
+		case 'R', 'r':
+			c.flag = flagReset
+		case 'P', 'p':
+			c.flag = flagPause
+		default:
+			return nil, p.errorf(ErrUnsupported, "the flag %q", p.peek())
+		}
+		p.i += 2
+	}
+	var err error
+	if c.left, err = p.operand(); err != nil {
+		return nil, err
+	}
+	if c.cmp, err = p.comparison(); err != nil {
+		return nil, err
+	}
+	if c.right, err = p.operand(); err != nil {
+		return nil, err
+	}
+	if c.target, err = p.hits(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *parser) operand() (o operand, err error) {
+	if !p.more() {
+		return o, p.errorf(ErrSyntax, "no operand")
+	}
+	kind := operandValue
+	switch p.peek() {
+	case 'd', 'D':
+		kind = operandDelta
+		p.i++
+	case 'p', 'P':
+		kind = operandPrior
+		p.i++
+	case 'b', 'B':
+		o.bcd = true
+		p.i++
+	case '~', 'v', 'V', 'f', 'F':
+		return o, p.errorf(ErrUnsupported, "the operand %q", p.peek())
+	}
+	if !p.more() {
+		return o, p.errorf(ErrSyntax, "no operand")
+	}
+
+	if c := p.peek(); c == 'h' || c == 'H' {
+		if kind != operandValue || o.bcd {
+			return o, p.errorf(ErrSyntax, "the constant with the modifier")
+		}
+		p.i++
+		v, err := p.number(16)
+		return operand{kind: operandConst, value: v}, err
+	}
+	if !strings.HasPrefix(p.s[p.i:], "0x") && !strings.HasPrefix(p.s[p.i:], "0X") {
+		if kind != operandValue || o.bcd {
+			return o, p.errorf(ErrSyntax, "the constant with the modifier")
+		}
+		v, err := p.number(10)
+		return operand{kind: operandConst, value: v}, err
+	}
+
+	p.i += 2
+	sz := size16
+	if p.more() {
+		switch c := p.peek(); {
+		case c == ' ':
+			p.i++
+		case c == 'H' || c == 'h':
+			sz = size8
+			p.i++
+		case c == 'W' || c == 'w':
+			sz = size24
+			p.i++
+		case c == 'X' || c == 'x':
+			sz = size32
+			p.i++
+		case c == 'L' || c == 'l':
+			sz = sizeLow
+			p.i++
+		case c == 'U' || c == 'u':
+			sz = sizeHigh
+			p.i++
+		case c >= 'M' && c <= 'T':
+			sz = sizeBit0 + size(c-'M')
+			p.i++
+		case c >= 'm' && c <= 't':
+			sz = sizeBit0 + size(c-'m')
+			p.i++
+		case isHex(c):
+		default:
+			return o, p.errorf(ErrUnsupported, "the memory size %q", c)
+		}
+	}
+	addr, err := p.number(16)
+	if err != nil {
+		return o, err
+	}
+	o.kind, o.ref = kind, p.refs.get(addr, sz)
+	return o, nil
+}
+
+func (p *parser) comparison() (comparison, error) {
+	ops := []struct {
+		s   string
+		cmp comparison
+	}{{"==", cmpEq}, {"!=", cmpNe}, {"<=", cmpLe}, {">=", cmpGe}, {"=", cmpEq}, {"<", cmpLt}, {">", cmpGt}}
+	for _, op := range ops {
+		if strings.HasPrefix(p.s[p.i:], op.s) {
+			p.i += len(op.s)
+			return op.cmp, nil
+		}
+	}
+	if p.more() && (p.peek() == '*' || p.peek() == '/' || p.peek() == '&' || p.peek() == '^') {
+		return 0, p.errorf(ErrUnsupported, "the operator %q", p.peek())
+	}
+	return 0, p.errorf(ErrSyntax, "no comparison")
+}
+
+// hits parses the hit count of the condition, .N. or (N).
+func (p *parser) hits() (uint32, error) {
+	if !p.more() || p.peek() != '.' && p.peek() != '(' {
+		return 0, nil
+	}
+	end := byte('.')
+	if p.peek() == '(' {
+		end = ')'
+	}
+	p.i++
+	n, err := p.number(10)
+	if err != nil {
+		return 0, err
+	}
+	if !p.more() || p.peek() != end {
+		return 0, p.errorf(ErrSyntax, "no end of the hit count")
+	}
+	p.i++
+	return n, nil
+}
+
+func (p *parser) number(base int) (uint32, error) {
+	start := p.i
+	for p.more() && (base == 16 && isHex(p.peek()) || base == 10 && p.peek() >= '0' && p.peek() <= '9') {
+		p.i++
+	}
+	if start == p.i {
+		return 0, p.errorf(ErrSyntax, "no number")
+	}
+	n, err := strconv.ParseUint(p.s[start:p.i], base, 32)
+	if err != nil {
+		return 0, p.errorf(ErrSyntax, "%v", err)
+	}
+	return uint32(n), nil
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,85 @@
+package achievements
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTrigger(t *testing.T) {
+	tests := []struct {
+		s    string
+		core int
+		alts int
+		err  error
+	}{
+		{s: "0xH0010=5", core: 1},
+		{s: "0xH0010=5_d0xH0010<0xH0010.3._R:0xX0020=0", core: 3},
+		{s: "0xH0010=h1f_0x 0012!=0_0xW0a>=2_0xL1<=3_0xU2>1_0xs3=1_b0x4==16", core: 7},
+		{s: "1=1S0xH0030=1S0xS0030=1", core: 1, alts: 2},
+		{s: "S0xH0030=1", alts: 1},
+		{s: "0xH0010=1(2)_P:0xH0011=1", core: 2},
+		{s: "0xH0010", err: ErrSyntax},
+		{s: "0xH0010=", err: ErrSyntax},
+		{s: "0xH0010=1.2", err: ErrSyntax},
+		{s: "0xH0010=1__0xH0011=1", err: ErrSyntax},
+		{s: "d5=0xH0010", err: ErrSyntax},
+		{s: "A:0xH0010_0xH0011=2", err: ErrUnsupported},
+		{s: "0xK0010=2", err: ErrUnsupported},
+		{s: "0xH0010*2=4", err: ErrUnsupported},
+		{s: "~0xH0010=1", err: ErrUnsupported},
+	}
+	for _, test := range tests {
+		tr, err := parseTrigger(test.s, &memrefs{})
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: wrong error %v, expected %v", test.s, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(tr.core) != test.core || len(tr.alts) != test.alts {
+			t.Errorf("%q: got %v conditions and %v alt groups, expected %v and %v",
+				test.s, len(tr.core), len(tr.alts), test.core, test.alts)
+		}
+	}
+}
+
+func TestMemref(t *testing.T) {
+	mem := []byte{0x34, 0x12, 0xcd, 0xab, 0x99}
+	tests := []struct {
+		addr  uint32
+		size  size
+		value uint32
+	}{
+		{addr: 0, size: size8, value: 0x34},
+		{addr: 0, size: size16, value: 0x1234},
+		{addr: 1, size: size24, value: 0xabcd12},
+		{addr: 0, size: size32, value: 0xabcd1234},
+		{addr: 2, size: sizeLow, value: 0xd},
+		{addr: 2, size: sizeHigh, value: 0xc},
+		{addr: 4, size: sizeBit0, value: 1},
+		{addr: 4, size: sizeBit0 + 1, value: 0},
+		{addr: 4, size: sizeBit0 + 7, value: 1},
+		// out of the memory
+		{addr: 4, size: size16, value: 0x99},
+		{addr: 100, size: size32, value: 0},
+	}
+	for _, test := range tests {
+		ref := &memref{addr: test.addr, size: test.size}
+		ref.update(mem)
+		if ref.value != test.value {
+			t.Errorf("wrong value %#x of %v (%v), expected %#x", ref.value, test.addr, test.size, test.value)
+		}
+	}
+
+	ref := &memref{addr: 0, size: size8}
+	for _, v := range []byte{1, 2, 2} {
+		ref.update([]byte{v})
+	}
+	if ref.value != 2 || ref.delta != 2 || ref.prior != 1 {
+		t.Errorf("wrong values %v, delta %v, prior %v", ref.value, ref.delta, ref.prior)
+	}
+	if n := fromBCD(0x1234); n != 1234 {
+		t.Errorf("wrong BCD value %v", n)
+	}
+}
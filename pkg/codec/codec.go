@@ -5,4 +5,41 @@ type VideoCodec string
 const (
 	H264 VideoCodec = "h264"
 	VPX  VideoCodec = "vpx"
+	VP9  VideoCodec = "vp9"
+	AV1  VideoCodec = "av1"
 )
+
+// Preferred is the list of the video codecs
+// from the most to the least preferred one.
+var Preferred = []VideoCodec{AV1, VP9, H264, VPX}
+
+// Select returns the most preferred video codec supported by all the peers.
+// If there is no such codec or no peers, the default codec is returned.
+func Select(def VideoCodec, peers ...[]VideoCodec) VideoCodec {
+	if len(peers) == 0 {
+		return def
+	}
+	for _, c := range Preferred {
+		common := true
+		for _, peer := range peers {
+			if !Has(peer, c) {
+				common = false
+				break
+			}
+		}
+		if common {
+			return c
+		}
+	}
+	return def
+}
+
+// Has tells if the codec is in the list of the codecs.
+func Has(codecs []VideoCodec, c VideoCodec) bool {
+	for _, cc := range codecs {
+		if cc == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package codec
+
+import "testing"
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name  string
+		def   VideoCodec
+		peers [][]VideoCodec
+		want  VideoCodec
+	}{
+		{name: "no peers", def: H264, want: H264},
+		{name: "single peer", def: H264, peers: [][]VideoCodec{{VPX, VP9, H264}}, want: VP9},
+		{name: "common", def: VPX, peers: [][]VideoCodec{{AV1, VP9, H264}, {H264, VP9}}, want: VP9},
+		{name: "lowest common", def: H264, peers: [][]VideoCodec{{AV1, VPX}, {VPX, H264}}, want: VPX},
+		{name: "disagree", def: H264, peers: [][]VideoCodec{{AV1}, {VP9}}, want: H264},
+		{name: "no codecs", def: VPX, peers: [][]VideoCodec{{VP9}, {}}, want: VPX},
+	}
+	for _, test := range tests {
+		if got := Select(test.def, test.peers...); got != test.want {
+			t.Errorf("%v: got %v, expected %v", test.name, got, test.want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package coordinator
 
 import (
+	"time"
+
 	"github.com/giongto35/cloud-game/v2/pkg/config"
 	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
 	"github.com/giongto35/cloud-game/v2/pkg/config/monitoring"
@@ -21,10 +23,35 @@ type Config struct {
 		}
 		Server    shared.Server
 		Analytics Analytics
+		// the time the session seats are kept in the rooms
+		// after the sessions have gone, 0 -- no reconnects
+		ReconnectTTL time.Duration
+		// the load average per core (0-1) of the workers from their heartbeats
+		// over which they don't get new rooms, 0 -- unlimited
+		MaxWorkerLoad float64
+		// the time without the heartbeats of the workers
+		// after which they are dropped, 0 -- never
+		WorkerTimeout time.Duration
+		// the time-limited credentials of the TURN servers
+		// of the sessions (TURN REST API)
+		Turn struct {
+			// the shared secret of the TURN servers, empty -- disabled
+			Secret string
+			// the lifetime of the credentials, 0 -- one day
+			TTL time.Duration
+		}
+		// the request header with the user ID of the sessions
+		// set by the auth proxy in front of the coordinator (i.e. X-Forwarded-User),
+		// empty -- anonymous sessions
+		UserHeader string
+		// the token of the admin requests (i.e. the rescans)
+		// (Authorization: Bearer <token>), empty -- disabled
+		AdminToken string
 	}
-	Emulator  emulator.Emulator
-	Recording shared.Recording
-	Webrtc    webrtcConfig.Webrtc
+	Emulator   emulator.Emulator
+	JoinTokens shared.JoinTokens
+	Recording  shared.Recording
+	Webrtc     webrtcConfig.Webrtc
 }
 
 // Analytics is optional Google Analytics
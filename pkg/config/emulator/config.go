@@ -4,6 +4,8 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/encoder"
 )
 
 type Emulator struct {
@@ -12,9 +14,110 @@ type Emulator struct {
 		Keep   bool
 		Width  int
 		Height int
+		// how the game frames are scaled into the WxH viewport:
+		//   - fit (default, letterboxed)
+		//   - fill (cropped)
+		//   - integer (the integer multiples of the native size)
+		//   - stretch (regardless of the aspect ratio)
+		ScalingMode string
 	}
+	// what to do with the resolution changes of the games while running:
+	//   - follow (default, the video is resized to the new resolution)
+	//   - keep (the frames are scaled into the initial size)
+	Geometry string
 	Storage  string
-	Libretro LibretroConfig
+	// how the files of the rooms are kept in the storage:
+	//   - room (default), <storage>/<room>/ with all the files of the room
+	//   - flat, all the files in the storage dir (older versions)
+	StorageLayout string
+	// the removal of the storage of the old rooms (room layout only)
+	StorageCleanup StorageCleanup
+	// a directory with the cheat files of the games (<game sha1>.cht)
+	Cheats string
+	// an interval in seconds between the game autosaves,
+	// 0 -- disabled
+	AutosaveInterval int
+	// a min interval in seconds between the saves of a room
+	// when its last player has left, 0 -- 60
+	LeaveSaveInterval int
+	// save the games of all the rooms on close,
+	// false -- only of the rooms saved before
+	AlwaysCloudSave bool
+	// an interval in seconds between the writes of the game save RAM
+	// (battery saves) to the disk,
+	// 0 -- only on save and close
+	SRAMFlushInterval int
+	Rewind            Rewind
+	FastForward       FastForward
+	RomCache          RomCache
+	Input             Input
+	Libretro          LibretroConfig
+}
+
+// The layouts of the emulator storage.
+const (
+	StorageLayoutRoom = "room"
+	StorageLayoutFlat = "flat"
+)
+
+// StorageCleanup is the config of the removal of the storage dirs of the rooms
+// which have not been played for a while.
+type StorageCleanup struct {
+	// the number of days since the last change of the files
+	// of the room to remove them,
+	// 0 -- never
+	ExpiryDays int
+	// an interval in hours between the cleanups,
+	// 0 -- 24
+	Interval int
+}
+
+// IsFlatStorage tells if the rooms keep their files in the storage dir.
+func (e Emulator) IsFlatStorage() bool { return e.StorageLayout == StorageLayoutFlat }
+
+// The modes of the resolution changes of the games.
+const (
+	GeometryFollow = "follow"
+	GeometryKeep   = "keep"
+)
+
+// Rewind is the game rewind config.
+type Rewind struct {
+	// the number of seconds of the game that can be rewound,
+	// 0 -- disabled
+	Seconds int
+	// max size in bytes of the emulator state allowing rewind,
+	// 0 -- no limit
+	MaxStateSize int
+}
+
+// FastForward is the game fast-forward config.
+type FastForward struct {
+	// max speed multiplier of the game,
+	// 1 -- disabled
+	MaxSpeed float64
+	// what to do with the audio while fast-forwarding:
+	//   - mute
+	//   - resample (default, plays the audio with a higher pitch)
+	Audio string
+}
+
+// Input is the config of the player input.
+type Input struct {
+	// the part (0-1) of the analog stick range around its center
+	// where the stick is centered, 0 -- disabled
+	Deadzone float64
+}
+
+// RomCache is the config of the extracted games of the archives (zip)
+// for the cores which can't load games from memory.
+type RomCache struct {
+	// the directory of the extracted games
+	Path string
+	// max size in megabytes of all the extracted games,
+	// the least recently used ones are removed,
+	// 0 -- no limit
+	MaxSize int
 }
 
 type LibretroConfig struct {
@@ -22,6 +125,9 @@ type LibretroConfig struct {
 		Paths struct {
 			Libs    string
 			Configs string
+			// the system directory of the cores with their BIOS files,
+			// empty -- ./pkg/emulator/libretro/system
+			System string
 		}
 		Repo struct {
 			Sync      bool
@@ -30,9 +136,38 @@ type LibretroConfig struct {
 			Secondary LibretroRepoConfig
 		}
 		List map[string]LibretroCoreConfig
+		// Manifest contains the downloads of the cores by their names in the list,
+		// the missing cores are downloaded before the game start
+		Manifest map[string]CoreDownload
+		// Bios is the download of the missing BIOS files of the cores
+		Bios BiosDownload
 	}
 }
 
+// BiosDownload is the private download of the BIOS files,
+// they are fetched as <url>/<name> and checked with their MD5 checksums.
+type BiosDownload struct {
+	// empty -- no downloads
+	Url string
+}
+
+// BiosFile is a system file (BIOS) of a core in the system directory.
+type BiosFile struct {
+	Name string
+	// the MD5 checksum (hex) of the file, empty -- any file
+	Md5 string
+	// the cores run without the optional files (i.e. with the HLE BIOS)
+	Optional bool
+}
+
+// CoreDownload is the download of a core lib file or
+// a zip archive with it.
+type CoreDownload struct {
+	Url string
+	// the SHA-256 checksum (hex) of the downloaded file
+	Sha256 string
+}
+
 type LibretroRepoConfig struct {
 	Type        string
 	Url         string
@@ -51,9 +186,40 @@ type LibretroCoreConfig struct {
 	UsesLibCo   bool
 	HasMultitap bool
 	AltRepo     bool
+	// Players is the max number of the players of the core games,
+	// 0 -- the room default
+	Players int
+	// CoreOptions are the core variables (options),
+	// they override the values of the config file
+	CoreOptions map[string]string
+	// Audio has the audio encoder settings (bitrate, complexity, FEC)
+	// for the games of the core overriding the worker ones
+	Audio encoder.Audio
+	// Devices are the controller devices plugged into the ports (from 0)
+	// by their names declared by the core (or IDs), i.e. {1: SNES Mouse}
+	Devices map[int]string
+	// Keyboard passes the keyboard of one of the players
+	// (the room owner by default) into the computer cores (DOSBox)
+	Keyboard bool
+	// Bios are the BIOS files of the core in the system directory
+	// along with the known ones of the core
+	Bios []BiosFile
+	// RegionOption is the core option of the region of the games
+	// (i.e. fceumm_region), it's needed for the forced regions
+	RegionOption string
+	// Region forces the region (pal, ntsc) of the games of the core,
+	// the region reported by the core if empty
+	Region string
 
 	// hack: keep it here to pass it down the emulator
-	AutoGlContext bool
+	AutoGlContext     bool
+	System            string
+	BiosDownload      BiosDownload
+	Rewind            Rewind
+	FastForward       FastForward
+	SRAMFlushInterval int
+	RomCache          RomCache
+	Input             Input
 }
 
 type CoreInfo struct {
@@ -66,6 +232,13 @@ func (e Emulator) GetLibretroCoreConfig(emulator string) LibretroCoreConfig {
 	cores := e.Libretro.Cores
 	conf := cores.List[emulator]
 	conf.Lib = path.Join(cores.Paths.Libs, conf.Lib)
+	conf.Rewind = e.Rewind
+	conf.FastForward = e.FastForward
+	conf.SRAMFlushInterval = e.SRAMFlushInterval
+	conf.RomCache = e.RomCache
+	conf.Input = e.Input
+	conf.System = cores.Paths.System
+	conf.BiosDownload = cores.Bios
 	if conf.Config != "" {
 		conf.Config = path.Join(cores.Paths.Configs, conf.Config)
 	}
@@ -1,31 +1,372 @@
 package encoder
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Encoder struct {
 	Audio       Audio
 	Video       Video
 	WithoutGame bool
+	// Importer is the transport of the frames of the emulator without game
+	Importer Importer
+}
+
+// Importer is the transport of the video frames of the out-of-process emulator.
+type Importer struct {
+	// the frames go in the shared memory ring buffer
+	// and only their slot numbers over the socket,
+	// false -- the whole frames over the socket
+	Shm bool
+	// the number of the frames of the ring, 0 -- 4
+	Slots int
+	// the max size of the frames of the ring, 0 -- 1280x720
+	MaxWidth  int
+	MaxHeight int
 }
 
 type Audio struct {
-	Channels  int
+	Channels int
+	// Frame is the duration (ms) of the Opus frames,
+	// 0 -- the longest Opus frame within a frame of the game, see WithFps
 	Frame     int
 	Frequency int
+	// Resampler is the resampler of the core audio (fast, quality)
+	// into the frequency of the encoder
+	Resampler string
+	// the Opus encoder settings, the zero values are the defaults
+	//
+	// Bitrate in bit/s
+	Bitrate int
+	// Complexity is from 1 (the fastest) to 10 (the best quality)
+	Complexity int
+	// EnableFEC adds the in-band forward error correction data
+	EnableFEC bool
+	// ExpectedPacketLoss is the expected packet loss in percents for FEC
+	ExpectedPacketLoss int
 }
 
 type Video struct {
 	Codec string
-	H264  struct {
-		Crf      uint8
-		Preset   string
-		Profile  string
-		Tune     string
-		LogLevel int
-	}
-	Vpx struct {
+	// Filters are the names of the video filters applied before the encoding
+	// (nearest, bilinear, scanlines, crt)
+	Filters []string
+	// Backend is the hardware encoding API (vaapi, nvenc),
+	// the software encoders are used if empty
+	Backend string
+	// Device is the GPU of the hardware encoder
+	Device string
+	// Bitrate is the range of the adaptive video bitrate (kbit/s),
+	// the adaptation is disabled with zero max.
+	Bitrate struct {
+		Min uint
+		Max uint
+	}
+	// Ladder is the resolution ladder of the adaptive bitrate,
+	// the video is downscaled when the bitrate drops
+	Ladder Ladder
+	// Simulcast encodes the second low layer of the video for the slow peers
+	Simulcast Simulcast
+	H264      H264
+	Vpx       struct {
+		Bitrate          uint
+		KeyframeInterval uint
+	}
+	Vp9 struct {
+		Bitrate          uint
+		KeyframeInterval uint
+		Speed            int
+	}
+	Av1 struct {
 		Bitrate          uint
 		KeyframeInterval uint
+		Speed            int
+	}
+	// Fps is the frame rate of the game (of its region) for the rate control
+	// of the encoders, it's set by the rooms and not by the config
+	Fps float64
+}
+
+// Ladder is the resolution ladder of the video under congestion.
+// The frames are downscaled to the step of the lowest bitrate above
+// the current bitrate of the video, and they go back to the larger size
+// when the bitrate gets above the step one by the hysteresis share.
+type Ladder struct {
+	Steps []LadderStep
+	// Hysteresis is the share of the step bitrate (0-1) above it
+	// the video goes back up
+	Hysteresis float64
+}
+
+// LadderStep is the downscaled video below the bitrate (kbit/s),
+// the scale (0-1) is of the viewport.
+type LadderStep struct {
+	Scale   float64
+	Bitrate uint
+}
+
+// Simulcast is the dual encoding of the video of the rooms:
+// the high layer of the full settings and the low layer of half the size
+// and bitrate for the peers of the bandwidth below the bitrate.
+// It takes about twice as much CPU for the encoding.
+type Simulcast struct {
+	Enabled bool
+	// Bitrate is the bandwidth estimate (kbit/s) of the peers of the low layer,
+	// the half of the max bitrate if zero
+	Bitrate uint
+}
+
+// H264 is the x264 encoder settings.
+type H264 struct {
+	// Crf is the quality of the crf rate control, from 0 (lossless) to 51 (the worst)
+	Crf uint8
+	// Preset is the x264 speed preset (ultrafast ... placebo)
+	Preset string
+	// Profile is the H.264 profile (baseline, main, high)
+	Profile string
+	// Tune is the comma-separated x264 tunes (zerolatency, animation, ...),
+	// only one of them may be a psy tune
+	Tune string
+	// Level is the H.264 level (3.1, 4, ...), the encoder picks it if empty
+	Level string
+	// RateControl is the rate control mode (crf, abr, cbr), crf if empty
+	RateControl string
+	// Bitrate is the target bitrate (kbit/s) of the abr and cbr rate control
+	Bitrate uint
+	// Entropy is the entropy coding (cabac, cavlc) of the main and high profiles,
+	// the baseline profile has only cavlc
+	Entropy  string
+	LogLevel int
+}
+
+// the x264 encoder settings
+const (
+	H264Crf = "crf"
+	H264Abr = "abr"
+	H264Cbr = "cbr"
+
+	H264Cabac = "cabac"
+	H264Cavlc = "cavlc"
+
+	H264Baseline = "baseline"
+
+	MaxH264Crf = 51
+)
+
+// the defaults of the x264 encoder for the wrong values
+const (
+	DefaultH264Preset  = "superfast"
+	DefaultH264Profile = H264Baseline
+	DefaultH264Tune    = "zerolatency"
+)
+
+var (
+	H264Presets  = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"}
+	H264Profiles = []string{H264Baseline, "main", "high"}
+	H264Levels   = []string{"1", "1b", "1.1", "1.2", "1.3", "2", "2.1", "2.2", "3", "3.1", "3.2", "4", "4.1", "4.2",
+		"5", "5.1", "5.2", "6", "6.1", "6.2"}
+	// the psy tunes exclude each other
+	h264PsyTunes = []string{"film", "animation", "grain", "stillimage", "psnr", "ssim"}
+	h264Tunes    = []string{"fastdecode", "zerolatency"}
+)
+
+// Check returns the x264 settings with the wrong values and combinations
+// of them replaced by the defaults. The error lists the changed values.
+func (h H264) Check() (H264, error) {
+	var wrong []string
+	if h.Preset != "" && !oneOf(h.Preset, H264Presets) {
+		wrong = append(wrong, fmt.Sprintf("preset %v -> %v", h.Preset, DefaultH264Preset))
+		h.Preset = DefaultH264Preset
+	}
+	if h.Profile != "" && !oneOf(h.Profile, H264Profiles) {
+		wrong = append(wrong, fmt.Sprintf("profile %v -> %v", h.Profile, DefaultH264Profile))
+		h.Profile = DefaultH264Profile
+	}
+	if h.Tune != "" {
+		psy := 0
+		for _, tune := range strings.Split(h.Tune, ",") {
+			if oneOf(tune, h264PsyTunes) {
+				psy++
+			} else if !oneOf(tune, h264Tunes) {
+				psy = 2
+			}
+		}
+		if psy > 1 {
+			wrong = append(wrong, fmt.Sprintf("tune %v -> %v", h.Tune, DefaultH264Tune))
+			h.Tune = DefaultH264Tune
+		}
+	}
+	if h.Crf > MaxH264Crf {
+		wrong = append(wrong, fmt.Sprintf("crf %v -> %v", h.Crf, MaxH264Crf))
+		h.Crf = MaxH264Crf
+	}
+	if h.Level != "" && !oneOf(h.Level, H264Levels) {
+		wrong = append(wrong, fmt.Sprintf("level %v -> auto", h.Level))
+		h.Level = ""
+	}
+	switch h.RateControl {
+	case "", H264Crf:
+	case H264Abr, H264Cbr:
+		if h.Bitrate == 0 {
+			wrong = append(wrong, fmt.Sprintf("rate control %v without bitrate -> %v", h.RateControl, H264Crf))
+			h.RateControl = H264Crf
+		}
+	default:
+		wrong = append(wrong, fmt.Sprintf("rate control %v -> %v", h.RateControl, H264Crf))
+		h.RateControl = H264Crf
+	}
+	switch h.Entropy {
+	case "", H264Cavlc:
+	case H264Cabac:
+		if h.Profile == H264Baseline {
+			wrong = append(wrong, fmt.Sprintf("entropy %v of the %v profile -> %v", h.Entropy, h.Profile, H264Cavlc))
+			h.Entropy = H264Cavlc
+		}
+	default:
+		wrong = append(wrong, fmt.Sprintf("entropy %v -> auto", h.Entropy))
+		h.Entropy = ""
+	}
+	if len(wrong) > 0 {
+		return h, fmt.Errorf("wrong h264 encoder settings: %v", strings.Join(wrong, ", "))
+	}
+	return h, nil
+}
+
+// Override returns the x264 settings changed with the non-empty settings of the override.
+func (h H264) Override(o H264) H264 {
+	if o.Crf != 0 {
+		h.Crf = o.Crf
+	}
+	if o.Preset != "" {
+		h.Preset = o.Preset
+	}
+	if o.Profile != "" {
+		h.Profile = o.Profile
+	}
+	if o.Tune != "" {
+		h.Tune = o.Tune
+	}
+	if o.Level != "" {
+		h.Level = o.Level
+	}
+	if o.RateControl != "" {
+		h.RateControl = o.RateControl
+	}
+	if o.Bitrate != 0 {
+		h.Bitrate = o.Bitrate
+	}
+	if o.Entropy != "" {
+		h.Entropy = o.Entropy
+	}
+	return h
+}
+
+func oneOf(v string, list []string) bool {
+	for _, s := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// the Opus encoder limits and defaults
+const (
+	DefaultAudioBitrate    = 192000
+	MinAudioBitrate        = 500
+	MaxAudioBitrate        = 512000
+	DefaultAudioComplexity = 10
+	MaxAudioComplexity     = 10
+	MaxAudioPacketLoss     = 100
+)
+
+// Override returns the audio settings changed with the non-zero encoder settings of the override.
+func (a Audio) Override(o Audio) Audio {
+	if o.Resampler != "" {
+		a.Resampler = o.Resampler
+	}
+	if o.Bitrate != 0 {
+		a.Bitrate = o.Bitrate
+	}
+	if o.Complexity != 0 {
+		a.Complexity = o.Complexity
+	}
+	if o.EnableFEC {
+		a.EnableFEC = true
+	}
+	if o.ExpectedPacketLoss != 0 {
+		a.ExpectedPacketLoss = o.ExpectedPacketLoss
+	}
+	return a
+}
+
+// Clamp returns the audio settings with the encoder settings within the limits
+// and the defaults instead of the zero values.
+// The error lists the changed wrong values.
+func (a Audio) Clamp() (Audio, error) {
+	var wrong []string
+	if a.Bitrate == 0 {
+		a.Bitrate = DefaultAudioBitrate
+	}
+	if a.Complexity == 0 {
+		a.Complexity = DefaultAudioComplexity
+	}
+	if b := clamp(a.Bitrate, MinAudioBitrate, MaxAudioBitrate); b != a.Bitrate {
+		wrong = append(wrong, fmt.Sprintf("bitrate %v -> %v", a.Bitrate, b))
+		a.Bitrate = b
+	}
+	if c := clamp(a.Complexity, 1, MaxAudioComplexity); c != a.Complexity {
+		wrong = append(wrong, fmt.Sprintf("complexity %v -> %v", a.Complexity, c))
+		a.Complexity = c
+	}
+	if l := clamp(a.ExpectedPacketLoss, 0, MaxAudioPacketLoss); l != a.ExpectedPacketLoss {
+		wrong = append(wrong, fmt.Sprintf("expected packet loss %v -> %v", a.ExpectedPacketLoss, l))
+		a.ExpectedPacketLoss = l
+	}
+	if len(wrong) > 0 {
+		return a, fmt.Errorf("wrong audio encoder settings: %v", strings.Join(wrong, ", "))
+	}
+	return a, nil
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// opusFrames are the Opus frame durations (ms) of whole milliseconds,
+// from the longest one.
+var opusFrames = []int{60, 40, 20, 10, 5}
+
+// DefaultAudioFrame is the Opus frame duration (ms) of the games without the frame rate.
+const DefaultAudioFrame = 20
+
+// WithFps returns the audio settings of the game of the frame rate,
+// without the frame duration the Opus frames are the longest ones
+// within one video frame of the game, 20ms of PAL (50 FPS) or 10ms of NTSC (60 FPS).
+func (a Audio) WithFps(fps float64) Audio {
+	if a.Frame > 0 {
+		return a
+	}
+	a.Frame = DefaultAudioFrame
+	if fps <= 0 {
+		return a
+	}
+	frame := 1000 / fps
+	for _, f := range opusFrames {
+		a.Frame = f
+		if float64(f) <= frame {
+			break
+		}
 	}
+	return a
 }
 
-func (a *Audio) GetFrameSize() int          { return a.GetFrameSizeFor(a.Frequency) }
-func (a *Audio) GetFrameSizeFor(hz int) int { return hz * a.Frame / 1000 * a.Channels }
+// GetFrameSize returns the number of the samples in one encoder frame.
+func (a *Audio) GetFrameSize() int { return a.Frequency * a.Frame / 1000 * a.Channels }
@@ -0,0 +1,139 @@
+package encoder
+
+import "testing"
+
+func TestAudioClamp(t *testing.T) {
+	tests := []struct {
+		audio Audio
+		want  Audio
+		wrong bool
+	}{
+		{
+			audio: Audio{},
+			want:  Audio{Bitrate: DefaultAudioBitrate, Complexity: DefaultAudioComplexity},
+		},
+		{
+			audio: Audio{Bitrate: 64000, Complexity: 5, EnableFEC: true, ExpectedPacketLoss: 10},
+			want:  Audio{Bitrate: 64000, Complexity: 5, EnableFEC: true, ExpectedPacketLoss: 10},
+		},
+		{
+			audio: Audio{Bitrate: 1, Complexity: 42, ExpectedPacketLoss: -1},
+			want:  Audio{Bitrate: MinAudioBitrate, Complexity: MaxAudioComplexity},
+			wrong: true,
+		},
+		{
+			audio: Audio{Bitrate: 1000000, Complexity: -3, ExpectedPacketLoss: 200},
+			want:  Audio{Bitrate: MaxAudioBitrate, Complexity: 1, ExpectedPacketLoss: MaxAudioPacketLoss},
+			wrong: true,
+		},
+	}
+	for _, test := range tests {
+		audio, err := test.audio.Clamp()
+		if audio != test.want {
+			t.Errorf("wrong clamp of %+v: %+v, expected %+v", test.audio, audio, test.want)
+		}
+		if (err != nil) != test.wrong {
+			t.Errorf("wrong clamp error of %+v: %v", test.audio, err)
+		}
+	}
+}
+
+func TestAudioOverride(t *testing.T) {
+	audio := Audio{Channels: 2, Bitrate: 192000, Complexity: 10}
+	if o := audio.Override(Audio{}); o != audio {
+		t.Errorf("the empty override has changed the settings %+v", o)
+	}
+	o := audio.Override(Audio{Channels: 1, Resampler: "fast", Bitrate: 96000, EnableFEC: true, ExpectedPacketLoss: 5})
+	if want := (Audio{Channels: 2, Resampler: "fast", Bitrate: 96000, Complexity: 10, EnableFEC: true, ExpectedPacketLoss: 5}); o != want {
+		t.Errorf("wrong override %+v, expected %+v", o, want)
+	}
+}
+
+func TestAudioWithFps(t *testing.T) {
+	tests := []struct {
+		audio Audio
+		fps   float64
+		frame int
+		size  int
+	}{
+		// PAL
+		{audio: Audio{Channels: 2, Frequency: 48000}, fps: 50, frame: 20, size: 1920},
+		// NTSC
+		{audio: Audio{Channels: 2, Frequency: 48000}, fps: 60.0988, frame: 10, size: 960},
+		{audio: Audio{Channels: 2, Frequency: 48000}, fps: 59.94, frame: 10, size: 960},
+		{audio: Audio{Channels: 1, Frequency: 48000}, fps: 25, frame: 40, size: 1920},
+		{audio: Audio{Channels: 2, Frequency: 48000}, fps: 240, frame: 5, size: 480},
+		{audio: Audio{Channels: 2, Frequency: 48000}, fps: 0, frame: DefaultAudioFrame, size: 1920},
+		// the config one
+		{audio: Audio{Channels: 2, Frequency: 48000, Frame: 20}, fps: 60, frame: 20, size: 1920},
+	}
+	for _, test := range tests {
+		audio := test.audio.WithFps(test.fps)
+		if audio.Frame != test.frame || audio.GetFrameSize() != test.size {
+			t.Errorf("wrong frame %vms (%v samples) of %v FPS, expected %vms (%v samples)",
+				audio.Frame, audio.GetFrameSize(), test.fps, test.frame, test.size)
+		}
+	}
+}
+
+func TestH264Check(t *testing.T) {
+	tests := []struct {
+		name  string
+		h264  H264
+		want  H264
+		wrong bool
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			h264: H264{Crf: 23, Preset: "veryfast", Profile: "high", Tune: "zerolatency,animation", Level: "4.1",
+				RateControl: H264Cbr, Bitrate: 3000, Entropy: H264Cabac},
+			want: H264{Crf: 23, Preset: "veryfast", Profile: "high", Tune: "zerolatency,animation", Level: "4.1",
+				RateControl: H264Cbr, Bitrate: 3000, Entropy: H264Cabac},
+		},
+		{
+			name:  "baseline cabac",
+			h264:  H264{Profile: H264Baseline, Entropy: H264Cabac},
+			want:  H264{Profile: H264Baseline, Entropy: H264Cavlc},
+			wrong: true,
+		},
+		{
+			name:  "two psy tunes",
+			h264:  H264{Tune: "film,animation"},
+			want:  H264{Tune: DefaultH264Tune},
+			wrong: true,
+		},
+		{
+			name:  "abr without bitrate",
+			h264:  H264{RateControl: H264Abr},
+			want:  H264{RateControl: H264Crf},
+			wrong: true,
+		},
+		{
+			name:  "unknown values",
+			h264:  H264{Crf: 60, Preset: "warp", Profile: "high444", Tune: "fast", Level: "7", RateControl: "vbr", Entropy: "huffman"},
+			want:  H264{Crf: MaxH264Crf, Preset: DefaultH264Preset, Profile: DefaultH264Profile, Tune: DefaultH264Tune, RateControl: H264Crf},
+			wrong: true,
+		},
+	}
+	for _, test := range tests {
+		h264, err := test.h264.Check()
+		if h264 != test.want {
+			t.Errorf("%v: wrong check %+v, expected %+v", test.name, h264, test.want)
+		}
+		if (err != nil) != test.wrong {
+			t.Errorf("%v: wrong check error %v", test.name, err)
+		}
+	}
+}
+
+func TestH264Override(t *testing.T) {
+	h264 := H264{Crf: 17, Preset: "veryfast", Profile: "main", Tune: "zerolatency"}
+	if o := h264.Override(H264{}); o != h264 {
+		t.Errorf("the empty override has changed the settings %+v", o)
+	}
+	o := h264.Override(H264{Preset: "faster", Profile: "high", RateControl: H264Cbr, Bitrate: 2500})
+	if want := (H264{Crf: 17, Preset: "faster", Profile: "high", Tune: "zerolatency", RateControl: H264Cbr, Bitrate: 2500}); o != want {
+		t.Errorf("wrong override %+v, expected %+v", o, want)
+	}
+}
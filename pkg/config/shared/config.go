@@ -1,6 +1,10 @@
 package shared
 
-import flag "github.com/spf13/pflag"
+import (
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
 
 type Server struct {
 	Address string
@@ -17,8 +21,20 @@ type Recording struct {
 	Enabled       bool
 	CompressLevel int
 	Name          string
-	Folder        string
-	Zip           bool
+	// empty -- the recordings dir of the room storage
+	Folder string
+	Zip    bool
+}
+
+// JoinTokens is the config of the signed tokens
+// the sessions join the rooms of the workers with.
+type JoinTokens struct {
+	// the shared secrets of the coordinator and workers,
+	// the first one signs the tokens, the others only check them (rotation),
+	// empty -- no tokens
+	Keys []string
+	// the lifetime of the tokens, 0 -- one minute
+	TTL time.Duration
 }
 
 func (s *Server) WithFlags() {
@@ -3,4 +3,45 @@ package storage
 type Storage struct {
 	Provider string
 	Key      string
+	S3       S3
+	Retry    Retry
+	// the zstd level (1-22) of the uploaded save states,
+	// 0 -- uncompressed
+	Compression int
+	Encryption  Encryption
+}
+
+// Encryption is the config of the encryption (AES-256-GCM) of the save states.
+type Encryption struct {
+	// the keys (32 bytes in hex) in some files (file:<path>)
+	// or env vars (env:<name>), the first one encrypts the states,
+	// the others decrypt the states of the old keys
+	Keys []string
+}
+
+// Retry is the config of the retries of the failed storage requests.
+type Retry struct {
+	// max number of the request attempts, 0 or 1 -- no retries
+	Attempts int
+	// a delay in milliseconds before the first retry,
+	// it doubles with every next one
+	Backoff int
+	// max delay in milliseconds between the retries
+	MaxBackoff int
+}
+
+// S3 is the config of S3-compatible storages (AWS S3, MinIO, etc.).
+type S3 struct {
+	// custom endpoint URL, e.g. http://localhost:9000 for MinIO,
+	// empty -- the default AWS endpoint
+	Endpoint string
+	Bucket   string
+	Region   string
+	// the path to a shared credentials file,
+	// empty -- the default credentials chain (AWS_* env vars, ~/.aws/credentials)
+	CredentialsFile string
+	// use path-style addressing (http://host/bucket/key), needed for MinIO
+	PathStyle bool
+	// a prefix of the object keys, e.g. saves/
+	Prefix string
 }
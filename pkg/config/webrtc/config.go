@@ -1,6 +1,10 @@
 package webrtc
 
-import "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+import (
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+)
 
 type Webrtc struct {
 	DisableDefaultInterceptors bool
@@ -10,9 +14,16 @@ type Webrtc struct {
 		Min uint16
 		Max uint16
 	}
-	IceIpMap   string
-	IceLite    bool
-	SinglePort int
+	IceIpMap string
+	IceLite  bool
+	// a time for the ICE restart of the broken connections
+	// (i.e. network changes) before the peer is dropped,
+	// 0 -- disabled
+	IceRestartTimeout time.Duration
+	// a time the peers with the broken connections (i.e. closed tabs)
+	// keep their seats in the rooms, 0 -- until their sessions end
+	SeatTimeout time.Duration
+	SinglePort  int
 }
 
 type IceServer struct {
@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/giongto35/cloud-game/v2/pkg/config"
 	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
@@ -18,28 +19,194 @@ import (
 )
 
 type Config struct {
-	Encoder   encoder.Encoder
-	Emulator  emulator.Emulator
-	Recording shared.Recording
-	Storage   storage.Storage
-	Worker    Worker
-	Webrtc    webrtcConfig.Webrtc
+	Encoder    encoder.Encoder
+	Emulator   emulator.Emulator
+	JoinTokens shared.JoinTokens
+	Recording  shared.Recording
+	Room       Room
+	Storage    storage.Storage
+	Worker     Worker
+	Webrtc     webrtcConfig.Webrtc
+}
+
+type Room struct {
+	// Achievements are the RetroAchievements of the games of the rooms
+	Achievements Achievements
+	// Bandwidth is the cap of the media sent by each room to its peers
+	Bandwidth Bandwidth
+	// Chat is the text chat of the peers of the rooms
+	Chat Chat
+	// a share of dropped media frames (0..1) of some peer
+	// after which the room will complain about it,
+	// 0 -- disabled
+	DropWarnThreshold float64
+	// a time after which a room without active peers will be closed,
+	// 0 -- disabled
+	IdleTimeout time.Duration
+	// the frames the rooms with two or more players
+	// hold the input of all the players for, 0 -- none
+	InputDelay int
+	// InputLimit limits the input messages of the peers of the rooms
+	InputLimit InputLimit
+	// the max number of the players of a room when the game doesn't tell it,
+	// 0 or more than the emulator ports -- all the ports
+	MaxPlayers int
+	// the max number of the spectators of a room, 0 -- unlimited
+	MaxSpectators int
+	// a time the exported room waits for its new worker
+	// before it goes on, 0 -- one minute
+	MigrationTimeout time.Duration
+	// a time the new room has to load its game (including the core download),
+	// after that the room is closed, 0 -- one minute
+	StartTimeout time.Duration
+	// Stalls is the watch of the media of the rooms whose consumers have stopped
+	Stalls Stalls
+	// Watchdog restarts the hung or exited emulators of the rooms
+	Watchdog Watchdog
+	// Recording is the built-in WebM recording of the rooms
+	Recording struct {
+		// empty -- the recordings dir of the room storage
+		Folder string
+		// the limits of a recording, 0 -- unlimited
+		MaxDuration time.Duration
+		// in megabytes
+		MaxSize int64
+	}
+}
+
+// Achievements are the RetroAchievements (retroachievements.org) of the games,
+// the achievements of the games are cached on the disk.
+type Achievements struct {
+	// the user of the API and its web API token, empty token -- disabled
+	User  string
+	Token string
+	// the address of the API server, empty -- retroachievements.org
+	Api string
+	// the dir of the cached achievements of the games, empty -- no cache
+	Cache string
+}
+
+// Bandwidth is the cap of the media bytes sent by a room to all its peers,
+// the rooms over the cap lower their video bitrate (and resolution).
+type Bandwidth struct {
+	// the max rate of the room in kbit/s, 0 -- unlimited
+	Cap uint
+	// the sliding window of the rate, 0 -- 10s
+	Window time.Duration
+}
+
+// InputLimit is the rate limit of the input messages of each peer,
+// the defaults are well over the input of the 60 Hz games.
+type InputLimit struct {
+	// the input messages per second, 0 -- 1000
+	Rate float64
+	// the messages over the rate a peer may send at once, 0 -- 200
+	Burst int
+	// the dropped (over the rate or malformed) messages per second
+	// after which the peer is disconnected, 0 -- 1000
+	Kick int
+}
+
+// Chat is the text chat of the rooms over the control data channels.
+type Chat struct {
+	// the number of the last messages the new peers get, 0 -- 50
+	History int
+	// the messages per second of a peer, 0 -- 1
+	Rate float64
+	// the max length of a message in characters, 0 -- 200
+	MaxLength int
+}
+
+// Watchdog restarts the hung or exited emulators of the rooms from the last saves.
+type Watchdog struct {
+	// the number of the frame intervals of the game without frames
+	// after which the emulator is hung, 0 -- no hang checks
+	Frames int
+	// the max number of the restarts of the emulator of a room,
+	// after that the room is closed, 0 -- 3
+	Recoveries int
+}
+
+// Stalls is the watch of the media sends of the rooms (the video encoders
+// and the media queues of the peers) whose consumers don't take them.
+type Stalls struct {
+	// the time the media sends may stall for, 0 -- no watch
+	Threshold time.Duration
+	// the action for the peers which haven't taken their media for the threshold,
+	// drop -- drop their media, disconnect -- disconnect them
+	Peer string
+	// the action for the video encoders which haven't taken the frames or
+	// whose frames haven't been taken for the threshold,
+	// drop -- drop the frames, restart -- restart the encoder pipe
+	Encoder string
 }
 
 type Worker struct {
+	// Admission is the admission control of the new rooms
+	// by the CPU budget of the worker
+	Admission Admission
+	// the admin API of the rooms on the worker server,
+	// it takes the requests with the token only
+	// (Authorization: Bearer <token>), empty token -- disabled
+	Admin struct {
+		Endpoint string
+		Token    string
+	}
 	Monitoring monitoring.Config
 	Network    struct {
 		CoordinatorAddress string
 		Endpoint           string
 		PingEndpoint       string
-		PublicAddress      string
-		Secure             bool
-		Zone               string
+		// the Prometheus metrics endpoint of the worker server
+		// (along with the monitoring server one), empty -- disabled
+		MetricsEndpoint string
+		PublicAddress   string
+		Secure          bool
+		Zone            string
 	}
 	Server shared.Server
 	Tag    string
+	// a time after which the draining worker (i.e. on shutdown)
+	// closes the rooms with the peers, 0 -- at once
+	DrainTimeout time.Duration
+	// the max number of the rooms of the worker
+	// the coordinator gives it, 0 -- unlimited
+	MaxRooms int
 }
 
+// Admission estimates the CPU cost of the rooms and
+// rejects the new rooms over the CPU budget of the worker
+// (cores x utilization), so the coordinator gives them to other workers.
+type Admission struct {
+	// what to do with the new rooms over the budget:
+	//   - off (default), no checks
+	//   - soft, the rooms are only logged
+	//   - hard, the rooms are rejected
+	Mode string
+	// the number of the CPU cores of the budget, 0 -- all the cores
+	Cores int
+	// the share (0-1) of the cores the rooms may use, 0 -- 0.8
+	Utilization float64
+	// the CPU costs (in cores) of the emulation of the games of the cores
+	// by their names in the emulator list
+	Costs map[string]float64
+	// the cost of the emulation of the cores without the costs, 0 -- 0.2
+	DefaultCost float64
+	// the cost of the encoding of one megapixel of the viewport
+	// (at 60 fps), 0 -- 1
+	PixelCost float64
+	// the weight (0-1) of the measured costs of the rooms
+	// in the estimates of their cores, 0 -- 0.2
+	LearningRate float64
+}
+
+// The admission modes of the new rooms.
+const (
+	AdmissionOff  = "off"
+	AdmissionSoft = "soft"
+	AdmissionHard = "hard"
+)
+
 // allows custom config path
 var configPath string
 
@@ -65,7 +232,7 @@ func (c *Config) ParseFlags() {
 // expandSpecialTags replaces all the special tags in the config.
 func (c *Config) expandSpecialTags() {
 	tag := "{user}"
-	for _, dir := range []*string{&c.Emulator.Storage, &c.Emulator.Libretro.Cores.Repo.ExtLock} {
+	for _, dir := range []*string{&c.Emulator.Storage, &c.Emulator.Cheats, &c.Emulator.RomCache.Path, &c.Emulator.Libretro.Cores.Repo.ExtLock, &c.Room.Achievements.Cache} {
 		if *dir == "" || !strings.Contains(*dir, tag) {
 			continue
 		}
@@ -83,6 +250,11 @@ func (c *Config) fixValues() {
 	if c.Webrtc.IceLite {
 		c.Webrtc.IceServers = []webrtcConfig.IceServer{}
 	}
+	h264, err := c.Encoder.Video.H264.Check()
+	if err != nil {
+		log.Printf("warn: %v", err)
+	}
+	c.Encoder.Video.H264 = h264
 }
 
 // GetAddr returns defined in the config server address.
@@ -13,6 +13,10 @@ type BrowserClient struct {
 	SessionID string
 	RoomID    string
 	WorkerID  string // TODO: how about pointer to workerClient?
+	// the reconnect token of the room seat of the session
+	reconnect string
+	// the user ID of the session from the auth proxy, empty -- anonymous
+	User string
 }
 
 // NewCoordinatorClient returns a client connecting to browser.
@@ -7,6 +7,7 @@ import (
 	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
 	"github.com/giongto35/cloud-game/v2/pkg/games"
 	"github.com/giongto35/cloud-game/v2/pkg/monitoring"
+	"github.com/giongto35/cloud-game/v2/pkg/os"
 	"github.com/giongto35/cloud-game/v2/pkg/service"
 )
 
@@ -15,10 +16,22 @@ func New(conf coordinator.Config) (services service.Group) {
 	httpSrv, err := NewHTTPServer(conf, func(mux *http.ServeMux) {
 		mux.HandleFunc("/ws", srv.WS)
 		mux.HandleFunc("/wso", srv.WSO)
+		mux.HandleFunc("/screenshot", srv.Screenshot)
+		mux.HandleFunc("/save-thumbnail", srv.SaveThumbnail)
+		mux.HandleFunc("/save-export", srv.ExportSave)
+		mux.HandleFunc("/rescan", srv.Rescan)
+		mux.HandleFunc("/lobby", srv.Lobby)
+		mux.HandleFunc("/leave", srv.Leave)
 	})
 	if err != nil {
 		log.Fatalf("http init fail: %v", err)
 	}
+	// rescan the games library on SIGHUP
+	go func() {
+		for range os.ExpectReload() {
+			srv.library.Rescan()
+		}
+	}()
 	services.Add(srv, httpSrv)
 	if conf.Coordinator.Monitoring.IsEnabled() {
 		services.Add(monitoring.New(conf.Coordinator.Monitoring, httpSrv.GetHost(), "cord"))
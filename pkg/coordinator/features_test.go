@@ -0,0 +1,148 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// newFeatureTest starts the coordinator with the worker of the connection request,
+// the worker answers the rewinds and the saves.
+func newFeatureTest(t *testing.T, conn api.ConnectionRequest) (*Server, *httptest.Server, *testWorker, string) {
+	conf := coordinator.Config{}
+	conf.Coordinator.ReconnectTTL = time.Minute
+	s := NewServer(conf, testLibrary{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.WS)
+	mux.HandleFunc("/wso", s.WSO)
+	mux.HandleFunc("/leave", s.Leave)
+	srv := httptest.NewServer(mux)
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+	w := newTestWorkerWith(t, host, conn)
+	for _, id := range []string{api.GameRewind, api.GameSave} {
+		id := id
+		w.Receive(id, func(resp cws.WSPacket) cws.WSPacket { return cws.WSPacket{ID: id, Data: "ok"} })
+	}
+	time.Sleep(100 * time.Millisecond)
+	return s, srv, w, host
+}
+
+// Tests that the new coordinator doesn't send the commands
+// of the new features to the old worker and tells it the browser.
+func TestOldWorker(t *testing.T) {
+	s, srv, worker, host := newFeatureTest(t, api.ConnectionRequest{PingURL: "ping"})
+	defer srv.Close()
+	defer worker.Close()
+
+	browser := newTestBrowser(t, host, "")
+	defer browser.Close()
+	joined := startGame(t, browser)
+
+	tests := []struct {
+		id      string
+		feature string
+	}{
+		{id: api.GameRewind, feature: api.FeatureRewind},
+		{id: api.GameSaveSlot, feature: api.FeatureSaveSlots},
+		{id: api.GameSlots, feature: api.FeatureSaveSlots},
+		{id: api.GameConnectionStats, feature: api.FeatureStatsV2},
+		{id: api.GameImportSave, feature: api.FeatureSaveFiles},
+		{id: api.GameFork, feature: api.FeatureForks},
+	}
+	for _, test := range tests {
+		resp := syncSend(t, browser, cws.WSPacket{ID: test.id, RoomID: joined.RoomID})
+		if resp.Data != api.UnsupportedError(test.feature) {
+			t.Errorf("wrong response %q to %v, expected %q", resp.Data, test.id, api.UnsupportedError(test.feature))
+		}
+	}
+	// the base commands are relayed as before
+	if resp := syncSend(t, browser, cws.WSPacket{ID: api.GameSave, RoomID: joined.RoomID}); resp.Data != "ok" {
+		t.Errorf("the save hasn't been relayed, %+v", resp)
+	}
+
+	for _, wc := range s.workerClients {
+		if _, err := wc.GetRoomStats(joined.RoomID); err == nil || !strings.HasPrefix(err.Error(), api.Unsupported) {
+			t.Errorf("wrong error %v of the room stats", err)
+		}
+		if err := s.MigrateRoom(joined.RoomID, wc.WorkerID); err == nil {
+			t.Errorf("the room has moved")
+		}
+	}
+}
+
+// Tests that the workers get the commands of their features
+// and the ones they don't know are acked with the errors instead of the timeouts.
+func TestNewWorker(t *testing.T) {
+	s, srv, worker, host := newFeatureTest(t,
+		api.ConnectionRequest{PingURL: "ping", Version: api.ProtocolVersion, Features: api.Features})
+	defer srv.Close()
+	defer worker.Close()
+
+	browser := newTestBrowser(t, host, "")
+	defer browser.Close()
+	joined := startGame(t, browser)
+
+	if resp := syncSend(t, browser, cws.WSPacket{ID: api.GameRewind, RoomID: joined.RoomID}); resp.Data != "ok" {
+		t.Errorf("the rewind hasn't been relayed, %+v", resp)
+	}
+	// the worker doesn't have the handler of the room stats
+	for _, wc := range s.workerClients {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := wc.GetRoomStats(joined.RoomID)
+			errs <- err
+		}()
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Errorf("no error of the unknown command")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the unknown command hasn't been acked")
+		}
+	}
+}
+
+// Tests that the passwords and the save files of the browsers
+// go to the workers of their rooms only.
+func TestRoomCommands(t *testing.T) {
+	_, srv, worker, host := newFeatureTest(t,
+		api.ConnectionRequest{PingURL: "ping", Version: api.ProtocolVersion, Features: api.Features})
+	defer srv.Close()
+	defer worker.Close()
+	relayed := make(chan cws.WSPacket, 2)
+	for _, id := range []string{api.GamePassword, api.GameImportSave} {
+		id := id
+		worker.Receive(id, func(resp cws.WSPacket) cws.WSPacket {
+			relayed <- resp
+			return cws.WSPacket{ID: id, Data: "ok"}
+		})
+	}
+
+	browser := newTestBrowser(t, host, "")
+	defer browser.Close()
+	for _, id := range []string{api.GamePassword, api.GameImportSave} {
+		if resp := syncSend(t, browser, cws.WSPacket{ID: id, Data: "{}"}); resp.ID != id || resp.Data != "error" {
+			t.Errorf("wrong response %+v to %v without the room", resp, id)
+		}
+	}
+	if len(relayed) != 0 {
+		t.Errorf("the commands without the room have been relayed")
+	}
+
+	joined := startGame(t, browser)
+	for _, id := range []string{api.GamePassword, api.GameImportSave} {
+		if resp := syncSend(t, browser, cws.WSPacket{ID: id, Data: "{}"}); resp.Data != "ok" {
+			t.Errorf("the %v hasn't been relayed, %+v", id, resp)
+		}
+		if resp := <-relayed; resp.RoomID != joined.RoomID || resp.SessionID == "" {
+			t.Errorf("wrong relayed %v of the room %v (%v)", id, resp.RoomID, resp.SessionID)
+		}
+	}
+}
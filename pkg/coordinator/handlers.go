@@ -3,21 +3,23 @@ package coordinator
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"github.com/rs/xid"
 	"log"
-	"math"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
 	"github.com/giongto35/cloud-game/v2/pkg/cws"
 	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
 	"github.com/giongto35/cloud-game/v2/pkg/games"
 	"github.com/giongto35/cloud-game/v2/pkg/ice"
 	"github.com/giongto35/cloud-game/v2/pkg/network/websocket"
 	"github.com/giongto35/cloud-game/v2/pkg/service"
+	"github.com/giongto35/cloud-game/v2/pkg/session"
 	"github.com/gofrs/uuid"
 )
 
@@ -33,6 +35,19 @@ type Server struct {
 	workerClients map[string]*WorkerClient
 	// browserClients are the map sessionID to browser Client
 	browserClients map[string]*BrowserClient
+	// mu guards the maps of the rooms and clients
+	// against the goroutines other than the ones of the connections
+	mu sync.RWMutex
+	// thumbnails are the cached screenshots of the rooms
+	thumbnails thumbnails
+	// reconnects are the room seats of the gone sessions by their tokens
+	reconnects *session.Reconnects
+	// lobby is the list of the public rooms of the workers
+	lobby *lobby
+	// joins mints the tokens of the sessions to join the rooms of the workers
+	joins *session.JoinTokens
+	// turn mints the TURN credentials of the sessions
+	turn *ice.Turn
 
 	userWsUpgrader, workerWsUpgrader websocket.Upgrader
 }
@@ -50,11 +65,20 @@ func NewServer(cfg coordinator.Config, library games.GameLibrary) *Server {
 		workerClients: map[string]*WorkerClient{},
 		// Mapping sessionID to browser
 		browserClients: map[string]*BrowserClient{},
+		thumbnails:     thumbnails{ttl: thumbnailTTL, cache: map[string]thumbnail{}, now: time.Now},
+		reconnects:     session.NewReconnects(cfg.Coordinator.ReconnectTTL),
+		lobby:          newLobby(lobbyTTL),
+		joins:          session.NewJoinTokens(cfg.JoinTokens.Keys, cfg.JoinTokens.TTL),
+		turn:           ice.NewTurn(cfg.Coordinator.Turn.Secret, cfg.Coordinator.Turn.TTL),
 	}
 
 	// a custom Origin check
 	s.workerWsUpgrader = websocket.NewUpgrader(cfg.Coordinator.Origin.WorkerWs)
 	s.userWsUpgrader = websocket.NewUpgrader(cfg.Coordinator.Origin.UserWs)
+	s.watchLibrary()
+	if cfg.Coordinator.UserHeader != "" && !s.joins.Enabled() {
+		log.Printf("Warn: the users are anonymous for the workers without the join token keys")
+	}
 
 	return s
 }
@@ -110,18 +134,29 @@ func (s *Server) WSO(w http.ResponseWriter, r *http.Request) {
 	wc.PingServer = connRt.PingURL
 	wc.Port = connRt.Port
 	wc.Tag = connRt.Tag
+	wc.SetFeatures(connRt.Version, connRt.Features)
+	if connRt.Version < api.ProtocolVersion {
+		wc.Printf("Warn: the worker has the old protocol version %v, it gets only the commands of its features %v",
+			connRt.Version, connRt.Features)
+	}
+	wc.maxLoad = s.cfg.Coordinator.MaxWorkerLoad
 
 	addr := getIP(c.RemoteAddr())
 	wc.Printf("id: %v | addr: %v | zone: %v | ping: %v | tag: %v", wc.Id, addr, wc.Zone, wc.PingServer, wc.Tag)
-	wc.StunTurnServer = ice.ToJson(s.cfg.Webrtc.IceServers, ice.Replacement{From: "server-ip", To: addr})
+	wc.IceServers = ice.Replace(s.cfg.Webrtc.IceServers, ice.Replacement{From: "server-ip", To: addr})
 
 	// Attach to Server instance with workerID, add defer
+	s.mu.Lock()
 	s.workerClients[workerID] = wc
+	s.mu.Unlock()
 	defer s.cleanWorker(wc, workerID)
 
 	wc.Send(api.ServerIdPacket(workerID), nil)
 
 	s.workerRoutes(wc)
+	if timeout := s.cfg.Coordinator.WorkerTimeout; timeout > 0 {
+		go s.watchHeartbeats(wc, timeout)
+	}
 	wc.Listen()
 }
 
@@ -154,6 +189,9 @@ func (s *Server) WS(w http.ResponseWriter, r *http.Request) {
 	// Create browserClient instance
 	bc := NewBrowserClient(c, sessionID)
 	bc.Println("Generated worker ID")
+	if header := s.cfg.Coordinator.UserHeader; header != "" {
+		bc.User = r.Header.Get(header)
+	}
 
 	// Run browser listener first (to capture ping)
 	go bc.Listen()
@@ -227,11 +265,14 @@ func (s *Server) WS(w http.ResponseWriter, r *http.Request) {
 	bc.WorkerID = wc.WorkerID
 
 	wc.ChangeUserQuantityBy(1)
-	defer wc.ChangeUserQuantityBy(-1)
+	// the session may move to another worker with its room
+	defer func() { wc.ChangeUserQuantityBy(-1) }()
 
 	// Everything is cool
 	// Attach to Server instance with sessionID
+	s.mu.Lock()
 	s.browserClients[sessionID] = bc
+	s.mu.Unlock()
 	defer s.cleanBrowser(bc, sessionID)
 
 	// Routing browserClient message
@@ -239,11 +280,25 @@ func (s *Server) WS(w http.ResponseWriter, r *http.Request) {
 
 	bc.Send(cws.WSPacket{
 		ID:   "init",
-		Data: createInitPackage(wc.Id, wc.StunTurnServer, s.library.GetAll()),
+		Data: createInitPackage(wc.Id, ice.ToJson(s.iceServers(wc, sessionID)), s.library.GetAll()),
 	}, nil)
 
 	// If peerconnection is done (client.Done is signalled), we close peerconnection
 	<-bc.Done
+	s.mu.RLock()
+	if w, ok := s.workerClients[bc.WorkerID]; ok {
+		wc = w
+	}
+	s.mu.RUnlock()
+
+	// the session keeps its seat in the room for a while,
+	// the worker cleans it if nobody comes back with the token
+	if s.reconnects.Leave(bc.reconnect, func(seat session.Seat) {
+		wc.Send(api.TerminateSessionPacket(seat.SessionID), nil)
+	}) {
+		bc.Printf("Keeping the seat in the room %v for reconnect", bc.RoomID)
+		return
+	}
 
 	// Notify worker to clean session
 	wc.Send(api.TerminateSessionPacket(sessionID), nil)
@@ -273,35 +328,23 @@ func (s *Server) getAvailableWorkers() map[string]*WorkerClient {
 // findBestServerFromBrowser returns the best server for a session
 // All workers addresses are sent to user and user will ping to get latency
 func (s *Server) findBestServerFromBrowser(workerClients map[string]*WorkerClient, client *BrowserClient, zone string) (string, error) {
-	// TODO: Find best Server by latency, currently return by ping
 	if len(workerClients) == 0 {
-		return "", errors.New("no server found")
+		return "", errNoWorker
 	}
 
 	latencies := s.getLatencyMapFromBrowser(workerClients, client)
 	client.Println("Latency map", latencies)
 
-	if len(latencies) == 0 {
-		return "", errors.New("no server found")
-	}
-
-	var bestWorker *WorkerClient
-	var minLatency int64 = math.MaxInt64
-
-	// get the worker with lowest latency to user
-	for wc, l := range latencies {
-		if zone != "" && wc.Zone != zone {
-			// skip worker not in the zone if zone param is given
-			continue
-		}
-
-		if l < minLatency {
-			bestWorker = wc
-			minLatency = l
+	workers := make([]workerChoice, 0, len(workerClients))
+	for _, wc := range workerClients {
+		w := workerChoice{id: wc.WorkerID, zone: wc.Zone, latency: -1}
+		if l, ok := latencies[wc]; ok {
+			w.latency = l
 		}
+		w.rooms, w.load = wc.Load()
+		workers = append(workers, w)
 	}
-
-	return bestWorker.WorkerID, nil
+	return pickWorker(workers, zone)
 }
 
 // getLatencyMapFromBrowser get all latencies from worker to user
@@ -345,7 +388,9 @@ func (s *Server) getLatencyMapFromBrowser(workerClients map[string]*WorkerClient
 // cleanBrowser is called when a browser is disconnected
 func (s *Server) cleanBrowser(bc *BrowserClient, sessionID string) {
 	bc.Println("Disconnect from coordinator")
+	s.mu.Lock()
 	delete(s.browserClients, sessionID)
+	s.mu.Unlock()
 	bc.Close()
 }
 
@@ -353,6 +398,7 @@ func (s *Server) cleanBrowser(bc *BrowserClient, sessionID string) {
 // connection from worker to coordinator is also closed
 func (s *Server) cleanWorker(wc *WorkerClient, workerID string) {
 	wc.Println("Unregister worker from coordinator")
+	s.mu.Lock()
 	// Remove workerID from workerClients
 	delete(s.workerClients, workerID)
 	// Clean all rooms connecting to that server
@@ -360,12 +406,22 @@ func (s *Server) cleanWorker(wc *WorkerClient, workerID string) {
 		if roomServer == workerID {
 			wc.Printf("Remove room %s", roomID)
 			delete(s.roomToWorker, roomID)
+			s.thumbnails.remove(roomID)
+			s.roomGone(roomID, workerID)
 		}
 	}
+	s.mu.Unlock()
+	s.lobby.remove(workerID)
 
 	wc.Close()
 }
 
+// iceServers returns the ICE servers of the worker for the session
+// with new TURN credentials of the session.
+func (s *Server) iceServers(wc *WorkerClient, sessionID string) []webrtc.IceServer {
+	return s.turn.WithCredentials(wc.IceServers, sessionID)
+}
+
 // createInitPackage returns xid + serverhost + game list in encoded wspacket format
 // This package will be sent to initialize
 func createInitPackage(id xid.ID, stunturn string, games []games.GameMetadata) string {
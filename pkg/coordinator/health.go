@@ -0,0 +1,39 @@
+package coordinator
+
+import (
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// watchHeartbeats drops the worker that has missed its heartbeats
+// for the timeout (i.e. the worker has died without closing its connection),
+// the worker is unregistered with its rooms after that.
+func (s *Server) watchHeartbeats(wc *WorkerClient, timeout time.Duration) {
+	t := time.NewTicker(timeout / 4)
+	defer t.Stop()
+	for {
+		select {
+		case <-wc.Done:
+			return
+		case <-t.C:
+			if since := wc.sinceBeat(); since > timeout {
+				wc.Printf("warn: no heartbeats for %v, the worker is gone", since.Round(time.Millisecond))
+				wc.SetGone()
+				wc.Close()
+				return
+			}
+		}
+	}
+}
+
+// roomGone tells the browsers of the room of the gone worker about it,
+// they start the room again from its cloud save.
+// Should be called under the server lock.
+func (s *Server) roomGone(roomID string, workerID string) {
+	for _, bc := range s.browserClients {
+		if bc.RoomID == roomID && bc.WorkerID == workerID {
+			bc.Send(api.RoomErrorPacket(roomID, api.RoomGone), nil)
+		}
+	}
+}
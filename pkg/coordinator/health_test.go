@@ -0,0 +1,147 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// Tests that the workers without the heartbeats are dropped
+// with their rooms, and the reconnected workers get their rooms back.
+func TestWorkerHeartbeatExpiry(t *testing.T) {
+	conf := coordinator.Config{}
+	conf.Coordinator.ReconnectTTL = time.Minute
+	conf.Coordinator.WorkerTimeout = 300 * time.Millisecond
+	s := NewServer(conf, testLibrary{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.WS)
+	mux.HandleFunc("/wso", s.WSO)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// the worker hangs without the heartbeats
+	hung := newTestWorker(t, host)
+	defer hung.Close()
+	time.Sleep(100 * time.Millisecond)
+	browser := newTestBrowser(t, host, "")
+	defer browser.Close()
+	gone := make(chan string, 1)
+	browser.Receive(api.RoomError, func(resp cws.WSPacket) cws.WSPacket {
+		gone <- resp.Data
+		return cws.EmptyPacket
+	})
+	joined := startGame(t, browser)
+
+	select {
+	case err := <-gone:
+		if err != api.RoomGone {
+			t.Errorf("wrong room error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the browser hasn't been told about the gone worker")
+	}
+	s.mu.RLock()
+	if len(s.workerClients) != 0 || len(s.roomToWorker) != 0 {
+		t.Errorf("the gone worker is kept %v with the rooms %v", s.workerClients, s.roomToWorker)
+	}
+	s.mu.RUnlock()
+
+	// the worker is back with heartbeats and its room
+	back := newTestWorker(t, host)
+	defer back.Close()
+	// the heartbeats of the worker are more frequent than the timeout
+	go func() {
+		for {
+			select {
+			case <-back.Done:
+				return
+			case <-time.After(conf.Coordinator.WorkerTimeout / 4):
+				back.Send(cws.HeartbeatPacket, nil)
+			}
+		}
+	}()
+	back.Send(api.RegisterRoomPacket(joined.RoomID), nil)
+	time.Sleep(2 * conf.Coordinator.WorkerTimeout)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.workerClients) != 1 {
+		t.Fatalf("the live worker has been dropped")
+	}
+	for id, wc := range s.workerClients {
+		if s.roomToWorker[joined.RoomID] != id {
+			t.Errorf("the room %v hasn't been registered again, %v", joined.RoomID, s.roomToWorker)
+		}
+		if !wc.HasGameSlot() {
+			t.Errorf("the live worker doesn't get new games")
+		}
+	}
+}
+
+func TestWorkerGone(t *testing.T) {
+	wc := &WorkerClient{lastBeat: time.Now().Add(-time.Minute)}
+	if wc.sinceBeat() < time.Minute {
+		t.Errorf("wrong time since the last heartbeat %v", wc.sinceBeat())
+	}
+	wc.Beat()
+	if wc.sinceBeat() > time.Second {
+		t.Errorf("the heartbeat hasn't been registered")
+	}
+	wc.SetGone()
+	if wc.HasGameSlot() {
+		t.Errorf("the gone worker has a game slot")
+	}
+}
+
+// Tests that the room errors of the worker go to the browsers
+// of their sessions, the starting browsers have no rooms yet.
+func TestRoomErrorSession(t *testing.T) {
+	srv, worker := newTestServer(t, time.Minute)
+	defer srv.Close()
+	defer worker.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	var errs []chan string
+	for _, room := range []string{"", worker.room} {
+		browser := newTestBrowser(t, host, room)
+		defer browser.Close()
+		failed := make(chan string, 1)
+		browser.Receive(api.RoomError, func(resp cws.WSPacket) cws.WSPacket {
+			failed <- resp.Data
+			return cws.EmptyPacket
+		})
+		startGame(t, browser)
+		errs = append(errs, failed)
+	}
+	worker.mu.Lock()
+	var session string
+	for id, player := range worker.players {
+		if player == 2 {
+			session = id
+		}
+	}
+	worker.mu.Unlock()
+
+	packet := api.RoomErrorPacket("", api.RoomCrashed)
+	packet.SessionID = session
+	worker.Send(packet, nil)
+	select {
+	case err := <-errs[0]:
+		if err != api.RoomCrashed {
+			t.Errorf("wrong room error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the browser hasn't got the room error of its session")
+	}
+	select {
+	case err := <-errs[1]:
+		t.Errorf("the room error %v of another session", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
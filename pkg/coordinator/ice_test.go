@@ -0,0 +1,35 @@
+package coordinator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
+	"github.com/giongto35/cloud-game/v2/pkg/ice"
+)
+
+func TestSessionIceServers(t *testing.T) {
+	conf := coordinator.Config{}
+	conf.Coordinator.Turn.Secret = "secret"
+	s := NewServer(conf, testLibrary{})
+	wc := &WorkerClient{IceServers: ice.Replace([]webrtc.IceServer{
+		ice.NewIceServer("stun:{server-ip}:3478"),
+		ice.NewIceServer("turn:{server-ip}:3478"),
+	}, ice.Replacement{From: "server-ip", To: "10.0.0.1"})}
+
+	servers := s.iceServers(wc, "session1")
+	if servers[0].Url != "stun:10.0.0.1:3478" || servers[0].Username != "" {
+		t.Errorf("wrong STUN server %+v", servers[0])
+	}
+	turn := servers[1]
+	if turn.Url != "turn:10.0.0.1:3478" || !strings.HasSuffix(turn.Username, ":session1") {
+		t.Errorf("wrong TURN server %+v", turn)
+	}
+	if !s.turn.Valid(turn.Username, turn.Credential) {
+		t.Errorf("wrong TURN credentials %+v", turn)
+	}
+	if wc.IceServers[1].Username != "" {
+		t.Errorf("the worker servers have got the credentials of the session")
+	}
+}
@@ -9,8 +9,17 @@ import (
 	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
 )
 
+// handleHeartbeat takes the load of the worker from its heartbeat.
 func (wc *WorkerClient) handleHeartbeat() cws.PacketHandler {
 	return func(resp cws.WSPacket) cws.WSPacket {
+		wc.Beat()
+		if resp.Data != "" {
+			load := api.WorkerLoad{}
+			if err := load.From(resp.Data); err == nil {
+				wc.SetLoad(load)
+			}
+			resp.Data = ""
+		}
 		return resp
 	}
 }
@@ -33,6 +42,16 @@ func GetConnectionRequest(data string) (api.ConnectionRequest, error) {
 func (wc *WorkerClient) handleRegisterRoom(s *Server) cws.PacketHandler {
 	return func(resp cws.WSPacket) cws.WSPacket {
 		log.Printf("Coordinator: Received registerRoom room %s from worker %s", resp.Data, wc.WorkerID)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// the room of the gone worker may have started on another one,
+		// the room with the same ID of the reconnected worker doesn't take it
+		if id, ok := s.roomToWorker[resp.Data]; ok && id != wc.WorkerID {
+			if _, live := s.workerClients[id]; live {
+				log.Printf("warn: the room %s runs on the worker %s already", resp.Data, id)
+				return api.RegisterRoomPacket(api.NoData)
+			}
+		}
 		s.roomToWorker[resp.Data] = wc.WorkerID
 		log.Printf("Coordinator: Current room list is: %+v", s.roomToWorker)
 		return api.RegisterRoomPacket(api.NoData)
@@ -52,12 +71,52 @@ func (wc *WorkerClient) handleGetRoom(s *Server) cws.PacketHandler {
 func (wc *WorkerClient) handleCloseRoom(s *Server) cws.PacketHandler {
 	return func(resp cws.WSPacket) cws.WSPacket {
 		log.Printf("Coordinator: Received closeRoom room %s from worker %s", resp.Data, wc.WorkerID)
-		delete(s.roomToWorker, resp.Data)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// the room may have moved to another worker
+		if s.roomToWorker[resp.Data] == wc.WorkerID {
+			delete(s.roomToWorker, resp.Data)
+			s.thumbnails.remove(resp.Data)
+		}
 		log.Printf("Coordinator: Current room list is: %+v", s.roomToWorker)
 		return api.CloseRoomPacket(api.NoData)
 	}
 }
 
+// handleWorkerDrain takes the draining worker out of the game scheduling
+// and moves its rooms to the free workers.
+func (wc *WorkerClient) handleWorkerDrain(s *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) cws.WSPacket {
+		wc.Printf("Worker drain status: %v", resp.Data)
+		wc.SetDraining()
+		if resp.Data == api.WorkerDraining {
+			s.moveRooms(wc)
+		}
+		return cws.EmptyPacket
+	}
+}
+
+// handleRoomError passes the error of a room that couldn't start to its browser
+// by the session ID of the packet, the browsers get their rooms only after the start.
+// The errors without the session go to the browsers of the room.
+func (wc *WorkerClient) handleRoomError(s *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) cws.WSPacket {
+		log.Printf("Coordinator: room %s of worker %s has failed, %s", resp.RoomID, wc.WorkerID, resp.Data)
+		if resp.SessionID != "" {
+			if bc, ok := s.browserClients[resp.SessionID]; ok {
+				bc.Send(api.RoomErrorPacket(resp.RoomID, resp.Data), nil)
+			}
+			return cws.EmptyPacket
+		}
+		for _, bc := range s.browserClients {
+			if bc.RoomID == resp.RoomID {
+				bc.Send(api.RoomErrorPacket(resp.RoomID, resp.Data), nil)
+			}
+		}
+		return cws.EmptyPacket
+	}
+}
+
 // handleIceCandidate passes an ICE candidate (WebRTC) to the browser.
 func (wc *WorkerClient) handleIceCandidate(s *Server) cws.PacketHandler {
 	return func(resp cws.WSPacket) cws.WSPacket {
@@ -73,3 +132,18 @@ func (wc *WorkerClient) handleIceCandidate(s *Server) cws.PacketHandler {
 		return cws.EmptyPacket
 	}
 }
+
+// handleOffer passes an SDP offer of the ICE restart (WebRTC) to the browser.
+func (wc *WorkerClient) handleOffer(s *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) cws.WSPacket {
+		wc.Println("Received ICE restart offer from worker -> relay to browser")
+		bc, ok := s.browserClients[resp.SessionID]
+		if ok {
+			resp.SessionID = ""
+			bc.Send(resp, nil)
+		} else {
+			wc.Println("Error: unknown SessionID:", resp.SessionID)
+		}
+		return cws.EmptyPacket
+	}
+}
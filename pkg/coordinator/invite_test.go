@@ -0,0 +1,73 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/session"
+)
+
+// Tests that the new players of the running room get the join tokens
+// only with the invites of the owner and the spectators get them right away.
+func TestJoinTokenInvite(t *testing.T) {
+	conf := coordinator.Config{}
+	conf.Coordinator.ReconnectTTL = time.Minute
+	conf.JoinTokens.Keys = []string{"secret"}
+	s := NewServer(conf, testLibrary{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.WS)
+	mux.HandleFunc("/wso", s.WSO)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+	worker := newTestWorker(t, host)
+	defer worker.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	owner := newTestBrowser(t, host, "")
+	defer owner.Close()
+	token := syncSend(t, owner, cws.WSPacket{ID: api.GameJoinToken, Data: "{}"})
+	if token.Data == "error" || token.Data == api.JoinForbidden {
+		t.Fatalf("no join token of the new room, %+v", token)
+	}
+	joined := startGame(t, owner)
+	time.Sleep(100 * time.Millisecond)
+
+	invites := session.NewJoinTokens(conf.JoinTokens.Keys, 0)
+	s.mu.RLock()
+	workerID := s.roomToWorker[joined.RoomID]
+	s.mu.RUnlock()
+	invite, _ := invites.MintInvite(workerID, joined.RoomID)
+	other, _ := invites.MintInvite(workerID, "another room")
+
+	tests := []struct {
+		name      string
+		request   api.GameJoinTokenRequest
+		forbidden bool
+	}{
+		{name: "no invite", forbidden: true},
+		{name: "the invite", request: api.GameJoinTokenRequest{Invite: invite}},
+		{name: "the invite of another room", request: api.GameJoinTokenRequest{Invite: other}, forbidden: true},
+		{name: "the spectator", request: api.GameJoinTokenRequest{Spectator: true}},
+	}
+	guest := newTestBrowser(t, host, joined.RoomID)
+	defer guest.Close()
+	for _, test := range tests {
+		data, _ := test.request.To()
+		resp := syncSend(t, guest, cws.WSPacket{ID: api.GameJoinToken, RoomID: joined.RoomID, Data: data})
+		if forbidden := resp.Data == api.JoinForbidden; forbidden != test.forbidden || resp.Data == "error" {
+			t.Errorf("%v: got the join token %q", test.name, resp.Data)
+		}
+	}
+
+	// the players of the room
+	if resp := syncSend(t, owner, cws.WSPacket{ID: api.GameJoinToken, RoomID: joined.RoomID, Data: "{}"}); resp.Data == api.JoinForbidden {
+		t.Errorf("the owner has been forbidden to join its room")
+	}
+}
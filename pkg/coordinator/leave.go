@@ -0,0 +1,52 @@
+package coordinator
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// maxLeaveSize is the max size of the leave beacons,
+// they have only the reconnect tokens.
+const maxLeaveSize = 256
+
+// Leave releases the seat of the session which has closed its tab,
+// the beacon of the page (POST) has the reconnect token of the seat.
+// It's the fallback of the leave command of the control channel,
+// the worker releases the seat right away, but the token is still valid
+// until the reconnect TTL (i.e. it's a page reload).
+func (s *Server) Leave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	token, err := ioutil.ReadAll(io.LimitReader(r.Body, maxLeaveSize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	seat, ok := s.reconnects.Seat(strings.TrimSpace(string(token)))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.RLock()
+	wc, ok := s.workerClients[seat.WorkerID]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := wc.unsupported(api.SessionLeave); err != nil {
+		log.Printf("warn: the session %v can't leave, %v", seat.SessionID, err)
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	log.Printf("Coordinator: the session %v has left the room %v", seat.SessionID, seat.RoomID)
+	wc.Send(api.SessionLeavePacket(seat.SessionID), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// Tests that the leave beacon of the closed tab releases the seat
+// on the worker right away and the token still gets the seat back.
+func TestLeave(t *testing.T) {
+	srv, worker := newTestServer(t, time.Minute)
+	defer srv.Close()
+	defer worker.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+	left := make(chan string, 1)
+	worker.Receive(api.SessionLeave, func(resp cws.WSPacket) cws.WSPacket {
+		left <- resp.SessionID
+		return cws.EmptyPacket
+	})
+
+	browser := newTestBrowser(t, host, "")
+	joined := startGame(t, browser)
+	browser.Close()
+
+	leave := func(method string, token string) int {
+		req := httptest.NewRequest(method, "/leave", strings.NewReader(token))
+		w := httptest.NewRecorder()
+		srv.Config.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	start := time.Now()
+	if code := leave(http.MethodPost, joined.Data); code != http.StatusNoContent {
+		t.Fatalf("wrong status %v of the leave", code)
+	}
+	select {
+	case <-left:
+		if released := time.Since(start); released > time.Second {
+			t.Errorf("the seat has been released after %v", released)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the worker hasn't released the seat")
+	}
+
+	for _, test := range []struct {
+		method, token string
+		code          int
+	}{
+		{method: http.MethodGet, token: joined.Data, code: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, token: "nope", code: http.StatusNotFound},
+	} {
+		if code := leave(test.method, test.token); code != test.code {
+			t.Errorf("wrong status %v of the %v leave with %q, expected %v", code, test.method, test.token, test.code)
+		}
+	}
+
+	// a page reload
+	browser = newTestBrowser(t, host, joined.RoomID)
+	defer browser.Close()
+	if back := syncSend(t, browser, cws.WSPacket{ID: api.GameReconnect, Data: joined.Data}); back.ID != api.GameStart {
+		t.Errorf("the token of the left session hasn't reconnected, %+v", back)
+	}
+}
+
+// Tests that the leave beacons of the old workers don't go there.
+func TestLeaveOldWorker(t *testing.T) {
+	_, srv, worker, host := newFeatureTest(t, api.ConnectionRequest{PingURL: "ping"})
+	defer srv.Close()
+	defer worker.Close()
+
+	browser := newTestBrowser(t, host, "")
+	defer browser.Close()
+	joined := startGame(t, browser)
+
+	req := httptest.NewRequest(http.MethodPost, "/leave", strings.NewReader(joined.Data))
+	w := httptest.NewRecorder()
+	srv.Config.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("wrong status %v of the leave", w.Code)
+	}
+}
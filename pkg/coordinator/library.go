@@ -0,0 +1,61 @@
+package coordinator
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/session"
+)
+
+// watchLibrary sends the new game list to the browsers
+// on the library changes. The games of the running rooms
+// stay in the library.
+func (s *Server) watchLibrary() {
+	s.library.KeepInUse(s.hasRoomOfGame)
+	s.library.OnChange(func(games.Changes) { s.sendGameList() })
+}
+
+// hasRoomOfGame runs with the scans of the library.
+func (s *Server) hasRoomOfGame(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for roomID := range s.roomToWorker {
+		if session.GetGameNameFromRoomID(roomID) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) sendGameList() {
+	var names []string
+	for _, game := range s.library.GetAll() {
+		names = append(names, game.Name)
+	}
+	packet := api.GameListPacket(names)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, bc := range s.browserClients {
+		bc.Send(packet, nil)
+	}
+}
+
+// Rescan scans the games library again (POST with the admin token),
+// the browsers get the new game list after that.
+func (s *Server) Rescan(w http.ResponseWriter, r *http.Request) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token := s.cfg.Coordinator.AdminToken
+	if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	s.library.Rescan()
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,53 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+)
+
+// rescanLibrary counts the rescans of the library.
+type rescanLibrary struct {
+	testLibrary
+	rescans int
+}
+
+func (l *rescanLibrary) Rescan() { l.rescans++ }
+
+// Tests that only the admin requests rescan the library.
+func TestRescanAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		auth   string
+		method string
+		code   int
+	}{
+		{name: "the admin", token: "secret", auth: "Bearer secret", method: http.MethodPost, code: http.StatusAccepted},
+		{name: "no token", token: "secret", method: http.MethodPost, code: http.StatusUnauthorized},
+		{name: "a wrong token", token: "secret", auth: "Bearer guess", method: http.MethodPost, code: http.StatusUnauthorized},
+		{name: "disabled", auth: "Bearer ", method: http.MethodPost, code: http.StatusUnauthorized},
+		{name: "not a post", token: "secret", auth: "Bearer secret", method: http.MethodGet, code: http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		conf := coordinator.Config{}
+		conf.Coordinator.AdminToken = test.token
+		lib := &rescanLibrary{}
+		s := NewServer(conf, lib)
+
+		r := httptest.NewRequest(test.method, "/rescan", nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		s.Rescan(w, r)
+		if w.Code != test.code {
+			t.Errorf("%v: got %v, expected %v", test.name, w.Code, test.code)
+		}
+		if rescanned := lib.rescans > 0; rescanned != (test.code == http.StatusAccepted) {
+			t.Errorf("%v: the library has been rescanned %v times", test.name, lib.rescans)
+		}
+	}
+}
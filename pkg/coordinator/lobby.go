@@ -0,0 +1,113 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// lobbyTTL is how long the room reports of the workers are kept,
+// the workers report their rooms every 10 seconds.
+const lobbyTTL = 30 * time.Second
+
+// lobbyReport is the last report of the rooms of a worker.
+type lobbyReport struct {
+	zone  string
+	rooms []api.RoomInfo
+	time  time.Time
+}
+
+// lobby is the list of the public rooms of all the workers.
+type lobby struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	reports map[string]lobbyReport
+}
+
+func newLobby(ttl time.Duration) *lobby {
+	return &lobby{ttl: ttl, now: time.Now, reports: map[string]lobbyReport{}}
+}
+
+// update replaces the rooms of the worker.
+func (l *lobby) update(workerID string, zone string, rooms []api.RoomInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reports[workerID] = lobbyReport{zone: zone, rooms: rooms, time: l.now()}
+}
+
+// remove removes the rooms of the gone worker.
+func (l *lobby) remove(workerID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.reports, workerID)
+}
+
+// list returns the public rooms of the fresh reports sorted by their games and IDs.
+// The rooms reported by several workers (i.e. moving rooms) are taken
+// from the last report.
+func (l *lobby) list() []api.LobbyRoom {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	rooms := map[string]api.LobbyRoom{}
+	updated := map[string]time.Time{}
+	for id, report := range l.reports {
+		if now.Sub(report.time) > l.ttl {
+			delete(l.reports, id)
+			continue
+		}
+		for _, r := range report.rooms {
+			if r.Private || !report.time.After(updated[r.ID]) {
+				continue
+			}
+			rooms[r.ID] = api.LobbyRoom{
+				ID:         r.ID,
+				Game:       r.Game,
+				Players:    r.Players,
+				MaxPlayers: r.MaxPlayers,
+				Zone:       report.zone,
+			}
+			updated[r.ID] = report.time
+		}
+	}
+	list := make([]api.LobbyRoom, 0, len(rooms))
+	for _, r := range rooms {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Game != list[j].Game {
+			return list[i].Game < list[j].Game
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// handleRoomStatus takes the periodic report of the rooms of the worker.
+func (wc *WorkerClient) handleRoomStatus(s *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) cws.WSPacket {
+		status := api.RoomStatusRequest{}
+		if err := status.From(resp.Data); err != nil {
+			wc.Printf("error: malformed room status, %v", err)
+			return cws.EmptyPacket
+		}
+		s.lobby.update(wc.WorkerID, wc.Zone, status.Rooms)
+		return cws.EmptyPacket
+	}
+}
+
+// Lobby returns the public rooms of all the workers in JSON.
+func (s *Server) Lobby(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(s.lobby.list()); err != nil {
+		log.Printf("error: couldn't write the lobby, %v", err)
+	}
+}
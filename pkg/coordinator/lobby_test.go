@@ -0,0 +1,106 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+func sendRoomStatus(t *testing.T, w *testWorker, rooms ...api.RoomInfo) {
+	data, err := (&api.RoomStatusRequest{Rooms: rooms}).To()
+	if err != nil {
+		t.Fatalf("couldn't make the room status, %v", err)
+	}
+	w.Send(api.RoomStatusPacket(data), nil)
+}
+
+func getLobby(t *testing.T, s *Server) (rooms []api.LobbyRoom) {
+	w := httptest.NewRecorder()
+	s.Lobby(w, httptest.NewRequest(http.MethodGet, "/lobby", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &rooms); err != nil {
+		t.Fatalf("malformed lobby %q, %v", w.Body.String(), err)
+	}
+	return
+}
+
+// waitLobby waits until the lobby has the number of the rooms.
+func waitLobby(t *testing.T, s *Server, n int) []api.LobbyRoom {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rooms := getLobby(t, s)
+		if len(rooms) == n {
+			return rooms
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wrong lobby %+v, expected %v rooms", rooms, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLobby(t *testing.T) {
+	s := NewServer(coordinator.Config{}, testLibrary{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wso", s.WSO)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	a, b := newTestWorker(t, host), newTestWorker(t, host)
+	defer a.Close()
+	defer b.Close()
+
+	sendRoomStatus(t, a,
+		api.RoomInfo{ID: "moving", Game: "Sonic", Players: 1, MaxPlayers: 2},
+		api.RoomInfo{ID: "secret", Game: "Contra", Players: 1, MaxPlayers: 2, Private: true},
+	)
+	waitLobby(t, s, 1)
+	time.Sleep(10 * time.Millisecond)
+	// the room has moved to the second worker with a new player
+	sendRoomStatus(t, b,
+		api.RoomInfo{ID: "moving", Game: "Sonic", Players: 2, MaxPlayers: 2},
+		api.RoomInfo{ID: "arena", Game: "Doom", Players: 3, MaxPlayers: 4},
+	)
+	expected := []api.LobbyRoom{
+		{ID: "arena", Game: "Doom", Players: 3, MaxPlayers: 4},
+		{ID: "moving", Game: "Sonic", Players: 2, MaxPlayers: 2},
+	}
+	if rooms := waitLobby(t, s, 2); !reflect.DeepEqual(rooms, expected) {
+		t.Errorf("wrong lobby %+v, expected %+v", rooms, expected)
+	}
+
+	// the gone workers take their rooms with them
+	b.Close()
+	rooms := waitLobby(t, s, 1)
+	if rooms[0].ID != "moving" || rooms[0].Players != 1 {
+		t.Errorf("wrong lobby %+v after the worker has gone", rooms)
+	}
+}
+
+func TestLobbyStale(t *testing.T) {
+	now := time.Now()
+	l := newLobby(time.Minute)
+	l.now = func() time.Time { return now }
+	l.update("a", "eu", []api.RoomInfo{{ID: "1", Game: "Tetris", MaxPlayers: 1}})
+	now = now.Add(30 * time.Second)
+	l.update("b", "us", []api.RoomInfo{{ID: "2", Game: "Tetris", MaxPlayers: 1}})
+
+	if rooms := l.list(); len(rooms) != 2 || rooms[0].Zone != "eu" || rooms[1].Zone != "us" {
+		t.Errorf("wrong lobby %+v", rooms)
+	}
+	// the first worker has died without a word
+	now = now.Add(45 * time.Second)
+	if rooms := l.list(); len(rooms) != 1 || rooms[0].ID != "2" {
+		t.Errorf("the stale rooms are in the lobby %+v", rooms)
+	}
+	if _, ok := l.reports["a"]; ok {
+		t.Errorf("the stale report is kept")
+	}
+}
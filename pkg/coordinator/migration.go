@@ -0,0 +1,147 @@
+package coordinator
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/ice"
+)
+
+// MigrateRoom moves the running room to another worker (i.e. off the overloaded one).
+// The room stops on its worker with the state uploaded into the cloud storage,
+// the target worker starts the room with the same ID from that state,
+// then the browsers of the room are told to reconnect there.
+// The room goes on with its old worker if the target one couldn't take it.
+func (s *Server) MigrateRoom(roomID string, workerID string) error {
+	from, ok := s.workerClients[s.roomToWorker[roomID]]
+	if !ok {
+		return fmt.Errorf("no worker of the room %v", roomID)
+	}
+	to, ok := s.workerClients[workerID]
+	if !ok {
+		return fmt.Errorf("no worker %v", workerID)
+	}
+	if from == to {
+		return fmt.Errorf("the room %v is on the worker %v already", roomID, workerID)
+	}
+	// the room isn't stopped for the worker which couldn't take it
+	if err := to.unsupported(api.RoomImport); err != nil {
+		return err
+	}
+
+	migration, err := from.ExportRoom(roomID)
+	if err != nil {
+		return err
+	}
+	if err := to.ImportRoom(migration); err != nil {
+		from.HandoffRoom(roomID, false)
+		return err
+	}
+	s.mu.Lock()
+	s.roomToWorker[roomID] = to.WorkerID
+	s.mu.Unlock()
+	// the room closes before its sessions so it doesn't save the game
+	from.HandoffRoom(roomID, true)
+
+	for _, bc := range s.browserClients {
+		if bc.RoomID != roomID || bc.WorkerID != from.WorkerID {
+			continue
+		}
+		bc.WorkerID = to.WorkerID
+		from.ChangeUserQuantityBy(-1)
+		to.ChangeUserQuantityBy(1)
+		from.Send(api.TerminateSessionPacket(bc.SessionID), nil)
+		bc.Send(api.GameMigratePacket(roomID, ice.ToJson(s.iceServers(to, bc.SessionID))), nil)
+	}
+	log.Printf("Coordinator: room %v has moved from worker %v to %v", roomID, from.WorkerID, to.WorkerID)
+	return nil
+}
+
+// moveRooms migrates the rooms of the draining worker to the free workers,
+// the rooms which couldn't move stay there until they are drained.
+func (s *Server) moveRooms(from *WorkerClient) {
+	if from.unsupported(api.RoomExport) != nil {
+		return
+	}
+	var rooms []string
+	for roomID, workerID := range s.roomToWorker {
+		if workerID == from.WorkerID {
+			rooms = append(rooms, roomID)
+		}
+	}
+	for _, roomID := range rooms {
+		to, err := s.freeWorker(from, api.RoomImport)
+		if err == nil {
+			err = s.MigrateRoom(roomID, to.WorkerID)
+		}
+		if err != nil {
+			log.Printf("warn: the room %v of the draining worker %v hasn't moved, %v", roomID, from.WorkerID, err)
+		}
+	}
+}
+
+// ForkRoom clones the running room of the owner session into a new room on another worker
+// and returns the ID of the new room, the libretro cores run one game per worker.
+// The worker of the room uploads the snapshot of its game into the cloud storage,
+// the new room starts from it and the room keeps running.
+func (s *Server) ForkRoom(roomID string, sessionID string) (string, error) {
+	from, ok := s.workerClients[s.roomToWorker[roomID]]
+	if !ok {
+		return "", fmt.Errorf("no worker of the room %v", roomID)
+	}
+	to, err := s.freeWorker(from, api.RoomImport)
+	if err != nil {
+		return "", err
+	}
+	fork, err := from.ForkRoom(roomID, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if err := to.ImportRoom(fork); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.roomToWorker[fork.RoomID] = to.WorkerID
+	s.mu.Unlock()
+	log.Printf("Coordinator: room %v has been forked into %v on worker %v", roomID, fork.RoomID, to.WorkerID)
+	return fork.RoomID, nil
+}
+
+// freeWorker returns the worker with a free game slot other than the one,
+// the worker is picked by its load in the zone of the other one
+// among the workers supporting the command.
+func (s *Server) freeWorker(other *WorkerClient, command string) (*WorkerClient, error) {
+	var workers []workerChoice
+	for _, wc := range s.getAvailableWorkers() {
+		if wc == other || wc.unsupported(command) != nil {
+			continue
+		}
+		w := workerChoice{id: wc.WorkerID, zone: wc.Zone, latency: -1}
+		w.rooms, w.load = wc.Load()
+		workers = append(workers, w)
+	}
+	id, err := pickWorker(workers, other.Zone)
+	if err != nil {
+		return nil, err
+	}
+	return s.workerClients[id], nil
+}
+
+// moveBrowser moves the browser without a room to another worker
+// (i.e. off the worker which couldn't take its new room),
+// the worker is picked by its load in the zone of the old one.
+// The browser reconnects there and starts the game of the room again.
+func (s *Server) moveBrowser(bc *BrowserClient, from *WorkerClient, roomID string) error {
+	to, err := s.freeWorker(from, api.GameStart)
+	if err != nil {
+		return err
+	}
+	bc.WorkerID = to.WorkerID
+	from.ChangeUserQuantityBy(-1)
+	to.ChangeUserQuantityBy(1)
+	from.Send(api.TerminateSessionPacket(bc.SessionID), nil)
+	bc.Send(api.GameMigratePacket(roomID, ice.ToJson(s.iceServers(to, bc.SessionID))), nil)
+	log.Printf("Coordinator: browser %v has moved from the overloaded worker %v to %v", bc.SessionID, from.WorkerID, to.WorkerID)
+	return nil
+}
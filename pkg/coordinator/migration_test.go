@@ -0,0 +1,373 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// testCloud is the cloud storage shared by the test workers.
+type testCloud struct {
+	mu    sync.Mutex
+	saves map[string]string
+}
+
+func (c *testCloud) save(key, state string) {
+	c.mu.Lock()
+	c.saves[key] = state
+	c.mu.Unlock()
+}
+
+func (c *testCloud) load(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saves[key]
+}
+
+// migrationTest is a coordinator with the source worker of the room
+// and the target one.
+type migrationTest struct {
+	s        *Server
+	srv      *httptest.Server
+	host     string
+	from, to *testWorker
+	cloud    *testCloud
+	// the imported state and the handoffs of the source worker
+	imported chan string
+	handoffs chan string
+}
+
+// newMigrationTest starts the coordinator with the source worker,
+// the browser joins the room there,
+// then the target worker comes with the state of the game (RAM value).
+func newMigrationTest(t *testing.T, ram string, imports bool) (*migrationTest, *cws.Client, cws.WSPacket) {
+	conf := coordinator.Config{}
+	conf.Coordinator.ReconnectTTL = time.Minute
+	m := &migrationTest{
+		s:        NewServer(conf, testLibrary{}),
+		cloud:    &testCloud{saves: map[string]string{}},
+		imported: make(chan string, 1),
+		handoffs: make(chan string, 1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", m.s.WS)
+	mux.HandleFunc("/wso", m.s.WSO)
+	m.srv = httptest.NewServer(mux)
+	m.host = "ws" + strings.TrimPrefix(m.srv.URL, "http")
+
+	m.from = newTestWorker(t, m.host)
+	time.Sleep(100 * time.Millisecond)
+	browser := newTestBrowser(t, m.host, "")
+	joined := startGame(t, browser)
+	m.to = newTestWorker(t, m.host)
+	time.Sleep(100 * time.Millisecond)
+
+	m.from.Receive(api.RoomExport, func(resp cws.WSPacket) cws.WSPacket {
+		m.cloud.save(resp.RoomID, ram)
+		m.from.mu.Lock()
+		migration := api.RoomMigration{RoomID: resp.RoomID, Name: testGame.Name, Players: map[string]int{}}
+		for session, player := range m.from.players {
+			migration.Players[session] = player
+		}
+		m.from.mu.Unlock()
+		data, _ := migration.To()
+		return cws.WSPacket{ID: api.RoomExport, RoomID: resp.RoomID, Data: data}
+	})
+	m.from.Receive(api.RoomHandoff, func(resp cws.WSPacket) cws.WSPacket {
+		m.handoffs <- resp.Data
+		return cws.EmptyPacket
+	})
+	m.to.Receive(api.RoomImport, func(resp cws.WSPacket) cws.WSPacket {
+		if !imports {
+			return cws.WSPacket{ID: api.RoomImport, Data: "error"}
+		}
+		migration := api.RoomMigration{}
+		if err := migration.From(resp.Data); err != nil {
+			return cws.WSPacket{ID: api.RoomImport, Data: "error"}
+		}
+		m.to.mu.Lock()
+		for session, player := range migration.Players {
+			m.to.players[session] = player
+		}
+		m.to.mu.Unlock()
+		m.imported <- m.cloud.load(migration.RoomID)
+		m.to.Send(api.RegisterRoomPacket(migration.RoomID), nil)
+		return cws.WSPacket{ID: api.RoomImport, Data: "ok"}
+	})
+	return m, browser, joined
+}
+
+func (m *migrationTest) close() {
+	m.from.Close()
+	m.to.Close()
+	m.srv.Close()
+}
+
+// targetID returns the ID of the worker without the room.
+func (m *migrationTest) targetID(room string) string {
+	for id := range m.s.workerClients {
+		if id != m.s.roomToWorker[room] {
+			return id
+		}
+	}
+	return ""
+}
+
+// Tests that the room moves with its state and players to another worker
+// and its browser is told to reconnect there.
+func TestMigrateRoom(t *testing.T) {
+	m, browser, joined := newMigrationTest(t, "ram:0x42", true)
+	defer m.close()
+	defer browser.Close()
+	migrated := make(chan cws.WSPacket, 1)
+	browser.Receive(api.GameMigrate, func(resp cws.WSPacket) cws.WSPacket {
+		migrated <- resp
+		return cws.EmptyPacket
+	})
+
+	target := m.targetID(joined.RoomID)
+	if err := m.s.MigrateRoom(joined.RoomID, target); err != nil {
+		t.Fatalf("couldn't migrate the room, %v", err)
+	}
+
+	select {
+	case state := <-m.imported:
+		if state != "ram:0x42" {
+			t.Errorf("wrong state %v of the migrated room", state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the room hasn't been imported")
+	}
+	select {
+	case handoff := <-m.handoffs:
+		if handoff != "ok" {
+			t.Errorf("the moved room hasn't been closed, %v", handoff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no handoff of the room")
+	}
+	select {
+	case resp := <-migrated:
+		if resp.RoomID != joined.RoomID {
+			t.Errorf("wrong migrated room %v", resp.RoomID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the browser hasn't been told about the migration")
+	}
+	select {
+	case <-m.from.terminated:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the session is left on the old worker")
+	}
+	if worker := m.s.roomToWorker[joined.RoomID]; worker != target {
+		t.Errorf("the room is on the worker %v, expected %v", worker, target)
+	}
+
+	// the browser joins the room on the new worker with its player
+	m.to.mu.Lock()
+	players := len(m.to.players)
+	m.to.mu.Unlock()
+	if players != 1 {
+		t.Errorf("wrong number of the migrated players %v", players)
+	}
+	if resp := startGame(t, browser); resp.RoomID != joined.RoomID {
+		t.Errorf("the browser has joined the room %v, expected %v", resp.RoomID, joined.RoomID)
+	}
+	m.to.mu.Lock()
+	joins := m.to.next - 2
+	m.to.mu.Unlock()
+	if joins != 1 {
+		t.Errorf("the browser hasn't joined the new worker")
+	}
+}
+
+// Tests that the rooms of the draining worker move to the free workers.
+func TestDrainMigratesRooms(t *testing.T) {
+	m, browser, joined := newMigrationTest(t, "ram:0x42", true)
+	defer m.close()
+	defer browser.Close()
+	migrated := make(chan cws.WSPacket, 1)
+	browser.Receive(api.GameMigrate, func(resp cws.WSPacket) cws.WSPacket {
+		migrated <- resp
+		return cws.EmptyPacket
+	})
+	target := m.targetID(joined.RoomID)
+
+	m.from.Send(api.WorkerDrainPacket(api.WorkerDraining), nil)
+	select {
+	case state := <-m.imported:
+		if state != "ram:0x42" {
+			t.Errorf("wrong state %v of the migrated room", state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the room of the draining worker hasn't been imported")
+	}
+	select {
+	case resp := <-migrated:
+		if resp.RoomID != joined.RoomID {
+			t.Errorf("wrong migrated room %v", resp.RoomID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the browser hasn't been told about the migration")
+	}
+	if worker := m.s.roomToWorker[joined.RoomID]; worker != target {
+		t.Errorf("the room is on the worker %v, expected %v", worker, target)
+	}
+}
+
+// Tests that the room goes on with its worker when the target one couldn't take it.
+func TestMigrateRoomFailed(t *testing.T) {
+	m, browser, joined := newMigrationTest(t, "ram:0x42", false)
+	defer m.close()
+	defer browser.Close()
+	source := m.s.roomToWorker[joined.RoomID]
+
+	if err := m.s.MigrateRoom(joined.RoomID, m.targetID(joined.RoomID)); err == nil {
+		t.Fatalf("the room has moved to the worker without it")
+	}
+	select {
+	case handoff := <-m.handoffs:
+		if handoff != "error" {
+			t.Errorf("the room hasn't been resumed, %v", handoff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no handoff of the room")
+	}
+	if worker := m.s.roomToWorker[joined.RoomID]; worker != source {
+		t.Errorf("the room is on the worker %v, expected %v", worker, source)
+	}
+	if err := m.s.MigrateRoom(joined.RoomID, source); err == nil {
+		t.Errorf("the room has moved to its own worker")
+	}
+}
+
+// Tests that the room is forked into a new room on another worker
+// and the room goes on with its worker.
+func TestForkRoom(t *testing.T) {
+	m, browser, joined := newMigrationTest(t, "ram:0x42", true)
+	defer m.close()
+	defer browser.Close()
+	source, target := m.s.roomToWorker[joined.RoomID], m.targetID(joined.RoomID)
+	forked := "fork___" + testGame.Name
+	m.from.Receive(api.RoomFork, func(resp cws.WSPacket) cws.WSPacket {
+		if resp.RoomID != joined.RoomID {
+			return cws.WSPacket{ID: api.RoomFork, Data: "error", Error: "no room"}
+		}
+		m.cloud.save(forked, "ram:0x13")
+		data, _ := (&api.RoomMigration{RoomID: forked, Name: testGame.Name}).To()
+		return cws.WSPacket{ID: api.RoomFork, RoomID: resp.RoomID, Data: data}
+	})
+
+	resp := syncSend(t, browser, cws.WSPacket{ID: api.GameFork})
+	if resp.Data != "ok" || resp.RoomID != forked {
+		t.Fatalf("couldn't fork the room, %+v", resp)
+	}
+	select {
+	case state := <-m.imported:
+		if state != "ram:0x13" {
+			t.Errorf("wrong state %v of the forked room", state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the fork hasn't started")
+	}
+	if worker := m.s.roomToWorker[forked]; worker != target {
+		t.Errorf("the fork is on the worker %v, expected %v", worker, target)
+	}
+	if worker := m.s.roomToWorker[joined.RoomID]; worker != source {
+		t.Errorf("the room is on the worker %v, expected %v", worker, source)
+	}
+	select {
+	case handoff := <-m.handoffs:
+		t.Errorf("the forked room has been handed off, %v", handoff)
+	default:
+	}
+
+	// the errors of the fork go to the browser
+	m.from.Receive(api.RoomFork, func(resp cws.WSPacket) cws.WSPacket {
+		return cws.WSPacket{ID: api.RoomFork, Data: "error", Error: "only the room owner can do that"}
+	})
+	if resp := syncSend(t, browser, cws.WSPacket{ID: api.GameFork}); resp.Data != "only the room owner can do that" {
+		t.Errorf("wrong error of the fork %+v", resp)
+	}
+}
+
+// Tests that the browser moves to another worker
+// when its worker can't take the new room.
+func TestMoveOverloaded(t *testing.T) {
+	conf := coordinator.Config{}
+	conf.Coordinator.ReconnectTTL = time.Minute
+	s := NewServer(conf, testLibrary{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.WS)
+	mux.HandleFunc("/wso", s.WSO)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// the first worker with the game start is overloaded
+	var mu sync.Mutex
+	var rejected *testWorker
+	overloaded := func(w *testWorker) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if rejected == nil {
+			rejected = w
+		}
+		return rejected == w
+	}
+	for i := 0; i < 2; i++ {
+		w := newTestWorker(t, host)
+		defer w.Close()
+		w.mu.Lock()
+		w.overloaded = overloaded
+		w.mu.Unlock()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	browser := newTestBrowser(t, host, "")
+	defer browser.Close()
+	migrated := make(chan cws.WSPacket, 1)
+	browser.Receive(api.GameMigrate, func(resp cws.WSPacket) cws.WSPacket {
+		migrated <- resp
+		return cws.EmptyPacket
+	})
+	req, _ := json.Marshal(api.GameStartRequest{GameName: testGame.Name})
+	if resp := syncSend(t, browser, cws.WSPacket{ID: api.GameStart, Data: string(req)}); resp.ID == api.RoomError {
+		t.Fatalf("the browser has got the error of the overloaded worker, %v", resp.Data)
+	}
+	select {
+	case <-migrated:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the browser hasn't been moved")
+	}
+	select {
+	case <-rejected.terminated:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the session is left on the overloaded worker")
+	}
+
+	// the game starts on the other worker
+	startGame(t, browser)
+	rejected.mu.Lock()
+	joins := len(rejected.players)
+	rejected.mu.Unlock()
+	if joins != 0 {
+		t.Errorf("the browser has joined the overloaded worker")
+	}
+	// the old worker is free without the browser otherwise
+	for _, bc := range s.browserClients {
+		for id, wc := range s.workerClients {
+			if id != bc.WorkerID && wc.HasGameSlot() {
+				t.Errorf("the overloaded worker gets the games")
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package coordinator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/gorilla/websocket"
+)
+
+var testGame = games.GameMetadata{Name: "Sushi The Cat", Type: "nes", Path: "Sushi The Cat.nes"}
+
+type testLibrary struct{}
+
+func (testLibrary) GetAll() []games.GameMetadata { return []games.GameMetadata{testGame} }
+func (testLibrary) Scan()                        {}
+func (testLibrary) Rescan()                      {}
+func (testLibrary) OnChange(func(games.Changes)) {}
+func (testLibrary) KeepInUse(func(string) bool)  {}
+func (testLibrary) FindGameByName(name string) games.GameMetadata {
+	if name == testGame.Name {
+		return testGame
+	}
+	return games.GameMetadata{}
+}
+
+// testWorker is a worker with one room,
+// which keeps the player indices of the sessions in that room.
+type testWorker struct {
+	*cws.Client
+	room string
+
+	mu         sync.Mutex
+	players    map[string]int
+	next       int
+	terminated chan string
+	// tells if the worker rejects the new room as overloaded
+	overloaded func(w *testWorker) bool
+}
+
+func newTestWorker(t *testing.T, host string) *testWorker {
+	return newTestWorkerWith(t, host, api.ConnectionRequest{PingURL: "ping", Version: api.ProtocolVersion, Features: api.Features})
+}
+
+// newTestWorkerWith connects the worker with its connection request,
+// i.e. the one of the old workers without the features.
+func newTestWorkerWith(t *testing.T, host string, connRt api.ConnectionRequest) *testWorker {
+	req, _ := json.Marshal(connRt)
+	conn, _, err := websocket.DefaultDialer.Dial(host+"/wso?data="+base64.URLEncoding.EncodeToString(req), nil)
+	if err != nil {
+		t.Fatalf("couldn't connect the worker, %v", err)
+	}
+	w := &testWorker{
+		Client:     cws.NewClient(conn),
+		room:       "room___" + testGame.Name,
+		players:    map[string]int{},
+		next:       2,
+		terminated: make(chan string, 10),
+	}
+	w.Receive(api.GameStart, func(resp cws.WSPacket) cws.WSPacket {
+		w.mu.Lock()
+		if w.overloaded != nil && w.overloaded(w) {
+			w.mu.Unlock()
+			return api.RoomErrorPacket("", api.RoomOverloaded)
+		}
+		w.players[resp.SessionID] = w.next
+		w.next++
+		player := w.players[resp.SessionID]
+		w.mu.Unlock()
+		w.Send(api.RegisterRoomPacket(w.room), nil)
+		return cws.WSPacket{ID: api.GameStart, RoomID: w.room, PlayerIndex: player}
+	})
+	w.Receive(api.GameReconnect, func(resp cws.WSPacket) cws.WSPacket {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		player, ok := w.players[resp.Data]
+		if !ok || resp.RoomID != w.room {
+			return cws.WSPacket{ID: api.GameReconnect, Data: "error"}
+		}
+		delete(w.players, resp.Data)
+		w.players[resp.SessionID] = player
+		return cws.WSPacket{ID: api.GameStart, RoomID: w.room, PlayerIndex: player}
+	})
+	w.Receive(api.TerminateSession, func(resp cws.WSPacket) cws.WSPacket {
+		w.mu.Lock()
+		delete(w.players, resp.SessionID)
+		w.mu.Unlock()
+		w.terminated <- resp.SessionID
+		return cws.EmptyPacket
+	})
+	go w.Listen()
+	return w
+}
+
+// newTestBrowser connects a browser with the room (optional)
+// and waits for its init.
+func newTestBrowser(t *testing.T, host string, room string) *cws.Client {
+	return newTestBrowserWith(t, host, room, nil)
+}
+
+// newTestBrowserWith connects the browser with the headers of its requests,
+// i.e. the ones of the auth proxy.
+func newTestBrowserWith(t *testing.T, host string, room string, header http.Header) *cws.Client {
+	conn, _, err := websocket.DefaultDialer.Dial(host+"/ws?room_id="+url.QueryEscape(room), header)
+	if err != nil {
+		t.Fatalf("couldn't connect the browser, %v", err)
+	}
+	b := cws.NewClient(conn)
+	ready := make(chan struct{})
+	b.Receive("checkLatency", func(resp cws.WSPacket) cws.WSPacket {
+		return cws.WSPacket{ID: "checkLatency", Data: `{"ping": 1}`}
+	})
+	b.Receive("init", func(resp cws.WSPacket) cws.WSPacket {
+		close(ready)
+		return cws.EmptyPacket
+	})
+	go b.Listen()
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no init of the browser")
+	}
+	return b
+}
+
+func newTestServer(t *testing.T, ttl time.Duration) (*httptest.Server, *testWorker) {
+	conf := coordinator.Config{}
+	conf.Coordinator.ReconnectTTL = ttl
+	s := NewServer(conf, testLibrary{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.WS)
+	mux.HandleFunc("/wso", s.WSO)
+	mux.HandleFunc("/leave", s.Leave)
+	srv := httptest.NewServer(mux)
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+	w := newTestWorker(t, host)
+	// the worker has been registered
+	time.Sleep(100 * time.Millisecond)
+	return srv, w
+}
+
+func syncSend(t *testing.T, c *cws.Client, packet cws.WSPacket) cws.WSPacket {
+	resp := make(chan cws.WSPacket, 1)
+	c.Send(packet, func(r cws.WSPacket) { resp <- r })
+	select {
+	case r := <-resp:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no response to %v", packet.ID)
+	}
+	return cws.EmptyPacket
+}
+
+func startGame(t *testing.T, c *cws.Client) cws.WSPacket {
+	req, _ := json.Marshal(api.GameStartRequest{GameName: testGame.Name})
+	resp := syncSend(t, c, cws.WSPacket{ID: api.GameStart, Data: string(req)})
+	if resp.ID != api.GameStart || resp.RoomID == "" || resp.Data == "" {
+		t.Fatalf("couldn't start the game, %+v", resp)
+	}
+	return resp
+}
+
+// Tests that the browser gets back its room and player
+// after the connection drop with the reconnect token.
+func TestReconnect(t *testing.T) {
+	srv, worker := newTestServer(t, time.Minute)
+	defer srv.Close()
+	defer worker.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	browser := newTestBrowser(t, host, "")
+	joined := startGame(t, browser)
+	token := joined.Data
+	browser.Close()
+
+	browser = newTestBrowser(t, host, joined.RoomID)
+	defer browser.Close()
+	back := syncSend(t, browser, cws.WSPacket{ID: api.GameReconnect, Data: token})
+	if back.ID != api.GameStart {
+		t.Fatalf("couldn't reconnect, %+v", back)
+	}
+	if back.RoomID != joined.RoomID || back.PlayerIndex != joined.PlayerIndex {
+		t.Errorf("wrong room %v and player %v after the reconnect, expected %v and %v",
+			back.RoomID, back.PlayerIndex, joined.RoomID, joined.PlayerIndex)
+	}
+	if back.Data == "" || back.Data == token {
+		t.Errorf("no new reconnect token")
+	}
+	select {
+	case id := <-worker.terminated:
+		t.Errorf("the seat of the session %v has been released", id)
+	default:
+	}
+
+	// the token is single-use
+	other := newTestBrowser(t, host, joined.RoomID)
+	defer other.Close()
+	if resp := syncSend(t, other, cws.WSPacket{ID: api.GameReconnect, Data: token}); resp.Data != "error" {
+		t.Errorf("the used token has reconnected, %+v", resp)
+	}
+}
+
+// Tests that the seat of the gone session is released after the TTL.
+func TestReconnectExpired(t *testing.T) {
+	srv, worker := newTestServer(t, 100*time.Millisecond)
+	defer srv.Close()
+	defer worker.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	browser := newTestBrowser(t, host, "")
+	joined := startGame(t, browser)
+	browser.Close()
+
+	select {
+	case <-worker.terminated:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the seat of the gone session hasn't been released")
+	}
+	browser = newTestBrowser(t, host, joined.RoomID)
+	defer browser.Close()
+	if resp := syncSend(t, browser, cws.WSPacket{ID: api.GameReconnect, Data: joined.Data}); resp.Data != "error" {
+		t.Errorf("the expired token has reconnected, %+v", resp)
+	}
+}
@@ -8,10 +8,14 @@ func (s *Server) workerRoutes(wc *WorkerClient) {
 		return
 	}
 	wc.Receive(api.Heartbeat, wc.handleHeartbeat())
+	wc.Receive(api.WorkerDrain, wc.handleWorkerDrain(s))
+	wc.Receive(api.RoomStatus, wc.handleRoomStatus(s))
 	wc.Receive(api.RegisterRoom, wc.handleRegisterRoom(s))
 	wc.Receive(api.GetRoom, wc.handleGetRoom(s))
 	wc.Receive(api.CloseRoom, wc.handleCloseRoom(s))
+	wc.Receive(api.RoomError, wc.handleRoomError(s))
 	wc.Receive(api.IceCandidate, wc.handleIceCandidate(s))
+	wc.Receive(api.Offer, wc.handleOffer(s))
 }
 
 // useragentRoutes adds all useragent (browser) request routes.
@@ -24,11 +28,27 @@ func (s *Server) useragentRoutes(bc *BrowserClient) {
 	bc.Receive(api.Answer, bc.handleAnswer(s))
 	bc.Receive(api.IceCandidate, bc.handleIceCandidate(s))
 	bc.Receive(api.GameStart, bc.handleGameStart(s))
+	bc.Receive(api.GameReconnect, bc.handleGameReconnect(s))
+	bc.Receive(api.GameJoinToken, bc.handleJoinToken(s))
 	bc.Receive(api.GameQuit, bc.handleGameQuit(s))
 	bc.Receive(api.GameSave, bc.handleGameSave(s))
 	bc.Receive(api.GameLoad, bc.handleGameLoad(s))
+	bc.Receive(api.GameSaveSlot, bc.handleFeature(s, bc.handleGameSave(s)))
+	bc.Receive(api.GameLoadSlot, bc.handleFeature(s, bc.handleGameLoad(s)))
+	bc.Receive(api.GameSlots, bc.handleFeature(s, bc.handleGameSlots(s)))
 	bc.Receive(api.GamePlayerSelect, bc.handleGamePlayerSelect(s))
 	bc.Receive(api.GameMultitap, bc.handleGameMultitap(s))
-	bc.Receive(api.GameRecording, bc.handleGameRecording(s))
+	bc.Receive(api.GameKeyMapping, bc.handleGameKeyMapping(s))
+	bc.Receive(api.GameRewind, bc.handleFeature(s, bc.handleGameRewind(s)))
+	bc.Receive(api.GamePause, bc.handleGamePause(s))
+	bc.Receive(api.GameFastForward, bc.handleGameFastForward(s))
+	bc.Receive(api.GameRecording, bc.handleFeature(s, bc.handleGameRecording(s)))
+	bc.Receive(api.GameKick, bc.handleGameKick(s))
+	bc.Receive(api.GameBan, bc.handleGameKick(s))
+	bc.Receive(api.GamePassword, bc.handleGamePassword(s))
+	bc.Receive(api.GameImportSave, bc.handleFeature(s, bc.handleGameImportSave(s)))
+	bc.Receive(api.GameFork, bc.handleFeature(s, bc.handleGameFork(s)))
+	bc.Receive(api.GameInvite, bc.handleFeature(s, bc.handleGameInvite(s)))
+	bc.Receive(api.GameConnectionStats, bc.handleFeature(s, bc.handleConnectionStats(s)))
 	bc.Receive(api.GetServerList, bc.handleGetServerList(s))
 }
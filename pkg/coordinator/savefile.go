@@ -0,0 +1,58 @@
+package coordinator
+
+import (
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/session"
+)
+
+// ExportSave returns the save file of the game of some room as a download,
+// the room ID and the reconnect token of the seat of the session in the room
+// are in the room and token query params.
+// The owners of the rooms of the same game and core import it with the import_save command.
+func (s *Server) ExportSave(w http.ResponseWriter, r *http.Request) {
+	roomID := r.URL.Query().Get("room")
+	if !s.inRoom(roomID, r.URL.Query().Get("token")) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	workerID, ok := s.roomToWorker[roomID]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	wc, ok := s.workerClients[workerID]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := wc.unsupported(api.RoomExportSave); err != nil {
+		log.Printf("warn: no save file of the room %v, %v", roomID, err)
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	save, err := wc.ExportRoomSave(roomID)
+	if err != nil {
+		log.Printf("warn: no save file of the room %v, %v", roomID, err)
+		http.NotFound(w, r)
+		return
+	}
+	name := session.GetGameNameFromRoomID(roomID)
+	if name == "" {
+		name = "game"
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".save"}))
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(save)
+}
+
+// inRoom tells if the reconnect token is of a seat in the room,
+// the files of the rooms go only to their sessions.
+func (s *Server) inRoom(roomID string, token string) bool {
+	seat, ok := s.reconnects.Seat(token)
+	return ok && seat.RoomID == roomID
+}
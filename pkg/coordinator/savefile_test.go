@@ -0,0 +1,67 @@
+package coordinator
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// Tests that the save files of the rooms are downloaded from their workers
+// and the old workers without them answer with the error.
+func TestExportSave(t *testing.T) {
+	tests := []struct {
+		name   string
+		conn   api.ConnectionRequest
+		room   string
+		token  string
+		status int
+	}{
+		{name: "the happy path", conn: api.ConnectionRequest{PingURL: "ping", Version: api.ProtocolVersion, Features: api.Features},
+			status: http.StatusOK},
+		{name: "another room", conn: api.ConnectionRequest{PingURL: "ping", Version: api.ProtocolVersion, Features: api.Features},
+			room: "nope", status: http.StatusForbidden},
+		{name: "no token", conn: api.ConnectionRequest{PingURL: "ping", Version: api.ProtocolVersion, Features: api.Features},
+			token: "nope", status: http.StatusForbidden},
+		{name: "old worker", conn: api.ConnectionRequest{PingURL: "ping"}, status: http.StatusNotImplemented},
+	}
+	save := []byte{0x1f, 0x8b, 0x42}
+	for _, test := range tests {
+		s, srv, worker, host := newFeatureTest(t, test.conn)
+		worker.Receive(api.RoomExportSave, func(resp cws.WSPacket) cws.WSPacket {
+			data, _ := (&api.RoomExportSaveResponse{Save: save}).To()
+			return cws.WSPacket{ID: api.RoomExportSave, RoomID: resp.RoomID, Data: data}
+		})
+		browser := newTestBrowser(t, host, "")
+		joined := startGame(t, browser)
+		room, token := test.room, test.token
+		if room == "" {
+			room = joined.RoomID
+		}
+		if token == "" {
+			token = joined.Data
+		}
+
+		w := httptest.NewRecorder()
+		s.ExportSave(w, httptest.NewRequest(http.MethodGet,
+			"/save-export?room="+url.QueryEscape(room)+"&token="+url.QueryEscape(token), nil))
+		if w.Code != test.status {
+			t.Errorf("%v: wrong status %v, expected %v", test.name, w.Code, test.status)
+		}
+		if test.status == http.StatusOK {
+			if !bytes.Equal(w.Body.Bytes(), save) {
+				t.Errorf("%v: wrong save file %v", test.name, w.Body.Bytes())
+			}
+			if d := w.Header().Get("Content-Disposition"); d != `attachment; filename="Sushi The Cat.save"` {
+				t.Errorf("%v: wrong download %v", test.name, d)
+			}
+		}
+		browser.Close()
+		worker.Close()
+		srv.Close()
+	}
+}
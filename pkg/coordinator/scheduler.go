@@ -0,0 +1,70 @@
+package coordinator
+
+import (
+	"errors"
+	"sort"
+)
+
+// latencyTie is the difference of the latencies (ms) of the workers
+// small enough to pick them by their load instead.
+const latencyTie = 5
+
+var errNoWorker = errors.New("no server found")
+
+// workerChoice is a worker with capacity for a new room.
+type workerChoice struct {
+	id   string
+	zone string
+	// the latency (ms) of the browser to the worker, <0 -- no probe
+	latency int64
+	rooms   int
+	load    float64
+}
+
+// pickWorker returns the ID of the worker for the new room of the browser,
+// only the workers of the zone are picked if it's set.
+// The worker with the lowest latency is picked,
+// the workers within the latencyTie of it go by the number of their rooms,
+// then their load average and ID.
+// The workers without the latencies are picked by their load
+// when the browser has no probes, they are skipped otherwise.
+func pickWorker(workers []workerChoice, zone string) (string, error) {
+	candidates := make([]workerChoice, 0, len(workers))
+	var best int64 = -1
+	for _, w := range workers {
+		if zone != "" && w.zone != zone {
+			continue
+		}
+		candidates = append(candidates, w)
+		if w.latency >= 0 && (best < 0 || w.latency < best) {
+			best = w.latency
+		}
+	}
+	// the probes are there, the rest are too far
+	if best >= 0 {
+		near := candidates[:0]
+		for _, w := range candidates {
+			if w.latency >= 0 && w.latency-best <= latencyTie {
+				near = append(near, w)
+			}
+		}
+		candidates = near
+	}
+	if len(candidates) == 0 {
+		return "", errNoWorker
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.rooms != b.rooms {
+			return a.rooms < b.rooms
+		}
+		if a.load != b.load {
+			return a.load < b.load
+		}
+		if a.latency != b.latency {
+			return a.latency < b.latency
+		}
+		return a.id < b.id
+	})
+	return candidates[0].id, nil
+}
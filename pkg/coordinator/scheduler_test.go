@@ -0,0 +1,144 @@
+package coordinator
+
+import (
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+func TestPickWorker(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers []workerChoice
+		zone    string
+		want    string
+		err     error
+	}{
+		{name: "no workers", err: errNoWorker},
+		{
+			name: "the lowest latency",
+			workers: []workerChoice{
+				{id: "a", latency: 80},
+				{id: "b", latency: 20, rooms: 3, load: .7},
+				{id: "c", latency: 45},
+			},
+			want: "b",
+		},
+		{
+			name: "the latency ties go by the rooms",
+			workers: []workerChoice{
+				{id: "a", latency: 20, rooms: 2},
+				{id: "b", latency: 24, rooms: 1},
+				{id: "c", latency: 26},
+			},
+			want: "b",
+		},
+		{
+			name: "then by the load average",
+			workers: []workerChoice{
+				{id: "a", latency: 20, rooms: 1, load: .5},
+				{id: "b", latency: 22, rooms: 1, load: .2},
+			},
+			want: "b",
+		},
+		{
+			name: "then by the latency",
+			workers: []workerChoice{
+				{id: "a", latency: 23, rooms: 1, load: .2},
+				{id: "b", latency: 21, rooms: 1, load: .2},
+			},
+			want: "b",
+		},
+		{
+			name: "then by the ID",
+			workers: []workerChoice{
+				{id: "b", latency: 20},
+				{id: "a", latency: 20},
+			},
+			want: "a",
+		},
+		{
+			name: "the unprobed workers are skipped",
+			workers: []workerChoice{
+				{id: "a", latency: -1},
+				{id: "b", latency: 150, rooms: 5},
+			},
+			want: "b",
+		},
+		{
+			name: "no probes at all",
+			workers: []workerChoice{
+				{id: "a", latency: -1, rooms: 2},
+				{id: "b", latency: -1, rooms: 1, load: .8},
+				{id: "c", latency: -1, rooms: 1, load: .3},
+			},
+			want: "c",
+		},
+		{
+			name: "the zone",
+			workers: []workerChoice{
+				{id: "a", zone: "us", latency: 10},
+				{id: "b", zone: "eu", latency: 90},
+				{id: "c", zone: "eu", latency: 95, rooms: 1},
+			},
+			zone: "eu",
+			want: "b",
+		},
+		{
+			name:    "no workers in the zone",
+			workers: []workerChoice{{id: "a", zone: "us", latency: 10}},
+			zone:    "eu",
+			err:     errNoWorker,
+		},
+	}
+	for _, test := range tests {
+		got, err := pickWorker(test.workers, test.zone)
+		if got != test.want || err != test.err {
+			t.Errorf("%v: got the worker %q (%v), expected %q (%v)", test.name, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestWorkerCapacity(t *testing.T) {
+	tests := []struct {
+		name    string
+		load    *api.WorkerLoad
+		users   int
+		maxLoad float64
+		free    bool
+	}{
+		{name: "the old worker", free: true},
+		{name: "the old busy worker", users: 1},
+		{name: "free rooms", load: &api.WorkerLoad{Rooms: 1, MaxRooms: 2}, users: 1, free: true},
+		{name: "no free rooms", load: &api.WorkerLoad{Rooms: 2, MaxRooms: 2}},
+		{name: "the unreported room", load: &api.WorkerLoad{MaxRooms: 1}, users: 1},
+		{name: "unlimited rooms", load: &api.WorkerLoad{Rooms: 10}, free: true},
+		{name: "the load average", load: &api.WorkerLoad{LoadAvg: .95}, maxLoad: .9},
+		{name: "the load average below the limit", load: &api.WorkerLoad{LoadAvg: .5}, maxLoad: .9, free: true},
+		{name: "the CPU budget", load: &api.WorkerLoad{Rooms: 3, Overloaded: true}},
+	}
+	for _, test := range tests {
+		wc := &WorkerClient{maxLoad: test.maxLoad}
+		if test.load != nil {
+			wc.SetLoad(*test.load)
+		}
+		wc.ChangeUserQuantityBy(test.users)
+		if free := wc.HasGameSlot(); free != test.free {
+			t.Errorf("%v: the worker has a game slot %v, expected %v", test.name, free, test.free)
+		}
+	}
+	wc := &WorkerClient{}
+	wc.SetLoad(api.WorkerLoad{MaxRooms: 5})
+	wc.SetOverloaded()
+	if wc.HasGameSlot() {
+		t.Errorf("the worker which has rejected the room has a game slot")
+	}
+	wc.SetLoad(api.WorkerLoad{MaxRooms: 5})
+	if !wc.HasGameSlot() {
+		t.Errorf("the worker has no game slot after the heartbeat")
+	}
+	wc.SetDraining()
+	if wc.HasGameSlot() {
+		t.Errorf("the draining worker has a game slot")
+	}
+}
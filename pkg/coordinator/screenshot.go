@@ -0,0 +1,137 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// thumbnailTTL is how long the room screenshots are cached.
+const thumbnailTTL = 10 * time.Second
+
+var errNoRoom = errors.New("no room")
+
+type thumbnail struct {
+	image []byte
+	time  time.Time
+}
+
+// thumbnails is the cache of the room screenshots (PNG).
+type thumbnails struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	cache map[string]thumbnail
+	now   func() time.Time
+}
+
+func (t *thumbnails) get(roomID string) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if th, ok := t.cache[roomID]; ok && t.now().Sub(th.time) < t.ttl {
+		return th.image
+	}
+	return nil
+}
+
+func (t *thumbnails) put(roomID string, image []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	// drop the old ones
+	for id, th := range t.cache {
+		if now.Sub(th.time) >= t.ttl {
+			delete(t.cache, id)
+		}
+	}
+	t.cache[roomID] = thumbnail{image: image, time: now}
+}
+
+func (t *thumbnails) remove(roomID string) {
+	t.mu.Lock()
+	delete(t.cache, roomID)
+	t.mu.Unlock()
+}
+
+// getThumbnail returns the cached screenshot of the room or
+// requests a new one from the worker of the room.
+func (s *Server) getThumbnail(roomID string) ([]byte, error) {
+	if image := s.thumbnails.get(roomID); image != nil {
+		return image, nil
+	}
+	workerID, ok := s.roomToWorker[roomID]
+	if !ok {
+		return nil, errNoRoom
+	}
+	wc, ok := s.workerClients[workerID]
+	if !ok {
+		return nil, errNoRoom
+	}
+	image, err := wc.GetRoomScreenshot(roomID)
+	if err != nil {
+		return nil, err
+	}
+	s.thumbnails.put(roomID, image)
+	return image, nil
+}
+
+// Screenshot returns the current frame of some room as a PNG image,
+// the room ID is in the room query param.
+func (s *Server) Screenshot(w http.ResponseWriter, r *http.Request) {
+	roomID := r.URL.Query().Get("room")
+	image, err := s.getThumbnail(roomID)
+	if err != nil {
+		log.Printf("warn: no screenshot of the room %v, %v", roomID, err)
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(thumbnailTTL.Seconds())))
+	_, _ = w.Write(image)
+}
+
+// SaveThumbnail returns the thumbnail of a save slot of some room as a JPEG image,
+// the room ID, the slot and the reconnect token of the seat of the session in the room
+// are in the room, slot and token query params.
+func (s *Server) SaveThumbnail(w http.ResponseWriter, r *http.Request) {
+	roomID := r.URL.Query().Get("room")
+	if !s.inRoom(roomID, r.URL.Query().Get("token")) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	// no slot -- the default one
+	slot := 0
+	if param := r.URL.Query().Get("slot"); param != "" {
+		var err error
+		if slot, err = strconv.Atoi(param); err != nil || slot < 0 {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+	image, err := s.getSaveThumbnail(roomID, slot)
+	if err != nil {
+		log.Printf("warn: no slot %v thumbnail of the room %v, %v", slot, roomID, err)
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(image)
+}
+
+// getSaveThumbnail requests the thumbnail of the save slot from the worker of the room,
+// the slots are overwritten, so they aren't cached.
+func (s *Server) getSaveThumbnail(roomID string, slot int) ([]byte, error) {
+	workerID, ok := s.roomToWorker[roomID]
+	if !ok {
+		return nil, errNoRoom
+	}
+	wc, ok := s.workerClients[workerID]
+	if !ok {
+		return nil, errNoRoom
+	}
+	return wc.GetRoomSaveThumbnail(roomID, slot)
+}
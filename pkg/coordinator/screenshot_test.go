@@ -0,0 +1,64 @@
+package coordinator
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// Tests that the save slot thumbnails go only to the sessions of the rooms
+// and only of the valid slots.
+func TestSaveThumbnail(t *testing.T) {
+	s, srv, worker, host := newFeatureTest(t, api.ConnectionRequest{PingURL: "ping", Version: api.ProtocolVersion, Features: api.Features})
+	defer srv.Close()
+	defer worker.Close()
+	image := []byte{0xff, 0xd8}
+	worker.Receive(api.RoomSaveThumbnail, func(resp cws.WSPacket) cws.WSPacket {
+		data, _ := (&api.RoomSaveThumbnailResponse{Image: image}).To()
+		return cws.WSPacket{ID: api.RoomSaveThumbnail, RoomID: resp.RoomID, Data: data}
+	})
+	browser := newTestBrowser(t, host, "")
+	defer browser.Close()
+	joined := startGame(t, browser)
+
+	tests := []struct {
+		name   string
+		room   string
+		token  string
+		slot   string
+		status int
+	}{
+		{name: "the happy path", slot: "2", status: http.StatusOK},
+		{name: "the default slot", status: http.StatusOK},
+		{name: "another room", room: "nope", status: http.StatusForbidden},
+		{name: "no token", token: "nope", status: http.StatusForbidden},
+		{name: "a negative slot", slot: "-1", status: http.StatusBadRequest},
+		{name: "a bad slot", slot: "one", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		room, token := test.room, test.token
+		if room == "" {
+			room = joined.RoomID
+		}
+		if token == "" {
+			token = joined.Data
+		}
+		query := "/save-thumbnail?room=" + url.QueryEscape(room) + "&token=" + url.QueryEscape(token)
+		if test.slot != "" {
+			query += "&slot=" + test.slot
+		}
+		w := httptest.NewRecorder()
+		s.SaveThumbnail(w, httptest.NewRequest(http.MethodGet, query, nil))
+		if w.Code != test.status {
+			t.Errorf("%v: wrong status %v, expected %v", test.name, w.Code, test.status)
+		}
+		if test.status == http.StatusOK && !bytes.Equal(w.Body.Bytes(), image) {
+			t.Errorf("%v: wrong thumbnail %v", test.name, w.Body.Bytes())
+		}
+	}
+}
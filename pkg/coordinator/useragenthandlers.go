@@ -27,6 +27,11 @@ func (bc *BrowserClient) handleInitWebrtc(o *Server) cws.PacketHandler {
 		if !ok {
 			return cws.EmptyPacket
 		}
+		// the worker connects with the same ICE servers (and TURN credentials)
+		call := api.InitWebrtcCall{IceServers: o.iceServers(wc, bc.SessionID)}
+		if data, err := call.To(); err == nil {
+			resp.Data = data
+		}
 		sdp := wc.SyncSend(resp)
 		bc.Println("Received SDP from worker -> sending back to browser")
 		return sdp
@@ -80,15 +85,32 @@ func (bc *BrowserClient) handleGameStart(o *Server) cws.PacketHandler {
 		if err != nil {
 			return cws.EmptyPacket
 		}
+		if gameStartCall.User, err = o.joins.MintUser(bc.User, bc.SessionID); err != nil {
+			bc.Printf("Warn: couldn't sign the user, %v", err)
+		}
 		if packet, err := gameStartCall.To(); err != nil {
 			return cws.EmptyPacket
 		} else {
 			resp.Data = packet
 		}
 		workerResp := wc.SyncSend(resp)
+		// the browser starts the game again on another worker
+		if workerResp.ID == api.RoomError && workerResp.Data == api.RoomOverloaded {
+			wc.SetOverloaded()
+			if err = o.moveBrowser(bc, wc, resp.RoomID); err == nil {
+				return cws.EmptyPacket
+			}
+			bc.Printf("Warn: couldn't move off the overloaded worker, %v", err)
+		}
+		if workerResp.ID == api.RoomError && workerResp.Data == api.RoomFull {
+			workerResp.Data = roomFullMessage(wc, resp.RoomID, gameStartCall.Spectator)
+		}
 		// Response from worker contains initialized roomID. Set roomID to the session
 		bc.RoomID = workerResp.RoomID
 		bc.Println("Received room response from browser: ", workerResp.RoomID)
+		if workerResp.ID == api.GameStart {
+			workerResp.Data = bc.newReconnectToken(o)
+		}
 
 		if o.cfg.Recording.Enabled && gameStartCall.Record {
 			bc.Send(cws.WSPacket{
@@ -107,6 +129,18 @@ func (bc *BrowserClient) handleGameStart(o *Server) cws.PacketHandler {
 	}
 }
 
+// roomFullMessage tells the user how full is the room.
+func roomFullMessage(wc *WorkerClient, roomID string, spectator bool) string {
+	stats, err := wc.GetRoomStats(roomID)
+	if err != nil {
+		return "the room is full"
+	}
+	if spectator {
+		return fmt.Sprintf("the room is full (%v/%v spectators)", stats.Spectators, stats.MaxSpectators)
+	}
+	return fmt.Sprintf("the room is full (%v/%v players)", stats.Players, stats.MaxPlayers)
+}
+
 func (bc *BrowserClient) handleGameQuit(o *Server) cws.PacketHandler {
 	return func(resp cws.WSPacket) (req cws.WSPacket) {
 		bc.Println("Received quit request from a browser -> relay to worker")
@@ -119,11 +153,87 @@ func (bc *BrowserClient) handleGameQuit(o *Server) cws.PacketHandler {
 		}
 		// Send but, waiting
 		wc.SyncSend(resp)
+		o.reconnects.Take(bc.reconnect)
+		bc.reconnect = ""
 
 		return cws.EmptyPacket
 	}
 }
 
+// handleGameReconnect gives the returning session (i.e. after a page reload)
+// the seat of its previous session in the room by the reconnect token.
+func (bc *BrowserClient) handleGameReconnect(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received reconnect request from a browser -> relay to worker")
+		seat, ok := o.reconnects.Take(resp.Data)
+		if !ok {
+			bc.Println("Warn: unknown or expired reconnect token")
+			return cws.WSPacket{ID: api.GameReconnect, Data: "error"}
+		}
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok || seat.WorkerID != bc.WorkerID {
+			bc.Printf("Warn: the seat in the room %v is on another worker", seat.RoomID)
+			// nobody can take the seat anymore
+			if old, ok := o.workerClients[seat.WorkerID]; ok {
+				old.Send(api.TerminateSessionPacket(seat.SessionID), nil)
+			}
+			return cws.WSPacket{ID: api.GameReconnect, Data: "error"}
+		}
+		playerIndex, err := wc.Reconnect(seat.RoomID, bc.SessionID, seat.SessionID)
+		if err != nil {
+			bc.Printf("Warn: couldn't reconnect, %v", err)
+			return cws.WSPacket{ID: api.GameReconnect, Data: "error"}
+		}
+		bc.RoomID = seat.RoomID
+		return cws.WSPacket{ID: api.GameStart, RoomID: seat.RoomID, PlayerIndex: playerIndex, Data: bc.newReconnectToken(o)}
+	}
+}
+
+// handleJoinToken mints the token of the session to join the room
+// of the packet (the empty one -- a new room) on its worker.
+// The new players of the running rooms need the invites of their owners,
+// but the ones of the old workers which can't mint them.
+func (bc *BrowserClient) handleJoinToken(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.GameJoinToken
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+		var request api.GameJoinTokenRequest
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		if wc, ok := o.workerClients[o.roomToWorker[resp.RoomID]]; ok && wc.unsupported(api.GameInvite) == nil &&
+			!request.Spectator && bc.RoomID != resp.RoomID {
+			if err := o.joins.VerifyInvite(request.Invite, wc.WorkerID, resp.RoomID); err != nil {
+				bc.Printf("Warn: couldn't join the room %v as a player, %v", resp.RoomID, err)
+				req.Data = api.JoinForbidden
+				return req
+			}
+		}
+		scope := session.JoinScope{
+			WorkerID:  bc.WorkerID,
+			RoomID:    resp.RoomID,
+			SessionID: bc.SessionID,
+			Role:      session.RoleOf(request.Spectator),
+		}
+		token, err := o.joins.Mint(scope)
+		if err != nil {
+			bc.Printf("error: couldn't mint the join token, %v", err)
+			return req
+		}
+		req.Data = token
+		return req
+	}
+}
+
+// newReconnectToken replaces the reconnect token of the session
+// with a new one of its current room seat.
+func (bc *BrowserClient) newReconnectToken(o *Server) string {
+	o.reconnects.Take(bc.reconnect)
+	bc.reconnect = o.reconnects.Mint(session.Seat{SessionID: bc.SessionID, RoomID: bc.RoomID, WorkerID: bc.WorkerID})
+	return bc.reconnect
+}
+
 func (bc *BrowserClient) handleGameSave(o *Server) cws.PacketHandler {
 	return func(resp cws.WSPacket) (req cws.WSPacket) {
 		bc.Println("Received save request from a browser -> relay to worker")
@@ -158,6 +268,23 @@ func (bc *BrowserClient) handleGameLoad(o *Server) cws.PacketHandler {
 	}
 }
 
+func (bc *BrowserClient) handleGameSlots(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received save slots request from a browser -> relay to worker")
+
+		// TODO: Async
+		resp.SessionID = bc.SessionID
+		resp.RoomID = bc.RoomID
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok {
+			return cws.EmptyPacket
+		}
+		resp = wc.SyncSend(resp)
+
+		return resp
+	}
+}
+
 func (bc *BrowserClient) handleGamePlayerSelect(o *Server) cws.PacketHandler {
 	return func(resp cws.WSPacket) (req cws.WSPacket) {
 		bc.Println("Received update player index request from a browser -> relay to worker")
@@ -192,6 +319,183 @@ func (bc *BrowserClient) handleGameMultitap(o *Server) cws.PacketHandler {
 	}
 }
 
+func (bc *BrowserClient) handleGameKeyMapping(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received key mapping request from a browser -> relay to worker")
+
+		// TODO: Async
+		resp.SessionID = bc.SessionID
+		resp.RoomID = bc.RoomID
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok {
+			return cws.EmptyPacket
+		}
+		resp = wc.SyncSend(resp)
+
+		return resp
+	}
+}
+
+func (bc *BrowserClient) handleGameRewind(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received rewind request from a browser -> relay to worker")
+
+		// TODO: Async
+		resp.SessionID = bc.SessionID
+		resp.RoomID = bc.RoomID
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok {
+			return cws.EmptyPacket
+		}
+		resp = wc.SyncSend(resp)
+
+		return resp
+	}
+}
+
+func (bc *BrowserClient) handleGamePause(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received pause request from a browser -> relay to worker")
+
+		// TODO: Async
+		resp.SessionID = bc.SessionID
+		resp.RoomID = bc.RoomID
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok {
+			return cws.EmptyPacket
+		}
+		resp = wc.SyncSend(resp)
+
+		return resp
+	}
+}
+
+// handleGameKick relays the kick or ban request of the room owner to the worker.
+func (bc *BrowserClient) handleGameKick(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Printf("Received %v request from a browser -> relay to worker", resp.ID)
+
+		// TODO: Async
+		resp.SessionID = bc.SessionID
+		resp.RoomID = bc.RoomID
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok {
+			return cws.EmptyPacket
+		}
+		resp = wc.SyncSend(resp)
+
+		return resp
+	}
+}
+
+// handleGamePassword relays the password of the room of the owner to the worker,
+// the browsers without the room get the error.
+// The password isn't logged.
+func (bc *BrowserClient) handleGamePassword(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received password request from a browser -> relay to worker")
+		return bc.relayRoomCommand(o, resp)
+	}
+}
+
+// handleGameImportSave relays the save file of the browser to the worker of its room,
+// the browsers without the room get the error.
+func (bc *BrowserClient) handleGameImportSave(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Printf("Received save file (%v bytes) from a browser -> relay to worker", len(resp.Data))
+		return bc.relayRoomCommand(o, resp)
+	}
+}
+
+// handleGameInvite relays the invite request of the browser (the room owner)
+// to the worker of its room, the worker mints the invite.
+func (bc *BrowserClient) handleGameInvite(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received invite request from a browser -> relay to worker")
+		return bc.relayRoomCommand(o, resp)
+	}
+}
+
+// relayRoomCommand sends the command of the browser to the worker of its room
+// and returns the response of the worker.
+func (bc *BrowserClient) relayRoomCommand(o *Server, resp cws.WSPacket) cws.WSPacket {
+	wc, ok := o.workerClients[bc.WorkerID]
+	if !ok || bc.RoomID == "" {
+		return cws.WSPacket{ID: resp.ID, Data: "error"}
+	}
+	resp.SessionID = bc.SessionID
+	resp.RoomID = bc.RoomID
+	return wc.SyncSend(resp)
+}
+
+// handleGameFork clones the room of the browser (its owner) into a new room
+// on another worker, the browser gets the ID of the new room for sharing.
+func (bc *BrowserClient) handleGameFork(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received fork request from a browser")
+		req.ID = api.GameFork
+		id, err := o.ForkRoom(bc.RoomID, bc.SessionID)
+		if err != nil {
+			bc.Printf("Warn: couldn't fork the room %v, %v", bc.RoomID, err)
+			req.Data = err.Error()
+			return req
+		}
+		req.RoomID = id
+		req.Data = "ok"
+		return req
+	}
+}
+
+// handleFeature answers the browser with the error of the command its worker doesn't support
+// instead of relaying the command there, the old workers don't answer them.
+func (bc *BrowserClient) handleFeature(o *Server, h cws.PacketHandler) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		if wc, ok := o.workerClients[bc.WorkerID]; ok {
+			if err := wc.unsupported(resp.ID); err != nil {
+				bc.Printf("Warn: %v", err)
+				return cws.WSPacket{ID: resp.ID, Data: err.Error()}
+			}
+		}
+		return h(resp)
+	}
+}
+
+// handleConnectionStats relays the connection stats request of the browser to the worker.
+func (bc *BrowserClient) handleConnectionStats(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok {
+			return cws.EmptyPacket
+		}
+		stats, err := wc.GetConnectionStats(bc.RoomID, bc.SessionID)
+		if err != nil {
+			return cws.WSPacket{ID: api.GameConnectionStats, Data: "error"}
+		}
+		data, err := stats.To()
+		if err != nil {
+			return cws.WSPacket{ID: api.GameConnectionStats, Data: "error"}
+		}
+		return cws.WSPacket{ID: api.GameConnectionStats, Data: data}
+	}
+}
+
+func (bc *BrowserClient) handleGameFastForward(o *Server) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		bc.Println("Received fast-forward request from a browser -> relay to worker")
+
+		// TODO: Async
+		resp.SessionID = bc.SessionID
+		resp.RoomID = bc.RoomID
+		wc, ok := o.workerClients[bc.WorkerID]
+		if !ok {
+			return cws.EmptyPacket
+		}
+		resp = wc.SyncSend(resp)
+
+		return resp
+	}
+}
+
 func (bc *BrowserClient) handleGameRecording(o *Server) cws.PacketHandler {
 	return func(resp cws.WSPacket) (req cws.WSPacket) {
 		bc.Println("Received recording request from a browser -> relay to worker")
@@ -254,6 +558,13 @@ func newGameStartCall(roomId string, data string, library games.GameLibrary, rec
 		Base: gameInfo.Base,
 		Path: gameInfo.Path,
 		Type: gameInfo.Type,
+
+		Overrides: gameInfo.Overrides,
+		Hash:      gameInfo.Hash,
+		Spectator: request.Spectator,
+		Password:  request.Password,
+		Token:     request.Token,
+		Hardcore:  request.Hardcore,
 	}
 	if recording {
 		call.Record = request.Record
@@ -0,0 +1,70 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/coordinator"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/session"
+)
+
+// Tests that the worker gets the user of the auth proxy header
+// signed for the session and nothing for the anonymous one.
+func TestGameStartUser(t *testing.T) {
+	conf := coordinator.Config{}
+	conf.Coordinator.UserHeader = "X-Forwarded-User"
+	conf.JoinTokens.Keys = []string{"secret"}
+	s := NewServer(conf, testLibrary{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.WS)
+	mux.HandleFunc("/wso", s.WSO)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	host := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	w := newTestWorker(t, host)
+	defer w.Close()
+	calls := make(chan cws.WSPacket, 1)
+	w.Receive(api.GameStart, func(resp cws.WSPacket) cws.WSPacket {
+		calls <- resp
+		w.Send(api.RegisterRoomPacket(w.room), nil)
+		return cws.WSPacket{ID: api.GameStart, RoomID: w.room}
+	})
+	time.Sleep(100 * time.Millisecond)
+	users := session.NewJoinTokens(conf.JoinTokens.Keys, 0)
+
+	tests := []struct {
+		room   string
+		header string
+		user   string
+	}{
+		{header: "alice", user: "alice"},
+		{room: w.room, header: "", user: ""},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.header != "" {
+			header.Set(conf.Coordinator.UserHeader, test.header)
+		}
+		browser := newTestBrowserWith(t, host, test.room, header)
+		defer browser.Close()
+		syncSend(t, browser, cws.WSPacket{ID: api.GameStart, Data: `{"game_name": "` + testGame.Name + `"}`})
+		select {
+		case resp := <-calls:
+			var call api.GameStartCall
+			if err := call.From(resp.Data); err != nil {
+				t.Fatal(err)
+			}
+			if user, err := users.VerifyUser(call.User, resp.SessionID); user != test.user || err != nil {
+				t.Errorf("the worker has got the user %q (%v), expected %q", user, err, test.user)
+			}
+		default:
+			t.Fatalf("no game start of the worker")
+		}
+	}
+}
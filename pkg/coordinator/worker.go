@@ -1,12 +1,16 @@
 package coordinator
 
 import (
+	"errors"
 	"fmt"
 	"github.com/rs/xid"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
 	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
 	"github.com/gorilla/websocket"
 )
 
@@ -18,12 +22,32 @@ type WorkerClient struct {
 	WorkerID string
 	Addr     string
 	// public server used for ping check
-	PingServer     string
-	Port           string
-	StunTurnServer string
-	Tag            string
-	userCount      int // may be atomic
-	Zone           string
+	PingServer string
+	Port       string
+	// the ICE servers of the worker (with its address)
+	IceServers []webrtc.IceServer
+	Tag        string
+	userCount  int // may be atomic
+	Zone       string
+	// the draining worker doesn't get new games
+	draining bool
+	// the worker over its CPU budget doesn't get new games
+	// until its heartbeat says otherwise
+	overloaded bool
+	// the last load from the heartbeats of the worker,
+	// the old workers don't have it
+	load    api.WorkerLoad
+	hasLoad bool
+	// the load average over which the worker doesn't get new games, 0 -- unlimited
+	maxLoad float64
+	// the time of the last heartbeat of the worker
+	lastBeat time.Time
+	// the worker without the heartbeats doesn't get new games
+	gone bool
+	// the version of the protocol and the features of the worker,
+	// it gets only the commands of them
+	version  int
+	features map[string]bool
 
 	mu sync.Mutex
 }
@@ -34,6 +58,7 @@ func NewWorkerClient(c *websocket.Conn, workerID string) *WorkerClient {
 	return &WorkerClient{
 		Client:   cws.NewClient(c),
 		WorkerID: workerID,
+		lastBeat: time.Now(),
 	}
 }
 
@@ -52,11 +77,317 @@ func (wc *WorkerClient) ChangeUserQuantityBy(n int) {
 
 // HasGameSlot tells whether the current worker has a
 // free slot to start a new game.
-// Workers support only one game at a time.
+// The workers without the load in their heartbeats
+// support only one game at a time.
 func (wc *WorkerClient) HasGameSlot() bool {
 	wc.mu.Lock()
 	defer wc.mu.Unlock()
-	return wc.userCount == 0
+	if wc.draining || wc.gone || wc.overloaded {
+		return false
+	}
+	if !wc.hasLoad {
+		return wc.userCount == 0
+	}
+	if wc.maxLoad > 0 && wc.load.LoadAvg >= wc.maxLoad {
+		return false
+	}
+	return wc.load.MaxRooms == 0 || wc.rooms() < wc.load.MaxRooms
+}
+
+// rooms returns the number of the rooms of the worker,
+// the users of the first room come before the heartbeat with it.
+// Should be called under the lock.
+func (wc *WorkerClient) rooms() int {
+	if wc.load.Rooms == 0 && wc.userCount > 0 {
+		return 1
+	}
+	return wc.load.Rooms
+}
+
+// Beat registers the heartbeat of the worker.
+func (wc *WorkerClient) Beat() {
+	wc.mu.Lock()
+	wc.lastBeat = time.Now()
+	wc.mu.Unlock()
+}
+
+// sinceBeat returns the time since the last heartbeat of the worker.
+func (wc *WorkerClient) sinceBeat() time.Duration {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return time.Since(wc.lastBeat)
+}
+
+// SetGone marks the worker without the heartbeats,
+// it won't get new games after that.
+func (wc *WorkerClient) SetGone() {
+	wc.mu.Lock()
+	wc.gone = true
+	wc.mu.Unlock()
+}
+
+// SetLoad updates the load of the worker from its heartbeat.
+func (wc *WorkerClient) SetLoad(load api.WorkerLoad) {
+	wc.mu.Lock()
+	wc.load, wc.hasLoad = load, true
+	wc.overloaded = load.Overloaded
+	wc.mu.Unlock()
+}
+
+// Load returns the number of the rooms and the load average of the worker.
+func (wc *WorkerClient) Load() (rooms int, load float64) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if !wc.hasLoad {
+		return wc.userCount, 0
+	}
+	return wc.rooms(), wc.load.LoadAvg
+}
+
+// SetOverloaded marks the worker which has rejected a new room,
+// it won't get new games until its next heartbeat.
+func (wc *WorkerClient) SetOverloaded() {
+	wc.mu.Lock()
+	wc.overloaded = true
+	wc.mu.Unlock()
+}
+
+// SetDraining marks the worker that stops,
+// it won't get new games after that.
+func (wc *WorkerClient) SetDraining() {
+	wc.mu.Lock()
+	wc.draining = true
+	wc.mu.Unlock()
+}
+
+// SetFeatures keeps the protocol version and the features advertised by the worker.
+func (wc *WorkerClient) SetFeatures(version int, features []string) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.version = version
+	wc.features = make(map[string]bool, len(features))
+	for _, feature := range features {
+		wc.features[feature] = true
+	}
+}
+
+// Supports tells if the worker has advertised the feature.
+func (wc *WorkerClient) Supports(feature string) bool {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return wc.features[feature]
+}
+
+// unsupported returns the error of the command the worker doesn't support, nil -- supported.
+func (wc *WorkerClient) unsupported(id string) error {
+	if feature := api.RequiredFeature(id); feature != "" && !wc.Supports(feature) {
+		return errors.New(api.UnsupportedError(feature))
+	}
+	return nil
+}
+
+// GetRoomStats requests the runtime stats of some room of the worker.
+func (wc *WorkerClient) GetRoomStats(roomID string) (api.RoomStatsResponse, error) {
+	if err := wc.unsupported(api.RoomStats); err != nil {
+		return api.RoomStatsResponse{}, err
+	}
+	stats := api.RoomStatsResponse{}
+	resp := wc.SyncSend(api.RoomStatsPacket(roomID))
+	if resp.Data == "error" {
+		return stats, fmt.Errorf("no stats for the room %v", roomID)
+	}
+	err := stats.From(resp.Data)
+	return stats, err
+}
+
+// GetConnectionStats requests the WebRTC connection stats of some session of the worker.
+func (wc *WorkerClient) GetConnectionStats(roomID string, sessionID string) (api.ConnectionStats, error) {
+	if err := wc.unsupported(api.GameConnectionStats); err != nil {
+		return api.ConnectionStats{}, err
+	}
+	stats := api.ConnectionStats{}
+	resp := wc.SyncSend(api.ConnectionStatsPacket(roomID, sessionID))
+	if resp.Data == "error" {
+		return stats, fmt.Errorf("no connection stats for the session %v", sessionID)
+	}
+	err := stats.From(resp.Data)
+	return stats, err
+}
+
+// Reconnect gives the seat of the gone session in the room of the worker
+// to the new session and returns the player index of the seat.
+func (wc *WorkerClient) Reconnect(roomID string, sessionID string, oldSessionID string) (int, error) {
+	resp := wc.SyncSend(api.ReconnectPacket(roomID, sessionID, oldSessionID))
+	if resp.Data == "error" {
+		return 0, fmt.Errorf("no seat of the session %v in the room %v", oldSessionID, roomID)
+	}
+	return resp.PlayerIndex, nil
+}
+
+// GetRoomScreenshot requests the current frame (PNG) of some room of the worker.
+func (wc *WorkerClient) GetRoomScreenshot(roomID string) ([]byte, error) {
+	screenshot := api.RoomScreenshotResponse{}
+	resp := wc.SyncSend(api.RoomScreenshotPacket(roomID))
+	if resp.Data == "error" {
+		return nil, fmt.Errorf("no screenshot of the room %v", roomID)
+	}
+	err := screenshot.From(resp.Data)
+	return screenshot.Image, err
+}
+
+// GetRoomSaveThumbnail requests the thumbnail (JPEG) of a save slot of some room of the worker.
+func (wc *WorkerClient) GetRoomSaveThumbnail(roomID string, slot int) ([]byte, error) {
+	if err := wc.unsupported(api.RoomSaveThumbnail); err != nil {
+		return nil, err
+	}
+	data, err := (&api.RoomSaveThumbnailRequest{Slot: slot}).To()
+	if err != nil {
+		return nil, err
+	}
+	thumbnail := api.RoomSaveThumbnailResponse{}
+	resp := wc.SyncSend(api.RoomSaveThumbnailPacket(roomID, data))
+	if resp.Data == "error" {
+		return nil, fmt.Errorf("no slot %v thumbnail of the room %v", slot, roomID)
+	}
+	err = thumbnail.From(resp.Data)
+	return thumbnail.Image, err
+}
+
+// ExportRoomSave requests the save file of some room of the worker.
+func (wc *WorkerClient) ExportRoomSave(roomID string) ([]byte, error) {
+	if err := wc.unsupported(api.RoomExportSave); err != nil {
+		return nil, err
+	}
+	save := api.RoomExportSaveResponse{}
+	resp := wc.SyncSend(api.RoomExportSavePacket(roomID))
+	if resp.Data == "error" {
+		return nil, fmt.Errorf("no save file of the room %v", roomID)
+	}
+	err := save.From(resp.Data)
+	return save.Save, err
+}
+
+// SetRoomCoreOption changes the core option (variable) of some room of the worker.
+func (wc *WorkerClient) SetRoomCoreOption(roomID string, key string, value string) error {
+	data, err := (&api.RoomCoreOptionRequest{Key: key, Value: value}).To()
+	if err != nil {
+		return err
+	}
+	resp := wc.SyncSend(api.RoomCoreOptionPacket(roomID, data))
+	if resp.Data == "error" {
+		return fmt.Errorf("couldn't set the core option %v of the room %v", key, roomID)
+	}
+	return nil
+}
+
+// SetRoomCheat enables or disables the cheat of some room of the worker.
+func (wc *WorkerClient) SetRoomCheat(roomID string, index int, code string, enabled bool) error {
+	data, err := (&api.RoomCheatRequest{Index: index, Code: code, Enabled: enabled}).To()
+	if err != nil {
+		return err
+	}
+	resp := wc.SyncSend(api.RoomCheatPacket(roomID, data))
+	if resp.Data == "error" {
+		return fmt.Errorf("couldn't change the cheat %v of the room %v", index, roomID)
+	}
+	return nil
+}
+
+// SwapRoomDisc changes the disc of the multi-disc game of some room of the worker.
+func (wc *WorkerClient) SwapRoomDisc(roomID string, index int) error {
+	data, err := (&api.RoomSwapDiscRequest{Index: index}).To()
+	if err != nil {
+		return err
+	}
+	resp := wc.SyncSend(api.RoomSwapDiscPacket(roomID, data))
+	if resp.Data == "error" {
+		return fmt.Errorf("couldn't swap the disc of the room %v to %v", roomID, index)
+	}
+	return nil
+}
+
+// SetRoomAudioBitrate changes the audio bitrate (bit/s) of some room of the worker.
+func (wc *WorkerClient) SetRoomAudioBitrate(roomID string, bitrate int) error {
+	data, err := (&api.RoomAudioBitrateRequest{Bitrate: bitrate}).To()
+	if err != nil {
+		return err
+	}
+	resp := wc.SyncSend(api.RoomAudioBitratePacket(roomID, data))
+	if resp.Data == "error" {
+		return fmt.Errorf("couldn't set the audio bitrate of the room %v to %v", roomID, bitrate)
+	}
+	return nil
+}
+
+// SetRoomVideoFilter changes the video filters of some room of the worker.
+func (wc *WorkerClient) SetRoomVideoFilter(roomID string, filters []string) error {
+	data, err := (&api.RoomVideoFilterRequest{Filters: filters}).To()
+	if err != nil {
+		return err
+	}
+	resp := wc.SyncSend(api.RoomVideoFilterPacket(roomID, data))
+	if resp.Data == "error" {
+		return fmt.Errorf("couldn't set the video filters of the room %v to %v", roomID, filters)
+	}
+	return nil
+}
+
+// ExportRoom stops some room of the worker for the migration to another worker
+// and returns the descriptor of the room.
+func (wc *WorkerClient) ExportRoom(roomID string) (api.RoomMigration, error) {
+	if err := wc.unsupported(api.RoomExport); err != nil {
+		return api.RoomMigration{}, err
+	}
+	migration := api.RoomMigration{}
+	resp := wc.SyncSend(api.RoomExportPacket(roomID))
+	if resp.Error != "" {
+		return migration, errors.New(resp.Error)
+	}
+	if resp.Data == "error" {
+		return migration, fmt.Errorf("couldn't export the room %v", roomID)
+	}
+	err := migration.From(resp.Data)
+	return migration, err
+}
+
+// ForkRoom uploads the snapshot of the game of some room of the owner session
+// for a new room and returns the descriptor of the new room.
+func (wc *WorkerClient) ForkRoom(roomID string, sessionID string) (api.RoomMigration, error) {
+	if err := wc.unsupported(api.RoomFork); err != nil {
+		return api.RoomMigration{}, err
+	}
+	fork := api.RoomMigration{}
+	resp := wc.SyncSend(api.RoomForkPacket(roomID, sessionID))
+	if resp.Error != "" {
+		return fork, errors.New(resp.Error)
+	}
+	if resp.Data == "error" {
+		return fork, fmt.Errorf("couldn't fork the room %v", roomID)
+	}
+	err := fork.From(resp.Data)
+	return fork, err
+}
+
+// ImportRoom starts the room exported by another worker.
+func (wc *WorkerClient) ImportRoom(migration api.RoomMigration) error {
+	if err := wc.unsupported(api.RoomImport); err != nil {
+		return err
+	}
+	data, err := migration.To()
+	if err != nil {
+		return err
+	}
+	resp := wc.SyncSend(api.RoomImportPacket(migration.RoomID, data))
+	if resp.Data != "ok" {
+		return fmt.Errorf("couldn't import the room %v", migration.RoomID)
+	}
+	return nil
+}
+
+// HandoffRoom ends the migration of the room exported by the worker,
+// the moved room is closed there and the rest go on.
+func (wc *WorkerClient) HandoffRoom(roomID string, moved bool) {
+	wc.Send(api.RoomHandoffPacket(roomID, moved), nil)
 }
 
 func (wc *WorkerClient) Printf(format string, args ...interface{}) {
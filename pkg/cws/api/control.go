@@ -0,0 +1,152 @@
+package api
+
+// The control commands of the peers sent over their WebRTC
+// control data channel, separated from the game input.
+const (
+	ControlSave       = "save"
+	ControlLoad       = "load"
+	ControlSaveSlot   = "save_slot"
+	ControlLoadSlot   = "load_slot"
+	ControlPause      = "pause"
+	ControlMultitap   = "multitap"
+	ControlScreenshot = "screenshot"
+	// ControlPorts returns the controller ports of the game with their devices
+	ControlPorts = "ports"
+	// ControlPortDevice plugs the device into the controller port
+	ControlPortDevice = "port_device"
+	// ControlKeyboard gives the keyboard of the computer cores
+	// to the session, the room owner by default (owner only)
+	ControlKeyboard = "keyboard"
+	// ControlVolume changes the audio volume of the peer (0-100)
+	ControlVolume = "volume"
+	// ControlMute turns off or on the audio of the peer
+	ControlMute = "mute"
+	// ControlChat sends the text message to all the peers of the room,
+	// the peers get the messages (and the history on join) as the replies without ID
+	ControlChat = "chat"
+	// ControlInputDelay sets the input delay of the players of the room
+	// in frames (owner only)
+	ControlInputDelay = "input_delay"
+	// ControlRumble is the event of the rumble of the controller of the player
+	// set by the game, it's sent as a reply without ID
+	ControlRumble = "rumble"
+	// ControlAchievement is the event of the game achievement unlocked
+	// in the room, it's sent to the room owner as a reply without ID
+	ControlAchievement = "achievement"
+	// ControlShutdown is the event (not a command) of the server shutdown,
+	// it's sent as a reply without ID
+	ControlShutdown = "shutdown"
+	// ControlKicked is the event of the session disconnected by the worker,
+	// it's sent as a reply without ID with the reason
+	ControlKicked = "kicked"
+	// ControlBandwidth is the event of the video bitrate of the room
+	// lowered (or restored) by the bandwidth cap of the room,
+	// it's sent as a reply without ID
+	ControlBandwidth = "bandwidth"
+	// ControlLeave releases the seat of the peer in the room right away
+	// (i.e. on the tab close), the session may still reconnect
+	ControlLeave = "leave"
+)
+
+// KickedInputFlood is the reason of the sessions kicked
+// for the input messages over the rate limit.
+const KickedInputFlood = "input_flood"
+
+// KickedStalled is the reason of the sessions kicked
+// for not taking their media (see the stalls of the rooms).
+const KickedStalled = "stalled"
+
+// KickedOwner is the reason of the sessions kicked by the owner of the room.
+const KickedOwner = "owner"
+
+// KickedBanned is the reason of the sessions banned by the owner of the room.
+const KickedBanned = "banned"
+
+// ControlCommand is a command of the peer,
+// i.e. {"id": 1, "cmd": "load_slot", "slot": 2}.
+// The ID is chosen by the peer to match the reply.
+type ControlCommand struct {
+	ID   uint32 `json:"id"`
+	Cmd  string `json:"cmd"`
+	Slot int    `json:"slot,omitempty"`
+	// the audio settings of the volume and mute commands
+	Volume int  `json:"volume,omitempty"`
+	Muted  bool `json:"muted,omitempty"`
+	// the controller port (from 0) and the device ID of the port_device command
+	Port   int    `json:"port,omitempty"`
+	Device uint32 `json:"device,omitempty"`
+	// the session (ID or user) of the keyboard command
+	Session string `json:"session,omitempty"`
+	// the message of the chat command
+	Text string `json:"text,omitempty"`
+	// the frames of the input_delay command
+	Frames int `json:"frames,omitempty"`
+}
+
+func (packet *ControlCommand) From(data string) error { return from(packet, data) }
+func (packet *ControlCommand) To() (string, error)    { return to(packet) }
+
+// ControlReply acknowledges the command with the same ID,
+// i.e. {"id": 1, "cmd": "pause", "ok": true, "data": {"paused": true}}.
+type ControlReply struct {
+	ID    uint32      `json:"id"`
+	Cmd   string      `json:"cmd"`
+	Ok    bool        `json:"ok"`
+	Error string      `json:"error,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+func (packet *ControlReply) From(data string) error { return from(packet, data) }
+func (packet *ControlReply) To() (string, error)    { return to(packet) }
+
+// KeyboardResponse is the session with the keyboard
+// after the keyboard command.
+type KeyboardResponse struct {
+	Holder string `json:"holder"`
+}
+
+// ChatMessage is the chat message of the room
+// with its sender set by the worker,
+// the player index (from 0) or -1 of the spectators.
+type ChatMessage struct {
+	Player    int    `json:"player"`
+	Spectator bool   `json:"spectator,omitempty"`
+	Text      string `json:"text"`
+	// the Unix time of the message
+	Time int64 `json:"time"`
+}
+
+// InputDelayResponse is the input delay of the room in frames.
+type InputDelayResponse struct {
+	Frames int `json:"frames"`
+}
+
+// AchievementEvent is the achievement unlocked in the room.
+type AchievementEvent struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Points      int    `json:"points"`
+	Badge       string `json:"badge,omitempty"`
+	Hardcore    bool   `json:"hardcore,omitempty"`
+}
+
+// KickedEvent is the reason of the disconnection of the session.
+type KickedEvent struct {
+	Reason string `json:"reason"`
+}
+
+// BandwidthEvent is the video bitrate limit of the room under its cap,
+// the rates are in kbit/s, 0 limit -- no limit.
+type BandwidthEvent struct {
+	Cap   uint `json:"cap"`
+	Rate  uint `json:"rate"`
+	Limit uint `json:"limit"`
+}
+
+// AudioVolumeResponse is the audio settings of the peer
+// after the volume and mute commands.
+type AudioVolumeResponse struct {
+	Volume int  `json:"volume"`
+	Muted  bool `json:"muted"`
+}
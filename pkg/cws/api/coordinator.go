@@ -1,10 +1,15 @@
 package api
 
-import "github.com/giongto35/cloud-game/v2/pkg/cws"
+import (
+	webrtcConfig "github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+)
 
 const (
 	GetRoom      = "get_room"
 	CloseRoom    = "close_room"
+	RoomError    = "room_error"
 	RegisterRoom = "register_room"
 	Heartbeat    = "heartbeat"
 	IceCandidate = "ice_candidate"
@@ -12,26 +17,117 @@ const (
 	NoData = ""
 
 	InitWebrtc = "init_webrtc"
+	Offer      = "offer"
 	Answer     = "answer"
 
 	GameStart        = "start"
+	GameReconnect    = "reconnect"
 	GameQuit         = "quit"
 	GameSave         = "save"
 	GameLoad         = "load"
+	GameSaveSlot     = "save_slot"
+	GameLoadSlot     = "load_slot"
+	GameSlots        = "slots"
 	GamePlayerSelect = "player_index"
 	GameMultitap     = "multitap"
+	GameKeyMapping   = "key_mapping"
+	GameRewind       = "rewind"
+	GamePause        = "pause"
+	GameFastForward  = "fast_forward"
 	GameRecording    = "recording"
-	GetServerList    = "get_server_list"
+	GameKick         = "kick"
+	GameBan          = "ban"
+	GamePassword     = "password"
+	// GameConnectionStats is the WebRTC connection stats of the session
+	GameConnectionStats = "connection_stats"
+	// GameMigrate tells the browser that its room has moved
+	// to another worker (with its STUN/TURN servers),
+	// the browser reconnects there
+	GameMigrate   = "migrate"
+	GetServerList = "get_server_list"
+	// GameList is the new list of the library games
+	// after the changes of the library
+	GameList = "game_list"
+	// GameJoinToken is the token of the session to join a room with
+	GameJoinToken = "join_token"
+	// GameImportSave loads the save file (exported from some room of the game)
+	// into the room of the owner, the errors tell why the save doesn't fit
+	GameImportSave = "import_save"
+	// GameFork clones the running game of the room of the owner
+	// into a new room on another worker, it responds with the ID of the new room
+	GameFork = "fork"
+	// GameInvite is the invite of the new players the owner shares
+	// with the link of the room, the rooms don't take the players without it
+	GameInvite = "invite"
+)
+
+// RoomFull is the room error of the joins over the limits of the room.
+const RoomFull = "room_full"
+
+// RoomGone is the room error of the rooms of the gone workers.
+const RoomGone = "room_gone"
+
+// The room errors of the rooms which have failed to start.
+const (
+	// RoomNoCore is the room error of the missing or broken emulator cores.
+	RoomNoCore = "no_core"
+	// RoomBadGame is the room error of the missing or broken game files.
+	RoomBadGame = "bad_game"
+	// RoomNoBios is the room error of the cores without their BIOS files,
+	// it's followed by the file, i.e. "no_bios: core Beetle PSX requires scph5501.bin".
+	RoomNoBios = "no_bios"
+	// RoomCrashed is the room error of the emulators crashed while loading.
+	RoomCrashed = "emulator_crash"
+	// RoomStartTimeout is the room error of the games loading too long.
+	RoomStartTimeout = "start_timeout"
+)
+
+// RoomOverloaded is the room error of the new rooms over the CPU budget of the worker,
+// the coordinator moves the browser to another worker with it.
+const RoomOverloaded = "overloaded"
+
+// RoomVideoFailed is the room error of the rooms closed by their failing video encoders.
+const RoomVideoFailed = "video_failure"
+
+// RoomNoCodec is the room error of the joins of the browsers
+// which can't decode the video codec of the running room.
+const RoomNoCodec = "no_codec"
+
+// the room errors of the join tokens,
+// the expired and invalid tokens should be requested again
+const (
+	JoinTokenExpired = "token_expired"
+	JoinTokenInvalid = "token_invalid"
+	JoinForbidden    = "forbidden"
 )
 
 type GameStartRequest struct {
 	GameName   string `json:"game_name"`
 	Record     bool   `json:"record,omitempty"`
 	RecordUser string `json:"record_user,omitempty"`
+	Spectator  bool   `json:"spectator,omitempty"`
+	// the password of the private room,
+	// the new room gets it
+	Password string `json:"password,omitempty"`
+	// the join token of the room
+	Token string `json:"token,omitempty"`
+	// the new room checks the achievements in the hardcore mode
+	// without the state loads and the cheats
+	Hardcore bool `json:"hardcore,omitempty"`
 }
 
 func (packet *GameStartRequest) From(data string) error { return from(packet, data) }
 
+// GameJoinTokenRequest asks the token to join the room (the packet one).
+type GameJoinTokenRequest struct {
+	Spectator bool `json:"spectator,omitempty"`
+	// the invite of the owner the players of the running rooms need
+	Invite string `json:"invite,omitempty"`
+}
+
+func (packet *GameJoinTokenRequest) From(data string) error { return from(packet, data) }
+func (packet *GameJoinTokenRequest) To() (string, error)    { return to(packet) }
+
 type GameRecordingRequest struct {
 	Active bool   `json:"active"`
 	User   string `json:"user"`
@@ -39,6 +135,81 @@ type GameRecordingRequest struct {
 
 func (packet *GameRecordingRequest) From(data string) error { return from(packet, data) }
 
+type GameSlotRequest struct {
+	Slot int `json:"slot"`
+}
+
+func (packet *GameSlotRequest) From(data string) error { return from(packet, data) }
+func (packet *GameSlotRequest) To() (string, error)    { return to(packet) }
+
+type GameSlotsResponse struct {
+	Slots []int `json:"slots"`
+}
+
+func (packet *GameSlotsResponse) From(data string) error { return from(packet, data) }
+func (packet *GameSlotsResponse) To() (string, error)    { return to(packet) }
+
+type GameKeyMappingRequest struct {
+	Mapping map[uint8]uint8 `json:"mapping"`
+}
+
+func (packet *GameKeyMappingRequest) From(data string) error { return from(packet, data) }
+func (packet *GameKeyMappingRequest) To() (string, error)    { return to(packet) }
+
+// GameImportSaveRequest has the save file exported from a room.
+type GameImportSaveRequest struct {
+	Save []byte `json:"save"`
+}
+
+func (packet *GameImportSaveRequest) From(data string) error { return from(packet, data) }
+func (packet *GameImportSaveRequest) To() (string, error)    { return to(packet) }
+
+type GameRewindRequest struct {
+	Seconds float64 `json:"seconds"`
+}
+
+func (packet *GameRewindRequest) From(data string) error { return from(packet, data) }
+func (packet *GameRewindRequest) To() (string, error)    { return to(packet) }
+
+type GameFastForwardRequest struct {
+	Speed float64 `json:"speed"`
+}
+
+func (packet *GameFastForwardRequest) From(data string) error { return from(packet, data) }
+func (packet *GameFastForwardRequest) To() (string, error)    { return to(packet) }
+
+type GamePauseResponse struct {
+	Paused bool `json:"paused"`
+}
+
+func (packet *GamePauseResponse) From(data string) error { return from(packet, data) }
+func (packet *GamePauseResponse) To() (string, error)    { return to(packet) }
+
+// GameKickRequest removes the session from the room of the owner (kick or ban).
+type GameKickRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+func (packet *GameKickRequest) From(data string) error { return from(packet, data) }
+func (packet *GameKickRequest) To() (string, error)    { return to(packet) }
+
+// GamePasswordRequest changes the password of the room of the owner.
+type GamePasswordRequest struct {
+	Password string `json:"password"`
+}
+
+func (packet *GamePasswordRequest) From(data string) error { return from(packet, data) }
+func (packet *GamePasswordRequest) To() (string, error)    { return to(packet) }
+
+// InitWebrtcCall has the ICE servers of the session (with its TURN credentials)
+// the worker creates the connection with.
+type InitWebrtcCall struct {
+	IceServers []webrtcConfig.IceServer `json:"ice_servers,omitempty"`
+}
+
+func (packet *InitWebrtcCall) From(data string) error { return from(packet, data) }
+func (packet *InitWebrtcCall) To() (string, error)    { return to(packet) }
+
 type GameStartCall struct {
 	Name       string `json:"name"`
 	Base       string `json:"base"`
@@ -46,6 +217,18 @@ type GameStartCall struct {
 	Type       string `json:"type"`
 	Record     bool   `json:"record,omitempty"`
 	RecordUser string `json:"record_user,omitempty"`
+	Spectator  bool   `json:"spectator,omitempty"`
+	Password   string `json:"password,omitempty"`
+	// the settings of the game overriding the worker config
+	Overrides *games.Overrides `json:"overrides,omitempty"`
+	// the content hash of the game file
+	Hash string `json:"hash,omitempty"`
+	// the join token of the session
+	Token    string `json:"token,omitempty"`
+	Hardcore bool   `json:"hardcore,omitempty"`
+	// the user ID of the session signed by the coordinator,
+	// empty -- the anonymous session
+	User string `json:"user,omitempty"`
 }
 
 func (packet *GameStartCall) From(data string) error { return from(packet, data) }
@@ -59,6 +242,66 @@ type ConnectionRequest struct {
 	Tag     string `json:"tag,omitempty"`
 	Zone    string `json:"zone,omitempty"`
 	Xid     string `json:"xid,omitempty"`
+	// the version of the protocol and the features of the worker,
+	// the old workers don't have them
+	Version  int      `json:"version,omitempty"`
+	Features []string `json:"features,omitempty"`
+}
+
+// ProtocolVersion is the version of the coordinator-worker protocol,
+// 0 is the one of the workers before the handshake.
+const ProtocolVersion = 1
+
+// The features of the workers advertised with their connection requests.
+const (
+	FeatureSaveSlots  = "save-slots"
+	FeatureRewind     = "rewind"
+	FeatureRecordings = "recordings"
+	FeatureStatsV2    = "stats-v2"
+	FeatureMigration  = "migration"
+	FeatureLeave      = "leave"
+	FeatureSaveFiles  = "save-files"
+	FeatureForks      = "forks"
+	FeatureInvites    = "invites"
+)
+
+// Features are the features of this worker.
+var Features = []string{FeatureSaveSlots, FeatureRewind, FeatureRecordings, FeatureStatsV2, FeatureMigration,
+	FeatureLeave, FeatureSaveFiles, FeatureForks, FeatureInvites}
+
+// commandFeatures are the features of the worker required by the commands,
+// the rest of the commands are supported by all the workers.
+var commandFeatures = map[string]string{
+	GameSaveSlot:        FeatureSaveSlots,
+	GameLoadSlot:        FeatureSaveSlots,
+	GameSlots:           FeatureSaveSlots,
+	RoomSaveThumbnail:   FeatureSaveSlots,
+	GameRewind:          FeatureRewind,
+	GameRecording:       FeatureRecordings,
+	RoomRecording:       FeatureRecordings,
+	GameConnectionStats: FeatureStatsV2,
+	RoomStats:           FeatureStatsV2,
+	RoomExport:          FeatureMigration,
+	RoomImport:          FeatureMigration,
+	RoomHandoff:         FeatureMigration,
+	SessionLeave:        FeatureLeave,
+	GameImportSave:      FeatureSaveFiles,
+	RoomExportSave:      FeatureSaveFiles,
+	GameFork:            FeatureForks,
+	RoomFork:            FeatureForks,
+	GameInvite:          FeatureInvites,
+}
+
+// RequiredFeature returns the feature of the worker the command requires, "" -- none.
+func RequiredFeature(id string) string { return commandFeatures[id] }
+
+// Unsupported is the error of the commands the worker doesn't support,
+// it's followed by the feature, i.e. "unsupported: worker does not support rewind".
+const Unsupported = "unsupported"
+
+// UnsupportedError returns the error of the feature the worker doesn't support.
+func UnsupportedError(feature string) string {
+	return Unsupported + ": worker does not support " + feature
 }
 
 type GetServerListRequest struct{}
@@ -84,11 +327,34 @@ type Server struct {
 func (packet *GetServerListRequest) From(data string) error { return from(packet, data) }
 func (packet *GetServerListResponse) To() (string, error)   { return to(packet) }
 
+// LobbyRoom is the public room in the lobby of the coordinator.
+type LobbyRoom struct {
+	ID         string `json:"id"`
+	Game       string `json:"game"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"max_players"`
+	// the network zone (region) of the worker of the room
+	Zone string `json:"zone,omitempty"`
+}
+
 // packets
 
 func RegisterRoomPacket(data string) cws.WSPacket { return cws.WSPacket{ID: RegisterRoom, Data: data} }
 func GetRoomPacket(data string) cws.WSPacket      { return cws.WSPacket{ID: GetRoom, Data: data} }
 func CloseRoomPacket(data string) cws.WSPacket    { return cws.WSPacket{ID: CloseRoom, Data: data} }
+func RoomErrorPacket(roomID string, err string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomError, RoomID: roomID, Data: err}
+}
 func IceCandidatePacket(data string, sessionId string) cws.WSPacket {
 	return cws.WSPacket{ID: IceCandidate, Data: data, SessionID: sessionId}
 }
+func OfferPacket(data string, sessionId string) cws.WSPacket {
+	return cws.WSPacket{ID: Offer, Data: data, SessionID: sessionId}
+}
+func GameMigratePacket(roomID string, stunturn string) cws.WSPacket {
+	return cws.WSPacket{ID: GameMigrate, RoomID: roomID, Data: stunturn}
+}
+func GameListPacket(games []string) cws.WSPacket {
+	data, _ := to(games)
+	return cws.WSPacket{ID: GameList, Data: data}
+}
@@ -1,10 +1,50 @@
 package api
 
-import "github.com/giongto35/cloud-game/v2/pkg/cws"
+import (
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+)
 
 const (
 	ServerId         = "server_id"
 	TerminateSession = "terminateSession"
+	RoomStats        = "room_stats"
+	RoomScreenshot   = "room_screenshot"
+	RoomRecording    = "room_recording"
+	RoomCoreOption   = "room_core_option"
+	RoomCheat        = "room_cheat"
+	RoomSwapDisc     = "room_swap_disc"
+	RoomAudioBitrate = "room_audio_bitrate"
+	RoomVideoFilter  = "room_video_filter"
+	// RoomSaveThumbnail returns the thumbnail of a save slot of a room
+	RoomSaveThumbnail = "room_save_thumbnail"
+	// RoomExport pauses the room and uploads its state
+	// for the migration to another worker
+	RoomExport = "room_export"
+	// RoomImport creates the migrated room on the target worker
+	RoomImport = "room_import"
+	// RoomHandoff ends the migration on the source worker,
+	// the room is closed with "ok" and resumed otherwise
+	RoomHandoff = "room_handoff"
+	// WorkerDrain stops the worker gracefully,
+	// the worker reports its drain status with it as well
+	WorkerDrain = "drain"
+	// RoomStatus is the periodic report of the rooms of the worker
+	RoomStatus = "room_status"
+	// SessionLeave releases the seat of the session which has left
+	// (i.e. closed the tab) in its room, the session may still reconnect
+	SessionLeave = "session_leave"
+	// RoomExportSave returns the save file of a room (state, save RAM and their game)
+	RoomExportSave = "room_export_save"
+	// RoomFork uploads the snapshot of the game of a room for a new room
+	// and returns the descriptor (RoomMigration) of the new room
+	RoomFork = "room_fork"
+)
+
+// the drain statuses of the worker
+const (
+	WorkerDraining = "draining"
+	WorkerDrained  = "drained"
 )
 
 type ConfPushCall struct {
@@ -14,8 +54,306 @@ type ConfPushCall struct {
 func (packet *ConfPushCall) From(data string) error { return from(packet, data) }
 func (packet *ConfPushCall) To() (string, error)    { return to(packet) }
 
+// RoomStatsResponse contains the runtime stats of a room.
+type RoomStatsResponse struct {
+	Fps       float64 `json:"fps"`
+	TargetFps float64 `json:"target_fps"`
+	// the average video encoding time in ms
+	EncodeLatency float64 `json:"encode_latency"`
+	Players       int     `json:"players"`
+	Spectators    int     `json:"spectators"`
+	// the limits of the room, 0 spectators -- unlimited
+	MaxPlayers        int    `json:"max_players"`
+	MaxSpectators     int    `json:"max_spectators"`
+	DroppedFrames     uint64 `json:"dropped_frames"`
+	SkippedFrames     uint64 `json:"skipped_frames"`
+	PeerDroppedFrames uint64 `json:"peer_dropped_frames"`
+	// the number of the saves not uploaded into the cloud storage yet
+	PendingUploads int `json:"pending_uploads"`
+	// the number of the restarts of the hung or exited emulator
+	Recoveries int `json:"recoveries"`
+	// the worst round-trip time (ms) and packet loss (0-1) of the sessions
+	MaxRTT        float64 `json:"max_rtt"`
+	MaxPacketLoss float64 `json:"max_packet_loss"`
+	// the connection stats by the session ID
+	Connections map[string]ConnectionStats `json:"connections,omitempty"`
+	// the number of the dropped input messages by the session ID
+	InputDropped map[string]uint64 `json:"input_dropped,omitempty"`
+	// the media bytes sent by the room (including the gone sessions)
+	// and by its sessions by the session ID
+	Egress        Egress            `json:"egress"`
+	SessionEgress map[string]Egress `json:"session_egress,omitempty"`
+	// the video bitrate limit (kbit/s) of the room over its bandwidth cap,
+	// 0 -- none
+	EgressLimit uint `json:"egress_limit,omitempty"`
+	// the video of the game, so the clients could align their canvas
+	Viewport *Viewport `json:"viewport,omitempty"`
+}
+
+// Egress is the number of the sent media bytes.
+type Egress struct {
+	Video uint64 `json:"video"`
+	Audio uint64 `json:"audio"`
+}
+
+// Viewport is the scaling mode and the size of the video frames.
+type Viewport struct {
+	Mode   string `json:"mode"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// the part of the game frames in the video (0-1), the fill mode crops them
+	Crop *ViewportCrop `json:"crop,omitempty"`
+}
+
+// ViewportCrop is the part of the game frames in the fractions of their size.
+type ViewportCrop struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
+}
+
+func (packet *RoomStatsResponse) From(data string) error { return from(packet, data) }
+func (packet *RoomStatsResponse) To() (string, error)    { return to(packet) }
+
+// RoomInfo is the short description of a room.
+type RoomInfo struct {
+	ID   string `json:"id"`
+	Game string `json:"game"`
+	// the time since the start of the room in seconds
+	Uptime     float64 `json:"uptime"`
+	Players    int     `json:"players"`
+	Spectators int     `json:"spectators"`
+	MaxPlayers int     `json:"max_players"`
+	// the room has the password
+	Private bool `json:"private"`
+}
+
+// WorkerLoad is the load of the worker in its heartbeats.
+type WorkerLoad struct {
+	Rooms int `json:"rooms"`
+	// the max number of the rooms of the worker, 0 -- unlimited
+	MaxRooms int `json:"max_rooms"`
+	// the peers of all the rooms
+	Sessions int `json:"sessions"`
+	// the load average of the last minute per core (0-1),
+	// it's not the CPU usage as it counts the waiting processes too
+	LoadAvg float64 `json:"load_avg"`
+	// the available memory in bytes
+	FreeMemory uint64 `json:"free_memory"`
+	// the worker has no CPU budget for new rooms
+	Overloaded bool `json:"overloaded,omitempty"`
+}
+
+func (packet *WorkerLoad) From(data string) error { return from(packet, data) }
+func (packet *WorkerLoad) To() (string, error)    { return to(packet) }
+
+// RoomStatusRequest contains all the rooms of the worker.
+type RoomStatusRequest struct {
+	Rooms []RoomInfo `json:"rooms"`
+}
+
+func (packet *RoomStatusRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomStatusRequest) To() (string, error)    { return to(packet) }
+
+// ConnectionStats contains the WebRTC connection quality of a session.
+type ConnectionStats struct {
+	Video TrackStats `json:"video"`
+	Audio TrackStats `json:"audio"`
+	// all the bytes sent over the connection
+	BytesSent uint64 `json:"bytes_sent"`
+}
+
+func (packet *ConnectionStats) From(data string) error { return from(packet, data) }
+func (packet *ConnectionStats) To() (string, error)    { return to(packet) }
+
+// TrackStats contains the stats of a media track of a session.
+type TrackStats struct {
+	// the round-trip time in ms
+	RTT float64 `json:"rtt"`
+	// the fraction (0-1) of the lost packets
+	PacketLoss float64 `json:"packet_loss"`
+	// the interarrival jitter in ms
+	Jitter    float64 `json:"jitter"`
+	BytesSent uint64  `json:"bytes_sent"`
+}
+
+// RoomScreenshotResponse contains the current frame of a room in PNG.
+type RoomScreenshotResponse struct {
+	Image []byte `json:"image"`
+}
+
+func (packet *RoomScreenshotResponse) From(data string) error { return from(packet, data) }
+func (packet *RoomScreenshotResponse) To() (string, error)    { return to(packet) }
+
+// RoomSaveThumbnailRequest requests the thumbnail of a save slot of a room.
+type RoomSaveThumbnailRequest struct {
+	Slot int `json:"slot"`
+}
+
+func (packet *RoomSaveThumbnailRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomSaveThumbnailRequest) To() (string, error)    { return to(packet) }
+
+// RoomSaveThumbnailResponse contains the thumbnail of a save slot of a room in JPEG.
+type RoomSaveThumbnailResponse struct {
+	Image []byte `json:"image"`
+}
+
+func (packet *RoomSaveThumbnailResponse) From(data string) error { return from(packet, data) }
+func (packet *RoomSaveThumbnailResponse) To() (string, error)    { return to(packet) }
+
+// RoomExportSaveResponse contains the save file of a room.
+type RoomExportSaveResponse struct {
+	Save []byte `json:"save"`
+}
+
+func (packet *RoomExportSaveResponse) From(data string) error { return from(packet, data) }
+func (packet *RoomExportSaveResponse) To() (string, error)    { return to(packet) }
+
+// RoomRecordingRequest starts or stops the WebM recording of a room.
+type RoomRecordingRequest struct {
+	Active bool `json:"active"`
+}
+
+func (packet *RoomRecordingRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomRecordingRequest) To() (string, error)    { return to(packet) }
+
+// RoomRecordingResponse contains the recording file of a room.
+type RoomRecordingResponse struct {
+	File string `json:"file"`
+}
+
+func (packet *RoomRecordingResponse) From(data string) error { return from(packet, data) }
+func (packet *RoomRecordingResponse) To() (string, error)    { return to(packet) }
+
+// RoomCoreOptionRequest changes the core option (variable) of a room.
+type RoomCoreOptionRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (packet *RoomCoreOptionRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomCoreOptionRequest) To() (string, error)    { return to(packet) }
+
+// RoomCheatRequest enables or disables the cheat of a room,
+// an empty code enables one of the cheats of the game file.
+type RoomCheatRequest struct {
+	Index   int    `json:"index"`
+	Code    string `json:"code,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+func (packet *RoomCheatRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomCheatRequest) To() (string, error)    { return to(packet) }
+
+// RoomSwapDiscRequest changes the disc of the multi-disc game of a room.
+type RoomSwapDiscRequest struct {
+	Index int `json:"index"`
+}
+
+func (packet *RoomSwapDiscRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomSwapDiscRequest) To() (string, error)    { return to(packet) }
+
+// RoomAudioBitrateRequest changes the audio bitrate (bit/s) of a room.
+type RoomAudioBitrateRequest struct {
+	Bitrate int `json:"bitrate"`
+}
+
+func (packet *RoomAudioBitrateRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomAudioBitrateRequest) To() (string, error)    { return to(packet) }
+
+// RoomVideoFilterRequest changes the video filters of a room,
+// no filters turn them off.
+type RoomVideoFilterRequest struct {
+	Filters []string `json:"filters"`
+}
+
+func (packet *RoomVideoFilterRequest) From(data string) error { return from(packet, data) }
+func (packet *RoomVideoFilterRequest) To() (string, error)    { return to(packet) }
+
+// RoomMigration describes the room moving to another worker,
+// the state of the room is in the cloud storage.
+type RoomMigration struct {
+	RoomID string `json:"room_id"`
+	Name   string `json:"name"`
+	Base   string `json:"base"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	// the settings of the game overriding the worker config
+	Overrides *games.Overrides `json:"overrides,omitempty"`
+	// the content hash of the game file
+	Hash string `json:"hash,omitempty"`
+	// the player indices by the browser session ID
+	Players map[string]int `json:"players,omitempty"`
+	// the browser sessions of the spectators
+	Spectators []string `json:"spectators,omitempty"`
+	// the password hash of the private room
+	PasswordHash []byte `json:"password_hash,omitempty"`
+	// the room is in the hardcore mode of the achievements
+	Hardcore bool `json:"hardcore,omitempty"`
+}
+
+func (packet *RoomMigration) From(data string) error { return from(packet, data) }
+func (packet *RoomMigration) To() (string, error)    { return to(packet) }
+
 func ServerIdPacket(id string) cws.WSPacket        { return cws.WSPacket{ID: ServerId, Data: id} }
 func ConfigRequestPacket(conf []byte) cws.WSPacket { return cws.WSPacket{Data: string(conf)} }
 func TerminateSessionPacket(sessionId string) cws.WSPacket {
 	return cws.WSPacket{ID: TerminateSession, SessionID: sessionId}
 }
+func SessionLeavePacket(sessionId string) cws.WSPacket {
+	return cws.WSPacket{ID: SessionLeave, SessionID: sessionId}
+}
+func WorkerDrainPacket(status string) cws.WSPacket {
+	return cws.WSPacket{ID: WorkerDrain, Data: status}
+}
+func RoomStatusPacket(data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomStatus, Data: data}
+}
+func RoomStatsPacket(roomId string) cws.WSPacket { return cws.WSPacket{ID: RoomStats, RoomID: roomId} }
+func ConnectionStatsPacket(roomId string, sessionId string) cws.WSPacket {
+	return cws.WSPacket{ID: GameConnectionStats, RoomID: roomId, SessionID: sessionId}
+}
+func ReconnectPacket(roomId string, sessionId string, oldSessionId string) cws.WSPacket {
+	return cws.WSPacket{ID: GameReconnect, RoomID: roomId, SessionID: sessionId, Data: oldSessionId}
+}
+func RoomScreenshotPacket(roomId string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomScreenshot, RoomID: roomId}
+}
+func RoomSaveThumbnailPacket(roomId string, data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomSaveThumbnail, RoomID: roomId, Data: data}
+}
+func RoomCoreOptionPacket(roomId string, data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomCoreOption, RoomID: roomId, Data: data}
+}
+func RoomCheatPacket(roomId string, data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomCheat, RoomID: roomId, Data: data}
+}
+func RoomSwapDiscPacket(roomId string, data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomSwapDisc, RoomID: roomId, Data: data}
+}
+func RoomAudioBitratePacket(roomId string, data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomAudioBitrate, RoomID: roomId, Data: data}
+}
+func RoomVideoFilterPacket(roomId string, data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomVideoFilter, RoomID: roomId, Data: data}
+}
+func RoomExportPacket(roomId string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomExport, RoomID: roomId}
+}
+func RoomExportSavePacket(roomId string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomExportSave, RoomID: roomId}
+}
+func RoomForkPacket(roomId string, sessionId string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomFork, RoomID: roomId, SessionID: sessionId}
+}
+func RoomImportPacket(roomId string, data string) cws.WSPacket {
+	return cws.WSPacket{ID: RoomImport, RoomID: roomId, Data: data}
+}
+func RoomHandoffPacket(roomId string, ok bool) cws.WSPacket {
+	data := "error"
+	if ok {
+		data = "ok"
+	}
+	return cws.WSPacket{ID: RoomHandoff, RoomID: roomId, Data: data}
+}
@@ -22,6 +22,9 @@ type (
 		sendCallbackLock sync.Mutex
 		// recvCallback is callback when receive based on ID of the packet
 		recvCallback map[string]func(req WSPacket)
+		// sent are the IDs of the sent packets,
+		// the packets with them are their replies
+		sent map[string]struct{}
 
 		Done chan struct{}
 	}
@@ -37,6 +40,9 @@ type (
 		PacketID string `json:"packet_id"`
 		// Globally ID of a browser session
 		SessionID string `json:"session_id"`
+		// the error of the packet the peer couldn't handle,
+		// i.e. the unknown one (the old peers don't have it)
+		Error string `json:"error,omitempty"`
 	}
 
 	PacketHandler func(resp WSPacket) (req WSPacket)
@@ -49,6 +55,9 @@ var (
 
 const WSWait = 20 * time.Second
 
+// ErrUnknownPacket is the error of the acks of the unknown packets.
+const ErrUnknownPacket = "unknown packet"
+
 func NewClient(conn *websocket.Conn) *Client {
 	id := uuid.Must(uuid.NewV4()).String()
 	sendCallback := map[string]func(WSPacket){}
@@ -60,6 +69,7 @@ func NewClient(conn *websocket.Conn) *Client {
 
 		sendCallback: sendCallback,
 		recvCallback: recvCallback,
+		sent:         map[string]struct{}{},
 
 		Done: make(chan struct{}),
 	}
@@ -91,6 +101,9 @@ func (c *Client) Send(request WSPacket, callback func(response WSPacket)) {
 		c.sendCallback[request.PacketID] = wrapperCallback
 		c.sendCallbackLock.Unlock()
 	}
+	c.sendCallbackLock.Lock()
+	c.sent[request.ID] = struct{}{}
+	c.sendCallbackLock.Unlock()
 
 	c.sendLock.Lock()
 	c.conn.SetWriteDeadline(time.Now().Add(WSWait))
@@ -156,11 +169,23 @@ func (c *Client) SyncSend(request WSPacket) (response WSPacket) {
 
 // Heartbeat maintains connection to coordinator.
 // Blocking.
-func (c *Client) Heartbeat() {
+func (c *Client) Heartbeat() { c.HeartbeatWith(nil) }
+
+// HeartbeatWith maintains connection to coordinator
+// with the data of the heartbeats (i.e. the load of the worker).
+// Blocking.
+func (c *Client) HeartbeatWith(data func() string) {
+	beat := func() {
+		packet := HeartbeatPacket
+		if data != nil {
+			packet.Data = data()
+		}
+		c.Send(packet, nil)
+	}
 	// send heartbeat every 1s
 	t := time.NewTicker(time.Second)
 	// don't wait 1 second
-	c.Send(HeartbeatPacket, nil)
+	beat()
 	for {
 		select {
 		case <-c.Done:
@@ -168,7 +193,7 @@ func (c *Client) Heartbeat() {
 			log.Printf("Close heartbeat")
 			return
 		case <-t.C:
-			c.Send(HeartbeatPacket, nil)
+			beat()
 		}
 	}
 }
@@ -207,10 +232,48 @@ func (c *Client) Listen() {
 		// Check if some receiver with the ID is registered
 		if callback, ok := c.recvCallback[wspacket.ID]; ok {
 			go callback(wspacket)
+			continue
 		}
+		c.unknown(wspacket)
 	}
 }
 
+// unknown logs the packet without the receiver and acks it with the error,
+// so the peer doesn't wait for it.
+// The replies of the sent packets (and the empty ones) go without the acks
+// and so do the errors.
+func (c *Client) unknown(packet WSPacket) {
+	if packet.ID == "" {
+		return
+	}
+	if packet.Error != "" {
+		log.Printf("warn: the peer couldn't handle the packet %v, %v", packet.ID, packet.Error)
+		return
+	}
+	c.sendCallbackLock.Lock()
+	_, reply := c.sent[packet.ID]
+	c.sendCallbackLock.Unlock()
+	if reply {
+		return
+	}
+	log.Printf("warn: unknown packet %v", packet.ID)
+	data, err := json.Marshal(WSPacket{
+		ID:        packet.ID,
+		Data:      "error",
+		RoomID:    packet.RoomID,
+		PacketID:  packet.PacketID,
+		SessionID: packet.SessionID,
+		Error:     ErrUnknownPacket + " " + packet.ID,
+	})
+	if err != nil {
+		return
+	}
+	c.sendLock.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(WSWait))
+	c.conn.WriteMessage(websocket.TextMessage, data)
+	c.sendLock.Unlock()
+}
+
 func (c *Client) Close() {
 	if c == nil || c.conn == nil {
 		return
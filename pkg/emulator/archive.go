@@ -0,0 +1,222 @@
+package emulator
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveExt is the extension of the game archives.
+const ArchiveExt = ".zip"
+
+// archiveMemberSep separates the archive and its member in the game paths,
+// e.g. roms/snes.zip#mario.sfc.
+const archiveMemberSep = "#"
+
+// GameFile is the game file to load into the core.
+type GameFile struct {
+	// Path is the game file path, archive#member for the archive members
+	Path string
+	// Size is the size of the game in bytes
+	Size int64
+	// Data is the game content for the cores loading games from memory
+	Data []byte
+}
+
+// IsArchive tells if the game path is a game archive or its member.
+func IsArchive(path string) bool {
+	archive, _ := SplitArchivePath(path)
+	return archive != ""
+}
+
+// SplitArchivePath splits the game path into the archive path and the archive member,
+// e.g. roms/snes.zip#mario.sfc -> roms/snes.zip, mario.sfc.
+// The member is empty for the archive paths without it,
+// the archive is empty for the non-archive paths.
+func SplitArchivePath(path string) (archive string, member string) {
+	sep := ArchiveExt + archiveMemberSep
+	if i := strings.LastIndex(strings.ToLower(path), sep); i >= 0 {
+		return path[:i+len(ArchiveExt)], path[i+len(sep):]
+	}
+	if strings.EqualFold(filepath.Ext(path), ArchiveExt) {
+		return path, ""
+	}
+	return "", ""
+}
+
+// ArchivePath returns the game path of the archive member.
+func ArchivePath(archive string, member string) string {
+	if member == "" {
+		return archive
+	}
+	return archive + archiveMemberSep + member
+}
+
+// ArchiveMembers returns the files of the archive.
+func ArchiveMembers(archive string) ([]string, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	var members []string
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() {
+			members = append(members, f.Name)
+		}
+	}
+	return members, nil
+}
+
+// FindArchiveMember returns the first file of the archive with one of the extensions (without dot).
+func FindArchiveMember(archive string, extensions []string) (string, error) {
+	members, err := ArchiveMembers(archive)
+	if err != nil {
+		return "", err
+	}
+	for _, member := range members {
+		ext := strings.TrimPrefix(filepath.Ext(member), ".")
+		for _, e := range extensions {
+			if ext != "" && strings.EqualFold(ext, e) {
+				return member, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no games with %v in %v", extensions, archive)
+}
+
+// ReadArchiveMember reads the file of the archive into memory.
+func ReadArchiveMember(archive string, member string) ([]byte, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	for _, f := range r.File {
+		if f.Name != member {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rc.Close() }()
+		return ioutil.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("no %v in %v", member, archive)
+}
+
+// extractArchive writes all the files of the archive into the directory.
+func extractArchive(archive string, dir string) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+	for _, f := range r.File {
+		path, err := memberPath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractFile(f, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberPath returns the path of the extracted archive member
+// keeping it inside the directory.
+func memberPath(dir string, member string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(member))
+	if path != dir && !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", errors.New("illegal archive member path " + member)
+	}
+	return path, nil
+}
+
+func extractFile(f *zip.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// OpenGame prepares the game file for the core with the list of
+// supported game extensions (the core valid_extensions).
+// The cores which load games from memory get the archive member content,
+// the fullpath ones get the member extracted into the cache
+// which should be released with RomCache.Release after the game.
+// The archives of the cores which support them (i.e. arcade romsets) stay as is.
+func OpenGame(path string, fullPath bool, extensions []string, cache RomCache) (GameFile, error) {
+	archive, member := SplitArchivePath(path)
+	if archive != "" && member == "" {
+		for _, ext := range extensions {
+			if "."+strings.ToLower(ext) == ArchiveExt {
+				archive = ""
+				break
+			}
+		}
+	}
+	if archive == "" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return GameFile{}, err
+		}
+		game := GameFile{Path: path, Size: fi.Size()}
+		if !fullPath {
+			if game.Data, err = ioutil.ReadFile(path); err != nil {
+				return GameFile{}, err
+			}
+		}
+		return game, nil
+	}
+
+	if member == "" {
+		var err error
+		if member, err = FindArchiveMember(archive, extensions); err != nil {
+			return GameFile{}, err
+		}
+	}
+	if !fullPath {
+		data, err := ReadArchiveMember(archive, member)
+		if err != nil {
+			return GameFile{}, err
+		}
+		return GameFile{Path: ArchivePath(archive, member), Size: int64(len(data)), Data: data}, nil
+	}
+	extracted, err := cache.Extract(archive, member)
+	if err != nil {
+		return GameFile{}, err
+	}
+	fi, err := os.Stat(extracted)
+	if err != nil {
+		cache.Release(extracted)
+		return GameFile{}, err
+	}
+	return GameFile{Path: extracted, Size: fi.Size()}, nil
+}
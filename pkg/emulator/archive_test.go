@@ -0,0 +1,163 @@
+package emulator
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeZip makes a zip archive with the files.
+func writeZip(t *testing.T, path string, files ...string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for i := 0; i < len(files); i += 2 {
+		fw, err := w.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(files[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitArchivePath(t *testing.T) {
+	tests := []struct {
+		path, archive, member string
+	}{
+		{path: "roms/mario.nes"},
+		{path: "roms/mario.zip", archive: "roms/mario.zip"},
+		{path: "roms/snes.ZIP#mario.sfc", archive: "roms/snes.ZIP", member: "mario.sfc"},
+		{path: "roms/snes.zip#dir/mario #1.sfc", archive: "roms/snes.zip", member: "dir/mario #1.sfc"},
+		{path: "roms/#1.nes"},
+	}
+	for _, test := range tests {
+		archive, member := SplitArchivePath(test.path)
+		if archive != test.archive || member != test.member {
+			t.Errorf("wrong split of %v: %q %q", test.path, archive, member)
+		}
+		if archive != "" && ArchivePath(archive, member) != test.path {
+			t.Errorf("wrong archive path %v", ArchivePath(archive, member))
+		}
+	}
+}
+
+func TestOpenGame(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	archive := filepath.Join(dir, "snes.zip")
+	writeZip(t, archive, "readme.txt", "hi", "mario.sfc", "MARIO", "disc/zelda.sfc", "ZELDA")
+	exts := []string{"smc", "sfc"}
+	cache := RomCache{Dir: filepath.Join(dir, "cache")}
+
+	// in-memory cores
+	game, err := OpenGame(archive, false, exts, cache)
+	if err != nil {
+		t.Fatalf("couldn't open the game, %v", err)
+	}
+	if game.Path != archive+"#mario.sfc" || string(game.Data) != "MARIO" || game.Size != 5 {
+		t.Errorf("wrong game %v %q %v", game.Path, game.Data, game.Size)
+	}
+	game, err = OpenGame(ArchivePath(archive, "disc/zelda.sfc"), false, exts, cache)
+	if err != nil || string(game.Data) != "ZELDA" {
+		t.Errorf("wrong archive member %q, %v", game.Data, err)
+	}
+	if _, err := os.Stat(cache.Dir); err == nil {
+		t.Errorf("the archive has been extracted for the in-memory core")
+	}
+	if _, err := OpenGame(archive, false, []string{"nes"}, cache); err == nil {
+		t.Errorf("expected no supported games error")
+	}
+
+	// fullpath cores
+	game, err = OpenGame(ArchivePath(archive, "disc/zelda.sfc"), true, exts, cache)
+	if err != nil {
+		t.Fatalf("couldn't extract the game, %v", err)
+	}
+	if data, err := ioutil.ReadFile(game.Path); err != nil || string(data) != "ZELDA" || game.Data != nil {
+		t.Errorf("wrong extracted game %v %q, %v", game.Path, data, err)
+	}
+	extracted, err := OpenGame(archive, true, exts, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(extracted.Path) != filepath.Dir(filepath.Dir(game.Path)) {
+		t.Errorf("the archive has been extracted twice %v %v", extracted.Path, game.Path)
+	}
+	if files, _ := ioutil.ReadDir(cache.Dir); len(files) != 1 {
+		t.Errorf("expected one extracted archive, got %v", len(files))
+	}
+
+	// the cores with the archive support
+	game, err = OpenGame(archive, true, []string{"zip"}, cache)
+	if err != nil || game.Path != archive {
+		t.Errorf("the archive should be loaded as is, %v, %v", game.Path, err)
+	}
+	game, err = OpenGame(archive, false, []string{"zip"}, cache)
+	if data, _ := ioutil.ReadFile(archive); err != nil || !bytes.Equal(game.Data, data) {
+		t.Errorf("the archive should be read as is, %v", err)
+	}
+}
+
+func TestRomCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cache := RomCache{Dir: filepath.Join(dir, "cache"), MaxSize: 250}
+	var paths []string
+	for i, name := range []string{"a.zip", "b.zip", "c.zip", "d.zip"} {
+		archive := filepath.Join(dir, name)
+		writeZip(t, archive, "game.nes", string(bytes.Repeat([]byte{byte('a' + i)}, 100)))
+		path, err := cache.Extract(archive, "game.nes")
+		if err != nil {
+			t.Fatalf("couldn't extract %v, %v", name, err)
+		}
+		paths = append(paths, path)
+		// the usage order
+		used := time.Now().Add(time.Duration(i-10) * time.Minute)
+		_ = os.Chtimes(filepath.Dir(path), used, used)
+		// b stays in use
+		if name != "b.zip" {
+			cache.Release(path)
+		}
+	}
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		if removed := i == 0 || i == 2; removed && err == nil {
+			t.Errorf("the least recently used archive %v is not removed", path)
+		} else if !removed && err != nil {
+			t.Errorf("the archive %v in use or recent is removed, %v", path, err)
+		}
+	}
+	cache.Release(paths[1])
+	cacheLock.Lock()
+	if hash := filepath.Base(filepath.Dir(paths[1])); cacheRefs[hash] != 0 {
+		t.Errorf("the released archive %v is in use %v", hash, cacheRefs[hash])
+	}
+	cacheLock.Unlock()
+
+	if _, err := cache.Extract(filepath.Join(dir, "a.zip"), "../../evil.nes"); err == nil {
+		t.Errorf("expected the illegal member path error")
+	}
+}
@@ -0,0 +1,140 @@
+package emulator
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Cheat is a cheat code of the game,
+// i.e. Game Genie, Pro Action Replay or raw memory patches (address:value).
+// Multiple codes of one cheat are joined with +.
+type Cheat struct {
+	Index   int
+	Code    string
+	Enabled bool
+	// Desc is an optional description of the cheat
+	Desc string
+}
+
+// maxCheatLength is the max length of cheat codes passed to the cores.
+const maxCheatLength = 1024
+
+// ValidateCheat checks that the cheat code looks like a cheat code,
+// the cores don't check the codes and may crash with garbage.
+func ValidateCheat(code string) error {
+	if code == "" {
+		return fmt.Errorf("empty cheat code")
+	}
+	if len(code) > maxCheatLength {
+		return fmt.Errorf("too long cheat code")
+	}
+	for _, part := range strings.Split(code, "+") {
+		if strings.TrimSpace(part) == "" {
+			return fmt.Errorf("malformed cheat code %q", code)
+		}
+		for _, c := range part {
+			switch {
+			case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			case c == ':', c == '-', c == '.', c == '?', c == ' ':
+			default:
+				return fmt.Errorf("malformed cheat code %q", code)
+			}
+		}
+	}
+	return nil
+}
+
+// GameHash returns the hash of the game file which keys the game cheat files.
+// The archive members are hashed by their content.
+func GameHash(path string) (string, error) {
+	h := sha1.New()
+	if archive, member := SplitArchivePath(path); member != "" {
+		data, err := ReadArchiveMember(archive, member)
+		if err != nil {
+			return "", err
+		}
+		_, _ = h.Write(data)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CheatFile returns the path of the cheat file of the game with the hash.
+func CheatFile(dir string, hash string) string { return filepath.Join(dir, hash+".cht") }
+
+// ReadCheats reads the cheats of the RetroArch cheat file (.cht):
+//
+//	cheats = 1
+//	cheat0_desc = "Infinite lives"
+//	cheat0_code = "SXIOPO"
+//	cheat0_enable = false
+//
+// The cheats with malformed codes are skipped.
+func ReadCheats(r io.Reader) ([]Cheat, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		equal := strings.Index(line, "=")
+		if equal < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:equal]), strings.TrimSpace(line[equal+1:])
+		values[key] = strings.Trim(value, `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(values["cheats"])
+	if err != nil {
+		return nil, fmt.Errorf("no number of cheats")
+	}
+	var cheats []Cheat
+	for i := 0; i < n; i++ {
+		prefix := "cheat" + strconv.Itoa(i) + "_"
+		cheat := Cheat{
+			Index:   i,
+			Code:    values[prefix+"code"],
+			Enabled: values[prefix+"enable"] == "true",
+			Desc:    values[prefix+"desc"],
+		}
+		if ValidateCheat(cheat.Code) != nil {
+			continue
+		}
+		cheats = append(cheats, cheat)
+	}
+	return cheats, nil
+}
+
+// LoadCheats reads the cheat file of the game from the directory,
+// no file means no cheats.
+func LoadCheats(dir string, hash string) ([]Cheat, error) {
+	f, err := os.Open(CheatFile(dir, hash))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return ReadCheats(f)
+}
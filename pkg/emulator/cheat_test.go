@@ -0,0 +1,81 @@
+package emulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateCheat(t *testing.T) {
+	for _, code := range []string{"SXIOPO", "DD62-3B1F", "7E0DBE05", "7E0DBE:05", "8009C6E4 03E7+8009C6E6 0000", "0xtest??"} {
+		if err := ValidateCheat(code); err != nil {
+			t.Errorf("valid code %q, %v", code, err)
+		}
+	}
+	for _, code := range []string{"", "+", "SXIOPO+", "SXIOPO\x00", "rm -rf /", "\n", strings.Repeat("A", 2000)} {
+		if err := ValidateCheat(code); err == nil {
+			t.Errorf("malformed code %q is valid", code)
+		}
+	}
+}
+
+func TestReadCheats(t *testing.T) {
+	file := `cheats = 4
+
+cheat0_desc = "Infinite lives"
+cheat0_code = "SXIOPO"
+cheat0_enable = false
+cheat1_desc = "Start on level 8"
+cheat1_code = "7E0DBE05+7E0DBF00"
+cheat1_enable = true
+cheat2_code = "bad;code"
+cheat3_code = "AAAA-BBBB"
+cheat3_enable = true
+`
+	cheats, err := ReadCheats(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("no cheats, %v", err)
+	}
+	want := []Cheat{
+		{Index: 0, Code: "SXIOPO", Desc: "Infinite lives"},
+		{Index: 1, Code: "7E0DBE05+7E0DBF00", Enabled: true, Desc: "Start on level 8"},
+		{Index: 3, Code: "AAAA-BBBB", Enabled: true},
+	}
+	if !reflect.DeepEqual(cheats, want) {
+		t.Errorf("wrong cheats\n got: %+v\nwant: %+v", cheats, want)
+	}
+
+	if _, err := ReadCheats(strings.NewReader("cheat0_code = SXIOPO")); err == nil {
+		t.Errorf("expected an error without the number of cheats")
+	}
+}
+
+func TestLoadCheats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cheats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	rom := filepath.Join(dir, "game.nes")
+	if err := ioutil.WriteFile(rom, []byte("NES\x1a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := GameHash(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cheats, err := LoadCheats(dir, hash); err != nil || cheats != nil {
+		t.Errorf("expected no cheats without a file, got %v, %v", cheats, err)
+	}
+	if err := ioutil.WriteFile(CheatFile(dir, hash), []byte("cheats = 1\ncheat0_code = SXIOPO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cheats, err := LoadCheats(dir, hash)
+	if err != nil || len(cheats) != 1 || cheats[0].Code != "SXIOPO" {
+		t.Errorf("wrong cheats %v, %v", cheats, err)
+	}
+}
@@ -0,0 +1,56 @@
+package emulator
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Device is a controller device type declared by the core for a port,
+// i.e. a joypad, a multitap, a mouse or a lightgun.
+type Device struct {
+	// ID is the libretro device type (RETRO_DEVICE_*) or its subclass
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+}
+
+// Port is a controller port of the core with the devices it supports.
+type Port struct {
+	// Device is the ID of the device plugged into the port
+	Device  uint32   `json:"device"`
+	Devices []Device `json:"devices"`
+}
+
+// Find returns the device of the port by its name (case-insensitive) or its ID.
+func (p Port) Find(name string) (Device, bool) {
+	id, err := strconv.ParseUint(strings.TrimSpace(name), 10, 32)
+	for _, d := range p.Devices {
+		if (err == nil && uint64(d.ID) == id) || strings.EqualFold(d.Name, strings.TrimSpace(name)) {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// Supports tells if the device can be plugged into the port.
+func (p Port) Supports(id uint32) bool {
+	for _, d := range p.Devices {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// The motors of the rumble (force feedback) of the controllers.
+const (
+	RumbleStrong = "strong"
+	RumbleWeak   = "weak"
+)
+
+// Rumble is the strength of the rumble motor (effect) of the controller port
+// set by the game, 0 -- off, 0xffff -- max.
+type Rumble struct {
+	Port     int    `json:"port"`
+	Effect   string `json:"effect"`
+	Strength uint16 `json:"strength"`
+}
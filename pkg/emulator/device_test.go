@@ -0,0 +1,27 @@
+package emulator
+
+import "testing"
+
+func TestPortFind(t *testing.T) {
+	port := Port{Device: 1, Devices: []Device{{ID: 1, Name: "SNES Joypad"}, {ID: 258, Name: "SNES Mouse"}}}
+	tests := []struct {
+		name string
+		id   uint32
+		ok   bool
+	}{
+		{name: "SNES Mouse", id: 258, ok: true},
+		{name: " snes mouse", id: 258, ok: true},
+		{name: "1", id: 1, ok: true},
+		{name: "Multitap"},
+		{name: "3"},
+	}
+	for _, test := range tests {
+		d, ok := port.Find(test.name)
+		if ok != test.ok || d.ID != test.id {
+			t.Errorf("wrong device %v (%v) of %q, expected %v (%v)", d.ID, ok, test.name, test.id, test.ok)
+		}
+	}
+	if !port.Supports(258) || port.Supports(2) {
+		t.Errorf("wrong supported devices of %v", port)
+	}
+}
@@ -1,34 +1,106 @@
 package emulator
 
-import "github.com/giongto35/cloud-game/v2/pkg/emulator/image"
+import (
+	"errors"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/image"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+)
 
 // CloudEmulator is the interface of cloud emulator.
 type CloudEmulator interface {
-	// LoadMeta returns meta data of emulator. Refer below
-	LoadMeta(path string) Metadata
+	// LoadMeta loads the core and the game and returns meta data of emulator. Refer below
+	// The emulator which failed to load shouldn't be started, only closed.
+	LoadMeta(path string) (Metadata, error)
 	// Start is called after LoadGame
 	Start()
 	// SetViewport sets viewport size
 	SetViewport(width int, height int)
+	// SetCrop sets the part of the game frames scaled into the viewport,
+	// the zero crop is the whole frames
+	SetCrop(crop viewport.Crop)
 	// SaveGame save game state
 	SaveGame() error
 	// LoadGame load game state
 	LoadGame() error
+	// SaveGameSlot saves game state into the slot, slot 0 is the main save
+	SaveGameSlot(slot int) error
+	// LoadGameSlot loads game state from the slot
+	LoadGameSlot(slot int) error
+	// Snapshot returns the save state and the save RAM (if any) of the running game
+	// taken between its frames, nothing is written on the disk
+	Snapshot() (state []byte, sram []byte, err error)
+	// Restore loads the save state and the save RAM (if any) into the running game
+	// between its frames and writes them as the main save
+	Restore(state []byte, sram []byte) error
 	// GetHashPath returns the path emulator will save state to
 	GetHashPath() string
+	// GetSlotPath returns the path emulator will save state of the slot to
+	GetSlotPath(slot int) string
+	// GetSRAMPath returns the path emulator will save the game save RAM (battery save) to
+	GetSRAMPath() string
+	// GetSlots returns the list of slots with saved states
+	GetSlots() []int
+	// Rewind restores game state the number of frames back
+	Rewind(frames int) error
+	// Pause stops running of the game, the states can be saved while paused
+	Pause()
+	// Resume continues running of the paused game
+	Resume()
+	// SetSpeedMultiplier changes the speed of the game (fast-forward),
+	// the video and audio stay at the normal rate
+	SetSpeedMultiplier(multiplier float64)
 	// Close will be called when the game is done
 	Close()
 
+	// ToggleMultitap plugs in or out the multitap of the second port,
+	// SetPortDevice should be used instead
 	ToggleMultitap() error
+	// SetPortDevice plugs the device of the core into the controller port (from 0)
+	SetPortDevice(port int, device uint32) error
+	// GetPorts returns the controller ports of the core with their devices
+	GetPorts() []Port
+	// Rumble returns the changes of the rumble of the controller ports set by the game
+	Rumble() <-chan Rumble
+	// SetCoreOption changes the core option (variable) at runtime
+	SetCoreOption(key, value string) error
+	// ApplyCheats replaces the cheats of the game
+	ApplyCheats(cheats []Cheat) error
+	// SwapDisc changes the disc of the multi-disc game
+	SwapDisc(index int) error
+	// WatchMemory sets the function called after each frame of the game
+	// with the system RAM of the core (valid only during the call), nil -- no calls
+	WatchMemory(fn func(mem []byte))
+	// OnFrame sets the function called after each frame of the game
+	// with the number of the frame, nil -- no calls
+	OnFrame(fn func(frame uint64))
+	// RunTime returns the total time the core has spent on the frames of the game
+	RunTime() time.Duration
 }
 
+var (
+	// ErrNoCore is the load error of the missing or broken emulator cores.
+	ErrNoCore = errors.New("no emulator core")
+	// ErrBadGame is the load error of the missing games or
+	// the games the core can't load.
+	ErrBadGame = errors.New("bad game file")
+	// ErrNoBios is the load error of the cores without their BIOS files.
+	ErrNoBios = errors.New("no BIOS")
+)
+
 type Metadata struct {
 	// the full path to some emulator lib
 	LibPath string
 	// the full path to the emulator config
 	ConfigPath string
+	// the core options (variables) overriding the config ones
+	CoreOptions map[string]string
+	// the audio encoder settings of the game overriding the worker ones
+	Audio encoder.Audio
 
-	AudioSampleRate int
+	AudioSampleRate float64
 	Fps             float64
 	BaseWidth       int
 	BaseHeight      int
@@ -38,4 +110,27 @@ type Metadata struct {
 	UsesLibCo       bool
 	AutoGlContext   bool
 	HasMultitap     bool
+	// Devices are the names (or IDs) of the devices
+	// plugged into the controller ports (from 0) after the game load
+	Devices map[int]string
+	// Region is the forced region of the game (RegionPAL, RegionNTSC)
+	// before the game load and the region reported by the core after it
+	Region string
+	// RegionOption is the core option of the forced region
+	RegionOption string
+}
+
+// The regions of the games, they go with the frame rates
+// of their TV systems.
+const (
+	RegionNTSC = "ntsc"
+	RegionPAL  = "pal"
+)
+
+// Geometry is the resolution of the frames of the game,
+// some cores change it while running (i.e. 224p/239p of SNES).
+type Geometry struct {
+	BaseWidth  int
+	BaseHeight int
+	Ratio      float64
 }
@@ -0,0 +1,354 @@
+// Package emulatortest provides the fake emulators of the rooms,
+// so the rooms are tested without the libretro cores.
+package emulatortest
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	config "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+)
+
+// DefaultMeta is the metadata of the fake games without their own.
+var DefaultMeta = emulator.Metadata{
+	AudioSampleRate: 48000,
+	Fps:             60,
+	BaseWidth:       256,
+	BaseHeight:      240,
+	Ratio:           4.0 / 3,
+}
+
+// Factory makes the fake emulators with the script,
+// its Init is the drop-in replacement of nanoarch.Init.
+type Factory struct {
+	// Meta is the metadata of the games, the zero one -- DefaultMeta,
+	// the frames and audio go at the rate of its Fps
+	Meta emulator.Metadata
+	// LoadErr is the error of the game loads
+	LoadErr error
+
+	mu        sync.Mutex
+	emulators []*Emulator
+}
+
+// Init makes a new fake emulator of the room.
+func (f *Factory) Init(roomID string, _ bool, inputChannel <-chan nanoarch.InputEvent, store nanoarch.Storage,
+	_ config.LibretroCoreConfig) (emulator.CloudEmulator, <-chan nanoarch.GameFrame, <-chan nanoarch.GameAudio) {
+	meta := f.Meta
+	if meta.Fps == 0 {
+		meta = DefaultMeta
+	}
+	e := &Emulator{
+		meta:    meta,
+		loadErr: f.LoadErr,
+		store:   store,
+		input:   inputChannel,
+		video:   make(chan nanoarch.GameFrame, 1),
+		audio:   make(chan nanoarch.GameAudio, 1),
+		done:    make(chan struct{}),
+		ended:   make(chan struct{}),
+		speed:   1,
+	}
+	f.mu.Lock()
+	f.emulators = append(f.emulators, e)
+	f.mu.Unlock()
+	return e, e.video, e.audio
+}
+
+// Emulators returns the emulators made by the factory.
+func (f *Factory) Emulators() []*Emulator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Emulator(nil), f.emulators...)
+}
+
+// Last returns the last emulator made by the factory, nil -- none.
+func (f *Factory) Last() *Emulator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.emulators) == 0 {
+		return nil
+	}
+	return f.emulators[len(f.emulators)-1]
+}
+
+// Emulator is the fake emulator emitting the synthetic frames
+// and audio until it is closed, it records the calls of the room.
+type Emulator struct {
+	meta    emulator.Metadata
+	loadErr error
+	store   nanoarch.Storage
+	input   <-chan nanoarch.InputEvent
+	video   chan nanoarch.GameFrame
+	audio   chan nanoarch.GameAudio
+
+	mu       sync.Mutex
+	calls    []string
+	inputs   []nanoarch.InputEvent
+	frames   uint64
+	vw, vh   int
+	crop     viewport.Crop
+	paused   bool
+	speed    float64
+	onFrame  func(frame uint64)
+	runTime  time.Duration
+	closed   bool
+	done     chan struct{}
+	ended    chan struct{}
+	doneOnce sync.Once
+}
+
+// record keeps the call of the room.
+func (e *Emulator) record(format string, args ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, fmt.Sprintf(format, args...))
+}
+
+// Calls returns the recorded calls of the room, i.e. "SaveGameSlot 0", "SetViewport 256x240".
+func (e *Emulator) Calls() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.calls...)
+}
+
+// Inputs returns the input events the emulator has got.
+func (e *Emulator) Inputs() []nanoarch.InputEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]nanoarch.InputEvent(nil), e.inputs...)
+}
+
+// Frames returns the number of the emitted frames.
+func (e *Emulator) Frames() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.frames
+}
+
+// Viewport returns the viewport set by the room.
+func (e *Emulator) Viewport() (int, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.vw, e.vh
+}
+
+// IsClosed tells if the emulator has been closed.
+func (e *Emulator) IsClosed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed
+}
+
+// Ended returns a channel which is closed when Start has returned.
+func (e *Emulator) Ended() <-chan struct{} { return e.ended }
+
+func (e *Emulator) LoadMeta(path string) (emulator.Metadata, error) {
+	e.record("LoadMeta %v", filepath.Base(path))
+	if e.loadErr != nil {
+		return emulator.Metadata{}, e.loadErr
+	}
+	return e.meta, nil
+}
+
+// Start emits the frames and audio at the rate of the game until the emulator is closed.
+func (e *Emulator) Start() {
+	defer close(e.ended)
+	defer close(e.video)
+	defer close(e.audio)
+
+	frameTime := time.Duration(float64(time.Second) / e.meta.Fps)
+	samples := int(e.meta.AudioSampleRate/e.meta.Fps) * 2
+	ticker := time.NewTicker(frameTime)
+	defer ticker.Stop()
+	input := e.input
+	for {
+		select {
+		case <-e.done:
+			return
+		case event, ok := <-input:
+			if !ok {
+				input = nil
+				continue
+			}
+			e.mu.Lock()
+			e.inputs = append(e.inputs, event)
+			e.mu.Unlock()
+		case <-ticker.C:
+			e.mu.Lock()
+			if e.paused {
+				e.mu.Unlock()
+				continue
+			}
+			e.frames++
+			n, w, h, hook := e.frames, e.vw, e.vh, e.onFrame
+			e.runTime += frameTime
+			e.mu.Unlock()
+			if w == 0 || h == 0 {
+				w, h = e.meta.BaseWidth, e.meta.BaseHeight
+			}
+			ts := time.Duration(n-1) * frameTime
+			if !e.send(nanoarch.GameFrame{Data: frame(w, h, n), Duration: frameTime, Timestamp: ts}) ||
+				!e.sendAudio(nanoarch.GameAudio{Samples: make([]int16, samples), Timestamp: ts}) {
+				return
+			}
+			if hook != nil {
+				hook(n)
+			}
+		}
+	}
+}
+
+func (e *Emulator) send(frame nanoarch.GameFrame) bool {
+	select {
+	case e.video <- frame:
+		return true
+	case <-e.done:
+		return false
+	}
+}
+
+func (e *Emulator) sendAudio(audio nanoarch.GameAudio) bool {
+	select {
+	case e.audio <- audio:
+		return true
+	case <-e.done:
+		return false
+	}
+}
+
+// frame returns the synthetic frame of the number.
+func frame(w, h int, n uint64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	c := color.RGBA{R: uint8(n), G: uint8(n >> 8), B: 0x80, A: 0xff}
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func (e *Emulator) SetViewport(width int, height int) {
+	e.record("SetViewport %vx%v", width, height)
+	e.mu.Lock()
+	e.vw, e.vh = width, height
+	e.mu.Unlock()
+}
+
+func (e *Emulator) SetCrop(crop viewport.Crop) {
+	e.mu.Lock()
+	e.crop = crop
+	e.mu.Unlock()
+}
+
+func (e *Emulator) SaveGame() error { return e.SaveGameSlot(0) }
+
+func (e *Emulator) LoadGame() error { return e.LoadGameSlot(0) }
+
+// SaveGameSlot writes the number of the frames into the file of the slot.
+func (e *Emulator) SaveGameSlot(slot int) error {
+	e.record("SaveGameSlot %v", slot)
+	path := e.GetSlotPath(slot)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(fmt.Sprintf("%v", e.Frames())), 0644)
+}
+
+// Snapshot returns the number of the frames as the state, the games have no save RAM.
+func (e *Emulator) Snapshot() ([]byte, []byte, error) {
+	e.record("Snapshot")
+	return []byte(fmt.Sprintf("%v", e.Frames())), nil, nil
+}
+
+// Restore writes the state and the save RAM into the files of the main save.
+func (e *Emulator) Restore(state []byte, sram []byte) error {
+	e.record("Restore")
+	if err := os.MkdirAll(e.store.Dir(), 0755); err != nil {
+		return err
+	}
+	if len(sram) > 0 {
+		if err := ioutil.WriteFile(e.GetSRAMPath(), sram, 0644); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(e.GetSlotPath(0), state, 0644)
+}
+
+func (e *Emulator) LoadGameSlot(slot int) error {
+	e.record("LoadGameSlot %v", slot)
+	_, err := os.Stat(e.GetSlotPath(slot))
+	return err
+}
+
+func (e *Emulator) GetHashPath() string            { return e.store.GetSavePath() }
+func (e *Emulator) GetSlotPath(slot int) string    { return e.store.GetSlotPath(slot) }
+func (e *Emulator) GetSRAMPath() string            { return e.store.GetSRAMPath() }
+func (e *Emulator) GetSlots() []int                { return e.store.GetSlots() }
+func (e *Emulator) Rewind(frames int) error        { e.record("Rewind %v", frames); return nil }
+func (e *Emulator) ToggleMultitap() error          { return nil }
+func (e *Emulator) GetPorts() []emulator.Port      { return nil }
+func (e *Emulator) Rumble() <-chan emulator.Rumble { return nil }
+func (e *Emulator) SwapDisc(index int) error       { e.record("SwapDisc %v", index); return nil }
+func (e *Emulator) WatchMemory(func(mem []byte))   {}
+
+func (e *Emulator) SetPortDevice(port int, device uint32) error {
+	return fmt.Errorf("no port %v", port)
+}
+
+func (e *Emulator) SetCoreOption(key, value string) error {
+	e.record("SetCoreOption %v=%v", key, value)
+	return nil
+}
+
+func (e *Emulator) ApplyCheats(cheats []emulator.Cheat) error {
+	e.record("ApplyCheats %v", len(cheats))
+	return nil
+}
+
+func (e *Emulator) Pause() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.paused = true
+}
+
+func (e *Emulator) Resume() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.paused = false
+}
+
+func (e *Emulator) SetSpeedMultiplier(multiplier float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.speed = multiplier
+}
+
+func (e *Emulator) OnFrame(fn func(frame uint64)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onFrame = fn
+}
+
+func (e *Emulator) RunTime() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.runTime
+}
+
+// Close stops the emulator, it may be called before Start.
+func (e *Emulator) Close() {
+	e.record("Close")
+	e.mu.Lock()
+	e.closed = true
+	e.mu.Unlock()
+	e.doneOnce.Do(func() { close(e.done) })
+}
@@ -0,0 +1,101 @@
+// Package frame implements the wire format of video frames
+// streamed from an out-of-process emulator to a worker.
+//
+// Each frame is a 4-byte big-endian length header followed by the payload:
+//
+//	| duration, ns (int64) | width (uint32) | height (uint32) | stride (uint32) | pixels (RGBA) |
+//
+// All the numbers are big-endian.
+package frame
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"time"
+)
+
+const (
+	headerSize = 4
+	metaSize   = 8 + 4 + 4 + 4
+	// MaxSize is the max allowed payload size of a frame (8K RGBA).
+	MaxSize = metaSize + 7680*4320*4
+)
+
+var (
+	// ErrBadFrame is returned when a frame payload is malformed,
+	// such frames are skipped and the next read starts from the next header.
+	ErrBadFrame = errors.New("bad frame")
+	// ErrTooLarge is returned when a frame header declares a too big payload,
+	// after that the stream can't be read anymore.
+	ErrTooLarge = errors.New("frame is too large")
+)
+
+// Write writes the image into the writer in the wire format.
+func Write(w io.Writer, img *image.RGBA, duration time.Duration) error {
+	size := img.Bounds().Size()
+	buf := make([]byte, headerSize+metaSize, headerSize+metaSize+len(img.Pix))
+	binary.BigEndian.PutUint32(buf[0:], uint32(metaSize+len(img.Pix)))
+	binary.BigEndian.PutUint64(buf[4:], uint64(duration))
+	binary.BigEndian.PutUint32(buf[12:], uint32(size.X))
+	binary.BigEndian.PutUint32(buf[16:], uint32(size.Y))
+	binary.BigEndian.PutUint32(buf[20:], uint32(img.Stride))
+	_, err := w.Write(append(buf, img.Pix...))
+	return err
+}
+
+// Reader reads frames from a stream in the wire format.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func NewReader(r io.Reader) *Reader { return &Reader{r: bufio.NewReader(r)} }
+
+// Read reads the next frame from the stream.
+// A malformed frame is dropped with ErrBadFrame and
+// the reader still can be used for the next frames.
+// Other errors are the errors of the underlying reader or ErrTooLarge.
+func (r *Reader) Read() (*image.RGBA, time.Duration, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxSize {
+		return nil, 0, ErrTooLarge
+	}
+
+	if cap(r.buf) < int(size) {
+		r.buf = make([]byte, size)
+	}
+	payload := r.buf[:size]
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	if size < metaSize {
+		return nil, 0, ErrBadFrame
+	}
+
+	duration := time.Duration(binary.BigEndian.Uint64(payload[0:]))
+	w := int(binary.BigEndian.Uint32(payload[8:]))
+	h := int(binary.BigEndian.Uint32(payload[12:]))
+	stride := int(binary.BigEndian.Uint32(payload[16:]))
+	pix := payload[metaSize:]
+	if stride < w*4 || len(pix) != stride*h {
+		return nil, 0, ErrBadFrame
+	}
+
+	img := &image.RGBA{
+		Pix:    make([]byte, len(pix)),
+		Stride: stride,
+		Rect:   image.Rect(0, 0, w, h),
+	}
+	copy(img.Pix, pix)
+	return img, duration, nil
+}
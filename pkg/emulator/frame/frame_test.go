@@ -0,0 +1,93 @@
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func newImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rand.Read(img.Pix)
+	return img
+}
+
+func TestReadWrite(t *testing.T) {
+	images := []*image.RGBA{
+		newImage(256, 240),
+		newImage(320, 240),
+		newImage(1, 1),
+		newImage(640, 480),
+		newImage(0, 0),
+		newImage(160, 144),
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i, img := range images {
+			if err := Write(pw, img, time.Duration(i)*time.Millisecond); err != nil {
+				t.Errorf("write error: %v", err)
+			}
+		}
+		_ = pw.Close()
+	}()
+
+	r := NewReader(pr)
+	for i, want := range images {
+		img, d, err := r.Read()
+		if err != nil {
+			t.Fatalf("frame %v read error: %v", i, err)
+		}
+		if d != time.Duration(i)*time.Millisecond {
+			t.Errorf("frame %v duration %v != %v", i, d, time.Duration(i)*time.Millisecond)
+		}
+		if img.Rect != want.Rect || img.Stride != want.Stride || !bytes.Equal(img.Pix, want.Pix) {
+			t.Errorf("frame %v is corrupted", i)
+		}
+	}
+	if _, _, err := r.Read(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReadBadFrame(t *testing.T) {
+	var buf bytes.Buffer
+	_ = Write(&buf, newImage(10, 10), 0)
+	// a frame with a wrong stride
+	bad := newImage(10, 10)
+	bad.Stride = 11
+	_ = Write(&buf, bad, 0)
+	// a too short frame
+	_, _ = buf.Write([]byte{0, 0, 0, 2, 0xFF, 0xFF})
+	good := newImage(20, 5)
+	_ = Write(&buf, good, 0)
+
+	r := NewReader(&buf)
+	if _, _, err := r.Read(); err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.Read(); err != ErrBadFrame {
+			t.Fatalf("expected a bad frame, got %v", err)
+		}
+	}
+	img, _, err := r.Read()
+	if err != nil {
+		t.Fatalf("couldn't read the frame after the bad ones: %v", err)
+	}
+	if !bytes.Equal(img.Pix, good.Pix) {
+		t.Errorf("frame is corrupted")
+	}
+}
+
+func TestReadTooLarge(t *testing.T) {
+	var header [headerSize]byte
+	binary.BigEndian.PutUint32(header[:], MaxSize+1)
+	if _, _, err := NewReader(bytes.NewReader(header[:])).Read(); err != ErrTooLarge {
+		t.Errorf("expected too large error, got %v", err)
+	}
+}
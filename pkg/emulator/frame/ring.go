@@ -0,0 +1,305 @@
+package frame
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// The ring buffer of video frames in the shared memory
+// of an out-of-process emulator and a worker.
+// The emulator writes the frames into the fixed slots of the ring
+// and sends only the slot numbers (uint32, big-endian) over the socket,
+// the worker takes the frames from the slots without the copies
+// and frees the slots after the use.
+//
+// The memory starts with the ring header:
+//
+//	| magic "CGFR" | version (uint32) | slots (uint32) | slot size (uint32) | reserved |
+//
+// then the slots follow, each one is the slot header and the pixels:
+//
+//	| state (uint32) | format (uint32) | sequence (uint64) | width (uint32) | height (uint32) |
+//	| stride (uint32) | reserved | timestamp, ns (int64) | duration, ns (int64) | reserved |
+//
+// The numbers are in the native (little-endian) byte order as the memory is shared
+// on the same machine, the slot states are changed atomically.
+const (
+	ringMagic      = "CGFR"
+	ringVersion    = 1
+	ringHeaderSize = 64
+	slotHeaderSize = 64
+	// SignalSize is the size of the slot number of a frame on the socket.
+	SignalSize = 4
+)
+
+// FormatRGBA is the only pixel format of the frames for now.
+const FormatRGBA = 1
+
+// the states of the slots, the writer takes the free or ready (not taken yet) slots,
+// the reader takes the ready ones
+const (
+	slotFree uint32 = iota
+	slotWriting
+	slotReady
+	slotReading
+)
+
+var (
+	// ErrRingFull is returned when all the slots are held by the reader,
+	// the frame is dropped.
+	ErrRingFull = errors.New("no free frame slots")
+	// ErrStale is returned for the slots without new frames
+	// (i.e. the writer has put a newer frame there already), they are skipped.
+	ErrStale = errors.New("stale frame slot")
+	// ErrBadRing is returned for the memory without a valid ring.
+	ErrBadRing = errors.New("bad frame ring")
+)
+
+// Ring is the ring buffer of video frames in some (shared) memory.
+// One writer and one reader may use the same memory.
+type Ring struct {
+	mem   []byte
+	slots int
+	size  int
+
+	// the writer side: the next slot and the sequence of the last frame
+	next int
+	seq  uint64
+	// the reader side: the sequence of the last taken frame and
+	// the number of the frames in use, guarded by mu
+	last   uint64
+	mu     sync.Mutex
+	held   int
+	closed bool
+
+	// remove and unmap free the memory of the ring (may be nil)
+	remove func()
+	unmap  func() error
+}
+
+// Slot is the frame taken from the slot of the ring.
+// Its image is a view of the shared memory,
+// it should not be used after the Release call.
+type Slot struct {
+	Image    *image.RGBA
+	Sequence uint64
+	Time     time.Time
+	Duration time.Duration
+	// Release frees the slot for the next frames
+	Release func()
+}
+
+// RingSize returns the memory size of the ring of the slots of size bytes.
+func RingSize(slots int, size int) int {
+	return ringHeaderSize + slots*(slotHeaderSize+alignSize(size))
+}
+
+// alignSize aligns the slots for the atomic access to their states.
+func alignSize(size int) int { return (size + 7) &^ 7 }
+
+// NewRing creates the ring of the slots of size bytes in the memory.
+func NewRing(mem []byte, slots int, size int) (*Ring, error) {
+	size = alignSize(size)
+	if slots <= 0 || size <= 0 || len(mem) < RingSize(slots, size) {
+		return nil, fmt.Errorf("%w, %v bytes for %v slots of %v bytes", ErrBadRing, len(mem), slots, size)
+	}
+	copy(mem, ringMagic)
+	binary.LittleEndian.PutUint32(mem[4:], ringVersion)
+	binary.LittleEndian.PutUint32(mem[8:], uint32(slots))
+	binary.LittleEndian.PutUint32(mem[12:], uint32(size))
+	r := &Ring{mem: mem, slots: slots, size: size}
+	for i := 0; i < slots; i++ {
+		atomic.StoreUint32(r.state(i), slotFree)
+	}
+	return r, nil
+}
+
+// OpenRing opens the ring of the memory (i.e. on the writer side).
+// The frames go on after the last ones of the ring,
+// the slots left by the previous writer while it was writing are freed.
+func OpenRing(mem []byte) (*Ring, error) {
+	if len(mem) < ringHeaderSize || string(mem[:4]) != ringMagic {
+		return nil, ErrBadRing
+	}
+	if v := binary.LittleEndian.Uint32(mem[4:]); v != ringVersion {
+		return nil, fmt.Errorf("%w, version %v", ErrBadRing, v)
+	}
+	slots := int(binary.LittleEndian.Uint32(mem[8:]))
+	size := int(binary.LittleEndian.Uint32(mem[12:]))
+	if slots <= 0 || size <= 0 || size != alignSize(size) || len(mem) < RingSize(slots, size) {
+		return nil, ErrBadRing
+	}
+	r := &Ring{mem: mem, slots: slots, size: size}
+	for i := 0; i < slots; i++ {
+		atomic.CompareAndSwapUint32(r.state(i), slotWriting, slotFree)
+		h := r.header(i)
+		if seq := binary.LittleEndian.Uint64(h[8:]); seq > r.seq {
+			r.seq, r.next = seq, (i+1)%slots
+		}
+	}
+	return r, nil
+}
+
+// Slots returns the number of the slots of the ring.
+func (r *Ring) Slots() int { return r.slots }
+
+// SlotSize returns the max size of the frames of the ring.
+func (r *Ring) SlotSize() int { return r.size }
+
+// Write puts the frame into the next free slot of the ring and
+// returns the number of the slot for the reader.
+// When the reader is slower, the oldest frames not taken yet are overwritten,
+// ErrRingFull is returned if all the slots are in use.
+func (r *Ring) Write(img *image.RGBA, duration time.Duration) (int, error) {
+	size := img.Bounds().Size()
+	n := img.Stride * size.Y
+	if n > r.size {
+		return 0, fmt.Errorf("the frame %vx%v is larger than the slots (%v bytes)", size.X, size.Y, r.size)
+	}
+	if img.Stride < size.X*4 || len(img.Pix) < n {
+		return 0, ErrBadFrame
+	}
+	for k := 0; k < r.slots; k++ {
+		i := (r.next + k) % r.slots
+		state := r.state(i)
+		if !atomic.CompareAndSwapUint32(state, slotFree, slotWriting) &&
+			!atomic.CompareAndSwapUint32(state, slotReady, slotWriting) {
+			continue
+		}
+		r.seq++
+		h := r.header(i)
+		binary.LittleEndian.PutUint32(h[4:], FormatRGBA)
+		binary.LittleEndian.PutUint64(h[8:], r.seq)
+		binary.LittleEndian.PutUint32(h[16:], uint32(size.X))
+		binary.LittleEndian.PutUint32(h[20:], uint32(size.Y))
+		binary.LittleEndian.PutUint32(h[24:], uint32(img.Stride))
+		binary.LittleEndian.PutUint64(h[32:], uint64(time.Now().UnixNano()))
+		binary.LittleEndian.PutUint64(h[40:], uint64(duration))
+		copy(r.pixels(i), img.Pix[:n])
+		atomic.StoreUint32(state, slotReady)
+		r.next = (i + 1) % r.slots
+		return i, nil
+	}
+	return 0, ErrRingFull
+}
+
+// Take takes the frame of the slot, the slot is held until the release of the frame.
+// The older frames than the last taken one are dropped with ErrStale,
+// so the frames go in order even if the writer has overwritten some of them.
+func (r *Ring) Take(slot int) (Slot, error) {
+	if slot < 0 || slot >= r.slots {
+		return Slot{}, ErrBadFrame
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return Slot{}, ErrBadRing
+	}
+	state := r.state(slot)
+	if !atomic.CompareAndSwapUint32(state, slotReady, slotReading) {
+		return Slot{}, ErrStale
+	}
+	freeSlot := func() { atomic.StoreUint32(state, slotFree) }
+	h := r.header(slot)
+	seq := binary.LittleEndian.Uint64(h[8:])
+	if seq <= r.last {
+		freeSlot()
+		return Slot{}, ErrStale
+	}
+	r.last = seq
+	format := binary.LittleEndian.Uint32(h[4:])
+	width := int(binary.LittleEndian.Uint32(h[16:]))
+	height := int(binary.LittleEndian.Uint32(h[20:]))
+	stride := int(binary.LittleEndian.Uint32(h[24:]))
+	if format != FormatRGBA || stride < width*4 || stride*height > r.size {
+		freeSlot()
+		return Slot{}, ErrBadFrame
+	}
+	n := stride * height
+	pix := r.pixels(slot)[:n:n]
+	r.held++
+	var once sync.Once
+	return Slot{
+		Image:    &image.RGBA{Pix: pix, Stride: stride, Rect: image.Rect(0, 0, width, height)},
+		Sequence: seq,
+		Time:     time.Unix(0, int64(binary.LittleEndian.Uint64(h[32:]))),
+		Duration: time.Duration(binary.LittleEndian.Uint64(h[40:])),
+		Release:  func() { once.Do(func() { freeSlot(); r.release() }) },
+	}, nil
+}
+
+func (r *Ring) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.held--
+	if r.closed && r.held == 0 {
+		r.free()
+	}
+}
+
+// Close closes the ring, its memory is unmapped
+// once all the taken frames are released.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.remove != nil {
+		r.remove()
+	}
+	if r.held > 0 {
+		return nil
+	}
+	return r.free()
+}
+
+func (r *Ring) free() error {
+	if r.unmap == nil {
+		return nil
+	}
+	err := r.unmap()
+	r.unmap = nil
+	return err
+}
+
+func (r *Ring) offset(slot int) int { return ringHeaderSize + slot*(slotHeaderSize+r.size) }
+
+func (r *Ring) header(slot int) []byte {
+	off := r.offset(slot)
+	return r.mem[off : off+slotHeaderSize]
+}
+
+func (r *Ring) state(slot int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&r.mem[r.offset(slot)]))
+}
+
+func (r *Ring) pixels(slot int) []byte {
+	off := r.offset(slot) + slotHeaderSize
+	return r.mem[off : off+r.size]
+}
+
+// WriteSignal sends the slot number of the new frame.
+func WriteSignal(w io.Writer, slot int) error {
+	var buf [SignalSize]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(slot))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// ReadSignal reads the slot number of the next frame.
+func ReadSignal(r io.Reader) (int, error) {
+	var buf [SignalSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint32(buf[:])), nil
+}
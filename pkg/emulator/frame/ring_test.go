@@ -0,0 +1,258 @@
+package frame
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func newRing(t testing.TB, slots int, size int) *Ring {
+	r, err := NewRing(make([]byte, RingSize(slots, size)), slots, size)
+	if err != nil {
+		t.Fatalf("couldn't create the ring, %v", err)
+	}
+	return r
+}
+
+func TestRingWraparound(t *testing.T) {
+	r := newRing(t, 3, 8*8*4)
+	for i := 0; i < 10; i++ {
+		img := newImage(8, 8)
+		slot, err := r.Write(img, time.Duration(i))
+		if err != nil {
+			t.Fatalf("frame %v write error: %v", i, err)
+		}
+		if slot != i%3 {
+			t.Errorf("frame %v is in the slot %v, expected %v", i, slot, i%3)
+		}
+		f, err := r.Take(slot)
+		if err != nil {
+			t.Fatalf("frame %v take error: %v", i, err)
+		}
+		if f.Sequence != uint64(i+1) || f.Duration != time.Duration(i) {
+			t.Errorf("frame %v has the sequence %v and duration %v", i, f.Sequence, f.Duration)
+		}
+		if f.Image.Rect != img.Rect || !bytes.Equal(f.Image.Pix, img.Pix) {
+			t.Errorf("frame %v is corrupted", i)
+		}
+		f.Release()
+		// the second release does nothing
+		f.Release()
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("close error: %v", err)
+	}
+}
+
+func TestRingWriterFaster(t *testing.T) {
+	r := newRing(t, 3, 4*4*4)
+	var frames []*image.RGBA
+	var slots []int
+	for i := 0; i < 5; i++ {
+		img := newImage(4, 4)
+		slot, err := r.Write(img, 0)
+		if err != nil {
+			t.Fatalf("frame %v write error: %v", i, err)
+		}
+		frames, slots = append(frames, img), append(slots, slot)
+	}
+	// the frames 0 and 1 are overwritten with 3 and 4,
+	// the newest frames go first and the older ones are dropped
+	var taken []Slot
+	for _, slot := range slots {
+		f, err := r.Take(slot)
+		if err == ErrStale {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("take error: %v", err)
+		}
+		taken = append(taken, f)
+	}
+	if len(taken) != 2 {
+		t.Fatalf("taken %v frames, expected 2", len(taken))
+	}
+	for i, f := range taken {
+		if want := frames[3+i]; f.Sequence != uint64(4+i) || !bytes.Equal(f.Image.Pix, want.Pix) {
+			t.Errorf("got the frame %v, expected %v", f.Sequence, 4+i)
+		}
+	}
+
+	// the taken slots are not overwritten, the writer drops the frames then
+	if _, err := r.Write(newImage(4, 4), 0); err != nil {
+		t.Fatalf("couldn't write into the free slot, %v", err)
+	}
+	held, err := r.Take(2)
+	if err != nil {
+		t.Fatalf("take error: %v", err)
+	}
+	if _, err := r.Write(newImage(4, 4), 0); err != ErrRingFull {
+		t.Errorf("expected the full ring, got %v", err)
+	}
+	if !bytes.Equal(taken[0].Image.Pix, frames[3].Pix) {
+		t.Errorf("the taken frame has been overwritten")
+	}
+	held.Release()
+	if _, err := r.Write(newImage(4, 4), 0); err != nil {
+		t.Errorf("couldn't write into the released slot, %v", err)
+	}
+	for _, f := range taken {
+		f.Release()
+	}
+}
+
+func TestRingBadFrames(t *testing.T) {
+	r := newRing(t, 2, 4*4*4)
+	if _, err := r.Write(newImage(8, 8), 0); err == nil {
+		t.Errorf("the large frame is written")
+	}
+	if _, err := r.Take(5); err != ErrBadFrame {
+		t.Errorf("expected a bad slot, got %v", err)
+	}
+	if _, err := r.Take(0); err != ErrStale {
+		t.Errorf("the empty slot is %v, expected stale", err)
+	}
+	if _, err := OpenRing(make([]byte, 100)); err != ErrBadRing {
+		t.Errorf("the ring of zeros is %v", err)
+	}
+}
+
+func TestRingReopen(t *testing.T) {
+	mem := make([]byte, RingSize(3, 64))
+	reader, _ := NewRing(mem, 3, 64)
+	writer, err := OpenRing(mem)
+	if err != nil {
+		t.Fatalf("couldn't open the ring, %v", err)
+	}
+	if writer.Slots() != 3 || writer.SlotSize() != 64 {
+		t.Errorf("wrong ring of %v slots of %v bytes", writer.Slots(), writer.SlotSize())
+	}
+	for i := 0; i < 2; i++ {
+		slot, _ := writer.Write(newImage(4, 4), 0)
+		f, _ := reader.Take(slot)
+		f.Release()
+	}
+	// the restarted emulator goes on with the next frames
+	writer, _ = OpenRing(mem)
+	slot, err := writer.Write(newImage(4, 4), 0)
+	if err != nil || slot != 2 {
+		t.Fatalf("the frame is in the slot %v (%v), expected 2", slot, err)
+	}
+	if f, err := reader.Take(slot); err != nil || f.Sequence != 3 {
+		t.Errorf("got the frame %v (%v) after the reopen", f.Sequence, err)
+	}
+}
+
+func TestShm(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("no shared memory frames")
+	}
+	path := filepath.Join(os.TempDir(), "cloud-game-test-frames.shm")
+	reader, err := CreateShm(path, 2, 16*16*4)
+	if err != nil {
+		t.Fatalf("couldn't create the shared memory, %v", err)
+	}
+	writer, err := OpenShm(path)
+	if err != nil {
+		t.Fatalf("couldn't open the shared memory, %v", err)
+	}
+	img := newImage(16, 16)
+	slot, err := writer.Write(img, time.Millisecond)
+	if err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	f, err := reader.Take(slot)
+	if err != nil {
+		t.Fatalf("take error: %v", err)
+	}
+	_ = writer.Close()
+	if err := reader.Close(); err != nil {
+		t.Errorf("close error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the shared memory file %v is there", path)
+	}
+	// the taken frame is still there after the close
+	if !bytes.Equal(f.Image.Pix, img.Pix) {
+		t.Errorf("the frame is corrupted")
+	}
+	if _, err := reader.Take(slot); err != ErrBadRing {
+		t.Errorf("the closed ring gives the frames, %v", err)
+	}
+	f.Release()
+	if reader.unmap != nil {
+		t.Errorf("the memory of the ring is mapped after the release")
+	}
+}
+
+func TestSignal(t *testing.T) {
+	var buf bytes.Buffer
+	for _, slot := range []int{0, 3, 1 << 20} {
+		_ = WriteSignal(&buf, slot)
+	}
+	for _, want := range []int{0, 3, 1 << 20} {
+		if slot, err := ReadSignal(&buf); err != nil || slot != want {
+			t.Errorf("got the slot %v (%v), expected %v", slot, err, want)
+		}
+	}
+	if _, err := ReadSignal(&buf); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+// BenchmarkImport compares the frames (640x480) over the socket
+// with the frames in the ring and their slot numbers over the socket.
+func BenchmarkImport(b *testing.B) {
+	img := newImage(640, 480)
+	b.Run("stream", func(b *testing.B) {
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		go func() {
+			for i := 0; i < b.N; i++ {
+				_ = Write(c1, img, 0)
+			}
+		}()
+		r := NewReader(c2)
+		b.SetBytes(int64(len(img.Pix)))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := r.Read(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ring", func(b *testing.B) {
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		ring := newRing(b, 4, len(img.Pix))
+		go func() {
+			for i := 0; i < b.N; i++ {
+				slot, err := ring.Write(img, 0)
+				if err != nil {
+					continue
+				}
+				_ = WriteSignal(c1, slot)
+			}
+			_ = c1.Close()
+		}()
+		b.SetBytes(int64(len(img.Pix)))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for {
+			slot, err := ReadSignal(c2)
+			if err != nil {
+				break
+			}
+			if f, err := ring.Take(slot); err == nil {
+				f.Release()
+			}
+		}
+	})
+}
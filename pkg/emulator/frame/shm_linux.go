@@ -0,0 +1,65 @@
+package frame
+
+import (
+	"os"
+	"syscall"
+)
+
+// CreateShm creates the ring of the slots of size bytes
+// in the shared memory file (i.e. in /dev/shm) and maps it,
+// the file is removed on the close of the ring.
+// The memory of the ring is unmapped after its close and
+// the release of its frames.
+func CreateShm(path string, slots int, size int) (*Ring, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	if err := f.Truncate(int64(RingSize(slots, size))); err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	mem, err := mmap(f, RingSize(slots, size))
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	r, err := NewRing(mem, slots, size)
+	if err != nil {
+		_ = syscall.Munmap(mem)
+		_ = os.Remove(path)
+		return nil, err
+	}
+	r.remove = func() { _ = os.Remove(path) }
+	r.unmap = func() error { return syscall.Munmap(mem) }
+	return r, nil
+}
+
+// OpenShm maps the ring of the shared memory file (i.e. on the emulator side).
+func OpenShm(path string) (*Ring, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	mem, err := mmap(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	r, err := OpenRing(mem)
+	if err != nil {
+		_ = syscall.Munmap(mem)
+		return nil, err
+	}
+	r.unmap = func() error { return syscall.Munmap(mem) }
+	return r, nil
+}
+
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package frame
+
+import "errors"
+
+var errNoShm = errors.New("no shared memory frames on this system")
+
+// CreateShm is not supported, the frames go over the socket.
+func CreateShm(string, int, int) (*Ring, error) { return nil, errNoShm }
+
+// OpenShm is not supported, the frames go over the socket.
+func OpenShm(string) (*Ring, error) { return nil, errNoShm }
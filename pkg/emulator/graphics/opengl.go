@@ -109,7 +109,8 @@ func getFbo() uint32 {
 func SetPixelFormat(format PixelFormat) {
 	switch format {
 	case UnsignedShort5551:
-		opt.pixFormat = gl.UNSIGNED_SHORT_5_5_5_1
+		// 0RGB1555 of the cores
+		opt.pixFormat = gl.UNSIGNED_SHORT_1_5_5_5_REV
 		opt.pixType = gl.BGRA
 	case UnsignedShort565:
 		opt.pixFormat = gl.UNSIGNED_SHORT_5_6_5
@@ -1,11 +1,13 @@
 package image
 
 import (
+	"encoding/binary"
 	"image/color"
 )
 
 const (
-	// BIT_FORMAT_SHORT_5_5_5_1 has 5 bits R, 5 bits G, 5 bits B, 1 bit alpha
+	// BIT_FORMAT_SHORT_5_5_5_1 has 5 bits R, 5 bits G, 5 bits B, 1 bit alpha,
+	// the cores have it as 0RGB1555 (the top bit is unused)
 	BitFormatShort5551 = iota
 	// BIT_FORMAT_INT_8_8_8_8_REV has 8 bits R, 8 bits G, 8 bits B, 8 bit alpha
 	BitFormatInt8888Rev
@@ -26,6 +28,17 @@ func Rgb565(data []byte, index int) color.RGBA {
 	}
 }
 
+func Rgb1555(data []byte, index int) color.RGBA {
+	pixel := (int)(data[index]) + ((int)(data[index+1]) << 8)
+
+	return color.RGBA{
+		R: byte((((pixel>>10)&0x1F)*255 + 15) / 31),
+		G: byte((((pixel>>5)&0x1F)*255 + 15) / 31),
+		B: byte(((pixel&0x1F)*255 + 15) / 31),
+		A: 255,
+	}
+}
+
 func Rgba8888(data []byte, index int) color.RGBA {
 	return color.RGBA{
 		R: data[index+2],
@@ -34,3 +47,100 @@ func Rgba8888(data []byte, index int) color.RGBA {
 		A: 255,
 	}
 }
+
+// Row converts the row of pixels of the core in src into RGBA pixels of dst.
+// The dst slice should be large enough for all the pixels of src.
+type Row func(dst, src []byte)
+
+// The row converters of the formats, they are replaced
+// with the SIMD ones when the CPU supports them.
+var (
+	rgb565Row   = rgb565RowGo
+	xrgb8888Row = xrgb8888RowGo
+)
+
+// Rgb565Row converts the row of RGB565 pixels into RGBA.
+// The colors match the ones of Rgb565.
+func Rgb565Row(dst, src []byte) { rgb565Row(dst, src) }
+
+// Rgba8888Row converts the row of XRGB8888 pixels into RGBA.
+// The colors match the ones of Rgba8888.
+func Rgba8888Row(dst, src []byte) { xrgb8888Row(dst, src) }
+
+// Rgb1555Row converts the row of 0RGB1555 pixels into RGBA.
+// The colors match the ones of Rgb1555.
+func Rgb1555Row(dst, src []byte) { rgb1555RowGo(dst, src) }
+
+// FormatRow returns the row converter and the bytes per pixel
+// of the pixel format (BitFormat*), false for the unknown formats.
+func FormatRow(format int) (row Row, bpp int, ok bool) {
+	switch format {
+	case BitFormatShort5551:
+		return Rgb1555Row, 2, true
+	case BitFormatInt8888Rev:
+		return Rgba8888Row, 4, true
+	case BitFormatShort565:
+		return Rgb565Row, 2, true
+	}
+	return nil, 0, false
+}
+
+// The 5 and 6 bit channels scaled to 8 bits.
+var lut5, lut6 = scaleTable(31), scaleTable(63)
+
+func scaleTable(max int) (t [64]uint8) {
+	for i := 0; i <= max; i++ {
+		t[i] = uint8((i*255 + max/2) / max)
+	}
+	return
+}
+
+func rgb565(p uint16) uint32 {
+	return uint32(lut5[p>>11]) | uint32(lut6[(p>>5)&0x3F])<<8 | uint32(lut5[p&0x1F])<<16 | 0xFF<<24
+}
+
+func rgb565RowGo(dst, src []byte) {
+	n, i := len(src)/2, 0
+	// 4 pixels at a time
+	for ; i+4 <= n; i += 4 {
+		s := binary.LittleEndian.Uint64(src[i*2:])
+		d := dst[i*4 : i*4+16 : i*4+16]
+		binary.LittleEndian.PutUint64(d, uint64(rgb565(uint16(s)))|uint64(rgb565(uint16(s>>16)))<<32)
+		binary.LittleEndian.PutUint64(d[8:], uint64(rgb565(uint16(s>>32)))|uint64(rgb565(uint16(s>>48)))<<32)
+	}
+	for ; i < n; i++ {
+		binary.LittleEndian.PutUint32(dst[i*4:], rgb565(binary.LittleEndian.Uint16(src[i*2:])))
+	}
+}
+
+func rgb1555(p uint16) uint32 {
+	return uint32(lut5[(p>>10)&0x1F]) | uint32(lut5[(p>>5)&0x1F])<<8 | uint32(lut5[p&0x1F])<<16 | 0xFF<<24
+}
+
+func rgb1555RowGo(dst, src []byte) {
+	n, i := len(src)/2, 0
+	// 4 pixels at a time
+	for ; i+4 <= n; i += 4 {
+		s := binary.LittleEndian.Uint64(src[i*2:])
+		d := dst[i*4 : i*4+16 : i*4+16]
+		binary.LittleEndian.PutUint64(d, uint64(rgb1555(uint16(s)))|uint64(rgb1555(uint16(s>>16)))<<32)
+		binary.LittleEndian.PutUint64(d[8:], uint64(rgb1555(uint16(s>>32)))|uint64(rgb1555(uint16(s>>48)))<<32)
+	}
+	for ; i < n; i++ {
+		binary.LittleEndian.PutUint32(dst[i*4:], rgb1555(binary.LittleEndian.Uint16(src[i*2:])))
+	}
+}
+
+func xrgb8888RowGo(dst, src []byte) {
+	n, i := len(src)/4, 0
+	// 2 pixels at a time, B G R X -> R G B A
+	for ; i+2 <= n; i += 2 {
+		s := binary.LittleEndian.Uint64(src[i*4:])
+		binary.LittleEndian.PutUint64(dst[i*4:], (s>>16)&0x000000FF000000FF|s&0x0000FF000000FF00|
+			(s<<16)&0x00FF000000FF0000|0xFF000000FF000000)
+	}
+	for ; i < n; i++ {
+		s := binary.LittleEndian.Uint32(src[i*4:])
+		binary.LittleEndian.PutUint32(dst[i*4:], (s>>16)&0xFF|s&0xFF00|(s<<16)&0xFF0000|0xFF000000)
+	}
+}
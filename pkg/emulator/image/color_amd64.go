@@ -0,0 +1,37 @@
+package image
+
+import "golang.org/x/sys/cpu"
+
+func init() {
+	if cpu.X86.HasSSE2 {
+		rgb565Row, xrgb8888Row = rgb565RowSSE2, xrgb8888RowSSE2
+	}
+}
+
+// rgb565SSE2 converts n pixels, n is a multiple of 8.
+//
+//go:noescape
+func rgb565SSE2(dst, src *byte, n int)
+
+// xrgb8888SSE2 converts n pixels, n is a multiple of 4.
+//
+//go:noescape
+func xrgb8888SSE2(dst, src *byte, n int)
+
+func rgb565RowSSE2(dst, src []byte) {
+	n := len(src) / 2 &^ 7
+	if n > 0 {
+		_ = dst[n*4-1]
+		rgb565SSE2(&dst[0], &src[0], n)
+	}
+	rgb565RowGo(dst[n*4:], src[n*2:])
+}
+
+func xrgb8888RowSSE2(dst, src []byte) {
+	n := len(src) / 4 &^ 3
+	if n > 0 {
+		_ = dst[n*4-1]
+		xrgb8888SSE2(&dst[0], &src[0], n)
+	}
+	xrgb8888RowGo(dst[n*4:], src[n*4:])
+}
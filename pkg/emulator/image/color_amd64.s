@@ -0,0 +1,136 @@
+#include "textflag.h"
+
+// The 5 and 6 bit channels are scaled to 8 bits with
+// (c*527+23)>>6 and (c*259+33)>>6 that equal
+// (c*255+15)/31 and (c*255+31)/63 of Rgb565.
+DATA mul5<>+0(SB)/8, $0x020f020f020f020f
+DATA mul5<>+8(SB)/8, $0x020f020f020f020f
+GLOBL mul5<>(SB), RODATA|NOPTR, $16
+DATA add5<>+0(SB)/8, $0x0017001700170017
+DATA add5<>+8(SB)/8, $0x0017001700170017
+GLOBL add5<>(SB), RODATA|NOPTR, $16
+DATA mul6<>+0(SB)/8, $0x0103010301030103
+DATA mul6<>+8(SB)/8, $0x0103010301030103
+GLOBL mul6<>(SB), RODATA|NOPTR, $16
+DATA add6<>+0(SB)/8, $0x0021002100210021
+DATA add6<>+8(SB)/8, $0x0021002100210021
+GLOBL add6<>(SB), RODATA|NOPTR, $16
+DATA mask5<>+0(SB)/8, $0x001f001f001f001f
+DATA mask5<>+8(SB)/8, $0x001f001f001f001f
+GLOBL mask5<>(SB), RODATA|NOPTR, $16
+DATA mask6<>+0(SB)/8, $0x003f003f003f003f
+DATA mask6<>+8(SB)/8, $0x003f003f003f003f
+GLOBL mask6<>(SB), RODATA|NOPTR, $16
+DATA alpha16<>+0(SB)/8, $0xff00ff00ff00ff00
+DATA alpha16<>+8(SB)/8, $0xff00ff00ff00ff00
+GLOBL alpha16<>(SB), RODATA|NOPTR, $16
+
+DATA byte0<>+0(SB)/8, $0x000000ff000000ff
+DATA byte0<>+8(SB)/8, $0x000000ff000000ff
+GLOBL byte0<>(SB), RODATA|NOPTR, $16
+DATA byte1<>+0(SB)/8, $0x0000ff000000ff00
+DATA byte1<>+8(SB)/8, $0x0000ff000000ff00
+GLOBL byte1<>(SB), RODATA|NOPTR, $16
+DATA byte2<>+0(SB)/8, $0x00ff000000ff0000
+DATA byte2<>+8(SB)/8, $0x00ff000000ff0000
+GLOBL byte2<>(SB), RODATA|NOPTR, $16
+DATA alpha32<>+0(SB)/8, $0xff000000ff000000
+DATA alpha32<>+8(SB)/8, $0xff000000ff000000
+GLOBL alpha32<>(SB), RODATA|NOPTR, $16
+
+// func rgb565SSE2(dst, src *byte, n int)
+TEXT ·rgb565SSE2(SB), NOSPLIT, $0-24
+	MOVQ  dst+0(FP), DI
+	MOVQ  src+8(FP), SI
+	MOVQ  n+16(FP), CX
+	MOVOU mul5<>(SB), X8
+	MOVOU add5<>(SB), X9
+	MOVOU mul6<>(SB), X10
+	MOVOU add6<>(SB), X11
+	MOVOU mask5<>(SB), X12
+	MOVOU mask6<>(SB), X13
+	MOVOU alpha16<>(SB), X14
+
+loop565:
+	CMPQ CX, $8
+	JL   done565
+
+	// 8 pixels
+	MOVOU (SI), X0
+
+	// R
+	MOVO   X0, X1
+	PSRLW  $11, X1
+	PMULLW X8, X1
+	PADDW  X9, X1
+	PSRLW  $6, X1
+
+	// G
+	MOVO   X0, X2
+	PSRLW  $5, X2
+	PAND   X13, X2
+	PMULLW X10, X2
+	PADDW  X11, X2
+	PSRLW  $6, X2
+
+	// B
+	MOVO   X0, X3
+	PAND   X12, X3
+	PMULLW X8, X3
+	PADDW  X9, X3
+	PSRLW  $6, X3
+
+	// RG and BA words into RGBA
+	PSLLW     $8, X2
+	POR       X2, X1
+	POR       X14, X3
+	MOVO      X1, X4
+	PUNPCKLWL X3, X1
+	PUNPCKHWL X3, X4
+	MOVOU     X1, (DI)
+	MOVOU     X4, 16(DI)
+
+	ADDQ $16, SI
+	ADDQ $32, DI
+	SUBQ $8, CX
+	JMP  loop565
+
+done565:
+	RET
+
+// func xrgb8888SSE2(dst, src *byte, n int)
+TEXT ·xrgb8888SSE2(SB), NOSPLIT, $0-24
+	MOVQ  dst+0(FP), DI
+	MOVQ  src+8(FP), SI
+	MOVQ  n+16(FP), CX
+	MOVOU byte0<>(SB), X8
+	MOVOU byte1<>(SB), X9
+	MOVOU byte2<>(SB), X10
+	MOVOU alpha32<>(SB), X11
+
+loop8888:
+	CMPQ CX, $4
+	JL   done8888
+
+	// 4 pixels of B G R X
+	MOVOU (SI), X0
+	MOVO  X0, X1
+	PSRLL $16, X1
+	PAND  X8, X1
+	MOVO  X0, X2
+	PAND  X9, X2
+	MOVO  X0, X3
+	PSLLL $16, X3
+	PAND  X10, X3
+	POR   X2, X1
+	POR   X3, X1
+	POR   X11, X1
+	MOVOU X1, (DI)
+
+	ADDQ $16, SI
+	ADDQ $16, DI
+	SUBQ $4, CX
+	JMP  loop8888
+
+done8888:
+	RET
@@ -8,16 +8,28 @@ type imageCache struct {
 	image *image.RGBA
 	w     int
 	h     int
+	row   []byte
 }
 
 var canvas = imageCache{
 	image.NewRGBA(image.Rectangle{}),
 	0,
 	0,
+	nil,
 }
 
-func DrawRgbaImage(pixFormat Format, rotationFn Rotate, scaleType int, flipV bool, w, h, packedW, bpp int,
-	data []byte, dw, dh int) *image.RGBA {
+// DrawRgbaImage draws the frame data of the core into the RGBA image of dw x dh
+// with the pixels of out (dw * dh * 4 bytes), so the buffer could be reused.
+func DrawRgbaImage(pixFormat Row, rotationFn Rotate, scaleType int, flipV bool, w, h, packedW, bpp int,
+	data []byte, dw, dh int, out []byte) *image.RGBA {
+	return DrawRgbaImageCrop(pixFormat, rotationFn, scaleType, flipV, w, h, packedW, bpp, data,
+		image.Rectangle{}, dw, dh, out)
+}
+
+// DrawRgbaImageCrop draws the crop part of the rotated frame into the RGBA image of dw x dh,
+// the empty crop is the whole frame.
+func DrawRgbaImageCrop(pixFormat Row, rotationFn Rotate, scaleType int, flipV bool, w, h, packedW, bpp int,
+	data []byte, crop image.Rectangle, dw, dh int, out []byte) *image.RGBA {
 	if pixFormat == nil {
 		return nil
 	}
@@ -30,26 +42,37 @@ func DrawRgbaImage(pixFormat Format, rotationFn Rotate, scaleType int, flipV boo
 	src := getCanvas(ww, hh)
 
 	drawImage(pixFormat, w, h, packedW, bpp, flipV, rotationFn, data, src)
-	out := image.NewRGBA(image.Rect(0,0, dw, dh))
-	Resize(scaleType, src, out)
-	return out
+	img := &image.RGBA{Pix: out, Stride: dw * 4, Rect: image.Rect(0, 0, dw, dh)}
+	if crop = crop.Intersect(src.Rect); !crop.Empty() {
+		src = src.SubImage(crop).(*image.RGBA)
+	}
+	Resize(scaleType, src, img)
+	return img
 }
 
-func drawImage(toRGBA Format, w, h, packedW, bpp int, flipV bool, rotationFn Rotate, data []byte, image *image.RGBA) {
+// drawImage converts the frame row by row,
+// the rotated rows are converted into the temp row first.
+func drawImage(toRGBA Row, w, h, packedW, bpp int, flipV bool, rotationFn Rotate, data []byte, image *image.RGBA) {
+	rotated := rotationFn.Angle != Angle0
+	var row []byte
+	if rotated {
+		row = getRow(w)
+	}
 	for y := 0; y < h; y++ {
 		yy := y
 		if flipV {
 			yy = (h - 1) - y
 		}
+		src := data[y*packedW*bpp : (y*packedW+w)*bpp]
+		if !rotated {
+			toRGBA(image.Pix[yy*image.Stride:], src)
+			continue
+		}
+		toRGBA(row, src)
 		for x := 0; x < w; x++ {
-			src := toRGBA(data, (x+y*packedW)*bpp)
 			dx, dy := rotationFn.Call(x, yy, w, h)
 			i := dx*4 + dy*image.Stride
-			dst := image.Pix[i : i+4 : i+4]
-			dst[0] = src.R
-			dst[1] = src.G
-			dst[2] = src.B
-			dst[3] = src.A
+			copy(image.Pix[i:i+4:i+4], row[x*4:x*4+4])
 		}
 	}
 }
@@ -64,3 +87,10 @@ func getCanvas(w, h int) *image.RGBA {
 
 	return canvas.image
 }
+
+func getRow(w int) []byte {
+	if len(canvas.row) < w*4 {
+		canvas.row = make([]byte, w*4)
+	}
+	return canvas.row
+}
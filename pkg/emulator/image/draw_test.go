@@ -0,0 +1,213 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// drawPixels is the per pixel drawing the row converters should match.
+func drawPixels(toRGBA Format, w, h, packedW, bpp int, flipV bool, rotationFn Rotate, data []byte, image *image.RGBA) {
+	for y := 0; y < h; y++ {
+		yy := y
+		if flipV {
+			yy = (h - 1) - y
+		}
+		for x := 0; x < w; x++ {
+			src := toRGBA(data, (x+y*packedW)*bpp)
+			dx, dy := rotationFn.Call(x, yy, w, h)
+			i := dx*4 + dy*image.Stride
+			dst := image.Pix[i : i+4 : i+4]
+			dst[0] = src.R
+			dst[1] = src.G
+			dst[2] = src.B
+			dst[3] = src.A
+		}
+	}
+}
+
+func randomFrame(rnd *rand.Rand, packedW, h, bpp int) []byte {
+	data := make([]byte, packedW*h*bpp)
+	rnd.Read(data)
+	return data
+}
+
+var formats = []struct {
+	name string
+	bpp  int
+	ref  Format
+	rows map[string]Row
+}{
+	{name: "rgb565", bpp: 2, ref: Rgb565, rows: map[string]Row{"go": rgb565RowGo, "auto": Rgb565Row}},
+	{name: "xrgb8888", bpp: 4, ref: Rgba8888, rows: map[string]Row{"go": xrgb8888RowGo, "auto": Rgba8888Row}},
+	{name: "0rgb1555", bpp: 2, ref: Rgb1555, rows: map[string]Row{"go": rgb1555RowGo, "auto": Rgb1555Row}},
+}
+
+// Tests the colors of the known pixels of each format.
+func TestFormatColors(t *testing.T) {
+	tests := []struct {
+		format int
+		pixels []byte
+		rgba   []byte
+	}{
+		{
+			format: BitFormatShort565,
+			// red, green, blue, white, black, gray
+			pixels: []byte{0x00, 0xf8, 0xe0, 0x07, 0x1f, 0x00, 0xff, 0xff, 0x00, 0x00, 0x10, 0x84},
+			rgba: []byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255, 0, 0, 0, 255,
+				132, 130, 132, 255},
+		},
+		{
+			format: BitFormatInt8888Rev,
+			// B G R X
+			pixels: []byte{0, 0, 255, 0, 0, 255, 0, 0, 255, 0, 0, 0, 255, 255, 255, 0, 0, 0, 0, 0xff, 0x80, 0x80, 0x80, 0},
+			rgba: []byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255, 0, 0, 0, 255,
+				128, 128, 128, 255},
+		},
+		{
+			format: BitFormatShort5551,
+			// the top bit is unused
+			pixels: []byte{0x00, 0x7c, 0xe0, 0x03, 0x1f, 0x00, 0xff, 0x7f, 0x00, 0x80, 0x10, 0x42},
+			rgba: []byte{255, 0, 0, 255, 0, 255, 0, 255, 0, 0, 255, 255, 255, 255, 255, 255, 0, 0, 0, 255,
+				132, 132, 132, 255},
+		},
+	}
+	for _, test := range tests {
+		row, bpp, ok := FormatRow(test.format)
+		if !ok {
+			t.Fatalf("no converter of the format %v", test.format)
+		}
+		if len(test.pixels)/bpp != len(test.rgba)/4 {
+			t.Fatalf("wrong test pixels of the format %v", test.format)
+		}
+		dst := make([]byte, len(test.rgba))
+		row(dst, test.pixels)
+		if !bytes.Equal(dst, test.rgba) {
+			t.Errorf("wrong colors of the format %v\n%v\nexpected\n%v", test.format, dst, test.rgba)
+		}
+	}
+	if _, _, ok := FormatRow(42); ok {
+		t.Errorf("the unknown format has a converter")
+	}
+}
+
+func TestRowsMatchPixels(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for _, f := range formats {
+		for name, row := range f.rows {
+			// all the lengths around the batches of the fast paths
+			for n := 0; n <= 35; n++ {
+				src := randomFrame(rnd, n, 1, f.bpp)
+				dst := make([]byte, n*4)
+				row(dst, src)
+				for x := 0; x < n; x++ {
+					c := f.ref(src, x*f.bpp)
+					if !bytes.Equal(dst[x*4:x*4+4], []byte{c.R, c.G, c.B, c.A}) {
+						t.Fatalf("%v/%v: wrong pixel %v of %v", f.name, name, x, n)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRgb565AllColors(t *testing.T) {
+	src := make([]byte, 1<<17)
+	for i := 0; i < 1<<16; i++ {
+		src[i*2], src[i*2+1] = byte(i), byte(i>>8)
+	}
+	for name, row := range formats[0].rows {
+		dst := make([]byte, 1<<18)
+		row(dst, src)
+		for i := 0; i < 1<<16; i++ {
+			c := Rgb565(src, i*2)
+			if !bytes.Equal(dst[i*4:i*4+4], []byte{c.R, c.G, c.B, c.A}) {
+				t.Fatalf("%v: wrong color %#04x", name, i)
+			}
+		}
+	}
+}
+
+func TestDrawImageMatchesPixels(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	sizes := []struct{ w, h, packedW int }{{15, 9, 15}, {33, 17, 40}, {64, 48, 64}}
+	for _, f := range formats {
+		for _, s := range sizes {
+			data := randomFrame(rnd, s.packedW, s.h, f.bpp)
+			for _, rot := range Angles {
+				for _, flip := range []bool{false, true} {
+					w, h := s.w, s.h
+					if rot.IsEven {
+						w, h = h, w
+					}
+					expected := image.NewRGBA(image.Rect(0, 0, w, h))
+					drawPixels(f.ref, s.w, s.h, s.packedW, f.bpp, flip, rot, data, expected)
+					for name, row := range f.rows {
+						img := image.NewRGBA(image.Rect(0, 0, w, h))
+						drawImage(row, s.w, s.h, s.packedW, f.bpp, flip, rot, data, img)
+						if !bytes.Equal(img.Pix, expected.Pix) {
+							t.Errorf("%v/%v: the %vx%v frame (%v°, flip %v) differs",
+								f.name, name, s.w, s.h, rot.Angle*90, flip)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDrawRgbaImageCrop(t *testing.T) {
+	const w, h = 8, 4
+	data := randomFrame(rand.New(rand.NewSource(3)), w, h, 4)
+	rot := GetRotation(Angle0)
+	whole := DrawRgbaImage(Rgba8888Row, rot, ScaleNearestNeighbour, false, w, h, w, 4, data, w, h, make([]byte, w*h*4))
+
+	crop := image.Rect(2, 1, 6, 3)
+	img := DrawRgbaImageCrop(Rgba8888Row, rot, ScaleNearestNeighbour, false, w, h, w, 4, data, crop,
+		4, 2, make([]byte, 4*2*4))
+	for y := 0; y < 2; y++ {
+		if !bytes.Equal(img.Pix[y*img.Stride:(y+1)*img.Stride], whole.Pix[(y+1)*whole.Stride+2*4:(y+1)*whole.Stride+6*4]) {
+			t.Errorf("wrong cropped row %v", y)
+		}
+	}
+
+	// the crop out of the frame is the whole frame
+	img = DrawRgbaImageCrop(Rgba8888Row, rot, ScaleNearestNeighbour, false, w, h, w, 4, data,
+		image.Rect(10, 10, 20, 20), w, h, make([]byte, w*h*4))
+	if !bytes.Equal(img.Pix, whole.Pix) {
+		t.Errorf("the frame has been cropped out")
+	}
+}
+
+func benchmarkDraw(b *testing.B, bpp int, draw func(data []byte, img *image.RGBA)) {
+	const w, h = 512, 448
+	data := randomFrame(rand.New(rand.NewSource(1)), w, h, bpp)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	b.SetBytes(w * h * int64(bpp))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		draw(data, img)
+	}
+}
+
+func BenchmarkDraw512x448(b *testing.B) {
+	rot := GetRotation(Angle0)
+	for _, f := range formats {
+		f := f
+		b.Run(f.name+"/pixels", func(b *testing.B) {
+			benchmarkDraw(b, f.bpp, func(data []byte, img *image.RGBA) {
+				drawPixels(f.ref, 512, 448, 512, f.bpp, false, rot, data, img)
+			})
+		})
+		for name, row := range f.rows {
+			row := row
+			b.Run(f.name+"/"+name, func(b *testing.B) {
+				benchmarkDraw(b, f.bpp, func(data []byte, img *image.RGBA) {
+					drawImage(row, 512, 448, 512, f.bpp, false, rot, data, img)
+				})
+			})
+		}
+	}
+}
@@ -13,10 +13,10 @@ const (
 
 // A helper to choose appropriate rotation by its angle
 var Angles = [4]Rotate{
-	Angle0:   {Call: Rotate0, IsEven: false},
-	Angle90:  {Call: Rotate90, IsEven: true},
-	Angle180: {Call: Rotate180, IsEven: false},
-	Angle270: {Call: Rotate270, IsEven: true},
+	Angle0:   {Call: Rotate0, IsEven: false, Angle: Angle0},
+	Angle90:  {Call: Rotate90, IsEven: true, Angle: Angle90},
+	Angle180: {Call: Rotate180, IsEven: false, Angle: Angle180},
+	Angle270: {Call: Rotate270, IsEven: true, Angle: Angle270},
 }
 
 func GetRotation(angle Angle) Rotate {
@@ -33,6 +33,7 @@ func GetRotation(angle Angle) Rotate {
 type Rotate struct {
 	Call   func(x, y, w, h int) (int, int)
 	IsEven bool
+	Angle  Angle
 }
 
 // 0° or the original orientation
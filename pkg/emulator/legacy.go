@@ -0,0 +1,25 @@
+package emulator
+
+import (
+	"errors"
+	"os"
+)
+
+// MoveLegacyFile moves the file of the older versions from the legacy path
+// to the new path unless there is a file already.
+// It tells if the file has been moved.
+func MoveLegacyFile(path string, legacy string) (bool, error) {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := os.Rename(legacy, path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,45 @@
+package emulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveLegacyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	legacy, path := filepath.Join(dir, "room.a9993e36.srm"), filepath.Join(dir, "a9993e36.srm")
+	if moved, err := MoveLegacyFile(path, legacy); moved || err != nil {
+		t.Errorf("moved the missing file, %v", err)
+	}
+
+	if err := ioutil.WriteFile(legacy, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if moved, err := MoveLegacyFile(path, legacy); !moved || err != nil {
+		t.Fatalf("the legacy file hasn't been moved, %v", err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "old" {
+		t.Errorf("wrong moved file %q, %v", data, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("the legacy file is still there, %v", err)
+	}
+
+	// the new file stays
+	if err := ioutil.WriteFile(legacy, []byte("older"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if moved, err := MoveLegacyFile(path, legacy); moved || err != nil {
+		t.Errorf("the legacy file has replaced the new one, %v", err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "old" {
+		t.Errorf("wrong file %q", data)
+	}
+}
@@ -0,0 +1,175 @@
+// Package bios checks the BIOS (system) files of the cores in the system directory
+// and downloads the missing ones from the private download of the config.
+package bios
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	config "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// DefaultDir is the system directory of the cores without the config one.
+const DefaultDir = "./pkg/emulator/libretro/system"
+
+// known are the BIOS files of the cores by their library names
+// (retro_get_system_info), the cores with the HLE BIOS have them optional.
+var known = map[string][]config.BiosFile{
+	"Beetle PSX": {
+		{Name: "scph5501.bin", Md5: "490f666e1afb15b7362b406ed1cea246"},
+		{Name: "scph5500.bin", Md5: "8dd7d5296a650fac7319bce665a6a53c", Optional: true},
+		{Name: "scph5502.bin", Md5: "32736f17079d0b2b7024407c39bd3050", Optional: true},
+	},
+	"Beetle PSX HW": {
+		{Name: "scph5501.bin", Md5: "490f666e1afb15b7362b406ed1cea246"},
+		{Name: "scph5500.bin", Md5: "8dd7d5296a650fac7319bce665a6a53c", Optional: true},
+		{Name: "scph5502.bin", Md5: "32736f17079d0b2b7024407c39bd3050", Optional: true},
+	},
+	"PCSX-ReARMed": {
+		{Name: "scph5501.bin", Md5: "490f666e1afb15b7362b406ed1cea246", Optional: true},
+	},
+	"Beetle Saturn": {
+		{Name: "mpr-17933.bin", Md5: "3240872c70984b6cbfda1586cab68dbe"},
+		{Name: "sega_101.bin", Md5: "85ec9ca47d8f6807718151cbcca8b964", Optional: true},
+	},
+	"gpSP": {
+		{Name: "gba_bios.bin", Md5: "a860e8c0b6d573d191e4ec7db1b1e4f6"},
+	},
+	"mGBA": {
+		{Name: "gba_bios.bin", Md5: "a860e8c0b6d573d191e4ec7db1b1e4f6", Optional: true},
+	},
+}
+
+// client downloads the BIOS files.
+var client = &http.Client{Timeout: time.Minute}
+
+var errChecksum = errors.New("wrong checksum")
+
+// Error is the error of the required BIOS file of the core
+// which is missing or has the wrong checksum.
+type Error struct {
+	Core string
+	File string
+	// the file is there but it's not the one
+	Checksum bool
+}
+
+func (e *Error) Error() string {
+	if e.Checksum {
+		return fmt.Sprintf("core %v requires %v (wrong checksum)", e.Core, e.File)
+	}
+	return fmt.Sprintf("core %v requires %v", e.Core, e.File)
+}
+
+// Unwrap makes the error an emulator.ErrNoBios error.
+func (e *Error) Unwrap() error { return emulator.ErrNoBios }
+
+// Files returns the known BIOS files of the core with the files of its config,
+// the config ones replace the known files of the same names.
+func Files(core string, conf []config.BiosFile) []config.BiosFile {
+	var files []config.BiosFile
+	for _, f := range known[core] {
+		replaced := false
+		for _, c := range conf {
+			replaced = replaced || c.Name == f.Name
+		}
+		if !replaced {
+			files = append(files, f)
+		}
+	}
+	return append(files, conf...)
+}
+
+// Check checks the BIOS files of the core in the system directory,
+// the missing or wrong required files are downloaded when there is the download.
+// It returns the *Error of the first bad required file.
+// The wrong optional files are only logged.
+func Check(core string, dir string, files []config.BiosFile, download config.BiosDownload) error {
+	for _, f := range files {
+		ok, err := checkFile(dir, f)
+		if !ok && !f.Optional && download.Url != "" {
+			if e := fetch(download.Url, dir, f); e != nil {
+				log.Printf("warn: couldn't download the BIOS file %v, %v", f.Name, e)
+			} else {
+				ok = true
+			}
+		}
+		if ok {
+			continue
+		}
+		if !f.Optional {
+			return &Error{Core: core, File: f.Name, Checksum: err == errChecksum}
+		}
+		if err == errChecksum {
+			log.Printf("warn: the optional BIOS file %v of %v has the wrong checksum", f.Name, core)
+		}
+	}
+	return nil
+}
+
+// checkFile tells if the BIOS file is in the dir with its checksum.
+func checkFile(dir string, f config.BiosFile) (bool, error) {
+	file, err := os.Open(filepath.Join(dir, f.Name))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = file.Close() }()
+	if f.Md5 == "" {
+		return true, nil
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return false, err
+	}
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), f.Md5) {
+		return false, errChecksum
+	}
+	return true, nil
+}
+
+// fetch downloads the BIOS file into a temp file and moves it into the dir
+// when its checksum matches.
+func fetch(url string, dir string, f config.BiosFile) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	url = strings.TrimSuffix(url, "/") + "/" + f.Name
+	log.Printf("[bios-dl] <<< %v", url)
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response status %v", resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".download-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	h := md5.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); f.Md5 != "" && !strings.EqualFold(sum, f.Md5) {
+		return fmt.Errorf("%w: %v, expected %v", errChecksum, sum, f.Md5)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, f.Name))
+}
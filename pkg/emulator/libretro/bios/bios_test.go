@@ -0,0 +1,166 @@
+package bios
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	config "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+const testBiosMd5 = "949c8a5f325b07b7402514f9578f2616"
+
+// newSystemDir makes the system dir with the fixture files under the names.
+func newSystemDir(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "bios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, fixture := range files {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		bios  []config.BiosFile
+		// the file of the error
+		missing  string
+		checksum bool
+	}{
+		{
+			name:  "match",
+			files: map[string]string{"bios.bin": "test_bios.bin"},
+			bios:  []config.BiosFile{{Name: "bios.bin", Md5: testBiosMd5}},
+		},
+		{
+			name:  "any file",
+			files: map[string]string{"bios.bin": "other_bios.bin"},
+			bios:  []config.BiosFile{{Name: "bios.bin"}},
+		},
+		{
+			name:     "mismatch",
+			files:    map[string]string{"bios.bin": "other_bios.bin"},
+			bios:     []config.BiosFile{{Name: "bios.bin", Md5: testBiosMd5}},
+			missing:  "bios.bin",
+			checksum: true,
+		},
+		{
+			name:    "missing",
+			files:   map[string]string{"bios.bin": "test_bios.bin"},
+			bios:    []config.BiosFile{{Name: "bios.bin", Md5: testBiosMd5}, {Name: "bios2.bin"}},
+			missing: "bios2.bin",
+		},
+		{
+			name:  "optional",
+			files: map[string]string{"bios2.bin": "other_bios.bin"},
+			bios: []config.BiosFile{
+				{Name: "bios.bin", Md5: testBiosMd5, Optional: true},
+				{Name: "bios2.bin", Md5: testBiosMd5, Optional: true},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, cleanup := newSystemDir(t, test.files)
+			defer cleanup()
+
+			err := Check("Test", dir, test.bios, config.BiosDownload{})
+			if test.missing == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			var e *Error
+			if !errors.As(err, &e) || e.File != test.missing || e.Checksum != test.checksum {
+				t.Fatalf("wrong error %v", err)
+			}
+			if !errors.Is(err, emulator.ErrNoBios) {
+				t.Errorf("the error is not of the missing BIOS, %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckDownload(t *testing.T) {
+	good, err := ioutil.ReadFile("testdata/test_bios.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := ioutil.ReadFile("testdata/other_bios.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bios/bios.bin":
+			_, _ = w.Write(good)
+		case "/bios/bad.bin":
+			_, _ = w.Write(bad)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir, cleanup := newSystemDir(t, map[string]string{"bios.bin": "other_bios.bin"})
+	defer cleanup()
+	download := config.BiosDownload{Url: srv.URL + "/bios/"}
+
+	// replaces the wrong file
+	if err := Check("Test", dir, []config.BiosFile{{Name: "bios.bin", Md5: testBiosMd5}}, download); err != nil {
+		t.Fatalf("the BIOS is not downloaded, %v", err)
+	}
+	if ok, err := checkFile(dir, config.BiosFile{Name: "bios.bin", Md5: testBiosMd5}); !ok {
+		t.Errorf("wrong downloaded BIOS, %v", err)
+	}
+
+	for _, name := range []string{"bad.bin", "none.bin"} {
+		err := Check("Test", dir, []config.BiosFile{{Name: name, Md5: testBiosMd5}}, download)
+		var e *Error
+		if !errors.As(err, &e) || e.File != name {
+			t.Errorf("wrong error of %v, %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("the bad download %v is in the system dir", name)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	files := Files("Beetle Saturn", []config.BiosFile{
+		{Name: "sega_101.bin"},
+		{Name: "extra.bin", Optional: true},
+	})
+	want := []config.BiosFile{
+		{Name: "mpr-17933.bin", Md5: "3240872c70984b6cbfda1586cab68dbe"},
+		{Name: "sega_101.bin"},
+		{Name: "extra.bin", Optional: true},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("wrong files %+v", files)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("wrong file %+v, expected %+v", files[i], want[i])
+		}
+	}
+	if files := Files("Unknown", nil); len(files) != 0 {
+		t.Errorf("the unknown core has files %+v", files)
+	}
+}
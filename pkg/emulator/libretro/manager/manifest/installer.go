@@ -0,0 +1,198 @@
+// Package manifest installs the missing cores from the download manifest
+// of the config (the core name -> URL with SHA-256 checksum).
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/core"
+	"github.com/giongto35/cloud-game/v2/pkg/extractor"
+)
+
+var (
+	ErrNoDownload = errors.New("the core is missing and not in the download manifest")
+	ErrChecksum   = errors.New("wrong checksum of the downloaded core")
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+)
+
+type Installer struct {
+	conf emulator.LibretroConfig
+	arch core.ArchInfo
+
+	client *http.Client
+	// the number of the download attempts after the first one
+	retries int
+	// the delay before the first retry, doubles with each retry
+	backoff time.Duration
+
+	mu sync.Mutex
+	// the current downloads by the core name,
+	// concurrent installs of the same core wait for one download
+	downloads map[string]*download
+}
+
+type download struct {
+	done chan struct{}
+	err  error
+}
+
+func NewInstaller(conf emulator.LibretroConfig) *Installer {
+	arch, err := core.GetCoreExt()
+	if err != nil {
+		log.Printf("error: %v", err)
+	}
+	return &Installer{
+		conf:      conf,
+		arch:      arch,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		retries:   defaultRetries,
+		backoff:   defaultBackoff,
+		downloads: map[string]*download{},
+	}
+}
+
+// Sync downloads all the missing cores of the manifest.
+func (i *Installer) Sync() error {
+	var failed []string
+	for name := range i.conf.Cores.Manifest {
+		if err := i.Install(name); err != nil {
+			log.Printf("[core-dl] error: %v core, %v", name, err)
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to download these cores: %v", failed)
+	}
+	return nil
+}
+
+// Install downloads the core by its name in the list if it's missing.
+func (i *Installer) Install(name string) error {
+	path := i.libPath(name)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	src, ok := i.conf.Cores.Manifest[name]
+	if !ok || src.Url == "" {
+		return fmt.Errorf("%w: %v (%v)", ErrNoDownload, name, path)
+	}
+
+	i.mu.Lock()
+	d, ok := i.downloads[name]
+	if !ok {
+		d = &download{done: make(chan struct{})}
+		i.downloads[name] = d
+		go func() {
+			d.err = i.fetch(src, path)
+			i.mu.Lock()
+			delete(i.downloads, name)
+			i.mu.Unlock()
+			close(d.done)
+		}()
+	}
+	i.mu.Unlock()
+
+	<-d.done
+	return d.err
+}
+
+// libPath returns the path of the core lib file.
+func (i *Installer) libPath(name string) string {
+	return filepath.Join(i.conf.GetCoresStorePath(), i.conf.Cores.List[name].Lib+i.arch.LibExt)
+}
+
+// fetch downloads the core with retries.
+func (i *Installer) fetch(src emulator.CoreDownload, path string) (err error) {
+	backoff := i.backoff
+	for attempt := 0; ; attempt++ {
+		log.Printf("[core-dl] <<< %v, attempt %v", src.Url, attempt+1)
+		if err = i.get(src, path); err == nil {
+			log.Printf("[core-dl] %v has been installed", filepath.Base(path))
+			return nil
+		}
+		if attempt >= i.retries {
+			return err
+		}
+		log.Printf("[core-dl] warn: %v, retry in %v", err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// get downloads the core into a temp file and moves it to the path
+// when its checksum matches.
+func (i *Installer) get(src emulator.CoreDownload, path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	resp, err := i.client.Get(src.Url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response status %v", resp.Status)
+	}
+
+	ext := ""
+	if strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".zip") {
+		ext = ".zip"
+	}
+	tmp, err := ioutil.TempFile(dir, ".download-*"+ext)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, src.Sha256) {
+		return fmt.Errorf("%w: %v, expected %v", ErrChecksum, sum, src.Sha256)
+	}
+
+	if ext == "" {
+		return os.Rename(tmp.Name(), path)
+	}
+	return unpack(tmp.Name(), path)
+}
+
+// unpack moves the core lib of the archive to the path.
+func unpack(archive string, path string) error {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".unpack-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if _, err := extractor.NewFromExt(archive).Extract(archive, dir); err != nil {
+		return err
+	}
+	lib := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(lib); err != nil {
+		return fmt.Errorf("no %v in the downloaded archive", filepath.Base(path))
+	}
+	return os.Rename(lib, path)
+}
@@ -0,0 +1,194 @@
+package manifest
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+)
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func newTestInstaller(t *testing.T, manifest map[string]emulator.CoreDownload) (*Installer, func()) {
+	dir, err := ioutil.TempDir("", "cores")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf emulator.LibretroConfig
+	conf.Cores.Paths.Libs = dir
+	conf.Cores.List = map[string]emulator.LibretroCoreConfig{
+		"nes":  {Lib: "nestopia_libretro"},
+		"snes": {Lib: "snes9x_libretro"},
+	}
+	conf.Cores.Manifest = manifest
+	i := NewInstaller(conf)
+	i.backoff = time.Millisecond
+	return i, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestInstall(t *testing.T) {
+	lib := []byte("ELF core")
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write(lib)
+	}))
+	defer server.Close()
+
+	i, cleanup := newTestInstaller(t, map[string]emulator.CoreDownload{
+		"nes": {Url: server.URL + "/nestopia", Sha256: checksum(lib)},
+	})
+	defer cleanup()
+
+	if err := i.Install("nes"); err != nil {
+		t.Fatalf("couldn't install the core, %v", err)
+	}
+	if data, err := ioutil.ReadFile(i.libPath("nes")); err != nil || !bytes.Equal(data, lib) {
+		t.Errorf("wrong installed core %q, %v", data, err)
+	}
+	if err := i.Install("nes"); err != nil || requests != 1 {
+		t.Errorf("the installed core is downloaded again, %v requests, %v", requests, err)
+	}
+	if err := i.Install("snes"); !errors.Is(err, ErrNoDownload) {
+		t.Errorf("expected no download error, got %v", err)
+	}
+}
+
+func TestInstallCorrupted(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte("corrupted core"))
+	}))
+	defer server.Close()
+
+	i, cleanup := newTestInstaller(t, map[string]emulator.CoreDownload{
+		"nes": {Url: server.URL + "/nestopia", Sha256: checksum([]byte("ELF core"))},
+	})
+	defer cleanup()
+	i.retries = 2
+
+	if err := i.Install("nes"); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected the checksum error, got %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 download attempts, got %v", requests)
+	}
+	if files, _ := ioutil.ReadDir(i.conf.GetCoresStorePath()); len(files) != 0 {
+		t.Errorf("corrupted download has left files %v", files)
+	}
+	if err := i.Sync(); err == nil {
+		t.Errorf("expected the sync error")
+	}
+}
+
+func TestInstallRetry(t *testing.T) {
+	lib := []byte("ELF core")
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(lib)
+	}))
+	defer server.Close()
+
+	i, cleanup := newTestInstaller(t, map[string]emulator.CoreDownload{
+		"nes": {Url: server.URL + "/nestopia", Sha256: checksum(lib)},
+	})
+	defer cleanup()
+
+	if err := i.Sync(); err != nil {
+		t.Fatalf("couldn't install the core after retry, %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 download attempts, got %v", requests)
+	}
+}
+
+func TestInstallConcurrent(t *testing.T) {
+	lib := []byte("ELF core")
+	release := make(chan struct{})
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		_, _ = w.Write(lib)
+	}))
+	defer server.Close()
+
+	i, cleanup := newTestInstaller(t, map[string]emulator.CoreDownload{
+		"nes": {Url: server.URL + "/nestopia", Sha256: checksum(lib)},
+	})
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for n := 0; n < 5; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- i.Install("nes")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("couldn't install the core, %v", err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected one shared download, got %v", requests)
+	}
+}
+
+func TestInstallZip(t *testing.T) {
+	lib := []byte("ELF core")
+	var archive bytes.Buffer
+	w := zip.NewWriter(&archive)
+	fw, err := w.Create("nestopia_libretro" + NewInstaller(emulator.LibretroConfig{}).arch.LibExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(lib)
+	_ = w.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive.Bytes())
+	}))
+	defer server.Close()
+
+	i, cleanup := newTestInstaller(t, map[string]emulator.CoreDownload{
+		"nes": {Url: server.URL + "/nestopia.so.zip", Sha256: checksum(archive.Bytes())},
+	})
+	defer cleanup()
+
+	if err := i.Install("nes"); err != nil {
+		t.Fatalf("couldn't install the core, %v", err)
+	}
+	if data, err := ioutil.ReadFile(i.libPath("nes")); err != nil || !bytes.Equal(data, lib) {
+		t.Errorf("wrong unpacked core %q, %v", data, err)
+	}
+	if files, _ := ioutil.ReadDir(i.conf.GetCoresStorePath()); len(files) != 1 {
+		t.Errorf("the download has left temp files %v", files)
+	}
+}
@@ -77,6 +77,10 @@ void* bridge_retro_get_memory_data(void *f, unsigned id) {
 	return ((void* (*)(unsigned))f)(id);
 }
 
+unsigned bridge_retro_get_region(void *f) {
+	return ((unsigned (*)(void))f)();
+}
+
 size_t bridge_retro_serialize_size(void *f) {
   return ((size_t (*)(void))f)();
 }
@@ -93,6 +97,42 @@ void bridge_retro_set_controller_port_device(void *f, unsigned port, unsigned de
   return ((void (*)(unsigned, unsigned))f)(port, device);
 }
 
+void bridge_retro_cheat_reset(void *f) {
+  if (f) ((void (*)(void))f)();
+}
+
+void bridge_retro_cheat_set(void *f, unsigned index, bool enabled, const char *code) {
+  if (f) ((void (*)(unsigned, bool, const char*))f)(index, enabled, code);
+}
+
+void bridge_retro_keyboard_callback(void *f, bool down, unsigned keycode, uint32_t character, uint16_t key_modifiers) {
+  if (f) ((void (*)(bool, unsigned, uint32_t, uint16_t))f)(down, keycode, character, key_modifiers);
+}
+
+bool bridge_disk_set_eject_state(struct retro_disk_control_callback *cb, bool ejected) {
+  return cb->set_eject_state ? cb->set_eject_state(ejected) : false;
+}
+
+unsigned bridge_disk_get_image_index(struct retro_disk_control_callback *cb) {
+  return cb->get_image_index ? cb->get_image_index() : 0;
+}
+
+bool bridge_disk_set_image_index(struct retro_disk_control_callback *cb, unsigned index) {
+  return cb->set_image_index ? cb->set_image_index(index) : false;
+}
+
+unsigned bridge_disk_get_num_images(struct retro_disk_control_callback *cb) {
+  return cb->get_num_images ? cb->get_num_images() : 0;
+}
+
+// appends the disc image the same way as RetroArch does
+bool bridge_disk_add_image(struct retro_disk_control_callback *cb, const char *path) {
+  if (!cb->add_image_index || !cb->replace_image_index || !cb->get_num_images) return false;
+  if (!cb->add_image_index()) return false;
+  struct retro_game_info info = { .path = path };
+  return cb->replace_image_index(cb->get_num_images() - 1, &info);
+}
+
 bool coreEnvironment_cgo(unsigned cmd, void *data) {
 	bool coreEnvironment(unsigned, void*);
 	return coreEnvironment(cmd, data);
@@ -113,6 +153,11 @@ int16_t coreInputState_cgo(unsigned port, unsigned device, unsigned index, unsig
 	return coreInputState(port, device, index, id);
 }
 
+bool coreSetRumbleState_cgo(unsigned port, enum retro_rumble_effect effect, uint16_t strength) {
+	bool coreSetRumbleState(unsigned, unsigned, uint16_t);
+	return coreSetRumbleState(port, effect, strength);
+}
+
 void coreAudioSample_cgo(int16_t left, int16_t right) {
 	void coreAudioSample(int16_t, int16_t);
 	coreAudioSample(left, right);
@@ -0,0 +1,56 @@
+package nanoarch
+
+/*
+#include "libretro.h"
+#include <stdlib.h>
+
+void bridge_retro_cheat_reset(void *f);
+void bridge_retro_cheat_set(void *f, unsigned index, bool enabled, const char *code);
+*/
+import "C"
+import (
+	"unsafe"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// !global emulator lib state
+var (
+	retroCheatReset unsafe.Pointer
+	retroCheatSet   unsafe.Pointer
+)
+
+// setCheats replaces all the cheats of the core.
+func setCheats(cheats []emulator.Cheat) {
+	C.bridge_retro_cheat_reset(retroCheatReset)
+	for _, cheat := range cheats {
+		code := C.CString(cheat.Code)
+		C.bridge_retro_cheat_set(retroCheatSet, C.unsigned(cheat.Index), C.bool(cheat.Enabled), code)
+		C.free(unsafe.Pointer(code))
+	}
+}
+
+// ApplyCheats replaces the cheats of the game with the list.
+// The codes are checked before, one malformed code fails the whole list.
+// The cheats are applied again after each load of the game
+// since some cores clear them with the state.
+func (na *naEmulator) ApplyCheats(cheats []emulator.Cheat) error {
+	for _, cheat := range cheats {
+		if err := emulator.ValidateCheat(cheat.Code); err != nil {
+			return err
+		}
+	}
+	na.Lock()
+	defer na.Unlock()
+	na.cheats = append([]emulator.Cheat(nil), cheats...)
+	setCheats(na.cheats)
+	return nil
+}
+
+// reapplyCheats sets the cheats again (i.e. after the state restore),
+// should be called under the emulator lock.
+func (na *naEmulator) reapplyCheats() {
+	if len(na.cheats) > 0 {
+		setCheats(na.cheats)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+func TestApplyCheats(t *testing.T) {
+	core := stubCore{}
+	core.loadCheats()
+	defer func() { retroCheatReset, retroCheatSet = nil, nil }()
+
+	na := naEmulator{}
+	cheats := []emulator.Cheat{
+		{Index: 0, Code: "SXIOPO", Enabled: true},
+		{Index: 3, Code: "7E0DBE05+7E0DBF00"},
+	}
+	if err := na.ApplyCheats(cheats); err != nil {
+		t.Fatalf("cheats are not applied, %v", err)
+	}
+	if got := core.cheats(); !reflect.DeepEqual(got, cheats) {
+		t.Errorf("wrong core cheats\n got: %+v\nwant: %+v", got, cheats)
+	}
+
+	if err := na.ApplyCheats([]emulator.Cheat{{Index: 1, Code: "bad;code", Enabled: true}}); err == nil {
+		t.Errorf("malformed cheat is applied")
+	}
+	if got := core.cheats(); !reflect.DeepEqual(got, cheats) {
+		t.Errorf("malformed cheat has changed the core cheats: %+v", got)
+	}
+
+	// i.e. after the core has lost them with the state load
+	setCheats(nil)
+	na.reapplyCheats()
+	if got := core.cheats(); !reflect.DeepEqual(got, cheats) {
+		t.Errorf("cheats are not reapplied\n got: %+v\nwant: %+v", got, cheats)
+	}
+
+	if err := na.ApplyCheats(nil); err != nil || len(core.cheats()) != 0 {
+		t.Errorf("cheats are not removed, %v", err)
+	}
+}
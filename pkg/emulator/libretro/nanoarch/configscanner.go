@@ -13,6 +13,15 @@ type ConfigProperties map[string]*C.char
 
 func ScanConfigFile(filename string) ConfigProperties {
 	config := ConfigProperties{}
+	for key, value := range readConfigFile(filename) {
+		config[key] = C.CString(value)
+	}
+	return config
+}
+
+// readConfigFile reads key = value lines of the file.
+func readConfigFile(filename string) map[string]string {
+	config := map[string]string{}
 
 	if len(filename) == 0 {
 		return config
@@ -33,7 +42,7 @@ func ScanConfigFile(filename string) ConfigProperties {
 				if len(line) > equal {
 					value = strings.TrimSpace(line[equal+1:])
 				}
-				config[key] = C.CString(value)
+				config[key] = value
 			}
 		}
 	}
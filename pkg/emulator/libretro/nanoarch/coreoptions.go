@@ -0,0 +1,136 @@
+package nanoarch
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+/*
+#include "libretro.h"
+#include <stdlib.h>
+*/
+import "C"
+
+// coreOptions keeps track of the core variables (options).
+// The values themselves are in coreConfig.
+var coreOptions = struct {
+	// the possible values of the options declared by the core
+	declared map[string][]string
+	// the options changed at runtime, they are saved along with the game
+	changed map[string]string
+	// the options have been changed since the last check of the core
+	updated bool
+}{declared: map[string][]string{}, changed: map[string]string{}}
+
+// loadCoreOptions sets the core options from the config file
+// and the core config options which override the file ones.
+func loadCoreOptions(path string, options map[string]string) {
+	coreConfig = ScanConfigFile(path)
+	for key, value := range options {
+		setConfigValue(key, value)
+	}
+	coreOptions.declared = map[string][]string{}
+	coreOptions.changed = map[string]string{}
+	coreOptions.updated = false
+}
+
+func freeCoreOptions() {
+	for _, element := range coreConfig {
+		C.free(unsafe.Pointer(element))
+	}
+	coreConfig = ConfigProperties{}
+}
+
+func setConfigValue(key, value string) {
+	if old, ok := coreConfig[key]; ok {
+		C.free(unsafe.Pointer(old))
+	}
+	coreConfig[key] = C.CString(value)
+}
+
+// declareCoreOptions reads the list of the core options,
+// the values are described as "Description; value1|value2|...".
+func declareCoreOptions(data unsafe.Pointer) {
+	vars := (*[1 << 12]C.struct_retro_variable)(data)
+	for i := 0; vars[i].key != nil; i++ {
+		key, desc := C.GoString(vars[i].key), C.GoString(vars[i].value)
+		var values []string
+		if semicolon := strings.Index(desc, ";"); semicolon >= 0 {
+			values = strings.Split(strings.TrimSpace(desc[semicolon+1:]), "|")
+		}
+		coreOptions.declared[key] = values
+	}
+	log.Printf("[Env]: core options: %v", len(coreOptions.declared))
+	setRegionOption(coreOptions.declared)
+}
+
+// setCoreOption changes the core option at runtime.
+// The value should be one of the declared ones if the core has declared the option.
+func setCoreOption(key, value string) error {
+	if values, ok := coreOptions.declared[key]; ok && len(values) > 0 {
+		supported := false
+		for _, v := range values {
+			if v == value {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("unsupported value %v of the core option %v, expected one of %v", value, key, values)
+		}
+	}
+	setConfigValue(key, value)
+	coreOptions.changed[key] = value
+	coreOptions.updated = true
+	return nil
+}
+
+// coreOptionsUpdated tells the core if the options have been changed since its last check.
+func coreOptionsUpdated() bool {
+	updated := coreOptions.updated
+	coreOptions.updated = false
+	return updated
+}
+
+// saveCoreOptions writes the options changed at runtime into the file.
+func saveCoreOptions(path string) error {
+	if len(coreOptions.changed) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(coreOptions.changed))
+	for key := range coreOptions.changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(&buf, "%v = %v\n", key, coreOptions.changed[key])
+	}
+	return toFile(path, buf.Bytes())
+}
+
+// restoreCoreOptions sets the saved runtime options from the file if there is one.
+func restoreCoreOptions(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	for key, value := range readConfigFile(path) {
+		if err := setCoreOption(key, value); err != nil {
+			log.Printf("warn: couldn't restore the core option, %v", err)
+		}
+	}
+}
+
+// SetCoreOption changes the core option (variable),
+// the core will pick it up on the next run.
+// The changed options are saved and loaded along with the game.
+func (na *naEmulator) SetCoreOption(key, value string) error {
+	na.Lock()
+	defer na.Unlock()
+	return setCoreOption(key, value)
+}
@@ -0,0 +1,96 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCoreOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "core_options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	conf := filepath.Join(dir, "core.cfg")
+	if err := ioutil.WriteFile(conf, []byte("core_a = 1\ncore_b = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer freeCoreOptions()
+
+	core := stubCore{}
+	loadCoreOptions(conf, map[string]string{"core_b": "3", "core_c": "4"})
+	if !core.declare(map[string]string{"core_region": "Region; auto|ntsc|pal", "core_a": "A; 0|1"}) {
+		t.Fatalf("core options are not accepted")
+	}
+
+	for key, want := range map[string]string{"core_a": "1", "core_b": "3", "core_c": "4"} {
+		if value, ok := core.variable(key); !ok || value != want {
+			t.Errorf("wrong option %v = %v (%v), expected %v", key, value, ok, want)
+		}
+	}
+	if _, ok := core.variable("core_region"); ok {
+		t.Errorf("not configured option has a value")
+	}
+	if core.updated() {
+		t.Errorf("options are updated without changes")
+	}
+
+	// runtime changes
+	if err := setCoreOption("core_region", "mars"); err == nil {
+		t.Errorf("expected unsupported value error")
+	}
+	if err := setCoreOption("core_region", "pal"); err != nil {
+		t.Fatalf("option is not changed, %v", err)
+	}
+	if err := setCoreOption("core_b", "5"); err != nil {
+		t.Fatalf("option is not changed, %v", err)
+	}
+	if !core.updated() {
+		t.Errorf("changed options are not updated")
+	}
+	if core.updated() {
+		t.Errorf("options are updated twice")
+	}
+	if value, _ := core.variable("core_region"); value != "pal" {
+		t.Errorf("wrong changed option value %v", value)
+	}
+
+	// survive save and load
+	saved := filepath.Join(dir, "game.opt")
+	if err := saveCoreOptions(saved); err != nil {
+		t.Fatalf("options are not saved, %v", err)
+	}
+	freeCoreOptions()
+	loadCoreOptions(conf, nil)
+	restoreCoreOptions(saved)
+	if !core.updated() {
+		t.Errorf("restored options are not updated")
+	}
+	for key, want := range map[string]string{"core_a": "1", "core_b": "5", "core_region": "pal"} {
+		if value, ok := core.variable(key); !ok || value != want {
+			t.Errorf("wrong restored option %v = %v (%v), expected %v", key, value, ok, want)
+		}
+	}
+}
+
+func TestCoreOptionsWithoutChanges(t *testing.T) {
+	defer freeCoreOptions()
+	loadCoreOptions("", nil)
+	path := filepath.Join(os.TempDir(), "no_core_options.opt")
+	if err := saveCoreOptions(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		_ = os.Remove(path)
+		t.Errorf("options without changes are saved")
+	}
+	restoreCoreOptions(path)
+	if (stubCore{}).updated() {
+		t.Errorf("options are updated without saved ones")
+	}
+}
@@ -0,0 +1,335 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"unsafe"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+/*
+#include "libretro.h"
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#define STUB_CHEATS_MAX 16
+
+static struct {
+	unsigned index;
+	bool enabled;
+	char code[1025];
+} stub_cheats[STUB_CHEATS_MAX];
+static unsigned stub_cheats_num = 0;
+
+static void stub_retro_cheat_reset(void) { stub_cheats_num = 0; }
+
+static void stub_retro_cheat_set(unsigned index, bool enabled, const char *code) {
+	if (stub_cheats_num == STUB_CHEATS_MAX) return;
+	stub_cheats[stub_cheats_num].index = index;
+	stub_cheats[stub_cheats_num].enabled = enabled;
+	strncpy(stub_cheats[stub_cheats_num].code, code, 1024);
+	stub_cheats_num++;
+}
+
+static void *stub_retro_cheat_reset_ptr() { return (void *)stub_retro_cheat_reset; }
+static void *stub_retro_cheat_set_ptr() { return (void *)stub_retro_cheat_set; }
+
+static unsigned stub_cheats_count() { return stub_cheats_num; }
+static unsigned stub_cheat_index(unsigned i) { return stub_cheats[i].index; }
+static bool stub_cheat_enabled(unsigned i) { return stub_cheats[i].enabled; }
+static const char *stub_cheat_code(unsigned i) { return stub_cheats[i].code; }
+
+#define STUB_SRAM_MAX 1024
+
+static unsigned char stub_sram[STUB_SRAM_MAX];
+static size_t stub_sram_len = 0;
+
+static unsigned char stub_wram[STUB_SRAM_MAX];
+static size_t stub_wram_len = 0;
+
+static void *stub_retro_get_memory_data(unsigned id) {
+	if (id == RETRO_MEMORY_SYSTEM_RAM) return stub_wram_len > 0 ? stub_wram : NULL;
+	return id == RETRO_MEMORY_SAVE_RAM && stub_sram_len > 0 ? stub_sram : NULL;
+}
+
+static size_t stub_retro_get_memory_size(unsigned id) {
+	if (id == RETRO_MEMORY_SYSTEM_RAM) return stub_wram_len;
+	return id == RETRO_MEMORY_SAVE_RAM ? stub_sram_len : 0;
+}
+
+static void *stub_retro_get_memory_data_ptr() { return (void *)stub_retro_get_memory_data; }
+static void *stub_retro_get_memory_size_ptr() { return (void *)stub_retro_get_memory_size; }
+
+static void stub_sram_init(size_t len) {
+	stub_sram_len = len < STUB_SRAM_MAX ? len : STUB_SRAM_MAX;
+	memset(stub_sram, 0, STUB_SRAM_MAX);
+}
+
+static void *stub_sram_data() { return stub_sram; }
+
+static void stub_wram_init(size_t len) {
+	stub_wram_len = len < STUB_SRAM_MAX ? len : STUB_SRAM_MAX;
+	memset(stub_wram, 0, STUB_SRAM_MAX);
+}
+
+static void *stub_wram_data() { return stub_wram; }
+
+static unsigned stub_discs_num = 0;
+static unsigned stub_disc_index = 0;
+static bool stub_disc_ejected = false;
+static char stub_disc_log[2048];
+
+static void stub_disc_log_append(const char *format, unsigned index, const char *path) {
+	size_t len = strlen(stub_disc_log);
+	snprintf(stub_disc_log + len, sizeof(stub_disc_log) - len, format, index, path);
+}
+
+static bool stub_set_eject_state(bool ejected) {
+	stub_disc_ejected = ejected;
+	stub_disc_log_append(ejected ? "eject;" : "insert;", 0, "");
+	return true;
+}
+static bool stub_get_eject_state(void) { return stub_disc_ejected; }
+static unsigned stub_get_image_index(void) { return stub_disc_index; }
+static bool stub_set_image_index(unsigned index) {
+	if (!stub_disc_ejected || index >= stub_discs_num) return false;
+	stub_disc_index = index;
+	stub_disc_log_append("set %u;", index, "");
+	return true;
+}
+static unsigned stub_get_num_images(void) { return stub_discs_num; }
+static bool stub_replace_image_index(unsigned index, const struct retro_game_info *info) {
+	stub_disc_log_append("replace %u %s;", index, info->path);
+	return true;
+}
+static bool stub_add_image_index(void) {
+	stub_discs_num++;
+	stub_disc_log_append("add;", 0, "");
+	return true;
+}
+
+static struct retro_disk_control_callback stub_disk_control = {
+	stub_set_eject_state, stub_get_eject_state, stub_get_image_index, stub_set_image_index,
+	stub_get_num_images, stub_replace_image_index, stub_add_image_index,
+};
+
+static void *stub_disk_control_init(unsigned discs) {
+	stub_discs_num = discs;
+	stub_disc_index = 0;
+	stub_disc_ejected = false;
+	stub_disc_log[0] = '\0';
+	return &stub_disk_control;
+}
+
+static const char *stub_disc_log_str() { return stub_disc_log; }
+
+static char stub_port_log[1024];
+
+static void stub_retro_set_controller_port_device(unsigned port, unsigned device) {
+	size_t len = strlen(stub_port_log);
+	snprintf(stub_port_log + len, sizeof(stub_port_log) - len, "port %u %u;", port, device);
+}
+
+static void *stub_retro_set_controller_port_device_ptr() {
+	stub_port_log[0] = '\0';
+	return (void *)stub_retro_set_controller_port_device;
+}
+
+static const char *stub_port_log_str() { return stub_port_log; }
+
+static char stub_keyboard_log[2048];
+
+static void stub_keyboard_event(bool down, unsigned keycode, uint32_t character, uint16_t key_modifiers) {
+	size_t len = strlen(stub_keyboard_log);
+	snprintf(stub_keyboard_log + len, sizeof(stub_keyboard_log) - len,
+		"%s %u %u %u;", down ? "down" : "up", keycode, (unsigned)character, (unsigned)key_modifiers);
+}
+
+static struct retro_keyboard_callback stub_keyboard = { stub_keyboard_event };
+
+static void *stub_keyboard_init() {
+	stub_keyboard_log[0] = '\0';
+	return &stub_keyboard;
+}
+
+static const char *stub_keyboard_log_str() { return stub_keyboard_log; }
+
+static unsigned stub_region = RETRO_REGION_NTSC;
+
+static unsigned stub_retro_get_region(void) { return stub_region; }
+
+static void *stub_retro_get_region_ptr(unsigned region) {
+	stub_region = region;
+	return (void *)stub_retro_get_region;
+}
+
+static bool stub_set_rumble(struct retro_rumble_interface *rumble, unsigned port, unsigned effect, uint16_t strength) {
+	return rumble->set_rumble_state ? rumble->set_rumble_state(port, effect, strength) : false;
+}
+*/
+import "C"
+
+// stubCore calls the environment callback the same way as cores do
+// without any loaded core lib (for tests),
+// it's built only with the corestub tag so the workers don't have it.
+type stubCore struct{}
+
+// declare declares the core options with their descriptions,
+// i.e. "Region; auto|ntsc|pal".
+func (stubCore) declare(options map[string]string) bool {
+	vars := make([]C.struct_retro_variable, 0, len(options)+1)
+	for key, desc := range options {
+		vars = append(vars, C.struct_retro_variable{key: C.CString(key), value: C.CString(desc)})
+	}
+	vars = append(vars, C.struct_retro_variable{})
+	ok := coreEnvironment(C.RETRO_ENVIRONMENT_SET_VARIABLES, unsafe.Pointer(&vars[0]))
+	for _, v := range vars[:len(vars)-1] {
+		C.free(unsafe.Pointer(v.key))
+		C.free(unsafe.Pointer(v.value))
+	}
+	return bool(ok)
+}
+
+// variable returns the value of the core option.
+func (stubCore) variable(key string) (string, bool) {
+	variable := C.struct_retro_variable{key: C.CString(key)}
+	defer C.free(unsafe.Pointer(variable.key))
+	if !coreEnvironment(C.RETRO_ENVIRONMENT_GET_VARIABLE, unsafe.Pointer(&variable)) || variable.value == nil {
+		return "", false
+	}
+	return C.GoString(variable.value), true
+}
+
+// updated tells if some core option has changed since the last call.
+func (stubCore) updated() bool {
+	var updated C.bool
+	coreEnvironment(C.RETRO_ENVIRONMENT_GET_VARIABLE_UPDATE, unsafe.Pointer(&updated))
+	return bool(updated)
+}
+
+// loadCheats makes the stub core functions receive the cheats.
+func (stubCore) loadCheats() {
+	retroCheatReset = C.stub_retro_cheat_reset_ptr()
+	retroCheatSet = C.stub_retro_cheat_set_ptr()
+}
+
+// cheats returns the cheats set in the stub core after the last reset.
+func (stubCore) cheats() (cheats []emulator.Cheat) {
+	for i := C.unsigned(0); i < C.stub_cheats_count(); i++ {
+		cheats = append(cheats, emulator.Cheat{
+			Index:   int(C.stub_cheat_index(i)),
+			Code:    C.GoString(C.stub_cheat_code(i)),
+			Enabled: bool(C.stub_cheat_enabled(i)),
+		})
+	}
+	return
+}
+
+// loadSRAM makes the stub core expose the zeroed save RAM region
+// of the size (up to 1KB), 0 -- no save RAM.
+func (stubCore) loadSRAM(size int) {
+	C.stub_sram_init(C.size_t(size))
+	retroGetMemoryData = C.stub_retro_get_memory_data_ptr()
+	retroGetMemorySize = C.stub_retro_get_memory_size_ptr()
+}
+
+// sram returns the save RAM of the stub core.
+func (stubCore) sram() []byte {
+	return C.GoBytes(C.stub_sram_data(), C.int(C.stub_retro_get_memory_size(C.RETRO_MEMORY_SAVE_RAM)))
+}
+
+// writeSRAM changes the save RAM of the stub core as the game does.
+func (core stubCore) writeSRAM(data []byte) {
+	sram := (*[1 << 30]byte)(C.stub_sram_data())[:len(core.sram())]
+	copy(sram, data)
+}
+
+// loadSystemRAM makes the stub core expose the zeroed system RAM region
+// of the size (up to 1KB), 0 -- no system RAM.
+func (stubCore) loadSystemRAM(size int) {
+	C.stub_wram_init(C.size_t(size))
+	retroGetMemoryData = C.stub_retro_get_memory_data_ptr()
+	retroGetMemorySize = C.stub_retro_get_memory_size_ptr()
+}
+
+// writeSystemRAM changes the system RAM of the stub core as the game does.
+func (stubCore) writeSystemRAM(addr int, data []byte) {
+	wram := (*[1 << 30]byte)(C.stub_wram_data())[:C.stub_retro_get_memory_size(C.RETRO_MEMORY_SYSTEM_RAM)]
+	copy(wram[addr:], data)
+}
+
+// loadDiskControl sets the stub core disk control callbacks
+// with the number of discs inserted.
+func (stubCore) loadDiskControl(discs int) bool {
+	return bool(coreEnvironment(C.RETRO_ENVIRONMENT_SET_DISK_CONTROL_INTERFACE, C.stub_disk_control_init(C.unsigned(discs))))
+}
+
+// discLog returns the calls of the stub core disk control callbacks.
+func (stubCore) discLog() string { return C.GoString(C.stub_disc_log_str()) }
+
+// loadControllerInfo declares the devices of the controller ports
+// and makes the stub core receive the devices plugged into them.
+func (stubCore) loadControllerInfo(devices [][]emulator.Device) bool {
+	retroSetControllerPortDevice = C.stub_retro_set_controller_port_device_ptr()
+	info := make([]C.struct_retro_controller_info, 0, len(devices)+1)
+	var names []*C.char
+	for _, port := range devices {
+		types := make([]C.struct_retro_controller_description, len(port))
+		for i, d := range port {
+			name := C.CString(d.Name)
+			names = append(names, name)
+			types[i] = C.struct_retro_controller_description{desc: name, id: C.unsigned(d.ID)}
+		}
+		info = append(info, C.struct_retro_controller_info{types: &types[0], num_types: C.unsigned(len(types))})
+	}
+	info = append(info, C.struct_retro_controller_info{})
+	ok := coreEnvironment(C.RETRO_ENVIRONMENT_SET_CONTROLLER_INFO, unsafe.Pointer(&info[0]))
+	for _, name := range names {
+		C.free(unsafe.Pointer(name))
+	}
+	return bool(ok)
+}
+
+// portLog returns the devices plugged into the ports of the stub core.
+func (stubCore) portLog() string { return C.GoString(C.stub_port_log_str()) }
+
+// input returns the state of the input device of the port the core reads,
+// i.e. the motion of the mouse (RETRO_DEVICE_MOUSE, RETRO_DEVICE_ID_MOUSE_X).
+func (stubCore) input(port, device, index, id uint) int16 {
+	return int16(coreInputState(C.unsigned(port), C.unsigned(device), C.unsigned(index), C.unsigned(id)))
+}
+
+// loadKeyboard sets the keyboard callback of the stub core.
+func (stubCore) loadKeyboard() bool {
+	return bool(coreEnvironment(C.RETRO_ENVIRONMENT_SET_KEYBOARD_CALLBACK, C.stub_keyboard_init()))
+}
+
+// keyboardLog returns the calls of the stub core keyboard callback.
+func (stubCore) keyboardLog() string { return C.GoString(C.stub_keyboard_log_str()) }
+
+// rumble sets the rumble of the controller port the same way as cores do.
+func (stubCore) rumble(port, effect uint, strength uint16) bool {
+	var rumble C.struct_retro_rumble_interface
+	if !coreEnvironment(C.RETRO_ENVIRONMENT_GET_RUMBLE_INTERFACE, unsafe.Pointer(&rumble)) {
+		return false
+	}
+	return bool(C.stub_set_rumble(&rumble, C.unsigned(port), C.unsigned(effect), C.uint16_t(strength)))
+}
+
+// setGeometry changes the resolution of the game frames the same way as cores do.
+func (stubCore) setGeometry(w, h uint, ratio float32) bool {
+	g := C.struct_retro_game_geometry{base_width: C.unsigned(w), base_height: C.unsigned(h), aspect_ratio: C.float(ratio)}
+	return bool(coreEnvironment(C.RETRO_ENVIRONMENT_SET_GEOMETRY, unsafe.Pointer(&g)))
+}
+
+// loadRegion makes the stub core report the region of the game (PAL or NTSC).
+func (stubCore) loadRegion(pal bool) {
+	region := C.unsigned(C.RETRO_REGION_NTSC)
+	if pal {
+		region = C.RETRO_REGION_PAL
+	}
+	retroGetRegion = C.stub_retro_get_region_ptr(region)
+}
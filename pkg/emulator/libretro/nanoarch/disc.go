@@ -0,0 +1,134 @@
+package nanoarch
+
+/*
+#include "libretro.h"
+#include <stdlib.h>
+
+bool bridge_disk_set_eject_state(struct retro_disk_control_callback *cb, bool ejected);
+unsigned bridge_disk_get_image_index(struct retro_disk_control_callback *cb);
+bool bridge_disk_set_image_index(struct retro_disk_control_callback *cb, unsigned index);
+unsigned bridge_disk_get_num_images(struct retro_disk_control_callback *cb);
+bool bridge_disk_add_image(struct retro_disk_control_callback *cb, const char *path);
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// !global emulator lib state
+// the disk control callbacks of the core, nil if the core doesn't support disc swapping
+var diskControl *C.struct_retro_disk_control_callback
+
+var errNoDiskControl = errors.New("the core doesn't support disc swapping")
+
+// setDiskControl keeps the disk control callbacks of the core
+// (RETRO_ENVIRONMENT_SET_DISK_CONTROL_INTERFACE).
+func setDiskControl(data unsafe.Pointer) {
+	cb := *(*C.struct_retro_disk_control_callback)(data)
+	diskControl = &cb
+}
+
+// loadDiscs returns the game file to load into the core,
+// that is, the first disc of the multi-disc playlist
+// or the game itself.
+func loadDiscs(path string) (game string, discs []string) {
+	if !emulator.IsPlaylist(path) {
+		return path, nil
+	}
+	discs, err := emulator.LoadPlaylist(path)
+	if err != nil || len(discs) == 0 {
+		log.Printf("error: couldn't read the discs of %v, %v", path, err)
+		return path, nil
+	}
+	return discs[0], discs
+}
+
+// addDiscs appends the rest of the discs to the loaded one.
+func addDiscs(discs []string) error {
+	if diskControl == nil {
+		return errNoDiskControl
+	}
+	for _, disc := range discs {
+		path := C.CString(disc)
+		ok := C.bridge_disk_add_image(diskControl, path)
+		C.free(unsafe.Pointer(path))
+		if !ok {
+			return fmt.Errorf("couldn't add the disc %v", disc)
+		}
+	}
+	return nil
+}
+
+// currentDisc returns the index of the inserted disc and
+// the number of discs of the multi-disc game.
+func currentDisc() (index int, num int) {
+	if diskControl == nil {
+		return 0, 0
+	}
+	return int(C.bridge_disk_get_image_index(diskControl)), int(C.bridge_disk_get_num_images(diskControl))
+}
+
+// SwapDisc changes the disc of the multi-disc game the way the players do:
+// opens the tray, changes the disc and closes the tray.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) SwapDisc(index int) error {
+	na.Lock()
+	defer na.Unlock()
+	return swapDisc(index)
+}
+
+// swapDisc changes the disc of the game,
+// should be called under the emulator lock.
+func swapDisc(index int) error {
+	if diskControl == nil {
+		return errNoDiskControl
+	}
+	if _, num := currentDisc(); index < 0 || index >= num {
+		return fmt.Errorf("no disc %v, the game has %v", index, num)
+	}
+	if !C.bridge_disk_set_eject_state(diskControl, true) {
+		return errors.New("couldn't eject the disc")
+	}
+	if !C.bridge_disk_set_image_index(diskControl, C.unsigned(index)) {
+		C.bridge_disk_set_eject_state(diskControl, false)
+		return fmt.Errorf("couldn't change the disc to %v", index)
+	}
+	if !C.bridge_disk_set_eject_state(diskControl, false) {
+		return errors.New("couldn't insert the disc")
+	}
+	return nil
+}
+
+// writeDisc saves the current disc of the multi-disc game along with the slot state.
+// Should be called under the emulator lock.
+func (na *naEmulator) writeDisc(slot int) error {
+	index, num := currentDisc()
+	if num < 2 {
+		return nil
+	}
+	return toFile(na.storage.GetDiscPath(slot), []byte(strconv.Itoa(index)))
+}
+
+// readDisc restores the disc of the multi-disc game saved with the slot state,
+// should be called before the state restore under the emulator lock.
+func (na *naEmulator) readDisc(slot int) error {
+	data, err := fromFile(na.storage.GetDiscPath(slot))
+	if err != nil {
+		return nil
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("malformed disc file, %v", err)
+	}
+	if current, _ := currentDisc(); current == index {
+		return nil
+	}
+	return swapDisc(index)
+}
@@ -0,0 +1,94 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSwapDisc(t *testing.T) {
+	defer func() { diskControl = nil }()
+	na := &naEmulator{}
+	if err := na.SwapDisc(1); err != errNoDiskControl {
+		t.Errorf("expected no disk control error, got %v", err)
+	}
+
+	core := stubCore{}
+	if !core.loadDiskControl(1) {
+		t.Fatalf("disk control is not accepted")
+	}
+	if err := addDiscs([]string{"/games/Game (Disc 2).cue", "/games/Game (Disc 3).cue"}); err != nil {
+		t.Fatalf("couldn't add the discs, %v", err)
+	}
+	if log := core.discLog(); log != "add;replace 1 /games/Game (Disc 2).cue;add;replace 2 /games/Game (Disc 3).cue;" {
+		t.Errorf("wrong disc add calls %q", log)
+	}
+
+	core.loadDiskControl(3)
+	if err := na.SwapDisc(2); err != nil {
+		t.Fatalf("couldn't swap the disc, %v", err)
+	}
+	if log := core.discLog(); log != "eject;set 2;insert;" {
+		t.Errorf("wrong disc swap calls %q", log)
+	}
+	if index, num := currentDisc(); index != 2 || num != 3 {
+		t.Errorf("wrong disc %v of %v", index, num)
+	}
+	for _, index := range []int{-1, 3} {
+		if err := na.SwapDisc(index); err == nil {
+			t.Errorf("swapped to the missing disc %v", index)
+		}
+	}
+}
+
+func TestDiscPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_disc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	defer func() { diskControl = nil }()
+
+	core := stubCore{}
+	store := Storage{Path: dir, MainSave: "test_disc", Flat: true}
+	na := &naEmulator{storage: store, roomID: store.MainSave}
+
+	// single disc games don't have the disc files
+	core.loadDiskControl(1)
+	if err := na.writeDisc(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(store.GetDiscPath(0)); err == nil {
+		t.Errorf("the disc of the single disc game has been saved")
+	}
+
+	core.loadDiskControl(2)
+	if err := na.SwapDisc(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := na.writeDisc(3); err != nil {
+		t.Fatalf("couldn't save the disc, %v", err)
+	}
+
+	// a new game run starts with the first disc
+	core.loadDiskControl(2)
+	restored := &naEmulator{storage: store, roomID: store.MainSave}
+	if err := restored.LoadGameSlot(0); err != nil {
+		t.Fatal(err)
+	}
+	if index, _ := currentDisc(); index != 0 {
+		t.Errorf("the disc of another slot has been restored")
+	}
+	if err := restored.LoadGameSlot(3); err != nil {
+		t.Fatal(err)
+	}
+	if index, _ := currentDisc(); index != 1 {
+		t.Errorf("wrong restored disc %v", index)
+	}
+	if log := core.discLog(); log != "eject;set 1;insert;" {
+		t.Errorf("wrong disc restore calls %q", log)
+	}
+}
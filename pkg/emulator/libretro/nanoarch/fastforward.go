@@ -0,0 +1,93 @@
+package nanoarch
+
+import "sync"
+
+// audioMute is the fast-forward audio mode without any sound.
+const audioMute = "mute"
+
+// speed is the fast-forward state of the emulator.
+// The emulator runs the multiplier times faster than the game
+// while its video and audio stay at the normal rate.
+type speed struct {
+	mu         sync.Mutex
+	multiplier float64
+	// the accumulated part of the next output video frame
+	frame float64
+	// the position of the next audio frame in the samples
+	audio float64
+}
+
+// SetSpeedMultiplier changes the speed of the game (fast-forward),
+// the multiplier is clamped between 1 and the max speed of the config.
+func (na *naEmulator) SetSpeedMultiplier(multiplier float64) {
+	max := na.ffConf.MaxSpeed
+	if max < 1 {
+		max = 1
+	}
+	// NaN as well
+	if !(multiplier >= 1) {
+		multiplier = 1
+	}
+	if multiplier > max {
+		multiplier = max
+	}
+
+	na.speed.mu.Lock()
+	na.speed.multiplier = multiplier
+	na.speed.frame, na.speed.audio = 0, 0
+	na.speed.mu.Unlock()
+}
+
+func (na *naEmulator) speedMultiplier() float64 {
+	na.speed.mu.Lock()
+	defer na.speed.mu.Unlock()
+	if na.speed.multiplier < 1 {
+		return 1
+	}
+	return na.speed.multiplier
+}
+
+// keepFrame tells if the video frame should go into the output,
+// it drops the frames above the game frame rate while fast-forwarding,
+// i.e. every second frame with the multiplier 2.
+func (na *naEmulator) keepFrame() bool {
+	na.speed.mu.Lock()
+	defer na.speed.mu.Unlock()
+	if na.speed.multiplier <= 1 {
+		return true
+	}
+	na.speed.frame += 1 / na.speed.multiplier
+	if na.speed.frame < 1-1e-9 {
+		return false
+	}
+	na.speed.frame -= 1
+	if na.speed.frame < 0 {
+		na.speed.frame = 0
+	}
+	return true
+}
+
+// fastForwardAudio mutes or resamples the stereo audio samples
+// back to the normal rate while fast-forwarding.
+// The resampled audio has a higher pitch.
+func (na *naEmulator) fastForwardAudio(pcm []int16) []int16 {
+	na.speed.mu.Lock()
+	defer na.speed.mu.Unlock()
+	m := na.speed.multiplier
+	if m <= 1 {
+		return pcm
+	}
+	if na.ffConf.Audio == audioMute {
+		return nil
+	}
+
+	frames := float64(len(pcm) / 2)
+	out := make([]int16, 0, int(frames/m+1)*2)
+	pos := na.speed.audio
+	for ; pos < frames; pos += m {
+		i := int(pos) * 2
+		out = append(out, pcm[i], pcm[i+1])
+	}
+	na.speed.audio = pos - frames
+	return out
+}
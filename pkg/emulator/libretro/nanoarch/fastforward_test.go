@@ -0,0 +1,100 @@
+package nanoarch
+
+import (
+	"testing"
+	"time"
+
+	config "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+)
+
+// fakeClock is a clock that jumps to the time of each wait.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// runFor runs the emulator for the time of the clock and
+// returns the number of emulated and output frames.
+func runFor(na *naEmulator, clock *fakeClock, fps float64, d time.Duration) (ticks int, frames int) {
+	end, stopped := clock.now.Add(d), false
+	na.run(fps, func() {
+		if !clock.now.Before(end) {
+			if !stopped {
+				close(na.done)
+				stopped = true
+			}
+			return
+		}
+		ticks++
+		if na.keepFrame() {
+			frames++
+		}
+	})
+	return
+}
+
+func TestFastForward(t *testing.T) {
+	tests := []struct {
+		multiplier float64
+		ticks      int
+	}{
+		{multiplier: 1, ticks: 60},
+		{multiplier: 2, ticks: 120},
+		{multiplier: 2.5, ticks: 150},
+		{multiplier: 4, ticks: 240},
+		// clamped
+		{multiplier: 10, ticks: 240},
+		{multiplier: 0.5, ticks: 60},
+	}
+	for _, test := range tests {
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		na := naEmulator{ffConf: config.FastForward{MaxSpeed: 4}, clock: clock, done: make(chan struct{})}
+		na.SetSpeedMultiplier(test.multiplier)
+
+		ticks, frames := runFor(&na, clock, 60, time.Second)
+		if ticks < test.ticks-1 || ticks > test.ticks+1 {
+			t.Errorf("x%v: %v emulator ticks per second, expected ~%v", test.multiplier, ticks, test.ticks)
+		}
+		if frames < 59 || frames > 61 {
+			t.Errorf("x%v: %v output fps, expected ~60", test.multiplier, frames)
+		}
+	}
+}
+
+func TestFastForwardAudio(t *testing.T) {
+	pcm := make([]int16, 2*1000)
+	for i := range pcm {
+		pcm[i] = int16(i / 2)
+	}
+
+	na := naEmulator{ffConf: config.FastForward{MaxSpeed: 4}}
+	if out := na.fastForwardAudio(pcm); len(out) != len(pcm) {
+		t.Errorf("normal speed audio has changed")
+	}
+
+	na.SetSpeedMultiplier(2)
+	var out []int16
+	for i := 0; i < len(pcm); i += 2 * 250 {
+		out = append(out, na.fastForwardAudio(pcm[i:i+2*250])...)
+	}
+	if len(out) != len(pcm)/2 {
+		t.Fatalf("wrong resampled audio size %v, expected %v", len(out), len(pcm)/2)
+	}
+	for i := 0; i < len(out); i += 2 {
+		if out[i] != int16(i) || out[i+1] != int16(i) {
+			t.Fatalf("wrong resampled audio frame %v: %v", i/2, out[i:i+2])
+		}
+	}
+
+	na.ffConf.Audio = "mute"
+	if out := na.fastForwardAudio(pcm); len(out) != 0 {
+		t.Errorf("fast-forward audio is not muted")
+	}
+}
@@ -0,0 +1,29 @@
+package nanoarch
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RunTime returns the total time the core has spent on the frames of the game.
+func (na *naEmulator) RunTime() time.Duration { return time.Duration(atomic.LoadInt64(&na.runTime)) }
+
+// OnFrame sets the function called after each frame of the game
+// with the number of the frame (from 1), nil stops the calls.
+// The function runs on the emulator thread, so it should be quick.
+func (na *naEmulator) OnFrame(fn func(frame uint64)) {
+	na.Lock()
+	na.frameHook = fn
+	na.Unlock()
+}
+
+// endFrame counts the frame of the game, moves the media clock
+// and passes the frame to the frame hook.
+// Should be called under the emulator lock after the frame.
+func (na *naEmulator) endFrame() {
+	na.frameCount++
+	na.mediaClock.Frame(na.speedMultiplier())
+	if na.frameHook != nil {
+		na.frameHook(na.frameCount)
+	}
+}
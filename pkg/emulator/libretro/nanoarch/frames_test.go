@@ -0,0 +1,22 @@
+package nanoarch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOnFrame(t *testing.T) {
+	na := &naEmulator{}
+	na.endFrame()
+
+	var frames []uint64
+	na.OnFrame(func(frame uint64) { frames = append(frames, frame) })
+	na.endFrame()
+	na.endFrame()
+	na.OnFrame(nil)
+	na.endFrame()
+
+	if !reflect.DeepEqual(frames, []uint64{2, 3}) {
+		t.Errorf("wrong frames %v", frames)
+	}
+}
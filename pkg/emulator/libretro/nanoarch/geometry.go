@@ -0,0 +1,57 @@
+package nanoarch
+
+import "github.com/giongto35/cloud-game/v2/pkg/emulator"
+
+// geometry is the resolution of the frames of the core.
+// The cores change it with SET_GEOMETRY (SET_SYSTEM_AV_INFO)
+// or just with the frames of other size (i.e. 224p/239p of SNES),
+// the change goes to the room with the next sent frame.
+// Used on the emulator thread.
+type geometry struct {
+	current emulator.Geometry
+	// the aspect ratio of the core, 0 -- of the frame size
+	ratio   float64
+	changed bool
+}
+
+// reset sets the geometry of the loaded game, it goes with the first frame
+// (i.e. to the room of the restarted emulator which may have another one).
+func (g *geometry) reset(w, h int, ratio float64) {
+	*g = geometry{ratio: ratio}
+	g.update(w, h)
+}
+
+// set changes the geometry by the core.
+func (g *geometry) set(w, h int, ratio float64) {
+	g.ratio = ratio
+	g.update(w, h)
+}
+
+// frame changes the geometry by the size of the core frame.
+func (g *geometry) frame(w, h int) { g.update(w, h) }
+
+func (g *geometry) update(w, h int) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	ratio := g.ratio
+	if ratio <= 0 {
+		ratio = float64(w) / float64(h)
+	}
+	next := emulator.Geometry{BaseWidth: w, BaseHeight: h, Ratio: ratio}
+	if next != g.current {
+		g.current, g.changed = next, true
+	}
+}
+
+// pending returns the change not sent yet, nil if there is none.
+func (g *geometry) pending() *emulator.Geometry {
+	if !g.changed {
+		return nil
+	}
+	change := g.current
+	return &change
+}
+
+// sent marks the change as sent.
+func (g *geometry) sent() { g.changed = false }
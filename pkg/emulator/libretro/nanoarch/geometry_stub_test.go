@@ -0,0 +1,29 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+func TestSetGeometry(t *testing.T) {
+	defer func(na *naEmulator) { NAEmulator = na }(NAEmulator)
+	na := &naEmulator{}
+	NAEmulator = na
+	na.geometry.reset(256, 224, 0)
+	na.geometry.sent()
+
+	if !(stubCore{}).setGeometry(320, 240, 4.0/3) {
+		t.Fatalf("the geometry is not accepted")
+	}
+	want := emulator.Geometry{BaseWidth: 320, BaseHeight: 240, Ratio: float64(float32(4.0 / 3))}
+	if change := na.geometry.pending(); change == nil || *change != want {
+		t.Errorf("wrong change %+v, expected %+v", change, want)
+	}
+	if na.meta.BaseWidth != 320 || na.meta.BaseHeight != 240 {
+		t.Errorf("wrong game size %vx%v", na.meta.BaseWidth, na.meta.BaseHeight)
+	}
+}
@@ -0,0 +1,49 @@
+package nanoarch
+
+import (
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+func TestGeometry(t *testing.T) {
+	var g geometry
+	g.reset(256, 224, 4.0/3)
+	want := emulator.Geometry{BaseWidth: 256, BaseHeight: 224, Ratio: 4.0 / 3}
+	if change := g.pending(); change == nil || *change != want {
+		t.Errorf("wrong geometry of the loaded game %+v, expected %+v", change, want)
+	}
+	g.sent()
+	g.frame(256, 224)
+	if change := g.pending(); change != nil {
+		t.Errorf("the frame of the same size is a change %+v", change)
+	}
+
+	// 224p -> 239p
+	g.frame(256, 239)
+	g.frame(256, 239)
+	want = emulator.Geometry{BaseWidth: 256, BaseHeight: 239, Ratio: 4.0 / 3}
+	if change := g.pending(); change == nil || *change != want {
+		t.Fatalf("wrong change %+v, expected %+v", change, want)
+	}
+	// the dropped frames keep the change
+	if change := g.pending(); change == nil {
+		t.Fatalf("the change has been lost")
+	}
+	g.sent()
+	if change := g.pending(); change != nil {
+		t.Errorf("the sent change is pending %+v", change)
+	}
+
+	// the ratio of the frames without the core one
+	g.set(640, 480, 0)
+	want = emulator.Geometry{BaseWidth: 640, BaseHeight: 480, Ratio: 640.0 / 480}
+	if change := g.pending(); change == nil || *change != want {
+		t.Errorf("wrong change %+v, expected %+v", change, want)
+	}
+	g.sent()
+	g.frame(0, 0)
+	if change := g.pending(); change != nil {
+		t.Errorf("the empty frame is a change %+v", change)
+	}
+}
@@ -1,10 +1,19 @@
 package nanoarch
 
-import "sync"
+import (
+	"math"
+	"sync"
+	"time"
+)
 
 const (
 	// how many axes on the D-pad
 	dpadAxesNum = 4
+	// the number of the keyboard keys, more than RETROK_LAST
+	keysNum = 512
+	// the max number of the keyboard events between the frames,
+	// the rest is dropped
+	maxKeyEvents = 128
 	// the upper limit on how many controllers (players)
 	// are possible for one play session (emulator instance)
 	controllersNum = 8
@@ -22,6 +31,23 @@ type playerSession struct {
 	sync.RWMutex
 
 	state map[string][]controllerState
+	// the arrival time of the first input not yet taken by the core
+	arrived time.Time
+	// the mice and pointers of the players
+	mice     [controllersNum]mouseState
+	pointers [controllersNum]PointerEvent
+	// the keyboard events not yet taken by the core
+	// and the keys pressed for the core
+	keyEvents []KeyboardEvent
+	keys      [keysNum]bool
+}
+
+// mouseState is the motion of the mouse of a player
+// accumulated between the frames and the motion of the current frame.
+type mouseState struct {
+	dx, dy           int32
+	frameDX, frameDY int16
+	buttons          uint16
 }
 
 type controllerState struct {
@@ -46,21 +72,119 @@ func (ps *playerSession) close(id string) {
 }
 
 // setInput sets input state for some player in a game session.
-func (ps *playerSession) setInput(id string, player int, buttons uint16, dpad []byte) {
+// The arrival time of the input (may be zero) is kept until the core takes it.
+func (ps *playerSession) setInput(id string, player int, buttons uint16, axes [dpadAxesNum]int16, at time.Time) {
+	if player < 0 || player >= controllersNum {
+		return
+	}
 	ps.Lock()
 	defer ps.Unlock()
 
+	ps.arrive(at)
+
 	if _, ok := ps.state[id]; !ok {
 		ps.state[id] = make([]controllerState, controllersNum)
 	}
 
 	ps.state[id][player].keyState = buttons
-	for i, axes := 0, len(dpad); i < dpadAxesNum && (i+1)*2+1 < axes; i++ {
-		axis := (i + 1) * 2
-		ps.state[id][player].axes[i] = int16(dpad[axis+1])<<8 + int16(dpad[axis])
+	ps.state[id][player].axes = axes
+}
+
+// arrive keeps the arrival time of the first input,
+// should be called under the session lock.
+func (ps *playerSession) arrive(at time.Time) {
+	if !at.IsZero() && (ps.arrived.IsZero() || at.Before(ps.arrived)) {
+		ps.arrived = at
 	}
 }
 
+// moveMouse adds the motion of the mouse of the player.
+func (ps *playerSession) moveMouse(player int, m MouseEvent, at time.Time) {
+	if player < 0 || player >= controllersNum {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+
+	ps.arrive(at)
+	ps.mice[player].dx += int32(m.DX)
+	ps.mice[player].dy += int32(m.DY)
+	ps.mice[player].buttons = m.Buttons
+}
+
+// setPointer sets the pointer position of the player.
+func (ps *playerSession) setPointer(player int, p PointerEvent, at time.Time) {
+	if player < 0 || player >= controllersNum {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+
+	ps.arrive(at)
+	ps.pointers[player] = p
+}
+
+// pressKey queues the keyboard event until the core takes it.
+func (ps *playerSession) pressKey(k KeyboardEvent, at time.Time) {
+	if k.Key >= keysNum {
+		return
+	}
+	ps.Lock()
+	defer ps.Unlock()
+
+	if len(ps.keyEvents) >= maxKeyEvents {
+		return
+	}
+	ps.arrive(at)
+	ps.keyEvents = append(ps.keyEvents, k)
+}
+
+// takeKeys returns the queued keyboard events in their order
+// and presses (releases) their keys for the core.
+func (ps *playerSession) takeKeys() (events []KeyboardEvent) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	events, ps.keyEvents = ps.keyEvents, nil
+	for _, k := range events {
+		ps.keys[k.Key] = k.Down
+	}
+	return
+}
+
+// pollMice makes the accumulated motion of the mice the motion of the next frame,
+// the core reads it as many times as it wants during the frame.
+func (ps *playerSession) pollMice() {
+	ps.Lock()
+	defer ps.Unlock()
+
+	for i := range ps.mice {
+		m := &ps.mice[i]
+		m.frameDX, m.frameDY = clampInt16(m.dx), clampInt16(m.dy)
+		m.dx, m.dy = 0, 0
+	}
+}
+
+func clampInt16(v int32) int16 {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// takeArrival returns the arrival time of the first input
+// since the last call, zero if there were no inputs.
+func (ps *playerSession) takeArrival() (at time.Time) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	at, ps.arrived = ps.arrived, time.Time{}
+	return
+}
+
 // isKeyPressed checks if some button is pressed by any player.
 func (p *Players) isKeyPressed(player uint, key int) (pressed bool) {
 	p.session.RLock()
@@ -74,6 +198,40 @@ func (p *Players) isKeyPressed(player uint, key int) (pressed bool) {
 	return
 }
 
+// mouse returns the motion of the mouse of the player in the current frame
+// and its pressed buttons.
+func (p *Players) mouse(player uint) (dx, dy int16, buttons uint16) {
+	if player >= controllersNum {
+		return
+	}
+	p.session.RLock()
+	defer p.session.RUnlock()
+
+	m := p.session.mice[player]
+	return m.frameDX, m.frameDY, m.buttons
+}
+
+// pointer returns the pointer of the player.
+func (p *Players) pointer(player uint) PointerEvent {
+	if player >= controllersNum {
+		return PointerEvent{}
+	}
+	p.session.RLock()
+	defer p.session.RUnlock()
+
+	return p.session.pointers[player]
+}
+
+// isKeyDown checks if the keyboard key is pressed.
+func (p *Players) isKeyDown(key uint) bool {
+	if key >= keysNum {
+		return false
+	}
+	p.session.RLock()
+	defer p.session.RUnlock()
+	return p.session.keys[key]
+}
+
 // isDpadTouched checks if D-pad is used by any player.
 func (p *Players) isDpadTouched(player uint, axis uint) (shift int16) {
 	p.session.RLock()
@@ -88,10 +246,121 @@ func (p *Players) isDpadTouched(player uint, axis uint) (shift int16) {
 	return
 }
 
+// inputTiming is the arrival time of an input
+// and how long it has waited for the core.
+type inputTiming struct {
+	arrived time.Time
+	wait    time.Duration
+}
+
+// takeInput registers the inputs taken by the core for the next frame.
+// The first input is kept until a video frame is sent with it,
+// so the frames without the video don't lose it.
+func (na *naEmulator) takeInput() {
+	na.players.session.pollMice()
+	keyboardEvents(na.players.session.takeKeys())
+	at := na.players.session.takeArrival()
+	if at.IsZero() || !na.input.arrived.IsZero() {
+		return
+	}
+	c := na.clock
+	if c == nil {
+		c = systemClock{}
+	}
+	na.input = inputTiming{arrived: at, wait: c.Now().Sub(at)}
+}
+
+// InputKind is the device of the input event.
+type InputKind uint8
+
+const (
+	// InputPad is the joypad state (buttons and axes) of the raw state
+	InputPad InputKind = iota
+	// InputMouse is the relative motion of the mouse
+	InputMouse
+	// InputPointer is the absolute position of the pointer (touch screen, lightgun)
+	InputPointer
+	// InputKeyboard is the key press or release of the keyboard (the computer cores)
+	InputKeyboard
+)
+
+// The buttons of the mouse events, the same as of the browsers.
+const (
+	MouseLeft = 1 << iota
+	MouseRight
+	MouseMiddle
+)
+
+// MouseEvent is the motion of the mouse in the pixels of the core
+// since the previous event with its pressed buttons.
+type MouseEvent struct {
+	DX, DY  int16
+	Buttons uint16
+}
+
+// PointerOffscreen is the coordinate of the pointer outside the screen.
+const PointerOffscreen = -0x8000
+
+// PointerEvent is the position of the pointer on the screen of the core
+// from -0x7fff (left, top) to 0x7fff (right, bottom).
+type PointerEvent struct {
+	X, Y    int16
+	Pressed bool
+}
+
+// KeyboardEvent is the key press or release of the keyboard
+// with the retro_key (RETROK_*) code of the key,
+// the UTF-32 character of the key (0 -- none) and
+// the pressed modifier keys (RETROKMOD_* bits).
+type KeyboardEvent struct {
+	Down bool
+	Key  uint16
+	Char uint32
+	Mods uint16
+}
+
 type InputEvent struct {
+	// Kind is the device of the event, the joypad by default
+	Kind      InputKind
 	RawState  []byte
+	Mouse     MouseEvent
+	Pointer   PointerEvent
+	Keyboard  KeyboardEvent
 	PlayerIdx int
 	ConnID    string
+	// the time when the event has been received, zero if unknown
+	Time time.Time
 }
 
 func (ie InputEvent) bitmap() uint16 { return uint16(ie.RawState[1])<<8 + uint16(ie.RawState[0]) }
+
+// axes returns the analog sticks of the joypad state, the left (x, y) and
+// the right one (x, y), after the buttons as int16 LE.
+// The missing axes are centered (the digital-only joypads).
+func (ie InputEvent) axes() (axes [dpadAxesNum]int16) {
+	for i := 0; i < dpadAxesNum && (i+1)*2+1 < len(ie.RawState); i++ {
+		axis := (i + 1) * 2
+		axes[i] = int16(ie.RawState[axis+1])<<8 + int16(ie.RawState[axis])
+	}
+	return
+}
+
+// applyDeadzone centers the sticks within the deadzone (0-1 of their range)
+// and stretches the rest of the range, so the sticks start to move from zero.
+// The deadzone is radial, the stick directions stay the same.
+func applyDeadzone(axes [dpadAxesNum]int16, deadzone float64) [dpadAxesNum]int16 {
+	if deadzone <= 0 || deadzone >= 1 {
+		return axes
+	}
+	for i := 0; i+1 < dpadAxesNum; i += 2 {
+		x, y := float64(axes[i])/math.MaxInt16, float64(axes[i+1])/math.MaxInt16
+		m := math.Hypot(x, y)
+		if m <= deadzone {
+			axes[i], axes[i+1] = 0, 0
+			continue
+		}
+		k := (m - deadzone) / (1 - deadzone) / m
+		axes[i], axes[i+1] = clampInt16(int32(math.Round(x*k*math.MaxInt16))), clampInt16(int32(math.Round(y*k*math.MaxInt16)))
+	}
+	return axes
+}
@@ -0,0 +1,49 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import "testing"
+
+func TestAnalogInput(t *testing.T) {
+	defer func(na *naEmulator) { NAEmulator = na }(NAEmulator)
+	na := &naEmulator{players: NewPlayerSessionInput(), clock: &fakeClock{}, deadzone: 0.1}
+	NAEmulator = na
+	core := stubCore{}
+
+	const deviceAnalog, left, right, x, y = 5, 0, 1, 0, 1
+	na.handleInput(InputEvent{PlayerIdx: 0, ConnID: "a", RawState: []byte{1, 0, 0xff, 0x7f, 0x00, 0x80}})
+	na.handleInput(InputEvent{PlayerIdx: 1, ConnID: "b", RawState: []byte{0, 0, 0, 0, 0, 0, 0x00, 0xc0, 0x00, 0x40}})
+	// noise in the deadzone
+	na.handleInput(InputEvent{PlayerIdx: 2, ConnID: "c", RawState: []byte{0, 0, 0x00, 0x01, 0x00, 0xff}})
+
+	if lx, ly := core.input(0, deviceAnalog, left, x), core.input(0, deviceAnalog, left, y); lx != 32767 || ly != -32768 {
+		t.Errorf("wrong left stick of player 1 (%v, %v)", lx, ly)
+	}
+	if rx := core.input(0, deviceAnalog, right, x); rx != 0 {
+		t.Errorf("wrong right stick of player 1 %v", rx)
+	}
+	if lx := core.input(1, deviceAnalog, left, x); lx != 0 {
+		t.Errorf("wrong left stick of player 2 %v", lx)
+	}
+	if rx, ry := core.input(1, deviceAnalog, right, x), core.input(1, deviceAnalog, right, y); rx >= 0 || ry <= 0 || rx != -ry {
+		t.Errorf("wrong right stick of player 2 (%v, %v)", rx, ry)
+	}
+	if lx, ly := core.input(2, deviceAnalog, left, x), core.input(2, deviceAnalog, left, y); lx != 0 || ly != 0 {
+		t.Errorf("the deadzone of player 3 is not applied (%v, %v)", lx, ly)
+	}
+
+	// the analog buttons (RETRO_DEVICE_ID_JOYPAD_A)
+	if a := core.input(0, deviceAnalog, analogButtonIndex, 8); a != 32767 {
+		t.Errorf("wrong analog A button of player 1 %v", a)
+	}
+	if a := core.input(1, deviceAnalog, analogButtonIndex, 8); a != 0 {
+		t.Errorf("wrong analog A button of player 2 %v", a)
+	}
+
+	// the digital-only joypad centers the sticks again
+	na.handleInput(InputEvent{PlayerIdx: 0, ConnID: "a", RawState: []byte{0, 0}})
+	if lx := core.input(0, deviceAnalog, left, x); lx != 0 {
+		t.Errorf("the left stick of player 1 is not centered %v", lx)
+	}
+}
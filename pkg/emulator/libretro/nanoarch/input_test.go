@@ -3,6 +3,7 @@ package nanoarch
 import (
 	"math/rand"
 	"testing"
+	"time"
 )
 
 func TestConcurrentInput(t *testing.T) {
@@ -13,7 +14,7 @@ func TestConcurrentInput(t *testing.T) {
 	go func() {
 		for i := 0; i < events*2; i++ {
 			player := rand.Intn(controllersNum)
-			go players.session.setInput(session, player, 100, []byte{})
+			go players.session.setInput(session, player, 100, [dpadAxesNum]int16{}, time.Time{})
 			// here it usually crashes
 			go players.session.close(session)
 		}
@@ -25,3 +26,78 @@ func TestConcurrentInput(t *testing.T) {
 		}
 	}()
 }
+
+func TestInputArrival(t *testing.T) {
+	players := NewPlayerSessionInput()
+	if at := players.session.takeArrival(); !at.IsZero() {
+		t.Errorf("an arrival %v without inputs", at)
+	}
+
+	first := time.Unix(10, 0)
+	players.session.setInput("a", 0, 1, [dpadAxesNum]int16{}, first.Add(time.Millisecond))
+	players.session.setInput("b", 1, 1, [dpadAxesNum]int16{}, first)
+	players.session.setInput("a", 0, 0, [dpadAxesNum]int16{}, time.Time{})
+	if at := players.session.takeArrival(); !at.Equal(first) {
+		t.Errorf("wrong arrival %v, expected %v", at, first)
+	}
+	if at := players.session.takeArrival(); !at.IsZero() {
+		t.Errorf("the arrival %v is taken twice", at)
+	}
+}
+
+func TestInputTiming(t *testing.T) {
+	now := time.Unix(10, 0)
+	na := naEmulator{players: NewPlayerSessionInput(), clock: &fakeClock{now: now}}
+
+	na.players.session.setInput("a", 0, 1, [dpadAxesNum]int16{}, now.Add(-20*time.Millisecond))
+	na.takeInput()
+	// the frames without the video keep the first input
+	na.players.session.setInput("a", 0, 0, [dpadAxesNum]int16{}, now.Add(-5*time.Millisecond))
+	na.takeInput()
+	arrived, wait := na.input.arrived, na.input.wait
+	if !arrived.Equal(now.Add(-20*time.Millisecond)) || wait != 20*time.Millisecond {
+		t.Errorf("wrong input timing %v, %v", arrived, wait)
+	}
+}
+
+func TestAnalogAxes(t *testing.T) {
+	tests := []struct {
+		raw  []byte
+		axes [dpadAxesNum]int16
+	}{
+		// the digital-only joypads
+		{raw: []byte{1, 0}},
+		{raw: []byte{1, 0, 0xff}},
+		{raw: []byte{0, 0, 0x00, 0x80, 0xff, 0x7f}, axes: [dpadAxesNum]int16{-32768, 32767}},
+		{
+			raw:  []byte{0, 0, 0xff, 0xff, 0x01, 0x00, 0x00, 0x80, 0xff, 0x7f},
+			axes: [dpadAxesNum]int16{-1, 1, -32768, 32767},
+		},
+	}
+	for _, test := range tests {
+		if axes := (InputEvent{RawState: test.raw}).axes(); axes != test.axes {
+			t.Errorf("wrong axes %v of %v, expected %v", axes, test.raw, test.axes)
+		}
+	}
+}
+
+func TestDeadzone(t *testing.T) {
+	tests := []struct {
+		deadzone float64
+		axes     [dpadAxesNum]int16
+		expected [dpadAxesNum]int16
+	}{
+		{deadzone: 0, axes: [dpadAxesNum]int16{100, -100, 3, 4}, expected: [dpadAxesNum]int16{100, -100, 3, 4}},
+		{deadzone: 1, axes: [dpadAxesNum]int16{100, -100}, expected: [dpadAxesNum]int16{100, -100}},
+		{deadzone: 0.25, axes: [dpadAxesNum]int16{8000, 1000, 0, -8191}, expected: [dpadAxesNum]int16{0, 0, 0, 0}},
+		{deadzone: 0.25, axes: [dpadAxesNum]int16{32767, 0, 0, -32768}, expected: [dpadAxesNum]int16{32767, 0, 0, -32768}},
+		{deadzone: 0.5, axes: [dpadAxesNum]int16{-24575, 0, 0, 24575}, expected: [dpadAxesNum]int16{-16383, 0, 0, 16383}},
+		// the stick corners are out of the circle
+		{deadzone: 0.5, axes: [dpadAxesNum]int16{32767, 32767}, expected: [dpadAxesNum]int16{32767, 32767}},
+	}
+	for _, test := range tests {
+		if axes := applyDeadzone(test.axes, test.deadzone); axes != test.expected {
+			t.Errorf("wrong axes %v with the deadzone %v, expected %v", axes, test.deadzone, test.expected)
+		}
+	}
+}
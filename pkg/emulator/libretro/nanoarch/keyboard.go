@@ -0,0 +1,37 @@
+package nanoarch
+
+/*
+#include "libretro.h"
+
+void bridge_retro_keyboard_callback(void *f, bool down, unsigned keycode, uint32_t character, uint16_t key_modifiers);
+*/
+import "C"
+import "unsafe"
+
+// !global emulator lib state
+// the keyboard callback of the core, nil if the core only reads
+// the keyboard state (RETRO_DEVICE_KEYBOARD) or doesn't use the keyboard
+var keyboardCallback unsafe.Pointer
+
+// setKeyboardCallback keeps the keyboard callback of the core
+// (RETRO_ENVIRONMENT_SET_KEYBOARD_CALLBACK).
+func setKeyboardCallback(data unsafe.Pointer) {
+	keyboardCallback = unsafe.Pointer((*C.struct_retro_keyboard_callback)(data).callback)
+}
+
+// keyboardEvents passes the keyboard events to the core in their order,
+// should be called on the emulator thread before the core runs a frame.
+func keyboardEvents(events []KeyboardEvent) {
+	if keyboardCallback == nil {
+		return
+	}
+	for _, k := range events {
+		C.bridge_retro_keyboard_callback(keyboardCallback, C.bool(k.Down), C.unsigned(k.Key), C.uint32_t(k.Char), C.uint16_t(k.Mods))
+	}
+}
+
+// keyboardInput returns the state of the keyboard key
+// (RETRO_DEVICE_KEYBOARD) for the core, the keyboard is shared by all the ports.
+func keyboardInput(id C.unsigned) C.int16_t {
+	return pressed(NAEmulator.players.isKeyDown(uint(id)))
+}
@@ -0,0 +1,54 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import "testing"
+
+func TestKeyboardEvents(t *testing.T) {
+	defer func(na *naEmulator) { NAEmulator, keyboardCallback = na, nil }(NAEmulator)
+	na := &naEmulator{players: NewPlayerSessionInput(), clock: &fakeClock{}}
+	NAEmulator = na
+	core := stubCore{}
+	if !core.loadKeyboard() {
+		t.Fatalf("the keyboard callback is not accepted")
+	}
+
+	// the rapid key sequence of one frame, Shift+A after A
+	for _, k := range []KeyboardEvent{
+		{Down: true, Key: keyA, Char: 'a'},
+		{Down: false, Key: keyA},
+		{Down: true, Key: keyLShift, Mods: modShift},
+		{Down: true, Key: keyA, Char: 'A', Mods: modShift},
+		{Down: false, Key: keyA, Mods: modShift},
+		{Down: true, Key: keyB, Char: 'B', Mods: modShift},
+		// the unknown key
+		{Down: true, Key: keysNum},
+	} {
+		na.handleInput(InputEvent{Kind: InputKeyboard, Keyboard: k})
+	}
+	if log := core.keyboardLog(); log != "" || core.input(0, deviceKeyboard, 0, keyB) != 0 {
+		t.Fatalf("the keys are passed to the core before the frame, %q", log)
+	}
+
+	na.takeInput()
+	expected := "down 97 97 0;up 97 0 0;down 304 0 1;down 97 65 1;up 97 0 1;down 98 66 1;"
+	if log := core.keyboardLog(); log != expected {
+		t.Errorf("wrong keyboard callback calls %q, expected %q", log, expected)
+	}
+	for key, down := range map[uint]bool{keyA: false, keyB: true, keyLShift: true} {
+		// the keyboard is the same for all the ports
+		for port := uint(0); port < 2; port++ {
+			if is := core.input(port, deviceKeyboard, 0, key) == 1; is != down {
+				t.Errorf("the key %v of the port %v is pressed: %v, expected %v", key, port, is, down)
+			}
+		}
+	}
+
+	// the events are passed once
+	na.handleInput(InputEvent{Kind: InputKeyboard, Keyboard: KeyboardEvent{Key: keyB}})
+	na.takeInput()
+	if log := core.keyboardLog(); log != expected+"up 98 0 0;" || core.input(0, deviceKeyboard, 0, keyB) != 0 {
+		t.Errorf("wrong keyboard callback calls %q", log)
+	}
+}
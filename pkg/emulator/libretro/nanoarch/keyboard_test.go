@@ -0,0 +1,27 @@
+package nanoarch
+
+import (
+	"testing"
+	"time"
+)
+
+// the libretro keyboard device with its keys and modifiers
+const (
+	deviceKeyboard = 3
+
+	keyA, keyB, keyLShift = 97, 98, 304
+	modShift              = 0x01
+)
+
+func TestKeyboardFlood(t *testing.T) {
+	players := NewPlayerSessionInput()
+	for i := 0; i < maxKeyEvents*2; i++ {
+		players.session.pressKey(KeyboardEvent{Down: i%2 == 0, Key: keyA}, time.Time{})
+	}
+	if events := players.session.takeKeys(); len(events) != maxKeyEvents {
+		t.Errorf("wrong number of the keyboard events %v, expected %v", len(events), maxKeyEvents)
+	}
+	if events := players.session.takeKeys(); len(events) != 0 {
+		t.Errorf("the keyboard events are taken twice")
+	}
+}
@@ -0,0 +1,22 @@
+package nanoarch
+
+// WatchMemory sets the function called after each frame of the game
+// with the system RAM of the core, nil stops the calls.
+// The function runs on the emulator thread, so it should be quick.
+func (na *naEmulator) WatchMemory(fn func(mem []byte)) {
+	na.Lock()
+	na.memoryWatch = fn
+	na.Unlock()
+}
+
+// watchMemory passes the system RAM of the core to the memory watch,
+// the cores without the system RAM are not watched.
+// Should be called under the emulator lock after the frame.
+func (na *naEmulator) watchMemory() {
+	if na.memoryWatch == nil {
+		return
+	}
+	if mem := ptSystemRAM(); mem != nil {
+		na.memoryWatch((*[1 << 30]byte)(mem.ptr)[:mem.size:mem.size])
+	}
+}
@@ -0,0 +1,40 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWatchMemory(t *testing.T) {
+	core := stubCore{}
+	core.loadSystemRAM(0)
+
+	var calls int
+	var seen []byte
+	na := &naEmulator{}
+	na.WatchMemory(func(mem []byte) {
+		calls++
+		seen = append(seen[:0], mem...)
+	})
+	na.watchMemory()
+	if calls != 0 {
+		t.Errorf("the memory has been watched without the core support")
+	}
+
+	core.loadSystemRAM(32)
+	defer core.loadSystemRAM(0)
+	core.writeSystemRAM(0x10, []byte{1, 2, 3})
+	na.watchMemory()
+	if calls != 1 || len(seen) != 32 || !bytes.Equal(seen[0x10:0x13], []byte{1, 2, 3}) {
+		t.Fatalf("wrong watched memory %v (%v calls)", seen, calls)
+	}
+
+	na.WatchMemory(nil)
+	na.watchMemory()
+	if calls != 1 {
+		t.Errorf("the memory has been watched after the stop")
+	}
+}
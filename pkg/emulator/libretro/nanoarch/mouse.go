@@ -0,0 +1,50 @@
+package nanoarch
+
+/*
+#include "libretro.h"
+*/
+import "C"
+
+// mouseInput returns the state of the mouse of the port
+// (RETRO_DEVICE_MOUSE) for the core.
+func mouseInput(port uint, id C.unsigned) C.int16_t {
+	dx, dy, buttons := NAEmulator.players.mouse(port)
+	switch id {
+	case C.RETRO_DEVICE_ID_MOUSE_X:
+		return C.int16_t(dx)
+	case C.RETRO_DEVICE_ID_MOUSE_Y:
+		return C.int16_t(dy)
+	case C.RETRO_DEVICE_ID_MOUSE_LEFT:
+		return pressed(buttons&MouseLeft != 0)
+	case C.RETRO_DEVICE_ID_MOUSE_RIGHT:
+		return pressed(buttons&MouseRight != 0)
+	case C.RETRO_DEVICE_ID_MOUSE_MIDDLE:
+		return pressed(buttons&MouseMiddle != 0)
+	}
+	return 0
+}
+
+// pointerInput returns the state of the pointer of the port
+// (RETRO_DEVICE_POINTER) for the core, there is only one touch.
+func pointerInput(port uint, index C.unsigned, id C.unsigned) C.int16_t {
+	if index > 0 {
+		return 0
+	}
+	p := NAEmulator.players.pointer(port)
+	switch id {
+	case C.RETRO_DEVICE_ID_POINTER_X:
+		return C.int16_t(p.X)
+	case C.RETRO_DEVICE_ID_POINTER_Y:
+		return C.int16_t(p.Y)
+	case C.RETRO_DEVICE_ID_POINTER_PRESSED:
+		return pressed(p.Pressed)
+	}
+	return 0
+}
+
+func pressed(is bool) C.int16_t {
+	if is {
+		return 1
+	}
+	return 0
+}
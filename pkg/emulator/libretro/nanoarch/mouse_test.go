@@ -0,0 +1,70 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import "testing"
+
+// the libretro devices and their IDs
+const (
+	deviceMouse   = 2
+	devicePointer = 6
+
+	mouseX, mouseY, mouseLeft, mouseRight = 0, 1, 2, 3
+	pointerX, pointerY, pointerPressed    = 0, 1, 2
+)
+
+func TestMouseInput(t *testing.T) {
+	defer func(na *naEmulator) { NAEmulator = na }(NAEmulator)
+	na := &naEmulator{players: NewPlayerSessionInput(), clock: &fakeClock{}}
+	NAEmulator = na
+	core := stubCore{}
+
+	na.handleInput(InputEvent{Kind: InputMouse, PlayerIdx: 1, Mouse: MouseEvent{DX: 3, DY: -2, Buttons: MouseLeft}})
+	na.handleInput(InputEvent{Kind: InputMouse, PlayerIdx: 1, Mouse: MouseEvent{DX: 4, DY: -1, Buttons: MouseLeft | MouseRight}})
+	if dx := core.input(1, deviceMouse, 0, mouseX); dx != 0 {
+		t.Errorf("the mouse has moved %v before the frame", dx)
+	}
+
+	// the core sees the motion of the frame on each read
+	na.takeInput()
+	for i := 0; i < 2; i++ {
+		dx, dy := core.input(1, deviceMouse, 0, mouseX), core.input(1, deviceMouse, 0, mouseY)
+		if dx != 7 || dy != -3 {
+			t.Errorf("wrong mouse motion %v,%v, expected 7,-3", dx, dy)
+		}
+	}
+	if core.input(1, deviceMouse, 0, mouseLeft) != 1 || core.input(1, deviceMouse, 0, mouseRight) != 1 {
+		t.Errorf("the mouse buttons are not pressed")
+	}
+	if core.input(0, deviceMouse, 0, mouseX) != 0 || core.input(0, deviceMouse, 0, mouseLeft) != 0 {
+		t.Errorf("the mouse of another player has moved")
+	}
+
+	// no motion in the next frame, the buttons stay
+	na.takeInput()
+	if dx := core.input(1, deviceMouse, 0, mouseX); dx != 0 || core.input(1, deviceMouse, 0, mouseLeft) != 1 {
+		t.Errorf("wrong mouse of the next frame %v", dx)
+	}
+}
+
+func TestPointerInput(t *testing.T) {
+	defer func(na *naEmulator) { NAEmulator = na }(NAEmulator)
+	na := &naEmulator{players: NewPlayerSessionInput()}
+	NAEmulator = na
+	core := stubCore{}
+
+	na.handleInput(InputEvent{Kind: InputPointer, Pointer: PointerEvent{X: -0x4000, Y: 0x7fff, Pressed: true}})
+	x, y := core.input(0, devicePointer, 0, pointerX), core.input(0, devicePointer, 0, pointerY)
+	if x != -0x4000 || y != 0x7fff || core.input(0, devicePointer, 0, pointerPressed) != 1 {
+		t.Errorf("wrong pointer %v,%v", x, y)
+	}
+	// the second touch
+	if x := core.input(0, devicePointer, 1, pointerX); x != 0 {
+		t.Errorf("wrong second touch %v", x)
+	}
+	na.handleInput(InputEvent{Kind: InputPointer, Pointer: PointerEvent{X: PointerOffscreen, Y: PointerOffscreen}})
+	if x := core.input(0, devicePointer, 0, pointerX); x != PointerOffscreen || core.input(0, devicePointer, 0, pointerPressed) != 0 {
+		t.Errorf("wrong offscreen pointer %v", x)
+	}
+}
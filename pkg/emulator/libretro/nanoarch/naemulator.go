@@ -1,8 +1,6 @@
 package nanoarch
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"image"
 	"log"
@@ -12,6 +10,10 @@ import (
 
 	config "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/frame"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/bios"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
 )
 
 /*
@@ -51,10 +53,14 @@ void coreLog_cgo(enum retro_log_level level, const char *msg);
 import "C"
 
 type naEmulator struct {
+	// the total time of the frames of the core,
+	// should be 64-bit aligned for atomic access
+	runTime int64
+
 	sync.Mutex
 
 	imageChannel  chan<- GameFrame
-	audioChannel  chan<- []int16
+	audioChannel  chan<- GameAudio
 	inputChannel  <-chan InputEvent
 	videoExporter *VideoExporter
 
@@ -67,9 +73,62 @@ type naEmulator struct {
 
 	// out frame size
 	vw, vh int
+	// the part of the frames scaled into the out ones
+	crop viewport.Crop
+	// frames are the buffers of the out frames
+	frames media.FramePool
 
 	players Players
 
+	rewindConf config.Rewind
+	// the last emulator states, nil if rewind is disabled
+	rewind *rewindBuffer
+	// the cheats of the game
+	cheats []emulator.Cheat
+	// paused stops running of the core, guarded by the emulator lock
+	paused bool
+
+	ffConf config.FastForward
+	// the fast-forward state
+	speed speed
+	// the time source of the frame pacing, the system one if nil
+	clock clock
+	// the timestamps of the video frames and audio batches
+	mediaClock *media.Clock
+	// skipVideo drops the video of the late frames, guarded by the emulator lock
+	skipVideo bool
+	// the deadzone (0-1) of the analog sticks
+	deadzone float64
+	// the first input taken by the core since the last sent video frame,
+	// guarded by the emulator lock
+	input inputTiming
+	// the last written or restored game save RAM
+	sram state
+	// an interval between the save RAM writes, 0 -- disabled
+	sramFlush time.Duration
+	// the extracted games of the archives
+	romCache emulator.RomCache
+	// the file of the game loaded by the core, i.e. the one of the rom cache
+	romFile string
+	// the changes of the rumble of the controllers set by the core
+	// and the current rumble of the ports (strong, weak),
+	// the core sets it on the emulator thread
+	rumbleChannel chan emulator.Rumble
+	rumble        [controllersNum][2]uint16
+	// the resolution of the game frames of the core
+	geometry geometry
+	// the watch of the system RAM after the frames, guarded by the emulator lock
+	memoryWatch func(mem []byte)
+	// the number of the frames of the game and their hook,
+	// guarded by the emulator lock
+	frameCount uint64
+	frameHook  func(frame uint64)
+	// the system directory with the BIOS files of the core
+	// and their private download
+	systemDir    string
+	bios         []config.BiosFile
+	biosDownload config.BiosDownload
+
 	done chan struct{}
 }
 
@@ -83,36 +142,77 @@ type VideoExporter struct {
 type GameFrame struct {
 	Data     *image.RGBA
 	Duration time.Duration
+	// Buf is the pooled buffer of the image (may be nil),
+	// the receiver should release it after use
+	Buf *media.Frame
+	// Input is the arrival time of the first input shown in the frame,
+	// zero if there were no inputs since the previous frame
+	Input time.Time
+	// InputWait is how long that input has waited for the core
+	InputWait time.Duration
+	// Geometry is the new resolution of the game since this frame,
+	// nil if it hasn't changed
+	Geometry *emulator.Geometry
+	// Timestamp is the media time of the frame since the game start
+	Timestamp time.Duration
+	// Format is the pixel format of the core (image.BitFormat*)
+	// the frame has been converted from
+	Format int
+}
+
+// GameAudio contains the audio samples of the game (stereo).
+type GameAudio struct {
+	Samples []int16
+	// Timestamp is the media time of the first samples since the game start,
+	// the same clock as the one of the video frames
+	Timestamp time.Duration
 }
 
 var NAEmulator *naEmulator
 
 // NAEmulator implements CloudEmulator interface based on NanoArch(golang RetroArch)
-func NewNAEmulator(roomID string, inputChannel <-chan InputEvent, storage Storage, conf config.LibretroCoreConfig) (*naEmulator, chan GameFrame, chan []int16) {
+func NewNAEmulator(roomID string, inputChannel <-chan InputEvent, storage Storage, conf config.LibretroCoreConfig) (*naEmulator, chan GameFrame, chan GameAudio) {
 	imageChannel := make(chan GameFrame, 30)
-	audioChannel := make(chan []int16, 30)
+	audioChannel := make(chan GameAudio, 30)
+	rumbleChannel := make(chan emulator.Rumble, 32)
 
 	return &naEmulator{
 		meta: emulator.Metadata{
 			LibPath:       conf.Lib,
 			ConfigPath:    conf.Config,
+			CoreOptions:   conf.CoreOptions,
+			Audio:         conf.Audio,
 			Ratio:         conf.Ratio,
 			IsGlAllowed:   conf.IsGlAllowed,
 			UsesLibCo:     conf.UsesLibCo,
 			HasMultitap:   conf.HasMultitap,
+			Devices:       conf.Devices,
+			Region:        conf.Region,
+			RegionOption:  conf.RegionOption,
 			AutoGlContext: conf.AutoGlContext,
 		},
-		storage:      storage,
-		imageChannel: imageChannel,
-		audioChannel: audioChannel,
-		inputChannel: inputChannel,
-		players:      NewPlayerSessionInput(),
-		roomID:       roomID,
-		done:         make(chan struct{}, 1),
+		storage:       storage,
+		imageChannel:  imageChannel,
+		audioChannel:  audioChannel,
+		inputChannel:  inputChannel,
+		rumbleChannel: rumbleChannel,
+		players:       NewPlayerSessionInput(),
+		roomID:        roomID,
+		rewindConf:    conf.Rewind,
+		ffConf:        conf.FastForward,
+		deadzone:      conf.Input.Deadzone,
+		sramFlush:     time.Duration(conf.SRAMFlushInterval) * time.Second,
+		romCache:      emulator.RomCache{Dir: conf.RomCache.Path, MaxSize: int64(conf.RomCache.MaxSize) << 20},
+		systemDir:     conf.System,
+		bios:          conf.Bios,
+		biosDownload:  conf.BiosDownload,
+		done:          make(chan struct{}, 1),
 	}, imageChannel, audioChannel
 }
 
-// NewVideoExporter creates new video Exporter that produces to unix socket
+// NewVideoExporter creates new video Exporter that produces to unix socket.
+// Without the socket the frames are dropped,
+// the room sees no frames and restarts the emulator.
 func NewVideoExporter(roomID string, imgChannel chan GameFrame) *VideoExporter {
 	sockAddr := fmt.Sprintf("/tmp/cloudretro-retro-%s.sock", roomID)
 
@@ -120,19 +220,20 @@ func NewVideoExporter(roomID string, imgChannel chan GameFrame) *VideoExporter {
 		log.Println("Dialing to ", sockAddr)
 		conn, err := net.Dial("unix", sockAddr)
 		if err != nil {
-			log.Fatal("accept error: ", err)
+			log.Printf("error: couldn't export the video frames, %v", err)
+			for img := range imgChannel {
+				img.Buf.Release()
+			}
+			return
 		}
 
 		defer conn.Close()
 
 		for img := range imgChannel {
-			reqBodyBytes := new(bytes.Buffer)
-			gob.NewEncoder(reqBodyBytes).Encode(img)
-			//fmt.Printf("%+v %+v %+v \n", img.Image.Stride, img.Image.Rect.Max.X, len(img.Image.Pix))
-			// conn.Write(img.Image.Pix)
-			b := reqBodyBytes.Bytes()
-			fmt.Printf("Bytes %d\n", len(b))
-			conn.Write(b)
+			if err := frame.Write(conn, img.Data, img.Duration); err != nil {
+				log.Printf("error: couldn't export a video frame, %v", err)
+			}
+			img.Buf.Release()
 		}
 	}(sockAddr)
 
@@ -141,7 +242,7 @@ func NewVideoExporter(roomID string, imgChannel chan GameFrame) *VideoExporter {
 
 // Init initialize new RetroArch cloud emulator
 // withImageChan returns an image stream as Channel for output else it will write to unix socket
-func Init(roomID string, withImageChannel bool, inputChannel <-chan InputEvent, storage Storage, config config.LibretroCoreConfig) (*naEmulator, chan GameFrame, chan []int16) {
+func Init(roomID string, withImageChannel bool, inputChannel <-chan InputEvent, storage Storage, config config.LibretroCoreConfig) (*naEmulator, chan GameFrame, chan GameAudio) {
 	emu, imageChannel, audioChannel := NewNAEmulator(roomID, inputChannel, storage, config)
 	// Set to global NAEmulator
 	NAEmulator = emu
@@ -154,58 +255,154 @@ func Init(roomID string, withImageChannel bool, inputChannel <-chan InputEvent,
 	return emu, imageChannel, audioChannel
 }
 
-// listenInput handles user input.
+// listenInput handles user input until the emulator is closed.
 // The user input is encoded as bitmap that we decode
 // and send into the game emulator.
 func (na *naEmulator) listenInput() {
-	for in := range NAEmulator.inputChannel {
+	for {
+		select {
+		case in, ok := <-na.inputChannel:
+			if !ok {
+				return
+			}
+			na.handleInput(in)
+		case <-na.done:
+			return
+		}
+	}
+}
+
+// handleInput routes the input event to the device of the player.
+func (na *naEmulator) handleInput(in InputEvent) {
+	switch in.Kind {
+	case InputMouse:
+		na.players.session.moveMouse(in.PlayerIdx, in.Mouse, in.Time)
+	case InputPointer:
+		na.players.session.setPointer(in.PlayerIdx, in.Pointer, in.Time)
+	case InputKeyboard:
+		na.players.session.pressKey(in.Keyboard, in.Time)
+	default:
+		if len(in.RawState) < 2 {
+			return
+		}
 		bitmap := in.bitmap()
 		if bitmap == InputTerminate {
 			na.players.session.close(in.ConnID)
-			continue
+			return
 		}
-		na.players.session.setInput(in.ConnID, in.PlayerIdx, bitmap, in.RawState)
+		na.players.session.setInput(in.ConnID, in.PlayerIdx, bitmap, applyDeadzone(in.axes(), na.deadzone), in.Time)
 	}
 }
 
-func (na *naEmulator) LoadMeta(path string) emulator.Metadata {
-	coreLoad(na.meta)
-	coreLoadGame(path)
+func (na *naEmulator) LoadMeta(path string) (emulator.Metadata, error) {
+	// the cores may ask for the system directory in retro_init
+	setSystemDirectory(na.systemDirectory())
+	if err := coreLoad(na.meta); err != nil {
+		na.release()
+		return emulator.Metadata{}, err
+	}
+	if err := na.checkBios(); err != nil {
+		coreUnload()
+		na.release()
+		return emulator.Metadata{}, err
+	}
+	game, discs := loadDiscs(path)
+	if err := coreLoadGame(game, na.romCache); err != nil {
+		coreUnload()
+		na.release()
+		return emulator.Metadata{}, err
+	}
+	plugDevices(na.meta.Devices)
+	if len(discs) > 1 {
+		if err := addDiscs(discs[1:]); err != nil {
+			log.Printf("warn: only the first disc of %v is available, %v", path, err)
+		}
+	}
 	na.gamePath = path
-	return na.meta
+	return na.meta, nil
+}
+
+// checkBios checks the BIOS files of the core in the system directory,
+// the cores without the required files don't load the games.
+func (na *naEmulator) checkBios() error {
+	dir := na.systemDirectory()
+	name := coreLibraryName()
+	return bios.Check(name, dir, bios.Files(name, na.bios), na.biosDownload)
+}
+
+// systemDirectory returns the system directory (BIOS) of the core.
+func (na *naEmulator) systemDirectory() string {
+	if na.systemDir == "" {
+		return bios.DefaultDir
+	}
+	return na.systemDir
+}
+
+// release closes the media of the emulator which won't start,
+// so their readers (i.e. the video exporter) are done.
+func (na *naEmulator) release() {
+	close(na.imageChannel)
+	close(na.audioChannel)
 }
 
 func (na *naEmulator) SetViewport(width int, height int) { na.vw, na.vh = width, height }
 
+func (na *naEmulator) SetCrop(crop viewport.Crop) { na.crop = crop }
+
 func (na *naEmulator) Start() {
 	err := na.LoadGame()
 	if err != nil {
 		log.Printf("error: couldn't load a save, %v", err)
 	}
+	na.initRewind()
+	if na.roomID != "" && na.sramFlush > 0 {
+		go na.startSRAMFlush(na.sramFlush)
+	}
 
 	framerate := 1 / na.meta.Fps
-	log.Printf("framerate: %vms", framerate)
-	ticker := time.NewTicker(time.Second / time.Duration(na.meta.Fps))
-	defer ticker.Stop()
+	log.Printf("framerate: %vms (%v), %v audio frames per frame", framerate, na.meta.Region,
+		na.meta.AudioSampleRate/na.meta.Fps)
 
 	lastFrameTime = time.Now()
+	na.mediaClock = media.NewClock(na.meta.Fps, na.meta.AudioSampleRate)
 
-	for {
-		na.Lock()
+	na.run(na.meta.Fps, func() {
+		na.takeInput()
 		nanoarchRun()
-		na.Unlock()
+		na.watchMemory()
+		na.snapshot()
+		na.endFrame()
+	})
 
-		select {
-		case <-ticker.C:
-			continue
-		case <-na.done:
-			nanoarchShutdown()
-			close(na.imageChannel)
-			close(na.audioChannel)
-			log.Println("Closed Director")
-			return
-		}
+	if na.roomID != "" {
+		na.flushSRAM()
 	}
+	nanoarchShutdown()
+	na.romCache.Release(na.romFile)
+	close(na.imageChannel)
+	close(na.audioChannel)
+	log.Println("Closed Director")
+}
+
+// Pause stops running of the game until Resume.
+// No frames or audio are produced after the call.
+func (na *naEmulator) Pause() {
+	na.Lock()
+	na.paused = true
+	na.Unlock()
+}
+
+// Resume continues the paused game.
+func (na *naEmulator) Resume() {
+	na.Lock()
+	if na.paused {
+		na.paused = false
+		// don't count the pause in the duration of the next frame
+		fmu.Lock()
+		lastFrameTime = time.Now()
+		fmu.Unlock()
+	}
+	na.Unlock()
 }
 
 func (na *naEmulator) SaveGame() error {
@@ -225,17 +422,103 @@ func (na *naEmulator) LoadGame() error {
 	return nil
 }
 
-func (na *naEmulator) ToggleMultitap() error {
+func (na *naEmulator) SaveGameSlot(slot int) error {
+	if na.roomID != "" {
+		return na.SaveSlot(slot)
+	}
+	return nil
+}
+
+func (na *naEmulator) LoadGameSlot(slot int) error {
 	if na.roomID != "" {
-		toggleMultitap()
+		return na.LoadSlot(slot)
 	}
 	return nil
 }
 
+// Rewind restores the state of the game some number of frames back.
+func (na *naEmulator) Rewind(frames int) error {
+	na.Lock()
+	defer na.Unlock()
+
+	if na.rewind == nil {
+		return errNoRewind
+	}
+	st, err := na.rewind.rewind(frames)
+	if err != nil {
+		return err
+	}
+	if err := restoreSaveState(st); err != nil {
+		return err
+	}
+	na.reapplyCheats()
+	return nil
+}
+
+// initRewind enables the rewind buffer if the core allows it.
+func (na *naEmulator) initRewind() {
+	if na.rewindConf.Seconds <= 0 {
+		return
+	}
+	size := saveStateSize()
+	if size == 0 {
+		log.Printf("warn: rewind is disabled, the core doesn't support save states")
+		return
+	}
+	if max := na.rewindConf.MaxStateSize; max > 0 && size > uint(max) {
+		log.Printf("warn: rewind is disabled, the core state size %v exceeds %v", size, max)
+		return
+	}
+	frames := int(float64(na.rewindConf.Seconds) * na.meta.Fps)
+	na.rewind = newRewindBuffer(frames)
+	log.Printf("Rewind is enabled for %v frames", frames)
+}
+
+// snapshot stages the copy of the current state of the game for the rewind buffer,
+// see commitSnapshot.
+// Should be called under the emulator lock.
+func (na *naEmulator) snapshot() {
+	if na.rewind == nil {
+		return
+	}
+	st, err := getSaveState()
+	if err != nil {
+		log.Printf("warn: rewind is disabled, %v", err)
+		na.rewind = nil
+		return
+	}
+	na.rewind.stage(st)
+}
+
+// commitSnapshot compresses the staged state into the rewind buffer
+// outside the emulator lock.
+func (na *naEmulator) commitSnapshot() {
+	na.Lock()
+	rewind := na.rewind
+	na.Unlock()
+	if rewind == nil {
+		return
+	}
+	if err := rewind.commit(); err != nil {
+		log.Printf("warn: rewind is disabled, %v", err)
+		na.Lock()
+		if na.rewind == rewind {
+			na.rewind = nil
+		}
+		na.Unlock()
+	}
+}
+
 func (na *naEmulator) GetHashPath() string { return na.storage.GetSavePath() }
 
 func (na *naEmulator) GetSRAMPath() string { return na.storage.GetSRAMPath() }
 
+func (na *naEmulator) GetOptionsPath() string { return na.storage.GetOptionsPath() }
+
+func (na *naEmulator) GetSlotPath(slot int) string { return na.storage.GetSlotPath(slot) }
+
+func (na *naEmulator) GetSlots() []int { return na.storage.GetSlots() }
+
 func (na *naEmulator) Close() {
 	close(na.done)
 }
@@ -1,11 +1,12 @@
 package nanoarch
 
 import (
-	"bufio"
+	"fmt"
 	"log"
-	"os"
+	"math"
 	"os/user"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -13,6 +14,7 @@ import (
 	"github.com/giongto35/cloud-game/v2/pkg/emulator"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator/graphics"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator/image"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/bios"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/core"
 	"github.com/giongto35/cloud-game/v2/pkg/thread"
 )
@@ -76,8 +78,8 @@ var video struct {
 	autoGlContext bool
 }
 
-// default core pix format converter
-var pixelFormatConverterFn = image.Rgb565
+// the converter of the pixel format of the core (see setPixelFormat)
+var pixelFormatConverterFn image.Row = image.Rgb1555Row
 var rotationFn = image.GetRotation(image.Angle(0))
 
 //const joypadNumKeys = int(C.RETRO_DEVICE_ID_JOYPAD_R3 + 1)
@@ -85,15 +87,19 @@ var rotationFn = image.GetRotation(image.Angle(0))
 
 var isGlAllowed bool
 var usesLibCo bool
-var coreConfig ConfigProperties
+var coreConfig = ConfigProperties{}
 
-var multitap struct {
-	supported bool
-	enabled   bool
-	value     C.unsigned
-}
+// analogButtonIndex is RETRO_DEVICE_INDEX_ANALOG_BUTTON of the newer libretro.h,
+// the cores read the analog value of the joypad buttons with it.
+const analogButtonIndex = 2
+
+// hasMultitap enables the multitap toggle of the core
+var hasMultitap bool
+
+var systemDirectory = C.CString(bios.DefaultDir)
 
-var systemDirectory = C.CString("./pkg/emulator/libretro/system")
+// systemDirectories are the paths of the system directories of the cores by the directories.
+var systemDirectories = map[string]*C.char{bios.DefaultDir: systemDirectory}
 var saveDirectory = C.CString(".")
 var currentUser *C.char
 
@@ -127,6 +133,15 @@ type CloudEmulator interface {
 
 //export coreVideoRefresh
 func coreVideoRefresh(data unsafe.Pointer, width C.unsigned, height C.unsigned, pitch C.size_t) {
+	// keep the normal frame rate while fast-forwarding
+	if !NAEmulator.keepFrame() {
+		return
+	}
+	// the late frames don't render to catch up with the game frame rate
+	if NAEmulator.skipVideo {
+		return
+	}
+
 	t := time.Now()
 	fmu.Lock()
 	dt := t.Sub(lastFrameTime)
@@ -139,6 +154,9 @@ func coreVideoRefresh(data unsafe.Pointer, width C.unsigned, height C.unsigned,
 		return
 	}
 
+	// the cores may change the frame size without telling
+	NAEmulator.geometry.frame(int(width), int(height))
+
 	// calculate real frame width in pixels from packed data (realWidth >= width)
 	packedWidth := int(uint32(pitch) / video.bpp)
 	if packedWidth < 1 {
@@ -157,22 +175,37 @@ func coreVideoRefresh(data unsafe.Pointer, width C.unsigned, height C.unsigned,
 	}
 
 	// the image is being resized and de-rotated
-	img := image.DrawRgbaImage(
+	// into the pooled buffer released by the room
+	vw, vh := NAEmulator.vw, NAEmulator.vh
+	buf := NAEmulator.frames.Get(vw * vh * 4)
+	// the crop is of the rotated frames
+	ww, hh := int(width), int(height)
+	if rotationFn.IsEven {
+		ww, hh = hh, ww
+	}
+	img := image.DrawRgbaImageCrop(
 		pixelFormatConverterFn,
 		rotationFn,
 		image.ScaleNearestNeighbour,
 		isOpenGLRender,
 		int(width), int(height), packedWidth, int(video.bpp),
 		data_,
-		NAEmulator.vw,
-		NAEmulator.vh,
+		NAEmulator.crop.Rect(ww, hh),
+		vw,
+		vh,
+		buf.Data,
 	)
 
 	// the image is pushed into a channel
 	// where it will be distributed with fan-out
 	select {
-	case NAEmulator.imageChannel <- GameFrame{Data: img, Duration: dt}:
+	case NAEmulator.imageChannel <- GameFrame{Data: img, Duration: dt, Buf: buf,
+		Input: NAEmulator.input.arrived, InputWait: NAEmulator.input.wait, Geometry: NAEmulator.geometry.pending(),
+		Timestamp: NAEmulator.mediaClock.Video(), Format: int(video.pixFmt)}:
+		NAEmulator.input = inputTiming{}
+		NAEmulator.geometry.sent()
 	default:
+		buf.Release()
 	}
 }
 
@@ -182,15 +215,28 @@ func coreInputPoll() {
 
 //export coreInputState
 func coreInputState(port C.unsigned, device C.unsigned, index C.unsigned, id C.unsigned) C.int16_t {
+	switch device {
+	case C.RETRO_DEVICE_MOUSE:
+		return mouseInput(uint(port), id)
+	case C.RETRO_DEVICE_POINTER:
+		return pointerInput(uint(port), index, id)
+	case C.RETRO_DEVICE_KEYBOARD:
+		return keyboardInput(id)
+	}
+
 	if device == C.RETRO_DEVICE_ANALOG {
+		// the analog buttons are the digital ones at full strength
+		if index == analogButtonIndex {
+			if key, ok := bindKeysMap[int(id)]; ok && NAEmulator.players.isKeyPressed(uint(port), key) {
+				return math.MaxInt16
+			}
+			return 0
+		}
 		if index > C.RETRO_DEVICE_INDEX_ANALOG_RIGHT || id > C.RETRO_DEVICE_ID_ANALOG_Y {
 			return 0
 		}
 		axis := index*2 + id
-		value := NAEmulator.players.isDpadTouched(uint(port), uint(axis))
-		if value != 0 {
-			return (C.int16_t)(value)
-		}
+		return (C.int16_t)(NAEmulator.players.isDpadTouched(uint(port), uint(axis)))
 	}
 
 	if id >= 255 || index > 0 || device != C.RETRO_DEVICE_JOYPAD {
@@ -220,8 +266,14 @@ func audioWrite(buf unsafe.Pointer, frames C.size_t) C.size_t {
 	// and buf pointer is the same in continuous frames
 	copy(p, pcm)
 
+	// the time goes on with the muted audio as well
+	ts := NAEmulator.mediaClock.Audio(int(frames), NAEmulator.speedMultiplier())
+	if p = NAEmulator.fastForwardAudio(p); len(p) == 0 {
+		return frames
+	}
+
 	select {
-	case NAEmulator.audioChannel <- p:
+	case NAEmulator.audioChannel <- GameAudio{Samples: p, Timestamp: ts}:
 	default:
 	}
 
@@ -305,6 +357,12 @@ func coreEnvironment(cmd C.unsigned, data unsafe.Pointer) C.bool {
 		}
 		// fmt.Printf("[Env]: get variable: key:%v not found\n", key)
 		return false
+	case C.RETRO_ENVIRONMENT_SET_VARIABLES:
+		declareCoreOptions(data)
+		return true
+	case C.RETRO_ENVIRONMENT_GET_VARIABLE_UPDATE:
+		*(*C.bool)(data) = C.bool(coreOptionsUpdated())
+		return true
 	case C.RETRO_ENVIRONMENT_SET_HW_RENDER:
 		video.isGl = isGlAllowed
 		if isGlAllowed {
@@ -314,22 +372,33 @@ func coreEnvironment(cmd C.unsigned, data unsafe.Pointer) C.bool {
 			return true
 		}
 		return false
+	case C.RETRO_ENVIRONMENT_SET_DISK_CONTROL_INTERFACE:
+		setDiskControl(data)
+		return true
 	case C.RETRO_ENVIRONMENT_SET_CONTROLLER_INFO:
-		if multitap.supported {
-			info := (*[100]C.struct_retro_controller_info)(data)
-			var i C.unsigned
-			for i = 0; unsafe.Pointer(info[i].types) != nil; i++ {
-				var j C.unsigned
-				types := (*[100]C.struct_retro_controller_description)(unsafe.Pointer(info[i].types))
-				for j = 0; j < info[i].num_types; j++ {
-					if C.GoString(types[j].desc) == "Multitap" {
-						multitap.value = types[j].id
-						return true
-					}
-				}
-			}
+		setControllerInfo(data)
+		return true
+	case C.RETRO_ENVIRONMENT_SET_KEYBOARD_CALLBACK:
+		setKeyboardCallback(data)
+		return true
+	case C.RETRO_ENVIRONMENT_GET_RUMBLE_INTERFACE:
+		setRumbleInterface(data)
+		return true
+	case C.RETRO_ENVIRONMENT_SET_GEOMETRY:
+		setGeometry(*(*C.struct_retro_game_geometry)(data))
+		return true
+	case C.RETRO_ENVIRONMENT_SET_SYSTEM_AV_INFO:
+		avi := (*C.struct_retro_system_av_info)(data)
+		if int32(avi.geometry.max_width) > video.maxWidth || int32(avi.geometry.max_height) > video.maxHeight {
+			log.Printf("warn: the core max frame size %vx%v is larger than the initial one",
+				avi.geometry.max_width, avi.geometry.max_height)
 		}
-		return false
+		if float64(avi.timing.fps) != NAEmulator.meta.Fps ||
+			float64(avi.timing.sample_rate) != NAEmulator.meta.AudioSampleRate {
+			log.Printf("warn: the core timing change (%v FPS, %vHz) is ignored", avi.timing.fps, avi.timing.sample_rate)
+		}
+		setGeometry(avi.geometry)
+		return true
 	default:
 		//fmt.Println("[Env]: command not implemented", cmd)
 		return false
@@ -337,6 +406,22 @@ func coreEnvironment(cmd C.unsigned, data unsafe.Pointer) C.bool {
 	return true
 }
 
+// setGeometry changes the resolution of the game frames by the core,
+// the change goes with the next frame.
+func setGeometry(g C.struct_retro_game_geometry) {
+	w, h, ratio := int(g.base_width), int(g.base_height), float64(g.aspect_ratio)
+	log.Printf("[Env]: geometry %vx%v (%v)", w, h, ratio)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	NAEmulator.meta.BaseWidth, NAEmulator.meta.BaseHeight = w, h
+	if ratio > 0 {
+		NAEmulator.meta.Ratio = ratio
+	}
+	video.baseWidth, video.baseHeight = int32(w), int32(h)
+	NAEmulator.geometry.set(w, h, ratio)
+}
+
 //export initVideo
 func initVideo() {
 	var context graphics.Context
@@ -403,15 +488,18 @@ var (
 	retroUnloadGame              unsafe.Pointer
 )
 
-func coreLoad(meta emulator.Metadata) {
+// coreLoad loads and initializes the lib of the core.
+func coreLoad(meta emulator.Metadata) error {
 	isGlAllowed = meta.IsGlAllowed
 	usesLibCo = meta.UsesLibCo
 	video.autoGlContext = meta.AutoGlContext
-	coreConfig = ScanConfigFile(meta.ConfigPath)
+	loadCoreOptions(meta.ConfigPath, meta.CoreOptions)
+	forceRegion(meta.RegionOption, meta.Region)
 
-	multitap.supported = meta.HasMultitap
-	multitap.enabled = false
-	multitap.value = 0
+	hasMultitap = meta.HasMultitap
+	ports = nil
+	// the libretro default until the core sets its own one
+	setPixelFormat(image.BitFormatShort5551)
 
 	filePath := meta.LibPath
 	if arch, err := core.GetCoreExt(); err == nil {
@@ -427,7 +515,9 @@ func coreLoad(meta emulator.Metadata) {
 	if err != nil {
 		retroHandle, err = loadLibRollingRollingRolling(filePath)
 		if err != nil {
-			log.Fatalf("error core load: %s, %v", filePath, err)
+			mu.Unlock()
+			freeCoreOptions()
+			return fmt.Errorf("%w, %v, %v", emulator.ErrNoCore, filePath, err)
 		}
 	}
 
@@ -451,6 +541,9 @@ func coreLoad(meta emulator.Metadata) {
 	retroSetControllerPortDevice = loadFunction(retroHandle, "retro_set_controller_port_device")
 	retroGetMemorySize = loadFunction(retroHandle, "retro_get_memory_size")
 	retroGetMemoryData = loadFunction(retroHandle, "retro_get_memory_data")
+	retroCheatReset = loadFunction(retroHandle, "retro_cheat_reset")
+	retroCheatSet = loadFunction(retroHandle, "retro_cheat_set")
+	retroGetRegion = loadFunction(retroHandle, "retro_get_region")
 
 	mu.Unlock()
 
@@ -465,45 +558,42 @@ func coreLoad(meta emulator.Metadata) {
 
 	v := C.bridge_retro_api_version(retroAPIVersion)
 	log.Printf("Libretro API version: %v", v)
+	return nil
 }
 
-func slurp(path string, size int64) ([]byte, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	bytes := make([]byte, size)
-	buffer := bufio.NewReader(f)
-	_, err = buffer.Read(bytes)
-	if err != nil {
-		return nil, err
+// coreUnload deinitializes and unloads the core without the game
+// (i.e. the game has failed to load).
+func coreUnload() {
+	C.bridge_retro_deinit(retroDeinit)
+	if err := closeLib(retroHandle); err != nil {
+		log.Printf("error when close: %v", err)
 	}
-	return bytes, nil
+	freeCoreOptions()
 }
 
-func coreLoadGame(filename string) {
-	file, err := os.Open(filename)
-	if err != nil {
-		panic(err)
-	}
-
-	fi, err := file.Stat()
-	if err != nil {
-		panic(err)
+// setSystemDirectory changes the system directory the cores get.
+// The cores may keep the path they got for their lifetime,
+// so the paths are never freed (there are a few of them in the config).
+func setSystemDirectory(dir string) {
+	path, ok := systemDirectories[dir]
+	if !ok {
+		path = C.CString(dir)
+		systemDirectories[dir] = path
 	}
-	_ = file.Close()
-
-	size := fi.Size()
-	log.Printf("ROM size: %v", size)
+	systemDirectory = path
+}
 
-	csFilename := C.CString(filename)
-	defer C.free(unsafe.Pointer(csFilename))
-	gi := C.struct_retro_game_info{
-		path: csFilename,
-		size: C.size_t(size),
-	}
+// coreLibraryName returns the name of the loaded core (retro_get_system_info).
+func coreLibraryName() string {
+	si := C.struct_retro_system_info{}
+	C.bridge_retro_get_system_info(retroGetSystemInfo, &si)
+	return C.GoString(si.library_name)
+}
 
+// coreLoadGame loads the game into the core,
+// the games of the archives are read into memory or
+// extracted into the cache for the fullpath cores.
+func coreLoadGame(filename string, cache emulator.RomCache) error {
 	si := C.struct_retro_system_info{}
 	C.bridge_retro_get_system_info(retroGetSystemInfo, &si)
 	log.Printf("  library_name: %v", C.GoString(si.library_name))
@@ -512,27 +602,45 @@ func coreLoadGame(filename string) {
 	log.Printf("  need_fullpath: %v", bool(si.need_fullpath))
 	log.Printf("  block_extract: %v", bool(si.block_extract))
 
-	if !si.need_fullpath {
-		bytes, err := slurp(filename, size)
-		if err != nil {
-			panic(err)
-		}
-		cstr := C.CString(string(bytes))
-		defer C.free(unsafe.Pointer(cstr))
-		gi.data = unsafe.Pointer(cstr)
+	extensions := strings.Split(C.GoString(si.valid_extensions), "|")
+	if si.block_extract {
+		// the core reads the archives itself
+		extensions = append(extensions, strings.TrimPrefix(emulator.ArchiveExt, "."))
+	}
+	game, err := emulator.OpenGame(filename, bool(si.need_fullpath), extensions, cache)
+	if err != nil {
+		return fmt.Errorf("%w, %v", emulator.ErrBadGame, err)
+	}
+	log.Printf("ROM size: %v", game.Size)
+
+	csFilename := C.CString(game.Path)
+	defer C.free(unsafe.Pointer(csFilename))
+	gi := C.struct_retro_game_info{
+		path: csFilename,
+		size: C.size_t(game.Size),
+	}
+	if game.Data != nil {
+		data := C.CBytes(game.Data)
+		defer C.free(data)
+		gi.data = data
 	}
 
 	ok := C.bridge_retro_load_game(retroLoadGame, &gi)
 	if !ok {
-		log.Fatal("The core failed to load the content.")
+		cache.Release(game.Path)
+		return fmt.Errorf("%w, the core failed to load %v", emulator.ErrBadGame, filename)
 	}
+	NAEmulator.romFile = game.Path
 
 	avi := C.struct_retro_system_av_info{}
 	C.bridge_retro_get_system_av_info(retroGetSystemAVInfo, &avi)
 
 	// Append the library name to the window title.
-	NAEmulator.meta.AudioSampleRate = int(avi.timing.sample_rate)
-	NAEmulator.meta.Fps = float64(avi.timing.fps)
+	region := coreRegion()
+	fps, sampleRate := gameTiming(region, float64(avi.timing.fps), float64(avi.timing.sample_rate))
+	NAEmulator.meta.Region = region
+	NAEmulator.meta.AudioSampleRate = sampleRate
+	NAEmulator.meta.Fps = fps
 	NAEmulator.meta.BaseWidth = int(avi.geometry.base_width)
 	NAEmulator.meta.BaseHeight = int(avi.geometry.base_height)
 	// set aspect ratio
@@ -544,6 +652,7 @@ func coreLoadGame(filename string) {
 		ratio = float64(avi.geometry.base_width) / float64(avi.geometry.base_height)
 	}
 	NAEmulator.meta.Ratio = ratio
+	NAEmulator.geometry.reset(NAEmulator.meta.BaseWidth, NAEmulator.meta.BaseHeight, float64(avi.geometry.aspect_ratio))
 
 	log.Printf("-----------------------------------")
 	log.Printf("---  Core audio and video info  ---")
@@ -552,8 +661,9 @@ func coreLoadGame(filename string) {
 		avi.geometry.base_width, avi.geometry.base_height,
 		avi.geometry.max_width, avi.geometry.max_height)
 	log.Printf("  AR:    %v", ratio)
-	log.Printf("  FPS:   %v", avi.timing.fps)
-	log.Printf("  Audio: %vHz", avi.timing.sample_rate)
+	log.Printf("  FPS:   %v (%v)", fps, avi.timing.fps)
+	log.Printf("  Audio: %vHz", sampleRate)
+	log.Printf("  Region: %v", region)
 	log.Printf("-----------------------------------")
 
 	video.maxWidth = int32(avi.geometry.max_width)
@@ -575,21 +685,7 @@ func coreLoadGame(filename string) {
 	for i := 0; i < maxPort; i++ {
 		C.bridge_retro_set_controller_port_device(retroSetControllerPortDevice, C.uint(i), C.RETRO_DEVICE_JOYPAD)
 	}
-}
-
-func toggleMultitap() {
-	if multitap.supported && multitap.value != 0 {
-		// Official SNES games only support a single multitap device
-		// Most require it to be plugged in player 2 port
-		// And Snes9X requires it to be "plugged" after the game is loaded
-		// Control this from the browser since player 2 will stop working in some games if multitap is "plugged" in
-		if multitap.enabled {
-			C.bridge_retro_set_controller_port_device(retroSetControllerPortDevice, 1, C.RETRO_DEVICE_JOYPAD)
-		} else {
-			C.bridge_retro_set_controller_port_device(retroSetControllerPortDevice, 1, multitap.value)
-		}
-		multitap.enabled = !multitap.enabled
-	}
+	return nil
 }
 
 func nanoarchShutdown() {
@@ -620,12 +716,12 @@ func nanoarchShutdown() {
 	}
 
 	setRotation(0)
+	diskControl = nil
+	keyboardCallback = nil
 	if err := closeLib(retroHandle); err != nil {
 		log.Printf("error when close: %v", err)
 	}
-	for _, element := range coreConfig {
-		C.free(unsafe.Pointer(element))
-	}
+	freeCoreOptions()
 }
 
 func nanoarchRun() {
@@ -644,27 +740,33 @@ func nanoarchRun() {
 	}
 }
 
+// videoSetPixelFormat switches the frames to the pixel format of the core,
+// the cores may do it after the load as well, so the next frame has the new format.
+// The unknown formats are rejected and the current one is kept.
 func videoSetPixelFormat(format uint32) C.bool {
 	switch format {
 	case C.RETRO_PIXEL_FORMAT_0RGB1555:
-		video.pixFmt = image.BitFormatShort5551
 		graphics.SetPixelFormat(graphics.UnsignedShort5551)
-		video.bpp = 2
-		// format is not implemented
-		pixelFormatConverterFn = nil
+		return C.bool(setPixelFormat(image.BitFormatShort5551))
 	case C.RETRO_PIXEL_FORMAT_XRGB8888:
-		video.pixFmt = image.BitFormatInt8888Rev
 		graphics.SetPixelFormat(graphics.UnsignedInt8888Rev)
-		video.bpp = 4
-		pixelFormatConverterFn = image.Rgba8888
+		return C.bool(setPixelFormat(image.BitFormatInt8888Rev))
 	case C.RETRO_PIXEL_FORMAT_RGB565:
-		video.pixFmt = image.BitFormatShort565
 		graphics.SetPixelFormat(graphics.UnsignedShort565)
-		video.bpp = 2
-		pixelFormatConverterFn = image.Rgb565
-	default:
-		log.Fatalf("Unknown pixel type %v", format)
+		return C.bool(setPixelFormat(image.BitFormatShort565))
+	}
+	log.Printf("warn: unsupported pixel format %v of the core", format)
+	return false
+}
+
+// setPixelFormat sets the converter of the frames of the pixel format (image.BitFormat*).
+func setPixelFormat(format int) bool {
+	row, bpp, ok := image.FormatRow(format)
+	if !ok {
+		return false
 	}
+	video.pixFmt, video.bpp = uint32(format), uint32(bpp)
+	pixelFormatConverterFn = row
 	return true
 }
 
@@ -33,7 +33,7 @@ type EmulatorMock struct {
 
 	// channels
 	imageInCh  <-chan GameFrame
-	audioInCh  <-chan []int16
+	audioInCh  <-chan GameAudio
 	inputOutCh chan<- InputEvent
 }
 
@@ -61,12 +61,13 @@ func GetEmulatorMock(room string, system string) *EmulatorMock {
 	meta := conf.Emulator.GetLibretroCoreConfig(system)
 
 	images := make(chan GameFrame, 30)
-	audio := make(chan []int16, 30)
+	audio := make(chan GameAudio, 30)
 	inputs := make(chan InputEvent, 100)
 
 	store := Storage{
 		Path:     os.TempDir(),
 		MainSave: room,
+		Flat:     true,
 	}
 
 	// an emu
@@ -80,6 +81,7 @@ func GetEmulatorMock(room string, system string) *EmulatorMock {
 			meta: emulator.Metadata{
 				LibPath:     meta.Lib,
 				ConfigPath:  meta.Config,
+				CoreOptions: meta.CoreOptions,
 				Ratio:       meta.Ratio,
 				IsGlAllowed: meta.IsGlAllowed,
 				UsesLibCo:   meta.UsesLibCo,
@@ -119,7 +121,7 @@ func GetDefaultEmulatorMock(room string, system string, rom string) *EmulatorMoc
 	mock := GetEmulatorMock(room, system)
 	mock.loadRom(rom)
 	go mock.handleVideo(func(_ GameFrame) {})
-	go mock.handleAudio(func(_ []int16) {})
+	go mock.handleAudio(func(_ GameAudio) {})
 
 	return mock
 }
@@ -128,8 +130,12 @@ func GetDefaultEmulatorMock(room string, system string, rom string) *EmulatorMoc
 // The rom will be loaded from emulators' games path.
 func (emu *EmulatorMock) loadRom(game string) {
 	fmt.Printf("%v %v\n", emu.paths.cores, emu.core)
-	coreLoad(emulator.Metadata{LibPath: emu.paths.cores + emu.core})
-	coreLoadGame(emu.paths.games + game)
+	if err := coreLoad(emulator.Metadata{LibPath: emu.paths.cores + emu.core}); err != nil {
+		panic(err)
+	}
+	if err := coreLoadGame(emu.paths.games+game, emulator.RomCache{}); err != nil {
+		panic(err)
+	}
 }
 
 // shutdownEmulator closes the emulator and cleans its resources.
@@ -160,7 +166,7 @@ func (emu *EmulatorMock) handleVideo(handler func(image GameFrame)) {
 }
 
 // handleAudio is a custom message handler for the audio channel.
-func (emu *EmulatorMock) handleAudio(handler func(sample []int16)) {
+func (emu *EmulatorMock) handleAudio(handler func(audio GameAudio)) {
 	for frame := range emu.audioInCh {
 		handler(frame)
 	}
@@ -0,0 +1,105 @@
+package nanoarch
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// clock is the time source of the frame pacing.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// maxLateFrames is the number of frames behind the schedule
+// after which the emulator runs the frames without the video to catch up.
+const maxLateFrames = 2
+
+// maxCatchUp is how far behind the schedule the emulator may be,
+// after that the schedule starts over (i.e. after long saves).
+const maxCatchUp = time.Second
+
+// pacer schedules the emulator frames with the frame rate of the game.
+// The frame deadlines are absolute (start + n / fps) so the
+// late wake-ups and the rounding of the frame interval don't accumulate.
+type pacer struct {
+	clock clock
+	fps   float64
+	// the speed multiplier of the current schedule
+	multiplier float64
+	// the time of the first frame of the current schedule
+	start time.Time
+	// the number of frames since the start
+	frame int64
+}
+
+func newPacer(fps float64, c clock) *pacer {
+	return &pacer{clock: c, fps: fps, multiplier: 1, start: c.Now()}
+}
+
+// deadline returns the time of the frame n of the current schedule.
+func (p *pacer) deadline(n int64) time.Time {
+	return p.start.Add(time.Duration(float64(n) * float64(time.Second) / (p.fps * p.multiplier)))
+}
+
+// wait returns a channel that fires at the time of the next frame
+// sped up with the multiplier.
+func (p *pacer) wait(multiplier float64) <-chan time.Time {
+	if multiplier != p.multiplier {
+		p.start, p.frame, p.multiplier = p.deadline(p.frame), 0, multiplier
+	}
+	p.frame++
+	now := p.clock.Now()
+	next := p.deadline(p.frame)
+	if now.Sub(next) > maxCatchUp {
+		p.start, p.frame, next = now, 0, now
+	}
+	return p.clock.After(next.Sub(now))
+}
+
+// late returns the number of whole frames
+// the current time is behind the deadline of the current frame.
+func (p *pacer) late() int {
+	behind := p.clock.Now().Sub(p.deadline(p.frame))
+	if behind <= 0 {
+		return 0
+	}
+	return int(behind.Seconds() * p.fps * p.multiplier)
+}
+
+// run calls the frame function with the frame rate of the game
+// times the speed multiplier until the emulator is closed.
+// The paused emulator skips the frames.
+// The frames late more than maxLateFrames run without the video.
+func (na *naEmulator) run(fps float64, frame func()) {
+	c := na.clock
+	if c == nil {
+		c = systemClock{}
+	}
+	pace := newPacer(fps, c)
+	late := false
+	for {
+		na.Lock()
+		if !na.paused {
+			na.skipVideo = late
+			start := c.Now()
+			frame()
+			atomic.AddInt64(&na.runTime, int64(c.Now().Sub(start)))
+			na.skipVideo = false
+		}
+		na.Unlock()
+		na.commitSnapshot()
+
+		select {
+		case <-pace.wait(na.speedMultiplier()):
+		case <-na.done:
+			return
+		}
+		late = pace.late() > maxLateFrames
+	}
+}
@@ -0,0 +1,91 @@
+package nanoarch
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// jitterClock is a fake clock that wakes up late by some random time.
+type jitterClock struct {
+	fakeClock
+	rnd    *rand.Rand
+	jitter time.Duration
+}
+
+func (c *jitterClock) After(d time.Duration) <-chan time.Time {
+	return c.fakeClock.After(d + time.Duration(c.rnd.Int63n(int64(c.jitter))))
+}
+
+// pace runs the emulator for the time of the clock calling the stall function each frame,
+// returns the number of emulated frames and the frames without the video.
+func pace(na *naEmulator, clock *fakeClock, fps float64, d time.Duration, stall func(frame int)) (ticks int, skipped int) {
+	end, stopped := clock.now.Add(d), false
+	na.run(fps, func() {
+		if !clock.now.Before(end) {
+			if !stopped {
+				close(na.done)
+				stopped = true
+			}
+			return
+		}
+		ticks++
+		if na.skipVideo {
+			skipped++
+		}
+		if stall != nil {
+			stall(ticks)
+		}
+	})
+	return
+}
+
+func TestPacerDrift(t *testing.T) {
+	fps := 60.0988
+	clock := &jitterClock{
+		fakeClock: fakeClock{now: time.Unix(0, 0)},
+		rnd:       rand.New(rand.NewSource(1)),
+		jitter:    4 * time.Millisecond,
+	}
+	na := naEmulator{clock: clock, done: make(chan struct{})}
+	ticks, skipped := pace(&na, &clock.fakeClock, fps, time.Hour, nil)
+
+	expected := time.Hour.Seconds() * fps
+	if drift := math.Abs(float64(ticks) - expected); drift >= 1 {
+		t.Errorf("the frames have drifted by %.2f frames in an hour (%v, expected %.2f)", drift, ticks, expected)
+	}
+	if skipped > 0 {
+		t.Errorf("%v frames without video for the jitter below the frame interval", skipped)
+	}
+}
+
+func TestPacerCatchUp(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	na := naEmulator{clock: clock, done: make(chan struct{})}
+
+	// some long frame
+	ticks, skipped := pace(&na, clock, 60, 2*time.Second, func(frame int) {
+		if frame == 30 {
+			clock.now = clock.now.Add(100 * time.Millisecond)
+		}
+	})
+	if ticks < 119 || ticks > 121 {
+		t.Errorf("the late frames haven't caught up, %v frames, expected ~120", ticks)
+	}
+	if skipped < 1 || skipped > 6 {
+		t.Errorf("wrong number of the frames without video %v", skipped)
+	}
+
+	// the stalls longer than the catch up time start the schedule over
+	clock = &fakeClock{now: time.Unix(0, 0)}
+	na = naEmulator{clock: clock, done: make(chan struct{})}
+	ticks, skipped = pace(&na, clock, 60, 5*time.Second, func(frame int) {
+		if frame == 30 {
+			clock.now = clock.now.Add(2 * time.Second)
+		}
+	})
+	if ticks < 179 || ticks > 183 || skipped > 0 {
+		t.Errorf("the schedule hasn't started over, %v frames (%v skipped), expected ~180", ticks, skipped)
+	}
+}
@@ -0,0 +1,66 @@
+package nanoarch
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Tests that the paused emulator stops producing frames and
+// continues after the resume.
+func TestPause(t *testing.T) {
+	mock := GetEmulatorMock("test_pause", "gba")
+	mock.loadRom("Sushi The Cat.gba")
+	defer func() {
+		_ = os.Remove(mock.GetHashPath())
+		_ = os.Remove(mock.GetSRAMPath())
+	}()
+
+	var frames int32
+	closed := make(chan struct{})
+	go func() {
+		for range mock.imageInCh {
+			atomic.AddInt32(&frames, 1)
+		}
+		close(closed)
+	}()
+	go mock.handleAudio(func(_ GameAudio) {})
+	go mock.Start()
+
+	interval := time.Second / time.Duration(mock.meta.Fps)
+	waitFrames := func(n int32) bool {
+		for timeout := time.After(5 * time.Second); ; {
+			if atomic.LoadInt32(&frames) >= n {
+				return true
+			}
+			select {
+			case <-timeout:
+				return false
+			case <-time.After(interval):
+			}
+		}
+	}
+
+	if !waitFrames(10) {
+		t.Fatalf("no frames")
+	}
+	mock.Pause()
+	time.Sleep(interval)
+	paused := atomic.LoadInt32(&frames)
+	time.Sleep(10 * interval)
+	if n := atomic.LoadInt32(&frames); n != paused {
+		t.Errorf("%v frames after the pause", n-paused)
+	}
+	if err := mock.SaveGame(); err != nil {
+		t.Errorf("the paused game wasn't saved, %v", err)
+	}
+
+	mock.Resume()
+	if !waitFrames(paused + 10) {
+		t.Errorf("no frames after the resume")
+	}
+
+	mock.Close()
+	<-closed
+}
@@ -1,33 +1,90 @@
 package nanoarch
 
-import "io/ioutil"
+import (
+	"io/ioutil"
+	"log"
+)
 
 // Save writes the current state to the filesystem.
 // Deadlock warning: locks the emulator.
-func (na *naEmulator) Save() (err error) {
+func (na *naEmulator) Save() error { return na.SaveSlot(0) }
+
+// SaveSlot writes the current state into the slot file.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) SaveSlot(slot int) (err error) {
 	na.Lock()
 	defer na.Unlock()
 
-	if sramState := getSaveRAM(); sramState != nil {
-		err = toFile(na.GetSRAMPath(), sramState)
+	err = na.writeSRAM()
+	if err := saveCoreOptions(na.GetOptionsPath()); err != nil {
+		return err
+	}
+	if err := na.writeDisc(slot); err != nil {
+		return err
 	}
 	if saveState, err := getSaveState(); err == nil {
-		return toFile(na.GetHashPath(), saveState)
+		return toFile(na.GetSlotPath(slot), saveState)
 	}
 	return
 }
 
+// Snapshot returns the current state and save RAM of the game,
+// it blocks the game for the serialization only.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) Snapshot() (state []byte, sram []byte, err error) {
+	na.Lock()
+	defer na.Unlock()
+
+	if state, err = getSaveState(); err != nil {
+		return nil, nil, err
+	}
+	return state, getSaveRAM(), nil
+}
+
+// Restore replaces the state and the save RAM (if any) of the running game
+// and writes them into the main save files.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) Restore(state []byte, sram []byte) error {
+	na.Lock()
+	defer na.Unlock()
+
+	if len(sram) > 0 {
+		if err := toFile(na.GetSRAMPath(), sram); err != nil {
+			return err
+		}
+		restoreSaveRAM(sram)
+		na.sram = sram
+	}
+	if err := toFile(na.GetSlotPath(0), state); err != nil {
+		return err
+	}
+	if err := restoreSaveState(state); err != nil {
+		return err
+	}
+	na.reapplyCheats()
+	return nil
+}
+
 // Load restores the state from the filesystem.
 // Deadlock warning: locks the emulator.
-func (na *naEmulator) Load() (err error) {
+func (na *naEmulator) Load() error { return na.LoadSlot(0) }
+
+// LoadSlot restores the state from the slot file.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) LoadSlot(slot int) (err error) {
 	na.Lock()
 	defer na.Unlock()
 
-	if sramState, err := fromFile(na.GetSRAMPath()); err == nil {
-		restoreSaveRAM(sramState)
+	restoreCoreOptions(na.GetOptionsPath())
+	na.readSRAM()
+	if err := na.readDisc(slot); err != nil {
+		log.Printf("warn: couldn't restore the disc, %v", err)
 	}
-	if saveState, err := fromFile(na.GetHashPath()); err == nil {
-		return restoreSaveState(saveState)
+	if saveState, err := fromFile(na.GetSlotPath(slot)); err == nil {
+		if err := restoreSaveState(saveState); err != nil {
+			return err
+		}
+		na.reapplyCheats()
 	}
 	return
 }
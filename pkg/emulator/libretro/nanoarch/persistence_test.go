@@ -58,7 +58,6 @@ func TestSave(t *testing.T) {
 // Emulate n ticks again.
 // Call load from the save (b).
 // Compare states (a) and (b), should be =.
-//
 func TestLoad(t *testing.T) {
 	tests := []testRun{
 		{
@@ -158,7 +157,7 @@ func TestStateConcurrency(t *testing.T) {
 
 		mock.loadRom(test.run.rom)
 		go mock.handleVideo(func(frame GameFrame) {})
-		go mock.handleAudio(func(_ []int16) {})
+		go mock.handleAudio(func(_ GameAudio) {})
 		go mock.handleInput(func(_ InputEvent) {})
 
 		rand.Seed(int64(test.seed))
@@ -0,0 +1,56 @@
+package nanoarch
+
+import (
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/image"
+)
+
+// Tests that the frames after the format switches of the core
+// have the colors of their formats.
+func TestPixelFormatSwitch(t *testing.T) {
+	defer setPixelFormat(image.BitFormatShort5551)
+
+	// the red pixels of the formats
+	red := map[int][]byte{
+		image.BitFormatShort565:   {0x00, 0xf8},
+		image.BitFormatInt8888Rev: {0, 0, 255, 0},
+		image.BitFormatShort5551:  {0x00, 0x7c},
+	}
+	steps := []int{
+		image.BitFormatShort565,
+		image.BitFormatInt8888Rev,
+		image.BitFormatShort565,
+		image.BitFormatShort5551,
+		image.BitFormatInt8888Rev,
+	}
+	rot := image.GetRotation(image.Angle(0))
+	for i, format := range steps {
+		if !setPixelFormat(format) {
+			t.Fatalf("step %v: the format %v is rejected", i, format)
+		}
+		// the next frame is of the new format
+		var data []byte
+		for p := 0; p < 4; p++ {
+			data = append(data, red[format]...)
+		}
+		img := image.DrawRgbaImage(pixelFormatConverterFn, rot, image.ScaleNearestNeighbour, false,
+			2, 2, 2, int(video.bpp), data, 2, 2, make([]byte, 2*2*4))
+		if img == nil {
+			t.Fatalf("step %v: the frame of the format %v is dropped", i, format)
+		}
+		for p := 0; p < 4; p++ {
+			if c := img.Pix[p*4 : p*4+4]; c[0] != 255 || c[1] != 0 || c[2] != 0 || c[3] != 255 {
+				t.Fatalf("step %v: wrong color %v of the format %v", i, c, format)
+			}
+		}
+	}
+
+	// the unknown formats keep the current one
+	if setPixelFormat(42) {
+		t.Errorf("the unknown format is accepted")
+	}
+	if video.pixFmt != image.BitFormatInt8888Rev || video.bpp != 4 {
+		t.Errorf("the format has changed to %v (%v bpp)", video.pixFmt, video.bpp)
+	}
+}
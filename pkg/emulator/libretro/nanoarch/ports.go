@@ -0,0 +1,119 @@
+package nanoarch
+
+/*
+#include "libretro.h"
+
+void bridge_retro_set_controller_port_device(void *f, unsigned port, unsigned device);
+*/
+import "C"
+import (
+	"fmt"
+	"log"
+	"unsafe"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// !global emulator lib state
+// the controller ports of the core with the devices declared by it,
+// nil if the core doesn't declare them
+var ports []emulator.Port
+
+// multitapPort is the port of the multitap toggle.
+// Official SNES games only support a single multitap device,
+// most require it to be plugged in player 2 port.
+const multitapPort = 1
+
+// setControllerInfo keeps the devices of the controller ports declared by the core
+// (RETRO_ENVIRONMENT_SET_CONTROLLER_INFO), the ports have a joypad by default.
+func setControllerInfo(data unsafe.Pointer) {
+	info := (*[100]C.struct_retro_controller_info)(data)
+	ports = nil
+	for i := 0; i < len(info) && unsafe.Pointer(info[i].types) != nil; i++ {
+		port := emulator.Port{Device: C.RETRO_DEVICE_JOYPAD}
+		types := (*[100]C.struct_retro_controller_description)(unsafe.Pointer(info[i].types))
+		for j := 0; j < int(info[i].num_types) && j < len(types); j++ {
+			port.Devices = append(port.Devices, emulator.Device{ID: uint32(types[j].id), Name: C.GoString(types[j].desc)})
+		}
+		ports = append(ports, port)
+	}
+}
+
+// setPortDevice plugs the device into the port,
+// the device should be declared by the core for the port, or be a joypad.
+// Should be called under the emulator lock.
+func setPortDevice(port int, device uint32) error {
+	if port < 0 || port >= len(ports) {
+		return fmt.Errorf("the core has no controller port %v", port)
+	}
+	if device != C.RETRO_DEVICE_JOYPAD && !ports[port].Supports(device) {
+		return fmt.Errorf("the core doesn't support the device %v in the port %v", device, port)
+	}
+	C.bridge_retro_set_controller_port_device(retroSetControllerPortDevice, C.unsigned(port), C.unsigned(device))
+	ports[port].Device = device
+	return nil
+}
+
+// plugDevices plugs the devices into the ports by their names or IDs
+// after the game load.
+func plugDevices(devices map[int]string) {
+	for port, name := range devices {
+		if port < 0 || port >= len(ports) {
+			log.Printf("warn: the core has no controller port %v for %v", port, name)
+			continue
+		}
+		device, ok := ports[port].Find(name)
+		if !ok {
+			log.Printf("warn: the core has no device %v for the port %v", name, port)
+			continue
+		}
+		if err := setPortDevice(port, device.ID); err != nil {
+			log.Printf("warn: couldn't plug %v, %v", name, err)
+		}
+	}
+}
+
+// toggleMultitap plugs the multitap in or out of its port,
+// should be called under the emulator lock.
+func toggleMultitap() error {
+	if !hasMultitap || len(ports) <= multitapPort {
+		return nil
+	}
+	multitap, ok := ports[multitapPort].Find("Multitap")
+	if !ok {
+		return nil
+	}
+	if ports[multitapPort].Device == multitap.ID {
+		return setPortDevice(multitapPort, C.RETRO_DEVICE_JOYPAD)
+	}
+	return setPortDevice(multitapPort, multitap.ID)
+}
+
+// SetPortDevice plugs the device into the controller port of the core.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) SetPortDevice(port int, device uint32) error {
+	na.Lock()
+	defer na.Unlock()
+	return setPortDevice(port, device)
+}
+
+// GetPorts returns the controller ports of the core with their devices.
+func (na *naEmulator) GetPorts() []emulator.Port {
+	na.Lock()
+	defer na.Unlock()
+	return append([]emulator.Port(nil), ports...)
+}
+
+// ToggleMultitap plugs in or out the multitap of the second port
+// of the cores with the multitap option of the config.
+// Snes9X requires it to be "plugged" after the game is loaded,
+// and player 2 stops working in some games with it, so it's controlled from the browser.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) ToggleMultitap() error {
+	if na.roomID == "" {
+		return nil
+	}
+	na.Lock()
+	defer na.Unlock()
+	return toggleMultitap()
+}
@@ -0,0 +1,86 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// the controller info of Snes9x
+var snesDevices = [][]emulator.Device{
+	{{ID: 1, Name: "SNES Joypad"}, {ID: 2, Name: "SNES Mouse"}},
+	{{ID: 1, Name: "SNES Joypad"}, {ID: 2, Name: "SNES Mouse"}, {ID: 257, Name: "Multitap"}, {ID: 260, Name: "SuperScope"}},
+}
+
+func TestSetPortDevice(t *testing.T) {
+	defer func() { ports = nil }()
+	na := &naEmulator{}
+	if err := na.SetPortDevice(0, 1); err == nil {
+		t.Errorf("plugged the device without the controller info")
+	}
+
+	core := stubCore{}
+	if !core.loadControllerInfo(snesDevices) {
+		t.Fatalf("the controller info is not accepted")
+	}
+	expected := []emulator.Port{{Device: 1, Devices: snesDevices[0]}, {Device: 1, Devices: snesDevices[1]}}
+	if got := na.GetPorts(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong ports %+v, expected %+v", got, expected)
+	}
+
+	if err := na.SetPortDevice(1, 260); err != nil {
+		t.Fatalf("couldn't plug the device, %v", err)
+	}
+	if err := na.SetPortDevice(0, 1); err != nil {
+		t.Fatalf("couldn't plug the joypad, %v", err)
+	}
+	// the unsupported devices and ports
+	for _, pd := range [][2]int{{0, 257}, {0, 260}, {2, 1}, {-1, 1}} {
+		if err := na.SetPortDevice(pd[0], uint32(pd[1])); err == nil {
+			t.Errorf("plugged the unsupported device %v into the port %v", pd[1], pd[0])
+		}
+	}
+	if log := core.portLog(); log != "port 1 260;port 0 1;" {
+		t.Errorf("wrong port device calls %q", log)
+	}
+	if got := na.GetPorts(); got[0].Device != 1 || got[1].Device != 260 {
+		t.Errorf("wrong port devices %+v", got)
+	}
+}
+
+func TestPlugDevices(t *testing.T) {
+	defer func() { ports = nil }()
+	core := stubCore{}
+	core.loadControllerInfo(snesDevices)
+
+	plugDevices(map[int]string{0: "snes mouse", 1: "Zapper", 3: "SNES Joypad"})
+	if log := core.portLog(); log != "port 0 2;" {
+		t.Errorf("wrong port device calls %q", log)
+	}
+}
+
+func TestToggleMultitap(t *testing.T) {
+	defer func() { ports, hasMultitap = nil, false }()
+	core := stubCore{}
+	core.loadControllerInfo(snesDevices)
+	na := &naEmulator{roomID: "test_multitap"}
+
+	// the cores without the multitap option
+	if err := na.ToggleMultitap(); err != nil || core.portLog() != "" {
+		t.Errorf("toggled the multitap of the core without it, %v", err)
+	}
+
+	hasMultitap = true
+	for i := 0; i < 2; i++ {
+		if err := na.ToggleMultitap(); err != nil {
+			t.Fatalf("couldn't toggle the multitap, %v", err)
+		}
+	}
+	if log := core.portLog(); log != "port 1 257;port 1 1;" {
+		t.Errorf("wrong multitap toggle calls %q", log)
+	}
+}
@@ -0,0 +1,99 @@
+package nanoarch
+
+/*
+#include "libretro.h"
+
+unsigned bridge_retro_get_region(void *f);
+*/
+import "C"
+import (
+	"log"
+	"strings"
+	"unsafe"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+var retroGetRegion unsafe.Pointer
+
+// the nominal frame rates of the regions
+const (
+	ntscFps = 60
+	palFps  = 50
+)
+
+// forcedRegion is the region of the game set with the core option of the region.
+var forcedRegion struct {
+	option string
+	region string
+}
+
+// forceRegion makes the core run the next game in the region
+// with the core option of the region, the empty region isn't forced.
+func forceRegion(option, region string) {
+	forcedRegion.option, forcedRegion.region = option, strings.ToLower(region)
+	if forcedRegion.region != "" && option == "" {
+		log.Printf("warn: the region %v of the game is not forced, the core has no region option", region)
+	}
+}
+
+// setRegionOption sets the core option of the forced region
+// to the declared value of the region.
+func setRegionOption(declared map[string][]string) {
+	option, region := forcedRegion.option, forcedRegion.region
+	if region == "" || option == "" {
+		return
+	}
+	values, ok := declared[option]
+	if !ok {
+		log.Printf("warn: the core has no region option %v, the region %v is not forced", option, region)
+		return
+	}
+	value, ok := regionValue(values, region)
+	if !ok {
+		log.Printf("warn: the core has no region %v of the option %v (%v)", region, option, values)
+		return
+	}
+	log.Printf("[Env]: forced region %v (%v = %v)", region, option, value)
+	setConfigValue(option, value)
+}
+
+// regionValue returns the first value of the region option
+// starting with the region name, i.e. PAL or ntsc-u.
+func regionValue(values []string, region string) (string, bool) {
+	if len(values) == 0 {
+		return region, true
+	}
+	for _, v := range values {
+		if strings.HasPrefix(strings.ToLower(v), region) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// coreRegion returns the region of the game reported by the core.
+func coreRegion() string {
+	if retroGetRegion != nil && C.bridge_retro_get_region(retroGetRegion) == C.RETRO_REGION_PAL {
+		return emulator.RegionPAL
+	}
+	return emulator.RegionNTSC
+}
+
+// gameTiming returns the frame rate and the audio sample rate of the game
+// of the region from the core timing.
+// The games are paced with the frame rate reported by the core,
+// the cores without it get the nominal one of the region.
+// The sample rate is of the emulated time, so it stays the same
+// and the audio of a frame is sampleRate / fps.
+func gameTiming(region string, fps, sampleRate float64) (float64, float64) {
+	nominal := float64(ntscFps)
+	if region == emulator.RegionPAL {
+		nominal = palFps
+	}
+	if fps <= 0 {
+		log.Printf("warn: the core has no frame rate, %v FPS of %v", nominal, region)
+		fps = nominal
+	}
+	return fps, sampleRate
+}
@@ -0,0 +1,108 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// Tests that the games of the stub core reporting the regions
+// are paced with the frame rates of the regions along with their audio.
+func TestRegionTiming(t *testing.T) {
+	core := stubCore{}
+	defer core.loadRegion(false)
+
+	tests := []struct {
+		pal        bool
+		fps        float64
+		sampleRate float64
+		region     string
+		// the expected frame rate and the Opus frame (ms)
+		pace  float64
+		frame int
+	}{
+		{pal: true, fps: 50, sampleRate: 44100, region: emulator.RegionPAL, pace: 50, frame: 20},
+		// the PAL game of the core running it with the NTSC timing
+		{pal: true, fps: 60.0988, sampleRate: 44100, region: emulator.RegionPAL, pace: 60.0988, frame: 10},
+		{pal: true, fps: 0, sampleRate: 32040, region: emulator.RegionPAL, pace: 50, frame: 20},
+		{pal: false, fps: 60.0988, sampleRate: 48000, region: emulator.RegionNTSC, pace: 60.0988, frame: 10},
+		{pal: false, fps: 0, sampleRate: 48000, region: emulator.RegionNTSC, pace: 60, frame: 10},
+		// the arcade boards of the odd frame rates
+		{pal: false, fps: 54.7, sampleRate: 48000, region: emulator.RegionNTSC, pace: 54.7, frame: 10},
+	}
+	for _, test := range tests {
+		core.loadRegion(test.pal)
+		region := coreRegion()
+		if region != test.region {
+			t.Errorf("wrong region %v, expected %v", region, test.region)
+		}
+		fps, sampleRate := gameTiming(region, test.fps, test.sampleRate)
+		if fps != test.pace || sampleRate != test.sampleRate {
+			t.Errorf("wrong timing %v FPS (%vHz) of %v FPS %v, expected %v FPS (%vHz)",
+				fps, sampleRate, test.fps, region, test.pace, test.sampleRate)
+		}
+
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		na := naEmulator{clock: clock, done: make(chan struct{})}
+		ticks, _ := pace(&na, clock, fps, 10*time.Second, nil)
+		if expected := 10 * test.pace; math.Abs(float64(ticks)-expected) > 1 {
+			t.Errorf("wrong number of the frames %v in 10s of %v, expected %v", ticks, region, expected)
+		}
+
+		audio := encoder.Audio{Channels: 2, Frequency: 48000}.WithFps(fps)
+		if audio.Frame != test.frame || audio.GetFrameSize() != 48*test.frame*2 {
+			t.Errorf("wrong Opus frame %vms (%v samples) of %v, expected %vms",
+				audio.Frame, audio.GetFrameSize(), region, test.frame)
+		}
+	}
+}
+
+// Tests that the forced regions of the games set the region options
+// of the cores to their own values.
+func TestRegionOption(t *testing.T) {
+	defer freeCoreOptions()
+	defer forceRegion("", "")
+
+	core := stubCore{}
+	tests := []struct {
+		option string
+		desc   string
+		region string
+		value  string
+		ok     bool
+	}{
+		{option: "fceumm_region", desc: "Region; Auto|NTSC|PAL|Dendy", region: "PAL", value: "PAL", ok: true},
+		{option: "nestopia_favored_system", desc: "System; auto|ntsc|pal|famicom|dendy", region: "pal", value: "pal", ok: true},
+		{option: "genesis_plus_gx_region_detect", desc: "Region; auto|ntsc-u|pal|ntsc-j", region: "ntsc", value: "ntsc-u", ok: true},
+		// the core without the region
+		{option: "core_region", desc: "Region; auto|japan", region: "pal"},
+		// not forced
+		{option: "core_region", desc: "Region; auto|ntsc|pal"},
+	}
+	for _, test := range tests {
+		loadCoreOptions("", nil)
+		forceRegion(test.option, test.region)
+		if !core.declare(map[string]string{test.option: test.desc}) {
+			t.Fatalf("core options are not accepted")
+		}
+		value, ok := core.variable(test.option)
+		if ok != test.ok || value != test.value {
+			t.Errorf("wrong option %v = %v (%v) of the region %v, expected %v",
+				test.option, value, ok, test.region, test.value)
+		}
+	}
+
+	// the core doesn't declare the option
+	loadCoreOptions("", nil)
+	forceRegion("snes9x_region", "pal")
+	_ = core.declare(map[string]string{"core_a": "A; 0|1"})
+	if _, ok := core.variable("snes9x_region"); ok {
+		t.Errorf("the undeclared region option is set")
+	}
+}
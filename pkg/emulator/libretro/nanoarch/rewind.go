@@ -0,0 +1,130 @@
+package nanoarch
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+var errNoRewind = errors.New("rewind is not available")
+
+// rewindBuffer is a ring buffer of the last emulator states.
+// The states are compressed to reduce the memory use,
+// the copies of the states are staged under the emulator lock
+// and compressed (committed) outside it.
+type rewindBuffer struct {
+	mu     sync.Mutex
+	states [][]byte
+	// the position of the next state
+	head int
+	// the number of stored states
+	size int
+	// the staged state and the number of the rewinds at the time,
+	// the states staged before a rewind are dropped
+	pending state
+	gen     int
+
+	buf bytes.Buffer
+	w   *flate.Writer
+}
+
+func newRewindBuffer(capacity int) *rewindBuffer {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return &rewindBuffer{states: make([][]byte, capacity), w: w}
+}
+
+// stage keeps the copy of the state until the commit.
+func (b *rewindBuffer) stage(st state) {
+	b.mu.Lock()
+	b.pending = st
+	b.mu.Unlock()
+}
+
+// commit pushes the staged state if there has been no rewind since,
+// the commits shouldn't run concurrently.
+func (b *rewindBuffer) commit() error {
+	b.mu.Lock()
+	st, gen := b.pending, b.gen
+	b.pending = nil
+	b.mu.Unlock()
+	if st == nil {
+		return nil
+	}
+	return b.store(st, gen)
+}
+
+// push adds the state into the buffer overwriting the oldest one if it's full.
+func (b *rewindBuffer) push(st state) error {
+	b.mu.Lock()
+	gen := b.gen
+	b.mu.Unlock()
+	return b.store(st, gen)
+}
+
+// store compresses the state of the rewind gen into the buffer.
+func (b *rewindBuffer) store(st state, gen int) error {
+	b.buf.Reset()
+	b.w.Reset(&b.buf)
+	if _, err := b.w.Write(st); err != nil {
+		return err
+	}
+	if err := b.w.Close(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.gen {
+		return nil
+	}
+	// reuse the memory of the oldest state
+	compressed := append(b.states[b.head][:0], b.buf.Bytes()...)
+	b.states[b.head] = compressed
+	b.head = (b.head + 1) % len(b.states)
+	if b.size < len(b.states) {
+		b.size++
+	}
+	return nil
+}
+
+// rewind returns the state the number of frames back from the latest one
+// (or the oldest available state) and drops all the newer states.
+func (b *rewindBuffer) rewind(frames int) (state, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = nil
+	b.gen++
+	if b.size == 0 {
+		return nil, errNoRewind
+	}
+	if frames < 0 {
+		frames = 0
+	}
+	if frames > b.size-1 {
+		frames = b.size - 1
+	}
+	b.size -= frames
+	b.head = (b.head - frames + len(b.states)) % len(b.states)
+
+	latest := (b.head - 1 + len(b.states)) % len(b.states)
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(b.states[latest])))
+}
+
+// len returns the number of stored states.
+func (b *rewindBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// memSize returns the size of the stored states.
+func (b *rewindBuffer) memSize() (size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, st := range b.states {
+		size += cap(st)
+	}
+	return
+}
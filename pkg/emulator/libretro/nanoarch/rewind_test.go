@@ -0,0 +1,95 @@
+package nanoarch
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRewindBuffer(t *testing.T) {
+	buf := newRewindBuffer(5)
+	if _, err := buf.rewind(1); err != errNoRewind {
+		t.Errorf("expected no rewind error, got %v", err)
+	}
+
+	for i := byte(0); i < 8; i++ {
+		if err := buf.push(bytes.Repeat([]byte{i}, 1000)); err != nil {
+			t.Fatalf("push error: %v", err)
+		}
+	}
+	if buf.len() != 5 {
+		t.Errorf("expected 5 states, got %v", buf.len())
+	}
+	if buf.memSize() >= 5*1000 {
+		t.Errorf("the states are not compressed (%v bytes)", buf.memSize())
+	}
+
+	tests := []struct {
+		frames int
+		state  byte
+		left   int
+	}{
+		{frames: 0, state: 7, left: 5},
+		{frames: 2, state: 5, left: 3},
+		{frames: 10, state: 3, left: 1},
+		{frames: 1, state: 3, left: 1},
+	}
+	for _, test := range tests {
+		st, err := buf.rewind(test.frames)
+		if err != nil {
+			t.Fatalf("rewind error: %v", err)
+		}
+		if !bytes.Equal(st, bytes.Repeat([]byte{test.state}, 1000)) {
+			t.Errorf("rewind %v: wrong state %v", test.frames, st[0])
+		}
+		if buf.len() != test.left {
+			t.Errorf("rewind %v: expected %v states, got %v", test.frames, test.left, buf.len())
+		}
+	}
+
+	// continue after rewind
+	_ = buf.push([]byte{42})
+	if st, _ := buf.rewind(0); !bytes.Equal(st, []byte{42}) {
+		t.Errorf("wrong state after rewind %v", st)
+	}
+
+	// the states staged before the rewind are dropped
+	n := buf.len()
+	buf.stage([]byte{43})
+	_, _ = buf.rewind(0)
+	if err := buf.commit(); err != nil || buf.len() != n {
+		t.Errorf("the staged state has been kept after the rewind (%v states), %v", buf.len(), err)
+	}
+	buf.stage([]byte{44})
+	if err := buf.commit(); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if st, _ := buf.rewind(0); !bytes.Equal(st, []byte{44}) {
+		t.Errorf("wrong committed state %v", st)
+	}
+}
+
+// Tests that the emulator state after rewind
+// matches the state the number of frames before.
+func TestRewind(t *testing.T) {
+	mock := GetDefaultEmulatorMock("test_rewind", "nes", "Super Mario Bros.nes")
+	mock.rewind = newRewindBuffer(100)
+
+	var hashes []string
+	for i := 0; i < 50; i++ {
+		mock.emulateOneFrame()
+		mock.Lock()
+		mock.snapshot()
+		mock.Unlock()
+		mock.commitSnapshot()
+		hashes = append(hashes, mock.getStateHash())
+	}
+
+	if err := mock.Rewind(20); err != nil {
+		t.Fatalf("rewind error: %v", err)
+	}
+	if hash := mock.getStateHash(); hash != hashes[29] {
+		t.Errorf("wrong state after rewind %v != %v", hash, hashes[29])
+	}
+
+	mock.shutdownEmulator()
+}
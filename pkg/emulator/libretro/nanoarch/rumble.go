@@ -0,0 +1,53 @@
+package nanoarch
+
+/*
+#include "libretro.h"
+
+bool coreSetRumbleState_cgo(unsigned port, enum retro_rumble_effect effect, uint16_t strength);
+*/
+import "C"
+import (
+	"unsafe"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// setRumbleInterface gives the rumble callback to the core
+// (RETRO_ENVIRONMENT_GET_RUMBLE_INTERFACE).
+func setRumbleInterface(data unsafe.Pointer) {
+	(*C.struct_retro_rumble_interface)(data).set_rumble_state = (C.retro_set_rumble_state_t)(C.coreSetRumbleState_cgo)
+}
+
+//export coreSetRumbleState
+func coreSetRumbleState(port C.unsigned, effect C.unsigned, strength C.uint16_t) C.bool {
+	if NAEmulator == nil {
+		return false
+	}
+	return C.bool(NAEmulator.setRumble(int(port), int(effect), uint16(strength)))
+}
+
+// setRumble passes the changes of the rumble of the port to the room,
+// the cores set the same rumble every frame.
+// The changes are dropped when the room doesn't keep up with them
+// and sent again with the next rumble of the core.
+func (na *naEmulator) setRumble(port int, effect int, strength uint16) bool {
+	if port < 0 || port >= controllersNum || effect < 0 || effect > C.RETRO_RUMBLE_WEAK {
+		return false
+	}
+	if na.rumble[port][effect] == strength {
+		return true
+	}
+	rumble := emulator.Rumble{Port: port, Effect: emulator.RumbleStrong, Strength: strength}
+	if effect == C.RETRO_RUMBLE_WEAK {
+		rumble.Effect = emulator.RumbleWeak
+	}
+	select {
+	case na.rumbleChannel <- rumble:
+		na.rumble[port][effect] = strength
+	default:
+	}
+	return true
+}
+
+// Rumble returns the changes of the rumble of the controller ports.
+func (na *naEmulator) Rumble() <-chan emulator.Rumble { return na.rumbleChannel }
@@ -0,0 +1,75 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+func TestRumble(t *testing.T) {
+	defer func(na *naEmulator) { NAEmulator = na }(NAEmulator)
+	na := &naEmulator{rumbleChannel: make(chan emulator.Rumble, 32)}
+	NAEmulator = na
+	core := stubCore{}
+
+	const strong, weak = 0, 1
+	// the cores set the rumble every frame
+	for i := 0; i < 3; i++ {
+		if !core.rumble(1, strong, 0xffff) {
+			t.Fatalf("the rumble is not accepted")
+		}
+	}
+	core.rumble(1, weak, 0x8000)
+	core.rumble(0, weak, 0)
+	core.rumble(1, strong, 0)
+	if core.rumble(controllersNum, strong, 1) || core.rumble(0, 2, 1) {
+		t.Errorf("the rumble of the unknown port or effect is accepted")
+	}
+
+	expected := []emulator.Rumble{
+		{Port: 1, Effect: emulator.RumbleStrong, Strength: 0xffff},
+		{Port: 1, Effect: emulator.RumbleWeak, Strength: 0x8000},
+		{Port: 1, Effect: emulator.RumbleStrong, Strength: 0},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-na.Rumble():
+			if got != want {
+				t.Errorf("wrong rumble %+v, expected %+v", got, want)
+			}
+		default:
+			t.Fatalf("no rumble %+v", want)
+		}
+	}
+	select {
+	case got := <-na.Rumble():
+		t.Errorf("extra rumble %+v", got)
+	default:
+	}
+}
+
+// Tests that the rumble dropped by the full queue of the room
+// is sent again with the next rumble of the core.
+func TestRumbleDropped(t *testing.T) {
+	defer func(na *naEmulator) { NAEmulator = na }(NAEmulator)
+	na := &naEmulator{rumbleChannel: make(chan emulator.Rumble, 1)}
+	NAEmulator = na
+	core := stubCore{}
+
+	core.rumble(0, 0, 1)
+	// the queue is full
+	core.rumble(0, 0, 0xffff)
+	<-na.Rumble()
+	core.rumble(0, 0, 0xffff)
+	select {
+	case got := <-na.Rumble():
+		if got.Strength != 0xffff {
+			t.Errorf("wrong rumble %+v", got)
+		}
+	default:
+		t.Errorf("the dropped rumble hasn't been sent again")
+	}
+}
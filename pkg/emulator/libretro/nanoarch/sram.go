@@ -0,0 +1,60 @@
+package nanoarch
+
+import (
+	"bytes"
+	"log"
+	"time"
+)
+
+// writeSRAM writes the game save RAM (battery save) into the file
+// if it has changed since the last write or restore.
+// Should be called under the emulator lock.
+func (na *naEmulator) writeSRAM() error {
+	sram := getSaveRAM()
+	if sram == nil || bytes.Equal(sram, na.sram) {
+		return nil
+	}
+	if err := toFile(na.GetSRAMPath(), sram); err != nil {
+		return err
+	}
+	na.sram = sram
+	return nil
+}
+
+// readSRAM restores the game save RAM from the file if there is one.
+// Should be called under the emulator lock after the game load and
+// before the first run of the core, otherwise the game
+// may initialize its own empty save.
+func (na *naEmulator) readSRAM() {
+	sram, err := fromFile(na.GetSRAMPath())
+	if err != nil {
+		return
+	}
+	restoreSaveRAM(sram)
+	na.sram = sram
+}
+
+// flushSRAM writes the changed game save RAM to the disk.
+// Deadlock warning: locks the emulator.
+func (na *naEmulator) flushSRAM() {
+	na.Lock()
+	defer na.Unlock()
+	if err := na.writeSRAM(); err != nil {
+		log.Printf("error: couldn't write the save RAM, %v", err)
+	}
+}
+
+// startSRAMFlush periodically writes the game save RAM to the disk
+// until the emulator is closed.
+func (na *naEmulator) startSRAMFlush(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-na.done:
+			return
+		case <-ticker.C:
+			na.flushSRAM()
+		}
+	}
+}
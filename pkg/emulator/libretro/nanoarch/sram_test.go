@@ -0,0 +1,107 @@
+//go:build corestub
+// +build corestub
+
+package nanoarch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSRAM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_sram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	core := stubCore{}
+	core.loadSRAM(0)
+
+	na := &naEmulator{
+		storage: Storage{Path: dir, MainSave: "test_sram", GameHash: "a9993e36", Flat: true},
+		roomID:  "test_sram",
+		done:    make(chan struct{}),
+	}
+
+	na.flushSRAM()
+	if _, err := os.Stat(na.GetSRAMPath()); err == nil {
+		t.Errorf("the save RAM has been written without the core support")
+	}
+
+	core.loadSRAM(64)
+	defer core.loadSRAM(0)
+	save := bytes.Repeat([]byte{0xbe, 0xef}, 32)
+	core.writeSRAM(save)
+	na.flushSRAM()
+	if data, err := ioutil.ReadFile(na.GetSRAMPath()); err != nil || !bytes.Equal(data, save) {
+		t.Fatalf("wrong save RAM file %v, %v", data, err)
+	}
+
+	// a new game run
+	core.loadSRAM(64)
+	restored := &naEmulator{storage: na.storage, roomID: na.roomID}
+	if err := restored.LoadGame(); err != nil {
+		t.Fatalf("couldn't load the game, %v", err)
+	}
+	if !bytes.Equal(core.sram(), save) {
+		t.Errorf("wrong restored save RAM %v", core.sram())
+	}
+
+	// the save RAM is written only after changes
+	if err := os.Remove(na.GetSRAMPath()); err != nil {
+		t.Fatal(err)
+	}
+	restored.flushSRAM()
+	if _, err := os.Stat(na.GetSRAMPath()); err == nil {
+		t.Errorf("unchanged save RAM has been written")
+	}
+}
+
+func TestSRAMPeriodicFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_sram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	core := stubCore{}
+	core.loadSRAM(16)
+	defer core.loadSRAM(0)
+
+	na := &naEmulator{
+		storage: Storage{Path: dir, MainSave: "test_sram_flush", Flat: true},
+		roomID:  "test_sram_flush",
+		done:    make(chan struct{}),
+	}
+	flushed := make(chan struct{})
+	go func() {
+		na.startSRAMFlush(10 * time.Millisecond)
+		close(flushed)
+	}()
+
+	save := []byte("battery save")
+	na.Lock()
+	core.writeSRAM(save)
+	na.Unlock()
+	for timeout := time.After(time.Second); ; {
+		if data, _ := ioutil.ReadFile(na.GetSRAMPath()); bytes.HasPrefix(data, save) {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("the save RAM hasn't been flushed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	na.Close()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Errorf("the flush hasn't stopped after close")
+	}
+}
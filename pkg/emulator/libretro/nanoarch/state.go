@@ -90,6 +90,15 @@ func getMemoryData(id uint) unsafe.Pointer {
 	return C.bridge_retro_get_memory_data(retroGetMemoryData, C.uint(id))
 }
 
+// ptSystemRAM returns the system RAM memory pointer if core supports it or nil.
+func ptSystemRAM() *mem {
+	ptr, size := getMemoryData(C.RETRO_MEMORY_SYSTEM_RAM), getMemorySize(C.RETRO_MEMORY_SYSTEM_RAM)
+	if ptr == nil || size == 0 {
+		return nil
+	}
+	return &mem{ptr: ptr, size: size}
+}
+
 // ptSaveRam return SRAM memory pointer if core supports it or nil.
 func ptSaveRAM() *mem {
 	ptr, size := getMemoryData(C.RETRO_MEMORY_SAVE_RAM), getMemorySize(C.RETRO_MEMORY_SAVE_RAM)
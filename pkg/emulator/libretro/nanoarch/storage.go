@@ -1,6 +1,17 @@
 package nanoarch
 
-import "path/filepath"
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
 
 type Storage struct {
 	// save path without the dir slash in the end
@@ -10,7 +21,152 @@ type Storage struct {
 	// needed for Google Cloud save/restore which
 	// doesn't support multiple files
 	MainSave string
+	// the hash of the game file which keys the game save RAM
+	// so it won't be loaded into another (version of the) game
+	GameHash string
+	// all the files of the rooms are in the Path dir (older versions),
+	// otherwise each room has its own dir there
+	Flat bool
+}
+
+// Dir returns the dir of the files of the room, e.g. <path>/abc<...>293.
+func (s *Storage) Dir() string {
+	if s.Flat {
+		return s.Path
+	}
+	return filepath.Join(s.Path, s.MainSave)
+}
+
+func (s *Storage) GetSavePath() string { return filepath.Join(s.Dir(), s.MainSave+".dat") }
+
+// GetSRAMPath returns the path of the game save RAM (battery save) file of the room,
+// e.g. <game sha1>.srm in the dir of the room, so it follows the game content and not its file name,
+// or abc<...>293.<game sha1>.srm in the flat storage shared by the rooms.
+// The games without the hash have the save RAM of the room, e.g. abc<...>293.srm.
+func (s *Storage) GetSRAMPath() string {
+	switch {
+	case s.GameHash == "":
+		return filepath.Join(s.Dir(), s.MainSave+".srm")
+	case s.Flat:
+		return filepath.Join(s.Dir(), s.MainSave+"."+s.GameHash+".srm")
+	default:
+		return filepath.Join(s.Dir(), s.GameHash+".srm")
+	}
+}
+
+// GetLegacySRAMPaths returns the paths of the save RAM files of the room
+// of the older versions from the newest one, i.e. abc<...>293.<game sha1>.srm
+// and abc<...>293.srm, or nothing for the games without the hash.
+func (s *Storage) GetLegacySRAMPaths() (paths []string) {
+	if s.GameHash == "" {
+		return nil
+	}
+	if !s.Flat {
+		paths = append(paths, filepath.Join(s.Dir(), s.MainSave+"."+s.GameHash+".srm"))
+	}
+	return append(paths, filepath.Join(s.Dir(), s.MainSave+".srm"))
+}
+
+// GetOptionsPath returns the path of the core options changed at runtime.
+func (s *Storage) GetOptionsPath() string { return filepath.Join(s.Dir(), s.MainSave+".opt") }
+
+// GetSlotPath returns the path of a save state file of the slot,
+// e.g. abc<...>293.1.state.
+// Slot 0 is the main save.
+func (s *Storage) GetSlotPath(slot int) string {
+	if slot == 0 {
+		return s.GetSavePath()
+	}
+	return filepath.Join(s.Dir(), fmt.Sprintf("%s.%d.state", s.MainSave, slot))
 }
 
-func (s *Storage) GetSavePath() string { return filepath.Join(s.Path, s.MainSave+".dat") }
-func (s *Storage) GetSRAMPath() string { return filepath.Join(s.Path, s.MainSave+".srm") }
+// GetDiscPath returns the path of the file with the disc index of
+// the multi-disc game saved along with the slot state, e.g. abc<...>293.1.disc.
+func (s *Storage) GetDiscPath(slot int) string {
+	if slot == 0 {
+		return filepath.Join(s.Dir(), s.MainSave+".disc")
+	}
+	return filepath.Join(s.Dir(), fmt.Sprintf("%s.%d.disc", s.MainSave, slot))
+}
+
+// GetSlots returns the sorted list of slots which have save state files.
+func (s *Storage) GetSlots() (slots []int) {
+	files, err := ioutil.ReadDir(s.Dir())
+	if err != nil {
+		return
+	}
+	main := filepath.Base(s.GetSavePath())
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		name := f.Name()
+		if name == main {
+			slots = append(slots, 0)
+			continue
+		}
+		if !strings.HasPrefix(name, s.MainSave+".") || !strings.HasSuffix(name, ".state") {
+			continue
+		}
+		slot, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, s.MainSave+"."), ".state"))
+		if err != nil || slot <= 0 {
+			continue
+		}
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+	return
+}
+
+// MoveLegacyFiles makes the dir of the room and moves there the files
+// of the room from the flat storage of the older versions
+// (all the abc<...>293.* files, i.e. the states, thumbnails, options, save RAM).
+// The save RAM of the room of the older versions is renamed then into the current one,
+// the game save RAM files of the flat storage shared by the rooms are left as is.
+// It returns the number of the moved files.
+func (s *Storage) MoveLegacyFiles() (int, error) {
+	if err := os.MkdirAll(s.Dir(), 0755); err != nil {
+		return 0, err
+	}
+	n := 0
+	if !s.Flat {
+		moved, err := s.moveFlatFiles()
+		if err != nil {
+			return moved, err
+		}
+		n = moved
+	}
+	for _, legacy := range s.GetLegacySRAMPaths() {
+		moved, err := emulator.MoveLegacyFile(s.GetSRAMPath(), legacy)
+		if err != nil {
+			return n, err
+		}
+		if moved {
+			return n + 1, nil
+		}
+	}
+	return n, nil
+}
+
+// moveFlatFiles moves the files of the room from the flat storage into its dir.
+func (s *Storage) moveFlatFiles() (int, error) {
+	files, err := ioutil.ReadDir(s.Path)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), s.MainSave+".") {
+			continue
+		}
+		path := filepath.Join(s.Dir(), f.Name())
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.Rename(filepath.Join(s.Path, f.Name()), path); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,163 @@
+package nanoarch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStorageSlots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_slots")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := Storage{Path: dir, MainSave: "abc293___Super Mario Bros."}
+	if err := os.MkdirAll(store.Dir(), 0755); err != nil {
+		t.Fatalf("couldn't make the room dir, %v", err)
+	}
+	if slots := store.GetSlots(); len(slots) != 0 {
+		t.Errorf("expected no slots, got %v", slots)
+	}
+
+	if path := store.GetSlotPath(0); path != store.GetSavePath() {
+		t.Errorf("slot 0 should be the main save, got %v", path)
+	}
+	if path := store.GetSlotPath(2); path != filepath.Join(dir, "abc293___Super Mario Bros.", "abc293___Super Mario Bros..2.state") {
+		t.Errorf("wrong slot path %v", path)
+	}
+
+	for _, f := range []string{
+		store.GetSlotPath(10),
+		store.GetSlotPath(2),
+		store.GetSlotPath(0),
+		store.GetSRAMPath(),
+		filepath.Join(store.Dir(), "abc293___Super Mario Bros..x.state"),
+		filepath.Join(store.Dir(), "other.1.state"),
+	} {
+		if err := ioutil.WriteFile(f, []byte{1}, 0644); err != nil {
+			t.Fatalf("couldn't write a file, %v", err)
+		}
+	}
+
+	if slots := store.GetSlots(); !reflect.DeepEqual(slots, []int{0, 2, 10}) {
+		t.Errorf("wrong slots %v", slots)
+	}
+}
+
+func TestStorageLegacyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_legacy")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := Storage{Path: dir, MainSave: "abc293___Super Mario Bros.", GameHash: "a9993e36"}
+	// the flat storage of the older versions
+	flat := Storage{Path: dir, MainSave: store.MainSave, GameHash: store.GameHash, Flat: true}
+	moved := []string{
+		flat.GetSavePath(),
+		flat.GetSlotPath(2),
+		flat.GetSlotPath(2) + "-thumb.jpg",
+		flat.GetDiscPath(2),
+		flat.GetOptionsPath(),
+	}
+	kept := []string{
+		// the save RAM of the game shared by the rooms
+		filepath.Join(dir, store.GameHash+".srm"),
+		filepath.Join(dir, "def456___Contra.dat"),
+	}
+	sram := flat.GetSRAMPath()
+	for _, f := range append(append(moved, kept...), sram) {
+		if err := ioutil.WriteFile(f, []byte(filepath.Base(f)), 0644); err != nil {
+			t.Fatalf("couldn't write a file, %v", err)
+		}
+	}
+
+	n, err := store.MoveLegacyFiles()
+	if err != nil {
+		t.Fatalf("couldn't move the files, %v", err)
+	}
+	// the save RAM of the room is moved and renamed
+	if n != len(moved)+2 {
+		t.Errorf("wrong number of the moved files %v", n)
+	}
+	for _, f := range moved {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("the legacy file %v is still there", f)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(store.Dir(), filepath.Base(f)))
+		if err != nil || string(data) != filepath.Base(f) {
+			t.Errorf("the file %v is not in the room dir, %v", f, err)
+		}
+	}
+	for _, f := range kept {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("the file %v is not kept, %v", f, err)
+		}
+	}
+	if data, err := ioutil.ReadFile(store.GetSRAMPath()); err != nil || string(data) != filepath.Base(sram) {
+		t.Errorf("the save RAM of the room is not moved, %v", err)
+	}
+	if slots := store.GetSlots(); !reflect.DeepEqual(slots, []int{0, 2}) {
+		t.Errorf("wrong slots %v", slots)
+	}
+
+	// the room files are not replaced with the legacy ones
+	if err := ioutil.WriteFile(flat.GetSavePath(), []byte("old"), 0644); err != nil {
+		t.Fatalf("couldn't write a file, %v", err)
+	}
+	if n, err := store.MoveLegacyFiles(); err != nil || n != 0 {
+		t.Errorf("wrong move of the existing files %v, %v", n, err)
+	}
+	if data, _ := ioutil.ReadFile(store.GetSavePath()); string(data) == "old" {
+		t.Errorf("the room save has been replaced")
+	}
+}
+
+// Tests that the save RAM files of the rooms of the older versions
+// become the current ones of the same rooms only.
+func TestStorageLegacySRAM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_legacy_sram")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	write := func(path, data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("couldn't write a file, %v", err)
+		}
+	}
+	// the save RAM of the game shared by the rooms
+	write(filepath.Join(dir, "a9993e36.srm"), "game")
+
+	tests := []struct {
+		name  string
+		store Storage
+		// the save RAM file of the older version
+		legacy string
+	}{
+		{name: "room", store: Storage{Path: dir, MainSave: "abc293", GameHash: "a9993e36"}, legacy: "abc293.srm"},
+		{name: "flat", store: Storage{Path: dir, MainSave: "abc294", GameHash: "a9993e36", Flat: true}, legacy: "abc294.srm"},
+		{name: "no save RAM", store: Storage{Path: dir, MainSave: "abc295", GameHash: "a9993e36"}},
+	}
+	for _, test := range tests {
+		if test.legacy != "" {
+			write(filepath.Join(dir, test.legacy), test.name)
+		}
+		if _, err := test.store.MoveLegacyFiles(); err != nil {
+			t.Fatalf("%v: couldn't move the files, %v", test.name, err)
+		}
+		data, err := ioutil.ReadFile(test.store.GetSRAMPath())
+		switch {
+		case test.legacy == "" && err == nil:
+			t.Errorf("%v: the room has the save RAM %q of another room", test.name, data)
+		case test.legacy != "" && string(data) != test.name:
+			t.Errorf("%v: wrong save RAM %q, %v", test.name, data, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package emulator
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlaylistExt is the extension of the multi-disc game playlists.
+const PlaylistExt = ".m3u"
+
+// IsPlaylist tells if the game file is a multi-disc playlist.
+func IsPlaylist(path string) bool { return strings.EqualFold(filepath.Ext(path), PlaylistExt) }
+
+// ReadPlaylist reads the disc image paths of the .m3u playlist:
+//
+//	#EXTM3U
+//	Game (Disc 1).cue
+//	Game (Disc 2).cue
+//
+// The comments and empty lines are skipped.
+func ReadPlaylist(r io.Reader) ([]string, error) {
+	var discs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		discs = append(discs, filepath.FromSlash(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return discs, nil
+}
+
+// LoadPlaylist reads the playlist file, the relative disc paths
+// are resolved against the playlist directory.
+func LoadPlaylist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	discs, err := ReadPlaylist(f)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	for i, disc := range discs {
+		if !filepath.IsAbs(disc) {
+			discs[i] = filepath.Join(dir, disc)
+		}
+	}
+	return discs, nil
+}
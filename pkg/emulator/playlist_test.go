@@ -0,0 +1,45 @@
+package emulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPlaylist(t *testing.T) {
+	discs, err := ReadPlaylist(strings.NewReader("#EXTM3U\n\nGame (Disc 1).cue\r\n  # disc 2\ndiscs/Game (Disc 2).cue\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Game (Disc 1).cue", filepath.FromSlash("discs/Game (Disc 2).cue")}
+	if !reflect.DeepEqual(discs, want) {
+		t.Errorf("wrong discs %v, expected %v", discs, want)
+	}
+}
+
+func TestLoadPlaylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "Game.M3U")
+	if !IsPlaylist(path) || IsPlaylist(filepath.Join(dir, "Game.cue")) {
+		t.Errorf("wrong playlist detection")
+	}
+	if err := ioutil.WriteFile(path, []byte("Game (Disc 1).cue\n/games/Game (Disc 2).cue\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	discs, err := LoadPlaylist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "Game (Disc 1).cue"), "/games/Game (Disc 2).cue"}
+	if !reflect.DeepEqual(discs, want) {
+		t.Errorf("wrong discs %v, expected %v", discs, want)
+	}
+}
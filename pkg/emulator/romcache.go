@@ -0,0 +1,165 @@
+package emulator
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RomCache keeps the extracted game archives for the cores
+// which can't load games from memory.
+// The archives are extracted once into the directories named by
+// the archive hash and shared between the rooms.
+// The extracted archives are in use until they are released
+// and only the unused ones are removed.
+type RomCache struct {
+	Dir string
+	// MaxSize is the max size in bytes of all the extracted archives,
+	// the least recently used ones are removed, 0 -- no limit
+	MaxSize int64
+}
+
+// cacheLock guards the cache directories of the process.
+var cacheLock sync.Mutex
+
+// cacheRefs is the number of the uses of the extracted archives
+// of the process by their hashes, guarded by the cacheLock.
+var cacheRefs = map[string]int{}
+
+var errNoCache = errors.New("no cache directory for the archives")
+
+// Extract returns the path of the archive member extracting the archive if needed.
+// The path should be released with Release after its use.
+func (c RomCache) Extract(archive string, member string) (string, error) {
+	if c.Dir == "" {
+		return "", errNoCache
+	}
+	hash, err := GameHash(archive)
+	if err != nil {
+		return "", err
+	}
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	dir := filepath.Join(c.Dir, hash)
+	path, err := memberPath(dir, member)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err == nil {
+		now := time.Now()
+		_ = os.Chtimes(dir, now, now)
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		cacheRefs[hash]++
+		return path, nil
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(c.Dir, ".extract")
+	if err != nil {
+		return "", err
+	}
+	if err := extractArchive(archive, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", err
+	}
+	// other workers may share the cache
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.RemoveAll(tmp)
+		if _, e := os.Stat(dir); e != nil {
+			return "", err
+		}
+	}
+	log.Printf("Extracted %v into %v", archive, dir)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	cacheRefs[hash]++
+	c.evict()
+	return path, nil
+}
+
+// Release tells the cache that the extracted file of the path isn't used anymore,
+// the paths out of the cache are skipped.
+func (c RomCache) Release(path string) {
+	if c.Dir == "" {
+		return
+	}
+	rel, err := filepath.Rel(c.Dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return
+	}
+	hash := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if cacheRefs[hash] <= 1 {
+		delete(cacheRefs, hash)
+		return
+	}
+	cacheRefs[hash]--
+}
+
+// evict removes the least recently used extracted archives
+// which are not in use until the cache fits the max size.
+// Should be called under the cacheLock.
+func (c RomCache) evict() {
+	if c.MaxSize <= 0 {
+		return
+	}
+	files, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	type entry struct {
+		name string
+		size int64
+		used time.Time
+	}
+	var entries []entry
+	var total int64
+	for _, f := range files {
+		if !f.IsDir() || f.Name()[0] == '.' {
+			continue
+		}
+		size := dirSize(filepath.Join(c.Dir, f.Name()))
+		entries = append(entries, entry{name: f.Name(), size: size, used: f.ModTime()})
+		total += size
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	for _, e := range entries {
+		if total <= c.MaxSize {
+			return
+		}
+		if cacheRefs[e.name] > 0 {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.Dir, e.name)); err != nil {
+			log.Printf("warn: couldn't remove the cached archive %v, %v", e.name, err)
+			continue
+		}
+		total -= e.size
+	}
+}
+
+// dirSize returns the size of all the files in the directory.
+func dirSize(dir string) (size int64) {
+	_ = filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,171 @@
+// Package viewport computes the size of the video frames of the games
+// for the scaling modes of the viewport (letterboxing, integer scaling).
+// The sizes are even for the video encoders (YUV 4:2:0).
+package viewport
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+)
+
+// The scaling modes of the game frames in the viewport.
+const (
+	// Native is the native size of the game frames without viewport.
+	Native = "native"
+	// Fit is the largest picture of the game aspect ratio in the viewport,
+	// the rest of the viewport is letterboxed (default).
+	Fit = "fit"
+	// Fill is the smallest picture of the game aspect ratio covering
+	// the whole viewport, the picture is cropped.
+	Fill = "fill"
+	// Integer is the largest integer multiple of the native size of the game
+	// in the viewport, the pixels of the game are square and don't shimmer.
+	// The games larger than the viewport fit into it.
+	Integer = "integer"
+	// Stretch is the whole viewport regardless of the game aspect ratio.
+	Stretch = "stretch"
+)
+
+// ErrMode is returned for the unknown scaling modes, they fit.
+var ErrMode = errors.New("unknown scaling mode")
+
+// Crop is the part of the game frames in the fractions (0-1) of their size,
+// the zero crop is the whole frames.
+type Crop struct {
+	X, Y, W, H float64
+}
+
+// Rect returns the part of the frames of w x h.
+func (c Crop) Rect(w, h int) image.Rectangle {
+	if c == (Crop{}) {
+		return image.Rect(0, 0, w, h)
+	}
+	x0, y0 := int(math.Round(c.X*float64(w))), int(math.Round(c.Y*float64(h)))
+	x1, y1 := x0+int(math.Round(c.W*float64(w))), y0+int(math.Round(c.H*float64(h)))
+	return image.Rect(x0, y0, max(x1, x0+1), max(y1, y0+1)).Intersect(image.Rect(0, 0, w, h))
+}
+
+// Game is the picture of the game.
+type Game struct {
+	// the native size of the frames before the rotation
+	Width, Height int
+	// the display aspect ratio of the frames before the rotation,
+	// 0 -- of the native size
+	Ratio float64
+	// the game is rotated by 90 or 270 degrees
+	Rotated bool
+}
+
+// Viewport is the size of the video frames of the game after its rotation.
+type Viewport struct {
+	Mode          string
+	Width, Height int
+	// the part of the game frames in the video, only the fill mode crops them
+	Crop Crop
+}
+
+// New returns the video of the game in the viewport of w x h with the mode,
+// the viewport without size (0) has the native size of the game.
+// The unknown modes fit with ErrMode.
+func New(mode string, game Game, w, h int) (Viewport, error) {
+	gw, gh, ratio := game.Width, game.Height, game.Ratio
+	if gw <= 0 || gh <= 0 {
+		return Viewport{Mode: Native}, fmt.Errorf("bad game size %vx%v", gw, gh)
+	}
+	if ratio <= 0 {
+		ratio = float64(gw) / float64(gh)
+	}
+	if game.Rotated {
+		gw, gh, ratio = gh, gw, 1/ratio
+	}
+
+	var err error
+	switch mode {
+	case Native, Fit, Fill, Integer, Stretch:
+	case "":
+		mode = Fit
+	default:
+		err = fmt.Errorf("%w %v", ErrMode, mode)
+		mode = Fit
+	}
+	w, h = floorEven(w), floorEven(h)
+	if w < 2 || h < 2 {
+		mode = Native
+	}
+
+	v := Viewport{Mode: mode}
+	switch mode {
+	case Native:
+		v.Width, v.Height = evenSize(gw), evenSize(gh)
+	case Fit:
+		v.Width, v.Height = fit(ratio, w, h)
+	case Fill:
+		v.Width, v.Height = w, h
+		v.Crop = fill(ratio, w, h)
+	case Integer:
+		if n := min(w/gw, h/gh); n >= 1 {
+			v.Width, v.Height = evenSize(gw*n), evenSize(gh*n)
+		} else {
+			v.Width, v.Height = fit(float64(gw)/float64(gh), w, h)
+		}
+	case Stretch:
+		v.Width, v.Height = w, h
+	}
+	return v, err
+}
+
+// Scale returns the viewport scaled n times.
+func (v Viewport) Scale(n int) Viewport {
+	if n > 1 {
+		v.Width, v.Height = v.Width*n, v.Height*n
+	}
+	return v
+}
+
+// fit returns the largest size of the aspect ratio in w x h.
+func fit(ratio float64, w, h int) (int, int) {
+	if float64(h)*ratio <= float64(w) {
+		return min(roundEven(float64(h)*ratio), w), h
+	}
+	return w, min(roundEven(float64(w)/ratio), h)
+}
+
+// fill returns the part of the picture of the aspect ratio covering w x h.
+func fill(ratio float64, w, h int) Crop {
+	target := float64(w) / float64(h)
+	switch {
+	case ratio > target:
+		part := target / ratio
+		return Crop{X: (1 - part) / 2, W: part, H: 1}
+	case ratio < target:
+		part := ratio / target
+		return Crop{Y: (1 - part) / 2, W: 1, H: part}
+	}
+	return Crop{}
+}
+
+// roundEven rounds the size to the nearest even one (at least 2).
+func roundEven(x float64) int { return max(int(math.Round(x/2))*2, 2) }
+
+// floorEven rounds the size down to the even one.
+func floorEven(x int) int { return x &^ 1 }
+
+// evenSize rounds the size down to the even one (at least 2),
+// the odd frames lose one pixel.
+func evenSize(x int) int { return max(floorEven(x), 2) }
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,156 @@
+package viewport
+
+import (
+	"errors"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestViewport(t *testing.T) {
+	snes := Game{Width: 256, Height: 224, Ratio: 4.0 / 3}
+	nes := Game{Width: 256, Height: 240}
+	// a vertical arcade game of the horizontal frames
+	arcade := Game{Width: 288, Height: 224, Ratio: 4.0 / 3, Rotated: true}
+
+	tests := []struct {
+		name  string
+		mode  string
+		game  Game
+		w, h  int
+		want  Viewport
+		crop  bool
+		error bool
+	}{
+		// fit
+		{name: "fit default", game: nes, w: 640, h: 480, want: Viewport{Mode: Fit, Width: 512, Height: 480}},
+		{name: "fit ratio", mode: Fit, game: snes, w: 640, h: 480, want: Viewport{Mode: Fit, Width: 640, Height: 480}},
+		{name: "fit pillarbox", mode: Fit, game: snes, w: 1280, h: 720, want: Viewport{Mode: Fit, Width: 960, Height: 720}},
+		{name: "fit letterbox", mode: Fit, game: snes, w: 640, h: 720, want: Viewport{Mode: Fit, Width: 640, Height: 480}},
+		{name: "fit larger game", mode: Fit, game: Game{Width: 640, Height: 480}, w: 320, h: 200,
+			want: Viewport{Mode: Fit, Width: 266, Height: 200}},
+		// 200 * 256 / 240 = 213.3
+		{name: "fit even", mode: Fit, game: nes, w: 320, h: 200, want: Viewport{Mode: Fit, Width: 214, Height: 200}},
+		// 321x241 -> 320x240
+		{name: "fit odd viewport", mode: Fit, game: snes, w: 321, h: 241, want: Viewport{Mode: Fit, Width: 320, Height: 240}},
+		{name: "fit rotated", mode: Fit, game: arcade, w: 640, h: 480, want: Viewport{Mode: Fit, Width: 360, Height: 480}},
+		// fill
+		{name: "fill wide", mode: Fill, game: snes, w: 1280, h: 720, want: Viewport{Mode: Fill, Width: 1280, Height: 720},
+			crop: true},
+		{name: "fill tall", mode: Fill, game: snes, w: 480, h: 640, want: Viewport{Mode: Fill, Width: 480, Height: 640},
+			crop: true},
+		{name: "fill same", mode: Fill, game: snes, w: 640, h: 480, want: Viewport{Mode: Fill, Width: 640, Height: 480}},
+		{name: "fill rotated", mode: Fill, game: arcade, w: 640, h: 480, want: Viewport{Mode: Fill, Width: 640, Height: 480},
+			crop: true},
+		// integer
+		{name: "integer", mode: Integer, game: snes, w: 1280, h: 720, want: Viewport{Mode: Integer, Width: 768, Height: 672}},
+		{name: "integer exact", mode: Integer, game: nes, w: 512, h: 480, want: Viewport{Mode: Integer, Width: 512, Height: 480}},
+		{name: "integer rotated", mode: Integer, game: arcade, w: 640, h: 480, want: Viewport{Mode: Integer, Width: 224, Height: 288}},
+		{name: "integer odd game", mode: Integer, game: Game{Width: 255, Height: 223}, w: 600, h: 500,
+			want: Viewport{Mode: Integer, Width: 510, Height: 446}},
+		{name: "integer odd game once", mode: Integer, game: Game{Width: 255, Height: 223}, w: 300, h: 300,
+			want: Viewport{Mode: Integer, Width: 254, Height: 222}},
+		{name: "integer larger game", mode: Integer, game: Game{Width: 640, Height: 480}, w: 320, h: 320,
+			want: Viewport{Mode: Integer, Width: 320, Height: 240}},
+		// stretch
+		{name: "stretch", mode: Stretch, game: snes, w: 1280, h: 720, want: Viewport{Mode: Stretch, Width: 1280, Height: 720}},
+		{name: "stretch odd", mode: Stretch, game: snes, w: 1281, h: 721, want: Viewport{Mode: Stretch, Width: 1280, Height: 720}},
+		// native
+		{name: "native", mode: Native, game: snes, w: 1280, h: 720, want: Viewport{Mode: Native, Width: 256, Height: 224}},
+		{name: "native rotated", mode: Native, game: arcade, want: Viewport{Mode: Native, Width: 224, Height: 288}},
+		{name: "native odd", mode: Native, game: Game{Width: 255, Height: 1}, want: Viewport{Mode: Native, Width: 254, Height: 2}},
+		{name: "no viewport", mode: Fit, game: snes, w: 1, h: 0, want: Viewport{Mode: Native, Width: 256, Height: 224}},
+		// errors
+		{name: "unknown mode", mode: "zoom", game: snes, w: 640, h: 480, want: Viewport{Mode: Fit, Width: 640, Height: 480},
+			error: true},
+		{name: "no game", mode: Fit, game: Game{Width: 0, Height: 224}, w: 640, h: 480, want: Viewport{Mode: Native},
+			error: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := New(test.mode, test.game, test.w, test.h)
+			if (err != nil) != test.error {
+				t.Errorf("unexpected error %v", err)
+			}
+			crop := v.Crop
+			v.Crop = Crop{}
+			if v != test.want {
+				t.Errorf("wrong viewport %+v, expected %+v", v, test.want)
+			}
+			if (crop != Crop{}) != test.crop {
+				t.Errorf("wrong crop %+v", crop)
+			}
+			if v.Width%2 != 0 || v.Height%2 != 0 {
+				t.Errorf("odd viewport %vx%v", v.Width, v.Height)
+			}
+			if test.w >= 2 && test.h >= 2 && v.Mode != Native && (v.Width > test.w || v.Height > test.h) {
+				t.Errorf("the viewport %vx%v is larger than %vx%v", v.Width, v.Height, test.w, test.h)
+			}
+		})
+	}
+}
+
+// Tests that the cropped part of the filled game has the aspect ratio of the viewport.
+func TestViewportFillCrop(t *testing.T) {
+	tests := []struct {
+		game Game
+		w, h int
+		rect image.Rectangle
+	}{
+		// 4:3 in 16:9, (1 - 0.75) / 2 of the lines are cropped on the top and bottom
+		{game: Game{Width: 256, Height: 224, Ratio: 4.0 / 3}, w: 1280, h: 720, rect: image.Rect(0, 28, 256, 196)},
+		// 4:3 in 3:4
+		{game: Game{Width: 320, Height: 240}, w: 480, h: 640, rect: image.Rect(70, 0, 250, 240)},
+		// the rotated 3:4 in 4:3 (the frames of 224x288 after the rotation)
+		{game: Game{Width: 288, Height: 224, Ratio: 4.0 / 3, Rotated: true}, w: 640, h: 480, rect: image.Rect(0, 63, 224, 225)},
+	}
+	for _, test := range tests {
+		v, _ := New(Fill, test.game, test.w, test.h)
+		gw, gh := test.game.Width, test.game.Height
+		if test.game.Rotated {
+			gw, gh = gh, gw
+		}
+		rect := v.Crop.Rect(gw, gh)
+		if rect != test.rect {
+			t.Errorf("wrong crop %v of %+v, expected %v", rect, v.Crop, test.rect)
+		}
+		ratio := test.game.Ratio
+		if ratio == 0 {
+			ratio = float64(test.game.Width) / float64(test.game.Height)
+		}
+		if test.game.Rotated {
+			ratio = 1 / ratio
+		}
+		// the display ratio of the cropped part
+		cropped := ratio * v.Crop.W / v.Crop.H
+		if target := float64(test.w) / float64(test.h); math.Abs(cropped-target) > 1e-9 {
+			t.Errorf("wrong ratio %v of the cropped part, expected %v", cropped, target)
+		}
+	}
+}
+
+func TestViewportMode(t *testing.T) {
+	_, err := New("zoom", Game{Width: 256, Height: 224}, 640, 480)
+	if !errors.Is(err, ErrMode) {
+		t.Errorf("wrong error %v of the unknown mode", err)
+	}
+}
+
+func TestViewportScale(t *testing.T) {
+	v := Viewport{Mode: Fit, Width: 320, Height: 240}
+	if s := v.Scale(3); s.Width != 960 || s.Height != 720 {
+		t.Errorf("wrong scaled viewport %vx%v", s.Width, s.Height)
+	}
+	if s := v.Scale(0); s != v {
+		t.Errorf("the viewport has been scaled 0 times")
+	}
+}
+
+func TestCropRect(t *testing.T) {
+	if rect := (Crop{}).Rect(256, 224); rect != image.Rect(0, 0, 256, 224) {
+		t.Errorf("wrong rect %v of the zero crop", rect)
+	}
+	if rect := (Crop{X: 0.9, Y: 0.9, W: 0.5, H: 0.001}).Rect(100, 100); rect != image.Rect(90, 90, 100, 91) {
+		t.Errorf("wrong rect %v out of the frames", rect)
+	}
+}
@@ -0,0 +1,187 @@
+//go:build av1
+// +build av1
+
+package av1
+
+/*
+#cgo pkg-config: aom
+#cgo CFLAGS: -Wall -O3
+
+#include "aom/aom_encoder.h"
+#include "aom/aom_image.h"
+#include "aom/aomcx.h"
+
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct FrameBuffer {
+  void *ptr;
+  int size;
+} FrameBuffer;
+
+aom_codec_err_t call_aom_codec_enc_config_default(aom_codec_enc_cfg_t *cfg) {
+	return aom_codec_enc_config_default(aom_codec_av1_cx(), cfg, AOM_USAGE_REALTIME);
+}
+aom_codec_err_t call_aom_codec_enc_init(aom_codec_ctx_t *codec, aom_codec_enc_cfg_t *cfg) {
+	return aom_codec_enc_init(codec, aom_codec_av1_cx(), cfg, 0);
+}
+aom_codec_err_t call_aom_codec_control(aom_codec_ctx_t *codec, int id, int value) {
+	return aom_codec_control(codec, id, value);
+}
+
+FrameBuffer get_frame_buffer(aom_codec_ctx_t *codec, aom_codec_iter_t *iter) {
+    FrameBuffer fb = {NULL, 0};
+    const aom_codec_cx_pkt_t *pkt;
+    while ((pkt = aom_codec_get_cx_data(codec, iter)) != NULL) {
+        if (pkt->kind == AOM_CODEC_CX_FRAME_PKT) {
+            fb.ptr = pkt->data.frame.buf;
+            fb.size = pkt->data.frame.sz;
+            break;
+        }
+    }
+    return fb;
+}
+
+void aom_img_read(aom_image_t *dst, void *src) {
+	for (int plane = 0; plane < 3; ++plane) {
+		unsigned char *buf = dst->planes[plane];
+		const int stride = dst->stride[plane];
+		const int w = plane > 0 ? (dst->d_w + 1) >> dst->x_chroma_shift : dst->d_w;
+		const int h = plane > 0 ? (dst->d_h + 1) >> dst->y_chroma_shift : dst->d_h;
+
+		for (int y = 0; y < h; ++y) {
+			memcpy(buf, src, w);
+			buf += stride;
+			src += w;
+		}
+	}
+}
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+type Av1 struct {
+	frameCount C.int
+	image      C.aom_image_t
+	codecCtx   C.aom_codec_ctx_t
+	cfg        C.aom_codec_enc_cfg_t
+	kfi        C.int
+	// force the next frame to be a keyframe
+	kf bool
+
+	// the speed of the encoder for the restarts
+	speed C.int
+	// the error of the last frame
+	err error
+}
+
+// NewEncoder creates a new real-time AV1 encoder.
+func NewEncoder(width, height int, options ...Option) (*Av1, error) {
+	opts := &Options{
+		Bitrate:     1200,
+		KeyframeInt: 5,
+		Speed:       8,
+	}
+
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	enc := &Av1{kfi: C.int(opts.KeyframeInt), speed: C.int(opts.Speed)}
+
+	if C.aom_img_alloc(&enc.image, C.AOM_IMG_FMT_I420, C.uint(width), C.uint(height), 1) == nil {
+		return nil, fmt.Errorf("aom_img_alloc failed")
+	}
+
+	cfg := &enc.cfg
+	if C.call_aom_codec_enc_config_default(cfg) != 0 {
+		C.aom_img_free(&enc.image)
+		return nil, fmt.Errorf("failed to get default codec config")
+	}
+
+	cfg.g_w = C.uint(width)
+	cfg.g_h = C.uint(height)
+	cfg.rc_target_bitrate = C.uint(opts.Bitrate)
+	if opts.Fps > 0 {
+		// the frames go one by one (pts + 1)
+		cfg.g_timebase.num, cfg.g_timebase.den = 1000, C.int(math.Round(opts.Fps*1000))
+	}
+	cfg.rc_end_usage = C.AOM_CBR
+	cfg.g_error_resilient = 1
+	cfg.g_lag_in_frames = 0
+
+	if err := enc.init(); err != nil {
+		C.aom_img_free(&enc.image)
+		return nil, err
+	}
+	return enc, nil
+}
+
+// init initializes the codec context with the config.
+func (a *Av1) init() error {
+	if C.call_aom_codec_enc_init(&a.codecCtx, &a.cfg) != 0 {
+		return fmt.Errorf("failed to initialize encoder")
+	}
+
+	if C.call_aom_codec_control(&a.codecCtx, C.AOME_SET_CPUUSED, a.speed) != 0 {
+		C.aom_codec_destroy(&a.codecCtx)
+		return fmt.Errorf("failed to set the encoder speed")
+	}
+	return nil
+}
+
+// see: https://aomedia.googlesource.com/aom/+/master/examples/simple_encoder.c
+func (a *Av1) Encode(yuv []byte) []byte {
+	var iter C.aom_codec_iter_t
+	C.aom_img_read(&a.image, unsafe.Pointer(&yuv[0]))
+
+	var flags C.int
+	if a.kf || a.kfi > 0 && a.frameCount%a.kfi == 0 {
+		flags |= C.AOM_EFLAG_FORCE_KF
+		a.kf = false
+	}
+	ret := C.aom_codec_encode(&a.codecCtx, &a.image, C.aom_codec_pts_t(a.frameCount), 1, C.aom_enc_frame_flags_t(flags))
+	a.frameCount++
+	if a.err = nil; ret != 0 {
+		a.err = fmt.Errorf("failed to encode frame, %v", C.GoString(C.aom_codec_error(&a.codecCtx)))
+		return []byte{}
+	}
+
+	fb := C.get_frame_buffer(&a.codecCtx, &iter)
+	if fb.ptr == nil {
+		return []byte{}
+	}
+	// the encoder memory is valid until the next call
+	return (*[1 << 30]byte)(fb.ptr)[:fb.size:fb.size]
+}
+
+func (a *Av1) ForceKeyframe() { a.kf = true }
+
+// Err returns the error of the last encoded frame.
+func (a *Av1) Err() error { return a.err }
+
+// Reset reinitializes the codec context with the current config.
+func (a *Av1) Reset() error {
+	C.aom_codec_destroy(&a.codecCtx)
+	a.err, a.kf = nil, true
+	return a.init()
+}
+
+// SetBitrate changes the target bitrate (kbit/s).
+func (a *Av1) SetBitrate(kbps uint) error {
+	a.cfg.rc_target_bitrate = C.uint(kbps)
+	if C.aom_codec_enc_config_set(&a.codecCtx, &a.cfg) != 0 {
+		return fmt.Errorf("failed to set the bitrate")
+	}
+	return nil
+}
+
+func (a *Av1) Shutdown() error {
+	C.aom_img_free(&a.image)
+	C.aom_codec_destroy(&a.codecCtx)
+	return nil
+}
@@ -0,0 +1,31 @@
+package av1
+
+import "errors"
+
+// ErrUnavailable is returned when the app is built without libaom.
+var ErrUnavailable = errors.New("AV1 encoder is not available, build with the av1 tag and libaom")
+
+type Options struct {
+	// Target bandwidth to use for this stream, in kilobits per second.
+	Bitrate uint
+	// Force keyframe interval.
+	KeyframeInt uint
+	// Encoding speed (cpu-used) 0-10,
+	// the higher values are faster with lower quality.
+	Speed int
+	// The frame rate of the video for the rate control, the libaom default (30) if zero.
+	Fps float64
+}
+
+type Option func(*Options)
+
+func WithOptions(arg Options) Option {
+	return func(args *Options) {
+		args.Bitrate = arg.Bitrate
+		args.KeyframeInt = arg.KeyframeInt
+		args.Fps = arg.Fps
+		if arg.Speed > 0 {
+			args.Speed = arg.Speed
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !av1
+// +build !av1
+
+package av1
+
+type Av1 struct{}
+
+// NewEncoder always fails without the av1 build tag.
+// The callers should fallback to some other codec.
+func NewEncoder(_, _ int, _ ...Option) (*Av1, error) { return nil, ErrUnavailable }
+
+func (a *Av1) Encode([]byte) []byte  { return nil }
+func (a *Av1) ForceKeyframe()        {}
+func (a *Av1) SetBitrate(uint) error { return ErrUnavailable }
+func (a *Av1) Err() error            { return nil }
+func (a *Av1) Reset() error          { return ErrUnavailable }
+func (a *Av1) Shutdown() error       { return nil }
@@ -0,0 +1,67 @@
+package filter
+
+import "image"
+
+const (
+	// crtCurvature is the barrel distortion of the CRT screen
+	crtCurvature = 0.08
+	// crtVignette is how darker the corners are (0..1)
+	crtVignette = 0.35
+)
+
+// crt bends the frame like a CRT screen and darkens its edges (vignette).
+// The source pixels and the brightness of each pixel are computed once
+// for the frame size, the screen is symmetric so the rotation doesn't matter.
+type crt struct {
+	buf *image.RGBA
+	// the source pixel offset of each pixel, -1 for the black ones
+	src []int32
+	// the brightness (x/256) of each pixel
+	shade []uint16
+}
+
+func newCRT(w, h int) *crt {
+	c := &crt{
+		buf:   image.NewRGBA(image.Rect(0, 0, w, h)),
+		src:   make([]int32, w*h),
+		shade: make([]uint16, w*h),
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// from -1 to 1 from the center
+			u := 2*(float64(x)+0.5)/float64(w) - 1
+			v := 2*(float64(y)+0.5)/float64(h) - 1
+			r2 := u*u + v*v
+			su, sv := u*(1+crtCurvature*r2), v*(1+crtCurvature*r2)
+			i := y*w + x
+			if su < -1 || su >= 1 || sv < -1 || sv >= 1 {
+				c.src[i] = -1
+				continue
+			}
+			sx, sy := int((su+1)*float64(w)/2), int((sv+1)*float64(h)/2)
+			c.src[i] = int32(sy*w*4 + sx*4)
+			c.shade[i] = uint16(256 * (1 - crtVignette*r2/2))
+		}
+	}
+	return c
+}
+
+func (c *crt) Apply(src *image.RGBA) *image.RGBA {
+	if !sameSize(src, c.buf) || src.Stride != c.buf.Stride {
+		return src
+	}
+	out := c.buf.Pix
+	for i, from := range c.src {
+		px := out[i*4 : i*4+4 : i*4+4]
+		if from < 0 {
+			px[0], px[1], px[2], px[3] = 0, 0, 0, 0xff
+			continue
+		}
+		in, shade := src.Pix[from:from+4:from+4], c.shade[i]
+		px[0] = uint8(uint16(in[0]) * shade >> 8)
+		px[1] = uint8(uint16(in[1]) * shade >> 8)
+		px[2] = uint8(uint16(in[2]) * shade >> 8)
+		px[3] = in[3]
+	}
+	return c.buf
+}
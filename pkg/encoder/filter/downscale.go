@@ -0,0 +1,66 @@
+package filter
+
+import "image"
+
+// downscale shrinks the frames to its size with the average of the source
+// pixels of each of its pixels (the area or box filter).
+// It's fast and doesn't alias as much as the nearest-neighbor one.
+type downscale struct {
+	buf *image.RGBA
+	// the bounds of the source columns and lines of the pixels,
+	// made for the source size
+	xs, ys []int
+	sw, sh int
+}
+
+// NewDownscale returns the filter shrinking the frames to w x h.
+// The frames of the same size or smaller ones go as is.
+func NewDownscale(w, h int) Filter {
+	return &downscale{buf: image.NewRGBA(image.Rect(0, 0, w, h)), xs: make([]int, w+1), ys: make([]int, h+1)}
+}
+
+func (d *downscale) Apply(src *image.RGBA) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	w, h := d.buf.Rect.Dx(), d.buf.Rect.Dy()
+	if sw < w || sh < h || sw == w && sh == h {
+		return src
+	}
+	if sw != d.sw || sh != d.sh {
+		d.sw, d.sh = sw, sh
+		bounds(d.xs, sw)
+		bounds(d.ys, sh)
+	}
+	for y := 0; y < h; y++ {
+		y0, y1 := d.ys[y], d.ys[y+1]
+		out := d.buf.Pix[y*d.buf.Stride:]
+		for x := 0; x < w; x++ {
+			x0, x1 := d.xs[x], d.xs[x+1]
+			var r, g, b, a int
+			for sy := y0; sy < y1; sy++ {
+				line := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(line); i += 4 {
+					r += int(line[i])
+					g += int(line[i+1])
+					b += int(line[i+2])
+					a += int(line[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			i := x * 4
+			out[i] = uint8((r + n/2) / n)
+			out[i+1] = uint8((g + n/2) / n)
+			out[i+2] = uint8((b + n/2) / n)
+			out[i+3] = uint8((a + n/2) / n)
+		}
+	}
+	return d.buf
+}
+
+// bounds splits the source size into len(b)-1 parts of at least one pixel,
+// the part i is [b[i], b[i+1]).
+func bounds(b []int, size int) {
+	n := len(b) - 1
+	for i := range b {
+		b[i] = i * size / n
+	}
+}
@@ -0,0 +1,78 @@
+// Package filter contains the post-processing of the video frames
+// (scanlines, CRT, smoothing) applied before their encoding.
+// The filters reuse their buffers made for the frame size,
+// so they don't allocate memory per frame.
+package filter
+
+import (
+	"fmt"
+	"image"
+)
+
+// The names of the filters.
+const (
+	// Nearest upscales the small frames with the nearest-neighbor interpolation
+	Nearest = "nearest"
+	// Bilinear upscales the small frames with the bilinear interpolation
+	Bilinear = "bilinear"
+	// Scanlines darkens every other line of the game
+	Scanlines = "scanlines"
+	// CRT bends the frame like a CRT screen with the darker corners
+	CRT = "crt"
+)
+
+// Filter processes the frames of the same size,
+// the result is valid until the next frame.
+// The input frame isn't changed.
+type Filter interface {
+	Apply(src *image.RGBA) *image.RGBA
+}
+
+// Chain is the list of filters applied one by one.
+type Chain []Filter
+
+// New makes the chain of the filters by their names for the frames of w x h.
+// The upscale filter goes first, the frames of any size are upscaled
+// to w x h with it.
+// The rotated flag tells that the game is rotated by 90 or 270 degrees,
+// so its lines are vertical.
+func New(names []string, w, h int, rotated bool) (Chain, error) {
+	var chain Chain
+	for _, name := range names {
+		var f Filter
+		switch name {
+		case Nearest, Bilinear:
+			if len(chain) > 0 && isScale(chain[0]) {
+				return nil, fmt.Errorf("filter: more than one upscale filter")
+			}
+			chain = append(Chain{newScale(name, w, h)}, chain...)
+			continue
+		case Scanlines:
+			f = newScanlines(w, h, rotated)
+		case CRT:
+			f = newCRT(w, h)
+		default:
+			return nil, fmt.Errorf("filter: unknown filter %v", name)
+		}
+		chain = append(chain, f)
+	}
+	return chain, nil
+}
+
+// Apply processes the frame with all the filters of the chain.
+func (c Chain) Apply(src *image.RGBA) *image.RGBA {
+	for _, f := range c {
+		src = f.Apply(src)
+	}
+	return src
+}
+
+// Scales tells if the chain upscales the frames.
+func (c Chain) Scales() bool { return len(c) > 0 && isScale(c[0]) }
+
+func isScale(f Filter) bool { _, ok := f.(*scale); return ok }
+
+// sameSize tells if the frame has the buffer size.
+func sameSize(img *image.RGBA, buf *image.RGBA) bool {
+	return img.Rect.Dx() == buf.Rect.Dx() && img.Rect.Dy() == buf.Rect.Dy()
+}
@@ -0,0 +1,184 @@
+package filter
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden images of the filters")
+
+// testFrame makes a frame with the color gradients.
+func testFrame(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			img.Pix[i] = uint8(x * 255 / w)
+			img.Pix[i+1] = uint8(y * 255 / h)
+			img.Pix[i+2] = uint8((x + y) % 64 * 4)
+			img.Pix[i+3] = 0xff
+		}
+	}
+	return img
+}
+
+// checkGolden compares the frame with the golden image of the testdata.
+func checkGolden(t *testing.T, name string, img *image.RGBA) {
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no golden image %v, %v", path, err)
+	}
+	golden, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("bad golden image %v, %v", path, err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("wrong %v frame size %v, expected %v", name, img.Bounds(), golden.Bounds())
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, g, b, a := golden.At(x, y).RGBA(); img.RGBAAt(x, y) != rgba(r, g, b, a) {
+				t.Fatalf("the %v frame differs from the golden image at %v,%v", name, x, y)
+			}
+		}
+	}
+}
+
+func rgba(r, g, b, a uint32) (c struct{ R, G, B, A uint8 }) {
+	c.R, c.G, c.B, c.A = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+	return
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		golden  string
+		filters []string
+		rotated bool
+		// the size of the source frame
+		w, h int
+	}{
+		{golden: "nearest", filters: []string{Nearest}, w: 32, h: 24},
+		{golden: "bilinear", filters: []string{Bilinear}, w: 32, h: 24},
+		{golden: "scanlines", filters: []string{Scanlines}, w: 64, h: 48},
+		{golden: "scanlines_rotated", filters: []string{Scanlines}, rotated: true, w: 64, h: 48},
+		{golden: "crt", filters: []string{CRT}, w: 64, h: 48},
+		// the upscale goes first
+		{golden: "bilinear_scanlines_crt", filters: []string{Scanlines, CRT, Bilinear}, w: 32, h: 24},
+	}
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+			chain, err := New(test.filters, 64, 48, test.rotated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src := testFrame(test.w, test.h)
+			orig := append([]uint8{}, src.Pix...)
+			out := chain.Apply(src)
+			if !bytes.Equal(src.Pix, orig) {
+				t.Errorf("the source frame has been changed")
+			}
+			checkGolden(t, test.golden, out)
+		})
+	}
+}
+
+func TestFiltersNoAlloc(t *testing.T) {
+	chain, err := New([]string{Bilinear, Scanlines, CRT}, 64, 48, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := testFrame(32, 24)
+	if allocs := testing.AllocsPerRun(10, func() { chain.Apply(src) }); allocs > 0 {
+		t.Errorf("the filters allocate %v times per frame", allocs)
+	}
+}
+
+func TestNewFilters(t *testing.T) {
+	if _, err := New([]string{"blur"}, 64, 48, false); err == nil {
+		t.Errorf("no error of the unknown filter")
+	}
+	if _, err := New([]string{Nearest, Bilinear}, 64, 48, false); err == nil {
+		t.Errorf("no error of two upscale filters")
+	}
+	chain, err := New(nil, 64, 48, false)
+	if err != nil || len(chain) != 0 || chain.Scales() {
+		t.Errorf("wrong empty chain %v, %v", chain, err)
+	}
+	src := testFrame(64, 48)
+	if chain.Apply(src) != src {
+		t.Errorf("the empty chain has changed the frame")
+	}
+	if chain, _ := New([]string{CRT, Nearest}, 64, 48, false); !chain.Scales() {
+		t.Errorf("the chain doesn't upscale")
+	}
+}
+
+func benchmarkFilter(b *testing.B, name string, w, h int) {
+	chain, err := New([]string{name}, 640, 480, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	src := testFrame(w, h)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.Apply(src)
+	}
+}
+
+// the upscale of the 320x240 frames
+func BenchmarkNearest640x480(b *testing.B)  { benchmarkFilter(b, Nearest, 320, 240) }
+func BenchmarkBilinear640x480(b *testing.B) { benchmarkFilter(b, Bilinear, 320, 240) }
+
+func BenchmarkScanlines640x480(b *testing.B) { benchmarkFilter(b, Scanlines, 640, 480) }
+func BenchmarkCRT640x480(b *testing.B)       { benchmarkFilter(b, CRT, 640, 480) }
+
+func TestDownscale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	// the pixels of the left half are 0 and 100, of the right one 200
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			v := uint8(200)
+			if x < 2 {
+				v = uint8(100 * (x % 2))
+			}
+			copy(src.Pix[src.PixOffset(x, y):], []uint8{v, v, v, 0xff})
+		}
+	}
+	out := NewDownscale(2, 1).Apply(src)
+	if out.Rect.Dx() != 2 || out.Rect.Dy() != 1 {
+		t.Fatalf("wrong frame size %v", out.Rect)
+	}
+	if left, right := out.RGBAAt(0, 0), out.RGBAAt(1, 0); left.R != 50 || left.A != 0xff || right.R != 200 {
+		t.Errorf("wrong average pixels %v, %v", left, right)
+	}
+
+	f := NewDownscale(48, 36)
+	if f.Apply(testFrame(48, 36)).Rect.Dx() != 48 {
+		t.Errorf("the frame of the same size has been changed")
+	}
+	src = testFrame(64, 48)
+	if out := f.Apply(src); out.Rect.Dx() != 48 || out.Rect.Dy() != 36 {
+		t.Errorf("wrong frame size %v of 0.75x", out.Rect)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { f.Apply(src) }); allocs > 0 {
+		t.Errorf("the downscale allocates %v times per frame", allocs)
+	}
+}
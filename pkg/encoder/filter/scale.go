@@ -0,0 +1,29 @@
+package filter
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// scale upscales the frames to its size.
+type scale struct {
+	interpolator draw.Interpolator
+	buf          *image.RGBA
+}
+
+func newScale(name string, w, h int) *scale {
+	var interpolator draw.Interpolator = draw.NearestNeighbor
+	if name == Bilinear {
+		interpolator = draw.ApproxBiLinear
+	}
+	return &scale{interpolator: interpolator, buf: image.NewRGBA(image.Rect(0, 0, w, h))}
+}
+
+func (s *scale) Apply(src *image.RGBA) *image.RGBA {
+	if sameSize(src, s.buf) {
+		return src
+	}
+	s.interpolator.Scale(s.buf, s.buf.Rect, src, src.Rect, draw.Src, nil)
+	return s.buf
+}
@@ -0,0 +1,47 @@
+package filter
+
+import "image"
+
+// scanlineShade is the brightness (x/256) of the dark lines.
+const scanlineShade = 160
+
+// scanlines darkens the odd lines of the game,
+// the lines of the rotated games are the columns of the frame.
+type scanlines struct {
+	buf     *image.RGBA
+	rotated bool
+}
+
+func newScanlines(w, h int, rotated bool) *scanlines {
+	return &scanlines{buf: image.NewRGBA(image.Rect(0, 0, w, h)), rotated: rotated}
+}
+
+func (s *scanlines) Apply(src *image.RGBA) *image.RGBA {
+	if !sameSize(src, s.buf) {
+		return src
+	}
+	w, h := s.buf.Rect.Dx(), s.buf.Rect.Dy()
+	for y := 0; y < h; y++ {
+		in := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		out := s.buf.Pix[y*s.buf.Stride : y*s.buf.Stride+w*4]
+		copy(out, in)
+		switch {
+		case s.rotated:
+			for i := 4; i < len(out); i += 8 {
+				darken(out[i : i+4 : i+4])
+			}
+		case y%2 == 1:
+			for i := 0; i < len(out); i += 4 {
+				darken(out[i : i+4 : i+4])
+			}
+		}
+	}
+	return s.buf
+}
+
+// darken makes the RGBA pixel darker keeping its alpha.
+func darken(px []uint8) {
+	px[0] = uint8(uint16(px[0]) * scanlineShade >> 8)
+	px[1] = uint8(uint16(px[1]) * scanlineShade >> 8)
+	px[2] = uint8(uint16(px[2]) * scanlineShade >> 8)
+}
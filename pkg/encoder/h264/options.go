@@ -1,5 +1,10 @@
 package h264
 
+import (
+	"strconv"
+	"strings"
+)
+
 type Options struct {
 	// Constant Rate Factor (CRF)
 	// This method allows the encoder to attempt to achieve a certain output quality for the whole file
@@ -13,6 +18,19 @@ type Options struct {
 	// baseline, main, high, high10, high422, high444.
 	Profile  string
 	LogLevel int32
+	// The max bitrate (kbit/s) of the capped CRF mode, 0 is unlimited.
+	// It should be set to enable SetBitrate.
+	Bitrate uint
+	// 1, 1b, 1.1 ... 6.2, the encoder picks it if empty.
+	Level string
+	// crf, abr, cbr, crf is the default.
+	RateControl string
+	// The target bitrate (kbit/s) of the abr and cbr rate control.
+	TargetBitrate uint
+	// cabac, cavlc, the default of the preset and profile if empty.
+	Entropy string
+	// The frame rate of the video for the rate control, the x264 default (25) if zero.
+	Fps float64
 }
 
 type Option func(*Options)
@@ -24,6 +42,12 @@ func WithOptions(arg Options) Option {
 		args.Preset = arg.Preset
 		args.Profile = arg.Profile
 		args.LogLevel = arg.LogLevel
+		args.Bitrate = arg.Bitrate
+		args.Level = arg.Level
+		args.RateControl = arg.RateControl
+		args.TargetBitrate = arg.TargetBitrate
+		args.Entropy = arg.Entropy
+		args.Fps = arg.Fps
 	}
 }
 func Crf(arg uint8) Option      { return func(args *Options) { args.Crf = arg } }
@@ -31,3 +55,24 @@ func Tune(arg string) Option    { return func(args *Options) { args.Tune = arg }
 func Preset(arg string) Option  { return func(args *Options) { args.Preset = arg } }
 func Profile(arg string) Option { return func(args *Options) { args.Profile = arg } }
 func LogLevel(arg int32) Option { return func(args *Options) { args.LogLevel = arg } }
+
+// levelIdc returns the level_idc of the H.264 level, i.e. 31 of 3.1, 9 of 1b
+// or 0 for the wrong levels.
+func levelIdc(level string) int32 {
+	if level == "1b" {
+		return 9
+	}
+	major, minor, dot := level, "0", strings.IndexByte(level, '.')
+	if dot >= 0 {
+		major, minor = level[:dot], level[dot+1:]
+	}
+	ma, err := strconv.Atoi(major)
+	if err != nil || ma < 1 || ma > 6 {
+		return 0
+	}
+	mi, err := strconv.Atoi(minor)
+	if err != nil || mi < 0 || mi > 9 {
+		return 0
+	}
+	return int32(ma*10 + mi)
+}
@@ -4,6 +4,8 @@ import "C"
 import (
 	"fmt"
 	"log"
+	"math"
+	"unsafe"
 )
 
 type H264 struct {
@@ -18,8 +20,15 @@ type H264 struct {
 
 	// keep monotonic pts to suppress warnings
 	pts int64
+	// force the next frame to be a keyframe (IDR)
+	kf bool
+	// the error of the last frame
+	err error
 }
 
+// fpsDen is the denominator of the fractional frame rates (i.e. 59.94).
+const fpsDen = 1000
+
 func NewEncoder(width, height int, options ...Option) (encoder *H264, err error) {
 	libVersion := int(Build)
 
@@ -47,14 +56,39 @@ func NewEncoder(width, height int, options ...Option) (encoder *H264, err error)
 	}
 
 	param := Param{}
-	if opts.Preset != "" && opts.Tune != "" {
-		if ParamDefaultPreset(&param, opts.Preset, opts.Tune) < 0 {
+	if opts.Preset != "" || opts.Tune != "" {
+		// the tune goes with the x264 default preset
+		preset := opts.Preset
+		if preset == "" {
+			preset = "medium"
+		}
+		if ParamDefaultPreset(&param, preset, opts.Tune) < 0 {
 			return nil, fmt.Errorf("x264: invalid preset/tune name")
 		}
 	} else {
 		ParamDefault(&param)
 	}
 
+	switch opts.Entropy {
+	case "":
+	case "cabac":
+		if opts.Profile == "baseline" {
+			return nil, fmt.Errorf("x264: no cabac in the baseline profile")
+		}
+		param.BCabac = 1
+	case "cavlc":
+		param.BCabac = 0
+	default:
+		return nil, fmt.Errorf("x264: invalid entropy coding %v", opts.Entropy)
+	}
+
+	if opts.Level != "" {
+		if param.ILevelIdc = levelIdc(opts.Level); param.ILevelIdc == 0 {
+			return nil, fmt.Errorf("x264: invalid level %v", opts.Level)
+		}
+	}
+
+	// the profile goes after the settings it restricts
 	if opts.Profile != "" {
 		if ParamApplyProfile(&param, opts.Profile) < 0 {
 			return nil, fmt.Errorf("x264: invalid profile name")
@@ -72,9 +106,33 @@ func NewEncoder(width, height int, options ...Option) (encoder *H264, err error)
 	param.IWidth = int32(width)
 	param.IHeight = int32(height)
 	param.ILogLevel = opts.LogLevel
+	if opts.Fps > 0 {
+		param.IFpsNum, param.IFpsDen = uint32(math.Round(opts.Fps*fpsDen)), fpsDen
+	}
 
-	param.Rc.IRcMethod = RcCrf
-	param.Rc.FRfConstant = float32(opts.Crf)
+	switch opts.RateControl {
+	case "", "crf":
+		param.Rc.IRcMethod = RcCrf
+		param.Rc.FRfConstant = float32(opts.Crf)
+	case "abr", "cbr":
+		if opts.TargetBitrate == 0 {
+			return nil, fmt.Errorf("x264: no bitrate of the %v rate control", opts.RateControl)
+		}
+		param.Rc.IRcMethod = RcAbr
+		param.Rc.IBitrate = int32(opts.TargetBitrate)
+	default:
+		return nil, fmt.Errorf("x264: invalid rate control %v", opts.RateControl)
+	}
+	if opts.Bitrate > 0 {
+		// VBV can't be enabled later with reconfig
+		param.Rc.IVbvMaxBitrate = int32(opts.Bitrate)
+		param.Rc.IVbvBufferSize = int32(opts.Bitrate)
+	}
+	if opts.RateControl == "cbr" {
+		// the constant bitrate is the abr capped with the one second VBV of the target
+		param.Rc.IVbvMaxBitrate = int32(opts.TargetBitrate)
+		param.Rc.IVbvBufferSize = int32(opts.TargetBitrate)
+	}
 
 	encoder = &H264{
 		csp:        param.ICsp,
@@ -91,7 +149,14 @@ func NewEncoder(width, height int, options ...Option) (encoder *H264, err error)
 	return
 }
 
+// Encode encodes the frame, the result is in the encoder memory,
+// so it's valid until the next call.
 func (e *H264) Encode(yuv []byte) []byte {
+	// the failed restart
+	if e.ref == nil {
+		e.err = fmt.Errorf("x264: the encoder is closed")
+		return []byte{}
+	}
 	var picIn, picOut Picture
 
 	picIn.Img.ICsp = e.csp
@@ -106,6 +171,10 @@ func (e *H264) Encode(yuv []byte) []byte {
 
 	picIn.IPts = e.pts
 	e.pts++
+	if e.kf {
+		picIn.IType = TypeIdr
+		e.kf = false
+	}
 
 	defer func() {
 		picIn.freePlane(0)
@@ -113,14 +182,64 @@ func (e *H264) Encode(yuv []byte) []byte {
 		picIn.freePlane(2)
 	}()
 
-	if ret := EncoderEncode(e.ref, e.nals, &e.nnals, &picIn, &picOut); ret > 0 {
-		return C.GoBytes(e.nals[0].PPayload, C.int(ret))
+	ret := EncoderEncode(e.ref, e.nals, &e.nnals, &picIn, &picOut)
+	if e.err = nil; ret < 0 {
+		e.err = fmt.Errorf("x264: failed to encode frame (%v)", ret)
+		return []byte{}
+	}
+	if ret > 0 {
+		return (*[1 << 30]byte)(unsafe.Pointer(e.nals[0].PPayload))[:ret:ret]
 		// ret should be equal to writer writes
 	}
 	return []byte{}
 }
 
-func (e *H264) Shutdown() error {
+func (e *H264) ForceKeyframe() { e.kf = true }
+
+// Err returns the error of the last encoded frame.
+func (e *H264) Err() error { return e.err }
+
+// Reset reopens the encoder with its current parameters.
+func (e *H264) Reset() error {
+	var param Param
+	EncoderParameters(e.ref, &param)
 	EncoderClose(e.ref)
+	e.err, e.kf = nil, true
+	if e.ref = EncoderOpen(&param); e.ref == nil {
+		return fmt.Errorf("x264: cannot open the encoder")
+	}
+	return nil
+}
+
+// SetBitrate changes the max bitrate (kbit/s), and the target one
+// of the abr and cbr rate control.
+// The crf encoder should be created with the Bitrate option.
+func (e *H264) SetBitrate(kbps uint) error {
+	if e.ref == nil {
+		return fmt.Errorf("x264: the encoder is closed")
+	}
+	var param Param
+	EncoderParameters(e.ref, &param)
+	abr := param.Rc.IRcMethod == RcAbr
+	if param.Rc.IVbvMaxBitrate == 0 && !abr {
+		return fmt.Errorf("x264: no max bitrate (VBV) set")
+	}
+	if abr {
+		param.Rc.IBitrate = int32(kbps)
+	}
+	if param.Rc.IVbvMaxBitrate > 0 {
+		param.Rc.IVbvMaxBitrate = int32(kbps)
+		param.Rc.IVbvBufferSize = int32(kbps)
+	}
+	if EncoderReconfig(e.ref, &param) < 0 {
+		return fmt.Errorf("x264: couldn't reconfigure the encoder")
+	}
+	return nil
+}
+
+func (e *H264) Shutdown() error {
+	if e.ref != nil {
+		EncoderClose(e.ref)
+	}
 	return nil
 }
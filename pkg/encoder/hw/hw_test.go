@@ -0,0 +1,40 @@
+package hw
+
+import "testing"
+
+func TestEncoderName(t *testing.T) {
+	tests := []struct {
+		backend, codec string
+		name           string
+	}{
+		{backend: VAAPI, codec: "h264", name: "h264_vaapi"},
+		{backend: VAAPI, codec: "vpx", name: "vp8_vaapi"},
+		{backend: VAAPI, codec: "vp9", name: "vp9_vaapi"},
+		{backend: NVENC, codec: "h264", name: "h264_nvenc"},
+		{backend: NVENC, codec: "vp9"},
+		{backend: VAAPI, codec: "av1"},
+		{backend: "quicksync", codec: "h264"},
+	}
+	for _, test := range tests {
+		name, err := encoderName(test.backend, test.codec)
+		if name != test.name || (err != nil) != (test.name == "") {
+			t.Errorf("wrong %v encoder %v of %v, expected %v", test.backend, name, test.codec, test.name)
+		}
+	}
+}
+
+// Tests that the encoder fails without the device,
+// so the callers could fallback to the software encoders.
+func TestNewEncoderNoDevice(t *testing.T) {
+	tests := []Options{
+		{Backend: VAAPI, Device: "/dev/dri/renderD-none", Codec: "h264"},
+		{Backend: NVENC, Device: "99", Codec: "h264"},
+	}
+	for _, test := range tests {
+		enc, err := NewEncoder(64, 48, WithOptions(test))
+		if err == nil {
+			_ = enc.Shutdown()
+			t.Errorf("the %v encoder works without the device %v", test.Backend, test.Device)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+//go:build hwenc
+// +build hwenc
+
+package hw
+
+/*
+#cgo pkg-config: libavcodec libavutil
+#cgo CFLAGS: -Wall -O3
+
+#include <libavcodec/avcodec.h>
+#include <libavutil/hwcontext.h>
+#include <libavutil/opt.h>
+
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct hwenc {
+  AVCodecContext *ctx;
+  // the VAAPI device, NULL with NVENC
+  AVBufferRef *device;
+  // the input frame of NVENC, the mapped surface of VAAPI
+  AVFrame *frame;
+  // the VAAPI surface
+  AVFrame *surface;
+  AVPacket *pkt;
+  int64_t pts;
+} hwenc;
+
+static void hwenc_close(hwenc *e) {
+  avcodec_free_context(&e->ctx);
+  av_frame_free(&e->frame);
+  av_frame_free(&e->surface);
+  av_packet_free(&e->pkt);
+  av_buffer_unref(&e->device);
+}
+
+static int hwenc_open(hwenc *e, const char *name, int vaapi, const char *device, int w, int h, int kbps, int gop,
+                      int fps_num, int fps_den) {
+  int err;
+  const AVCodec *codec = avcodec_find_encoder_by_name(name);
+  if (!codec) return AVERROR_ENCODER_NOT_FOUND;
+  if (!(e->ctx = avcodec_alloc_context3(codec))) return AVERROR(ENOMEM);
+
+  AVCodecContext *ctx = e->ctx;
+  ctx->width = w;
+  ctx->height = h;
+  ctx->time_base = (AVRational){fps_den, fps_num};
+  ctx->framerate = (AVRational){fps_num, fps_den};
+  ctx->gop_size = gop;
+  ctx->max_b_frames = 0;
+  ctx->bit_rate = (int64_t)kbps * 1000;
+  ctx->rc_max_rate = ctx->bit_rate;
+  ctx->rc_buffer_size = ctx->bit_rate;
+  ctx->flags |= AV_CODEC_FLAG_LOW_DELAY;
+
+  if (vaapi) {
+    if ((err = av_hwdevice_ctx_create(&e->device, AV_HWDEVICE_TYPE_VAAPI, *device ? device : NULL, NULL, 0)) < 0)
+      return err;
+    AVBufferRef *frames = av_hwframe_ctx_alloc(e->device);
+    if (!frames) return AVERROR(ENOMEM);
+    AVHWFramesContext *fc = (AVHWFramesContext *)frames->data;
+    fc->format = AV_PIX_FMT_VAAPI;
+    fc->sw_format = AV_PIX_FMT_NV12;
+    fc->width = w;
+    fc->height = h;
+    fc->initial_pool_size = 4;
+    if ((err = av_hwframe_ctx_init(frames)) < 0) {
+      av_buffer_unref(&frames);
+      return err;
+    }
+    ctx->hw_frames_ctx = frames;
+    ctx->pix_fmt = AV_PIX_FMT_VAAPI;
+    av_opt_set(ctx->priv_data, "rc_mode", "CBR", 0);
+  } else {
+    // the RGBA frames go as is, NVENC converts them on the GPU
+    ctx->pix_fmt = AV_PIX_FMT_RGB0;
+    if (*device) av_opt_set(ctx->priv_data, "gpu", device, 0);
+    // the presets of the old and new NVENC SDKs
+    if (av_opt_set(ctx->priv_data, "preset", "p1", 0) < 0) av_opt_set(ctx->priv_data, "preset", "llhp", 0);
+    av_opt_set(ctx->priv_data, "tune", "ull", 0);
+    av_opt_set(ctx->priv_data, "rc", "cbr", 0);
+    av_opt_set(ctx->priv_data, "zerolatency", "1", 0);
+    av_opt_set(ctx->priv_data, "forced-idr", "1", 0);
+    av_opt_set(ctx->priv_data, "delay", "0", 0);
+  }
+  if ((err = avcodec_open2(ctx, codec, NULL)) < 0) return err;
+
+  if (!(e->frame = av_frame_alloc()) || !(e->pkt = av_packet_alloc())) return AVERROR(ENOMEM);
+  if (vaapi) {
+    if (!(e->surface = av_frame_alloc())) return AVERROR(ENOMEM);
+    e->frame->format = AV_PIX_FMT_NV12;
+    return 0;
+  }
+  e->frame->format = ctx->pix_fmt;
+  e->frame->width = w;
+  e->frame->height = h;
+  return av_frame_get_buffer(e->frame, 0);
+}
+
+// hwenc_frame returns the frame to write the next picture into,
+// the VAAPI surface is mapped into memory.
+static AVFrame *hwenc_frame(hwenc *e, int *err) {
+  if (!e->device) {
+    *err = av_frame_make_writable(e->frame);
+    return e->frame;
+  }
+  if ((*err = av_hwframe_get_buffer(e->ctx->hw_frames_ctx, e->surface, 0)) < 0) return NULL;
+  e->frame->format = AV_PIX_FMT_NV12;
+  if ((*err = av_hwframe_map(e->frame, e->surface, AV_HWFRAME_MAP_WRITE | AV_HWFRAME_MAP_OVERWRITE)) < 0) {
+    av_frame_unref(e->surface);
+    return NULL;
+  }
+  return e->frame;
+}
+
+// rgba_write converts the RGBA picture into the frame (NV12 or RGB0).
+static void rgba_write(AVFrame *f, const uint8_t *src, int stride, int w, int h) {
+  if (f->format == AV_PIX_FMT_RGB0) {
+    for (int y = 0; y < h; y++) memcpy(f->data[0] + y * f->linesize[0], src + y * stride, w * 4);
+    return;
+  }
+  for (int y = 0; y < h; y++) {
+    const uint8_t *rgba = src + y * stride;
+    uint8_t *dst_y = f->data[0] + y * f->linesize[0];
+    uint8_t *dst_uv = f->data[1] + (y >> 1) * f->linesize[1];
+    for (int x = 0; x < w; x++, rgba += 4) {
+      *dst_y++ = ((66 * rgba[0] + 129 * rgba[1] + 25 * rgba[2]) >> 8) + 16;
+      // the top-left pixel of the chroma block
+      if (!(y & 1) && !(x & 1)) {
+        *dst_uv++ = ((-38 * rgba[0] + -74 * rgba[1] + 112 * rgba[2]) >> 8) + 128;
+        *dst_uv++ = ((112 * rgba[0] + -94 * rgba[1] + -18 * rgba[2]) >> 8) + 128;
+      }
+    }
+  }
+}
+
+// yuv_write copies the I420 picture into the frame (NV12 or RGB0).
+static void yuv_write(AVFrame *f, const uint8_t *src, int w, int h) {
+  const uint8_t *src_u = src + w * h;
+  const uint8_t *src_v = src_u + (w / 2) * (h / 2);
+  if (f->format == AV_PIX_FMT_RGB0) {
+    for (int y = 0; y < h; y++) {
+      uint8_t *dst = f->data[0] + y * f->linesize[0];
+      for (int x = 0; x < w; x++, dst += 4) {
+        int c = src[y * w + x] - 16, d = src_u[(y / 2) * (w / 2) + x / 2] - 128, e = src_v[(y / 2) * (w / 2) + x / 2] - 128;
+        int r = (298 * c + 409 * e + 128) >> 8, g = (298 * c - 100 * d - 208 * e + 128) >> 8, b = (298 * c + 516 * d + 128) >> 8;
+        dst[0] = r < 0 ? 0 : r > 255 ? 255 : r;
+        dst[1] = g < 0 ? 0 : g > 255 ? 255 : g;
+        dst[2] = b < 0 ? 0 : b > 255 ? 255 : b;
+      }
+    }
+    return;
+  }
+  for (int y = 0; y < h; y++) memcpy(f->data[0] + y * f->linesize[0], src + y * w, w);
+  for (int y = 0; y < h / 2; y++) {
+    uint8_t *dst = f->data[1] + y * f->linesize[1];
+    for (int x = 0; x < w / 2; x++) {
+      *dst++ = src_u[y * (w / 2) + x];
+      *dst++ = src_v[y * (w / 2) + x];
+    }
+  }
+}
+
+// hwenc_encode sends the written frame into the encoder
+// and returns the size of the encoded packet if any.
+static int hwenc_encode(hwenc *e, int keyframe) {
+  AVFrame *f = e->frame;
+  if (e->device) {
+    av_frame_unref(e->frame);
+    f = e->surface;
+  }
+  f->pts = e->pts++;
+  f->pict_type = keyframe ? AV_PICTURE_TYPE_I : AV_PICTURE_TYPE_NONE;
+  int err = avcodec_send_frame(e->ctx, f);
+  if (e->device) av_frame_unref(e->surface);
+  if (err < 0) return err;
+
+  av_packet_unref(e->pkt);
+  err = avcodec_receive_packet(e->ctx, e->pkt);
+  if (err == AVERROR(EAGAIN)) return 0;
+  if (err < 0) return err;
+  return e->pkt->size;
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"unsafe"
+)
+
+// Encoder is the hardware video encoder, it takes the I420 or RGBA frames.
+// The RGBA frames are written into the GPU memory without the YUV conversion
+// on the CPU with NVENC, or converted right into the mapped surface with VAAPI.
+type Encoder struct {
+	enc  C.hwenc
+	opts Options
+	name string
+	w, h int
+	// force the next frame to be a keyframe
+	kf bool
+	// the error of the last frame
+	err error
+}
+
+// NewEncoder creates a new hardware video encoder.
+// It fails if the GPU or its driver is absent.
+func NewEncoder(width, height int, options ...Option) (*Encoder, error) {
+	opts := &Options{
+		Bitrate:     1500,
+		KeyframeInt: 120,
+	}
+	for _, opt := range options {
+		opt(opts)
+	}
+	name, err := encoderName(opts.Backend, opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+	e := &Encoder{opts: *opts, name: name, w: width, h: height}
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Encoder) open() error {
+	name, device := C.CString(e.name), C.CString(e.opts.Device)
+	defer C.free(unsafe.Pointer(name))
+	defer C.free(unsafe.Pointer(device))
+	var vaapi C.int
+	if e.opts.Backend == VAAPI {
+		vaapi = 1
+	}
+	fps := e.opts.Fps
+	if fps <= 0 {
+		fps = 60
+	}
+	err := C.hwenc_open(&e.enc, name, vaapi, device, C.int(e.w), C.int(e.h), C.int(e.opts.Bitrate), C.int(e.opts.KeyframeInt),
+		C.int(math.Round(fps*1000)), 1000)
+	if err < 0 {
+		C.hwenc_close(&e.enc)
+		return fmt.Errorf("%v (%v), %v", e.name, e.opts.Device, avError(err))
+	}
+	return nil
+}
+
+// Encode encodes the I420 frame.
+func (e *Encoder) Encode(yuv []byte) []byte {
+	return e.encode(func(f *C.AVFrame) {
+		C.yuv_write(f, (*C.uint8_t)(unsafe.Pointer(&yuv[0])), C.int(e.w), C.int(e.h))
+	})
+}
+
+// EncodeRGBA encodes the RGBA frame without its conversion into I420.
+func (e *Encoder) EncodeRGBA(img *image.RGBA) []byte {
+	return e.encode(func(f *C.AVFrame) {
+		C.rgba_write(f, (*C.uint8_t)(unsafe.Pointer(&img.Pix[0])), C.int(img.Stride), C.int(e.w), C.int(e.h))
+	})
+}
+
+func (e *Encoder) encode(write func(*C.AVFrame)) []byte {
+	e.err = nil
+	// the failed restart
+	if e.enc.ctx == nil {
+		e.err = fmt.Errorf("%v is closed", e.name)
+		return []byte{}
+	}
+	var err C.int
+	f := C.hwenc_frame(&e.enc, &err)
+	if err < 0 {
+		e.err = fmt.Errorf("%v couldn't get a frame, %v", e.name, avError(err))
+		return []byte{}
+	}
+	write(f)
+
+	var kf C.int
+	if e.kf {
+		kf, e.kf = 1, false
+	}
+	size := C.hwenc_encode(&e.enc, kf)
+	if size < 0 {
+		e.err = fmt.Errorf("%v couldn't encode a frame, %v", e.name, avError(size))
+		return []byte{}
+	}
+	if size == 0 {
+		return []byte{}
+	}
+	// the packet is valid until the next call
+	return (*[1 << 30]byte)(unsafe.Pointer(e.enc.pkt.data))[:size:size]
+}
+
+func (e *Encoder) ForceKeyframe() { e.kf = true }
+
+// SetBitrate changes the target bitrate (kbit/s).
+// NVENC changes it on the fly and VAAPI restarts the encoder with it.
+func (e *Encoder) SetBitrate(kbps uint) error {
+	e.opts.Bitrate = kbps
+	if e.opts.Backend == NVENC {
+		e.enc.ctx.bit_rate = C.int64_t(kbps) * 1000
+		e.enc.ctx.rc_max_rate = e.enc.ctx.bit_rate
+		return nil
+	}
+	return e.Reset()
+}
+
+// Err returns the error of the last encoded frame.
+func (e *Encoder) Err() error { return e.err }
+
+// Reset restarts the encoder with the current options.
+func (e *Encoder) Reset() error {
+	C.hwenc_close(&e.enc)
+	e.enc = C.hwenc{}
+	e.err = nil
+	if err := e.open(); err != nil {
+		return err
+	}
+	e.kf = true
+	return nil
+}
+
+func (e *Encoder) Shutdown() error {
+	C.hwenc_close(&e.enc)
+	return nil
+}
+
+func avError(code C.int) error {
+	buf := make([]byte, 128)
+	C.av_strerror(code, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+	return errors.New(C.GoString((*C.char)(unsafe.Pointer(&buf[0]))))
+}
@@ -0,0 +1,74 @@
+// Package hw contains the hardware video encoders (VAAPI, NVENC) made with FFmpeg.
+// They are available only with the hwenc build tag,
+// otherwise the constructor returns ErrUnavailable.
+package hw
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The hardware encoding backends.
+const (
+	// VAAPI is the encoding API of the Intel and AMD GPUs (libva)
+	VAAPI = "vaapi"
+	// NVENC is the encoding API of the NVIDIA GPUs
+	NVENC = "nvenc"
+)
+
+// ErrUnavailable is returned when the app is built without the hardware encoders.
+var ErrUnavailable = errors.New("hardware video encoder is not available, build with the hwenc tag and FFmpeg")
+
+type Options struct {
+	// Backend is the encoding API: vaapi, nvenc.
+	Backend string
+	// Device is the DRM render node of VAAPI (i.e. /dev/dri/renderD128)
+	// or the GPU index of NVENC (i.e. 0), the default device is used if empty.
+	Device string
+	// Codec is the video codec: h264, vpx, vp9.
+	Codec string
+	// Target bandwidth to use for this stream, in kilobits per second.
+	Bitrate uint
+	// Force keyframe interval (frames).
+	KeyframeInt uint
+	// The frame rate of the video, 60 if zero.
+	Fps float64
+}
+
+type Option func(*Options)
+
+func WithOptions(arg Options) Option {
+	return func(args *Options) {
+		args.Backend = arg.Backend
+		args.Device = arg.Device
+		args.Codec = arg.Codec
+		if arg.Bitrate > 0 {
+			args.Bitrate = arg.Bitrate
+		}
+		if arg.Fps > 0 {
+			args.Fps = arg.Fps
+		}
+		if arg.KeyframeInt > 0 {
+			args.KeyframeInt = arg.KeyframeInt
+		}
+	}
+}
+
+// encoders are the FFmpeg encoders of the codecs by backend.
+var encoders = map[string]map[string]string{
+	VAAPI: {"h264": "h264_vaapi", "vpx": "vp8_vaapi", "vp9": "vp9_vaapi"},
+	NVENC: {"h264": "h264_nvenc"},
+}
+
+// encoderName returns the name of the FFmpeg encoder of the codec.
+func encoderName(backend string, codec string) (string, error) {
+	codecs, ok := encoders[backend]
+	if !ok {
+		return "", fmt.Errorf("unknown hardware encoder backend %v", backend)
+	}
+	name, ok := codecs[codec]
+	if !ok {
+		return "", fmt.Errorf("no %v encoder of %v", backend, codec)
+	}
+	return name, nil
+}
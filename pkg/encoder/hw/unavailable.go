@@ -0,0 +1,26 @@
+//go:build !hwenc
+// +build !hwenc
+
+package hw
+
+type Encoder struct{}
+
+// NewEncoder always fails without the hwenc build tag.
+// The callers should fallback to the software encoders.
+func NewEncoder(_, _ int, options ...Option) (*Encoder, error) {
+	opts := &Options{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	if _, err := encoderName(opts.Backend, opts.Codec); err != nil {
+		return nil, err
+	}
+	return nil, ErrUnavailable
+}
+
+func (e *Encoder) Encode([]byte) []byte  { return nil }
+func (e *Encoder) ForceKeyframe()        {}
+func (e *Encoder) SetBitrate(uint) error { return ErrUnavailable }
+func (e *Encoder) Err() error            { return nil }
+func (e *Encoder) Reset() error          { return ErrUnavailable }
+func (e *Encoder) Shutdown() error       { return nil }
@@ -25,11 +25,32 @@ func NewEncoder(outFq, channels int, options ...func(*Encoder) error) (*Encoder,
 		enc.SetComplexity(10),
 	)
 	for _, option := range options {
-		result = multierror.Append(option(enc))
+		result = multierror.Append(result, option(enc))
 	}
 	return enc, result.ErrorOrNil()
 }
 
+// WithBitrate sets the bitrate of the encoder in bit/s.
+func WithBitrate(bitrate int) func(*Encoder) error {
+	return func(e *Encoder) error { return e.SetBitrate(Bitrate(bitrate)) }
+}
+
+// WithComplexity sets the complexity of the encoder.
+func WithComplexity(complexity int) func(*Encoder) error {
+	return func(e *Encoder) error { return e.SetComplexity(complexity) }
+}
+
+// WithFEC switches the in-band forward error correction
+// for the expected packet loss in percents.
+func WithFEC(fec bool, packetLoss int) func(*Encoder) error {
+	return func(e *Encoder) error {
+		if err := e.SetFEC(fec); err != nil {
+			return err
+		}
+		return e.SetPacketLossPerc(packetLoss)
+	}
+}
+
 func (e *Encoder) Encode(pcm []int16) ([]byte, error) {
 	n, err := e.LibOpusEncoder.Encode(pcm, e.buf)
 	// n = 1 is DTX
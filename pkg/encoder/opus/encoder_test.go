@@ -0,0 +1,39 @@
+package opus
+
+import "testing"
+
+func TestEncoderOptions(t *testing.T) {
+	enc, err := NewEncoder(48000, 2, WithBitrate(64000), WithComplexity(5), WithFEC(true, 10))
+	if err != nil {
+		t.Fatalf("couldn't create the encoder, %v", err)
+	}
+	if bitrate, err := enc.Bitrate(); err != nil || bitrate != 64000 {
+		t.Errorf("wrong bitrate %v, %v", bitrate, err)
+	}
+	if complexity, err := enc.Complexity(); err != nil || complexity != 5 {
+		t.Errorf("wrong complexity %v, %v", complexity, err)
+	}
+	if fec, err := enc.FEC(); err != nil || !fec {
+		t.Errorf("FEC is not enabled, %v", err)
+	}
+	if loss, err := enc.PacketLossPerc(); err != nil || loss != 10 {
+		t.Errorf("wrong packet loss %v, %v", loss, err)
+	}
+
+	// at runtime
+	if err := enc.SetBitrate(96000); err != nil {
+		t.Fatalf("couldn't change the bitrate, %v", err)
+	}
+	if bitrate, _ := enc.Bitrate(); bitrate != 96000 {
+		t.Errorf("the bitrate hasn't changed %v", bitrate)
+	}
+	if _, err := enc.Encode(make([]int16, 960*2)); err != nil {
+		t.Errorf("couldn't encode with the new bitrate, %v", err)
+	}
+}
+
+func TestEncoderWrongOptions(t *testing.T) {
+	if _, err := NewEncoder(48000, 2, WithComplexity(42)); err == nil {
+		t.Errorf("expected the wrong complexity error")
+	}
+}
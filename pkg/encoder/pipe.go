@@ -1,9 +1,16 @@
 package encoder
 
 import (
+	"fmt"
+	"image"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder/yuv"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
 )
 
 type VideoPipe struct {
@@ -15,13 +22,53 @@ type VideoPipe struct {
 
 	// frame size
 	w, h int
+
+	// the new bitrate (kbit/s) to apply before the next frame
+	bitrate uint32
+	// 1 if the next frame should be a keyframe
+	keyframe uint32
+
+	// the new filters to apply before the next frame, nil if unchanged
+	filterLock sync.Mutex
+	filter     *filter.Chain
+
+	keyframeLock sync.Mutex
+	lastKeyframe time.Time
+	now          func() time.Time
+
+	// frames are the buffers of the encoded frames
+	frames media.FramePool
+
+	// the encoder failures in a row since the first of them
+	failures    int
+	failedSince time.Time
+	onRestart   func(err error)
+	onFailure   func(err error)
+
+	// the watch of the output frames the consumer doesn't take
+	stall   *media.SendWatch
+	onStall func()
 }
 
+// keyframeInterval is the min time between two forced keyframes.
+const keyframeInterval = time.Second
+
+// The failed encoders are restarted, the failures of the encoders
+// which don't recover are reported with OnFailure.
+const (
+	// maxFailures is the number of the encoder failures in a row
+	// within failureWindow which are reported
+	maxFailures   = 5
+	failureWindow = 10 * time.Second
+)
+
 // NewVideoPipe returns new video encoder pipe.
 // By default, it waits for RGBA images on the input channel,
 // converts them into YUV I420 format,
 // encodes with provided video encoder, and
 // puts the result into the output channel.
+// The output frames are pooled, they should be released after use.
+// The encoders of RGBAEncoder get the RGBA images without the conversion.
 func NewVideoPipe(enc Encoder, w, h int) *VideoPipe {
 	return &VideoPipe{
 		Input:  make(chan InFrame, 1),
@@ -32,6 +79,8 @@ func NewVideoPipe(enc Encoder, w, h int) *VideoPipe {
 
 		w: w,
 		h: h,
+
+		now: time.Now,
 	}
 }
 
@@ -47,13 +96,193 @@ func (vp *VideoPipe) Start() {
 	}()
 
 	yuvProc := yuv.NewYuvImgProcessor(vp.w, vp.h)
+	rgba, _ := vp.encoder.(RGBAEncoder)
+	var filters filter.Chain
+	// the input of the dropped frames goes with the next frame
+	var input time.Time
+	// the encoders start with a keyframe
+	keyframe := true
 	for img := range vp.Input {
-		yCbCr := yuvProc.Process(img.Image).Get()
-		frame := vp.encoder.Encode(yCbCr)
-		if len(frame) > 0 {
-			vp.Output <- OutFrame{Data: frame, Duration: img.Duration}
+		if input.IsZero() {
+			input = img.Input
+		}
+		vp.applyBitrate()
+		if vp.applyKeyframe() {
+			keyframe = true
+		}
+		filters = vp.applyFilter(filters)
+		frame := filters.Apply(img.Image)
+		// the frames of the old viewport after the filter change
+		if frame.Rect.Dx() != vp.w || frame.Rect.Dy() != vp.h {
+			img.Buf.Release()
+			continue
 		}
+		data, err := vp.encode(rgba, yuvProc, frame)
+		img.Buf.Release()
+		if err != nil {
+			keyframe = vp.restart(err) || keyframe
+			continue
+		}
+		vp.failures = 0
+		if len(data) > 0 {
+			buf := vp.frames.Get(len(data))
+			copy(buf.Data, data)
+			if !vp.send(OutFrame{Data: buf.Data, Duration: img.Duration, Time: img.Time, Buf: buf, Input: input,
+				Keyframe: keyframe, Timestamp: img.Timestamp}) {
+				buf.Release()
+				// the peers can't decode the stream after the dropped frame
+				vp.ForceKeyframe()
+				continue
+			}
+			input, keyframe = time.Time{}, false
+		}
+	}
+}
+
+// encode encodes the frame, the panics of the encoder are its errors.
+func (vp *VideoPipe) encode(rgba RGBAEncoder, yuvProc yuv.ImgProcessor, frame *image.RGBA) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("encoder panic, %v", r)
+		}
+	}()
+	if rgba != nil {
+		data = rgba.EncodeRGBA(frame)
+	} else {
+		data = vp.encoder.Encode(yuvProc.Process(frame).Get())
+	}
+	if enc, ok := vp.encoder.(Resetter); ok {
+		err = enc.Err()
+	}
+	return
+}
+
+// send puts the encoded frame into the output, the frames the consumer
+// hasn't taken for the stall threshold (see OnStall) are dropped.
+func (vp *VideoPipe) send(frame OutFrame) bool {
+	select {
+	case vp.Output <- frame:
+		return true
+	default:
+	}
+	select {
+	case vp.Output <- frame:
+		vp.stall.Done()
+		return true
+	case <-vp.stall.Wait():
+		log.Printf("warn: the encoded video frame hasn't been taken for %v, dropped", vp.stall.Threshold())
+		if vp.onStall != nil {
+			vp.onStall()
+		}
+		return false
+	}
+}
+
+// OnStall sets the handler of the output frames which haven't been taken
+// for the threshold, such frames are dropped. Without it the frames wait forever.
+// It's called in the encoding goroutine. Should be called before Start.
+func (vp *VideoPipe) OnStall(threshold time.Duration, fn func()) {
+	vp.stall, vp.onStall = media.NewSendWatch(threshold), fn
+}
+
+// OnRestart sets the handler of the restarts of the failed encoder,
+// it's called in the encoding goroutine. Should be called before Start.
+func (vp *VideoPipe) OnRestart(fn func(err error)) { vp.onRestart = fn }
+
+// OnFailure sets the handler of the encoder which keeps failing after its restarts,
+// it's called in the encoding goroutine. Should be called before Start.
+func (vp *VideoPipe) OnFailure(fn func(err error)) { vp.onFailure = fn }
+
+// restart reinitializes the failed encoder, the next frame is a keyframe.
+// It tells if the keyframe has been forced.
+func (vp *VideoPipe) restart(err error) (keyframe bool) {
+	now := vp.now()
+	if vp.failures == 0 || now.Sub(vp.failedSince) > failureWindow {
+		vp.failures, vp.failedSince = 0, now
+	}
+	vp.failures++
+	log.Printf("error: video encoder has failed (%v in a row), %v", vp.failures, err)
+	if enc, ok := vp.encoder.(Resetter); ok {
+		if err := enc.Reset(); err != nil {
+			log.Printf("error: couldn't restart the video encoder, %v", err)
+		}
+	}
+	if vp.onRestart != nil {
+		vp.onRestart(err)
+	}
+	enc, keyframe := vp.encoder.(KeyframeForcer)
+	if keyframe {
+		enc.ForceKeyframe()
+	}
+	if vp.failures == maxFailures && vp.onFailure != nil {
+		vp.onFailure(err)
+	}
+	return
+}
+
+// SetBitrate changes the encoder bitrate (kbit/s).
+// The change is applied before the next frame in the encoding goroutine,
+// and ignored if the encoder doesn't support it.
+func (vp *VideoPipe) SetBitrate(kbps uint) { atomic.StoreUint32(&vp.bitrate, uint32(kbps)) }
+
+func (vp *VideoPipe) applyBitrate() {
+	kbps := atomic.SwapUint32(&vp.bitrate, 0)
+	if kbps == 0 {
+		return
+	}
+	enc, ok := vp.encoder.(BitrateSetter)
+	if !ok {
+		return
+	}
+	if err := enc.SetBitrate(uint(kbps)); err != nil {
+		log.Printf("error: couldn't change the encoder bitrate to %v, %v", kbps, err)
+	}
+}
+
+// SetFilter changes the filters of the frames before their encoding.
+// The filters should be made for the frame size of the pipe,
+// the change is applied before the next frame in the encoding goroutine.
+func (vp *VideoPipe) SetFilter(chain filter.Chain) {
+	vp.filterLock.Lock()
+	vp.filter = &chain
+	vp.filterLock.Unlock()
+}
+
+func (vp *VideoPipe) applyFilter(current filter.Chain) filter.Chain {
+	vp.filterLock.Lock()
+	defer vp.filterLock.Unlock()
+	if vp.filter == nil {
+		return current
+	}
+	current, vp.filter = *vp.filter, nil
+	return current
+}
+
+// ForceKeyframe asks the encoder to make the next frame a keyframe,
+// so the new peers could start decoding the stream immediately.
+// The forced keyframes are limited to one per keyframeInterval,
+// the requests above that are ignored.
+func (vp *VideoPipe) ForceKeyframe() {
+	vp.keyframeLock.Lock()
+	defer vp.keyframeLock.Unlock()
+	now := vp.now()
+	if !vp.lastKeyframe.IsZero() && now.Sub(vp.lastKeyframe) < keyframeInterval {
+		return
+	}
+	vp.lastKeyframe = now
+	atomic.StoreUint32(&vp.keyframe, 1)
+}
+
+// applyKeyframe forces the asked keyframe, it tells if the next frame is the keyframe.
+func (vp *VideoPipe) applyKeyframe() bool {
+	if atomic.SwapUint32(&vp.keyframe, 0) == 0 {
+		return false
+	}
+	enc, ok := vp.encoder.(KeyframeForcer)
+	if ok {
+		enc.ForceKeyframe()
 	}
+	return ok
 }
 
 func (vp *VideoPipe) Stop() {
@@ -0,0 +1,281 @@
+package encoder
+
+import (
+	"errors"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
+)
+
+type encoderMock struct {
+	bitrates  []uint
+	keyframes int
+}
+
+func (e *encoderMock) Encode([]byte) []byte { return []byte{0} }
+func (e *encoderMock) Shutdown() error      { return nil }
+func (e *encoderMock) ForceKeyframe()       { e.keyframes++ }
+func (e *encoderMock) SetBitrate(kbps uint) error {
+	e.bitrates = append(e.bitrates, kbps)
+	return nil
+}
+
+func sendFrame(t *testing.T, pipe *VideoPipe) {
+	pipe.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}
+	select {
+	case <-pipe.Output:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no frame")
+	}
+}
+
+func TestVideoPipeSetBitrate(t *testing.T) {
+	enc := &encoderMock{}
+	pipe := NewVideoPipe(enc, 16, 16)
+	go pipe.Start()
+	frame := func() { sendFrame(t, pipe) }
+
+	frame()
+	pipe.SetBitrate(1000)
+	frame()
+	frame()
+	// only the last one before a frame
+	pipe.SetBitrate(2000)
+	pipe.SetBitrate(1500)
+	frame()
+	pipe.Stop()
+
+	if len(enc.bitrates) != 2 || enc.bitrates[0] != 1000 || enc.bitrates[1] != 1500 {
+		t.Errorf("wrong bitrates %v, expected [1000 1500]", enc.bitrates)
+	}
+}
+
+func TestVideoPipeForceKeyframe(t *testing.T) {
+	enc := &encoderMock{}
+	pipe := NewVideoPipe(enc, 16, 16)
+	now := time.Unix(0, 0)
+	pipe.now = func() time.Time { return now }
+	go pipe.Start()
+
+	sendFrame(t, pipe)
+	// a burst of requests
+	for i := 0; i < 5; i++ {
+		pipe.ForceKeyframe()
+		sendFrame(t, pipe)
+	}
+	now = now.Add(999 * time.Millisecond)
+	pipe.ForceKeyframe()
+	sendFrame(t, pipe)
+	if enc.keyframes != 1 {
+		t.Errorf("expected 1 keyframe, got %v", enc.keyframes)
+	}
+
+	now = now.Add(time.Millisecond)
+	pipe.ForceKeyframe()
+	sendFrame(t, pipe)
+	pipe.Stop()
+	if enc.keyframes != 2 {
+		t.Errorf("expected 2 keyframes, got %v", enc.keyframes)
+	}
+}
+
+type plainEncoderMock struct{}
+
+func (e *plainEncoderMock) Encode([]byte) []byte { return []byte{0} }
+func (e *plainEncoderMock) Shutdown() error      { return nil }
+
+// Tests that the first and the forced keyframes are marked.
+func TestVideoPipeKeyframeMark(t *testing.T) {
+	pipe := NewVideoPipe(&encoderMock{}, 16, 16)
+	go pipe.Start()
+	defer pipe.Stop()
+	frame := func() bool {
+		pipe.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}
+		return (<-pipe.Output).Keyframe
+	}
+	if !frame() {
+		t.Errorf("the first frame is not a keyframe")
+	}
+	if frame() {
+		t.Errorf("the second frame is a keyframe")
+	}
+	pipe.ForceKeyframe()
+	if !frame() || frame() {
+		t.Errorf("wrong forced keyframe")
+	}
+
+	// the encoders without the forced keyframes
+	plain := NewVideoPipe(&plainEncoderMock{}, 16, 16)
+	go plain.Start()
+	defer plain.Stop()
+	plain.ForceKeyframe()
+	plain.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}
+	plain.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}
+	if !(<-plain.Output).Keyframe || (<-plain.Output).Keyframe {
+		t.Errorf("wrong keyframes of the plain encoder")
+	}
+}
+
+func TestVideoPipeSetFilter(t *testing.T) {
+	pipe := NewVideoPipe(&encoderMock{}, 16, 16)
+	go pipe.Start()
+	defer pipe.Stop()
+	small := func() bool {
+		pipe.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 8, 8))}
+		select {
+		case <-pipe.Output:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+
+	// the frames of the wrong size are dropped
+	if small() {
+		t.Errorf("the frame of the wrong size has been encoded")
+	}
+	chain, err := filter.New([]string{filter.Nearest, filter.Scanlines}, 16, 16, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe.SetFilter(chain)
+	if !small() {
+		t.Errorf("the upscaled frame hasn't been encoded")
+	}
+	sendFrame(t, pipe)
+}
+
+// failingEncoderMock fails every n-th frame (0 -- all the frames),
+// its frames after the restarts are keyframes (1).
+type failingEncoderMock struct {
+	n              int
+	panics         bool
+	frames, resets int
+	err            error
+	kf             bool
+}
+
+func (e *failingEncoderMock) Encode([]byte) []byte {
+	e.frames++
+	if e.n == 0 || e.frames%e.n == 0 {
+		if e.panics {
+			panic("encoder failure")
+		}
+		e.err = errors.New("encoder failure")
+		return nil
+	}
+	e.err = nil
+	if e.kf {
+		e.kf = false
+		return []byte{1}
+	}
+	return []byte{0}
+}
+func (e *failingEncoderMock) Err() error      { return e.err }
+func (e *failingEncoderMock) Reset() error    { e.resets++; return nil }
+func (e *failingEncoderMock) ForceKeyframe()  { e.kf = true }
+func (e *failingEncoderMock) Shutdown() error { return nil }
+
+// Tests that the pipe goes on with the keyframes after the encoder failures.
+func TestVideoPipeEncoderFailure(t *testing.T) {
+	enc := &failingEncoderMock{n: 100}
+	pipe := NewVideoPipe(enc, 16, 16)
+	var failed []error
+	pipe.OnFailure(func(err error) { failed = append(failed, err) })
+	restarts := 0
+	pipe.OnRestart(func(error) { restarts++ })
+	go pipe.Start()
+
+	recovered := false
+	for i := 1; i <= 1000; i++ {
+		pipe.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}
+		if i%100 == 0 {
+			recovered = true
+			continue
+		}
+		select {
+		case frame, ok := <-pipe.Output:
+			if !ok {
+				t.Fatalf("the pipe has stopped on the frame %v", i)
+			}
+			if keyframe := frame.Data[0] == 1; keyframe != recovered {
+				t.Fatalf("wrong keyframe %v of the frame %v", keyframe, i)
+			}
+			if frame.Keyframe != (recovered || i == 1) {
+				t.Fatalf("wrong keyframe mark %v of the frame %v", frame.Keyframe, i)
+			}
+			recovered = false
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no frame %v", i)
+		}
+	}
+	pipe.Stop()
+	if enc.resets != 10 {
+		t.Errorf("wrong number of the encoder restarts %v, expected 10", enc.resets)
+	}
+	if restarts != 10 {
+		t.Errorf("wrong number of the reported restarts %v, expected 10", restarts)
+	}
+	if len(failed) > 0 {
+		t.Errorf("the recovered failures have been reported, %v", failed)
+	}
+}
+
+// Tests that the encoder failures in a row are reported once.
+func TestVideoPipeEncoderFailures(t *testing.T) {
+	for _, panics := range []bool{false, true} {
+		enc := &failingEncoderMock{panics: panics}
+		pipe := NewVideoPipe(enc, 16, 16)
+		failed := make(chan error, 10)
+		pipe.OnFailure(func(err error) { failed <- err })
+		go pipe.Start()
+		for i := 0; i < maxFailures*2; i++ {
+			pipe.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}
+		}
+		pipe.Stop()
+		if len(failed) != 1 {
+			t.Errorf("wrong number of the reported failures %v (panics %v), expected 1", len(failed), panics)
+		}
+		if enc.resets != maxFailures*2 {
+			t.Errorf("wrong number of the encoder restarts %v (panics %v)", enc.resets, panics)
+		}
+	}
+}
+
+// Tests that the pipe whose output isn't taken drops the frames
+// after the stall threshold instead of blocking the input.
+func TestVideoPipeStall(t *testing.T) {
+	const threshold = 20 * time.Millisecond
+	enc := &encoderMock{}
+	pipe := NewVideoPipe(enc, 16, 16)
+	stalls := make(chan time.Time, 10)
+	pipe.OnStall(threshold, func() { stalls <- time.Now() })
+	go pipe.Start()
+
+	// nobody takes the output
+	start := time.Now()
+	for i := 0; i < cap(pipe.Output)+2; i++ {
+		select {
+		case pipe.Input <- InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the stalled pipe doesn't take the frame %v", i)
+		}
+	}
+	select {
+	case at := <-stalls:
+		if d := at.Sub(start); d < threshold || d > time.Second {
+			t.Errorf("the stall has been reported after %v, expected %v", d, threshold)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the stall hasn't been reported")
+	}
+	pipe.Stop()
+	if len(pipe.Output) != cap(pipe.Output) {
+		t.Errorf("wrong number of the frames in the output %v", len(pipe.Output))
+	}
+	if enc.keyframes == 0 {
+		t.Errorf("no keyframe after the dropped frame")
+	}
+}
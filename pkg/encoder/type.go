@@ -3,19 +3,76 @@ package encoder
 import (
 	"image"
 	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/media"
 )
 
 type InFrame struct {
 	Image    *image.RGBA
 	Duration time.Duration
+	// the time when the frame has been received
+	Time time.Time
+	// Buf is the pooled buffer of the image (may be nil),
+	// the pipe releases it after the encoding
+	Buf *media.Frame
+	// the arrival time of the first player input shown in the frame (may be zero)
+	Input time.Time
+	// Keyframe tells that the frame is the first or a forced keyframe of the encoder,
+	// the other keyframes of the encoder are not marked
+	Keyframe bool
+	// Timestamp is the media time of the frame (see media.Clock)
+	Timestamp time.Duration
 }
 
 type OutFrame struct {
 	Data     []byte
 	Duration time.Duration
+	// the time when the source frame has been received
+	Time time.Time
+	// Buf is the pooled buffer of the data,
+	// the receiver should release it after use
+	Buf *media.Frame
+	// the arrival time of the first player input shown in the frame (may be zero)
+	Input time.Time
+	// Keyframe tells that the frame is the first or a forced keyframe of the encoder,
+	// the other keyframes of the encoder are not marked
+	Keyframe bool
+	// Timestamp is the media time of the frame (see media.Clock)
+	Timestamp time.Duration
 }
 
+// Encoder encodes the YUV I420 frames,
+// the encoded data is valid until the next Encode call.
 type Encoder interface {
 	Encode(input []byte) []byte
 	Shutdown() error
 }
+
+// BitrateSetter is an encoder which bitrate can be changed on the fly.
+type BitrateSetter interface {
+	// SetBitrate sets the target bitrate in kbit/s.
+	SetBitrate(kbps uint) error
+}
+
+// RGBAEncoder is an encoder which takes the RGBA frames as is,
+// so they are not converted into YUV before the encoding.
+// The encoded data is valid until the next call.
+type RGBAEncoder interface {
+	EncodeRGBA(img *image.RGBA) []byte
+}
+
+// KeyframeForcer is an encoder which can be asked for a keyframe.
+type KeyframeForcer interface {
+	// ForceKeyframe makes the next encoded frame a keyframe.
+	ForceKeyframe()
+}
+
+// Resetter is an encoder which reports its errors and can be
+// reinitialized after them.
+type Resetter interface {
+	// Err returns the error of the last encoded frame, if any.
+	Err() error
+	// Reset reinitializes the codec with its current settings,
+	// the next encoded frame is a keyframe.
+	Reset() error
+}
@@ -12,6 +12,7 @@ package vpx
 #include <string.h>
 
 #define VP8_FOURCC 0x30385056
+#define VP9_FOURCC 0x30395056
 
 typedef struct VpxInterface {
   const char *const name;
@@ -30,6 +31,9 @@ vpx_codec_err_t call_vpx_codec_enc_config_default(const VpxInterface *encoder, v
 vpx_codec_err_t call_vpx_codec_enc_init(vpx_codec_ctx_t *codec, const VpxInterface *encoder, vpx_codec_enc_cfg_t *cfg) {
 	return vpx_codec_enc_init(codec, encoder->codec_interface(), cfg, 0);
 }
+vpx_codec_err_t call_vpx_codec_control(vpx_codec_ctx_t *codec, int id, int value) {
+	return vpx_codec_control_(codec, id, value);
+}
 
 FrameBuffer get_frame_buffer(vpx_codec_ctx_t *codec, vpx_codec_iter_t *iter) {
     // iter has set to NULL when after add new image
@@ -42,7 +46,10 @@ FrameBuffer get_frame_buffer(vpx_codec_ctx_t *codec, vpx_codec_iter_t *iter) {
     return fb;
 }
 
-const VpxInterface vpx_encoders[] = {{ "vp8", VP8_FOURCC, &vpx_codec_vp8_cx }};
+const VpxInterface vpx_encoders[] = {
+	{ "vp8", VP8_FOURCC, &vpx_codec_vp8_cx },
+	{ "vp9", VP9_FOURCC, &vpx_codec_vp9_cx },
+};
 
 int vpx_img_plane_width(const vpx_image_t *img, int plane) {
 	if (plane > 0 && img->x_chroma_shift > 0)
@@ -76,6 +83,7 @@ void vpx_img_read(vpx_image_t *dst, void *src) {
 import "C"
 import (
 	"fmt"
+	"math"
 	"unsafe"
 )
 
@@ -83,69 +91,132 @@ type Vpx struct {
 	frameCount C.int
 	image      C.vpx_image_t
 	codecCtx   C.vpx_codec_ctx_t
+	cfg        C.vpx_codec_enc_cfg_t
 	kfi        C.int
+	// force the next frame to be a keyframe
+	kf bool
+
+	// the codec and its speed (VP9) for the restarts
+	encoder *C.VpxInterface
+	vp9     bool
+	speed   C.int
+	// the error of the last frame
+	err error
 }
 
+// NewEncoder creates a new VP8 or VP9 (with the Vp9 option) encoder.
 func NewEncoder(width, height int, options ...Option) (*Vpx, error) {
-	encoder := &C.vpx_encoders[0]
-	if encoder == nil {
-		return nil, fmt.Errorf("couldn't get the encoder")
-	}
-
 	opts := &Options{
 		Bitrate:     1200,
 		KeyframeInt: 5,
+		Speed:       7,
 	}
 
 	for _, opt := range options {
 		opt(opts)
 	}
 
+	encoder := &C.vpx_encoders[0]
+	if opts.Vp9 {
+		encoder = &C.vpx_encoders[1]
+	}
+	if encoder == nil {
+		return nil, fmt.Errorf("couldn't get the encoder")
+	}
+
 	vpx := Vpx{
 		frameCount: C.int(0),
 		kfi:        C.int(opts.KeyframeInt),
+		encoder:    encoder,
+		vp9:        opts.Vp9,
+		speed:      C.int(opts.Speed),
 	}
 
 	if C.vpx_img_alloc(&vpx.image, C.VPX_IMG_FMT_I420, C.uint(width), C.uint(height), 1) == nil {
 		return nil, fmt.Errorf("vpx_img_alloc failed")
 	}
 
-	var cfg C.vpx_codec_enc_cfg_t
-	if C.call_vpx_codec_enc_config_default(encoder, &cfg) != 0 {
+	cfg := &vpx.cfg
+	if C.call_vpx_codec_enc_config_default(encoder, cfg) != 0 {
 		return nil, fmt.Errorf("failed to get default codec config")
 	}
 
 	cfg.g_w = C.uint(width)
 	cfg.g_h = C.uint(height)
 	cfg.rc_target_bitrate = C.uint(opts.Bitrate)
+	if opts.Fps > 0 {
+		// the frames go one by one (pts + 1)
+		cfg.g_timebase.num, cfg.g_timebase.den = 1000, C.int(math.Round(opts.Fps*1000))
+	}
 	cfg.g_error_resilient = 1
+	// no frame lag for real-time (the VP9 default is 25)
+	cfg.g_lag_in_frames = 0
 
-	if C.call_vpx_codec_enc_init(&vpx.codecCtx, encoder, &cfg) != 0 {
-		return nil, fmt.Errorf("failed to initialize encoder")
+	if err := vpx.init(); err != nil {
+		return nil, err
 	}
-
 	return &vpx, nil
 }
 
+// init initializes the codec context with the config.
+func (vpx *Vpx) init() error {
+	if C.call_vpx_codec_enc_init(&vpx.codecCtx, vpx.encoder, &vpx.cfg) != 0 {
+		return fmt.Errorf("failed to initialize encoder")
+	}
+
+	if vpx.vp9 {
+		if C.call_vpx_codec_control(&vpx.codecCtx, C.VP8E_SET_CPUUSED, vpx.speed) != 0 {
+			C.vpx_codec_destroy(&vpx.codecCtx)
+			return fmt.Errorf("failed to set the encoder speed")
+		}
+	}
+	return nil
+}
+
 // see: https://chromium.googlesource.com/webm/libvpx/+/master/examples/simple_encoder.c
 func (vpx *Vpx) Encode(yuv []byte) []byte {
 	var iter C.vpx_codec_iter_t
 	C.vpx_img_read(&vpx.image, unsafe.Pointer(&yuv[0]))
 
 	var flags C.int
-	if vpx.kfi > 0 && vpx.frameCount%vpx.kfi == 0 {
+	if vpx.kf || vpx.kfi > 0 && vpx.frameCount%vpx.kfi == 0 {
 		flags |= C.VPX_EFLAG_FORCE_KF
+		vpx.kf = false
 	}
-	if C.vpx_codec_encode(&vpx.codecCtx, &vpx.image, C.vpx_codec_pts_t(vpx.frameCount), 1, C.vpx_enc_frame_flags_t(flags), C.VPX_DL_REALTIME) != 0 {
-		fmt.Println("Failed to encode frame")
-	}
+	ret := C.vpx_codec_encode(&vpx.codecCtx, &vpx.image, C.vpx_codec_pts_t(vpx.frameCount), 1, C.vpx_enc_frame_flags_t(flags), C.VPX_DL_REALTIME)
 	vpx.frameCount++
+	if vpx.err = nil; ret != 0 {
+		vpx.err = fmt.Errorf("failed to encode frame, %v", C.GoString(C.vpx_codec_error(&vpx.codecCtx)))
+		return []byte{}
+	}
 
 	fb := C.get_frame_buffer(&vpx.codecCtx, &iter)
 	if fb.ptr == nil {
 		return []byte{}
 	}
-	return C.GoBytes(fb.ptr, fb.size)
+	// the encoder memory is valid until the next call
+	return (*[1 << 30]byte)(fb.ptr)[:fb.size:fb.size]
+}
+
+func (vpx *Vpx) ForceKeyframe() { vpx.kf = true }
+
+// Err returns the error of the last encoded frame.
+func (vpx *Vpx) Err() error { return vpx.err }
+
+// Reset reinitializes the codec context with the current config.
+func (vpx *Vpx) Reset() error {
+	C.vpx_codec_destroy(&vpx.codecCtx)
+	vpx.err, vpx.kf = nil, true
+	return vpx.init()
+}
+
+// SetBitrate changes the target bitrate (kbit/s).
+func (vpx *Vpx) SetBitrate(kbps uint) error {
+	vpx.cfg.rc_target_bitrate = C.uint(kbps)
+	if C.vpx_codec_enc_config_set(&vpx.codecCtx, &vpx.cfg) != 0 {
+		return fmt.Errorf("failed to set the bitrate")
+	}
+	return nil
 }
 
 func (vpx *Vpx) Shutdown() error {
@@ -5,6 +5,13 @@ type Options struct {
 	Bitrate uint
 	// Force keyframe interval.
 	KeyframeInt uint
+	// Use VP9 instead of VP8.
+	Vp9 bool
+	// VP9 encoding speed (cpu-used) 0-9,
+	// the higher values are faster with lower quality.
+	Speed int
+	// The frame rate of the video for the rate control, the libvpx default (30) if zero.
+	Fps float64
 }
 
 type Option func(*Options)
@@ -13,5 +20,10 @@ func WithOptions(arg Options) Option {
 	return func(args *Options) {
 		args.Bitrate = arg.Bitrate
 		args.KeyframeInt = arg.KeyframeInt
+		args.Vp9 = arg.Vp9
+		args.Fps = arg.Fps
+		if arg.Speed > 0 {
+			args.Speed = arg.Speed
+		}
 	}
 }
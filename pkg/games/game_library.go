@@ -7,13 +7,19 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
 )
 
+// rescanDebounce is the delay of the rescans merging
+// the rapid changes of the library files.
+const rescanDebounce = 2 * time.Second
+
 // Config is an external configuration
 type Config struct {
 	// some directory which is going to be
@@ -27,6 +33,9 @@ type Config struct {
 	Verbose bool
 	// enable directory changes watch
 	WatchMode bool
+	// an interval between the library rescans,
+	// 0 -- disabled
+	RescanInterval time.Duration
 }
 
 // libConf is an optimized internal library configuration
@@ -48,7 +57,10 @@ type library struct {
 	// !should be a tree-based structure
 	// game name -> game meta
 	// games with duplicate names are merged
-	games map[string]GameMetadata
+	games   map[string]GameMetadata
+	gamesMu sync.RWMutex
+	// the content hashes of the game files by their paths
+	hashes map[string]fileHash
 
 	// to restrict parallel execution
 	// or throttling
@@ -56,12 +68,34 @@ type library struct {
 	mu                sync.Mutex
 	isScanning        bool
 	isScanningDelayed bool
+
+	// the delayed rescan merging the rescan calls of the debounce time
+	rescan   *time.Timer
+	debounce time.Duration
+	onChange func(Changes)
+	inUse    func(name string) bool
+}
+
+// Changes are the names of the added and removed games of a library scan.
+type Changes struct {
+	Added   []string
+	Removed []string
 }
 
+func (c Changes) IsEmpty() bool { return len(c.Added) == 0 && len(c.Removed) == 0 }
+
 type GameLibrary interface {
 	GetAll() []GameMetadata
 	FindGameByName(name string) GameMetadata
 	Scan()
+	// Rescan scans the library again after a short delay,
+	// the rescans of the delay make one scan.
+	Rescan()
+	// OnChange sets the listener of the game changes of the scans.
+	OnChange(fn func(Changes))
+	// KeepInUse sets the check of the games in use (i.e. with a room),
+	// such games are never removed from the library.
+	KeepInUse(fn func(name string) bool)
 }
 
 type FileExtensionWhitelist interface {
@@ -77,6 +111,16 @@ type GameMetadata struct {
 	Base string
 	// the game path relative to the library base path
 	Path string
+	// Discs are the disc image paths of multi-disc games (.m3u playlists)
+	// relative to the library base path, the first one is loaded.
+	Discs []string
+	// Overrides are the settings of the game
+	// overriding the emulator config or nil
+	Overrides *Overrides
+	// Hash is the content hash (SHA1) of the game file
+	// which keys the game saves and cheats, so they stay
+	// with the renamed game files
+	Hash string
 }
 
 func (c Config) GetSupportedExtensions() []string { return c.Supported }
@@ -106,16 +150,22 @@ func NewLibWhitelisted(conf Config, filter FileExtensionWhitelist) GameLibrary {
 		mu:        sync.Mutex{},
 		games:     map[string]GameMetadata{},
 		hasSource: hasSource,
+		debounce:  rescanDebounce,
 	}
 
 	if conf.WatchMode && hasSource {
 		go library.watch()
 	}
+	if conf.RescanInterval > 0 && hasSource {
+		go library.rescanEvery(conf.RescanInterval)
+	}
 
 	return library
 }
 
 func (lib *library) GetAll() []GameMetadata {
+	lib.gamesMu.RLock()
+	defer lib.gamesMu.RUnlock()
 	var res []GameMetadata
 	for _, value := range lib.games {
 		res = append(res, value)
@@ -125,6 +175,8 @@ func (lib *library) GetAll() []GameMetadata {
 
 // FindGameByName returns some game info with its full filepath
 func (lib *library) FindGameByName(name string) GameMetadata {
+	lib.gamesMu.RLock()
+	defer lib.gamesMu.RUnlock()
 	var game GameMetadata
 	if val, ok := lib.games[name]; ok {
 		val.Base = lib.config.path
@@ -155,28 +207,61 @@ func (lib *library) Scan() {
 	start := time.Now()
 	var games []GameMetadata
 	dir := lib.config.path
+	overrides := loadOverrides(dir)
+	hashes := make(map[string]fileHash)
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if info != nil && !info.IsDir() && lib.isFileExtensionSupported(path) {
+		if info == nil || info.IsDir() {
+			return nil
+		}
+		if emulator.IsPlaylist(path) {
+			if meta, ok := lib.getPlaylistMetadata(path, dir); ok && !lib.config.ignored[meta.Name] {
+				meta.Overrides = gameOverrides(meta.Name, path, overrides)
+				meta.Hash = lib.hash(hashes, path, info)
+				games = append(games, meta)
+			}
+			return nil
+		}
+		if emulator.IsArchive(path) {
+			if archived := lib.getArchiveMetadata(path, dir); len(archived) > 0 {
+				for _, meta := range archived {
+					if !lib.config.ignored[meta.Name] {
+						meta.Overrides = gameOverrides(meta.Name, path, overrides)
+						meta.Hash = lib.hash(hashes, filepath.Join(dir, meta.Path), info)
+						games = append(games, meta)
+					}
+				}
+				return nil
+			}
+		}
+		if lib.isFileExtensionSupported(path) {
 			meta := getMetadata(path, dir)
 			meta.uid = hash(path)
 
 			if !lib.config.ignored[meta.Name] {
+				meta.Overrides = gameOverrides(meta.Name, path, overrides)
+				meta.Hash = lib.hash(hashes, path, info)
 				games = append(games, meta)
 			}
 		}
 		return nil
 	})
+	games = withoutDiscs(games)
 
 	if err != nil {
 		log.Printf("[lib] scan error with %q: %v\n", dir, err)
 	}
 
-	if len(games) > 0 {
-		lib.set(games)
+	// the failed and empty scans (i.e. of the unmounted library) keep the old games
+	var changes Changes
+	if err == nil && len(games) > 0 {
+		lib.hashes = hashes
+		changes = lib.set(games)
+	} else {
+		log.Printf("[lib] scan... no games, the old ones are kept\n")
 	}
 
 	lib.lastScanDuration = time.Since(start)
@@ -194,6 +279,37 @@ func (lib *library) Scan() {
 	}
 
 	log.Printf("[lib] scan... completed\n")
+	if !changes.IsEmpty() {
+		log.Printf("[lib] games: +%d -%d\n", len(changes.Added), len(changes.Removed))
+		if lib.onChange != nil {
+			lib.onChange(changes)
+		}
+	}
+}
+
+func (lib *library) Rescan() {
+	if !lib.hasSource {
+		return
+	}
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+	if lib.rescan != nil {
+		lib.rescan.Stop()
+	}
+	lib.rescan = time.AfterFunc(lib.debounce, lib.Scan)
+}
+
+func (lib *library) OnChange(fn func(Changes)) { lib.onChange = fn }
+
+func (lib *library) KeepInUse(fn func(name string) bool) { lib.inUse = fn }
+
+// rescanEvery rescans the library periodically.
+func (lib *library) rescanEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		lib.Rescan()
+	}
 }
 
 // watch adds the ability to rescan the entire library
@@ -214,10 +330,10 @@ func (lib *library) watch() {
 				if !ok {
 					return
 				}
-				if event.Op == fsnotify.Create || event.Op == fsnotify.Remove {
+				if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
 					// !to try to add the proper file/dir add/remove scan logic
 					// which is tricky
-					repo.Scan()
+					repo.Rescan()
 				}
 			case _, ok := <-watcher.Errors:
 				if !ok {
@@ -235,12 +351,34 @@ func (lib *library) watch() {
 	log.Printf("[lib] the watch has ended\n")
 }
 
-func (lib *library) set(games []GameMetadata) {
+// set replaces the games of the library and returns the changes,
+// the games in use stay in the library.
+func (lib *library) set(games []GameMetadata) (changes Changes) {
 	res := make(map[string]GameMetadata)
 	for _, value := range games {
 		res[value.Name] = value
 	}
+	lib.gamesMu.Lock()
+	defer lib.gamesMu.Unlock()
+	for name, game := range lib.games {
+		if _, ok := res[name]; ok {
+			continue
+		}
+		if lib.inUse != nil && lib.inUse(name) {
+			res[name] = game
+			continue
+		}
+		changes.Removed = append(changes.Removed, name)
+	}
+	for name := range res {
+		if _, ok := lib.games[name]; !ok {
+			changes.Added = append(changes.Added, name)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
 	lib.games = res
+	return
 }
 
 func (lib *library) isFileExtensionSupported(path string) bool {
@@ -264,8 +402,84 @@ func getMetadata(path string, basePath string) GameMetadata {
 	}
 }
 
+// getPlaylistMetadata returns game info from a multi-disc playlist path.
+// The type of the game is the type of its first disc.
+func (lib *library) getPlaylistMetadata(path string, basePath string) (meta GameMetadata, ok bool) {
+	discs, err := emulator.LoadPlaylist(path)
+	if err != nil {
+		log.Printf("[lib] playlist %q error: %v\n", path, err)
+		return
+	}
+	if len(discs) == 0 || !lib.isFileExtensionSupported(discs[0]) {
+		return
+	}
+	meta = getMetadata(path, basePath)
+	meta.uid = hash(path)
+	meta.Type = strings.TrimPrefix(filepath.Ext(discs[0]), ".")
+	for _, disc := range discs {
+		rel, err := filepath.Rel(basePath, disc)
+		if err != nil {
+			return meta, false
+		}
+		meta.Discs = append(meta.Discs, rel)
+	}
+	return meta, true
+}
+
+// getArchiveMetadata returns the info of the games in an archive (zip).
+// The games of the archives with multiple games are named by their files,
+// the path of such games is archive#game, e.g. snes.zip#mario.sfc.
+// The archives without supported games (i.e. arcade romsets) have no games here.
+func (lib *library) getArchiveMetadata(path string, basePath string) (games []GameMetadata) {
+	members, err := emulator.ArchiveMembers(path)
+	if err != nil {
+		log.Printf("[lib] archive %q error: %v\n", path, err)
+		return
+	}
+	relPath, _ := filepath.Rel(basePath, path)
+	for _, member := range members {
+		if emulator.IsArchive(member) || !lib.isFileExtensionSupported(member) {
+			continue
+		}
+		name := filepath.Base(filepath.FromSlash(member))
+		ext := filepath.Ext(name)
+		games = append(games, GameMetadata{
+			uid:  hash(emulator.ArchivePath(path, member)),
+			Name: strings.TrimSuffix(name, ext),
+			Type: ext[1:],
+			Path: emulator.ArchivePath(relPath, member),
+		})
+	}
+	if len(games) == 1 {
+		games[0].Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return
+}
+
+// withoutDiscs removes the games which are discs of the multi-disc games.
+func withoutDiscs(games []GameMetadata) []GameMetadata {
+	discs := map[string]bool{}
+	for _, game := range games {
+		for _, disc := range game.Discs {
+			discs[disc] = true
+		}
+	}
+	if len(discs) == 0 {
+		return games
+	}
+	res := games[:0]
+	for _, game := range games {
+		if len(game.Discs) > 0 || !discs[game.Path] {
+			res = append(res, game)
+		}
+	}
+	return res
+}
+
 // dumpLibrary printouts the current library snapshot of games
 func (lib *library) dumpLibrary() {
+	lib.gamesMu.RLock()
+	defer lib.gamesMu.RUnlock()
 	var gameList strings.Builder
 	for _, game := range lib.games {
 		gameList.WriteString("    " + game.Name + " (" + game.Path + ")" + "\n")
@@ -1,7 +1,17 @@
 package games
 
 import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
 )
 
 func TestLibraryScan(t *testing.T) {
@@ -48,6 +58,242 @@ func TestLibraryScan(t *testing.T) {
 	}
 }
 
+func TestLibraryScanPlaylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "games_playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	files := map[string]string{
+		"psx/Game.m3u":          "#EXTM3U\nGame (Disc 1).cue\nGame (Disc 2).cue\n",
+		"psx/Game (Disc 1).cue": "",
+		"psx/Game (Disc 2).cue": "",
+		"psx/Unsupported.m3u":   "Unsupported.iso\n",
+		"Super Mario Bros.nes":  "",
+		"psx/Single disc.cue":   "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	library := NewLib(Config{BasePath: dir, Supported: []string{"cue", "nes"}})
+	library.Scan()
+	if games := library.GetAll(); len(games) != 3 {
+		t.Errorf("wrong games %v", games)
+	}
+	game := library.FindGameByName("Game")
+	if game.Type != "cue" || game.Path != filepath.FromSlash("psx/Game.m3u") {
+		t.Errorf("wrong multi-disc game %+v", game)
+	}
+	discs := []string{filepath.FromSlash("psx/Game (Disc 1).cue"), filepath.FromSlash("psx/Game (Disc 2).cue")}
+	if !reflect.DeepEqual(game.Discs, discs) {
+		t.Errorf("wrong discs %v, expected %v", game.Discs, discs)
+	}
+	for _, name := range []string{"Game (Disc 1)", "Unsupported"} {
+		if game := library.FindGameByName(name); game.Name != "" {
+			t.Errorf("unexpected game %+v", game)
+		}
+	}
+	if game := library.FindGameByName("Single disc"); len(game.Discs) != 0 {
+		t.Errorf("single disc game has discs %v", game.Discs)
+	}
+}
+
+func TestLibraryScanArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "games_archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	archives := map[string][]string{
+		"snes/Super Mario World.zip": {"readme.txt", "smw.sfc"},
+		"snes/collection.zip":        {"games/Zelda.sfc", "Mario Kart.smc"},
+		"mame/pacman.zip":            {"pacman.6e", "pacman.6f"},
+		"other.zip":                  {"notes.txt"},
+	}
+	for name, files := range archives {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := zip.NewWriter(f)
+		for _, file := range files {
+			if _, err := w.Create(file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_ = w.Close()
+		_ = f.Close()
+	}
+
+	library := NewLib(Config{BasePath: dir, Supported: []string{"sfc", "smc", "zip"}})
+	library.Scan()
+	want := map[string]GameMetadata{
+		"Super Mario World": {Name: "Super Mario World", Type: "sfc", Path: filepath.FromSlash("snes/Super Mario World.zip") + "#smw.sfc"},
+		"Zelda":             {Name: "Zelda", Type: "sfc", Path: filepath.FromSlash("snes/collection.zip") + "#games/Zelda.sfc"},
+		"Mario Kart":        {Name: "Mario Kart", Type: "smc", Path: filepath.FromSlash("snes/collection.zip") + "#Mario Kart.smc"},
+		"pacman":            {Name: "pacman", Type: "zip", Path: filepath.FromSlash("mame/pacman.zip")},
+		"other":             {Name: "other", Type: "zip", Path: "other.zip"},
+	}
+	if games := library.GetAll(); len(games) != len(want) {
+		t.Errorf("wrong games %+v", games)
+	}
+	for name, expected := range want {
+		game := library.FindGameByName(name)
+		if game.Name != expected.Name || game.Type != expected.Type || game.Path != expected.Path {
+			t.Errorf("wrong game %+v, expected %+v", game, expected)
+		}
+	}
+}
+
+func TestLibraryRescan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "games_rescan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	addRom := func(name string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addRom("Contra.nes")
+	addRom("Tetris.nes")
+
+	lib := NewLib(Config{BasePath: dir, Supported: []string{"nes"}}).(*library)
+	lib.debounce = 10 * time.Millisecond
+	lib.Scan()
+	changes := make(chan Changes, 10)
+	lib.OnChange(func(c Changes) { changes <- c })
+	inUse := "Tetris"
+	lib.KeepInUse(func(name string) bool { return name == inUse })
+
+	expect := func(expected Changes) {
+		t.Helper()
+		select {
+		case c := <-changes:
+			if !reflect.DeepEqual(c, expected) {
+				t.Errorf("wrong changes %+v, expected %+v", c, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no changes %+v", expected)
+		}
+	}
+
+	// the rapid rescans make one scan
+	addRom("Super Mario Bros.nes")
+	for i := 0; i < 5; i++ {
+		lib.Rescan()
+	}
+	expect(Changes{Added: []string{"Super Mario Bros"}})
+	if game := lib.FindGameByName("Super Mario Bros"); game.Path != "Super Mario Bros.nes" {
+		t.Errorf("no new game %+v", game)
+	}
+	if games := lib.GetAll(); len(games) != 3 {
+		t.Errorf("wrong games %+v", games)
+	}
+
+	// the games in use stay
+	for _, name := range []string{"Contra.nes", "Tetris.nes"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib.Rescan()
+	expect(Changes{Removed: []string{"Contra"}})
+	if game := lib.FindGameByName("Tetris"); game.Name == "" {
+		t.Errorf("the game in use has been removed")
+	}
+	inUse = ""
+	lib.Rescan()
+	expect(Changes{Removed: []string{"Tetris"}})
+
+	// the empty scans keep the games
+	if err := os.Remove(filepath.Join(dir, "Super Mario Bros.nes")); err != nil {
+		t.Fatal(err)
+	}
+	lib.Rescan()
+	select {
+	case c := <-changes:
+		t.Errorf("unexpected changes %+v", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if game := lib.FindGameByName("Super Mario Bros"); game.Name == "" {
+		t.Errorf("the games have been removed with the empty scan")
+	}
+}
+
+func TestLibraryHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "games_hashes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	rom := []byte("NES\x1a rom")
+	sum := sha1.Sum(rom)
+	expected := hex.EncodeToString(sum[:])
+	if err := ioutil.WriteFile(filepath.Join(dir, "Contra.nes"), rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "Zipped.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	if member, err := w.Create("zipped.nes"); err != nil {
+		t.Fatal(err)
+	} else if _, err := member.Write(rom); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	_ = f.Close()
+
+	hashes := 0
+	defer func(fn func(string) (string, error)) { gameHash = fn }(gameHash)
+	gameHash = func(path string) (string, error) {
+		hashes++
+		return emulator.GameHash(path)
+	}
+
+	lib := NewLib(Config{BasePath: dir, Supported: []string{"nes", "zip"}})
+	lib.Scan()
+	for _, name := range []string{"Contra", "Zipped"} {
+		if game := lib.FindGameByName(name); game.Hash != expected {
+			t.Errorf("wrong %v hash %v, expected %v", name, game.Hash, expected)
+		}
+	}
+	if hashes != 2 {
+		t.Errorf("the games have been hashed %v times", hashes)
+	}
+
+	// the hashes are computed once
+	lib.Scan()
+	if hashes != 2 {
+		t.Errorf("the unchanged games have been hashed again")
+	}
+	// the renamed game keeps its hash
+	if err := os.Rename(filepath.Join(dir, "Contra.nes"), filepath.Join(dir, "Contra (U).nes")); err != nil {
+		t.Fatal(err)
+	}
+	lib.Scan()
+	if game := lib.FindGameByName("Contra (U)"); game.Hash != expected || hashes != 3 {
+		t.Errorf("wrong renamed game hash %v (%v hashes)", game.Hash, hashes)
+	}
+}
+
 func _map(vs []GameMetadata, f func(info GameMetadata) string) []string {
 	vsm := make([]string, len(vs))
 	for i, v := range vs {
@@ -55,3 +301,32 @@ func _map(vs []GameMetadata, f func(info GameMetadata) string) []string {
 	}
 	return vsm
 }
+
+func TestLibraryScanOverrides(t *testing.T) {
+	library := NewLib(Config{BasePath: "testdata/overrides", Supported: []string{"nes"}})
+	library.Scan()
+
+	mario := library.FindGameByName("Super Mario Bros")
+	expected := &Overrides{
+		Scale:       1,
+		MaxPlayers:  1,
+		CoreOptions: map[string]string{"fceumm_region": "PAL", "fceumm_palette": "raw"},
+	}
+	if !reflect.DeepEqual(mario.Overrides, expected) {
+		t.Errorf("wrong overrides %+v, expected %+v", mario.Overrides, expected)
+	}
+	contra := library.FindGameByName("Contra")
+	expected = &Overrides{
+		Emulator:    "nes2",
+		AspectRatio: &AspectRatio{Keep: true, Width: 320, Height: 200},
+		Devices:     map[int]string{1: "Zapper"},
+		H264:        &H264{Preset: "faster", Profile: "high"},
+		Region:      "pal",
+	}
+	if !reflect.DeepEqual(contra.Overrides, expected) {
+		t.Errorf("wrong overrides %+v, expected %+v", contra.Overrides, expected)
+	}
+	if tetris := library.FindGameByName("Tetris"); tetris.Path == "" || tetris.Overrides != nil {
+		t.Errorf("wrong game without overrides %+v", tetris)
+	}
+}
@@ -0,0 +1,37 @@
+package games
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// gameHash hashes the content of the game files (the archive members).
+var gameHash = emulator.GameHash
+
+// fileHash is the content hash of the file of some size and
+// modification time, the hashes of the unchanged files
+// aren't computed again with the library rescans.
+type fileHash struct {
+	size int64
+	mod  time.Time
+	hash string
+}
+
+// hash returns the content hash of the game path (file or archive#member)
+// of the file with info and keeps it in the hashes of the scan.
+func (lib *library) hash(hashes map[string]fileHash, path string, info os.FileInfo) string {
+	if h, ok := lib.hashes[path]; ok && h.size == info.Size() && h.mod.Equal(info.ModTime()) {
+		hashes[path] = h
+		return h.hash
+	}
+	hash, err := gameHash(path)
+	if err != nil {
+		log.Printf("[lib] hash of %q error: %v\n", path, err)
+		return ""
+	}
+	hashes[path] = fileHash{size: info.Size(), mod: info.ModTime(), hash: hash}
+	return hash
+}
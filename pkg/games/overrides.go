@@ -0,0 +1,146 @@
+package games
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kkyr/fig"
+)
+
+// OverridesFile is the central file of the game overrides
+// in the library base path, the games are by their names there:
+//
+//	games:
+//	  Super Mario Bros:
+//	    scale: 1
+//
+// The games may have their own sidecar files next to them as well,
+// i.e. Super Mario Bros.yaml for Super Mario Bros.nes, they override
+// the central file.
+const OverridesFile = "overrides.yaml"
+
+// Overrides are the settings of a game overriding the ones
+// of its core and the emulator config (game > core > global).
+// Empty values are not overridden.
+type Overrides struct {
+	// Emulator is the name of the core from the core list of the config
+	Emulator    string            `json:"emulator,omitempty"`
+	AspectRatio *AspectRatio      `json:"aspect_ratio,omitempty"`
+	Scale       int               `json:"scale,omitempty"`
+	CoreOptions map[string]string `json:"core_options,omitempty"`
+	MaxPlayers  int               `json:"max_players,omitempty"`
+	// Devices are the controller devices of the ports, see the core config
+	Devices map[int]string `json:"devices,omitempty"`
+	H264    *H264          `json:"h264,omitempty"`
+	// Region forces the region of the game (pal, ntsc)
+	// with the region option of its core
+	Region string `json:"region,omitempty"`
+}
+
+// H264 is the x264 encoder settings of the game, see the encoder config.
+type H264 struct {
+	Crf         uint8  `json:"crf,omitempty"`
+	Preset      string `json:"preset,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	Tune        string `json:"tune,omitempty"`
+	Level       string `json:"level,omitempty"`
+	RateControl string `json:"rate_control,omitempty"`
+	Bitrate     uint   `json:"bitrate,omitempty"`
+	Entropy     string `json:"entropy,omitempty"`
+}
+
+// AspectRatio is the viewport of the game, see the emulator config.
+type AspectRatio struct {
+	Keep        bool   `json:"keep"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ScalingMode string `json:"scaling_mode,omitempty"`
+}
+
+type overridesFile struct {
+	Games map[string]Overrides
+}
+
+// loadOverrides reads the central file of the game overrides,
+// the library without the file has no overrides.
+func loadOverrides(basePath string) map[string]Overrides {
+	var file overridesFile
+	if err := loadYaml(&file, filepath.Join(basePath, OverridesFile)); err != nil {
+		return nil
+	}
+	return file.Games
+}
+
+// sidecarOverrides reads the overrides of the game from its sidecar file,
+// i.e. games/<game name>.yaml for games/<game name>.nes.
+func sidecarOverrides(path string) (o Overrides, ok bool) {
+	name := strings.TrimSuffix(path, filepath.Ext(path)) + ".yaml"
+	return o, loadYaml(&o, name) == nil
+}
+
+func loadYaml(v interface{}, path string) error {
+	err := fig.Load(v, fig.File(filepath.Base(path)), fig.Dirs(filepath.Dir(path)))
+	if err != nil && !errors.Is(err, fig.ErrFileNotFound) && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[lib] overrides %q error: %v\n", path, err)
+	}
+	return err
+}
+
+// gameOverrides returns the overrides of the game of the file path
+// from the central file and its sidecar file or nil.
+func gameOverrides(name string, path string, central map[string]Overrides) *Overrides {
+	o, ok := central[name]
+	if sidecar, has := sidecarOverrides(path); has {
+		o, ok = o.Merge(sidecar), true
+	}
+	if !ok {
+		return nil
+	}
+	return &o
+}
+
+// Merge returns the overrides with the non-empty values of other over them.
+func (o Overrides) Merge(other Overrides) Overrides {
+	if other.Emulator != "" {
+		o.Emulator = other.Emulator
+	}
+	if other.AspectRatio != nil {
+		o.AspectRatio = other.AspectRatio
+	}
+	if other.Scale > 0 {
+		o.Scale = other.Scale
+	}
+	if other.H264 != nil {
+		o.H264 = other.H264
+	}
+	if other.MaxPlayers > 0 {
+		o.MaxPlayers = other.MaxPlayers
+	}
+	if other.Region != "" {
+		o.Region = other.Region
+	}
+	if len(other.CoreOptions) > 0 {
+		options := make(map[string]string, len(o.CoreOptions)+len(other.CoreOptions))
+		for k, v := range o.CoreOptions {
+			options[k] = v
+		}
+		for k, v := range other.CoreOptions {
+			options[k] = v
+		}
+		o.CoreOptions = options
+	}
+	if len(other.Devices) > 0 {
+		devices := make(map[int]string, len(o.Devices)+len(other.Devices))
+		for k, v := range o.Devices {
+			devices[k] = v
+		}
+		for k, v := range other.Devices {
+			devices[k] = v
+		}
+		o.Devices = devices
+	}
+	return o
+}
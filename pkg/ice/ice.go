@@ -25,6 +25,18 @@ func NewIceServerCredentials(url string, user string, credential string) webrtc.
 	}
 }
 
+// Replace returns the servers with the replaced {tags} of their URLs.
+func Replace(iceServers []webrtc.IceServer, replacements ...Replacement) []webrtc.IceServer {
+	servers := make([]webrtc.IceServer, len(iceServers))
+	for i, ice := range iceServers {
+		for _, replacement := range replacements {
+			ice.Url = strings.Replace(ice.Url, "{"+replacement.From+"}", replacement.To, -1)
+		}
+		servers[i] = ice
+	}
+	return servers
+}
+
 func ToJson(iceServers []webrtc.IceServer, replacements ...Replacement) string {
 	var sb strings.Builder
 	sn, n := len(iceServers), len(replacements)
@@ -0,0 +1,87 @@
+package ice
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
+)
+
+// defaultTurnTTL is the lifetime of the credentials without the TTL.
+const defaultTurnTTL = 24 * time.Hour
+
+// Turn mints the time-limited credentials of the TURN servers
+// with their shared secret (TURN REST API, i.e. coturn use-auth-secret).
+// The username is the expiry time (Unix) and the user (expiry:user),
+// the credential is base64(HMAC-SHA1(secret, username)).
+type Turn struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTurn creates the credentials of the secret with the TTL,
+// the empty secret disables them.
+func NewTurn(secret string, ttl time.Duration) *Turn {
+	if ttl <= 0 {
+		ttl = defaultTurnTTL
+	}
+	return &Turn{secret: []byte(secret), ttl: ttl, now: time.Now}
+}
+
+// Enabled tells if the credentials are minted.
+func (t *Turn) Enabled() bool { return t != nil && len(t.secret) > 0 }
+
+// Credentials returns new username and credential of the user.
+func (t *Turn) Credentials(user string) (username string, credential string) {
+	username = strconv.FormatInt(t.now().Add(t.ttl).Unix(), 10) + ":" + user
+	return username, t.credential(username)
+}
+
+// Valid checks the credential and expiry of the username
+// the same way the TURN servers do.
+func (t *Turn) Valid(username string, credential string) bool {
+	if !t.Enabled() {
+		return false
+	}
+	i := strings.Index(username, ":")
+	if i < 0 {
+		return false
+	}
+	expiry, err := strconv.ParseInt(username[:i], 10, 64)
+	if err != nil || t.now().Unix() >= expiry {
+		return false
+	}
+	return hmac.Equal([]byte(credential), []byte(t.credential(username)))
+}
+
+// WithCredentials returns the servers with new credentials of the user
+// for the TURN servers (turn:, turns:) without the static ones.
+func (t *Turn) WithCredentials(iceServers []webrtc.IceServer, user string) []webrtc.IceServer {
+	servers := make([]webrtc.IceServer, len(iceServers))
+	copy(servers, iceServers)
+	if !t.Enabled() {
+		return servers
+	}
+	for i, ice := range servers {
+		if !isTurn(ice.Url) || ice.Username != "" || ice.Credential != "" {
+			continue
+		}
+		servers[i].Username, servers[i].Credential = t.Credentials(user)
+	}
+	return servers
+}
+
+func (t *Turn) credential(username string) string {
+	mac := hmac.New(sha1.New, t.secret)
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func isTurn(url string) bool {
+	return strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:")
+}
@@ -0,0 +1,76 @@
+package ice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
+)
+
+func TestTurnCredentials(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	turn := NewTurn("secret", time.Hour)
+	turn.now = func() time.Time { return now }
+
+	username, credential := turn.Credentials("user1")
+	if username != "1600003600:user1" {
+		t.Errorf("wrong username %v", username)
+	}
+	// echo -n 1600003600:user1 | openssl dgst -sha1 -hmac secret -binary | base64
+	if credential != "MI3j0E4xtjtWUD3SFtU2dvCWHGY=" {
+		t.Errorf("wrong credential %v", credential)
+	}
+
+	tests := []struct {
+		name       string
+		username   string
+		credential string
+		after      time.Duration
+		valid      bool
+	}{
+		{name: "valid", username: username, credential: credential, after: 59 * time.Minute, valid: true},
+		{name: "expired", username: username, credential: credential, after: time.Hour},
+		{name: "wrong credential", username: username, credential: "MI3j0E4xtjtWUD3SFtU2dvCWHGZ="},
+		{name: "another user", username: "1600003600:user2", credential: credential},
+		{name: "extended expiry", username: "1700000000:user1", credential: credential},
+		{name: "no expiry", username: "user1", credential: credential},
+	}
+	for _, test := range tests {
+		turn.now = func() time.Time { return now.Add(test.after) }
+		if valid := turn.Valid(test.username, test.credential); valid != test.valid {
+			t.Errorf("%v: the credentials are valid %v, expected %v", test.name, valid, test.valid)
+		}
+	}
+	if NewTurn("another", time.Hour).Valid(username, credential) {
+		t.Errorf("the credentials of another secret are valid")
+	}
+}
+
+func TestTurnWithCredentials(t *testing.T) {
+	servers := []webrtc.IceServer{
+		NewIceServer("stun:stun.l.google.com:19302"),
+		NewIceServer("turn:localhost:3478"),
+		NewIceServer("turns:localhost:5349?transport=tcp"),
+		NewIceServerCredentials("turn:localhost:3479", "root", "root"),
+	}
+	turn := NewTurn("secret", time.Hour)
+	minted := turn.WithCredentials(servers, "user1")
+
+	if minted[0].Username != "" || minted[0].Credential != "" {
+		t.Errorf("the STUN server has got the credentials %v", minted[0])
+	}
+	for _, ice := range minted[1:3] {
+		if !turn.Valid(ice.Username, ice.Credential) {
+			t.Errorf("the TURN server has got wrong credentials %v", ice)
+		}
+	}
+	if minted[3] != servers[3] {
+		t.Errorf("the static credentials have changed %v", minted[3])
+	}
+	if servers[1].Username != "" {
+		t.Errorf("the config servers have changed")
+	}
+	if disabled := NewTurn("", 0).WithCredentials(servers, "user1"); disabled[1] != servers[1] {
+		t.Errorf("the disabled credentials are minted %v", disabled[1])
+	}
+}
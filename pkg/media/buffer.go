@@ -38,3 +38,6 @@ func (b *Buffer) Write(s Samples, onFull OnFull) (r int) {
 	}
 	return
 }
+
+// Len returns the number of the written samples waiting for the next callback.
+func (b *Buffer) Len() int { return b.wi }
@@ -0,0 +1,74 @@
+package media
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the monotonic media clock of the video and audio of a game,
+// the video time moves with the frames of the game and the audio time
+// with its samples, so both streams get the sample-accurate timestamps
+// of the same timeline whatever the wall time of their frames is.
+// While fast-forwarding the clock runs at the normal speed of the game.
+// The nil clock is always at zero.
+type Clock struct {
+	mu   sync.Mutex
+	fps  float64
+	rate float64
+	// the media times in seconds
+	video float64
+	audio float64
+}
+
+// NewClock returns the clock of the game of the frame rate
+// and the audio sample rate.
+func NewClock(fps float64, sampleRate float64) *Clock {
+	return &Clock{fps: fps, rate: sampleRate}
+}
+
+// Video returns the time of the current video frame.
+func (c *Clock) Video() time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return seconds(c.video)
+}
+
+// Frame moves the video time to the next frame of the game
+// running with the speed multiplier.
+func (c *Clock) Frame(speed float64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fps > 0 {
+		c.video += 1 / (c.fps * clampSpeed(speed))
+	}
+}
+
+// Audio returns the time of the audio batch of the number of the frames
+// (the samples of all the channels), the time moves past the batch.
+func (c *Clock) Audio(frames int, speed float64) time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.audio
+	if c.rate > 0 {
+		c.audio += float64(frames) / (c.rate * clampSpeed(speed))
+	}
+	return seconds(t)
+}
+
+func clampSpeed(speed float64) float64 {
+	if !(speed >= 1) {
+		return 1
+	}
+	return speed
+}
+
+func seconds(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
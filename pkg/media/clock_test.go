@@ -0,0 +1,54 @@
+package media
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	// NES, 60.0988 fps and 44100 Hz at 735.7 samples per frame
+	const fps, rate = 60.0988, 44100.0
+	c := NewClock(fps, rate)
+	frame := 0.0
+	var last time.Duration
+	for i := 0; i < 30*60*60; i++ {
+		// the batches of the cores are of whole samples
+		frame += rate / fps
+		n := int(frame)
+		frame -= float64(n)
+		if ts := c.Audio(n, 1); ts < last {
+			t.Fatalf("the audio time goes back %v < %v", ts, last)
+		}
+		c.Frame(1)
+	}
+	// 30 minutes of the frames
+	expected := seconds(30 * 60 * 60 / fps)
+	if d := c.Video() - expected; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("wrong video time %v, expected %v", c.Video(), expected)
+	}
+	// the audio is less than one sample behind
+	audio := c.Audio(0, 1)
+	if d := c.Video() - audio; d < 0 || d > seconds(1/rate) {
+		t.Errorf("the audio time %v drifts from the video time %v", audio, c.Video())
+	}
+}
+
+func TestClockSpeed(t *testing.T) {
+	c := NewClock(50, 48000)
+	for i := 0; i < 100; i++ {
+		c.Frame(4)
+		_ = c.Audio(960, 4)
+	}
+	// 100 frames of the 4x game are 0.5s of the stream
+	if v := c.Video(); v != 500*time.Millisecond {
+		t.Errorf("wrong video time %v", v)
+	}
+	if a := c.Audio(0, 4); a != 500*time.Millisecond {
+		t.Errorf("wrong audio time %v", a)
+	}
+	// the wrong multipliers are the normal speed
+	c.Frame(0)
+	if v := c.Video(); v != 520*time.Millisecond {
+		t.Errorf("wrong video time %v", v)
+	}
+}
@@ -0,0 +1,80 @@
+package media
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Frame is a reference-counted buffer of the video frame taken from a FramePool.
+// It goes back into the pool when all its holders have released it,
+// so its data should not be used after the Release call.
+// The nil frames (not pooled) are valid and do nothing.
+type Frame struct {
+	Data []byte
+	refs int32
+	pool *FramePool
+	// release is the Release method value made once per buffer
+	release func()
+	// free gives the not pooled buffer back to its owner
+	free func()
+}
+
+// FramePool reuses the frame buffers between the frames of a video stream.
+type FramePool struct {
+	pool sync.Pool
+}
+
+// Get returns a frame of size bytes with one reference.
+// The data of the reused frames is not cleared.
+func (p *FramePool) Get(size int) *Frame {
+	f, _ := p.pool.Get().(*Frame)
+	if f == nil || cap(f.Data) < size {
+		f = &Frame{Data: make([]byte, size), pool: p}
+		f.release = f.Release
+	}
+	f.Data = f.Data[:size]
+	f.refs = 1
+	return f
+}
+
+// NewFrame returns the frame of some other buffer (i.e. the shared memory) with one reference,
+// the free function is called when all its holders have released it.
+func NewFrame(data []byte, free func()) *Frame {
+	f := &Frame{Data: data, refs: 1, free: free}
+	f.release = f.Release
+	return f
+}
+
+// Retain adds a reference to the frame.
+func (f *Frame) Retain() {
+	if f == nil {
+		return
+	}
+	if atomic.AddInt32(&f.refs, 1) <= 1 {
+		panic("media: retain of the released frame")
+	}
+}
+
+// Release drops a reference to the frame.
+func (f *Frame) Release() {
+	if f == nil {
+		return
+	}
+	switch refs := atomic.AddInt32(&f.refs, -1); {
+	case refs == 0 && f.free != nil:
+		f.free()
+	case refs == 0:
+		poison(f.Data)
+		f.pool.pool.Put(f)
+	case refs < 0:
+		panic("media: the frame is released twice")
+	}
+}
+
+// Releaser returns the Release function of the frame without its allocation.
+func (f *Frame) Releaser() func() {
+	if f == nil {
+		return nil
+	}
+	return f.release
+}
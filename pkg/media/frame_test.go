@@ -0,0 +1,68 @@
+package media
+
+import "testing"
+
+func TestFramePool(t *testing.T) {
+	var pool FramePool
+	f := pool.Get(16)
+	if len(f.Data) != 16 {
+		t.Fatalf("wrong frame size %v", len(f.Data))
+	}
+	f.Retain()
+	f.Release()
+	f.Release()
+
+	// it could be another buffer after GC
+	g := pool.Get(8)
+	if len(g.Data) != 8 || g.refs != 1 {
+		t.Errorf("wrong reused frame %v, %v refs", len(g.Data), g.refs)
+	}
+	g.Release()
+
+	var nilFrame *Frame
+	nilFrame.Retain()
+	nilFrame.Release()
+	if nilFrame.Releaser() != nil {
+		t.Errorf("the nil frame has a releaser")
+	}
+}
+
+func TestNewFrame(t *testing.T) {
+	freed := 0
+	f := NewFrame(make([]byte, 16), func() { freed++ })
+	f.Retain()
+	f.Releaser()()
+	if freed != 0 {
+		t.Errorf("the held frame is freed")
+	}
+	f.Release()
+	if freed != 1 {
+		t.Errorf("the frame is freed %v times", freed)
+	}
+}
+
+func TestFrameReleasedTwice(t *testing.T) {
+	var pool FramePool
+	f := pool.Get(16)
+	f.Release()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("no panic of the second release")
+		}
+	}()
+	f.Release()
+}
+
+func TestFramePoolNoAlloc(t *testing.T) {
+	var pool FramePool
+	pool.Get(1024).Release()
+	allocs := testing.AllocsPerRun(100, func() {
+		f := pool.Get(1024)
+		f.Retain()
+		f.Releaser()()
+		f.Release()
+	})
+	if allocs > 0 {
+		t.Errorf("the pool allocates %v times per frame", allocs)
+	}
+}
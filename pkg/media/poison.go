@@ -0,0 +1,16 @@
+//go:build poison
+// +build poison
+
+package media
+
+// poisonByte fills the released frames,
+// so their use after the release is visible in the video.
+const poisonByte = 0xdb
+
+// poison fills the released buffer with junk.
+// It's enabled with the poison build tag.
+func poison(data []byte) {
+	for i := range data {
+		data[i] = poisonByte
+	}
+}
@@ -0,0 +1,19 @@
+//go:build poison
+// +build poison
+
+package media
+
+import "testing"
+
+func TestFramePoison(t *testing.T) {
+	var pool FramePool
+	f := pool.Get(4)
+	data := f.Data
+	copy(data, []byte{1, 2, 3, 4})
+	f.Release()
+	for _, b := range data {
+		if b != poisonByte {
+			t.Fatalf("the released frame isn't poisoned %v", data)
+		}
+	}
+}
@@ -1,25 +1,215 @@
 package media
 
-// ResampleStretch does a simple stretching of audio samples.
-func ResampleStretch(pcm []int16, size int) []int16 {
-	r, l, audio := make([]int16, size/2), make([]int16, size/2), make([]int16, size)
-	// ratio is basically the destination sample rate
-	// divided by the origin sample rate (i.e. 48000/44100)
-	ratio := float32(size) / float32(len(pcm))
-	for i, n := 0, len(pcm)-1; i < n; i += 2 {
-		idx := int(float32(i/2) * ratio)
-		r[idx], l[idx] = pcm[i], pcm[i+1]
+import "math"
+
+// The resampler types.
+const (
+	// ResamplerFast is the linear interpolation
+	ResamplerFast = "fast"
+	// ResamplerQuality is the windowed-sinc interpolation
+	ResamplerQuality = "quality"
+)
+
+// Resampler converts the audio samples of one sample rate into another.
+// It keeps its state between the calls, so the audio stream may be split
+// into the chunks of any size (in whole frames) and the fractional sample rates
+// (i.e. 32040.5 Hz) don't drift.
+type Resampler interface {
+	// Resample converts the interleaved (16bit PCM) samples of the input rate
+	// into the samples of the output rate.
+	Resample(pcm Samples) Samples
+}
+
+// NewResampler returns the resampler of the type (fast, quality)
+// for the interleaved samples with the number of channels.
+// The unknown types are the quality ones.
+func NewResampler(kind string, from, to float64, channels int) Resampler {
+	if channels < 1 {
+		channels = 1
+	}
+	if from == to || from <= 0 || to <= 0 {
+		return passthrough{}
+	}
+	if kind == ResamplerFast {
+		return &linear{step: from / to, channels: channels, prev: make(Samples, channels)}
 	}
-	for i, n := 1, len(r); i < n; i++ {
-		if r[i] == 0 {
-			r[i] = r[i-1]
+	return newSinc(from, to, channels)
+}
+
+type passthrough struct{}
+
+func (passthrough) Resample(pcm Samples) Samples { return pcm }
+
+// linear is the linear interpolation resampler.
+type linear struct {
+	// the input frames per one output frame
+	step float64
+	// the number of the output frames and the consumed input frames,
+	// the position of the next output frame is counted from them
+	// so it doesn't depend on the chunks and doesn't accumulate errors,
+	// the frame -1 is the last one of the previous chunk
+	outN, inN int64
+	channels  int
+	prev      Samples
+}
+
+func (l *linear) Resample(pcm Samples) Samples {
+	ch := l.channels
+	n := len(pcm) / ch
+	if n == 0 {
+		return nil
+	}
+	out := make(Samples, 0, (int(float64(n)/l.step)+2)*ch)
+	frame := func(i int) Samples {
+		if i < 0 {
+			return l.prev
+		}
+		return pcm[i*ch : i*ch+ch]
+	}
+	for {
+		pos := float64(l.outN)*l.step - float64(l.inN)
+		if pos >= float64(n-1) {
+			break
+		}
+		i := int(math.Floor(pos))
+		frac := pos - float64(i)
+		a, b := frame(i), frame(i+1)
+		for c := 0; c < ch; c++ {
+			out = append(out, clip16(float64(a[c])+(float64(b[c])-float64(a[c]))*frac))
+		}
+		l.outN++
+	}
+	l.inN += int64(n)
+	copy(l.prev, pcm[(n-1)*ch:n*ch])
+	return out
+}
+
+const (
+	// the number of the input frames on each side of the sinc kernel
+	sincHalf = 16
+	// the number of the precomputed kernel phases between two input frames
+	sincPhases = 256
+)
+
+// sinc is the windowed-sinc interpolation resampler
+// with the low-pass cutoff below the lower of the rates.
+type sinc struct {
+	step float64
+	// the number of the output frames and the dropped input frames
+	outN, inN int64
+	channels  int
+	// the input frames kept for the kernel
+	hist Samples
+	// the kernel coefficients by the phase
+	table [][]float64
+}
+
+func newSinc(from, to float64, channels int) *sinc {
+	cutoff := 0.95 * math.Min(1, to/from)
+	table := make([][]float64, sincPhases+1)
+	for p := range table {
+		row := make([]float64, 2*sincHalf)
+		frac, sum := float64(p)/sincPhases, 0.0
+		for j := range row {
+			d := frac + sincHalf - 1 - float64(j)
+			row[j] = cutoff * sincFn(cutoff*d) * blackman(d/sincHalf)
+			sum += row[j]
 		}
-		if l[i] == 0 {
-			l[i] = l[i-1]
+		// the unit gain for each phase
+		for j := range row {
+			row[j] /= sum
 		}
+		table[p] = row
+	}
+	return &sinc{
+		step:     from / to,
+		channels: channels,
+		// the silence before the stream start
+		hist:  make(Samples, (sincHalf-1)*channels),
+		table: table,
+	}
+}
+
+func (s *sinc) Resample(pcm Samples) Samples {
+	ch := s.channels
+	buf := append(s.hist, pcm[:len(pcm)/ch*ch]...)
+	n := len(buf) / ch
+	out := make(Samples, 0, (int(float64(len(pcm)/ch)/s.step)+2)*ch)
+	coef := make([]float64, 2*sincHalf)
+	acc := make([]float64, ch)
+	// the first input frame is after the silence
+	pos := float64(s.outN)*s.step - float64(s.inN) + sincHalf - 1
+	for int(pos)+sincHalf < n {
+		base := int(pos)
+		s.kernel(pos-float64(base), coef)
+		start := (base - sincHalf + 1) * ch
+		for c := range acc {
+			acc[c] = 0
+		}
+		for j, k := range coef {
+			frame := buf[start+j*ch : start+j*ch+ch]
+			for c, v := range frame {
+				acc[c] += float64(v) * k
+			}
+		}
+		for _, v := range acc {
+			out = append(out, clip16(v))
+		}
+		s.outN++
+		pos = float64(s.outN)*s.step - float64(s.inN) + sincHalf - 1
+	}
+	// keep the frames for the next kernels
+	drop := int(pos) - sincHalf + 1
+	if drop > n {
+		drop = n
+	}
+	if drop > 0 {
+		s.hist = append(s.hist[:0:0], buf[drop*ch:]...)
+		s.inN += int64(drop)
+	} else {
+		s.hist = buf
+	}
+	return out
+}
+
+// kernel computes the kernel coefficients for the fractional position
+// between two input frames interpolating the precomputed phases.
+func (s *sinc) kernel(frac float64, coef []float64) {
+	p := frac * sincPhases
+	i := int(p)
+	if i >= sincPhases {
+		i = sincPhases - 1
+	}
+	t := p - float64(i)
+	a, b := s.table[i], s.table[i+1]
+	for j := range coef {
+		coef[j] = a[j] + (b[j]-a[j])*t
+	}
+}
+
+func sincFn(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// blackman is the Blackman window for x in [-1, 1].
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
+
+func clip16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
 	}
-	for i := 0; i < size-1; i += 2 {
-		audio[i], audio[i+1] = r[i/2], l[i/2]
+	if v < math.MinInt16 {
+		return math.MinInt16
 	}
-	return audio
+	return int16(v)
 }
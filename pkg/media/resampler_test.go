@@ -0,0 +1,113 @@
+package media
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns the stereo tone of the frequency and sample rate
+// for the time in seconds (the right channel is inverted).
+func sine(hz, rate float64, frames int, start int) Samples {
+	s := make(Samples, 0, frames*2)
+	for i := start; i < start+frames; i++ {
+		v := int16(math.Round(10000 * math.Sin(2*math.Pi*hz*float64(i)/rate)))
+		s = append(s, v, -v)
+	}
+	return s
+}
+
+// resample converts one second of the tone split into 20ms chunks of the input rate.
+func resample(r Resampler, hz, from float64) Samples {
+	var out Samples
+	// the fractional rates have the chunks of different size
+	for i, pos := 0, 0; i < 50; i++ {
+		next := int(math.Round(from * float64(i+1) / 50))
+		out = append(out, r.Resample(sine(hz, from, next-pos, pos))...)
+		pos = next
+	}
+	return out
+}
+
+// snr returns the signal-to-noise ratio (dB) of the resampled tone
+// compared to the reference tone of the output rate
+// without the edges of the stream.
+func snr(out Samples, hz, to float64) float64 {
+	ref := sine(hz, to, len(out)/2, 0)
+	var signal, noise float64
+	from, till := int(to/50), len(out)/2-int(to/50)
+	for i := from * 2; i < till*2; i++ {
+		signal += float64(ref[i]) * float64(ref[i])
+		d := float64(out[i]) - float64(ref[i])
+		noise += d * d
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+func TestResample(t *testing.T) {
+	tests := []struct {
+		from, to float64
+		kind     string
+		hz       float64
+		snr      float64
+	}{
+		{from: 32040.5, to: 48000, kind: ResamplerQuality, hz: 1000, snr: 70},
+		{from: 32040.5, to: 48000, kind: ResamplerQuality, hz: 10000, snr: 50},
+		{from: 44100, to: 48000, kind: ResamplerQuality, hz: 1000, snr: 70},
+		{from: 44100, to: 48000, kind: ResamplerQuality, hz: 15000, snr: 50},
+		{from: 32040.5, to: 48000, kind: ResamplerFast, hz: 1000, snr: 35},
+		{from: 44100, to: 48000, kind: ResamplerFast, hz: 1000, snr: 35},
+	}
+	for _, test := range tests {
+		out := resample(NewResampler(test.kind, test.from, test.to, 2), test.hz, test.from)
+
+		// no drift, one second of the output without the kernel delay
+		if frames := len(out) / 2; math.Abs(float64(frames)-test.to) > 2*sincHalf {
+			t.Errorf("%v %v->%v: %v frames in one second", test.kind, test.from, test.to, frames)
+		}
+		if q := snr(out, test.hz, test.to); q < test.snr {
+			t.Errorf("%v %v->%v %vHz: SNR %.1fdB < %vdB", test.kind, test.from, test.to, test.hz, q, test.snr)
+		}
+	}
+}
+
+// Tests that the resampled stream doesn't depend on its chunks.
+func TestResampleChunks(t *testing.T) {
+	for _, kind := range []string{ResamplerFast, ResamplerQuality} {
+		in := sine(440, 32040.5, 3000, 0)
+		whole := NewResampler(kind, 32040.5, 48000, 2).Resample(in)
+
+		var chunked Samples
+		r := NewResampler(kind, 32040.5, 48000, 2)
+		for i, size := 0, 1; i < len(in); i, size = i+size*2, size%37+1 {
+			end := i + size*2
+			if end > len(in) {
+				end = len(in)
+			}
+			chunked = append(chunked, r.Resample(in[i:end])...)
+		}
+		if len(chunked) != len(whole) {
+			t.Fatalf("%v: wrong chunked stream size %v, expected %v", kind, len(chunked), len(whole))
+		}
+		for i := range whole {
+			if chunked[i] != whole[i] {
+				t.Fatalf("%v: the chunked stream differs at %v: %v != %v", kind, i, chunked[i], whole[i])
+			}
+		}
+	}
+}
+
+func TestResamplePassthrough(t *testing.T) {
+	in := sine(1000, 48000, 960, 0)
+	out := NewResampler(ResamplerQuality, 48000, 48000, 2).Resample(in)
+	if len(out) != len(in) || out[10] != in[10] {
+		t.Errorf("the same rate audio has changed")
+	}
+}
+
+func BenchmarkResampleQuality(b *testing.B) {
+	r := NewResampler(ResamplerQuality, 32040.5, 48000, 2)
+	in := sine(1000, 32040.5, 641, 0)
+	for i := 0; i < b.N; i++ {
+		r.Resample(in)
+	}
+}
@@ -0,0 +1,98 @@
+package media
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SendWatch watches the sends into a media channel whose consumer may stop
+// taking them, the sends which haven't gone for the threshold are stalled.
+// The sends dropping their media when the channel is full (the peer queues)
+// tell the watch about their results with Sent and Full.
+// The blocking sends wait for the channel no longer than the threshold with Wait,
+// they should be made by one goroutine.
+// The watch doesn't allocate on the sends, the timer of the waits is reused.
+// The nil watch never stalls.
+type SendWatch struct {
+	// the time (unix ns) of the first send of the full channel, 0 -- not full,
+	// should be 64-bit aligned for atomic access
+	since int64
+	// 1 if the stall has been reported
+	stalled   uint32
+	threshold time.Duration
+	timer     *time.Timer
+	now       func() time.Time
+}
+
+// NewSendWatch returns the watch of the sends stalled for the threshold,
+// nil without the threshold.
+func NewSendWatch(threshold time.Duration) *SendWatch {
+	if threshold <= 0 {
+		return nil
+	}
+	return &SendWatch{threshold: threshold, now: time.Now}
+}
+
+// Threshold returns the time of the stalled sends.
+func (w *SendWatch) Threshold() time.Duration {
+	if w == nil {
+		return 0
+	}
+	return w.threshold
+}
+
+// Sent tells that the send has gone, the channel is taken again.
+func (w *SendWatch) Sent() {
+	if w == nil || atomic.LoadInt64(&w.since) == 0 {
+		return
+	}
+	atomic.StoreInt64(&w.since, 0)
+	atomic.StoreUint32(&w.stalled, 0)
+}
+
+// Full tells that the send hasn't gone since the channel is full.
+// It returns true once when the channel has been full for the threshold,
+// the next stall is reported after some send goes.
+func (w *SendWatch) Full() bool {
+	if w == nil {
+		return false
+	}
+	now := w.now().UnixNano()
+	since := atomic.LoadInt64(&w.since)
+	if since == 0 {
+		atomic.CompareAndSwapInt64(&w.since, 0, now)
+		return false
+	}
+	if time.Duration(now-since) < w.threshold {
+		return false
+	}
+	return atomic.CompareAndSwapUint32(&w.stalled, 0, 1)
+}
+
+// Wait returns the end of the wait of the blocked send,
+// the send has stalled when it comes first, otherwise Done should be called.
+// The nil watch waits forever.
+func (w *SendWatch) Wait() <-chan time.Time {
+	if w == nil {
+		return nil
+	}
+	if w.timer == nil {
+		w.timer = time.NewTimer(w.threshold)
+	} else {
+		w.timer.Reset(w.threshold)
+	}
+	return w.timer.C
+}
+
+// Done ends the wait of the send which has gone.
+func (w *SendWatch) Done() {
+	if w == nil || w.timer == nil {
+		return
+	}
+	if !w.timer.Stop() {
+		select {
+		case <-w.timer.C:
+		default:
+		}
+	}
+}
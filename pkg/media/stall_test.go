@@ -0,0 +1,100 @@
+package media
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendWatchFull(t *testing.T) {
+	now := time.Unix(100, 0)
+	w := NewSendWatch(time.Second)
+	w.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		after   time.Duration
+		sent    bool
+		stalled bool
+	}{
+		{name: "the first full send"},
+		{name: "full within the threshold", after: 500 * time.Millisecond},
+		{name: "full for the threshold", after: 500 * time.Millisecond, stalled: true},
+		{name: "the stall is reported once", after: time.Second},
+		{name: "the send has gone", sent: true},
+		{name: "full again", after: 500 * time.Millisecond},
+		{name: "full again within the threshold", after: 500 * time.Millisecond},
+		{name: "the next stall", after: 500 * time.Millisecond, stalled: true},
+	}
+	for _, test := range tests {
+		now = now.Add(test.after)
+		if test.sent {
+			w.Sent()
+			continue
+		}
+		if stalled := w.Full(); stalled != test.stalled {
+			t.Errorf("%v: stalled %v, expected %v", test.name, stalled, test.stalled)
+		}
+	}
+
+	var off *SendWatch
+	if NewSendWatch(0) != nil || off.Full() || off.Wait() != nil || off.Threshold() != 0 {
+		t.Errorf("the watch without the threshold stalls")
+	}
+	off.Sent()
+	off.Done()
+}
+
+func TestSendWatchWait(t *testing.T) {
+	w := NewSendWatch(20 * time.Millisecond)
+	// the wedged consumer
+	ch := make(chan int)
+	start := time.Now()
+	select {
+	case ch <- 1:
+		t.Fatalf("the send has gone")
+	case <-w.Wait():
+	}
+	if d := time.Since(start); d < w.Threshold() || d > time.Second {
+		t.Errorf("the send has stalled after %v, expected %v", d, w.Threshold())
+	}
+
+	// the taken send doesn't leave the timer behind
+	buf := make(chan int, 1)
+	select {
+	case buf <- 1:
+		w.Done()
+	case <-w.Wait():
+		t.Fatalf("the send has stalled")
+	}
+	time.Sleep(2 * w.Threshold())
+	select {
+	case <-w.Wait():
+	case buf <- 2:
+		t.Fatalf("the send into the full channel has gone")
+	}
+}
+
+// Tests that the watch doesn't allocate on the sends.
+func TestSendWatchAllocs(t *testing.T) {
+	w := NewSendWatch(time.Minute)
+	ch := make(chan int, 1)
+	n := testing.AllocsPerRun(100, func() {
+		select {
+		case ch <- 1:
+			w.Sent()
+		default:
+			w.Full()
+		}
+		select {
+		case ch <- 1:
+			w.Done()
+		case <-w.Wait():
+		default:
+			w.Done()
+		}
+		<-ch
+	})
+	if n > 0 {
+		t.Errorf("the watch allocates %v times per send", n)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package os
+
+import (
+	"syscall"
+	"time"
+)
+
+// CPUTime returns the user and system CPU time of the process.
+func CPUTime() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, err
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), nil
+}
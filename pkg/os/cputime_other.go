@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package os
+
+import (
+	"errors"
+	"time"
+)
+
+// CPUTime returns the user and system CPU time of the process,
+// it's Linux only.
+func CPUTime() (time.Duration, error) {
+	return 0, errors.New("no CPU time of the process on this system")
+}
@@ -0,0 +1,46 @@
+package os
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+)
+
+// loadAvgPath is the load average of the system (Linux).
+var loadAvgPath = "/proc/loadavg"
+
+// LoadAverage returns the load average of the last minute per CPU core,
+// 1 -- all the cores are busy.
+// The systems without /proc/loadavg return an error.
+func LoadAverage() (float64, error) {
+	data, err := ioutil.ReadFile(loadAvgPath)
+	if err != nil {
+		return 0, err
+	}
+	var load float64
+	if _, err := fmt.Sscanf(string(data), "%f", &load); err != nil {
+		return 0, fmt.Errorf("malformed load average %q, %w", data, err)
+	}
+	return load / float64(runtime.NumCPU()), nil
+}
+
+// memInfoPath is the memory usage of the system (Linux).
+var memInfoPath = "/proc/meminfo"
+
+// FreeMemory returns the memory in bytes available for the new processes.
+// The systems without /proc/meminfo return an error.
+func FreeMemory() (uint64, error) {
+	data, err := ioutil.ReadFile(memInfoPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		var kb uint64
+		if _, err := fmt.Sscanf(line, "MemAvailable: %d kB", &kb); err == nil {
+			return kb * 1024, nil
+		}
+	}
+	return 0, errors.New("no available memory in " + memInfoPath)
+}
@@ -23,6 +23,22 @@ func ExpectTermination() chan struct{} {
 	return done
 }
 
+// ExpectReload returns the channel of the reload (SIGHUP) signals.
+func ExpectReload() chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	reload := make(chan struct{}, 1)
+	go func() {
+		for range signals {
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return reload
+}
+
 func GetUserHome() (string, error) {
 	me, err := user.Current()
 	if err != nil {
@@ -0,0 +1,213 @@
+// Package input reads and writes the recordings of user input events.
+//
+// A recording is a header followed by a list of events:
+//
+//	"CGIR" version(1)
+//	frame delta(uvarint) player index(uvarint) connection(uvarint) [ID length(uvarint) ID] state length(uvarint) state
+//
+// The frames are counted from the start of the recording and
+// each event keeps the delta from the frame of the previous one.
+// The connection IDs are numbered in the order of appearance,
+// the ID itself is written only when a new number appears.
+package input
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	version = 1
+	// the max length of the connection IDs and input states
+	maxLength = 1 << 16
+)
+
+var magic = []byte("CGIR")
+
+var (
+	ErrFormat = errors.New("not an input recording")
+	ErrOrder  = errors.New("events are out of order")
+)
+
+// Event is a recorded user input of some player
+// at the frame counted from the start of the recording.
+type Event struct {
+	Frame     uint64
+	PlayerIdx int
+	ConnID    string
+	RawState  []byte
+}
+
+// Writer writes events into a recording.
+type Writer struct {
+	w     *bufio.Writer
+	conns map[string]uint64
+	frame uint64
+	buf   [binary.MaxVarintLen64]byte
+}
+
+// NewWriter writes the header of a recording into w.
+// The events are buffered until Flush.
+func NewWriter(w io.Writer) (*Writer, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(magic); err != nil {
+		return nil, err
+	}
+	if err := bw.WriteByte(version); err != nil {
+		return nil, err
+	}
+	return &Writer{w: bw, conns: map[string]uint64{}}, nil
+}
+
+func (w *Writer) uvarint(v uint64) error {
+	n := binary.PutUvarint(w.buf[:], v)
+	_, err := w.w.Write(w.buf[:n])
+	return err
+}
+
+func (w *Writer) bytes(b []byte) error {
+	if err := w.uvarint(uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Write adds the event to the recording,
+// the events should go in the order of their frames.
+func (w *Writer) Write(e Event) error {
+	if e.Frame < w.frame {
+		return ErrOrder
+	}
+	if e.PlayerIdx < 0 {
+		return fmt.Errorf("bad player index %v", e.PlayerIdx)
+	}
+	if len(e.ConnID) > maxLength || len(e.RawState) > maxLength {
+		return fmt.Errorf("too long event")
+	}
+	if err := w.uvarint(e.Frame - w.frame); err != nil {
+		return err
+	}
+	w.frame = e.Frame
+	if err := w.uvarint(uint64(e.PlayerIdx)); err != nil {
+		return err
+	}
+	conn, ok := w.conns[e.ConnID]
+	if !ok {
+		conn = uint64(len(w.conns))
+		w.conns[e.ConnID] = conn
+	}
+	if err := w.uvarint(conn); err != nil {
+		return err
+	}
+	if !ok {
+		if err := w.bytes([]byte(e.ConnID)); err != nil {
+			return err
+		}
+	}
+	return w.bytes(e.RawState)
+}
+
+// Flush writes the buffered events.
+func (w *Writer) Flush() error { return w.w.Flush() }
+
+// Reader reads events from a recording.
+type Reader struct {
+	r     *bufio.Reader
+	conns []string
+	frame uint64
+}
+
+// NewReader checks the header of the recording in r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrFormat
+	}
+	if string(header[:len(magic)]) != string(magic) {
+		return nil, ErrFormat
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported input recording version %v", header[len(magic)])
+	}
+	return &Reader{r: br}, nil
+}
+
+func (r *Reader) bytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxLength {
+		return nil, ErrFormat
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r.r, b)
+	return b, err
+}
+
+// Read returns the next event of the recording or io.EOF at its end.
+func (r *Reader) Read() (e Event, err error) {
+	delta, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		// the end of the recording is allowed only between the events
+		return e, err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+	r.frame += delta
+	e.Frame = r.frame
+
+	player, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return e, err
+	}
+	e.PlayerIdx = int(player)
+
+	conn, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return e, err
+	}
+	switch {
+	case conn < uint64(len(r.conns)):
+		e.ConnID = r.conns[conn]
+	case conn == uint64(len(r.conns)):
+		id, err := r.bytes()
+		if err != nil {
+			return e, err
+		}
+		e.ConnID = string(id)
+		r.conns = append(r.conns, e.ConnID)
+	default:
+		return e, ErrFormat
+	}
+
+	e.RawState, err = r.bytes()
+	return e, err
+}
+
+// ReadAll returns all the events of the recording.
+func ReadAll(r io.Reader) ([]Event, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	for {
+		e, err := reader.Read()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+}
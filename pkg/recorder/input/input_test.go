@@ -0,0 +1,87 @@
+package input
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+var events = []Event{
+	{Frame: 0, PlayerIdx: 0, ConnID: "peer1", RawState: []byte{0x01, 0x00}},
+	{Frame: 0, PlayerIdx: 1, ConnID: "peer2", RawState: []byte{0x00, 0x00, 0xff, 0x7f, 0x00, 0x80}},
+	{Frame: 17, PlayerIdx: 0, ConnID: "peer1", RawState: []byte{0x00, 0x00}},
+	{Frame: 300, PlayerIdx: 3, ConnID: "peer3", RawState: []byte{0xff, 0xff}},
+	{Frame: 100000, PlayerIdx: 1, ConnID: "peer2", RawState: []byte{0x10, 0x02}},
+	{Frame: 100000, PlayerIdx: 0, ConnID: "", RawState: []byte{}},
+}
+
+func write(t *testing.T, events []Event) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		if err := w.Write(e); err != nil {
+			t.Fatalf("write failed, %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := write(t, events)
+	got, err := ReadAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read failed, %v", err)
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Fatalf("wrong events\n got: %v\nwant: %v", got, events)
+	}
+	// the same events are encoded the same way
+	if again := write(t, got); !bytes.Equal(again, data) {
+		t.Errorf("different encoding\n got: %x\nwant: %x", again, data)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	var many []Event
+	for i := 0; i < 1000; i++ {
+		many = append(many, Event{Frame: uint64(i * 2), PlayerIdx: i % 2, ConnID: "0123456789abcdef", RawState: []byte{byte(i), 0}})
+	}
+	// the delta, player, connection and state length and the 2-byte state
+	if size := len(write(t, many)); size > 5+16+1+1000*6 {
+		t.Errorf("the recording is too large, %v bytes", size)
+	}
+}
+
+func TestBadRecordings(t *testing.T) {
+	data := write(t, events)
+	if _, err := ReadAll(bytes.NewReader([]byte("WEBM\x01"))); err != ErrFormat {
+		t.Errorf("expected format error, got %v", err)
+	}
+	if _, err := ReadAll(bytes.NewReader(data[:len(data)-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+	// the empty recording
+	if got, err := ReadAll(bytes.NewReader(data[:5])); err != nil || len(got) != 0 {
+		t.Errorf("expected no events, got %v, %v", got, err)
+	}
+}
+
+func TestWriteOrder(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(Event{Frame: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(Event{Frame: 9}); err != ErrOrder {
+		t.Errorf("expected order error, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package webm
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// EBML (Matroska) element IDs used in WebM files.
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+
+	idSegment       = 0x18538067
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idMuxingApp     = 0x4D80
+	idWritingApp    = 0x5741
+	idDuration      = 0x4489
+
+	idTracks            = 0x1654AE6B
+	idTrackEntry        = 0xAE
+	idTrackNumber       = 0xD7
+	idTrackUID          = 0x73C5
+	idTrackType         = 0x83
+	idCodecID           = 0x86
+	idCodecPrivate      = 0x63A2
+	idVideo             = 0xE0
+	idPixelWidth        = 0xB0
+	idPixelHeight       = 0xBA
+	idAudio             = 0xE1
+	idSamplingFrequency = 0xB5
+	idChannels          = 0x9F
+
+	idCluster     = 0x1F43B675
+	idTimecode    = 0xE7
+	idSimpleBlock = 0xA3
+)
+
+// unknownSize is the reserved 8-byte size of an element
+// which size is not known yet.
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// appendID appends an element ID, the IDs already contain their length marker.
+func appendID(b []byte, id uint32) []byte {
+	switch {
+	case id > 0xFFFFFF:
+		return append(b, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFFFF:
+		return append(b, byte(id>>16), byte(id>>8), byte(id))
+	case id > 0xFF:
+		return append(b, byte(id>>8), byte(id))
+	default:
+		return append(b, byte(id))
+	}
+}
+
+// appendSize appends an element size as the shortest variable-length integer.
+func appendSize(b []byte, size uint64) []byte {
+	n := 1
+	// all ones value of each length is reserved
+	for n < 8 && size >= 1<<(7*uint(n))-1 {
+		n++
+	}
+	return appendSizeN(b, size, n)
+}
+
+// appendSizeN appends an element size as a variable-length integer of n bytes.
+func appendSizeN(b []byte, size uint64, n int) []byte {
+	size |= 1 << (7 * uint(n))
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(size>>(8*uint(i))))
+	}
+	return b
+}
+
+func appendElement(b []byte, id uint32, data []byte) []byte {
+	b = appendID(b, id)
+	b = appendSize(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendUint(b []byte, id uint32, v uint64) []byte {
+	n := 1
+	for n < 8 && v>>(8*uint(n)) > 0 {
+		n++
+	}
+	data := make([]byte, n)
+	for i := 0; i < n; i++ {
+		data[n-1-i] = byte(v >> (8 * uint(i)))
+	}
+	return appendElement(b, id, data)
+}
+
+func appendFloat(b []byte, id uint32, v float64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(v))
+	return appendElement(b, id, data)
+}
+
+func appendString(b []byte, id uint32, s string) []byte { return appendElement(b, id, []byte(s)) }
@@ -0,0 +1,302 @@
+package webm
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+)
+
+// ErrUnsupportedCodec is returned for the video codecs
+// which can't be stored in WebM files by the muxer.
+var ErrUnsupportedCodec = errors.New("unsupported recording codec")
+
+const (
+	videoTrack = 1
+	audioTrack = 2
+
+	// the WebM time units are milliseconds
+	timecodeScale = time.Millisecond
+	// clusterDuration is the max duration of a cluster,
+	// the block timecodes are 16-bit offsets from the cluster one.
+	clusterDuration = 5 * time.Second
+
+	app = "cloud-game"
+)
+
+// VideoTrack describes the encoded video frames.
+type VideoTrack struct {
+	Codec  codec.VideoCodec
+	Width  int
+	Height int
+}
+
+// AudioTrack describes the Opus audio.
+type AudioTrack struct {
+	Channels  int
+	Frequency int
+}
+
+// codecID returns the WebM codec ID of the video codec.
+// H264 is not a WebM codec and AV1 needs its codec configuration,
+// so only the VPX codecs are supported for now.
+func codecID(c codec.VideoCodec) (string, error) {
+	switch c {
+	case codec.VPX:
+		return "V_VP8", nil
+	case codec.VP9:
+		return "V_VP9", nil
+	default:
+		return "", ErrUnsupportedCodec
+	}
+}
+
+// Supported tells if the video codec can be recorded.
+func Supported(c codec.VideoCodec) bool {
+	_, err := codecID(c)
+	return err == nil
+}
+
+// Keyframe tells if the encoded VPX frame is a keyframe.
+func Keyframe(c codec.VideoCodec, frame []byte) bool {
+	if len(frame) == 0 {
+		return false
+	}
+	switch c {
+	case codec.VPX:
+		// the frame tag starts with the inverse keyframe bit
+		return frame[0]&0x01 == 0
+	case codec.VP9:
+		// frame_marker(2) profile_low_bit(1) profile_high_bit(1) [reserved_zero(1)]
+		// show_existing_frame(1) frame_type(1)
+		b := frame[0]
+		if b>>6 != 2 {
+			return false
+		}
+		bit := uint(3)
+		if profile := (b>>5)&1 | (b>>4)&1<<1; profile == 3 {
+			bit--
+		}
+		if b>>bit&1 == 1 {
+			return false
+		}
+		return b>>(bit-1)&1 == 0
+	default:
+		return false
+	}
+}
+
+// Muxer writes the video and audio frames into a WebM file.
+// The frames are grouped into clusters which start with a video keyframe
+// and are written as a whole. Close finalizes the file,
+// if the writer can seek it also sets the size and the duration of the segment,
+// otherwise the file is left as a live stream which is still playable.
+type Muxer struct {
+	w io.Writer
+	// the number of written bytes
+	written int64
+	// the offsets of the segment size and the duration value
+	segmentSize int64
+	duration    int64
+	// the segment data start offset
+	segment int64
+
+	cluster     []byte
+	clusterTime time.Duration
+	last        time.Duration
+	started     bool
+}
+
+// NewMuxer writes the WebM header with the tracks and returns the muxer of the file.
+func NewMuxer(w io.Writer, video VideoTrack, audio AudioTrack) (*Muxer, error) {
+	id, err := codecID(video.Codec)
+	if err != nil {
+		return nil, err
+	}
+	m := &Muxer{w: w}
+
+	var header []byte
+	header = appendUint(header, idEBMLVersion, 1)
+	header = appendUint(header, idEBMLReadVersion, 1)
+	header = appendUint(header, idEBMLMaxIDLength, 4)
+	header = appendUint(header, idEBMLMaxSizeLength, 8)
+	header = appendString(header, idDocType, "webm")
+	header = appendUint(header, idDocTypeVersion, 4)
+	header = appendUint(header, idDocTypeReadVersion, 2)
+	b := appendElement(nil, idEBML, header)
+
+	b = appendID(b, idSegment)
+	m.segmentSize = int64(len(b))
+	b = append(b, unknownSize...)
+	m.segment = int64(len(b))
+
+	var info []byte
+	info = appendUint(info, idTimecodeScale, uint64(timecodeScale))
+	info = appendString(info, idMuxingApp, app)
+	info = appendString(info, idWritingApp, app)
+	info = appendFloat(info, idDuration, 0)
+	b = appendID(b, idInfo)
+	b = appendSize(b, uint64(len(info)))
+	// the duration float value is the last 8 bytes of the info
+	m.duration = int64(len(b) + len(info) - 8)
+	b = append(b, info...)
+
+	var v []byte
+	v = appendUint(v, idTrackNumber, videoTrack)
+	v = appendUint(v, idTrackUID, videoTrack)
+	v = appendUint(v, idTrackType, 1)
+	v = appendString(v, idCodecID, id)
+	var size []byte
+	size = appendUint(size, idPixelWidth, uint64(video.Width))
+	size = appendUint(size, idPixelHeight, uint64(video.Height))
+	v = appendElement(v, idVideo, size)
+
+	var a []byte
+	a = appendUint(a, idTrackNumber, audioTrack)
+	a = appendUint(a, idTrackUID, audioTrack)
+	a = appendUint(a, idTrackType, 2)
+	a = appendString(a, idCodecID, "A_OPUS")
+	a = appendElement(a, idCodecPrivate, opusHead(audio))
+	var params []byte
+	params = appendFloat(params, idSamplingFrequency, float64(audio.Frequency))
+	params = appendUint(params, idChannels, uint64(audio.Channels))
+	a = appendElement(a, idAudio, params)
+
+	tracks := appendElement(nil, idTrackEntry, v)
+	tracks = appendElement(tracks, idTrackEntry, a)
+	b = appendElement(b, idTracks, tracks)
+
+	if err := m.write(b); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// opusHead returns the Opus identification header (RFC 7845).
+func opusHead(audio AudioTrack) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = byte(audio.Channels)
+	binary.LittleEndian.PutUint32(head[12:], uint32(audio.Frequency))
+	return head
+}
+
+func (m *Muxer) write(b []byte) error {
+	n, err := m.w.Write(b)
+	m.written += int64(n)
+	return err
+}
+
+// WriteVideo adds an encoded video frame with its timestamp from the start of the recording.
+// The frames before the first keyframe are skipped.
+func (m *Muxer) WriteVideo(frame []byte, keyframe bool, ts time.Duration) error {
+	if !m.started {
+		if !keyframe {
+			return nil
+		}
+		m.started = true
+	}
+	if keyframe || ts-m.clusterTime >= clusterDuration {
+		if err := m.newCluster(ts); err != nil {
+			return err
+		}
+	}
+	m.block(videoTrack, frame, keyframe, ts)
+	return nil
+}
+
+// WriteAudio adds an Opus packet with its timestamp from the start of the recording.
+// The audio before the first video keyframe is skipped.
+func (m *Muxer) WriteAudio(packet []byte, ts time.Duration) error {
+	if !m.started {
+		return nil
+	}
+	if ts-m.clusterTime >= clusterDuration {
+		if err := m.newCluster(ts); err != nil {
+			return err
+		}
+	}
+	m.block(audioTrack, packet, true, ts)
+	return nil
+}
+
+// Size returns the size of the file with the buffered cluster.
+func (m *Muxer) Size() int64 { return m.written + int64(len(m.cluster)) }
+
+// Duration returns the timestamp of the last frame.
+func (m *Muxer) Duration() time.Duration { return m.last }
+
+func (m *Muxer) block(track byte, data []byte, keyframe bool, ts time.Duration) {
+	// the tracks are interleaved a bit loosely, so
+	// the late frames are moved to the start of the cluster
+	if ts < m.clusterTime {
+		ts = m.clusterTime
+	}
+	if ts > m.last {
+		m.last = ts
+	}
+	offset := int16((ts - m.clusterTime) / timecodeScale)
+	var flags byte
+	if keyframe {
+		flags = 0x80
+	}
+	m.cluster = appendID(m.cluster, idSimpleBlock)
+	m.cluster = appendSize(m.cluster, uint64(4+len(data)))
+	m.cluster = append(m.cluster, 0x80|track, byte(uint16(offset)>>8), byte(offset), flags)
+	m.cluster = append(m.cluster, data...)
+}
+
+func (m *Muxer) newCluster(ts time.Duration) error {
+	if err := m.flush(); err != nil {
+		return err
+	}
+	// keep the clusters in order
+	if ts < m.clusterTime {
+		ts = m.clusterTime
+	}
+	m.clusterTime = ts
+	m.cluster = appendUint(m.cluster[:0], idTimecode, uint64(ts/timecodeScale))
+	return nil
+}
+
+// flush writes the current cluster.
+func (m *Muxer) flush() error {
+	if len(m.cluster) == 0 {
+		return nil
+	}
+	cluster := appendElement(nil, idCluster, m.cluster)
+	m.cluster = m.cluster[:0]
+	return m.write(cluster)
+}
+
+// Close writes the last cluster and updates the header of the file if it's possible.
+// It doesn't close the writer.
+func (m *Muxer) Close() error {
+	if err := m.flush(); err != nil {
+		return err
+	}
+	ws, ok := m.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := ws.Seek(m.segmentSize, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(appendSizeN(nil, uint64(m.written-m.segment), 8)); err != nil {
+		return err
+	}
+	if _, err := ws.Seek(m.duration, io.SeekStart); err != nil {
+		return err
+	}
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(float64(m.last/timecodeScale)))
+	if _, err := ws.Write(duration); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,323 @@
+package webm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+)
+
+// element is a parsed EBML element.
+type element struct {
+	id       uint32
+	data     []byte
+	children []element
+}
+
+var masters = map[uint32]bool{
+	idEBML: true, idSegment: true, idInfo: true, idTracks: true,
+	idTrackEntry: true, idVideo: true, idAudio: true, idCluster: true,
+}
+
+func readVint(b []byte) (v uint64, n int, err error) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, fmt.Errorf("bad vint")
+	}
+	for n = 1; b[0]&(0x80>>uint(n-1)) == 0; n++ {
+	}
+	if len(b) < n {
+		return 0, 0, fmt.Errorf("short vint")
+	}
+	for i := 0; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n, nil
+}
+
+// parse reads EBML elements, the elements of unknown size take the rest of the data.
+func parse(b []byte) ([]element, error) {
+	var elements []element
+	for len(b) > 0 {
+		id, n, err := readVint(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+		size, n, err := readVint(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+		size &^= 1 << (7 * uint(n))
+		if size == 1<<(7*uint(n))-1 {
+			size = uint64(len(b))
+		}
+		if size > uint64(len(b)) {
+			return nil, fmt.Errorf("element %x size %v is out of %v", id, size, len(b))
+		}
+		e := element{id: uint32(id), data: b[:size]}
+		if masters[e.id] {
+			if e.children, err = parse(e.data); err != nil {
+				return nil, err
+			}
+		}
+		elements = append(elements, e)
+		b = b[size:]
+	}
+	return elements, nil
+}
+
+func (e element) find(id uint32) *element {
+	for i := range e.children {
+		if e.children[i].id == id {
+			return &e.children[i]
+		}
+	}
+	return nil
+}
+
+func (e element) all(id uint32) (elements []element) {
+	for _, c := range e.children {
+		if c.id == id {
+			elements = append(elements, c)
+		}
+	}
+	return
+}
+
+func (e element) uint() (v uint64) {
+	for _, b := range e.data {
+		v = v<<8 | uint64(b)
+	}
+	return
+}
+
+func (e element) float() float64 { return math.Float64frombits(binary.BigEndian.Uint64(e.data)) }
+
+// block is a parsed SimpleBlock.
+type block struct {
+	track    int
+	ts       time.Duration
+	keyframe bool
+	data     []byte
+}
+
+// webmFile is a parsed WebM file
+type webmFile struct {
+	docType  string
+	codec    string
+	width    uint64
+	height   uint64
+	channels uint64
+	duration float64
+	blocks   []block
+}
+
+// parseWebm parses and validates the structure of a WebM file.
+func parseWebm(t *testing.T, data []byte) webmFile {
+	root, err := parse(data)
+	if err != nil {
+		t.Fatalf("bad EBML, %v", err)
+	}
+	if len(root) != 2 || root[0].id != idEBML || root[1].id != idSegment {
+		t.Fatalf("expected EBML header and segment, got %v elements", len(root))
+	}
+	var f webmFile
+	if doc := root[0].find(idDocType); doc != nil {
+		f.docType = string(doc.data)
+	}
+
+	segment := root[1]
+	info := segment.find(idInfo)
+	if info == nil {
+		t.Fatalf("no segment info")
+	}
+	if scale := info.find(idTimecodeScale); scale == nil || scale.uint() != uint64(time.Millisecond) {
+		t.Fatalf("wrong timecode scale")
+	}
+	f.duration = info.find(idDuration).float()
+
+	tracks := segment.find(idTracks)
+	if tracks == nil {
+		t.Fatalf("no tracks")
+	}
+	for _, entry := range tracks.all(idTrackEntry) {
+		switch entry.find(idTrackType).uint() {
+		case 1:
+			f.codec = string(entry.find(idCodecID).data)
+			video := entry.find(idVideo)
+			f.width, f.height = video.find(idPixelWidth).uint(), video.find(idPixelHeight).uint()
+		case 2:
+			if id := string(entry.find(idCodecID).data); id != "A_OPUS" {
+				t.Errorf("wrong audio codec %v", id)
+			}
+			if head := entry.find(idCodecPrivate); head == nil || !bytes.HasPrefix(head.data, []byte("OpusHead")) {
+				t.Errorf("no Opus header")
+			}
+			f.channels = entry.find(idAudio).find(idChannels).uint()
+		}
+	}
+
+	for _, cluster := range segment.all(idCluster) {
+		if len(cluster.children) == 0 || cluster.children[0].id != idTimecode {
+			t.Fatalf("no cluster timecode")
+		}
+		timecode := time.Duration(cluster.children[0].uint()) * time.Millisecond
+		for i, b := range cluster.all(idSimpleBlock) {
+			track, n, err := readVint(b.data)
+			if err != nil {
+				t.Fatalf("bad block track, %v", err)
+			}
+			offset := int16(binary.BigEndian.Uint16(b.data[n:]))
+			if offset < 0 {
+				t.Errorf("negative block offset %v", offset)
+			}
+			if track&^0x80 == videoTrack && i == 0 && b.data[n+2]&0x80 == 0 {
+				t.Errorf("cluster starts without keyframe")
+			}
+			f.blocks = append(f.blocks, block{
+				track:    int(track &^ 0x80),
+				ts:       timecode + time.Duration(offset)*time.Millisecond,
+				keyframe: b.data[n+2]&0x80 != 0,
+				data:     b.data[n+3:],
+			})
+		}
+	}
+	return f
+}
+
+// vp8Frame returns a fake VP8 frame with the keyframe bit of its tag.
+func vp8Frame(i int, keyframe bool) []byte {
+	tag := byte(0x01)
+	if keyframe {
+		tag = 0x00
+	}
+	return []byte{tag, byte(i), byte(i >> 8), 0x9d, 0x01, 0x2a}
+}
+
+func TestMuxer(t *testing.T) {
+	f, err := ioutil.TempFile("", "webm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer func() { _ = f.Close() }()
+
+	mux, err := NewMuxer(f, VideoTrack{Codec: codec.VPX, Width: 320, Height: 240}, AudioTrack{Channels: 2, Frequency: 48000})
+	if err != nil {
+		t.Fatalf("no muxer, %v", err)
+	}
+	const frames = 600
+	for i := 0; i < frames; i++ {
+		ts := time.Duration(i) * 16 * time.Millisecond
+		if err := mux.WriteVideo(vp8Frame(i, i%120 == 0), i%120 == 0, ts); err != nil {
+			t.Fatal(err)
+		}
+		if i%20 == 0 {
+			if err := mux.WriteAudio([]byte{0xfc, byte(i)}, ts); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := mux.Close(); err != nil {
+		t.Fatalf("close failed, %v", err)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mux.Size() != int64(len(data)) {
+		t.Errorf("wrong size %v, expected %v", mux.Size(), len(data))
+	}
+
+	file := parseWebm(t, data)
+	if file.docType != "webm" || file.codec != "V_VP8" || file.width != 320 || file.height != 240 || file.channels != 2 {
+		t.Errorf("wrong header %+v", file)
+	}
+	if want := float64((frames - 1) * 16); file.duration != want {
+		t.Errorf("wrong duration %v, expected %v", file.duration, want)
+	}
+	var video, audio int
+	for _, b := range file.blocks {
+		if b.track == videoTrack {
+			want := time.Duration(video) * 16 * time.Millisecond
+			if b.ts != want || !bytes.Equal(b.data, vp8Frame(video, video%120 == 0)) || b.keyframe != (video%120 == 0) {
+				t.Fatalf("wrong video frame %v at %v", video, b.ts)
+			}
+			video++
+		} else {
+			audio++
+		}
+	}
+	if video != frames || audio != frames/20 {
+		t.Errorf("wrong number of frames, video %v, audio %v", video, audio)
+	}
+}
+
+func TestMuxerSkipsFramesBeforeKeyframe(t *testing.T) {
+	var buf bytes.Buffer
+	mux, err := NewMuxer(&buf, VideoTrack{Codec: codec.VP9, Width: 2, Height: 2}, AudioTrack{Channels: 2, Frequency: 48000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = mux.WriteAudio([]byte{1}, 0)
+	_ = mux.WriteVideo([]byte{2}, false, 0)
+	_ = mux.WriteVideo([]byte{3}, true, 16*time.Millisecond)
+	_ = mux.WriteAudio([]byte{4}, 10*time.Millisecond)
+	if err := mux.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// not seekable, so the segment is left with the unknown size
+	file := parseWebm(t, buf.Bytes())
+	if len(file.blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %v", len(file.blocks))
+	}
+	if b := file.blocks[0]; b.track != videoTrack || !bytes.Equal(b.data, []byte{3}) {
+		t.Errorf("expected the keyframe first, got %+v", b)
+	}
+	// the late audio is moved to the cluster start
+	if b := file.blocks[1]; b.track != audioTrack || b.ts != 16*time.Millisecond {
+		t.Errorf("wrong audio %+v", b)
+	}
+}
+
+func TestMuxerUnsupportedCodec(t *testing.T) {
+	if _, err := NewMuxer(&bytes.Buffer{}, VideoTrack{Codec: codec.H264}, AudioTrack{}); err != ErrUnsupportedCodec {
+		t.Errorf("expected unsupported codec, got %v", err)
+	}
+}
+
+func TestKeyframe(t *testing.T) {
+	tests := []struct {
+		codec codec.VideoCodec
+		frame []byte
+		key   bool
+	}{
+		{codec.VPX, []byte{0x50, 0x42, 0x00, 0x9d}, true},
+		{codec.VPX, []byte{0x31, 0x07, 0x00}, false},
+		// profile 0, keyframe
+		{codec.VP9, []byte{0x82, 0x49, 0x83}, true},
+		// profile 0, inter frame
+		{codec.VP9, []byte{0x86, 0x00}, false},
+		// profile 0, show existing frame
+		{codec.VP9, []byte{0x88}, false},
+		// profile 3, keyframe
+		{codec.VP9, []byte{0xB0, 0x49}, true},
+		// profile 3, inter frame
+		{codec.VP9, []byte{0xB2, 0x00}, false},
+		{codec.VP9, []byte{0x00}, false},
+		{codec.VP9, nil, false},
+	}
+	for _, test := range tests {
+		if key := Keyframe(test.codec, test.frame); key != test.key {
+			t.Errorf("%v frame %x keyframe %v, expected %v", test.codec, test.frame, key, test.key)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package webm
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+)
+
+// Options are the limits and the location of recordings.
+type Options struct {
+	Dir string
+	// the limits after which the recording stops, 0 -- unlimited
+	MaxDuration time.Duration
+	MaxSize     int64
+}
+
+type packet struct {
+	data     []byte
+	ts       time.Duration
+	video    bool
+	keyframe bool
+}
+
+const (
+	// the number of frames waiting for the writer
+	queueSize = 256
+	// the max size of the cluster and block headers of a frame
+	frameOverhead = 32
+)
+
+var reFileName = regexp.MustCompile(`[^\w.-]+`)
+
+// Recorder records the encoded media of a room into a WebM file.
+// The frames are written in a separate goroutine so the writes never block the callers,
+// when the writer falls behind the new frames are dropped.
+type Recorder struct {
+	path  string
+	video VideoTrack
+	opts  Options
+
+	start time.Time
+	now   func() time.Time
+
+	mu      sync.RWMutex
+	stopped bool
+	queue   chan packet
+	// finished is closed when the file has been finalized
+	finished chan struct{}
+	done     chan struct{}
+
+	file *os.File
+	mux  *Muxer
+	err  error
+}
+
+// NewRecorder creates a new recording file named after the room
+// and the current time in the directory of the options and starts the writer.
+func NewRecorder(name string, video VideoTrack, audio AudioTrack, opts Options) (*Recorder, error) {
+	if !Supported(video.Codec) {
+		return nil, ErrUnsupportedCodec
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	path := filepath.Join(opts.Dir,
+		fmt.Sprintf("%v_%v.webm", reFileName.ReplaceAllString(name, "_"), now.Format("20060102150405")))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	mux, err := NewMuxer(file, video, audio)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return nil, err
+	}
+	r := &Recorder{
+		path:  path,
+		video: video,
+		opts:  opts,
+		start: now,
+		now:   time.Now,
+		queue: make(chan packet, queueSize),
+		file:  file,
+		mux:   mux,
+
+		finished: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Path returns the recording file path.
+func (r *Recorder) Path() string { return r.path }
+
+// Finished returns a channel which is closed when the file has been finalized,
+// either by Stop or when the recording has reached its max duration or size.
+func (r *Recorder) Finished() <-chan struct{} { return r.finished }
+
+// WriteVideo queues an encoded video frame, the frame is timed by its source frame.
+// The frame is copied since the video pipe reuses its buffer.
+func (r *Recorder) WriteVideo(frame encoder.OutFrame) {
+	t := frame.Time
+	if t.IsZero() {
+		t = r.now()
+	}
+	data := append([]byte(nil), frame.Data...)
+	r.push(packet{data: data, ts: t.Sub(r.start), video: true, keyframe: Keyframe(r.video.Codec, data)})
+}
+
+// WriteAudio queues an Opus packet.
+// The packet is copied since the audio encoder reuses its buffer.
+func (r *Recorder) WriteAudio(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	r.push(packet{data: append([]byte(nil), data...), ts: r.now().Sub(r.start)})
+}
+
+func (r *Recorder) push(p packet) {
+	if p.ts < 0 {
+		p.ts = 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.stopped {
+		return
+	}
+	select {
+	case r.queue <- p:
+	default:
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	for p := range r.queue {
+		if r.mux == nil {
+			continue
+		}
+		if r.limited(p) {
+			log.Printf("Recording %v has reached its limit", r.path)
+			r.finish()
+			continue
+		}
+		var err error
+		if p.video {
+			err = r.mux.WriteVideo(p.data, p.keyframe, p.ts)
+		} else {
+			err = r.mux.WriteAudio(p.data, p.ts)
+		}
+		if err != nil {
+			log.Printf("error: recording %v, %v", r.path, err)
+			r.finish()
+		}
+	}
+	if r.mux != nil {
+		r.finish()
+	}
+}
+
+func (r *Recorder) limited(p packet) bool {
+	return r.opts.MaxDuration > 0 && p.ts >= r.opts.MaxDuration ||
+		r.opts.MaxSize > 0 && r.mux.Size()+int64(len(p.data))+frameOverhead > r.opts.MaxSize
+}
+
+// finish finalizes the file, the next frames are ignored.
+func (r *Recorder) finish() {
+	err := r.mux.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	if r.err == nil {
+		r.err = err
+	}
+	r.mux = nil
+	close(r.finished)
+}
+
+// Stop writes the queued frames, finalizes the file and
+// returns the first error of the recording.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	<-r.done
+	return r.err
+}
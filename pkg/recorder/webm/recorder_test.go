@@ -0,0 +1,99 @@
+package webm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+)
+
+func record(t *testing.T, opts Options, frames int) (*Recorder, webmFile, int) {
+	dir, err := ioutil.TempDir("", "webm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	opts.Dir = filepath.Join(dir, "recordings")
+
+	rec, err := NewRecorder("1a2b___Super Game", VideoTrack{Codec: codec.VPX, Width: 256, Height: 240},
+		AudioTrack{Channels: 2, Frequency: 48000}, opts)
+	if err != nil {
+		t.Fatalf("no recorder, %v", err)
+	}
+	for i := 0; i < frames; i++ {
+		ts := rec.start.Add(time.Duration(i) * 16 * time.Millisecond)
+		rec.now = func() time.Time { return ts }
+		rec.WriteVideo(encoder.OutFrame{Data: vp8Frame(i, i%60 == 0), Time: ts})
+		rec.WriteAudio([]byte{0xfc, byte(i)})
+		// don't overflow the queue
+		for len(rec.queue) > queueSize/2 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("stop failed, %v", err)
+	}
+	data, err := ioutil.ReadFile(rec.Path())
+	if err != nil {
+		t.Fatalf("no recording, %v", err)
+	}
+	return rec, parseWebm(t, data), len(data)
+}
+
+func TestRecorder(t *testing.T) {
+	rec, file, _ := record(t, Options{}, 300)
+
+	if name := filepath.Base(rec.Path()); !strings.HasPrefix(name, "1a2b___Super_Game_") || filepath.Ext(name) != ".webm" {
+		t.Errorf("wrong file name %v", name)
+	}
+	select {
+	case <-rec.Finished():
+	default:
+		t.Errorf("not finished after stop")
+	}
+	var video, audio int
+	for _, b := range file.blocks {
+		if b.track == videoTrack {
+			video++
+		} else {
+			audio++
+		}
+	}
+	if video != 300 || audio != 300 {
+		t.Errorf("wrong number of frames, video %v, audio %v", video, audio)
+	}
+	if file.duration != 299*16 {
+		t.Errorf("wrong duration %v", file.duration)
+	}
+	// stop is idempotent
+	if err := rec.Stop(); err != nil {
+		t.Errorf("second stop failed, %v", err)
+	}
+}
+
+func TestRecorderMaxDuration(t *testing.T) {
+	_, file, _ := record(t, Options{MaxDuration: time.Second}, 300)
+	last := file.blocks[len(file.blocks)-1]
+	if last.ts >= time.Second {
+		t.Errorf("recorded past the max duration, %v", last.ts)
+	}
+	if file.duration < 900 {
+		t.Errorf("recording is too short, %v", file.duration)
+	}
+}
+
+func TestRecorderMaxSize(t *testing.T) {
+	const size = 2000
+	_, file, n := record(t, Options{MaxSize: size}, 300)
+	if len(file.blocks) == 0 {
+		t.Fatalf("empty recording")
+	}
+	if n > size {
+		t.Errorf("recording size %v is over the max size %v", n, size)
+	}
+}
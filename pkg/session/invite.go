@@ -0,0 +1,47 @@
+package session
+
+import "time"
+
+// inviteTTL is the lifetime of the invites,
+// they outlive the join tokens to be shared with the room links.
+const inviteTTL = time.Hour
+
+// inviteClaims is the room of the worker the owner of the room
+// invites the new players into.
+type inviteClaims struct {
+	WorkerID string `json:"w"`
+	RoomID   string `json:"r"`
+	Invite   bool   `json:"i"`
+	Expires  int64  `json:"exp"`
+}
+
+// MintInvite returns a new invite of the players of the room of the worker,
+// only the workers of the rooms (the owners) should mint them.
+func (j *JoinTokens) MintInvite(workerID string, roomID string) (string, error) {
+	if !j.Enabled() {
+		return "", nil
+	}
+	return j.seal(inviteClaims{WorkerID: workerID, RoomID: roomID, Invite: true, Expires: j.now().Add(inviteTTL).Unix()})
+}
+
+// VerifyInvite checks the signature, expiry and room of the invite.
+func (j *JoinTokens) VerifyInvite(token string, workerID string, roomID string) error {
+	if !j.Enabled() {
+		return nil
+	}
+	var claims inviteClaims
+	if err := j.open(token, &claims); err != nil {
+		return err
+	}
+	// i.e. the join tokens
+	if !claims.Invite {
+		return ErrJoinInvalid
+	}
+	if j.now().Unix() >= claims.Expires {
+		return ErrJoinExpired
+	}
+	if claims.WorkerID != workerID || claims.RoomID != roomID {
+		return ErrJoinForbidden
+	}
+	return nil
+}
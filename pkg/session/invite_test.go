@@ -0,0 +1,41 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvites(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	invites := NewJoinTokens([]string{"secret"}, time.Minute)
+	invites.now = func() time.Time { return now }
+	token, err := invites.MintInvite("w1", "r1")
+	if err != nil {
+		t.Fatalf("couldn't mint the invite, %v", err)
+	}
+	join, _ := invites.Mint(JoinScope{WorkerID: "w1", RoomID: "r1", Role: Player})
+	other, _ := NewJoinTokens([]string{"another"}, time.Minute).MintInvite("w1", "r1")
+
+	tests := []struct {
+		name   string
+		token  string
+		worker string
+		room   string
+		after  time.Duration
+		err    error
+	}{
+		{name: "the happy path", token: token, worker: "w1", room: "r1", after: 59 * time.Minute},
+		{name: "expired", token: token, worker: "w1", room: "r1", after: time.Hour, err: ErrJoinExpired},
+		{name: "another room", token: token, worker: "w1", room: "r2", err: ErrJoinForbidden},
+		{name: "another worker", token: token, worker: "w2", room: "r1", err: ErrJoinForbidden},
+		{name: "another key", token: other, worker: "w1", room: "r1", err: ErrJoinInvalid},
+		{name: "the join token", token: join, worker: "w1", room: "r1", err: ErrJoinInvalid},
+		{name: "no invite", worker: "w1", room: "r1", err: ErrJoinInvalid},
+	}
+	for _, test := range tests {
+		invites.now = func() time.Time { return now.Add(test.after) }
+		if err := invites.VerifyInvite(test.token, test.worker, test.room); err != test.err {
+			t.Errorf("%v: got %v, expected %v", test.name, err, test.err)
+		}
+	}
+}
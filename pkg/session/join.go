@@ -0,0 +1,156 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Role is what the session does in the room.
+type Role string
+
+const (
+	Player    Role = "player"
+	Spectator Role = "spectator"
+)
+
+// RoleOf returns the role of the player or spectator.
+func RoleOf(spectator bool) Role {
+	if spectator {
+		return Spectator
+	}
+	return Player
+}
+
+// JoinScope is the room of the worker the join token lets the session into,
+// the empty room is a new one.
+type JoinScope struct {
+	WorkerID  string `json:"w"`
+	RoomID    string `json:"r"`
+	SessionID string `json:"s"`
+	Role      Role   `json:"role"`
+}
+
+var (
+	// ErrJoinExpired is the error of the outdated tokens,
+	// the session should get a new one.
+	ErrJoinExpired = errors.New("the join token has expired")
+	// ErrJoinInvalid is the error of the missing, malformed tokens
+	// or the tokens of unknown keys, the session should get a new one.
+	ErrJoinInvalid = errors.New("invalid join token")
+	// ErrJoinForbidden is the error of the tokens of other scopes.
+	ErrJoinForbidden = errors.New("the join token is not for the room")
+)
+
+// JoinTokens mints and checks the signed (HMAC-SHA256) short-lived tokens
+// the sessions join the rooms of the workers with.
+// The first key signs the tokens, the others only check them (rotation).
+type JoinTokens struct {
+	keys [][]byte
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+type joinClaims struct {
+	JoinScope
+	Expires int64 `json:"exp"`
+}
+
+// defaultJoinTTL is the lifetime of the tokens without the TTL.
+const defaultJoinTTL = time.Minute
+
+// NewJoinTokens creates the tokens of the keys with the TTL,
+// no keys disable the tokens.
+func NewJoinTokens(keys []string, ttl time.Duration) *JoinTokens {
+	if ttl <= 0 {
+		ttl = defaultJoinTTL
+	}
+	j := JoinTokens{ttl: ttl, now: time.Now}
+	for _, k := range keys {
+		if k != "" {
+			j.keys = append(j.keys, []byte(k))
+		}
+	}
+	return &j
+}
+
+// Enabled tells if the sessions need the tokens.
+func (j *JoinTokens) Enabled() bool { return j != nil && len(j.keys) > 0 }
+
+// Mint returns a new token of the scope (payload.signature, base64url).
+func (j *JoinTokens) Mint(scope JoinScope) (string, error) {
+	if !j.Enabled() {
+		return "", nil
+	}
+	return j.seal(joinClaims{JoinScope: scope, Expires: j.now().Add(j.ttl).Unix()})
+}
+
+// Verify checks the signature, expiry and scope of the token.
+func (j *JoinTokens) Verify(token string, scope JoinScope) error {
+	if !j.Enabled() {
+		return nil
+	}
+	var claims joinClaims
+	if err := j.open(token, &claims); err != nil {
+		return err
+	}
+	if j.now().Unix() >= claims.Expires {
+		return ErrJoinExpired
+	}
+	if claims.JoinScope != scope {
+		return ErrJoinForbidden
+	}
+	return nil
+}
+
+// seal signs the claims with the first key.
+func (j *JoinTokens) seal(claims interface{}) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(sign(j.keys[0], payload)), nil
+}
+
+// open checks the signature of the token with any of the keys
+// and decodes its claims.
+func (j *JoinTokens) open(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return ErrJoinInvalid
+	}
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return ErrJoinInvalid
+	}
+	signature, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return ErrJoinInvalid
+	}
+	valid := false
+	for _, key := range j.keys {
+		if hmac.Equal(signature, sign(key, payload)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrJoinInvalid
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrJoinInvalid
+	}
+	return nil
+}
+
+func sign(key []byte, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,89 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJoinTokens(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	joins := NewJoinTokens([]string{"secret"}, time.Minute)
+	joins.now = func() time.Time { return now }
+	scope := JoinScope{WorkerID: "w1", RoomID: "room1", SessionID: "s1", Role: Player}
+
+	token, err := joins.Mint(scope)
+	if err != nil {
+		t.Fatalf("couldn't mint the token, %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		scope JoinScope
+		after time.Duration
+		err   error
+	}{
+		{name: "the happy path", scope: scope, after: 59 * time.Second},
+		{name: "expired", scope: scope, after: time.Minute, err: ErrJoinExpired},
+		{name: "wrong room", scope: JoinScope{WorkerID: "w1", RoomID: "room2", SessionID: "s1", Role: Player},
+			err: ErrJoinForbidden},
+		{name: "new room", scope: JoinScope{WorkerID: "w1", SessionID: "s1", Role: Player}, err: ErrJoinForbidden},
+		{name: "wrong role", scope: JoinScope{WorkerID: "w1", RoomID: "room1", SessionID: "s1", Role: Spectator},
+			err: ErrJoinForbidden},
+		{name: "wrong worker", scope: JoinScope{WorkerID: "w2", RoomID: "room1", SessionID: "s1", Role: Player},
+			err: ErrJoinForbidden},
+		{name: "wrong session", scope: JoinScope{WorkerID: "w1", RoomID: "room1", SessionID: "s2", Role: Player},
+			err: ErrJoinForbidden},
+	}
+	for _, test := range tests {
+		joins.now = func() time.Time { return now.Add(test.after) }
+		if err := joins.Verify(token, test.scope); err != test.err {
+			t.Errorf("%v: got %v, expected %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestJoinTokensInvalid(t *testing.T) {
+	joins := NewJoinTokens([]string{"secret"}, time.Minute)
+	scope := JoinScope{WorkerID: "w1", RoomID: "room1", SessionID: "s1", Role: Spectator}
+	token, _ := joins.Mint(scope)
+	other, _ := NewJoinTokens([]string{"another"}, time.Minute).Mint(scope)
+	// the payload of another scope with the signature of the token
+	forged, _ := joins.Mint(JoinScope{WorkerID: "w1", RoomID: "room1", SessionID: "s1", Role: Player})
+	forged = forged[:strings.Index(forged, ".")] + token[strings.Index(token, "."):]
+
+	for _, bad := range []string{"", "token", "a.b.c", token + "x", other, forged} {
+		if err := joins.Verify(bad, scope); err != ErrJoinInvalid {
+			t.Errorf("the token %q is %v, expected %v", bad, err, ErrJoinInvalid)
+		}
+	}
+}
+
+func TestJoinTokensRotation(t *testing.T) {
+	scope := JoinScope{WorkerID: "w1", RoomID: "room1", SessionID: "s1", Role: Player}
+	old, _ := NewJoinTokens([]string{"old"}, time.Minute).Mint(scope)
+	rotated := NewJoinTokens([]string{"new", "old"}, time.Minute)
+	if err := rotated.Verify(old, scope); err != nil {
+		t.Errorf("the token of the old key is %v", err)
+	}
+	token, _ := rotated.Mint(scope)
+	if err := NewJoinTokens([]string{"new"}, time.Minute).Verify(token, scope); err != nil {
+		t.Errorf("the token isn't signed with the first key, %v", err)
+	}
+	if err := NewJoinTokens([]string{"new"}, time.Minute).Verify(old, scope); err != ErrJoinInvalid {
+		t.Errorf("the token of the dropped key is %v", err)
+	}
+}
+
+func TestJoinTokensDisabled(t *testing.T) {
+	joins := NewJoinTokens(nil, 0)
+	if joins.Enabled() {
+		t.Errorf("the tokens without keys are enabled")
+	}
+	if token, err := joins.Mint(JoinScope{}); token != "" || err != nil {
+		t.Errorf("got the token %q (%v) without keys", token, err)
+	}
+	if err := joins.Verify("", JoinScope{RoomID: "room1"}); err != nil {
+		t.Errorf("the empty token is %v without keys", err)
+	}
+}
@@ -0,0 +1,119 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Seat is the place of the session in a room
+// the reconnect token gives back to the returning user (i.e. after a page reload).
+type Seat struct {
+	// the session that has left the room
+	SessionID string
+	RoomID    string
+	WorkerID  string
+}
+
+// Reconnects keeps the reconnect tokens of the sessions in the rooms.
+// The tokens of the sessions that have gone expire after the TTL
+// and are single-use.
+type Reconnects struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	tokens map[string]*reconnect
+}
+
+type reconnect struct {
+	seat   Seat
+	expiry *time.Timer
+}
+
+// NewReconnects creates the reconnect tokens with the TTL,
+// 0 disables the reconnects.
+func NewReconnects(ttl time.Duration) *Reconnects {
+	return &Reconnects{ttl: ttl, tokens: map[string]*reconnect{}}
+}
+
+// Enabled tells if the sessions can reconnect.
+func (r *Reconnects) Enabled() bool { return r != nil && r.ttl > 0 }
+
+// Mint returns a new reconnect token of the seat,
+// the token is valid until the session leaves and the TTL passes.
+func (r *Reconnects) Mint(seat Seat) string {
+	if !r.Enabled() {
+		return ""
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	token := hex.EncodeToString(b)
+	r.mu.Lock()
+	r.tokens[token] = &reconnect{seat: seat}
+	r.mu.Unlock()
+	return token
+}
+
+// Leave starts the TTL of the token of the gone session and
+// calls the function with the seat if the session doesn't come back in time.
+// It returns false if there is no such token.
+func (r *Reconnects) Leave(token string, expired func(Seat)) bool {
+	if !r.Enabled() {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rc, ok := r.tokens[token]
+	if !ok {
+		return false
+	}
+	if rc.expiry != nil {
+		rc.expiry.Stop()
+	}
+	rc.expiry = time.AfterFunc(r.ttl, func() {
+		r.mu.Lock()
+		current, ok := r.tokens[token]
+		if ok && current == rc {
+			delete(r.tokens, token)
+		}
+		r.mu.Unlock()
+		if ok && current == rc && expired != nil {
+			expired(rc.seat)
+		}
+	})
+	return true
+}
+
+// Take returns the seat of the token and revokes the token.
+func (r *Reconnects) Take(token string) (Seat, bool) {
+	if !r.Enabled() {
+		return Seat{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rc, ok := r.tokens[token]
+	if !ok {
+		return Seat{}, false
+	}
+	delete(r.tokens, token)
+	if rc.expiry != nil {
+		rc.expiry.Stop()
+	}
+	return rc.seat, true
+}
+
+// Seat returns the seat of the token without revoking the token.
+func (r *Reconnects) Seat(token string) (Seat, bool) {
+	if !r.Enabled() {
+		return Seat{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rc, ok := r.tokens[token]
+	if !ok {
+		return Seat{}, false
+	}
+	return rc.seat, true
+}
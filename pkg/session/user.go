@@ -0,0 +1,46 @@
+package session
+
+// userClaims is the user ID (profile) of the session
+// signed by the coordinator for the workers.
+type userClaims struct {
+	User      string `json:"u"`
+	SessionID string `json:"s"`
+	Expires   int64  `json:"exp"`
+}
+
+// MintUser returns a new token of the user ID of the session,
+// it's signed with the keys of the join tokens and lives as long.
+// The anonymous sessions and the coordinators without the keys get no tokens.
+func (j *JoinTokens) MintUser(user string, sessionID string) (string, error) {
+	if !j.Enabled() || user == "" {
+		return "", nil
+	}
+	return j.seal(userClaims{User: user, SessionID: sessionID, Expires: j.now().Add(j.ttl).Unix()})
+}
+
+// VerifyUser returns the user ID of the token of the session,
+// no token -- the anonymous session.
+// The workers without the keys can't check the tokens, so they don't trust them.
+func (j *JoinTokens) VerifyUser(token string, sessionID string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	if !j.Enabled() {
+		return "", ErrJoinInvalid
+	}
+	var claims userClaims
+	if err := j.open(token, &claims); err != nil {
+		return "", err
+	}
+	// i.e. the join tokens
+	if claims.User == "" {
+		return "", ErrJoinInvalid
+	}
+	if j.now().Unix() >= claims.Expires {
+		return "", ErrJoinExpired
+	}
+	if claims.SessionID != sessionID {
+		return "", ErrJoinForbidden
+	}
+	return claims.User, nil
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserTokens(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	users := NewJoinTokens([]string{"secret"}, time.Minute)
+	users.now = func() time.Time { return now }
+	token, err := users.MintUser("user1", "s1")
+	if err != nil {
+		t.Fatalf("couldn't mint the token, %v", err)
+	}
+	join, _ := users.Mint(JoinScope{WorkerID: "w1", SessionID: "s1", Role: Player})
+	other, _ := NewJoinTokens([]string{"another"}, time.Minute).MintUser("user1", "s1")
+
+	tests := []struct {
+		name    string
+		token   string
+		session string
+		after   time.Duration
+		user    string
+		err     error
+	}{
+		{name: "the happy path", token: token, session: "s1", after: 59 * time.Second, user: "user1"},
+		{name: "anonymous", session: "s1"},
+		{name: "expired", token: token, session: "s1", after: time.Minute, err: ErrJoinExpired},
+		{name: "another session", token: token, session: "s2", err: ErrJoinForbidden},
+		{name: "another key", token: other, session: "s1", err: ErrJoinInvalid},
+		{name: "the join token", token: join, session: "s1", err: ErrJoinInvalid},
+		{name: "forged", token: `{"u":"user1","s":"s1"}`, session: "s1", err: ErrJoinInvalid},
+	}
+	for _, test := range tests {
+		users.now = func() time.Time { return now.Add(test.after) }
+		user, err := users.VerifyUser(test.token, test.session)
+		if user != test.user || err != test.err {
+			t.Errorf("%v: got the user %q (%v), expected %q (%v)", test.name, user, err, test.user, test.err)
+		}
+	}
+}
+
+func TestUserTokensDisabled(t *testing.T) {
+	if token, err := NewJoinTokens(nil, 0).MintUser("user1", "s1"); token != "" || err != nil {
+		t.Errorf("got the token %q (%v) without keys", token, err)
+	}
+	if token, _ := NewJoinTokens([]string{"secret"}, 0).MintUser("", "s1"); token != "" {
+		t.Errorf("got the token %q of the anonymous session", token)
+	}
+	// the workers without the keys don't trust the users
+	token, _ := NewJoinTokens([]string{"secret"}, 0).MintUser("user1", "s1")
+	if user, err := NewJoinTokens(nil, 0).VerifyUser(token, "s1"); user != "" || err != ErrJoinInvalid {
+		t.Errorf("got the user %q (%v) without keys", user, err)
+	}
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The encrypted save states (AES-256-GCM) start with the header:
+// magic (4 bytes), version (1), the key ID (8), the random nonce prefix (7).
+// The content is sealed in the chunks with the nonces of
+// the prefix, the chunk counter (uint32 BE) and the last chunk flag,
+// so the reordered and truncated chunks are rejected too.
+const (
+	cryptMagic      = "CGSE"
+	cryptVersion    = 1
+	cryptIDSize     = 8
+	cryptPrefixSize = 7
+	cryptHeaderSize = len(cryptMagic) + 1 + cryptIDSize + cryptPrefixSize
+	cryptChunkSize  = 64 << 10
+)
+
+var ErrStateKey = errors.New("no key of the encrypted save state")
+
+// Key is the AES-256 key of the save states.
+type Key struct {
+	id   [cryptIDSize]byte
+	aead cipher.AEAD
+}
+
+// NewKey returns the key of 32 bytes.
+func NewKey(secret []byte) (Key, error) {
+	if len(secret) != 32 {
+		return Key{}, fmt.Errorf("the key should be 32 bytes, not %v", len(secret))
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return Key{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return Key{}, err
+	}
+	key := Key{aead: aead}
+	// the ID doesn't expose the key
+	hash := sha256.Sum256(secret)
+	copy(key.id[:], hash[:])
+	return key, nil
+}
+
+// LoadKeys reads the hex keys of the sources: file:<path> or env:<name>.
+// The errors don't contain the keys.
+func LoadKeys(sources []string) ([]Key, error) {
+	keys := make([]Key, 0, len(sources))
+	for i, source := range sources {
+		var secret string
+		switch {
+		case strings.HasPrefix(source, "file:"):
+			data, err := ioutil.ReadFile(strings.TrimPrefix(source, "file:"))
+			if err != nil {
+				return nil, fmt.Errorf("key %v, %v", i, err)
+			}
+			secret = string(data)
+		case strings.HasPrefix(source, "env:"):
+			name := strings.TrimPrefix(source, "env:")
+			if secret = os.Getenv(name); secret == "" {
+				return nil, fmt.Errorf("key %v, no env var %v", i, name)
+			}
+		default:
+			return nil, fmt.Errorf("key %v should be file:<path> or env:<name>", i)
+		}
+		raw, err := hex.DecodeString(strings.TrimSpace(secret))
+		if err != nil {
+			return nil, fmt.Errorf("key %v is not hex", i)
+		}
+		key, err := NewKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %v, %v", i, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// seal returns the writer encrypting into w, it should be closed
+// to write the last chunk.
+func (k Key) seal(w io.Writer) (io.WriteCloser, error) {
+	header := make([]byte, cryptHeaderSize)
+	copy(header, cryptMagic)
+	header[len(cryptMagic)] = cryptVersion
+	copy(header[len(cryptMagic)+1:], k.id[:])
+	if _, err := io.ReadFull(rand.Reader, header[len(cryptMagic)+1+cryptIDSize:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &sealWriter{
+		w:      w,
+		aead:   k.aead,
+		header: header,
+		buf:    make([]byte, 0, cryptChunkSize),
+		out:    make([]byte, 0, cryptChunkSize+k.aead.Overhead()),
+	}, nil
+}
+
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	out     []byte
+	counter uint32
+}
+
+func (s *sealWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// the full chunk isn't the last one
+		if len(s.buf) == cryptChunkSize {
+			if err := s.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(s.buf[len(s.buf):cryptChunkSize], p)
+		s.buf, p, n = s.buf[:len(s.buf)+c], p[c:], n+c
+	}
+	return n, nil
+}
+
+func (s *sealWriter) Close() error { return s.seal(true) }
+
+func (s *sealWriter) seal(last bool) error {
+	s.out = s.aead.Seal(s.out[:0], chunkNonce(s.header, s.counter, last), s.buf, s.header)
+	s.buf = s.buf[:0]
+	s.counter++
+	_, err := s.w.Write(s.out)
+	return err
+}
+
+// open returns the reader decrypting the content of r with the header
+// by the key of its ID.
+func open(r *bufio.Reader, keys []Key) (io.Reader, error) {
+	header := make([]byte, cryptHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrCorruptedState
+	}
+	if v := header[len(cryptMagic)]; v != cryptVersion {
+		return nil, fmt.Errorf("unsupported encrypted save state version %v", v)
+	}
+	id := header[len(cryptMagic)+1 : len(cryptMagic)+1+cryptIDSize]
+	for _, k := range keys {
+		if string(k.id[:]) == string(id) {
+			return &openReader{
+				r:      r,
+				aead:   k.aead,
+				header: header,
+				chunk:  make([]byte, cryptChunkSize+k.aead.Overhead()),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %x, check the encryption keys of the storage", ErrStateKey, id)
+}
+
+type openReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	chunk   []byte
+	plain   []byte
+	counter uint32
+	done    bool
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		if err := o.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
+
+func (o *openReader) next() error {
+	n, err := io.ReadFull(o.r, o.chunk)
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		return err
+	}
+	if !last {
+		if _, err := o.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := o.aead.Open(o.chunk[:0], chunkNonce(o.header, o.counter, last), o.chunk[:n], o.header)
+	if err != nil {
+		return ErrCorruptedState
+	}
+	o.plain, o.done = plain, last
+	o.counter++
+	return nil
+}
+
+// chunkNonce returns the nonce of the chunk:
+// the prefix of the header, the counter and the last chunk flag.
+func chunkNonce(header []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[cryptHeaderSize-cryptPrefixSize:])
+	binary.BigEndian.PutUint32(nonce[cryptPrefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	storageConfig "github.com/giongto35/cloud-game/v2/pkg/config/storage"
+)
+
+const (
+	testKeyOld = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testKeyNew = "f0e0d0c0b0a090807060504030201000f0e0d0c0b0a090807060504030201000"
+)
+
+func newTestCodec(t *testing.T, level int, keys ...string) StateCodec {
+	sources := make([]string, len(keys))
+	for i, key := range keys {
+		name := "CLOUD_GAME_TEST_KEY_" + string(rune('A'+i))
+		_ = os.Setenv(name, key)
+		sources[i] = "env:" + name
+	}
+	defer func() {
+		for _, source := range sources {
+			_ = os.Unsetenv(strings.TrimPrefix(source, "env:"))
+		}
+	}()
+	codec, err := NewStateCodec(storageConfig.Storage{Compression: level, Encryption: storageConfig.Encryption{Keys: sources}})
+	if err != nil {
+		t.Fatalf("couldn't make the codec, %v", err)
+	}
+	return codec
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage_keys_test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(file, []byte(testKeyOld+"\n"), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+	_ = os.Setenv("CLOUD_GAME_TEST_KEY", testKeyNew)
+	defer func() { _ = os.Unsetenv("CLOUD_GAME_TEST_KEY") }()
+
+	keys, err := LoadKeys([]string{"env:CLOUD_GAME_TEST_KEY", "file:" + file})
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("couldn't load the keys, %v", err)
+	}
+	if keys[0].id == keys[1].id {
+		t.Errorf("the keys have the same ID %x", keys[0].id)
+	}
+
+	for _, source := range []string{
+		testKeyNew,
+		"env:CLOUD_GAME_NO_KEY",
+		"file:" + filepath.Join(dir, "none"),
+		"file:" + file + "x",
+	} {
+		if _, err := LoadKeys([]string{source}); err == nil {
+			t.Errorf("loaded the wrong key %v", source)
+		} else if strings.Contains(err.Error(), testKeyNew) {
+			t.Errorf("the error has the key, %v", err)
+		}
+	}
+	_ = os.Setenv("CLOUD_GAME_TEST_KEY", testKeyNew[:32])
+	if _, err := LoadKeys([]string{"env:CLOUD_GAME_TEST_KEY"}); err == nil {
+		t.Errorf("loaded the short key")
+	}
+	_ = os.Setenv("CLOUD_GAME_TEST_KEY", "zz"+testKeyNew[2:])
+	if _, err := LoadKeys([]string{"env:CLOUD_GAME_TEST_KEY"}); err == nil {
+		t.Errorf("loaded the non-hex key")
+	}
+
+	codec, err := NewStateCodec(storageConfig.Storage{Encryption: storageConfig.Encryption{Keys: []string{"x"}}})
+	if err == nil {
+		t.Fatalf("made the codec with the wrong keys")
+	}
+	if err := codec.Save(context.Background(), newFlakyStorage(0, nil), "room", file); err == nil {
+		t.Errorf("saved the state without the keys")
+	}
+}
+
+func TestStateEncryption(t *testing.T) {
+	// the multiple chunks of the uncompressed states
+	for _, level := range []int{0, 3} {
+		state := stateFixture(3*cryptChunkSize + 100)
+		dir, path := newStateFile(t, state)
+		store := newFlakyStorage(0, nil)
+		codec := newTestCodec(t, level, testKeyNew)
+
+		if err := codec.Save(context.Background(), store, "room", path); err != nil {
+			t.Fatalf("couldn't save the state, %v", err)
+		}
+		encrypted := store.objects["room"]
+		if !bytes.HasPrefix(encrypted, []byte(cryptMagic)) || bytes.Contains(encrypted, []byte(stateMagic)) || bytes.Contains(encrypted, state[:1024]) {
+			t.Errorf("the state of the level %v is not encrypted", level)
+		}
+		loaded := filepath.Join(dir, "loaded.dat")
+		if err := codec.Load(context.Background(), store, "room", loaded); err != nil {
+			t.Fatalf("couldn't load the state of the level %v, %v", level, err)
+		}
+		if data, _ := ioutil.ReadFile(loaded); !bytes.Equal(data, state) {
+			t.Errorf("wrong decrypted state of %v bytes of the level %v", len(data), level)
+		}
+		// the same state is encrypted differently
+		_ = codec.Save(context.Background(), store, "room", path)
+		if bytes.Equal(encrypted, store.objects["room"]) {
+			t.Errorf("the states have the same nonces")
+		}
+		// the empty states
+		_ = ioutil.WriteFile(path, nil, 0644)
+		if err := codec.Save(context.Background(), store, "empty", path); err != nil {
+			t.Errorf("couldn't save the empty state, %v", err)
+		}
+		if err := codec.Load(context.Background(), store, "empty", loaded); err != nil {
+			t.Errorf("couldn't load the empty state, %v", err)
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Tests that the data made in memory (i.e. the profiles) go as the states.
+func TestStateData(t *testing.T) {
+	data := []byte(`{"keyMapping":{"a":"b"},"volume":50}`)
+	for _, codec := range []StateCodec{{}, newTestCodec(t, 3, testKeyNew)} {
+		store := newFlakyStorage(0, nil)
+		if err := codec.SaveData(context.Background(), store, "profile", data); err != nil {
+			t.Fatalf("couldn't save the data, %v", err)
+		}
+		if encrypted := len(codec.Keys) > 0; encrypted == bytes.Equal(store.objects["profile"], data) {
+			t.Errorf("wrong encryption %v of the data", encrypted)
+		}
+		loaded, err := codec.LoadData(context.Background(), store, "profile")
+		if err != nil || !bytes.Equal(loaded, data) {
+			t.Errorf("wrong loaded data %q, %v", loaded, err)
+		}
+	}
+}
+
+func TestStateKeyRotation(t *testing.T) {
+	state := stateFixture(64 << 10)
+	dir, path := newStateFile(t, state)
+	defer func() { _ = os.RemoveAll(dir) }()
+	store := newFlakyStorage(0, nil)
+	loaded := filepath.Join(dir, "loaded.dat")
+
+	old := newTestCodec(t, 1, testKeyOld)
+	if err := old.Save(context.Background(), store, "old", path); err != nil {
+		t.Fatalf("couldn't save the state, %v", err)
+	}
+	// the plaintext states before the encryption
+	store.objects["plain"] = state
+
+	rotated := newTestCodec(t, 1, testKeyNew, testKeyOld)
+	for _, name := range []string{"old", "plain"} {
+		if err := rotated.Load(context.Background(), store, name, loaded); err != nil {
+			t.Fatalf("couldn't load the %v state with the rotated keys, %v", name, err)
+		}
+		if data, _ := ioutil.ReadFile(loaded); !bytes.Equal(data, state) {
+			t.Errorf("wrong %v state with the rotated keys", name)
+		}
+	}
+	if err := rotated.Save(context.Background(), store, "new", path); err != nil {
+		t.Fatalf("couldn't save the state, %v", err)
+	}
+	id := store.objects["new"][len(cryptMagic)+1 : len(cryptMagic)+1+cryptIDSize]
+	if !bytes.Equal(id, rotated.Keys[0].id[:]) {
+		t.Errorf("the state is not encrypted with the newest key, %x", id)
+	}
+
+	// the removed keys and no keys at all
+	_ = ioutil.WriteFile(loaded, []byte("local"), 0644)
+	for _, codec := range []StateCodec{newTestCodec(t, 1, testKeyNew), {}} {
+		err := codec.Load(context.Background(), store, "old", loaded)
+		if !errors.Is(err, ErrStateKey) {
+			t.Errorf("wrong error of the unknown key, %v", err)
+		}
+		if data, _ := ioutil.ReadFile(loaded); string(data) != "local" {
+			t.Errorf("the state was replaced without the key")
+		}
+	}
+}
+
+func TestStateTamper(t *testing.T) {
+	state := stateFixture(3 * cryptChunkSize)
+	dir, path := newStateFile(t, state)
+	defer func() { _ = os.RemoveAll(dir) }()
+	store := newFlakyStorage(0, nil)
+	codec := newTestCodec(t, 0, testKeyNew)
+	if err := codec.Save(context.Background(), store, "room", path); err != nil {
+		t.Fatalf("couldn't save the state, %v", err)
+	}
+	good := store.objects["room"]
+	chunk := cryptChunkSize + 16
+
+	tamper := func(fn func(b []byte) []byte) []byte {
+		return fn(append([]byte{}, good...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "content", data: tamper(func(b []byte) []byte { b[cryptHeaderSize+chunk+10] ^= 1; return b })},
+		{name: "tag", data: tamper(func(b []byte) []byte { b[len(b)-1] ^= 1; return b })},
+		{name: "nonce", data: tamper(func(b []byte) []byte { b[cryptHeaderSize-1] ^= 1; return b })},
+		{name: "chunk order", data: tamper(func(b []byte) []byte {
+			c := b[cryptHeaderSize:]
+			first := append([]byte{}, c[:chunk]...)
+			copy(c, c[chunk:2*chunk])
+			copy(c[chunk:], first)
+			return b
+		})},
+		{name: "last chunk", data: tamper(func(b []byte) []byte { return b[:cryptHeaderSize+2*chunk] })},
+		{name: "truncated chunk", data: tamper(func(b []byte) []byte { return b[:len(b)-100] })},
+		{name: "header", data: good[:cryptHeaderSize-2]},
+		{name: "content", data: good[:cryptHeaderSize]},
+	}
+	for _, test := range tests {
+		store.objects["room"] = test.data
+		if err := codec.Load(context.Background(), store, "room", path); !errors.Is(err, ErrCorruptedState) {
+			t.Errorf("wrong error of the tampered %v, %v", test.name, err)
+		}
+		if data, _ := ioutil.ReadFile(path); !bytes.Equal(data, state) {
+			t.Errorf("the state was replaced with the tampered %v", test.name)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("the tampered states have left the files %v", len(files))
+	}
+}
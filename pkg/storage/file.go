@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// SaveFile uploads the file with the name streaming it from the disk.
+func SaveFile(ctx context.Context, s CloudStorage, name string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return s.Save(ctx, name, f, info.Size())
+}
+
+// LoadFile downloads the content with the name into the file streaming it to the disk.
+// The file is replaced only with the complete content.
+func LoadFile(ctx context.Context, s CloudStorage, name string, path string) error {
+	r, err := s.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+	return writeFile(path, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// writeFile replaces the file with the content written by the function
+// through a temp file next to it, the file is kept on errors.
+func writeFile(path string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.part")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// LoadData returns the whole content with the name,
+// use it only for the small files.
+func LoadData(ctx context.Context, s CloudStorage, name string) ([]byte, error) {
+	r, err := s.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	return ioutil.ReadAll(r)
+}
+
+// FileStorage adapts the storage to the old file and buffer API
+// for the transition to the streams.
+//
+// Deprecated: use SaveFile and LoadFile with the context.
+type FileStorage struct{ CloudStorage }
+
+func (s FileStorage) Save(name string, localPath string) error {
+	return SaveFile(context.Background(), s.CloudStorage, name, localPath)
+}
+
+func (s FileStorage) Load(name string) ([]byte, error) {
+	return LoadData(context.Background(), s.CloudStorage, name)
+}
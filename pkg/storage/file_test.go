@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// patternReader produces size bytes of the counter values,
+// it remembers the largest read.
+type patternReader struct {
+	size, pos int
+	maxRead   int
+	// blocks the reads after the position until the context is done
+	blockAt int
+	ctx     context.Context
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if r.ctx != nil && r.pos >= r.blockAt {
+		<-r.ctx.Done()
+		return 0, r.ctx.Err()
+	}
+	if len(p) > r.maxRead {
+		r.maxRead = len(p)
+	}
+	n := 0
+	for ; n < len(p) && r.pos < r.size; n, r.pos = n+1, r.pos+1 {
+		p[n] = byte(r.pos)
+	}
+	return n, nil
+}
+
+func (r *patternReader) Close() error { return nil }
+
+// streamStorage returns the content of the reader.
+type streamStorage struct {
+	r *patternReader
+	// the reader of the saves
+	saved io.Reader
+	size  int64
+}
+
+func (s *streamStorage) Save(_ context.Context, _ string, r io.Reader, size int64) error {
+	s.saved, s.size = r, size
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
+
+func (s *streamStorage) Load(context.Context, string) (io.ReadCloser, error) { return s.r, nil }
+
+func TestLoadFileStreaming(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage_test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// 50 MB states of PS1
+	const size = 50 << 20
+	st := &streamStorage{r: &patternReader{size: size}}
+	path := filepath.Join(dir, "room.dat")
+	if err := LoadFile(context.Background(), st, "room", path); err != nil {
+		t.Fatalf("couldn't load the file, %v", err)
+	}
+	if st.r.maxRead > 1<<20 {
+		t.Errorf("the content was buffered with the read of %v bytes", st.r.maxRead)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || len(data) != size || data[size-1] != byte((size-1)%256) {
+		t.Errorf("wrong file of %v bytes, %v", len(data), err)
+	}
+
+	if err := SaveFile(context.Background(), st, "room", path); err != nil {
+		t.Fatalf("couldn't save the file, %v", err)
+	}
+	if _, ok := st.saved.(*os.File); !ok || st.size != size {
+		t.Errorf("the file is not streamed, %T of %v bytes", st.saved, st.size)
+	}
+	if err := SaveFile(context.Background(), st, "room", filepath.Join(dir, "none")); err == nil {
+		t.Errorf("saved the missing file")
+	}
+}
+
+func TestLoadFileCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage_test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "room.dat")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st := &streamStorage{r: &patternReader{size: 1 << 20, blockAt: 1 << 10, ctx: ctx}}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := LoadFile(ctx, st, "room", path); err != context.Canceled {
+		t.Errorf("wrong error of the cancelled download, %v", err)
+	}
+	// the old file is kept without the parts
+	if data, _ := ioutil.ReadFile(path); !bytes.Equal(data, []byte("old")) {
+		t.Errorf("the file was replaced with the part %v", len(data))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("the download has left the files %v", len(files))
+	}
+}
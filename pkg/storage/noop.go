@@ -1,6 +1,10 @@
 package storage
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"io"
+)
 
 type NoopCloudStorage struct{}
 
@@ -10,10 +14,19 @@ func NewNoopCloudStorage() (*NoopCloudStorage, error) {
 	return nil, noopErr
 }
 
-func (n *NoopCloudStorage) Save(_ string, _ string) (err error) {
+func (n *NoopCloudStorage) Save(_ context.Context, _ string, _ io.Reader, _ int64) (err error) {
 	return nil
 }
 
-func (n *NoopCloudStorage) Load(_ string) (data []byte, err error) {
+func (n *NoopCloudStorage) Load(_ context.Context, _ string) (r io.ReadCloser, err error) {
 	return nil, noopErr
 }
+
+// IsNoop tells if the storage (with the retries) doesn't keep the files.
+func IsNoop(s CloudStorage) bool {
+	if r, ok := s.(*retryStorage); ok {
+		s = r.CloudStorage
+	}
+	_, ok := s.(*NoopCloudStorage)
+	return s == nil || ok
+}
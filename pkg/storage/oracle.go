@@ -1,12 +1,13 @@
 package storage
 
 import (
-	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"hash"
+	"io"
 	"net/http"
 	"time"
 )
@@ -34,20 +35,17 @@ func NewOracleDataStorageClient(accessURL string) (*OracleDataStorageClient, err
 	}, nil
 }
 
-func (s *OracleDataStorageClient) Save(name string, localPath string) (err error) {
+func (s *OracleDataStorageClient) Save(ctx context.Context, name string, r io.Reader, size int64) (err error) {
 	if s == nil {
 		return nil
 	}
 
-	dat, err := ioutil.ReadFile(localPath)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("PUT", s.accessURL+name, bytes.NewBuffer(dat))
+	hash := md5.New()
+	req, err := http.NewRequestWithContext(ctx, "PUT", s.accessURL+name, io.TeeReader(r, hash))
 	if err != nil {
 		return err
 	}
+	req.ContentLength = size
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -57,11 +55,11 @@ func (s *OracleDataStorageClient) Save(name string, localPath string) (err error
 		_ = resp.Body.Close()
 	}()
 	if resp.StatusCode != 200 {
-		return errors.New(resp.Status)
+		return &StatusError{Code: resp.StatusCode, Status: resp.Status}
 	}
 
 	dstMD5 := resp.Header.Get("Opc-Content-Md5")
-	srcMD5 := base64.StdEncoding.EncodeToString(md5Hash(dat))
+	srcMD5 := base64.StdEncoding.EncodeToString(hash.Sum(nil))
 	if dstMD5 != srcMD5 {
 		return fmt.Errorf("MD5 mismatch %v != %v", srcMD5, dstMD5)
 	}
@@ -69,39 +67,41 @@ func (s *OracleDataStorageClient) Save(name string, localPath string) (err error
 	return nil
 }
 
-func (s *OracleDataStorageClient) Load(name string) (data []byte, err error) {
+func (s *OracleDataStorageClient) Load(ctx context.Context, name string) (r io.ReadCloser, err error) {
 	if s == nil {
 		return nil, errors.New("cloud storage was not initialized")
 	}
 
-	res, err := s.client.Get(s.accessURL + name)
+	req, err := http.NewRequestWithContext(ctx, "GET", s.accessURL+name, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = res.Body.Close()
-	}()
-
-	if res.StatusCode != 200 {
-		return nil, errors.New(res.Status)
-	}
-
-	dat, err := ioutil.ReadAll(res.Body)
+	res, err := s.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-
-	dstMD5 := res.Header.Get("Content-Md5")
-	srcMD5 := base64.StdEncoding.EncodeToString(md5Hash(dat))
-	if dstMD5 != srcMD5 {
-		return nil, fmt.Errorf("MD5 mismatch %v != %v", srcMD5, dstMD5)
+	if res.StatusCode != 200 {
+		_ = res.Body.Close()
+		return nil, &StatusError{Code: res.StatusCode, Status: res.Status}
 	}
 
-	return dat, nil
+	return &md5Reader{ReadCloser: res.Body, hash: md5.New(), md5: res.Header.Get("Content-Md5")}, nil
 }
 
-func md5Hash(data []byte) []byte {
-	hash := md5.New()
-	hash.Write(data)
-	return hash.Sum(nil)
+// md5Reader checks the MD5 hash of the content at the end of it.
+type md5Reader struct {
+	io.ReadCloser
+	hash hash.Hash
+	md5  string
+}
+
+func (r *md5Reader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if srcMD5 := base64.StdEncoding.EncodeToString(r.hash.Sum(nil)); srcMD5 != r.md5 {
+			return n, fmt.Errorf("MD5 mismatch %v != %v", srcMD5, r.md5)
+		}
+	}
+	return n, err
 }
@@ -21,6 +21,7 @@ func newTestClient(fn rtFunc) *http.Client {
 func TestOracleSave(t *testing.T) {
 	client, err := NewOracleDataStorageClient("test-url/")
 	client.client = newTestClient(func(req *http.Request) *http.Response {
+		_, _ = ioutil.ReadAll(req.Body)
 		return &http.Response{
 			StatusCode: 200,
 			Body:       ioutil.NopCloser(strings.NewReader("")),
@@ -47,7 +48,7 @@ func TestOracleSave(t *testing.T) {
 		return
 	}
 
-	err = client.Save("oracle_test.file", tempFile.Name())
+	err = FileStorage{client}.Save("oracle_test.file", tempFile.Name())
 	if err != nil {
 		t.Errorf("can't save, err: %v", err)
 	}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	storageConfig "github.com/giongto35/cloud-game/v2/pkg/config/storage"
+)
+
+// StatusError is the HTTP status of the failed storage request.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string       { return e.Status }
+func (e *StatusError) HTTPStatusCode() int { return e.Code }
+
+// IsRetryable tells if the failed request may succeed later:
+// the timeouts and HTTP 408, 429, 5xx (the S3 SDK errors too).
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) {
+		code := status.HTTPStatusCode()
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryStorage retries the temporary failures of the storage
+// with the exponential backoff.
+type retryStorage struct {
+	CloudStorage
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// WithRetry wraps the storage with the retries of the config,
+// the storage is returned as is without them.
+func WithRetry(s CloudStorage, conf storageConfig.Retry) CloudStorage {
+	if conf.Attempts <= 1 {
+		return s
+	}
+	return &retryStorage{
+		CloudStorage: s,
+		attempts:     conf.Attempts,
+		backoff:      time.Duration(conf.Backoff) * time.Millisecond,
+		maxBackoff:   time.Duration(conf.MaxBackoff) * time.Millisecond,
+	}
+}
+
+// Save uploads the content with the retries,
+// only the seekable content (files) can be sent again.
+func (s *retryStorage) Save(ctx context.Context, name string, r io.Reader, size int64) error {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return s.CloudStorage.Save(ctx, name, r, size)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return s.CloudStorage.Save(ctx, name, r, size)
+	}
+	return s.retry(ctx, "save", name, func() error {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		return s.CloudStorage.Save(ctx, name, r, size)
+	})
+}
+
+// Load retries the requests of the content,
+// the failures in the middle of it are not retried.
+func (s *retryStorage) Load(ctx context.Context, name string) (r io.ReadCloser, err error) {
+	err = s.retry(ctx, "load", name, func() (err error) {
+		r, err = s.CloudStorage.Load(ctx, name)
+		return
+	})
+	return
+}
+
+func (s *retryStorage) retry(ctx context.Context, op string, name string, fn func() error) error {
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= s.attempts || ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+		log.Printf("warn: storage %v of %v has failed (%v/%v), retry in %v, %v", op, name, attempt, s.attempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; s.maxBackoff > 0 && backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	storageConfig "github.com/giongto35/cloud-game/v2/pkg/config/storage"
+)
+
+// flakyStorage is an in-memory storage which fails
+// the first requests with the error.
+type flakyStorage struct {
+	mu      sync.Mutex
+	fails   int
+	err     error
+	calls   int
+	objects map[string][]byte
+}
+
+func newFlakyStorage(fails int, err error) *flakyStorage {
+	return &flakyStorage{fails: fails, err: err, objects: map[string][]byte{}}
+}
+
+func (s *flakyStorage) fail() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.fails > 0 {
+		s.fails--
+		return true
+	}
+	return false
+}
+
+func (s *flakyStorage) Save(_ context.Context, name string, r io.Reader, _ int64) error {
+	if s.fail() {
+		// the failures in the middle of the upload
+		_, _ = io.CopyN(ioutil.Discard, r, 2)
+		return s.err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.objects[name] = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *flakyStorage) Load(_ context.Context, name string) (io.ReadCloser, error) {
+	if s.fail() {
+		return nil, s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[name]
+	if !ok {
+		return nil, &StatusError{Code: http.StatusNotFound, Status: "404 Not Found"}
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+var testRetry = storageConfig.Retry{Attempts: 3, Backoff: 1, MaxBackoff: 2}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: nil},
+		{err: &StatusError{Code: http.StatusServiceUnavailable}, retryable: true},
+		{err: &StatusError{Code: http.StatusInternalServerError}, retryable: true},
+		{err: &StatusError{Code: http.StatusTooManyRequests}, retryable: true},
+		{err: &StatusError{Code: http.StatusRequestTimeout}, retryable: true},
+		{err: fmt.Errorf("wrapped, %w", &StatusError{Code: http.StatusBadGateway}), retryable: true},
+		{err: &StatusError{Code: http.StatusNotFound}},
+		{err: &StatusError{Code: http.StatusForbidden}},
+		{err: timeoutError{}, retryable: true},
+		{err: context.DeadlineExceeded, retryable: true},
+		{err: context.Canceled},
+		{err: os.ErrNotExist},
+		{err: errors.New("MD5 mismatch")},
+	}
+	for _, test := range tests {
+		if retryable := IsRetryable(test.err); retryable != test.retryable {
+			t.Errorf("wrong retryable %v of %v", retryable, test.err)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	backend := newFlakyStorage(2, &StatusError{Code: http.StatusServiceUnavailable})
+	store := WithRetry(backend, testRetry)
+
+	if err := store.Save(context.Background(), "room", bytes.NewReader([]byte("state")), 5); err != nil {
+		t.Fatalf("couldn't save with the retries, %v", err)
+	}
+	if backend.calls != 3 {
+		t.Errorf("wrong number of attempts %v", backend.calls)
+	}
+	// the content is sent again from the start
+	if data := string(backend.objects["room"]); data != "state" {
+		t.Errorf("wrong saved content %q", data)
+	}
+
+	backend.fails, backend.calls = 2, 0
+	data, err := LoadData(context.Background(), store, "room")
+	if err != nil || string(data) != "state" || backend.calls != 3 {
+		t.Errorf("wrong load %q with %v attempts, %v", data, backend.calls, err)
+	}
+
+	// the permanent errors
+	backend.calls = 0
+	if _, err := store.Load(context.Background(), "room2"); !errors.As(err, new(*StatusError)) || backend.calls != 1 {
+		t.Errorf("the missing content was retried %v times, %v", backend.calls, err)
+	}
+
+	// too many failures
+	backend.fails, backend.calls = 5, 0
+	if _, err := store.Load(context.Background(), "room"); err == nil || backend.calls != testRetry.Attempts {
+		t.Errorf("wrong number of attempts %v, %v", backend.calls, err)
+	}
+
+	// the streams can't be sent again
+	backend.fails, backend.calls = 1, 0
+	if err := store.Save(context.Background(), "room", ioutil.NopCloser(bytes.NewReader([]byte("state"))), 5); err == nil || backend.calls != 1 {
+		t.Errorf("the stream was sent %v times, %v", backend.calls, err)
+	}
+
+	// no retries
+	backend.fails, backend.calls = 1, 0
+	if _, err := WithRetry(backend, storageConfig.Retry{Attempts: 1}).Load(context.Background(), "room"); err == nil || backend.calls != 1 {
+		t.Errorf("retried %v times without the retries, %v", backend.calls, err)
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	backend := newFlakyStorage(5, &StatusError{Code: http.StatusServiceUnavailable})
+	store := WithRetry(backend, storageConfig.Retry{Attempts: 5, Backoff: int(time.Hour / time.Millisecond)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.Load(ctx, "room")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.Canceled || backend.calls != 1 {
+			t.Errorf("wrong error of the cancelled load %v after %v attempts", err, backend.calls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the load is not cancelled during the backoff")
+	}
+}
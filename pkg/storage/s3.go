@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	storageConfig "github.com/giongto35/cloud-game/v2/pkg/config/storage"
+)
+
+// S3Client is a client of S3-compatible storages (AWS S3, MinIO, etc.).
+type S3Client struct {
+	client  *s3.Client
+	bucket  string
+	prefix  string
+	timeout time.Duration
+}
+
+// NewS3Client returns either a new S3 storage client or some error in case of failure.
+func NewS3Client(conf storageConfig.S3) (*S3Client, error) {
+	if conf.Bucket == "" {
+		return nil, errors.New("S3 bucket was not specified")
+	}
+
+	opts := []func(*config.LoadOptions) error{config.WithRegion(conf.Region)}
+	if conf.CredentialsFile != "" {
+		opts = append(opts, config.WithSharedCredentialsFiles([]string{conf.CredentialsFile}))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if conf.Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(conf.Endpoint)
+		}
+		o.UsePathStyle = conf.PathStyle
+	})
+
+	return &S3Client{
+		client:  client,
+		bucket:  conf.Bucket,
+		prefix:  conf.Prefix,
+		timeout: 10 * time.Second,
+	}, nil
+}
+
+// Save uploads the content of the reader,
+// the content should be seekable (io.Seeker) for the requests signed over HTTP.
+func (s *S3Client) Save(ctx context.Context, name string, r io.Reader, size int64) (err error) {
+	if s == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(s.key(name)),
+		Body:          r,
+		ContentLength: size,
+	})
+	return err
+}
+
+func (s *S3Client) Load(ctx context.Context, name string) (r io.ReadCloser, err error) {
+	if s == nil {
+		return nil, errors.New("cloud storage was not initialized")
+	}
+
+	// the timeout of the request lasts until the content is closed
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelReader{ReadCloser: out.Body, cancel: cancel}, nil
+}
+
+// cancelReader cancels its request on close.
+type cancelReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// key returns the object key of the save.
+func (s *S3Client) key(name string) string { return s.prefix + name }
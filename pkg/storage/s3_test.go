@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	storageConfig "github.com/giongto35/cloud-game/v2/pkg/config/storage"
+)
+
+// newS3Server returns a (path-style) S3 API stub which stores objects in memory.
+func newS3Server(status int) (*httptest.Server, map[string][]byte) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+				return
+			}
+			_, _ = w.Write(data)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	return server, objects
+}
+
+func newTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "s3_test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return dir
+}
+
+func newTestS3Client(t *testing.T, dir string, endpoint string, prefix string) *S3Client {
+	credentials := filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(credentials, []byte("[default]\naws_access_key_id = test\naws_secret_access_key = test\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	client, err := NewS3Client(storageConfig.S3{
+		Endpoint:        endpoint,
+		Bucket:          "test-bucket",
+		Region:          "us-east-1",
+		CredentialsFile: credentials,
+		PathStyle:       true,
+		Prefix:          prefix,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create S3 client, %v", err)
+	}
+	return client
+}
+
+func tempSave(t *testing.T, dir string, data string) string {
+	path := filepath.Join(dir, "s3_test.file")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return path
+}
+
+func TestS3NoBucket(t *testing.T) {
+	if _, err := NewS3Client(storageConfig.S3{}); err == nil {
+		t.Errorf("expected an error without the bucket")
+	}
+}
+
+func TestS3Key(t *testing.T) {
+	tests := []struct {
+		prefix string
+		name   string
+		key    string
+	}{
+		{name: "abc___game", key: "abc___game"},
+		{prefix: "saves/", name: "abc___game", key: "saves/abc___game"},
+		{prefix: "saves/", name: "abc___game.2", key: "saves/abc___game.2"},
+	}
+	for _, test := range tests {
+		s := S3Client{prefix: test.prefix}
+		if key := s.key(test.name); key != test.key {
+			t.Errorf("wrong key %v, expected %v", key, test.key)
+		}
+	}
+}
+
+func TestS3SaveLoad(t *testing.T) {
+	server, objects := newS3Server(http.StatusOK)
+	defer server.Close()
+	dir := newTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	client := newTestS3Client(t, dir, server.URL, "saves/")
+	store := FileStorage{client}
+
+	if err := store.Save("room1", tempSave(t, dir, "test")); err != nil {
+		t.Fatalf("can't save, err: %v", err)
+	}
+	if _, ok := objects["/test-bucket/saves/room1"]; !ok {
+		t.Errorf("the object wasn't stored with the proper key, %v", objects)
+	}
+
+	data, err := store.Load("room1")
+	if err != nil {
+		t.Fatalf("can't load, err: %v", err)
+	}
+	if string(data) != "test" {
+		t.Errorf("wrong data %v", string(data))
+	}
+
+	if _, err := store.Load("room2"); err == nil {
+		t.Errorf("expected an error for a missing save")
+	}
+}
+
+func TestS3Errors(t *testing.T) {
+	server, _ := newS3Server(http.StatusForbidden)
+	defer server.Close()
+	dir := newTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	client := newTestS3Client(t, dir, server.URL, "")
+	store := FileStorage{client}
+
+	if err := store.Save("room1", tempSave(t, dir, "test")); err == nil {
+		t.Errorf("expected a save error")
+	}
+	if _, err := store.Load("room1"); err == nil {
+		t.Errorf("expected a load error")
+	}
+	if err := store.Save("room1", "/not/existing/file"); err == nil {
+		t.Errorf("expected a file error")
+	}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cespare/xxhash/v2"
+	storageConfig "github.com/giongto35/cloud-game/v2/pkg/config/storage"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compressed save states start with the header:
+// magic (4 bytes), version (1), the uncompressed size (uint64 LE),
+// the xxhash64 checksum of the uncompressed state (uint64 LE).
+// The states without the magic are uncompressed (legacy) ones.
+const (
+	stateMagic      = "CGSZ"
+	stateVersion    = 1
+	stateHeaderSize = len(stateMagic) + 1 + 8 + 8
+)
+
+var ErrCorruptedState = errors.New("corrupted save state")
+
+type stateHeader struct {
+	size     uint64
+	checksum uint64
+}
+
+func (h stateHeader) bytes() []byte {
+	b := make([]byte, stateHeaderSize)
+	copy(b, stateMagic)
+	b[len(stateMagic)] = stateVersion
+	binary.LittleEndian.PutUint64(b[len(stateMagic)+1:], h.size)
+	binary.LittleEndian.PutUint64(b[len(stateMagic)+9:], h.checksum)
+	return b
+}
+
+func readStateHeader(r io.Reader) (h stateHeader, err error) {
+	b := make([]byte, stateHeaderSize)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return h, ErrCorruptedState
+	}
+	if v := b[len(stateMagic)]; v != stateVersion {
+		return h, fmt.Errorf("unsupported save state version %v", v)
+	}
+	h.size = binary.LittleEndian.Uint64(b[len(stateMagic)+1:])
+	h.checksum = binary.LittleEndian.Uint64(b[len(stateMagic)+9:])
+	return h, nil
+}
+
+// StateCodec compresses and encrypts the save states of the cloud storage,
+// the local states stay uncompressed and plaintext for the cores.
+type StateCodec struct {
+	// the zstd level (1-22), 0 -- uncompressed
+	Level int
+	// the encryption keys, the first one encrypts the states,
+	// all of them decrypt, empty -- no encryption
+	Keys []Key
+	// the config error fails the saves
+	err error
+}
+
+// NewStateCodec returns the codec of the config with its keys,
+// the codec fails all the saves with the config errors.
+func NewStateCodec(conf storageConfig.Storage) (StateCodec, error) {
+	keys, err := LoadKeys(conf.Encryption.Keys)
+	if err != nil {
+		err = fmt.Errorf("the save state encryption, %v", err)
+		return StateCodec{err: err}, err
+	}
+	return StateCodec{Level: conf.Compression, Keys: keys}, nil
+}
+
+// Save uploads the save state file compressed and encrypted.
+func (c StateCodec) Save(ctx context.Context, s CloudStorage, name string, path string) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.Level <= 0 && len(c.Keys) == 0 {
+		return SaveFile(ctx, s, name, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// the state is kept on the disk for the retries
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.upload")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := c.encode(tmp, f); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.Save(ctx, name, tmp, size)
+}
+
+// SaveData uploads the data (i.e. a small file made in memory)
+// compressed and encrypted as the save states.
+func (c StateCodec) SaveData(ctx context.Context, s CloudStorage, name string, data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+	var buf bytes.Buffer
+	if err := c.encode(&buf, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	return s.Save(ctx, name, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// encode writes the state compressed and encrypted.
+func (c StateCodec) encode(out io.Writer, state io.ReadSeeker) (err error) {
+	var w io.WriteCloser = nopWriteCloser{out}
+	if len(c.Keys) > 0 {
+		if w, err = c.Keys[0].seal(out); err != nil {
+			return err
+		}
+	}
+	if err := c.compress(w, state); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// compress writes the state with the header of its size and checksum.
+func (c StateCodec) compress(w io.Writer, f io.ReadSeeker) error {
+	if c.Level <= 0 {
+		_, err := io.Copy(w, f)
+		return err
+	}
+	hash := xxhash.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.Write(stateHeader{size: uint64(size), checksum: hash.Sum64()}.bytes()); err != nil {
+		return err
+	}
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(enc, f); err != nil {
+		_ = enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+// Load downloads the save state into the file decrypting and decompressing it.
+// The file is replaced only with the states of the proper size and checksum,
+// the uncompressed (legacy) states are loaded as is.
+func (c StateCodec) Load(ctx context.Context, s CloudStorage, name string, path string) error {
+	return c.load(ctx, s, name, func(write func(w io.Writer) error) error { return writeFile(path, write) })
+}
+
+// LoadData downloads the data saved with SaveData (or as is).
+func (c StateCodec) LoadData(ctx context.Context, s CloudStorage, name string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.load(ctx, s, name, func(write func(w io.Writer) error) error { return write(&buf) }); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// load downloads the save state with the output function
+// which writes the state with the given function.
+func (c StateCodec) load(ctx context.Context, s CloudStorage, name string, output func(write func(w io.Writer) error) error) error {
+	if c.err != nil {
+		return c.err
+	}
+	r, err := s.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(cryptMagic)); string(magic) == cryptMagic {
+		plain, err := open(br, c.Keys)
+		if err != nil {
+			return err
+		}
+		br = bufio.NewReader(plain)
+	}
+	if magic, _ := br.Peek(len(stateMagic)); string(magic) != stateMagic {
+		return output(func(w io.Writer) error {
+			_, err := io.Copy(w, br)
+			return err
+		})
+	}
+	header, err := readStateHeader(br)
+	if err != nil {
+		return err
+	}
+	dec, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	return output(func(w io.Writer) error {
+		hash := xxhash.New()
+		// no more than the state size
+		n, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(dec, int64(header.size)+1))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, ErrCorruptedState) {
+				return err
+			}
+			return fmt.Errorf("%w, %v", ErrCorruptedState, err)
+		}
+		if uint64(n) != header.size || hash.Sum64() != header.checksum {
+			return ErrCorruptedState
+		}
+		return nil
+	})
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stateFixture returns the synthetic save state which looks like
+// the emulator memory dumps: mostly empty RAM, repeated tiles
+// and tables, and some noise of the game variables.
+func stateFixture(size int) []byte {
+	rnd := rand.New(rand.NewSource(int64(size)))
+	state := make([]byte, size)
+	for i := 0; i < size; {
+		block := 256 + rnd.Intn(4096)
+		if i+block > size {
+			block = size - i
+		}
+		switch n := rnd.Intn(10); {
+		case n < 5:
+			// empty memory
+		case n < 8:
+			tile := make([]byte, 8+rnd.Intn(56))
+			rnd.Read(tile)
+			for j := 0; j < block; j++ {
+				state[i+j] = tile[j%len(tile)]
+			}
+		default:
+			rnd.Read(state[i : i+block])
+		}
+		i += block
+	}
+	return state
+}
+
+// the sizes of the save states of some cores
+var stateFixtures = []struct {
+	name string
+	size int
+}{
+	{name: "snes", size: 400 << 10},
+	{name: "ps1", size: 4608 << 10},
+	{name: "n64", size: 16 << 20},
+}
+
+func newStateFile(t testing.TB, state []byte) (dir string, path string) {
+	dir, err := ioutil.TempDir("", "storage_state_test")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	path = filepath.Join(dir, "room.dat")
+	if err := ioutil.WriteFile(path, state, 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return dir, path
+}
+
+func TestState(t *testing.T) {
+	state := stateFixture(400 << 10)
+	dir, path := newStateFile(t, state)
+	defer func() { _ = os.RemoveAll(dir) }()
+	store := newFlakyStorage(0, nil)
+	codec := StateCodec{Level: 3}
+
+	if err := codec.Save(context.Background(), store, "room", path); err != nil {
+		t.Fatalf("couldn't save the state, %v", err)
+	}
+	compressed := store.objects["room"]
+	if !bytes.HasPrefix(compressed, []byte(stateMagic)) || len(compressed) >= len(state) {
+		t.Errorf("the state is not compressed, %v of %v bytes", len(compressed), len(state))
+	}
+
+	loaded := filepath.Join(dir, "loaded.dat")
+	if err := codec.Load(context.Background(), store, "room", loaded); err != nil {
+		t.Fatalf("couldn't load the state, %v", err)
+	}
+	if data, _ := ioutil.ReadFile(loaded); !bytes.Equal(data, state) {
+		t.Errorf("wrong loaded state of %v bytes", len(data))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("the state has left the temp files %v", len(files))
+	}
+}
+
+func TestStateLegacy(t *testing.T) {
+	state := stateFixture(64 << 10)
+	dir, path := newStateFile(t, state)
+	defer func() { _ = os.RemoveAll(dir) }()
+	store := newFlakyStorage(0, nil)
+
+	codec := StateCodec{}
+
+	// without the compression
+	if err := codec.Save(context.Background(), store, "room", path); err != nil {
+		t.Fatalf("couldn't save the state, %v", err)
+	}
+	if !bytes.Equal(store.objects["room"], state) {
+		t.Errorf("the uncompressed state is changed")
+	}
+	// the old uploads of any size
+	for _, legacy := range [][]byte{state, []byte("CG"), {}} {
+		store.objects["legacy"] = legacy
+		loaded := filepath.Join(dir, "loaded.dat")
+		if err := codec.Load(context.Background(), store, "legacy", loaded); err != nil {
+			t.Fatalf("couldn't load the legacy state, %v", err)
+		}
+		if data, _ := ioutil.ReadFile(loaded); !bytes.Equal(data, legacy) {
+			t.Errorf("wrong legacy state of %v bytes, expected %v", len(data), len(legacy))
+		}
+	}
+}
+
+func TestStateCorrupted(t *testing.T) {
+	state := stateFixture(64 << 10)
+	dir, path := newStateFile(t, state)
+	defer func() { _ = os.RemoveAll(dir) }()
+	store := newFlakyStorage(0, nil)
+	codec := StateCodec{Level: 1}
+	if err := codec.Save(context.Background(), store, "room", path); err != nil {
+		t.Fatalf("couldn't save the state, %v", err)
+	}
+	good := store.objects["room"]
+
+	corrupt := func(fn func(b []byte) []byte) []byte {
+		return fn(append([]byte{}, good...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "checksum", data: corrupt(func(b []byte) []byte { b[stateHeaderSize-1] ^= 0xff; return b })},
+		{name: "size", data: corrupt(func(b []byte) []byte { b[len(stateMagic)+1]++; return b })},
+		{name: "data", data: corrupt(func(b []byte) []byte { b[len(b)/2] ^= 0xff; return b })},
+		{name: "truncated", data: corrupt(func(b []byte) []byte { return b[:len(b)/2] })},
+		{name: "header", data: []byte(stateMagic + "\x01\x00")},
+		{name: "version", data: corrupt(func(b []byte) []byte { b[len(stateMagic)] = 2; return b })},
+	}
+	for _, test := range tests {
+		store.objects["room"] = test.data
+		err := codec.Load(context.Background(), store, "room", path)
+		if err == nil {
+			t.Errorf("loaded the state with the corrupted %v", test.name)
+		}
+		if test.name != "version" && !errors.Is(err, ErrCorruptedState) {
+			t.Errorf("wrong error of the corrupted %v, %v", test.name, err)
+		}
+		// the core gets the old state
+		if data, _ := ioutil.ReadFile(path); !bytes.Equal(data, state) {
+			t.Errorf("the state was replaced with the corrupted %v", test.name)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("the corrupted states have left the files %v", len(files))
+	}
+}
+
+func BenchmarkSaveState(b *testing.B) {
+	for _, fixture := range stateFixtures {
+		for _, level := range []int{1, 3, 9} {
+			fixture, level := fixture, level
+			b.Run(fmt.Sprintf("%v/%v", fixture.name, level), func(b *testing.B) {
+				dir, path := newStateFile(b, stateFixture(fixture.size))
+				defer func() { _ = os.RemoveAll(dir) }()
+				store := newFlakyStorage(0, nil)
+				codec := StateCodec{Level: level}
+				b.SetBytes(int64(fixture.size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := codec.Save(context.Background(), store, "room", path); err != nil {
+						b.Fatalf("couldn't save the state, %v", err)
+					}
+				}
+				b.StopTimer()
+				upload := len(store.objects["room"])
+				b.ReportMetric(float64(upload), "upload-bytes")
+				b.ReportMetric(100*float64(upload)/float64(fixture.size), "%-of-state")
+			})
+		}
+	}
+}
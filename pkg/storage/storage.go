@@ -1,6 +1,14 @@
 package storage
 
+import (
+	"context"
+	"io"
+)
+
+// CloudStorage is a remote storage of the room files (save states, save RAM).
 type CloudStorage interface {
-	Save(name string, localPath string) (err error)
-	Load(name string) (data []byte, err error)
+	// Save uploads size bytes of the reader with the name.
+	Save(ctx context.Context, name string, r io.Reader, size int64) (err error)
+	// Load returns the content with the name, it should be closed after reading.
+	Load(ctx context.Context, name string) (r io.ReadCloser, err error)
 }
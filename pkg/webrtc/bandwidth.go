@@ -0,0 +1,73 @@
+package webrtc
+
+import (
+	"sync"
+
+	"github.com/pion/rtcp"
+)
+
+// bandwidthEstimator estimates the available bandwidth of a peer (kbit/s)
+// from its RTCP feedback. It takes the receiver estimate (REMB) if there is one,
+// and lowers it with the packet loss from the receiver reports
+// (similar to the loss-based controller of GCC).
+type bandwidthEstimator struct {
+	mu sync.Mutex
+	// the last receiver estimate
+	remb uint
+	// the loss-based estimate
+	loss uint
+	// the estimate without any feedback
+	initial uint
+}
+
+const (
+	// the loss fractions (x/256) of the receiver reports
+	// below which the estimate goes up or above which it goes down
+	lowLoss  = 256 * 2 / 100
+	highLoss = 256 * 10 / 100
+)
+
+func newBandwidthEstimator(initial uint) *bandwidthEstimator {
+	return &bandwidthEstimator{initial: initial, loss: initial}
+}
+
+// feedback updates the estimate with the RTCP packets.
+func (b *bandwidthEstimator) feedback(packets []rtcp.Packet) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, packet := range packets {
+		switch p := packet.(type) {
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			b.remb = uint(p.Bitrate / 1000)
+		case *rtcp.ReceiverReport:
+			for _, report := range p.Reports {
+				b.lost(report.FractionLost)
+			}
+		}
+	}
+}
+
+func (b *bandwidthEstimator) lost(fraction uint8) {
+	if b.loss == 0 {
+		b.loss = b.remb
+	}
+	switch {
+	case fraction < lowLoss:
+		b.loss += b.loss / 20
+		if b.initial > 0 && b.loss > b.initial {
+			b.loss = b.initial
+		}
+	case fraction > highLoss:
+		b.loss = uint(float64(b.loss) * (1 - 0.5*float64(fraction)/256))
+	}
+}
+
+// bitrate returns the current estimate in kbit/s or 0 if it's unknown.
+func (b *bandwidthEstimator) bitrate() uint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remb > 0 && (b.loss == 0 || b.remb < b.loss) {
+		return b.remb
+	}
+	return b.loss
+}
@@ -0,0 +1,59 @@
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/pion/rtcp"
+)
+
+func report(fraction uint8) *rtcp.ReceiverReport {
+	return &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{FractionLost: fraction}}}
+}
+
+func TestBandwidthEstimator(t *testing.T) {
+	b := newBandwidthEstimator(0)
+	if br := b.bitrate(); br != 0 {
+		t.Fatalf("expected unknown bitrate, got %v", br)
+	}
+
+	b.feedback([]rtcp.Packet{&rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: 2000000}})
+	if br := b.bitrate(); br != 2000 {
+		t.Errorf("expected REMB bitrate 2000, got %v", br)
+	}
+
+	// 50% loss
+	b.feedback([]rtcp.Packet{report(128)})
+	if br := b.bitrate(); br != 1500 {
+		t.Errorf("expected lowered bitrate 1500, got %v", br)
+	}
+
+	// no loss, goes up but not higher than REMB
+	for i := 0; i < 100; i++ {
+		b.feedback([]rtcp.Packet{report(0)})
+	}
+	if br := b.bitrate(); br != 2000 {
+		t.Errorf("expected REMB bitrate 2000, got %v", br)
+	}
+}
+
+func TestBandwidthEstimatorWithoutRemb(t *testing.T) {
+	b := newBandwidthEstimator(5000)
+	if br := b.bitrate(); br != 5000 {
+		t.Fatalf("expected initial bitrate, got %v", br)
+	}
+	// moderate loss keeps the estimate
+	b.feedback([]rtcp.Packet{report(256 * 5 / 100)})
+	if br := b.bitrate(); br != 5000 {
+		t.Errorf("expected the same bitrate, got %v", br)
+	}
+	b.feedback([]rtcp.Packet{report(64)})
+	if br := b.bitrate(); br != 4375 {
+		t.Errorf("expected lowered bitrate 4375, got %v", br)
+	}
+	for i := 0; i < 100; i++ {
+		b.feedback([]rtcp.Packet{report(0)})
+	}
+	if br := b.bitrate(); br != 5000 {
+		t.Errorf("expected bitrate not higher than initial, got %v", br)
+	}
+}
@@ -26,6 +26,17 @@ func DefaultPeerConnection(conf conf.Webrtc) (*PeerConnection, error) {
 	if err := m.RegisterDefaultCodecs(); err != nil {
 		return nil, err
 	}
+	// AV1 is not in the default codecs
+	if err := m.RegisterCodec(pion.RTPCodecParameters{
+		RTPCodecCapability: pion.RTPCodecCapability{
+			MimeType:     pion.MimeTypeAV1,
+			ClockRate:    videoClockRate,
+			RTCPFeedback: []pion.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}},
+		},
+		PayloadType: 35,
+	}, pion.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
 
 	i := &interceptor.Registry{}
 	if !conf.DisableDefaultInterceptors {
@@ -66,14 +77,7 @@ func DefaultPeerConnection(conf conf.Webrtc) (*PeerConnection, error) {
 		settings = settingEngine
 	})
 
-	peerConf := pion.Configuration{ICEServers: []pion.ICEServer{}}
-	for _, server := range conf.IceServers {
-		peerConf.ICEServers = append(peerConf.ICEServers, pion.ICEServer{
-			URLs:       []string{server.Url},
-			Username:   server.Username,
-			Credential: server.Credential,
-		})
-	}
+	peerConf := pion.Configuration{ICEServers: iceServers(conf.IceServers)}
 
 	conn := PeerConnection{
 		api: pion.NewAPI(
@@ -86,6 +90,23 @@ func DefaultPeerConnection(conf conf.Webrtc) (*PeerConnection, error) {
 	return &conn, nil
 }
 
+func iceServers(servers []conf.IceServer) []pion.ICEServer {
+	ice := []pion.ICEServer{}
+	for _, server := range servers {
+		ice = append(ice, pion.ICEServer{
+			URLs:       []string{server.Url},
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	return ice
+}
+
+// SetICEServers replaces the ICE servers of the new connections.
+func (p *PeerConnection) SetICEServers(servers []conf.IceServer) {
+	p.config.ICEServers = iceServers(servers)
+}
+
 func (p *PeerConnection) NewConnection() (*pion.PeerConnection, error) {
 	return p.api.NewPeerConnection(*p.config)
 }
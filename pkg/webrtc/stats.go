@@ -0,0 +1,196 @@
+package webrtc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+// statsInterval is the default interval between the connection stats updates.
+const statsInterval = 5 * time.Second
+
+// audioClockRate is the RTP clock rate of Opus.
+const audioClockRate = 48000
+
+// TrackStats contains the stats of one media track of the peer.
+type TrackStats struct {
+	// the round-trip time of the last receiver report
+	RTT time.Duration
+	// the fraction (0-1) of the packets lost since the previous receiver report
+	FractionLost float64
+	// the interarrival jitter of the packets
+	Jitter time.Duration
+	// the number of the sent bytes of the track
+	BytesSent uint64
+}
+
+// ConnectionStats contains a snapshot of the connection quality of the peer.
+type ConnectionStats struct {
+	Video TrackStats
+	Audio TrackStats
+	// the number of all the bytes sent over the connection
+	BytesSent uint64
+	// the time of the snapshot, zero if there are no stats yet
+	Updated time.Time
+}
+
+// connectionStats gathers the stats of the peer from the RTCP receiver reports
+// and the pion stats reports.
+// The pion reports don't have the stats of the RTP streams
+// in every version, so the receiver reports are the fallback for those.
+type connectionStats struct {
+	// the media bytes written into the tracks,
+	// should be 64-bit aligned for atomic access
+	videoBytes uint64
+	audioBytes uint64
+
+	mu sync.Mutex
+	// the stats of the last receiver reports by the track kind
+	reports map[string]TrackStats
+	last    ConnectionStats
+}
+
+// receiverReports updates the track stats with the receiver reports
+// of the RTP stream with the SSRC received at the time.
+func (s *connectionStats) receiverReports(kind string, ssrc uint32, clockRate float64, packets []rtcp.Packet, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, packet := range packets {
+		rr, ok := packet.(*rtcp.ReceiverReport)
+		if !ok {
+			continue
+		}
+		for _, report := range rr.Reports {
+			if report.SSRC != ssrc {
+				continue
+			}
+			if s.reports == nil {
+				s.reports = make(map[string]TrackStats)
+			}
+			stats := s.reports[kind]
+			stats.FractionLost = float64(report.FractionLost) / 256
+			stats.Jitter = time.Duration(float64(report.Jitter) / clockRate * float64(time.Second))
+			if rtt, ok := roundTripTime(report, now); ok {
+				stats.RTT = rtt
+			}
+			s.reports[kind] = stats
+		}
+	}
+}
+
+// roundTripTime returns the round-trip time of the receiver report,
+// the report should have the time of our last sender report.
+func roundTripTime(report rtcp.ReceptionReport, now time.Time) (time.Duration, bool) {
+	if report.LastSenderReport == 0 {
+		return 0, false
+	}
+	// the middle 32 bits of the NTP time, 1/65536 s
+	rtt := ntpMiddle(now) - report.LastSenderReport - report.Delay
+	// the clock skew of the peers
+	if rtt > 1<<31 {
+		return 0, false
+	}
+	return time.Duration(uint64(rtt) * uint64(time.Second) >> 16), true
+}
+
+// ntpMiddle returns the middle 32 bits of the NTP timestamp of the time.
+func ntpMiddle(t time.Time) uint32 {
+	// seconds since 1st January 1900
+	secs := uint64(t.Unix()) + 2208988800
+	frac := uint64(t.Nanosecond()) << 16 / uint64(time.Second)
+	return uint32(secs<<16 | frac)
+}
+
+// update makes a new snapshot of the stats with the pion stats report.
+func (s *connectionStats) update(report webrtc.StatsReport, now time.Time) ConnectionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := ConnectionStats{
+		Video:   s.reports[webrtc.RTPCodecTypeVideo.String()],
+		Audio:   s.reports[webrtc.RTPCodecTypeAudio.String()],
+		Updated: now,
+	}
+	stats.Video.BytesSent = atomic.LoadUint64(&s.videoBytes)
+	stats.Audio.BytesSent = atomic.LoadUint64(&s.audioBytes)
+
+	track := func(kind string) *TrackStats {
+		if kind == webrtc.RTPCodecTypeAudio.String() {
+			return &stats.Audio
+		}
+		return &stats.Video
+	}
+	for _, st := range report {
+		switch st := st.(type) {
+		case webrtc.OutboundRTPStreamStats:
+			track(st.Kind).BytesSent = st.BytesSent
+		case webrtc.RemoteInboundRTPStreamStats:
+			t := track(st.Kind)
+			t.RTT = time.Duration(st.RoundTripTime * float64(time.Second))
+			t.FractionLost = st.FractionLost
+			t.Jitter = time.Duration(st.Jitter * float64(time.Second))
+		case webrtc.TransportStats:
+			stats.BytesSent += st.BytesSent
+		}
+	}
+	s.last = stats
+	return stats
+}
+
+func (s *connectionStats) snapshot() ConnectionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Egress is the number of the media bytes sent to the peers.
+type Egress struct {
+	Video uint64
+	Audio uint64
+}
+
+// Total returns the number of all the media bytes.
+func (e Egress) Total() uint64 { return e.Video + e.Audio }
+
+// Add returns the sum of the bytes.
+func (e Egress) Add(o Egress) Egress {
+	return Egress{Video: e.Video + o.Video, Audio: e.Audio + o.Audio}
+}
+
+// Since returns the bytes sent after the other number of them.
+func (e Egress) Since(o Egress) Egress {
+	return Egress{Video: since(e.Video, o.Video), Audio: since(e.Audio, o.Audio)}
+}
+
+func since(n, base uint64) uint64 {
+	if n < base {
+		return 0
+	}
+	return n - base
+}
+
+// Egress returns the number of the media bytes written into the tracks of the peer.
+func (w *WebRTC) Egress() Egress {
+	return Egress{Video: atomic.LoadUint64(&w.stats.videoBytes), Audio: atomic.LoadUint64(&w.stats.audioBytes)}
+}
+
+// Stats returns the last snapshot of the connection stats of the peer.
+func (w *WebRTC) Stats() ConnectionStats { return w.stats.snapshot() }
+
+// pollStats updates the connection stats of the peer
+// with the interval until the connection is closed.
+func (w *WebRTC) pollStats(conn *webrtc.PeerConnection, interval time.Duration) {
+	if interval <= 0 {
+		interval = statsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if conn.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		w.stats.update(conn.GetStats(), time.Now())
+	}
+}
@@ -0,0 +1,263 @@
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	webrtcConfig "github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+func TestConnectionStatsReports(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	s := connectionStats{videoBytes: 4000, audioBytes: 300}
+
+	// our sender report was 100ms ago and the peer held it for 20ms
+	sent := ntpMiddle(now.Add(-100 * time.Millisecond))
+	s.receiverReports("video", 42, videoClockRate, []rtcp.Packet{
+		&rtcp.PictureLossIndication{},
+		&rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{
+			{SSRC: 42, FractionLost: 64, Jitter: 900, LastSenderReport: sent, Delay: 65536 / 50},
+			{SSRC: 43, FractionLost: 255},
+		}},
+	}, now)
+
+	stats := s.update(webrtc.StatsReport{}, now)
+	if rtt := stats.Video.RTT; rtt < 79*time.Millisecond || rtt > 81*time.Millisecond {
+		t.Errorf("wrong video RTT %v, expected 80ms", rtt)
+	}
+	if stats.Video.FractionLost != 0.25 {
+		t.Errorf("wrong video packet loss %v", stats.Video.FractionLost)
+	}
+	if stats.Video.Jitter != 10*time.Millisecond {
+		t.Errorf("wrong video jitter %v", stats.Video.Jitter)
+	}
+	if stats.Video.BytesSent != 4000 || stats.Audio.BytesSent != 300 {
+		t.Errorf("wrong sent bytes %v/%v", stats.Video.BytesSent, stats.Audio.BytesSent)
+	}
+	if stats.Audio.RTT != 0 || stats.Audio.FractionLost != 0 {
+		t.Errorf("the audio stats from the video reports %+v", stats.Audio)
+	}
+
+	// the stream stats of the pion report take precedence
+	stats = s.update(webrtc.StatsReport{
+		"out": webrtc.OutboundRTPStreamStats{Kind: "audio", BytesSent: 5000},
+		"remote": webrtc.RemoteInboundRTPStreamStats{
+			Kind: "audio", RoundTripTime: 0.05, FractionLost: 0.1, Jitter: 0.002,
+		},
+		"iceTransport": webrtc.TransportStats{BytesSent: 12345},
+		"pc":           webrtc.PeerConnectionStats{},
+	}, now)
+	want := TrackStats{RTT: 50 * time.Millisecond, FractionLost: 0.1, Jitter: 2 * time.Millisecond, BytesSent: 5000}
+	if stats.Audio != want {
+		t.Errorf("wrong audio stats %+v, expected %+v", stats.Audio, want)
+	}
+	if stats.BytesSent != 12345 || !stats.Updated.Equal(now) {
+		t.Errorf("wrong connection stats %+v", stats)
+	}
+	if s.snapshot() != stats {
+		t.Errorf("the last snapshot isn't cached")
+	}
+}
+
+func TestRoundTripTime(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	if _, ok := roundTripTime(rtcp.ReceptionReport{}, now); ok {
+		t.Errorf("the report without sender reports has RTT")
+	}
+	// the peer clock is ahead
+	if _, ok := roundTripTime(rtcp.ReceptionReport{LastSenderReport: ntpMiddle(now.Add(time.Second))}, now); ok {
+		t.Errorf("the report from the future has RTT")
+	}
+}
+
+// trackWriter is a mock track counting the written bytes,
+// it fails every failEvery write if set.
+type trackWriter struct {
+	webrtc.TrackLocal
+	mu        sync.Mutex
+	writes    int
+	bytes     uint64
+	failEvery int
+}
+
+func (t *trackWriter) WriteSample(sample media.Sample) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writes++
+	if t.failEvery > 0 && t.writes%t.failEvery == 0 {
+		return errors.New("write failed")
+	}
+	t.bytes += uint64(len(sample.Data))
+	return nil
+}
+
+func (t *trackWriter) written() (int, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.writes, t.bytes
+}
+
+// Tests that the egress of the peer has all the bytes
+// written into its tracks and none of the failed ones.
+func TestEgress(t *testing.T) {
+	const frames = 100
+	video, audio := &trackWriter{}, &trackWriter{failEvery: 7}
+	w := &WebRTC{
+		ImageChannel: make(chan WebFrame, frames),
+		AudioChannel: make(chan AudioFrame, frames),
+		videoTrack:   video,
+		isConnected:  true,
+	}
+	w.startStreaming(audio)
+	defer w.StopClient()
+
+	for i := 0; i < frames; i++ {
+		w.SendVideo(WebFrame{Data: make([]byte, 1000+i), Duration: 16 * time.Millisecond})
+		w.SendAudio(AudioFrame{Data: make([]byte, 100+i%10)})
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		vw, vb := video.written()
+		aw, ab := audio.written()
+		if vw == frames && aw == frames && w.Egress() == (Egress{Video: vb, Audio: ab}) {
+			break
+		}
+	}
+
+	_, vb := video.written()
+	_, ab := audio.written()
+	egress := w.Egress()
+	if egress.Video != vb || egress.Audio != ab || egress.Total() != vb+ab {
+		t.Errorf("wrong egress %+v, expected %v/%v", egress, vb, ab)
+	}
+	if vb != frames*1000+frames*(frames-1)/2 {
+		t.Errorf("wrong video bytes %v", vb)
+	}
+	if stats := w.stats.update(nil, time.Now()); stats.Video.BytesSent != vb || stats.Audio.BytesSent != ab {
+		t.Errorf("wrong sent bytes in the stats %+v", stats)
+	}
+}
+
+// Tests the stats of the connection with
+// another in-process peer connection.
+func TestConnectionStatsPeers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the peer connection test is slow")
+	}
+	conf := webrtcConfig.Config{}
+	conf.Encoder.Video.Codec = string(codec.VPX)
+	conf.Encoder.Audio.Frame = 20
+	w, err := NewWebRTC(conf)
+	if err != nil {
+		t.Fatalf("couldn't create the peer, %v", err)
+	}
+	w.statsEvery = 200 * time.Millisecond
+	defer w.StopClient()
+
+	// the remote peer with the receiver reports
+	remote, _ := connectPeer(t, w)
+	defer func() { _ = remote.Close() }()
+
+	// the stats are polled after the connection
+	var stats ConnectionStats
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		w.SendVideo(WebFrame{Data: make([]byte, 500), Duration: 16 * time.Millisecond})
+		w.SendAudio(AudioFrame{Data: make([]byte, 100)})
+		time.Sleep(20 * time.Millisecond)
+		if stats = w.Stats(); stats.Video.BytesSent > 0 && stats.Audio.BytesSent > 0 && stats.BytesSent > 0 {
+			break
+		}
+	}
+	if stats.Updated.IsZero() {
+		t.Fatalf("no connection stats")
+	}
+	if stats.Video.BytesSent == 0 || stats.Audio.BytesSent == 0 || stats.BytesSent < stats.Video.BytesSent {
+		t.Errorf("wrong sent bytes %+v", stats)
+	}
+}
+
+// connectPeer connects the peer with a new in-process remote peer
+// that has the default interceptors (RTCP reports) and reads all its tracks.
+// It returns the remote peer and its input data channel when it opens.
+func connectPeer(t *testing.T, w *WebRTC) (*webrtc.PeerConnection, <-chan *webrtc.DataChannel) {
+	m, i := &webrtc.MediaEngine{}, &interceptor.Registry{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		t.Fatal(err)
+	}
+	remote, err := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i)).
+		NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("couldn't create the remote peer, %v", err)
+	}
+
+	remote.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+	input := make(chan *webrtc.DataChannel, 1)
+	remote.OnDataChannel(func(channel *webrtc.DataChannel) {
+		if channel.Label() == "game-input" {
+			channel.OnOpen(func() { input <- channel })
+		}
+	})
+	remote.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		candidate, _ := Encode(c.ToJSON())
+		_ = w.AddCandidate(candidate)
+	})
+
+	offer, err := w.StartClient(func(candidate string) {
+		if candidate == "" {
+			return
+		}
+		var c webrtc.ICECandidateInit
+		if err := Decode(candidate, &c); err == nil {
+			_ = remote.AddICECandidate(c)
+		}
+	})
+	if err != nil {
+		t.Fatalf("couldn't start the peer, %v", err)
+	}
+	if err := answer(remote, w, offer); err != nil {
+		t.Fatal(err)
+	}
+	return remote, input
+}
+
+// answer answers the offer of the peer with the remote peer.
+func answer(remote *webrtc.PeerConnection, w *WebRTC, offer string) error {
+	var sdp webrtc.SessionDescription
+	if err := Decode(offer, &sdp); err != nil {
+		return err
+	}
+	if err := remote.SetRemoteDescription(sdp); err != nil {
+		return fmt.Errorf("couldn't set the offer, %v", err)
+	}
+	answer, err := remote.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err := remote.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	encoded, _ := Encode(answer)
+	if err := w.SetRemoteSDP(encoded); err != nil {
+		return fmt.Errorf("couldn't set the answer, %v", err)
+	}
+	return nil
+}
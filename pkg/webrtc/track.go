@@ -0,0 +1,205 @@
+package webrtc
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/rtp/pkg/obu"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const (
+	videoClockRate = 90000
+	// the max size of RTP packets (pion default)
+	rtpMTU = 1200
+	// OBU types of the AV1 bitstream
+	obuTemporalDelimiter = 2
+	obuTileList          = 8
+)
+
+// sampleWriter is a track that accepts the encoded frames.
+type sampleWriter interface {
+	WriteSample(sample media.Sample) error
+}
+
+// videoTrack is a local video track that accepts the encoded frames.
+type videoTrack interface {
+	webrtc.TrackLocal
+	sampleWriter
+}
+
+// rtpClock turns the media timestamps of the frames into the RTP timestamps
+// of a track (since its first frame), so the RTP timestamps follow the media time
+// without the rounding drift of the sample durations and the frame after a gap goes at its time.
+type rtpClock struct {
+	rate    float64
+	started bool
+	// the media time of the first frame
+	base time.Duration
+	// the media time of the next frame after the last one
+	next time.Duration
+	// the RTP timestamp of the last frame
+	last int64
+}
+
+// timestamp returns the RTP timestamp of the frame of the media timestamp and duration.
+// The timestamps going back (i.e. of the new emulator or without the media time)
+// go on from the last frame.
+func (c *rtpClock) timestamp(ts time.Duration, d time.Duration) uint32 {
+	switch {
+	case !c.started:
+		c.base, c.started = ts, true
+	case ts < c.next-d/2:
+		c.base += ts - c.next
+	}
+	c.next = ts + d
+	ticks := int64(math.Round((ts - c.base).Seconds() * c.rate))
+	if ticks < c.last {
+		ticks = c.last
+	}
+	c.last = ticks
+	return uint32(ticks)
+}
+
+func mimeType(c codec.VideoCodec) string {
+	switch c {
+	case codec.H264:
+		return webrtc.MimeTypeH264
+	case codec.VPX:
+		return webrtc.MimeTypeVP8
+	case codec.VP9:
+		return webrtc.MimeTypeVP9
+	case codec.AV1:
+		return webrtc.MimeTypeAV1
+	default:
+		return webrtc.MimeTypeH264
+	}
+}
+
+// videoCodec returns the codec for the MIME type or an empty one.
+func videoCodec(mime string) codec.VideoCodec {
+	for _, c := range codec.Preferred {
+		if strings.EqualFold(mimeType(c), mime) {
+			return c
+		}
+	}
+	return ""
+}
+
+func newVideoTrack(c codec.VideoCodec) (*timedTrack, error) {
+	return newTimedTrack(webrtc.RTPCodecCapability{MimeType: mimeType(c)}, "video", "game-video")
+}
+
+func newAudioTrack() (*timedTrack, error) {
+	return newTimedTrack(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "game-audio")
+}
+
+// timedTrack is a local track that packetizes the frames with their own
+// RTP timestamps (media.Sample.PacketTimestamp) since pion sample tracks
+// only move the timestamps by the durations of the previous samples.
+type timedTrack struct {
+	*webrtc.TrackLocalStaticRTP
+	packetizer rtp.Packetizer
+	// the random RTP timestamp of the first frame
+	offset uint32
+	// AV1 temporal units are packetized by OBUs
+	av1 bool
+}
+
+func newTimedTrack(capability webrtc.RTPCodecCapability, id string, stream string) (*timedTrack, error) {
+	var payloader rtp.Payloader
+	clockRate := uint32(videoClockRate)
+	switch capability.MimeType {
+	case webrtc.MimeTypeH264:
+		payloader = &codecs.H264Payloader{}
+	case webrtc.MimeTypeVP8:
+		payloader = &codecs.VP8Payloader{EnablePictureID: true}
+	case webrtc.MimeTypeVP9:
+		payloader = &codecs.VP9Payloader{}
+	case webrtc.MimeTypeAV1:
+		payloader = &codecs.AV1Payloader{}
+	case webrtc.MimeTypeOpus:
+		payloader, clockRate = &codecs.OpusPayloader{}, audioClockRate
+	default:
+		return nil, fmt.Errorf("no payloader for %v", capability.MimeType)
+	}
+	track, err := webrtc.NewTrackLocalStaticRTP(capability, id, stream)
+	if err != nil {
+		return nil, err
+	}
+	// the payload type and SSRC are set by the track itself
+	packetizer := rtp.NewPacketizer(rtpMTU, 0, 0, payloader, rtp.NewRandomSequencer(), clockRate)
+	return &timedTrack{
+		TrackLocalStaticRTP: track,
+		packetizer:          packetizer,
+		offset:              randomTimestamp(),
+		av1:                 capability.MimeType == webrtc.MimeTypeAV1,
+	}, nil
+}
+
+// WriteSample packetizes the frame with its RTP timestamp,
+// each OBU of the AV1 temporal units goes separately.
+func (t *timedTrack) WriteSample(sample media.Sample) error {
+	units := [][]byte{sample.Data}
+	if t.av1 {
+		units = splitOBUs(sample.Data)
+	}
+	ts := t.offset + sample.PacketTimestamp
+	for i, unit := range units {
+		last := i == len(units)-1
+		// all the packets of the frame share the timestamp
+		for _, p := range t.packetizer.Packetize(unit, 0) {
+			p.Timestamp = ts
+			p.Marker = last && p.Marker
+			if err := t.WriteRTP(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func randomTimestamp() uint32 {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// splitOBUs splits AV1 temporal unit into separate OBUs
+// without temporal delimiters and tile lists (not allowed in RTP).
+func splitOBUs(data []byte) (units [][]byte) {
+	for len(data) > 0 {
+		header := 1
+		if data[0]&0x04 != 0 {
+			header++
+		}
+		typ := (data[0] >> 3) & 0x0F
+		size := len(data)
+		if data[0]&0x02 != 0 {
+			if len(data) <= header {
+				return
+			}
+			n, read, err := obu.ReadLeb128(data[header:])
+			if err != nil {
+				return
+			}
+			size = header + int(read) + int(n)
+			if size > len(data) {
+				return
+			}
+		}
+		if typ != obuTemporalDelimiter && typ != obuTileList {
+			units = append(units, data[:size])
+		}
+		data = data[size:]
+	}
+	return
+}
@@ -0,0 +1,140 @@
+package webrtc
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestVideoCodecMime(t *testing.T) {
+	for _, c := range codec.Preferred {
+		if got := videoCodec(mimeType(c)); got != c {
+			t.Errorf("%v -> %v -> %v", c, mimeType(c), got)
+		}
+	}
+	if got := videoCodec("video/vp9"); got != codec.VP9 {
+		t.Errorf("mime types should be case insensitive, got %v", got)
+	}
+	if got := videoCodec(webrtc.MimeTypeH265); got != "" {
+		t.Errorf("unexpected codec %v", got)
+	}
+}
+
+func TestSplitOBUs(t *testing.T) {
+	td := []byte{0x12, 0x00}
+	seq := []byte{0x0A, 0x03, 1, 2, 3}
+	frame := []byte{0x32, 0x02, 4, 5}
+	// with an extension byte and without the size field (till the end)
+	last := []byte{0x34, 0x00, 6, 7, 8}
+
+	var data []byte
+	for _, unit := range [][]byte{td, seq, frame, last} {
+		data = append(data, unit...)
+	}
+
+	units := splitOBUs(data)
+	want := [][]byte{seq, frame, last}
+	if len(units) != len(want) {
+		t.Fatalf("got %v OBUs, expected %v", len(units), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(units[i], want[i]) {
+			t.Errorf("OBU %v is %v, expected %v", i, units[i], want[i])
+		}
+	}
+
+	if units := splitOBUs([]byte{0x0A, 0x05, 1}); len(units) != 0 {
+		t.Errorf("a truncated OBU shouldn't be returned, got %v", units)
+	}
+}
+
+// rtpStream sends the frames through the clock.
+type rtpStream struct {
+	clock rtpClock
+}
+
+// write returns the RTP timestamp of the frame (since the first one).
+func (s *rtpStream) write(ts time.Duration, d time.Duration) uint32 {
+	return s.clock.timestamp(ts, d)
+}
+
+func (s *rtpStream) time(rtp uint32) time.Duration {
+	return time.Duration(float64(rtp) / s.clock.rate * float64(time.Second))
+}
+
+// Tests 30 minutes of the NES video with the jittery frame durations
+// and the lost frames against the audio of the same media time.
+func TestRTPClockDrift(t *testing.T) {
+	fps, minutes := 60.0988, 30.0
+	audioFrame := 20 * time.Millisecond
+	random := rand.New(rand.NewSource(1))
+	video, audio := rtpStream{clock: rtpClock{rate: videoClockRate}}, rtpStream{clock: rtpClock{rate: audioClockRate}}
+
+	var worst time.Duration
+	check := func(what string, drift time.Duration) {
+		if drift < 0 {
+			drift = -drift
+		}
+		if drift > worst {
+			worst = drift
+		}
+		if drift >= audioFrame {
+			t.Fatalf("%v drift %v", what, drift)
+		}
+	}
+	var lastVideo, lastAudio time.Duration
+	var rtpVideo, rtpAudio uint32
+	next := time.Duration(0)
+	frameTime := time.Duration(float64(time.Second) / fps)
+	for i := 0; i < int(minutes*60*fps); i++ {
+		ts := time.Duration(float64(i) / fps * float64(time.Second))
+		// the audio frames up to the video frame
+		for ; next <= ts; next += audioFrame {
+			if random.Intn(100) == 0 {
+				continue
+			}
+			rtpAudio, lastAudio = audio.write(next, audioFrame), next
+			check("audio", audio.time(rtpAudio)-lastAudio)
+		}
+		// the skipped frames
+		if random.Intn(50) == 0 {
+			continue
+		}
+		// the wall time between the frames
+		d := frameTime + time.Duration(random.Intn(4000)-2000)*time.Microsecond
+		rtpVideo, lastVideo = video.write(ts, d), ts
+		check("video", video.time(rtpVideo)-lastVideo)
+	}
+	check("A/V", (video.time(rtpVideo)-audio.time(rtpAudio))-(lastVideo-lastAudio))
+	t.Logf("the worst drift is %v", worst)
+}
+
+func TestRTPClockRestart(t *testing.T) {
+	s := rtpStream{clock: rtpClock{rate: audioClockRate}}
+	frame := 20 * time.Millisecond
+	var last uint32
+	for i, ts := range []time.Duration{0, 20, 40, 60, 0, 20, 40, 500, 520} {
+		rtp := s.write(ts*time.Millisecond, frame)
+		if i > 0 && rtp <= last {
+			t.Fatalf("frame %v: the RTP timestamp %v doesn't go on after %v", i, rtp, last)
+		}
+		last = rtp
+	}
+	// the restart goes on from 80ms, so the last frame is at 80+520ms
+	if expected := uint32((80 + 520) * audioClockRate / 1000); last != expected {
+		t.Errorf("wrong RTP timestamp %v, expected %v", last, expected)
+	}
+
+	// the frames without the media time go by their durations
+	s = rtpStream{clock: rtpClock{rate: videoClockRate}}
+	for i := 0; i < 10; i++ {
+		last = s.write(0, time.Second/60)
+	}
+	if last != 9*1500 {
+		t.Errorf("wrong RTP timestamp of the frames without the time %v", last)
+	}
+}
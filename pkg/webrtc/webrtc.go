@@ -3,14 +3,20 @@ package webrtc
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
 	webrtcConfig "github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
+	stream "github.com/giongto35/cloud-game/v2/pkg/media"
 	"github.com/gofrs/uuid"
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
 	"github.com/pion/webrtc/v3/pkg/media"
 )
@@ -18,11 +24,47 @@ import (
 type WebFrame struct {
 	Data     []byte
 	Duration time.Duration
+	// Timestamp is the media time of the frame,
+	// the RTP timestamps of the video follow it
+	Timestamp time.Duration
+	// Release gives the data back to its owner after the write (may be nil)
+	Release func()
+}
+
+// AudioFrame is an encoded audio frame of the stream.
+type AudioFrame struct {
+	Data []byte
+	// Timestamp is the media time of the frame (the same clock as the video),
+	// the RTP timestamps of the audio follow it
+	Timestamp time.Duration
+	// Duration is the duration of the frame,
+	// the frame duration of the audio config if zero
+	Duration time.Duration
 }
 
 // WebRTC connection
 type WebRTC struct {
+	// media frame counters,
+	// should be 64-bit aligned for atomic access
+	videoFrames  uint64
+	videoDropped uint64
+	audioFrames  uint64
+	audioDropped uint64
+	// the connection quality stats
+	stats connectionStats
+	// the audio volume settings of the peer,
+	// quiet is 100 - volume so the zero value is the full volume
+	quiet uint32
+	muted uint32
+	// 1 while the broken ICE connection is being restarted
+	restarting uint32
+
 	ID string
+	// User identifies the peer between its connections (i.e. the browser session)
+	User string
+	// Profile is the user ID of the peer signed by the coordinator,
+	// the peer gets the preferences of the user profile, empty -- anonymous
+	Profile string
 
 	connection        *webrtc.PeerConnection
 	cfg               webrtcConfig.Config
@@ -30,17 +72,72 @@ type WebRTC struct {
 	isConnected       bool
 	// for yuvI420 image
 	ImageChannel chan WebFrame
-	AudioChannel chan []byte
+	AudioChannel chan AudioFrame
 	//VoiceInChannel  chan []byte
 	//VoiceOutChannel chan []byte
 	InputChannel chan []byte
+	// ControlChannel gets the control commands of the peer (save, load, etc.)
+	ControlChannel chan []byte
 
 	Done bool
 
 	RoomID      string
 	PlayerIndex int
+	// Spectator only watches the game and has no control over it
+	Spectator bool
+
+	// keyMapping is the current KeyMapping of the user input
+	keyMapping atomic.Value
+
+	// the video track and its codec,
+	// the codecs supported by both sides after the SDP answer
+	mu          sync.RWMutex
+	videoSender *webrtc.RTPSender
+	videoTrack  videoTrack
+	videoCodec  codec.VideoCodec
+	codecs      []codec.VideoCodec
+	// the data channel of the control commands
+	control *webrtc.DataChannel
+	// controlOpen is set when the control channel opens,
+	// onControlOpen is called then
+	controlOpen   bool
+	onControlOpen func()
+
+	// bandwidth estimates the peer bandwidth from its RTCP feedback
+	bandwidth *bandwidthEstimator
+	// onKeyframe is a func() called when the peer needs a keyframe
+	onKeyframe atomic.Value
+	// onRestart is a func(offer string) sending the SDP offer
+	// of the ICE restart to the peer
+	onRestart atomic.Value
+	// restartTimer drops the peer if the ICE restart takes too long,
+	// guarded by mu
+	restartTimer *time.Timer
+	// onGone is a func() called when the broken connection of the peer
+	// hasn't come back for the seat timeout
+	onGone atomic.Value
+	// seatTimer releases the seat of the peer, guarded by mu
+	seatTimer *time.Timer
+	// the interval of the connection stats updates, statsInterval if 0
+	statsEvery time.Duration
+
+	// streamLock guards the media channels against sends after they are closed
+	streamLock sync.RWMutex
+	stopped    bool
+	// the watches of the media channels the peer doesn't take,
+	// onStall is called with the media of the stalled channel
+	videoStall *stream.SendWatch
+	audioStall *stream.SendWatch
+	onStall    func(kind string)
 }
 
+var errNoControl = errors.New("no control channel")
+
+// KeyMapping maps the (retro) button ids of the user input
+// to some other button ids, e.g. {0: 8, 8: 0} swaps A and B.
+// An empty mapping leaves the input as is.
+type KeyMapping map[uint8]uint8
+
 type OnIceCallback func(candidate string)
 
 // Encode encodes the input in base64
@@ -74,11 +171,13 @@ func NewWebRTC(conf webrtcConfig.Config) (*WebRTC, error) {
 		ID: uuid.Must(uuid.NewV4()).String(),
 
 		ImageChannel: make(chan WebFrame, 30),
-		AudioChannel: make(chan []byte, 1),
+		AudioChannel: make(chan AudioFrame, 1),
 		//VoiceInChannel:  make(chan []byte, 1),
 		//VoiceOutChannel: make(chan []byte, 1),
-		InputChannel: make(chan []byte, 100),
-		cfg:          conf,
+		InputChannel:   make(chan []byte, 100),
+		ControlChannel: make(chan []byte, 10),
+		cfg:            conf,
+		bandwidth:      newBandwidthEstimator(conf.Encoder.Video.Bitrate.Max),
 	}
 	conn, err := DefaultPeerConnection(w.cfg.Webrtc)
 	if err != nil {
@@ -88,6 +187,12 @@ func NewWebRTC(conf webrtcConfig.Config) (*WebRTC, error) {
 	return w, nil
 }
 
+// SetICEServers replaces the ICE servers of the config (i.e. with the credentials of the session),
+// it should be called before StartClient.
+func (w *WebRTC) SetICEServers(servers []webrtcConfig.IceServer) {
+	w.defaultConnection.SetICEServers(servers)
+}
+
 // StartClient start webrtc
 func (w *WebRTC) StartClient(iceCB OnIceCallback) (string, error) {
 	defer func() {
@@ -97,7 +202,7 @@ func (w *WebRTC) StartClient(iceCB OnIceCallback) (string, error) {
 		}
 	}()
 	var err error
-	var videoTrack *webrtc.TrackLocalStaticSample
+	var videoTrack videoTrack
 
 	// reset client
 	if w.isConnected {
@@ -112,26 +217,34 @@ func (w *WebRTC) StartClient(iceCB OnIceCallback) (string, error) {
 		return "", nil
 	}
 
-	// add video track
-	rtpCodec := webrtc.RTPCodecCapability{MimeType: w.getVideoCodec()}
-	if videoTrack, err = webrtc.NewTrackLocalStaticSample(rtpCodec, "video", "game-video"); err != nil {
+	// add video track,
+	// the offer has all the video codecs and the room switches
+	// the track to the one it has chosen
+	defaultCodec := codec.VideoCodec(w.cfg.Encoder.Video.Codec)
+	if videoTrack, err = newVideoTrack(defaultCodec); err != nil {
 		return "", err
 	}
 
-	if _, err = w.connection.AddTrack(videoTrack); err != nil {
+	videoSender, err := w.connection.AddTrack(videoTrack)
+	if err != nil {
 		return "", err
 	}
+	w.mu.Lock()
+	w.videoSender, w.videoTrack, w.videoCodec = videoSender, videoTrack, defaultCodec
+	w.mu.Unlock()
+	go w.readRTCP(videoSender, webrtc.RTPCodecTypeVideo)
 	log.Println("Add video track")
 
 	// add audio track
-	opusTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "game-audio")
+	opusTrack, err := newAudioTrack()
 	if err != nil {
 		return "", err
 	}
-	_, err = w.connection.AddTrack(opusTrack)
+	audioSender, err := w.connection.AddTrack(opusTrack)
 	if err != nil {
 		return "", err
 	}
+	go w.readRTCP(audioSender, webrtc.RTPCodecTypeAudio)
 
 	//_, err = w.connection.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RtpTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
 
@@ -147,32 +260,62 @@ func (w *WebRTC) StartClient(iceCB OnIceCallback) (string, error) {
 	})
 
 	// Register text message handling
-	inputTrack.OnMessage(func(msg webrtc.DataChannelMessage) {
-		// TODO: Can add recover here
-		w.InputChannel <- msg.Data
-	})
+	inputTrack.OnMessage(func(msg webrtc.DataChannelMessage) { w.receiveInput(msg.Data) })
 
 	inputTrack.OnClose(func() {
 		log.Println("Data channel closed")
 		log.Println("Closed webrtc")
 	})
 
+	// create data channel for the control commands (hotkeys),
+	// the commands don't wait behind the game input
+	control, err := w.connection.CreateDataChannel("control", nil)
+	if err != nil {
+		return "", err
+	}
+	control.OnMessage(func(msg webrtc.DataChannelMessage) { w.receiveControl(msg.Data) })
+	control.OnOpen(w.openControl)
+	w.mu.Lock()
+	w.control = control
+	w.mu.Unlock()
+
 	// WebRTC state callback
+	conn := w.connection
 	w.connection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
 		log.Printf("ICE Connection State has changed: %s\n", connectionState.String())
-		if connectionState == webrtc.ICEConnectionStateConnected {
+		switch connectionState {
+		case webrtc.ICEConnectionStateConnected:
 			go func() {
+				// the streams are still there after the ICE restart
+				if w.restarted() {
+					log.Printf("ICE restart of the peer %v has been completed", w.ID)
+					w.requestKeyframe()
+					return
+				}
 				w.isConnected = true
 				log.Println("ConnectionStateConnected")
-				w.startStreaming(videoTrack, opusTrack)
+				w.startStreaming(opusTrack)
+				// new or restarted ICE connection
+				w.requestKeyframe()
+				go w.pollStats(conn, w.statsEvery)
 			}()
-
-		}
-		if connectionState == webrtc.ICEConnectionStateFailed || connectionState == webrtc.ICEConnectionStateClosed || connectionState == webrtc.ICEConnectionStateDisconnected {
+		case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateDisconnected:
+			go w.restartIce(conn)
+		case webrtc.ICEConnectionStateClosed:
 			w.StopClient()
 		}
 	})
 
+	// the seat of the peer goes after its connection
+	w.connection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			w.keepSeat()
+		case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed:
+			w.watchSeat()
+		}
+	})
+
 	w.connection.OnICECandidate(func(iceCandidate *webrtc.ICECandidate) {
 		if iceCandidate != nil {
 			log.Println("OnIceCandidate:", iceCandidate.ToJSON().Candidate)
@@ -229,21 +372,297 @@ func (w *WebRTC) StartClient(iceCB OnIceCallback) (string, error) {
 	return localSession, nil
 }
 
-func (w *WebRTC) getVideoCodec() string {
-	switch w.cfg.Encoder.Video.Codec {
-	case string(codec.H264):
-		return webrtc.MimeTypeH264
-	case string(codec.VPX):
-		return webrtc.MimeTypeVP8
+// OnRestartOffer sets the handler sending the SDP offer of the ICE restart
+// to the peer, the peer should answer it as the first offer.
+// Without the handler the broken connections are closed right away.
+func (w *WebRTC) OnRestartOffer(fn func(offer string)) { w.onRestart.Store(fn) }
+
+// IsRestarting tells if the broken ICE connection of the peer is being restarted.
+// The peer is neither connected nor gone during the restart.
+func (w *WebRTC) IsRestarting() bool { return atomic.LoadUint32(&w.restarting) == 1 }
+
+// restartIce tries to restore the broken (disconnected or failed) connection
+// of the peer with a new offer of ICE restart.
+// The peer is stopped if the restart is disabled, fails or takes
+// longer than the configured timeout.
+func (w *WebRTC) restartIce(conn *webrtc.PeerConnection) {
+	if w.IsRestarting() {
+		return
+	}
+	timeout := w.cfg.Webrtc.IceRestartTimeout
+	send, _ := w.onRestart.Load().(func(string))
+	if timeout <= 0 || send == nil || !w.isConnected {
+		w.StopClient()
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&w.restarting, 0, 1) {
+		return
+	}
+	w.isConnected = false
+
+	offer, err := conn.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err == nil {
+		err = conn.SetLocalDescription(offer)
+	}
+	var sdp string
+	if err == nil {
+		sdp, err = Encode(offer)
+	}
+	if err != nil {
+		log.Printf("error: couldn't restart ICE of the peer %v, %v", w.ID, err)
+		w.StopClient()
+		return
+	}
+
+	w.mu.Lock()
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		w.mu.Lock()
+		expired := w.restartTimer == timer
+		w.mu.Unlock()
+		if expired && w.IsRestarting() {
+			log.Printf("warn: ICE restart of the peer %v has timed out after %v", w.ID, timeout)
+			w.StopClient()
+		}
+	})
+	w.restartTimer = timer
+	w.mu.Unlock()
+
+	log.Printf("Restarting ICE of the peer %v", w.ID)
+	send(sdp)
+}
+
+// OnGone sets the handler of the peer which has been disconnected
+// for the seat timeout (i.e. the closed tab), the room releases its seat.
+// It's not called for the peers coming back within the timeout (or with the ICE restart)
+// and the peers closed on purpose.
+func (w *WebRTC) OnGone(fn func()) { w.onGone.Store(fn) }
+
+// watchSeat starts the seat timeout of the disconnected peer,
+// the timeout goes on while the ICE of the peer is being restarted.
+func (w *WebRTC) watchSeat() {
+	timeout := w.cfg.Webrtc.SeatTimeout
+	gone, _ := w.onGone.Load().(func())
+	if timeout <= 0 || gone == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seatTimer != nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		w.mu.Lock()
+		expired := w.seatTimer == timer
+		if expired {
+			w.seatTimer = nil
+		}
+		w.mu.Unlock()
+		if !expired || w.isConnected {
+			return
+		}
+		if w.IsRestarting() {
+			w.watchSeat()
+			return
+		}
+		log.Printf("warn: the peer %v has been disconnected for %v, releasing its seat", w.ID, timeout)
+		gone()
+	})
+	w.seatTimer = timer
+}
+
+// keepSeat stops the seat timeout of the peer which has come back.
+func (w *WebRTC) keepSeat() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seatTimer != nil {
+		w.seatTimer.Stop()
+		w.seatTimer = nil
+	}
+}
+
+// restarted ends the ICE restart of the peer
+// and tells if there was one.
+func (w *WebRTC) restarted() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !atomic.CompareAndSwapUint32(&w.restarting, 1, 0) {
+		return false
+	}
+	if w.restartTimer != nil {
+		w.restartTimer.Stop()
+		w.restartTimer = nil
+	}
+	w.isConnected = true
+	return true
+}
+
+// readRTCP reads the RTCP feedback of the peer until the connection is closed.
+// The feedback is needed for the interceptors (NACK), the bandwidth estimation
+// of the video and the connection stats.
+func (w *WebRTC) readRTCP(sender *webrtc.RTPSender, kind webrtc.RTPCodecType) {
+	var ssrc uint32
+	if encodings := sender.GetParameters().Encodings; len(encodings) > 0 {
+		ssrc = uint32(encodings[0].SSRC)
+	}
+	clockRate := float64(videoClockRate)
+	if kind == webrtc.RTPCodecTypeAudio {
+		clockRate = audioClockRate
+	}
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		w.stats.receiverReports(kind.String(), ssrc, clockRate, packets, time.Now())
+		if kind != webrtc.RTPCodecTypeVideo {
+			continue
+		}
+		w.bandwidth.feedback(packets)
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				w.requestKeyframe()
+			}
+		}
+	}
+}
+
+// OnKeyframeRequest sets the handler called when the peer needs a keyframe
+// to decode the video, i.e. after the ICE connection or a picture loss.
+func (w *WebRTC) OnKeyframeRequest(fn func()) { w.onKeyframe.Store(fn) }
+
+func (w *WebRTC) requestKeyframe() {
+	if fn, ok := w.onKeyframe.Load().(func()); ok && fn != nil {
+		fn()
+	}
+}
+
+// EstimatedBitrate returns the estimated bandwidth of the peer in kbit/s
+// or 0 if it's unknown.
+func (w *WebRTC) EstimatedBitrate() uint {
+	if w.bandwidth == nil {
+		return 0
+	}
+	return w.bandwidth.bitrate()
+}
+
+// VideoCodecs returns the video codecs accepted by the peer in its SDP answer.
+func (w *WebRTC) VideoCodecs() []codec.VideoCodec {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.codecs
+}
+
+// VideoCodec returns the codec of the video track.
+func (w *WebRTC) VideoCodec() codec.VideoCodec {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.videoCodec
+}
+
+// SetVideoCodec replaces the video track with a track of the codec.
+// The codec should be one of the negotiated codecs.
+func (w *WebRTC) SetVideoCodec(c codec.VideoCodec) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if c == w.videoCodec {
+		return nil
+	}
+	if w.videoSender == nil {
+		w.videoCodec = c
+		return nil
+	}
+	track, err := newVideoTrack(c)
+	if err != nil {
+		return err
+	}
+	if err = w.videoSender.ReplaceTrack(track); err != nil {
+		return fmt.Errorf("couldn't switch the video codec to %v, %v", c, err)
+	}
+	w.videoTrack, w.videoCodec = track, c
+	return nil
+}
+
+func (w *WebRTC) getVideoTrack() videoTrack {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.videoTrack
+}
+
+// negotiatedCodecs returns the video codecs of the sender
+// after the remote SDP has been set.
+func (w *WebRTC) negotiatedCodecs() (codecs []codec.VideoCodec) {
+	w.mu.RLock()
+	sender := w.videoSender
+	w.mu.RUnlock()
+	if sender == nil {
+		return
+	}
+	seen := map[codec.VideoCodec]bool{}
+	for _, params := range sender.GetParameters().Codecs {
+		if c := videoCodec(params.MimeType); c != "" && !seen[c] {
+			seen[c] = true
+			codecs = append(codecs, c)
+		}
+	}
+	return
+}
+
+// SetRoom attaches the peer to the room with the ID, empty -- detaches it.
+func (w *WebRTC) SetRoom(roomID string) { w.RoomID = roomID }
+
+func (w *WebRTC) GetId() string { return w.ID }
+
+func (w *WebRTC) GetUser() string { return w.User }
+
+func (w *WebRTC) SetUser(user string) { w.User = user }
+
+func (w *WebRTC) GetProfile() string { return w.Profile }
+
+func (w *WebRTC) SetProfile(profile string) { w.Profile = profile }
+
+func (w *WebRTC) GetPlayerIndex() int { return w.PlayerIndex }
+
+func (w *WebRTC) SetPlayerIndex(index int) { w.PlayerIndex = index }
+
+func (w *WebRTC) IsSpectator() bool { return w.Spectator }
+
+func (w *WebRTC) SetSpectator(spectator bool) { w.Spectator = spectator }
+
+// IsDone tells if the peer has finished its input.
+func (w *WebRTC) IsDone() bool { return w.Done }
+
+// receiveInput passes the input message of the data channel to the room without blocking,
+// the input of the spectators and the input the room doesn't take are dropped,
+// so they never hold the data channel.
+func (w *WebRTC) receiveInput(data []byte) {
+	if w.IsSpectator() {
+		return
+	}
+	select {
+	case w.InputChannel <- data:
 	default:
-		return webrtc.MimeTypeH264
 	}
 }
 
-func (w *WebRTC) AttachRoomID(roomID string) {
-	w.RoomID = roomID
+// receiveControl passes the control command of the data channel to the room without blocking,
+// the commands over the queue go without the replies.
+func (w *WebRTC) receiveControl(data []byte) {
+	select {
+	case w.ControlChannel <- data:
+	default:
+		log.Printf("warn: the control commands of the peer %v are dropped", w.ID)
+	}
 }
 
+// GetInputChannel returns the channel of the input messages of the peer.
+func (w *WebRTC) GetInputChannel() <-chan []byte { return w.InputChannel }
+
+// GetControlChannel returns the channel of the control commands of the peer.
+func (w *WebRTC) GetControlChannel() <-chan []byte { return w.ControlChannel }
+
 func (w *WebRTC) SetRemoteSDP(remoteSDP string) error {
 	var answer webrtc.SessionDescription
 	err := Decode(remoteSDP, &answer)
@@ -258,7 +677,11 @@ func (w *WebRTC) SetRemoteSDP(remoteSDP string) error {
 		return err
 	}
 
-	log.Println("Set Remote Description")
+	codecs := w.negotiatedCodecs()
+	w.mu.Lock()
+	w.codecs = codecs
+	w.mu.Unlock()
+	log.Printf("Set Remote Description, video codecs: %v", codecs)
 	return nil
 }
 
@@ -283,8 +706,9 @@ func (w *WebRTC) AddCandidate(candidate string) error {
 
 // StopClient disconnect
 func (w *WebRTC) StopClient() {
+	restarting := atomic.SwapUint32(&w.restarting, 0) == 1
 	// if stopped, bypass
-	if !w.isConnected {
+	if !w.isConnected && !restarting {
 		return
 	}
 
@@ -298,8 +722,11 @@ func (w *WebRTC) StopClient() {
 	//close(w.InputChannel)
 	// webrtc is producer, so we close
 	// NOTE: ImageChannel is waiting for input. Close in writer is not correct for this
+	w.streamLock.Lock()
+	w.stopped = true
 	close(w.ImageChannel)
 	close(w.AudioChannel)
+	w.streamLock.Unlock()
 	//close(w.VoiceInChannel)
 	//close(w.VoiceOutChannel)
 	log.Println("===StopClient===")
@@ -307,7 +734,153 @@ func (w *WebRTC) StopClient() {
 
 func (w *WebRTC) IsConnected() bool { return w.isConnected }
 
-func (w *WebRTC) startStreaming(vp8Track *webrtc.TrackLocalStaticSample, opusTrack *webrtc.TrackLocalStaticSample) {
+// OnControlOpen sets the handler of the opened control channel of the peer,
+// it's called right away if the channel is open.
+func (w *WebRTC) OnControlOpen(fn func()) {
+	w.mu.Lock()
+	open := w.controlOpen
+	if !open {
+		w.onControlOpen = fn
+	}
+	w.mu.Unlock()
+	if open {
+		fn()
+	}
+}
+
+func (w *WebRTC) openControl() {
+	w.mu.Lock()
+	w.controlOpen = true
+	fn := w.onControlOpen
+	w.onControlOpen = nil
+	w.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// SendControl sends the reply to a control command of the peer.
+func (w *WebRTC) SendControl(data []byte) error {
+	w.mu.RLock()
+	control := w.control
+	w.mu.RUnlock()
+	if control == nil {
+		return errNoControl
+	}
+	return control.SendText(string(data))
+}
+
+// SetKeyMapping replaces the user input key mapping.
+// The mapping shouldn't be modified after that.
+func (w *WebRTC) SetKeyMapping(mapping KeyMapping) { w.keyMapping.Store(mapping) }
+
+// GetKeyMapping returns the current user input key mapping.
+func (w *WebRTC) GetKeyMapping() KeyMapping {
+	mapping, _ := w.keyMapping.Load().(KeyMapping)
+	return mapping
+}
+
+// SendVideo puts a video frame into the stream queue without blocking.
+// If the queue is full the frame is dropped and false is returned.
+// The frames of the stopped peers are dropped as well.
+// The dropped frames are not released, it's up to the caller.
+func (w *WebRTC) SendVideo(frame WebFrame) bool {
+	w.streamLock.RLock()
+	defer w.streamLock.RUnlock()
+	if w.stopped {
+		return false
+	}
+	atomic.AddUint64(&w.videoFrames, 1)
+	select {
+	case w.ImageChannel <- frame:
+		w.videoStall.Sent()
+		return true
+	default:
+		atomic.AddUint64(&w.videoDropped, 1)
+		if w.videoStall.Full() {
+			w.onStall("video")
+		}
+		return false
+	}
+}
+
+// SendAudio puts an audio frame into the stream queue without blocking.
+// If the queue is full the frame is dropped and false is returned.
+func (w *WebRTC) SendAudio(frame AudioFrame) bool {
+	w.streamLock.RLock()
+	defer w.streamLock.RUnlock()
+	if w.stopped {
+		return false
+	}
+	atomic.AddUint64(&w.audioFrames, 1)
+	select {
+	case w.AudioChannel <- frame:
+		w.audioStall.Sent()
+		return true
+	default:
+		atomic.AddUint64(&w.audioDropped, 1)
+		if w.audioStall.Full() {
+			w.onStall("audio")
+		}
+		return false
+	}
+}
+
+// OnStall sets the handler of the media channels of the peer which have been full
+// for the threshold (the peer doesn't take its media), kind is video or audio.
+// The handler is called with the media sends, so it shouldn't block.
+func (w *WebRTC) OnStall(threshold time.Duration, fn func(kind string)) {
+	w.streamLock.Lock()
+	defer w.streamLock.Unlock()
+	if fn == nil {
+		threshold = 0
+	}
+	w.videoStall, w.audioStall, w.onStall = stream.NewSendWatch(threshold), stream.NewSendWatch(threshold), fn
+}
+
+// MaxVolume is the full (unchanged) audio volume of the peers.
+const MaxVolume = 100
+
+// SetVolume changes the audio volume (0-100) of the peer,
+// the values out of the range are clamped.
+func (w *WebRTC) SetVolume(volume int) {
+	if volume < 0 {
+		volume = 0
+	}
+	if volume > MaxVolume {
+		volume = MaxVolume
+	}
+	atomic.StoreUint32(&w.quiet, uint32(MaxVolume-volume))
+}
+
+// Volume returns the audio volume (0-100) of the peer.
+func (w *WebRTC) Volume() int { return MaxVolume - int(atomic.LoadUint32(&w.quiet)) }
+
+// SetMuted turns off or on the audio of the peer keeping its volume.
+func (w *WebRTC) SetMuted(muted bool) {
+	var v uint32
+	if muted {
+		v = 1
+	}
+	atomic.StoreUint32(&w.muted, v)
+}
+
+// Muted tells if the peer doesn't get any audio.
+func (w *WebRTC) Muted() bool { return atomic.LoadUint32(&w.muted) == 1 }
+
+// VideoFrames returns the total number of video frames sent to the peer (including dropped).
+func (w *WebRTC) VideoFrames() uint64 { return atomic.LoadUint64(&w.videoFrames) }
+
+// DroppedVideoFrames returns the number of video frames dropped because the peer was too slow.
+func (w *WebRTC) DroppedVideoFrames() uint64 { return atomic.LoadUint64(&w.videoDropped) }
+
+// AudioFrames returns the total number of audio frames sent to the peer (including dropped).
+func (w *WebRTC) AudioFrames() uint64 { return atomic.LoadUint64(&w.audioFrames) }
+
+// DroppedAudioFrames returns the number of audio frames dropped because the peer was too slow.
+func (w *WebRTC) DroppedAudioFrames() uint64 { return atomic.LoadUint64(&w.audioDropped) }
+
+func (w *WebRTC) startStreaming(opusTrack sampleWriter) {
 	log.Println("Start streaming")
 	// receive frame buffer
 	go func() {
@@ -318,11 +891,23 @@ func (w *WebRTC) startStreaming(vp8Track *webrtc.TrackLocalStaticSample, opusTra
 			}
 		}()
 
+		clock := rtpClock{rate: videoClockRate}
 		for data := range w.ImageChannel {
-			if err := vp8Track.WriteSample(media.Sample{Data: data.Data, Duration: data.Duration}); err != nil {
+			ts := clock.timestamp(data.Timestamp, data.Duration)
+			err := w.getVideoTrack().WriteSample(media.Sample{Data: data.Data, Duration: data.Duration, PacketTimestamp: ts})
+			size := len(data.Data)
+			if data.Release != nil {
+				data.Release()
+			}
+			if err != nil {
+				// the frames queued before the ICE restart
+				if w.IsRestarting() {
+					continue
+				}
 				log.Println("Warn: Err write sample: ", err)
 				break
 			}
+			atomic.AddUint64(&w.stats.videoBytes, uint64(size))
 		}
 	}()
 
@@ -335,15 +920,30 @@ func (w *WebRTC) startStreaming(vp8Track *webrtc.TrackLocalStaticSample, opusTra
 			}
 		}()
 
-		audioDuration := time.Duration(w.cfg.Encoder.Audio.Frame) * time.Millisecond
+		frame := w.cfg.Encoder.Audio.Frame
+		if frame <= 0 {
+			frame = encoderConfig.DefaultAudioFrame
+		}
+		audioDuration := time.Duration(frame) * time.Millisecond
+		clock := rtpClock{rate: audioClockRate}
 		for data := range w.AudioChannel {
 			if !w.isConnected {
+				if w.IsRestarting() {
+					continue
+				}
 				return
 			}
-			err := opusTrack.WriteSample(media.Sample{Data: data, Duration: audioDuration})
+			duration := data.Duration
+			if duration <= 0 {
+				duration = audioDuration
+			}
+			ts := clock.timestamp(data.Timestamp, duration)
+			err := opusTrack.WriteSample(media.Sample{Data: data.Data, Duration: duration, PacketTimestamp: ts})
 			if err != nil {
 				log.Println("Warn: Err write sample: ", err)
+				continue
 			}
+			atomic.AddUint64(&w.stats.audioBytes, uint64(len(data.Data)))
 		}
 	}()
 
@@ -0,0 +1,411 @@
+package webrtc
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	webrtcConfig "github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
+	"github.com/pion/webrtc/v3"
+)
+
+// Tests that a peer which doesn't read its video stream
+// doesn't delay frame delivery to the other peers.
+func TestSendVideoWithStalledPeer(t *testing.T) {
+	frames := 300
+	stalled := &WebRTC{ID: "stalled", ImageChannel: make(chan WebFrame, 30)}
+	healthy := &WebRTC{ID: "healthy", ImageChannel: make(chan WebFrame, 30)}
+
+	received := 0
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range healthy.ImageChannel {
+			received++
+		}
+	}()
+
+	interval := time.Millisecond
+	start := time.Now()
+	for i := 0; i < frames; i++ {
+		for _, peer := range []*WebRTC{stalled, healthy} {
+			peer.SendVideo(WebFrame{Data: []byte{byte(i)}})
+		}
+		time.Sleep(interval)
+	}
+	elapsed := time.Since(start)
+	close(healthy.ImageChannel)
+	wg.Wait()
+
+	if max := time.Duration(frames) * interval * 3; elapsed > max {
+		t.Errorf("the fan-out took too long %v > %v", elapsed, max)
+	}
+	if received != frames {
+		t.Errorf("the healthy peer has received %v frames instead of %v", received, frames)
+	}
+	if healthy.DroppedVideoFrames() != 0 {
+		t.Errorf("the healthy peer has dropped %v frames", healthy.DroppedVideoFrames())
+	}
+	if dropped := uint64(frames - cap(stalled.ImageChannel)); stalled.DroppedVideoFrames() != dropped {
+		t.Errorf("the stalled peer has dropped %v frames instead of %v", stalled.DroppedVideoFrames(), dropped)
+	}
+	if stalled.VideoFrames() != uint64(frames) || healthy.VideoFrames() != uint64(frames) {
+		t.Errorf("wrong number of sent frames: %v, %v", stalled.VideoFrames(), healthy.VideoFrames())
+	}
+}
+
+func TestSendAudioDrop(t *testing.T) {
+	w := &WebRTC{AudioChannel: make(chan AudioFrame, 1)}
+	if !w.SendAudio(AudioFrame{Data: []byte{1}}) {
+		t.Errorf("the first audio frame should be queued")
+	}
+	if w.SendAudio(AudioFrame{Data: []byte{2}}) {
+		t.Errorf("the second audio frame should be dropped")
+	}
+	if w.AudioFrames() != 2 || w.DroppedAudioFrames() != 1 {
+		t.Errorf("wrong audio counters: %v/%v", w.DroppedAudioFrames(), w.AudioFrames())
+	}
+}
+
+// Tests that the input nobody takes doesn't block the data channel.
+func TestReceiveInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		spectator bool
+		queued    int
+	}{
+		{name: "player", queued: 1},
+		{name: "spectator", spectator: true},
+	}
+	for _, test := range tests {
+		w := &WebRTC{InputChannel: make(chan []byte, 1), Spectator: test.spectator}
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 3; i++ {
+				w.receiveInput([]byte{byte(i)})
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%v: the input has blocked the data channel", test.name)
+		}
+		if n := len(w.InputChannel); n != test.queued {
+			t.Errorf("%v: %v queued input messages, expected %v", test.name, n, test.queued)
+		}
+	}
+}
+
+// Tests that the control commands over the queue don't block the data channel.
+func TestReceiveControl(t *testing.T) {
+	w := &WebRTC{ControlChannel: make(chan []byte, 1)}
+	done := make(chan struct{})
+	go func() {
+		w.receiveControl([]byte("1"))
+		w.receiveControl([]byte("2"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("the control command has blocked the data channel")
+	}
+	if cmd := <-w.ControlChannel; string(cmd) != "1" {
+		t.Errorf("wrong control command %s", cmd)
+	}
+}
+
+// Tests that the peer which doesn't take its media
+// is reported once its channels have been full for the stall threshold.
+func TestSendStall(t *testing.T) {
+	const threshold = 20 * time.Millisecond
+	w := &WebRTC{ImageChannel: make(chan WebFrame, 1), AudioChannel: make(chan AudioFrame, 1)}
+	stalls := make(chan string, 10)
+	start := time.Now()
+	w.OnStall(threshold, func(kind string) { stalls <- kind })
+
+	got := map[string]time.Duration{}
+	for deadline := time.Now().Add(5 * time.Second); len(got) < 2 && time.Now().Before(deadline); {
+		w.SendVideo(WebFrame{})
+		w.SendAudio(AudioFrame{})
+		select {
+		case kind := <-stalls:
+			got[kind] = time.Since(start)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	for _, kind := range []string{"video", "audio"} {
+		d, ok := got[kind]
+		if !ok {
+			t.Errorf("the %v stall hasn't been reported", kind)
+			continue
+		}
+		if d < threshold || d > time.Second {
+			t.Errorf("the %v stall has been reported after %v, expected %v", kind, d, threshold)
+		}
+	}
+
+	// the peer takes its media again
+	<-w.ImageChannel
+	w.SendVideo(WebFrame{})
+	for i := 0; i < 10; i++ {
+		w.SendVideo(WebFrame{})
+	}
+	if len(stalls) != 0 {
+		t.Errorf("the stall has been reported again, %v", <-stalls)
+	}
+}
+
+// Tests that the media sends racing with the peer stop don't panic.
+func TestSendAfterStop(t *testing.T) {
+	w := &WebRTC{ImageChannel: make(chan WebFrame, 30), AudioChannel: make(chan AudioFrame, 1), isConnected: true}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			w.SendVideo(WebFrame{Data: []byte{byte(i)}})
+			w.SendAudio(AudioFrame{Data: []byte{byte(i)}})
+		}
+	}()
+	w.StopClient()
+	wg.Wait()
+
+	if w.SendVideo(WebFrame{}) || w.SendAudio(AudioFrame{}) {
+		t.Errorf("the stopped peer shouldn't get frames")
+	}
+}
+
+func TestVolume(t *testing.T) {
+	w := &WebRTC{}
+	if w.Volume() != MaxVolume || w.Muted() {
+		t.Errorf("the new peers should have the full volume, %v, muted: %v", w.Volume(), w.Muted())
+	}
+	for volume, want := range map[int]int{50: 50, 0: 0, -10: 0, 120: MaxVolume} {
+		w.SetVolume(volume)
+		if w.Volume() != want {
+			t.Errorf("wrong volume %v for %v, expected %v", w.Volume(), volume, want)
+		}
+	}
+	w.SetVolume(30)
+	w.SetMuted(true)
+	if !w.Muted() || w.Volume() != 30 {
+		t.Errorf("the mute shouldn't change the volume, %v", w.Volume())
+	}
+}
+
+// Tests that the peer with the broken ICE connection
+// gets its input back after the ICE restart.
+func TestIceRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the peer connection test is slow")
+	}
+	conf := webrtcConfig.Config{}
+	conf.Encoder.Video.Codec = string(codec.VPX)
+	conf.Encoder.Audio.Frame = 20
+	conf.Webrtc.IceRestartTimeout = 10 * time.Second
+	w, err := NewWebRTC(conf)
+	if err != nil {
+		t.Fatalf("couldn't create the peer, %v", err)
+	}
+	w.statsEvery = 50 * time.Millisecond
+	defer w.StopClient()
+
+	remote, opened := connectPeer(t, w)
+	defer func() { _ = remote.Close() }()
+	var input *webrtc.DataChannel
+	select {
+	case input = <-opened:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no input channel")
+	}
+	received := func() bool {
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+			_ = input.Send([]byte{1})
+			select {
+			case <-w.InputChannel:
+				return true
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		return false
+	}
+	if !received() {
+		t.Fatalf("no input before the ICE restart")
+	}
+	// the stats are polled after the connection
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline) && w.Stats().Updated.IsZero(); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	offers := make(chan string, 1)
+	w.OnRestartOffer(func(offer string) { offers <- offer })
+	// as the failed ICE state does
+	w.restartIce(w.connection)
+	if !w.IsRestarting() || w.IsConnected() {
+		t.Fatalf("the peer isn't restarting ICE")
+	}
+	select {
+	case offer := <-offers:
+		if err := answer(remote, w, offer); err != nil {
+			t.Fatalf("couldn't answer the ICE restart, %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no offer of the ICE restart")
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline) && w.IsRestarting(); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if w.IsRestarting() {
+		t.Fatalf("the ICE restart hasn't been completed")
+	}
+	for len(w.InputChannel) > 0 {
+		<-w.InputChannel
+	}
+	if !received() {
+		t.Errorf("no input after the ICE restart")
+	}
+	// the same video stream
+	sent := atomic.LoadUint64(&w.stats.videoBytes)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if atomic.LoadUint64(&w.stats.videoBytes) > sent {
+			return
+		}
+		w.SendVideo(WebFrame{Data: make([]byte, 500), Duration: 16 * time.Millisecond})
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("no video after the ICE restart")
+}
+
+// Tests that the peer is dropped if it doesn't answer the ICE restart in time
+// or the restart is disabled.
+func TestIceRestartTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the peer connection test is slow")
+	}
+	for _, timeout := range []time.Duration{0, 200 * time.Millisecond} {
+		conf := webrtcConfig.Config{}
+		conf.Encoder.Video.Codec = string(codec.VPX)
+		conf.Webrtc.IceRestartTimeout = timeout
+		w, err := NewWebRTC(conf)
+		if err != nil {
+			t.Fatalf("couldn't create the peer, %v", err)
+		}
+		w.statsEvery = 50 * time.Millisecond
+		remote, _ := connectPeer(t, w)
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline) && w.Stats().Updated.IsZero(); {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		w.OnRestartOffer(func(string) {})
+		w.restartIce(w.connection)
+		if timeout > 0 && !w.IsRestarting() {
+			t.Errorf("the peer isn't restarting ICE with %v timeout", timeout)
+		}
+		time.Sleep(2 * timeout)
+		if w.IsRestarting() || w.SendVideo(WebFrame{}) {
+			t.Errorf("the peer hasn't been stopped with %v ICE restart timeout", timeout)
+		}
+		_ = remote.Close()
+	}
+}
+
+// Tests that the seat of the disconnected peer is released after the seat timeout
+// unless the peer comes back or restarts its ICE.
+func TestSeatTimeout(t *testing.T) {
+	timeout := 100 * time.Millisecond
+	newPeer := func(timeout time.Duration) (*WebRTC, chan time.Duration) {
+		w := &WebRTC{ID: "peer"}
+		w.cfg.Webrtc.SeatTimeout = timeout
+		gone, start := make(chan time.Duration, 2), time.Now()
+		w.OnGone(func() { gone <- time.Since(start) })
+		return w, gone
+	}
+
+	// the closed tab
+	w, gone := newPeer(timeout)
+	w.watchSeat()
+	w.watchSeat()
+	select {
+	case after := <-gone:
+		if after < timeout || after > 10*timeout {
+			t.Errorf("the seat has been released after %v, expected %v", after, timeout)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the seat hasn't been released")
+	}
+	select {
+	case <-gone:
+		t.Errorf("the seat has been released twice")
+	case <-time.After(2 * timeout):
+	}
+
+	// the peer has come back in time
+	w, gone = newPeer(timeout)
+	w.watchSeat()
+	time.Sleep(timeout / 4)
+	w.keepSeat()
+	select {
+	case <-gone:
+		t.Errorf("the seat of the peer back has been released")
+	case <-time.After(2 * timeout):
+	}
+
+	// the peer restarting its ICE keeps its seat until the end of the restart
+	w, gone = newPeer(timeout)
+	atomic.StoreUint32(&w.restarting, 1)
+	w.watchSeat()
+	select {
+	case <-gone:
+		t.Errorf("the seat of the restarting peer has been released")
+	case <-time.After(2 * timeout):
+	}
+	atomic.StoreUint32(&w.restarting, 0)
+	select {
+	case <-gone:
+	case <-time.After(time.Second):
+		t.Errorf("the seat hasn't been released after the restart")
+	}
+
+	// the seats are kept without the timeout
+	w, gone = newPeer(0)
+	w.watchSeat()
+	select {
+	case <-gone:
+		t.Errorf("the seat has been released without the timeout")
+	case <-time.After(2 * timeout):
+	}
+}
+
+func TestSetICEServers(t *testing.T) {
+	w, err := NewWebRTC(webrtcConfig.Config{Webrtc: webrtcConfig.Webrtc{
+		IceServers: []webrtcConfig.IceServer{{Url: "stun:stun.l.google.com:19302"}},
+	}})
+	if err != nil {
+		t.Fatalf("couldn't create the connection, %v", err)
+	}
+	w.SetICEServers([]webrtcConfig.IceServer{
+		{Url: "stun:localhost:3478"},
+		{Url: "turn:localhost:3478", Username: "1600003600:user1", Credential: "secret"},
+	})
+	conn, err := w.defaultConnection.NewConnection()
+	if err != nil {
+		t.Fatalf("couldn't create the peer connection, %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	servers := conn.GetConfiguration().ICEServers
+	if len(servers) != 2 {
+		t.Fatalf("the peer connection has got the servers %v", servers)
+	}
+	turn := servers[1]
+	if turn.URLs[0] != "turn:localhost:3478" || turn.Username != "1600003600:user1" || turn.Credential != "secret" {
+		t.Errorf("the peer connection has got wrong TURN server %+v", turn)
+	}
+}
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
+)
+
+// adminRoom is the room with its stats in the admin API.
+type adminRoom struct {
+	api.RoomInfo
+	Stats api.RoomStatsResponse `json:"stats"`
+}
+
+// adminHandler serves the admin API of the rooms under the prefix:
+// the list of the rooms, the stats of a room, its events (<id>/events) and its termination.
+// The requests should have the token (Authorization: Bearer <token>).
+func adminHandler(prefix string, token string, rooms *room.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		id, sub := splitPath(id)
+		if id == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			list := make([]api.RoomInfo, 0, rooms.Len())
+			for _, rm := range rooms.List() {
+				list = append(list, roomInfo(rm.Info()))
+			}
+			writeJSON(w, list)
+			return
+		}
+
+		rm := rooms.Get(id)
+		if rm == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if sub == "events" {
+			if r.Method != http.MethodGet {
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, rm.Events())
+			return
+		}
+		if sub != "" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, adminRoom{RoomInfo: roomInfo(rm.Info()), Stats: roomStats(rm.GetStats())})
+		case http.MethodDelete:
+			log.Printf("Terminating the room %v by the admin request", id)
+			// the final save may take longer than the request
+			go func() {
+				if err := rooms.Terminate(id); err != nil {
+					log.Printf("warn: couldn't terminate the room %v, %v", id, err)
+				}
+			}()
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// splitPath splits the room path into the room ID and its resource.
+func splitPath(path string) (id string, sub string) {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+func roomInfo(info room.Info) api.RoomInfo {
+	return api.RoomInfo{
+		ID:         info.ID,
+		Game:       info.Game,
+		Uptime:     info.Uptime.Round(time.Second).Seconds(),
+		Players:    info.Players,
+		Spectators: info.Spectators,
+		MaxPlayers: info.MaxPlayers,
+		Private:    info.Private,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error: couldn't write the admin response, %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
+)
+
+func TestAdminHandler(t *testing.T) {
+	admin := adminHandler("/admin/rooms", "secret", room.NewManager())
+	tests := []struct {
+		method, path, token string
+		code                int
+		body                string
+	}{
+		{method: http.MethodGet, path: "/admin/rooms", code: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/admin/rooms", token: "wrong", code: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/admin/rooms", token: "secret", code: http.StatusOK, body: "[]"},
+		{method: http.MethodPost, path: "/admin/rooms", token: "secret", code: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/admin/rooms/x", token: "secret", code: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/admin/rooms/x", token: "secret", code: http.StatusNotFound},
+		{method: http.MethodGet, path: "/admin/rooms/x/events", token: "secret", code: http.StatusNotFound},
+		{method: http.MethodGet, path: "/admin/rooms/x/events", code: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("wrong code %v of %v %v, expected %v", w.Code, test.method, test.path, test.code)
+		}
+		if body := strings.TrimSpace(w.Body.String()); test.body != "" && body != test.body {
+			t.Errorf("wrong body %q of %v %v", body, test.method, test.path)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package admission estimates the CPU costs of the rooms of the worker
+// and keeps their total within the CPU budget of the worker.
+// The cost of a room is the cost of the emulation of its core
+// and the cost of the encoding of its viewport, the estimates of the cores
+// are scaled by the measured costs of their rooms (see Observe).
+package admission
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+)
+
+// ErrWorkerOverloaded is the error of the new rooms over the CPU budget.
+var ErrWorkerOverloaded = errors.New("the server is overloaded")
+
+const (
+	defaultUtilization  = 0.8
+	defaultCost         = 0.2
+	defaultPixelCost    = 1.0
+	defaultLearningRate = 0.2
+	// the limits of the scale of the estimates of a core
+	minScale = 0.1
+	maxScale = 10
+)
+
+// Controller admits the new rooms by their estimated costs.
+type Controller struct {
+	mu     sync.Mutex
+	conf   worker.Admission
+	budget float64
+	// the rooms by their IDs and the rooms without the IDs yet
+	rooms   map[string]*Room
+	pending map[*Room]struct{}
+	// the measured / estimated costs of the cores
+	scale map[string]float64
+}
+
+// Room is the cost of a room admitted by the controller.
+type Room struct {
+	core string
+	// the viewport in megapixels
+	area     float64
+	estimate float64
+	// the measured cost, valid after the first measure
+	cost     float64
+	measured bool
+	// the last CPU time of the room and its time
+	cpu time.Duration
+	at  time.Time
+}
+
+// New returns the controller of the config,
+// the budget is of all the CPUs without the cores in the config.
+func New(conf worker.Admission) *Controller {
+	if conf.Cores <= 0 {
+		conf.Cores = runtime.NumCPU()
+	}
+	if conf.Utilization <= 0 {
+		conf.Utilization = defaultUtilization
+	}
+	if conf.DefaultCost <= 0 {
+		conf.DefaultCost = defaultCost
+	}
+	if conf.PixelCost <= 0 {
+		conf.PixelCost = defaultPixelCost
+	}
+	if conf.LearningRate <= 0 || conf.LearningRate > 1 {
+		conf.LearningRate = defaultLearningRate
+	}
+	return &Controller{
+		conf:    conf,
+		budget:  float64(conf.Cores) * conf.Utilization,
+		rooms:   map[string]*Room{},
+		pending: map[*Room]struct{}{},
+		scale:   map[string]float64{},
+	}
+}
+
+// Enabled tells if the controller checks the new rooms.
+func (c *Controller) Enabled() bool {
+	return c != nil && (c.conf.Mode == worker.AdmissionSoft || c.conf.Mode == worker.AdmissionHard)
+}
+
+// Estimate returns the estimated cost (in cores) of a new room
+// of the core with the viewport size.
+func (c *Controller) Estimate(core string, width int, height int) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.estimate(core, megapixels(width, height))
+}
+
+// estimate returns the config estimate of the room scaled by the measures of its core.
+func (c *Controller) estimate(core string, area float64) float64 {
+	cost := c.static(core, area)
+	if scale, ok := c.scale[core]; ok {
+		cost *= scale
+	}
+	return cost
+}
+
+// static returns the estimate of the room by the config.
+func (c *Controller) static(core string, area float64) float64 {
+	cost, ok := c.conf.Costs[core]
+	if !ok {
+		cost = c.conf.DefaultCost
+	}
+	return cost + area*c.conf.PixelCost
+}
+
+// Admit reserves the estimated cost of the new room of the core
+// with the viewport size in the budget.
+// The room over the budget is rejected with ErrWorkerOverloaded in the hard mode,
+// the soft mode only logs it.
+// The admitted room should be bound to its ID (Bind) or released (Cancel).
+func (c *Controller) Admit(core string, width int, height int) (*Room, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	area := megapixels(width, height)
+	r := &Room{core: core, area: area, estimate: c.estimate(core, area)}
+	if c.Enabled() {
+		if used := c.used(); used+r.estimate > c.budget {
+			if c.conf.Mode == worker.AdmissionHard {
+				return nil, fmt.Errorf("%w (%.2f + %.2f of %.2f cores)", ErrWorkerOverloaded, used, r.estimate, c.budget)
+			}
+			log.Printf("warn: the room of %v is over the CPU budget (%.2f + %.2f of %.2f cores)",
+				core, used, r.estimate, c.budget)
+		}
+	}
+	c.pending[r] = struct{}{}
+	return r, nil
+}
+
+// Bind gives the admitted room its ID.
+func (c *Controller) Bind(r *Room, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, r)
+	c.rooms[id] = r
+}
+
+// Cancel releases the admitted room without the ID (i.e. it hasn't been made).
+func (c *Controller) Cancel(r *Room) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, r)
+}
+
+// Release releases the room with the ID.
+func (c *Controller) Release(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.rooms, id)
+}
+
+// Observe takes the total CPU time of the emulation and encoding of the room
+// at the time, the cost of the room is the CPU time since its previous observation
+// per second. The estimates of its core move to the measured cost.
+// The CPU time going back (i.e. of the restarted emulator) starts a new measure.
+func (c *Controller) Observe(id string, cpu time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.rooms[id]
+	if !ok {
+		return
+	}
+	last, lastAt := r.cpu, r.at
+	r.cpu, r.at = cpu, now
+	if lastAt.IsZero() || cpu < last || !now.After(lastAt) {
+		return
+	}
+	r.cost = (cpu - last).Seconds() / now.Sub(lastAt).Seconds()
+	r.measured = true
+
+	static := c.static(r.core, r.area)
+	if static <= 0 {
+		return
+	}
+	scale, ok := c.scale[r.core]
+	if !ok {
+		scale = 1
+	}
+	scale += c.conf.LearningRate * (r.cost/static - scale)
+	if scale < minScale {
+		scale = minScale
+	}
+	if scale > maxScale {
+		scale = maxScale
+	}
+	c.scale[r.core] = scale
+}
+
+// Load returns the total cost of the rooms and the budget (in cores).
+func (c *Controller) Load() (used float64, budget float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used(), c.budget
+}
+
+// Overloaded tells if the controller rejects the new rooms of any cost.
+func (c *Controller) Overloaded() bool {
+	if c == nil || c.conf.Mode != worker.AdmissionHard {
+		return false
+	}
+	used, budget := c.Load()
+	return used >= budget
+}
+
+// used returns the total cost of the rooms,
+// the measured costs where there are ones.
+// Should be called under the lock.
+func (c *Controller) used() (total float64) {
+	for _, r := range c.rooms {
+		total += r.current()
+	}
+	for r := range c.pending {
+		total += r.current()
+	}
+	return
+}
+
+func (r *Room) current() float64 {
+	if r.measured {
+		return r.cost
+	}
+	return r.estimate
+}
+
+func megapixels(width int, height int) float64 {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	return float64(width) * float64(height) / 1e6
+}
@@ -0,0 +1,171 @@
+package admission
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+)
+
+// the budget of one core
+var testConf = worker.Admission{
+	Mode:        worker.AdmissionHard,
+	Cores:       2,
+	Utilization: .5,
+	Costs:       map[string]float64{"nes": .1, "n64": .5},
+	DefaultCost: .2,
+	PixelCost:   1,
+}
+
+// step is a new room of the script, -<room> releases the room.
+type step struct {
+	room   string
+	core   string
+	w, h   int
+	reject bool
+}
+
+func TestAdmit(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  string
+		steps []step
+	}{
+		{
+			name: "hard",
+			mode: worker.AdmissionHard,
+			steps: []step{
+				// 0.1 + 0.0768
+				{room: "nes1", core: "nes", w: 320, h: 240},
+				// 0.5 + 0.0768
+				{room: "n64", core: "n64", w: 320, h: 240},
+				{room: "n64-2", core: "n64", w: 320, h: 240, reject: true},
+				// the default cost 0.2 + 0.3072
+				{room: "psx-hd", core: "psx", w: 640, h: 480, reject: true},
+				{room: "psx", core: "psx", w: 160, h: 144},
+				{room: "nes2", core: "nes", w: 320, h: 240, reject: true},
+				{room: "-n64"},
+				{room: "n64-2", core: "n64", w: 320, h: 240},
+				{room: "nes2", core: "nes", w: 320, h: 240, reject: true},
+				{room: "-nes1"},
+				{room: "nes2", core: "nes", w: 320, h: 240},
+			},
+		},
+		{
+			name: "soft",
+			mode: worker.AdmissionSoft,
+			steps: []step{
+				{room: "n64", core: "n64", w: 640, h: 480},
+				{room: "n64-2", core: "n64", w: 640, h: 480},
+				{room: "n64-3", core: "n64", w: 640, h: 480},
+			},
+		},
+		{
+			name: "off",
+			steps: []step{
+				{room: "n64", core: "n64", w: 640, h: 480},
+				{room: "n64-2", core: "n64", w: 640, h: 480},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := testConf
+			conf.Mode = test.mode
+			c := New(conf)
+			for i, s := range test.steps {
+				if s.room[0] == '-' {
+					c.Release(s.room[1:])
+					continue
+				}
+				r, err := c.Admit(s.core, s.w, s.h)
+				if s.reject {
+					if !errors.Is(err, ErrWorkerOverloaded) {
+						t.Errorf("step %v: the room %v is not rejected, %v", i, s.room, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("step %v: the room %v is rejected, %v", i, s.room, err)
+				}
+				c.Bind(r, s.room)
+			}
+		})
+	}
+}
+
+func TestAdmitPending(t *testing.T) {
+	c := New(testConf)
+	// the rooms being made count too
+	r, err := c.Admit("n64", 320, 240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Admit("n64", 320, 240); err == nil {
+		t.Errorf("the pending room is not in the budget")
+	}
+	c.Cancel(r)
+	if used, _ := c.Load(); used != 0 {
+		t.Errorf("the canceled room is in the budget, %v", used)
+	}
+	if c.Overloaded() {
+		t.Errorf("the empty worker is overloaded")
+	}
+}
+
+func TestObserve(t *testing.T) {
+	c := New(testConf)
+	now := time.Unix(0, 0)
+	estimate := c.Estimate("n64", 320, 240)
+
+	// the n64 rooms take 0.9 cores each
+	var cpu time.Duration
+	for i := 0; i < 50; i++ {
+		r, err := c.Admit("n64", 320, 240)
+		if err != nil {
+			t.Fatalf("room %v is rejected, %v", i, err)
+		}
+		c.Bind(r, "n64")
+		c.Observe("n64", cpu, now)
+		cpu, now = cpu+9*time.Second, now.Add(10*time.Second)
+		c.Observe("n64", cpu, now)
+		if used, _ := c.Load(); math.Abs(used-.9) > 1e-9 {
+			t.Fatalf("the room %v costs %v, expected the measured 0.9", i, used)
+		}
+		c.Release("n64")
+	}
+	got := c.Estimate("n64", 320, 240)
+	if math.Abs(got-.9) > .01 {
+		t.Errorf("the estimate %v (from %v) hasn't learnt the measured cost 0.9", got, estimate)
+	}
+	if _, err := c.Admit("n64", 320, 240); err != nil {
+		t.Errorf("the room within the budget is rejected, %v", err)
+	}
+	if _, err := c.Admit("n64", 320, 240); err == nil {
+		t.Errorf("the room over the learnt budget is admitted")
+	}
+	// the other cores keep their estimates
+	if got := c.Estimate("nes", 0, 0); got != .1 {
+		t.Errorf("the nes estimate has changed %v", got)
+	}
+}
+
+func TestObserveRestart(t *testing.T) {
+	c := New(testConf)
+	r, _ := c.Admit("nes", 0, 0)
+	c.Bind(r, "nes")
+	now := time.Unix(0, 0)
+	c.Observe("nes", 10*time.Second, now)
+	c.Observe("nes", 12*time.Second, now.Add(10*time.Second))
+	// the restarted emulator
+	c.Observe("nes", time.Second, now.Add(20*time.Second))
+	if used, _ := c.Load(); math.Abs(used-.2) > 1e-9 {
+		t.Errorf("the room costs %v, expected 0.2", used)
+	}
+	c.Observe("nes", 4*time.Second, now.Add(30*time.Second))
+	if used, _ := c.Load(); math.Abs(used-.3) > 1e-9 {
+		t.Errorf("the room costs %v, expected 0.3", used)
+	}
+}
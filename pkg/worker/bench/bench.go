@@ -0,0 +1,272 @@
+// Package bench runs the rooms of a game without the clients,
+// so the capacity of a worker (how many rooms it could run)
+// is known before the real players come.
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/manager/manifest"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/os"
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
+)
+
+// ErrNoGame is the error of the benchmark without the game.
+var ErrNoGame = errors.New("no game to benchmark")
+
+const (
+	defaultDuration = 30 * time.Second
+	defaultWarmup   = 5 * time.Second
+)
+
+// Options are the options of the benchmark.
+type Options struct {
+	// Game is the path of the game file
+	Game string
+	// Room is the ID of the room, empty -- random
+	Room string
+	// the time the rooms are measured after their warm-up,
+	// 0 -- 30s and 5s
+	Duration time.Duration
+	Warmup   time.Duration
+}
+
+// Report is the result of the benchmark.
+type Report struct {
+	Game string `json:"game"`
+	// the measured time in seconds
+	Duration float64 `json:"duration"`
+	Cores    int     `json:"cores"`
+	// the CPU time of the processes of the rooms in seconds
+	// and its share of all the cores (0-1)
+	CPU     float64      `json:"cpu"`
+	CPULoad float64      `json:"cpu_load"`
+	Rooms   []RoomReport `json:"rooms"`
+}
+
+// RoomReport is the result of one room of the benchmark.
+type RoomReport struct {
+	Room string `json:"room"`
+	// the frame rate of the game and the one of the video the room has sent
+	TargetFps float64 `json:"target_fps"`
+	Fps       float64 `json:"fps"`
+	// the frame rate of the emulator within the last second
+	EmulatorFps float64 `json:"emulator_fps"`
+	VideoFrames uint64  `json:"video_frames"`
+	AudioFrames uint64  `json:"audio_frames"`
+	VideoBytes  uint64  `json:"video_bytes"`
+	AudioBytes  uint64  `json:"audio_bytes"`
+	// the percentiles of the video encoding time in ms
+	EncodeP50 float64 `json:"encode_p50"`
+	EncodeP95 float64 `json:"encode_p95"`
+	EncodeP99 float64 `json:"encode_p99"`
+	// the frames dropped before the encoding and skipped by the encoder
+	DroppedFrames uint64 `json:"dropped_frames"`
+	SkippedFrames uint64 `json:"skipped_frames"`
+	// the CPU time of the game and its encoding in seconds
+	CPU   float64 `json:"cpu"`
+	Error string  `json:"error,omitempty"`
+}
+
+// sink is a headless peer of the room counting its media frames.
+type sink struct {
+	// should be 64-bit aligned for atomic access
+	videoFrames, audioFrames uint64
+	videoBytes, audioBytes   uint64
+}
+
+func (s *sink) IsConnected() bool { return true }
+
+func (s *sink) SendVideo(frame webrtc.WebFrame) bool {
+	atomic.AddUint64(&s.videoFrames, 1)
+	atomic.AddUint64(&s.videoBytes, uint64(len(frame.Data)))
+	if frame.Release != nil {
+		frame.Release()
+	}
+	return true
+}
+
+func (s *sink) SendAudio(frame webrtc.AudioFrame) bool {
+	atomic.AddUint64(&s.audioFrames, 1)
+	atomic.AddUint64(&s.audioBytes, uint64(len(frame.Data)))
+	return true
+}
+
+// counts returns the frames and bytes of the video and audio.
+func (s *sink) counts() [4]uint64 {
+	return [4]uint64{atomic.LoadUint64(&s.videoFrames), atomic.LoadUint64(&s.audioFrames),
+		atomic.LoadUint64(&s.videoBytes), atomic.LoadUint64(&s.audioBytes)}
+}
+
+// gameMetadata returns the game of the file.
+func gameMetadata(path string) (games.GameMetadata, error) {
+	ext := filepath.Ext(path)
+	if path == "" || ext == "" {
+		return games.GameMetadata{}, ErrNoGame
+	}
+	name := filepath.Base(path)
+	return games.GameMetadata{
+		Name: strings.TrimSuffix(name, ext),
+		Type: ext[1:],
+		Base: filepath.Dir(path),
+		Path: name,
+	}, nil
+}
+
+// Run runs the room of the game in this process with the headless sink
+// through the whole emulator and encoder path of the worker and
+// reports its frames after the warm-up.
+// The libretro cores run one game per process, so the benchmarks of
+// more rooms go in their own processes, see Spawn.
+func Run(conf worker.Config, opts Options) (Report, error) {
+	game, err := gameMetadata(opts.Game)
+	if err != nil {
+		return Report{}, err
+	}
+	duration, warmup := opts.Duration, opts.Warmup
+	if duration <= 0 {
+		duration = defaultDuration
+	}
+	if warmup <= 0 {
+		warmup = defaultWarmup
+	}
+	// the rooms without the peers run until the end
+	conf.Room.IdleTimeout = 0
+	conf.Emulator.AutosaveInterval = 0
+	conf.Encoder.WithoutGame = false
+
+	noop, _ := storage.NewNoopCloudStorage()
+	r := room.NewRoom(opts.Room, game, "", false, noop, manifest.NewInstaller(conf.Emulator.Libretro), conf)
+	defer func() {
+		r.Close()
+		<-r.Closed()
+	}()
+	select {
+	case <-r.Ready():
+	case <-r.Closed():
+		return Report{}, fmt.Errorf("the room hasn't started, %v", r.Err())
+	}
+	s := &sink{}
+	r.AddSink(s)
+	defer r.RemoveSink(s)
+	time.Sleep(warmup)
+
+	cpu, err := os.CPUTime()
+	if err != nil {
+		log.Printf("warn: no CPU time of the benchmark, %v", err)
+	}
+	start, before, roomCpu := time.Now(), s.counts(), r.CPUTime()
+	select {
+	case <-time.After(duration):
+	case <-r.Closed():
+	}
+	elapsed := time.Since(start)
+	after, stats := s.counts(), r.GetStats()
+
+	report := RoomReport{
+		Room:          r.ID,
+		TargetFps:     stats.TargetFps,
+		Fps:           float64(after[0]-before[0]) / elapsed.Seconds(),
+		EmulatorFps:   stats.Fps,
+		VideoFrames:   after[0] - before[0],
+		AudioFrames:   after[1] - before[1],
+		VideoBytes:    after[2] - before[2],
+		AudioBytes:    after[3] - before[3],
+		EncodeP50:     ms(stats.EncodeTime.P50),
+		EncodeP95:     ms(stats.EncodeTime.P95),
+		EncodeP99:     ms(stats.EncodeTime.P99),
+		DroppedFrames: stats.DroppedFrames,
+		SkippedFrames: stats.SkippedFrames,
+		CPU:           (r.CPUTime() - roomCpu).Seconds(),
+	}
+	select {
+	case <-r.Closed():
+		report.Error = fmt.Sprintf("the room has been closed, %v", r.Err())
+	default:
+	}
+	result := Report{Game: game.Name, Duration: elapsed.Seconds(), Rooms: []RoomReport{report}}
+	if now, err := os.CPUTime(); err == nil {
+		result.CPU = (now - cpu).Seconds()
+	}
+	return Merge(result), nil
+}
+
+// Spawn runs the benchmarks of the commands at once, i.e. the worker
+// benchmarks of one room, and merges their JSON reports,
+// the last lines of their stdout. The stderr of the commands goes into the log.
+func Spawn(cmds []*exec.Cmd) (Report, error) {
+	reports := make([]Report, len(cmds))
+	errs := make([]error, len(cmds))
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		wg.Add(1)
+		go func(i int, cmd *exec.Cmd) {
+			defer wg.Done()
+			var out bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &out, log.Writer()
+			if err := cmd.Run(); err != nil {
+				errs[i] = fmt.Errorf("the benchmark %v has failed, %w", i, err)
+				return
+			}
+			if err := json.Unmarshal(lastLine(out.Bytes()), &reports[i]); err != nil {
+				errs[i] = fmt.Errorf("malformed report of the benchmark %v, %w", i, err)
+			}
+		}(i, cmd)
+	}
+	wg.Wait()
+	var ok []Report
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("error: %v", err)
+			continue
+		}
+		ok = append(ok, reports[i])
+	}
+	if len(ok) == 0 {
+		return Report{}, errors.New("no benchmark reports")
+	}
+	return Merge(ok...), nil
+}
+
+// Merge joins the reports of the benchmarks run at the same time,
+// the load is of the CPU time of all of them within the longest one.
+func Merge(reports ...Report) Report {
+	merged := Report{Cores: runtime.NumCPU(), Rooms: []RoomReport{}}
+	for _, r := range reports {
+		if merged.Game == "" {
+			merged.Game = r.Game
+		}
+		if r.Duration > merged.Duration {
+			merged.Duration = r.Duration
+		}
+		merged.CPU += r.CPU
+		merged.Rooms = append(merged.Rooms, r.Rooms...)
+	}
+	if merged.Duration > 0 && merged.Cores > 0 {
+		merged.CPULoad = merged.CPU / merged.Duration / float64(merged.Cores)
+	}
+	return merged
+}
+
+// lastLine returns the last non-empty line of the output.
+func lastLine(out []byte) []byte {
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	return lines[len(lines)-1]
+}
+
+func ms(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
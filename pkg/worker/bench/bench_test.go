@@ -0,0 +1,52 @@
+package bench
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestSink(t *testing.T) {
+	s := &sink{}
+	released := 0
+	for i := 0; i < 3; i++ {
+		s.SendVideo(webrtc.WebFrame{Data: make([]byte, 100), Release: func() { released++ }})
+		s.SendAudio(webrtc.AudioFrame{Data: make([]byte, 10)})
+	}
+	if counts := s.counts(); counts != [4]uint64{3, 3, 300, 30} {
+		t.Errorf("wrong counts %v", counts)
+	}
+	if released != 3 {
+		t.Errorf("the sink has released %v frames of 3", released)
+	}
+}
+
+func TestGameMetadata(t *testing.T) {
+	game, err := gameMetadata(filepath.Join("games", "Contra.nes"))
+	if err != nil || game.Name != "Contra" || game.Type != "nes" || game.Base != "games" || game.Path != "Contra.nes" {
+		t.Errorf("wrong game %+v, %v", game, err)
+	}
+	for _, path := range []string{"", "games/Contra"} {
+		if _, err := gameMetadata(path); err != ErrNoGame {
+			t.Errorf("wrong error %v of the game %q", err, path)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	reports := []Report{
+		{Game: "Contra", Duration: 10, CPU: 2, Rooms: []RoomReport{{Room: "bench00", Fps: 60}}},
+		{Game: "Contra", Duration: 10.5, CPU: 3, Rooms: []RoomReport{{Room: "bench01", Fps: 59}}},
+	}
+	merged := Merge(reports...)
+	if merged.Game != "Contra" || merged.Duration != 10.5 || merged.CPU != 5 || len(merged.Rooms) != 2 {
+		t.Errorf("wrong report %+v", merged)
+	}
+	if want := 5 / 10.5 / float64(merged.Cores); merged.CPULoad != want {
+		t.Errorf("wrong CPU load %v, expected %v", merged.CPULoad, want)
+	}
+	if line := string(lastLine([]byte("the room log\n{\"game\":\"Contra\"}\n\n"))); line != `{"game":"Contra"}` {
+		t.Errorf("wrong report line %v", line)
+	}
+}
@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+// drainPoll is how often the draining worker checks its rooms.
+const drainPoll = time.Second
+
+var errDraining = errors.New("the server is shutting down")
+
+// drainRoom is a room of the draining worker.
+type drainRoom interface {
+	Drain() error
+	IsEmpty() bool
+	SaveGame() error
+	Close()
+	Closed() <-chan struct{}
+}
+
+// Drain stops the worker gracefully.
+// The worker stops taking new rooms, saves the games of its rooms,
+// tells their players about the shutdown and waits until the rooms
+// become empty or the drain timeout passes, then closes the rooms
+// after the final save.
+// The coordinator gets the drain status of the worker.
+func (h *Handler) Drain(ctx context.Context) {
+	if !atomic.CompareAndSwapUint32(&h.draining, 0, 1) {
+		select {
+		case <-h.drained:
+		case <-ctx.Done():
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.Worker.DrainTimeout)
+	defer cancel()
+
+	log.Printf("[worker] draining %v rooms", h.rooms.Len())
+	h.reportDrain(api.WorkerDraining)
+	drainRooms(ctx, h.drainRooms, drainPoll)
+	h.reportDrain(api.WorkerDrained)
+	log.Printf("[worker] drained")
+	close(h.drained)
+}
+
+// Drained returns a channel which is closed when the worker has drained.
+func (h *Handler) Drained() <-chan struct{} { return h.drained }
+
+func (h *Handler) isDraining() bool { return atomic.LoadUint32(&h.draining) == 1 }
+
+func (h *Handler) drainRooms() []drainRoom {
+	list := h.rooms.List()
+	rooms := make([]drainRoom, 0, len(list))
+	for _, r := range list {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+func (h *Handler) reportDrain(status string) {
+	if h.oClient != nil {
+		h.oClient.Send(api.WorkerDrainPacket(status), nil)
+	}
+}
+
+// handleWorkerDrain drains the worker on the coordinator request,
+// the worker stops after that.
+func (h *Handler) handleWorkerDrain() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a drain request from coordinator")
+		go h.Drain(context.Background())
+		return cws.EmptyPacket
+	}
+}
+
+// drainRooms saves the rooms and tells their peers about the shutdown,
+// waits until the rooms are empty or the context is done,
+// then saves and closes them.
+func drainRooms(ctx context.Context, rooms func() []drainRoom, poll time.Duration) {
+	for _, r := range rooms() {
+		if err := r.Drain(); err != nil {
+			log.Printf("error: couldn't save the draining room, %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for !allEmpty(rooms()) {
+		select {
+		case <-ctx.Done():
+			log.Printf("warn: closing the rooms with the players")
+			closeRooms(rooms())
+			return
+		case <-ticker.C:
+		}
+	}
+	closeRooms(rooms())
+}
+
+func allEmpty(rooms []drainRoom) bool {
+	for _, r := range rooms {
+		if !r.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// closeRooms closes the rooms after the final save
+// and waits for their shutdown.
+func closeRooms(rooms []drainRoom) {
+	for _, r := range rooms {
+		if err := r.SaveGame(); err != nil {
+			log.Printf("error: couldn't save the closing room, %v", err)
+		}
+		r.Close()
+	}
+	for _, r := range rooms {
+		<-r.Closed()
+	}
+}
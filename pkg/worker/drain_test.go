@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
+	"github.com/gorilla/websocket"
+)
+
+// drainLog keeps the calls of the rooms in order.
+type drainLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *drainLog) add(call string) {
+	l.mu.Lock()
+	l.calls = append(l.calls, call)
+	l.mu.Unlock()
+}
+
+func (l *drainLog) index(call string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, c := range l.calls {
+		if c == call {
+			return i
+		}
+	}
+	return -1
+}
+
+type drainRoomMock struct {
+	id     string
+	log    *drainLog
+	empty  func() bool
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newDrainRoomMock(id string, log *drainLog, empty func() bool) *drainRoomMock {
+	return &drainRoomMock{id: id, log: log, empty: empty, closed: make(chan struct{})}
+}
+
+func (r *drainRoomMock) Drain() error            { r.log.add(r.id + " drain"); return nil }
+func (r *drainRoomMock) IsEmpty() bool           { return r.empty() }
+func (r *drainRoomMock) SaveGame() error         { r.log.add(r.id + " save"); return nil }
+func (r *drainRoomMock) Closed() <-chan struct{} { return r.closed }
+func (r *drainRoomMock) Close() {
+	r.once.Do(func() {
+		r.log.add(r.id + " close")
+		close(r.closed)
+	})
+}
+
+// Tests that the draining worker waits for its rooms
+// to become empty and saves them before the close.
+func TestDrainRooms(t *testing.T) {
+	log := &drainLog{}
+	left := time.Now().Add(50 * time.Millisecond)
+	rooms := []drainRoom{
+		newDrainRoomMock("a", log, func() bool { return true }),
+		newDrainRoomMock("b", log, func() bool { return time.Now().After(left) }),
+	}
+
+	start := time.Now()
+	drainRooms(context.Background(), func() []drainRoom { return rooms }, 10*time.Millisecond)
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("the rooms have been closed with the players")
+	}
+	for _, id := range []string{"a", "b"} {
+		drain, save, closed := log.index(id+" drain"), log.index(id+" save"), log.index(id+" close")
+		if drain < 0 || save < drain || closed < save {
+			t.Errorf("room %v: wrong order of the drain calls %v", id, log.calls)
+		}
+	}
+}
+
+// Tests that the rooms with players are closed after the timeout.
+func TestDrainRoomsTimeout(t *testing.T) {
+	log := &drainLog{}
+	rooms := []drainRoom{
+		newDrainRoomMock("a", log, func() bool { return false }),
+		newDrainRoomMock("b", log, func() bool { return true }),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		drainRooms(ctx, func() []drainRoom { return rooms }, 10*time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the rooms haven't been closed after the timeout")
+	}
+	for _, id := range []string{"a", "b"} {
+		if save, closed := log.index(id+" save"), log.index(id+" close"); save < 0 || closed < save {
+			t.Errorf("room %v hasn't been saved before the close, %v", id, log.calls)
+		}
+	}
+}
+
+// Tests that the coordinator gets the drain status of the worker.
+func TestDrainReport(t *testing.T) {
+	statuses := make(chan string, 2)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := cws.NewClient(conn)
+		c.Receive(api.WorkerDrain, func(resp cws.WSPacket) cws.WSPacket {
+			statuses <- resp.Data
+			return cws.EmptyPacket
+		})
+		c.Listen()
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("couldn't connect to the coordinator, %v", err)
+	}
+
+	h := NewHandler(worker.Config{}, "", room.NewManager())
+	h.oClient = NewCoordinatorClient(conn)
+	defer h.oClient.Close()
+	go h.oClient.Listen()
+
+	h.Drain(context.Background())
+	select {
+	case <-h.Drained():
+	default:
+		t.Errorf("the worker hasn't drained")
+	}
+	if !h.isDraining() {
+		t.Errorf("the drained worker takes new rooms")
+	}
+	// it's done once
+	h.Drain(context.Background())
+
+	for _, expected := range []string{api.WorkerDraining, api.WorkerDrained} {
+		select {
+		case status := <-statuses:
+			if status != expected {
+				t.Errorf("wrong drain status %v, expected %v", status, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %v status", expected)
+		}
+	}
+	select {
+	case status := <-statuses:
+		t.Errorf("unexpected status %v", status)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
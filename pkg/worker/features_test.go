@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
+	"github.com/gorilla/websocket"
+)
+
+// Tests that the worker advertises its features
+// to the coordinators which know them and the old ones.
+func TestConnectionRequestFeatures(t *testing.T) {
+	data, err := MakeConnectionRequest(worker.Config{}.Worker, "localhost:9000")
+	if err != nil {
+		t.Fatalf("no connection request, %v", err)
+	}
+	raw, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatalf("malformed connection request, %v", err)
+	}
+	req := api.ConnectionRequest{}
+	if err := json.Unmarshal(raw, &req); err != nil || req.Version != api.ProtocolVersion || len(req.Features) != len(api.Features) {
+		t.Errorf("wrong connection request %+v, %v", req, err)
+	}
+	// the old coordinators don't have the features
+	old := struct {
+		Addr    string `json:"addr,omitempty"`
+		PingURL string `json:"ping_url,omitempty"`
+		Xid     string `json:"xid,omitempty"`
+	}{}
+	if err := json.Unmarshal(raw, &old); err != nil || old.Xid == "" {
+		t.Errorf("wrong old connection request %+v, %v", old, err)
+	}
+}
+
+// Tests that the new worker acks the commands of the coordinator it doesn't know
+// with the errors, so the coordinator doesn't wait for them.
+func TestOldCoordinator(t *testing.T) {
+	acks := make(chan cws.WSPacket, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := cws.NewClient(conn)
+		go func() { acks <- c.SyncSend(cws.WSPacket{ID: "room_future", RoomID: "room"}) }()
+		c.Listen()
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("couldn't connect to the coordinator, %v", err)
+	}
+
+	h := NewHandler(worker.Config{}, "", room.NewManager())
+	h.oClient = NewCoordinatorClient(conn)
+	defer h.oClient.Close()
+	h.routes()
+	go h.oClient.Listen()
+
+	select {
+	case ack := <-acks:
+		if ack.Data != "error" || !strings.HasPrefix(ack.Error, cws.ErrUnknownPacket) {
+			t.Errorf("wrong ack %+v of the unknown command", ack)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the unknown command hasn't been acked")
+	}
+}
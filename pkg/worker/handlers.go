@@ -11,12 +11,16 @@ import (
 
 	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
 	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/bios"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/manager/manifest"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/manager/remotehttp"
 	"github.com/giongto35/cloud-game/v2/pkg/games"
 	"github.com/giongto35/cloud-game/v2/pkg/network/websocket"
 	"github.com/giongto35/cloud-game/v2/pkg/service"
+	"github.com/giongto35/cloud-game/v2/pkg/session"
 	"github.com/giongto35/cloud-game/v2/pkg/storage"
 	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/admission"
 	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
 	"github.com/rs/xid"
 )
@@ -28,25 +32,38 @@ type Handler struct {
 	// Client that connects to coordinator
 	oClient *CoordinatorClient
 	cfg     worker.Config
-	// Rooms map : RoomID -> Room
-	rooms map[string]*room.Room
+	// rooms of the worker by their IDs
+	rooms *room.Manager
 	// global ID of the current server
 	serverID string
 	// onlineStorage is client accessing to online storage (GCP)
 	onlineStorage storage.CloudStorage
 	// sessions handles all sessions server is handler (key is sessionID)
 	sessions map[string]*Session
+	// cores downloads the missing cores from the manifest
+	cores *manifest.Installer
+	// joins checks the join tokens of the sessions of the coordinator
+	joins *session.JoinTokens
+	// admission keeps the rooms within the CPU budget of the worker
+	admission *admission.Controller
+	// the worker doesn't take new rooms once it's draining (see Drain)
+	draining uint32
+	drained  chan struct{}
 }
 
-func NewHandler(conf worker.Config, address string) *Handler {
+func NewHandler(conf worker.Config, address string, rooms *room.Manager) *Handler {
 	createOfflineStorage(conf.Emulator.Storage)
 	onlineStorage := initCloudStorage(conf)
 	return &Handler{
 		address:       address,
 		cfg:           conf,
 		onlineStorage: onlineStorage,
-		rooms:         map[string]*room.Room{},
+		rooms:         rooms,
 		sessions:      map[string]*Session{},
+		cores:         manifest.NewInstaller(conf.Emulator.Libretro),
+		joins:         session.NewJoinTokens(conf.JoinTokens.Keys, conf.JoinTokens.TTL),
+		admission:     admission.New(conf.Worker.Admission),
+		drained:       make(chan struct{}),
 	}
 }
 
@@ -63,16 +80,52 @@ func (h *Handler) Run() {
 		log.Printf("[worker] connected to: %v", coordinatorAddress)
 
 		h.oClient = conn
-		go h.oClient.Heartbeat()
+		go h.oClient.HeartbeatWith(h.load)
+		go h.reportRooms(h.oClient)
 		h.routes()
+		h.announceRooms(h.oClient)
 		h.oClient.Listen()
 		// If cannot listen, reconnect to coordinator
 	}
 }
 
-func (h *Handler) Shutdown(context.Context) error { return nil }
+// Shutdown drains the worker.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.Drain(ctx)
+	return nil
+}
 
 func (h *Handler) Prepare() {
+	h.syncRepo()
+	if len(h.cfg.Emulator.Libretro.Cores.Manifest) > 0 {
+		log.Printf("Starting Libretro cores manifest sync...")
+		if err := h.cores.Sync(); err != nil {
+			log.Printf("error: cores manifest sync has failed, %v", err)
+		}
+	}
+	h.checkBios()
+}
+
+// checkBios checks (and downloads) the BIOS files of the config of the cores,
+// the known BIOS files of the cores are checked when they load the games.
+func (h *Handler) checkBios() {
+	cores := h.cfg.Emulator.Libretro.Cores
+	dir := cores.Paths.System
+	if dir == "" {
+		dir = bios.DefaultDir
+	}
+	for name, core := range cores.List {
+		if len(core.Bios) == 0 {
+			continue
+		}
+		if err := bios.Check(name, dir, core.Bios, cores.Bios); err != nil {
+			log.Printf("warn: the games of %v won't start, %v", name, err)
+		}
+	}
+}
+
+// syncRepo downloads the cores from the cores repository.
+func (h *Handler) syncRepo() {
 	if !h.cfg.Emulator.Libretro.Cores.Repo.Sync {
 		return
 	}
@@ -96,15 +149,18 @@ func initCloudStorage(conf worker.Config) storage.CloudStorage {
 	switch conf.Storage.Provider {
 	case "oracle":
 		st, err = storage.NewOracleDataStorageClient(conf.Storage.Key)
+	case "s3":
+		st, err = storage.NewS3Client(conf.Storage.S3)
 	case "coordinator":
 	default:
 		st, _ = storage.NewNoopCloudStorage()
 	}
 	if err != nil {
+		log.Printf("error: couldn't init %v cloud storage, %v", conf.Storage.Provider, err)
 		log.Printf("Switching to noop cloud save")
 		st, _ = storage.NewNoopCloudStorage()
 	}
-	return st
+	return storage.WithRetry(st, conf.Storage.Retry)
 }
 
 func newCoordinatorConnection(host string, conf worker.Worker, addr string) (*CoordinatorClient, error) {
@@ -129,13 +185,15 @@ func newCoordinatorConnection(host string, conf worker.Worker, addr string) (*Co
 func MakeConnectionRequest(w worker.Worker, address string) (string, error) {
 	addr := w.GetPingAddr(address)
 	req := api.ConnectionRequest{
-		Addr:    addr.Hostname(),
-		IsHTTPS: w.Server.Https,
-		PingURL: addr.String(),
-		Port:    w.GetPort(address),
-		Tag:     w.Tag,
-		Zone:    w.Network.Zone,
-		Xid:     xid.New().String(),
+		Addr:     addr.Hostname(),
+		IsHTTPS:  w.Server.Https,
+		PingURL:  addr.String(),
+		Port:     w.GetPort(address),
+		Tag:      w.Tag,
+		Zone:     w.Network.Zone,
+		Xid:      xid.New().String(),
+		Version:  api.ProtocolVersion,
+		Features: api.Features,
 	}
 	rez, err := json.Marshal(req)
 	if err != nil {
@@ -164,13 +222,7 @@ func (h *Handler) detachPeerConn(pc *webrtc.WebRTC) {
 	}
 }
 
-func (h *Handler) getRoom(roomID string) (r *room.Room) {
-	r, ok := h.rooms[roomID]
-	if !ok {
-		return nil
-	}
-	return
-}
+func (h *Handler) getRoom(roomID string) *room.Room { return h.rooms.Get(roomID) }
 
 // getRoom returns session from sessionID
 func (h *Handler) getSession(sessionID string) *Session {
@@ -183,44 +235,74 @@ func (h *Handler) getSession(sessionID string) *Session {
 }
 
 // detachRoom detach room from Handler
-func (h *Handler) detachRoom(roomID string) {
-	delete(h.rooms, roomID)
+func (h *Handler) detachRoom(r *room.Room) {
+	h.rooms.Remove(r)
+	// unless it's been replaced with another one
+	if h.rooms.Get(r.ID) == nil {
+		h.admission.Release(r.ID)
+	}
 }
 
-// createNewRoom creates a new room
-// Return nil in case of room is existed
-func (h *Handler) createNewRoom(game games.GameMetadata, recUser string, rec bool, roomID string) *room.Room {
-	// If the roomID doesn't have any running sessions (room was closed)
-	// we spawn a new room
-	if !h.isRoomBusy(roomID) {
-		newRoom := room.NewRoom(roomID, game, recUser, rec, h.onlineStorage, h.cfg)
-		// TODO: Might have race condition (and it has (:)
-		h.rooms[newRoom.ID] = newRoom
-		return newRoom
+// verifyJoin checks the join token of the session for the room
+// (the empty one -- a new room) and returns the room error of the token.
+func (h *Handler) verifyJoin(token string, roomID string, sessionID string, spectator bool) string {
+	scope := session.JoinScope{WorkerID: h.serverID, RoomID: roomID, SessionID: sessionID, Role: session.RoleOf(spectator)}
+	switch err := h.joins.Verify(token, scope); err {
+	case nil:
+		return ""
+	case session.ErrJoinExpired:
+		return api.JoinTokenExpired
+	case session.ErrJoinInvalid:
+		return api.JoinTokenInvalid
+	default:
+		return api.JoinForbidden
 	}
-	return nil
 }
 
-// isRoomBusy check if there is any running sessions.
-// TODO: If we remove sessions from room anytime a session is closed,
-// we can check if the sessions list is empty or not.
-func (h *Handler) isRoomBusy(roomID string) bool {
-	if roomID == "" {
-		return false
+// verifyUser returns the user of the session signed by the coordinator,
+// the sessions with the bad signatures are anonymous.
+func (h *Handler) verifyUser(token string, sessionID string) string {
+	user, err := h.joins.VerifyUser(token, sessionID)
+	if err != nil {
+		log.Printf("warn: session %v is anonymous, the user token is %v", sessionID, err)
 	}
-	// If no roomID is registered
-	r, ok := h.rooms[roomID]
-	if !ok {
-		return false
+	return user
+}
+
+// createNewRoom creates a new room within the CPU budget of the worker,
+// it fails with room.ErrRoomExists when the room with the ID runs already
+// and with admission.ErrWorkerOverloaded over the budget.
+// The setup of the room (i.e. its password) is done before the room
+// is available to the other sessions.
+func (h *Handler) createNewRoom(game games.GameMetadata, recUser string, rec bool, roomID string, setup func(r *room.Room)) (*room.Room, error) {
+	// the running rooms don't take the budget of the new ones
+	if roomID != "" && h.rooms.Has(roomID) {
+		return nil, room.ErrRoomExists
+	}
+	cost, err := h.admission.Admit(room.VideoEstimate(game, h.cfg))
+	if err != nil {
+		return nil, err
+	}
+	r, err := h.rooms.Create(roomID, func() *room.Room {
+		r := room.NewRoom(roomID, game, recUser, rec, h.onlineStorage, h.cores, h.cfg)
+		if setup != nil {
+			setup(r)
+		}
+		return r
+	})
+	if err != nil {
+		h.admission.Cancel(cost)
+		return nil, err
 	}
-	return r.IsRunningSessions()
+	h.admission.Bind(cost, r.ID)
+	return r, nil
 }
 
 func (h *Handler) Close() {
 	if h.oClient != nil {
 		h.oClient.Close()
 	}
-	for _, r := range h.rooms {
+	for _, r := range h.rooms.List() {
 		r.Close()
 	}
 }
@@ -2,12 +2,15 @@ package worker
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
 	"github.com/giongto35/cloud-game/v2/pkg/network/httpx"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func NewHTTPServer(conf worker.Config) (*httpx.Server, error) {
+func NewHTTPServer(conf worker.Config, rooms *room.Manager) (*httpx.Server, error) {
 	srv, err := httpx.NewServer(
 		conf.Worker.GetAddr(),
 		func(*httpx.Server) http.Handler {
@@ -16,6 +19,15 @@ func NewHTTPServer(conf worker.Config) (*httpx.Server, error) {
 				w.Header().Set("Access-Control-Allow-Origin", "*")
 				_, _ = w.Write([]byte{0x65, 0x63, 0x68, 0x6f}) // echo
 			})
+			if conf.Worker.Network.MetricsEndpoint != "" {
+				h.Handle(conf.Worker.Network.MetricsEndpoint, promhttp.Handler())
+			}
+			if conf.Worker.Admin.Token != "" {
+				prefix := strings.TrimSuffix(conf.Worker.Admin.Endpoint, "/") + "/rooms"
+				admin := adminHandler(prefix, conf.Worker.Admin.Token, rooms)
+				h.Handle(prefix, admin)
+				h.Handle(prefix+"/", admin)
+			}
 			return h
 		},
 		httpx.WithServerConfig(conf.Worker.Server),
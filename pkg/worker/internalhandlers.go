@@ -1,14 +1,20 @@
 package worker
 
 import (
+	"errors"
 	"log"
 	"strconv"
+	"time"
 
 	webrtcConfig "github.com/giongto35/cloud-game/v2/pkg/config/webrtc"
 	"github.com/giongto35/cloud-game/v2/pkg/cws"
 	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/bios"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
 	"github.com/giongto35/cloud-game/v2/pkg/games"
 	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/admission"
 	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
 )
 
@@ -27,6 +33,9 @@ func (h *Handler) handleTerminateSession() cws.PacketHandler {
 		if session != nil {
 			session.Close()
 			delete(h.sessions, resp.SessionID)
+			if r := h.getRoom(session.RoomID); r != nil {
+				r.ForgetSeat(session.peerconnection)
+			}
 			h.detachPeerConn(session.peerconnection)
 		} else {
 			log.Printf("Error: No session for ID: %s\n", resp.SessionID)
@@ -36,6 +45,387 @@ func (h *Handler) handleTerminateSession() cws.PacketHandler {
 	}
 }
 
+// handleSessionLeave releases the seat of the session which has left its room
+// (i.e. the beacon of the closed tab), the session may still reconnect.
+func (h *Handler) handleSessionLeave() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		session := h.getSession(resp.SessionID)
+		if session == nil {
+			log.Printf("warn: no session %v to leave", resp.SessionID)
+			return cws.EmptyPacket
+		}
+		if r := h.getRoom(session.RoomID); r != nil {
+			log.Printf("The session %v has left the room %v", resp.SessionID, r.ID)
+			r.ReleaseSeat(session.peerconnection)
+		}
+		return cws.EmptyPacket
+	}
+}
+
+func (h *Handler) handleRoomStats() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomStats
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		response := roomStats(r.GetStats())
+		if data, err := response.To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
+// roomStats converts the runtime stats of the room for the API.
+func roomStats(stats room.Stats) api.RoomStatsResponse {
+	response := api.RoomStatsResponse{
+		Fps:               stats.Fps,
+		TargetFps:         stats.TargetFps,
+		EncodeLatency:     float64(stats.EncodeLatency) / float64(time.Millisecond),
+		Players:           stats.Players,
+		Spectators:        stats.Spectators,
+		MaxPlayers:        stats.MaxPlayers,
+		MaxSpectators:     stats.MaxSpectators,
+		DroppedFrames:     stats.DroppedFrames,
+		SkippedFrames:     stats.SkippedFrames,
+		PeerDroppedFrames: stats.PeerDroppedFrames,
+		PendingUploads:    stats.PendingUploads,
+		Recoveries:        stats.Recoveries,
+		MaxRTT:            float64(stats.MaxRTT) / float64(time.Millisecond),
+		MaxPacketLoss:     stats.MaxPacketLoss,
+		InputDropped:      stats.InputDropped,
+		Egress:            api.Egress{Video: stats.Egress.Video, Audio: stats.Egress.Audio},
+		EgressLimit:       stats.EgressLimit,
+	}
+	if v := stats.Viewport; v.Width > 0 {
+		response.Viewport = &api.Viewport{Mode: v.Mode, Width: v.Width, Height: v.Height}
+		if c := v.Crop; c != (viewport.Crop{}) {
+			response.Viewport.Crop = &api.ViewportCrop{X: c.X, Y: c.Y, W: c.W, H: c.H}
+		}
+	}
+	for id, c := range stats.Connections {
+		if response.Connections == nil {
+			response.Connections = make(map[string]api.ConnectionStats)
+		}
+		response.Connections[id] = connectionStats(c)
+	}
+	for id, e := range stats.SessionEgress {
+		if response.SessionEgress == nil {
+			response.SessionEgress = make(map[string]api.Egress)
+		}
+		response.SessionEgress[id] = api.Egress{Video: e.Video, Audio: e.Audio}
+	}
+	return response
+}
+
+// handleGameConnectionStats returns the WebRTC connection stats of the session.
+func (h *Handler) handleGameConnectionStats() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.GameConnectionStats
+		req.Data = "error"
+
+		session := h.getSession(resp.SessionID)
+		if session == nil || session.peerconnection == nil {
+			return req
+		}
+		stats := connectionStats(session.peerconnection.Stats())
+		if data, err := stats.To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
+func connectionStats(c webrtc.ConnectionStats) api.ConnectionStats {
+	track := func(t webrtc.TrackStats) api.TrackStats {
+		return api.TrackStats{
+			RTT:        float64(t.RTT) / float64(time.Millisecond),
+			PacketLoss: t.FractionLost,
+			Jitter:     float64(t.Jitter) / float64(time.Millisecond),
+			BytesSent:  t.BytesSent,
+		}
+	}
+	return api.ConnectionStats{Video: track(c.Video), Audio: track(c.Audio), BytesSent: c.BytesSent}
+}
+
+// screenshotTimeout is the max time to wait for a frame,
+// it's for paused rooms without new frames.
+const screenshotTimeout = 2 * time.Second
+
+func (h *Handler) handleRoomScreenshot() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomScreenshot
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		img, err := r.Screenshot(screenshotTimeout)
+		if err != nil {
+			log.Printf("warn: no screenshot of the room %v, %v", resp.RoomID, err)
+			return req
+		}
+		response := api.RoomScreenshotResponse{Image: img}
+		if data, err := response.To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
+// handleRoomSaveThumbnail responds with the thumbnail of a save slot of a room.
+func (h *Handler) handleRoomSaveThumbnail() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomSaveThumbnail
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		request := api.RoomSaveThumbnailRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		img, err := r.GetSaveThumbnail(request.Slot)
+		if err != nil {
+			log.Printf("warn: no slot %v thumbnail of the room %v, %v", request.Slot, resp.RoomID, err)
+			return req
+		}
+		response := api.RoomSaveThumbnailResponse{Image: img}
+		if data, err := response.To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
+// handleRoomExportSave responds with the save file of a room.
+func (h *Handler) handleRoomExportSave() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomExportSave
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		save, err := r.ExportSave()
+		if err != nil {
+			log.Printf("warn: couldn't export the save of the room %v, %v", resp.RoomID, err)
+			return req
+		}
+		response := api.RoomExportSaveResponse{Save: save}
+		if data, err := response.To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
+// handleGameImportSave loads the save file into the room of the owner,
+// it responds with the error of the save file which doesn't fit the room.
+func (h *Handler) handleGameImportSave() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a save file of the room %v from coordinator", resp.RoomID)
+		req.ID = api.GameImportSave
+		req.Data = "error"
+
+		session := h.getSession(resp.SessionID)
+		r := h.getRoom(resp.RoomID)
+		if session == nil || r == nil {
+			return req
+		}
+		request := api.GameImportSaveRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		if err := r.ImportSave(session.peerconnection, request.Save); err != nil {
+			log.Printf("warn: session %v couldn't import the save into the room %v, %v", resp.SessionID, r.ID, err)
+			req.Data = err.Error()
+			return req
+		}
+		req.Data = "ok"
+
+		return req
+	}
+}
+
+// handleRoomRecording starts or stops the WebM recording of a room,
+// it responds with the recording file.
+func (h *Handler) handleRoomRecording() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomRecording
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		request := api.RoomRecordingRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		var file string
+		var err error
+		if request.Active {
+			file, err = r.StartRecording()
+		} else {
+			file, err = r.StopRecording()
+		}
+		if err != nil {
+			log.Printf("warn: room %v recording, %v", resp.RoomID, err)
+			return req
+		}
+		response := api.RoomRecordingResponse{File: file}
+		if data, err := response.To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
+func (h *Handler) handleRoomCoreOption() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomCoreOption
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		request := api.RoomCoreOptionRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		if err := r.SetCoreOption(request.Key, request.Value); err != nil {
+			log.Printf("warn: room %v core option, %v", resp.RoomID, err)
+			return req
+		}
+		req.Data = "ok"
+
+		return req
+	}
+}
+
+func (h *Handler) handleRoomCheat() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomCheat
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		request := api.RoomCheatRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		var err error
+		if request.Enabled {
+			err = r.EnableCheat(request.Index, request.Code)
+		} else {
+			err = r.DisableCheat(request.Index)
+		}
+		if err != nil {
+			log.Printf("warn: room %v cheat, %v", resp.RoomID, err)
+			return req
+		}
+		req.Data = "ok"
+
+		return req
+	}
+}
+
+func (h *Handler) handleRoomSwapDisc() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomSwapDisc
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		request := api.RoomSwapDiscRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		if err := r.SwapDisc(request.Index); err != nil {
+			log.Printf("warn: room %v disc swap, %v", resp.RoomID, err)
+			return req
+		}
+		req.Data = "ok"
+
+		return req
+	}
+}
+
+func (h *Handler) handleRoomAudioBitrate() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomAudioBitrate
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		request := api.RoomAudioBitrateRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		if err := r.SetAudioBitrate(request.Bitrate); err != nil {
+			log.Printf("warn: room %v audio bitrate, %v", resp.RoomID, err)
+			return req
+		}
+		req.Data = "ok"
+
+		return req
+	}
+}
+
+func (h *Handler) handleRoomVideoFilter() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		req.ID = api.RoomVideoFilter
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		request := api.RoomVideoFilterRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		if err := r.SetVideoFilter(request.Filters); err != nil {
+			log.Printf("warn: room %v video filter, %v", resp.RoomID, err)
+			return req
+		}
+		req.Data = "ok"
+
+		return req
+	}
+}
+
 func (h *Handler) handleInitWebrtc() cws.PacketHandler {
 	return func(resp cws.WSPacket) (req cws.WSPacket) {
 		log.Println("Received a request to createOffer from browser via coordinator")
@@ -45,15 +435,26 @@ func (h *Handler) handleInitWebrtc() cws.PacketHandler {
 			log.Println("error: Cannot create new WebRTC connection", err)
 			return cws.EmptyPacket
 		}
+		// the ICE servers of the session from the coordinator (i.e. with the TURN credentials),
+		// the ICE lite agent doesn't use them
+		var call api.InitWebrtcCall
+		if err := call.From(resp.Data); err == nil && len(call.IceServers) > 0 && !h.cfg.Webrtc.IceLite {
+			peerconnection.SetICEServers(call.IceServers)
+		}
 		localSession, err := peerconnection.StartClient(
 			// send back candidate string to browser
 			func(cd string) { h.oClient.Send(api.IceCandidatePacket(cd, resp.SessionID), nil) },
 		)
+		// the offers of the ICE restarts of the broken connections
+		// go the same way as the candidates
+		peerconnection.OnRestartOffer(func(offer string) { h.oClient.Send(api.OfferPacket(offer, resp.SessionID), nil) })
 
 		// localSession, err := peerconnection.StartClient(initPacket.IsMobile, iceCandidates[resp.SessionID])
 		// h.peerconnections[resp.SessionID] = peerconnection
 
 		// Create new sessions when we have new peerconnection initialized
+		// the browser session identifies the peer between its connections
+		peerconnection.User = resp.SessionID
 		session := &Session{
 			peerconnection: peerconnection,
 		}
@@ -65,7 +466,7 @@ func (h *Handler) handleInitWebrtc() cws.PacketHandler {
 			return cws.EmptyPacket
 		}
 
-		return cws.WSPacket{ID: "offer", Data: localSession}
+		return cws.WSPacket{ID: api.Offer, Data: localSession}
 	}
 }
 
@@ -120,7 +521,14 @@ func (h *Handler) handleGameStart() cws.PacketHandler {
 		if err := rom.From(resp.Data); err != nil {
 			return cws.EmptyPacket
 		}
-		game := games.GameMetadata{Name: rom.Name, Type: rom.Type, Base: rom.Base, Path: rom.Path}
+		if e := h.verifyJoin(rom.Token, resp.RoomID, resp.SessionID, rom.Spectator); e != "" {
+			log.Printf("warn: session %v can't join the room %v, %v", resp.SessionID, resp.RoomID, e)
+			return api.RoomErrorPacket("", e)
+		}
+		game := games.GameMetadata{Name: rom.Name, Type: rom.Type, Base: rom.Base, Path: rom.Path,
+			Overrides: rom.Overrides, Hash: rom.Hash}
+		session.peerconnection.Spectator = rom.Spectator
+		session.peerconnection.Profile = h.verifyUser(rom.User, resp.SessionID)
 
 		// recording
 		if h.cfg.Recording.Enabled {
@@ -129,11 +537,46 @@ func (h *Handler) handleGameStart() cws.PacketHandler {
 			log.Printf("RECORD OFF")
 		}
 
-		room := h.startGameHandler(game, rom.RecordUser, rom.Record, resp.RoomID, resp.PlayerIndex, session.peerconnection)
+		r, err := h.startGameHandler(game, rom.RecordUser, rom.Record, resp.RoomID, resp.PlayerIndex, rom.Password, rom.Hardcore, session.peerconnection)
+		if err != nil {
+			log.Printf("warn: session %v can't join the room %v, %v", resp.SessionID, resp.RoomID, err)
+			return api.RoomErrorPacket("", roomError(err))
+		}
+		session.RoomID = r.ID
+		return cws.WSPacket{ID: api.GameStart, RoomID: r.ID, PlayerIndex: session.peerconnection.PlayerIndex}
+	}
+}
+
+// handleGameReconnect moves the session into the room seat of its previous session,
+// which has gone (i.e. the browser page has been reloaded).
+// The old session is purged in any case.
+func (h *Handler) handleGameReconnect() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a reconnect request of the session %v from coordinator", resp.Data)
+		req.ID = api.GameReconnect
+		req.Data = "error"
+		session, old := h.getSession(resp.SessionID), h.getSession(resp.Data)
+		if session == nil || old == nil {
+			log.Printf("error: no sessions to reconnect %v -> %v", resp.Data, resp.SessionID)
+			return req
+		}
+		delete(h.sessions, resp.Data)
+
+		room := h.getRoom(old.RoomID)
+		if room == nil || room.ID != resp.RoomID {
+			log.Printf("warn: session %v is not in the room %v", resp.Data, resp.RoomID)
+			old.Close()
+			h.detachPeerConn(old.peerconnection)
+			return req
+		}
+		if err := room.ReconnectSession(old.peerconnection, session.peerconnection); err != nil {
+			log.Printf("warn: session %v can't reconnect to the room %v, %v", resp.SessionID, room.ID, err)
+			old.Close()
+			h.detachPeerConn(old.peerconnection)
+			return req
+		}
 		session.RoomID = room.ID
-		// TODO: can data race (and it does)
-		h.rooms[room.ID] = room
-		return cws.WSPacket{ID: api.GameStart, RoomID: room.ID}
+		return cws.WSPacket{ID: api.GameStart, RoomID: room.ID, PlayerIndex: session.peerconnection.PlayerIndex}
 	}
 }
 
@@ -186,8 +629,7 @@ func (h *Handler) handleGameLoad() cws.PacketHandler {
 		log.Println("Loading game state")
 		req.ID = api.GameLoad
 		req.Data = "ok"
-		if resp.RoomID != "" {
-			room := h.getRoom(resp.RoomID)
+		if room := h.getRoom(resp.RoomID); room != nil {
 			err := room.LoadGame()
 			if err != nil {
 				log.Println("[!] Cannot load game state: ", err)
@@ -201,22 +643,102 @@ func (h *Handler) handleGameLoad() cws.PacketHandler {
 	}
 }
 
+func (h *Handler) handleGameSaveSlot() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a save game slot from coordinator: %v", resp)
+		req.ID = api.GameSaveSlot
+		req.Data = "ok"
+
+		room := h.getRoom(resp.RoomID)
+		if room == nil {
+			req.Data = "error"
+			return req
+		}
+		request := api.GameSlotRequest{}
+		if err := request.From(resp.Data); err != nil {
+			req.Data = "error"
+			return req
+		}
+		if err := room.SaveGameSlot(request.Slot); err != nil {
+			log.Printf("error, cannot save game slot %v: %v", request.Slot, err)
+			req.Data = "error"
+		}
+
+		return req
+	}
+}
+
+func (h *Handler) handleGameLoadSlot() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a load game slot from coordinator: %v", resp)
+		req.ID = api.GameLoadSlot
+		req.Data = "ok"
+
+		room := h.getRoom(resp.RoomID)
+		if room == nil {
+			req.Data = "error"
+			return req
+		}
+		request := api.GameSlotRequest{}
+		if err := request.From(resp.Data); err != nil {
+			req.Data = "error"
+			return req
+		}
+		if err := room.LoadGameSlot(request.Slot); err != nil {
+			log.Printf("error, cannot load game slot %v: %v", request.Slot, err)
+			req.Data = "error"
+		}
+
+		return req
+	}
+}
+
+func (h *Handler) handleGameSlots() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Println("Received a save slots list request from coordinator")
+		req.ID = api.GameSlots
+		req.Data = "error"
+
+		room := h.getRoom(resp.RoomID)
+		if room == nil {
+			return req
+		}
+		slots := api.GameSlotsResponse{Slots: room.GetSlots()}
+		if slots.Slots == nil {
+			slots.Slots = []int{}
+		}
+		if data, err := slots.To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
 func (h *Handler) handleGamePlayerSelect() cws.PacketHandler {
 	return func(resp cws.WSPacket) (req cws.WSPacket) {
 		log.Println("Received an update player index event from coordinator")
 		req.ID = api.GamePlayerSelect
 
-		room := h.getRoom(resp.RoomID)
+		r := h.getRoom(resp.RoomID)
 		session := h.getSession(resp.SessionID)
 		idx, err := strconv.Atoi(resp.Data)
-		log.Printf("Got session %v and room %v", session, room)
+		log.Printf("Got session %v and room %v", session, r)
 
-		if room != nil && session != nil && err == nil {
-			room.UpdatePlayerIndex(session.peerconnection, idx)
-			req.Data = strconv.Itoa(idx)
-		} else {
+		if r == nil || session == nil || err != nil {
 			req.Data = "error"
+			return req
+		}
+		if err := r.UpdatePlayerIndex(session.peerconnection, idx); err != nil {
+			log.Printf("error: couldn't update player index, %v", err)
+			req.Data = "error"
+			// the peer keeps its player
+			if err == room.ErrPlayerTaken {
+				req.Data = strconv.Itoa(session.peerconnection.PlayerIndex)
+			}
+			return req
 		}
+		req.Data = strconv.Itoa(idx)
 
 		return req
 	}
@@ -227,8 +749,7 @@ func (h *Handler) handleGameMultitap() cws.PacketHandler {
 		log.Println("Received a multitap toggle from coordinator")
 		req.ID = api.GameMultitap
 		req.Data = "ok"
-		if resp.RoomID != "" {
-			room := h.getRoom(resp.RoomID)
+		if room := h.getRoom(resp.RoomID); room != nil {
 			err := room.ToggleMultitap()
 			if err != nil {
 				log.Println("[!] Could not toggle multitap state: ", err)
@@ -242,6 +763,216 @@ func (h *Handler) handleGameMultitap() cws.PacketHandler {
 	}
 }
 
+func (h *Handler) handleGameKeyMapping() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a key mapping from coordinator: %v", resp)
+		req.ID = api.GameKeyMapping
+		req.Data = "ok"
+
+		session := h.getSession(resp.SessionID)
+		if session == nil {
+			req.Data = "error"
+			return req
+		}
+		request := api.GameKeyMappingRequest{}
+		if err := request.From(resp.Data); err != nil {
+			req.Data = "error"
+			return req
+		}
+		session.peerconnection.SetKeyMapping(request.Mapping)
+		if room := h.getRoom(session.RoomID); room != nil {
+			if err := room.SaveProfile(session.peerconnection); err != nil {
+				log.Printf("warn: couldn't save the profile of the session %v, %v", resp.SessionID, err)
+			}
+		}
+
+		return req
+	}
+}
+
+func (h *Handler) handleGameRewind() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a rewind from coordinator: %v", resp)
+		req.ID = api.GameRewind
+		req.Data = "ok"
+
+		room := h.getRoom(resp.RoomID)
+		if room == nil {
+			req.Data = "error"
+			return req
+		}
+		request := api.GameRewindRequest{}
+		if err := request.From(resp.Data); err != nil {
+			req.Data = "error"
+			return req
+		}
+		if err := room.Rewind(time.Duration(request.Seconds * float64(time.Second))); err != nil {
+			log.Printf("error: couldn't rewind the game, %v", err)
+			req.Data = "error"
+		}
+
+		return req
+	}
+}
+
+func (h *Handler) handleGamePause() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a pause toggle from coordinator: %v", resp)
+		req.ID = api.GamePause
+		req.Data = "error"
+
+		session := h.getSession(resp.SessionID)
+		room := h.getRoom(resp.RoomID)
+		if session == nil || room == nil {
+			return req
+		}
+		paused, err := room.TogglePause(session.peerconnection)
+		if err != nil {
+			log.Printf("warn: couldn't toggle the pause of the game, %v", err)
+			return req
+		}
+		if data, err := (&api.GamePauseResponse{Paused: paused}).To(); err == nil {
+			req.Data = data
+		}
+
+		return req
+	}
+}
+
+// handleGameKick removes some session from the room of the owner.
+func (h *Handler) handleGameKick() cws.PacketHandler {
+	return h.handleOwnerCommand(api.GameKick, func(r *room.Room, id string) error { return r.KickSession(id) })
+}
+
+// handleGameBan removes some session from the room of the owner
+// for the lifetime of the room.
+func (h *Handler) handleGameBan() cws.PacketHandler {
+	return h.handleOwnerCommand(api.GameBan, func(r *room.Room, id string) error { return r.BanSession(id) })
+}
+
+// handleGamePassword changes the password of the room of the owner,
+// the empty one makes the room public.
+// The sessions in the room stay there.
+func (h *Handler) handleGamePassword() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		// no password in the logs
+		log.Printf("Received a password request of the room %v from coordinator", resp.RoomID)
+		req.ID = api.GamePassword
+		req.Data = "error"
+
+		session := h.getSession(resp.SessionID)
+		r := h.getRoom(resp.RoomID)
+		if session == nil || r == nil {
+			return req
+		}
+		if !r.IsOwner(session.peerconnection) {
+			log.Printf("warn: session %v %v, %v", resp.SessionID, api.GamePassword, room.ErrNotRoomOwner)
+			return req
+		}
+		request := api.GamePasswordRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		hash, err := hashPassword(request.Password)
+		if err != nil {
+			log.Printf("error: couldn't change the password of the room %v, %v", r.ID, err)
+			return req
+		}
+		r.SetPasswordHash(hash)
+		req.Data = "ok"
+
+		return req
+	}
+}
+
+// handleGameInvite mints the invite of the new players of the room of the owner,
+// the coordinator lets the players with it into the room.
+func (h *Handler) handleGameInvite() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received an invite request of the room %v from coordinator", resp.RoomID)
+		req.ID = api.GameInvite
+		req.Data = "error"
+
+		session := h.getSession(resp.SessionID)
+		r := h.getRoom(resp.RoomID)
+		if session == nil || r == nil {
+			return req
+		}
+		if !r.IsOwner(session.peerconnection) {
+			log.Printf("warn: session %v %v, %v", resp.SessionID, api.GameInvite, room.ErrNotRoomOwner)
+			return req
+		}
+		invite, err := h.joins.MintInvite(h.serverID, r.ID)
+		if err != nil {
+			log.Printf("error: couldn't mint the invite of the room %v, %v", r.ID, err)
+			return req
+		}
+		req.RoomID = r.ID
+		req.Data = invite
+
+		return req
+	}
+}
+
+// handleOwnerCommand runs the command of the room owner for some session of the room.
+func (h *Handler) handleOwnerCommand(id string, command func(r *room.Room, session string) error) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a %v request from coordinator: %v", id, resp)
+		req.ID = id
+		req.Data = "error"
+
+		session := h.getSession(resp.SessionID)
+		r := h.getRoom(resp.RoomID)
+		if session == nil || r == nil {
+			return req
+		}
+		if !r.IsOwner(session.peerconnection) {
+			log.Printf("warn: session %v %v, %v", resp.SessionID, id, room.ErrNotRoomOwner)
+			return req
+		}
+		request := api.GameKickRequest{}
+		if err := request.From(resp.Data); err != nil {
+			return req
+		}
+		if request.SessionID == resp.SessionID || request.SessionID == session.peerconnection.ID {
+			return req
+		}
+		if err := command(r, request.SessionID); err != nil {
+			log.Printf("warn: couldn't %v the session %v, %v", id, request.SessionID, err)
+			return req
+		}
+		req.Data = "ok"
+
+		return req
+	}
+}
+
+func (h *Handler) handleGameFastForward() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a fast-forward from coordinator: %v", resp)
+		req.ID = api.GameFastForward
+		req.Data = "ok"
+
+		session := h.getSession(resp.SessionID)
+		room := h.getRoom(resp.RoomID)
+		if session == nil || room == nil {
+			req.Data = "error"
+			return req
+		}
+		request := api.GameFastForwardRequest{}
+		if err := request.From(resp.Data); err != nil {
+			req.Data = "error"
+			return req
+		}
+		if err := room.SetSpeed(session.peerconnection, request.Speed); err != nil {
+			log.Printf("warn: couldn't change the game speed, %v", err)
+			req.Data = "error"
+		}
+
+		return req
+	}
+}
+
 func (h *Handler) handleGameRecording() cws.PacketHandler {
 	return func(resp cws.WSPacket) (req cws.WSPacket) {
 		log.Printf("Received recording request from coordinator: %v", resp)
@@ -276,39 +1007,167 @@ func (h *Handler) handleGameRecording() cws.PacketHandler {
 	}
 }
 
-// startGameHandler starts a game if roomID is given, if not create new room
-func (h *Handler) startGameHandler(game games.GameMetadata, recUser string, rec bool, existedRoomID string, playerIndex int, peerconnection *webrtc.WebRTC) *room.Room {
+// startGameHandler starts a game if roomID is given, if not create new room.
+// The new rooms are private with the given password.
+func (h *Handler) startGameHandler(game games.GameMetadata, recUser string, rec bool, existedRoomID string, playerIndex int, password string, hardcore bool, peerconnection *webrtc.WebRTC) (*room.Room, error) {
 	log.Printf("Loading game: %v\n", game.Name)
 	// If we are connecting to coordinator, request corresponding serverID based on roomID
 	// TODO: check if existedRoomID is in the current server
-	room := h.getRoom(existedRoomID)
+	r := h.getRoom(existedRoomID)
 	// If room is not running
-	if room == nil {
-		log.Println("Got Room from local ", room, " ID: ", existedRoomID)
-		// Create new room and update player index
-		room = h.createNewRoom(game, recUser, rec, existedRoomID)
-		room.UpdatePlayerIndex(peerconnection, playerIndex)
+	if r == nil {
+		if h.isDraining() {
+			return nil, errDraining
+		}
+		log.Println("Got Room from local ", r, " ID: ", existedRoomID)
+		hash, err := hashPassword(password)
+		if err != nil {
+			log.Printf("error: couldn't hash the room password, %v", err)
+			return nil, err
+		}
+		// Create new room and update player index,
+		// the room is private and hardcore before the other sessions see it
+		newRoom, err := h.createNewRoom(game, recUser, rec, existedRoomID, func(r *room.Room) {
+			r.SetPasswordHash(hash)
+			r.SetHardcore(hardcore)
+		})
+		switch err {
+		case nil:
+			r = newRoom
+			go h.watchRoom(r)
+			go forwardAchievements(r)
+		case room.ErrRoomExists:
+			// the room has been created by another session just now
+			if r = h.getRoom(existedRoomID); r == nil {
+				return nil, err
+			}
+		default:
+			return nil, err
+		}
+	}
+	// the room is joinable once its game has started
+	if err := waitRoom(r); err != nil {
+		return nil, err
+	}
 
-		// Wait for done signal from room
-		go func() {
-			<-room.Done
-			h.detachRoom(room.ID)
-			// send signal to coordinator that the room is closed, coordinator will remove that room
-			h.oClient.Send(api.CloseRoomPacket(room.ID), nil)
-		}()
+	// the requested player or the first free one if it's taken
+	if !peerconnection.Spectator {
+		if err := r.UpdatePlayerIndex(peerconnection, playerIndex); err != nil {
+			log.Printf("warn: player %v is not available, %v", playerIndex, err)
+			if _, err := r.ClaimFreePlayerIndex(peerconnection); err != nil {
+				log.Printf("warn: %v", err)
+			}
+		}
 	}
 
 	// Attach peerconnection to room. If PC is already in room, don't detach
-	log.Println("Is PC in room", room.IsPCInRoom(peerconnection))
-	if !room.IsPCInRoom(peerconnection) {
+	log.Println("Is PC in room", r.IsPCInRoom(peerconnection))
+	if !r.IsPCInRoom(peerconnection) {
 		h.detachPeerConn(peerconnection)
-		room.AddConnectionToRoom(peerconnection)
+		if err := r.AddConnectionToRoom(peerconnection, password); err != nil {
+			return nil, err
+		}
 	}
 
 	// Register room to coordinator if we are connecting to coordinator
-	if room != nil && h.oClient != nil {
-		h.oClient.Send(api.RegisterRoomPacket(room.ID), nil)
+	if r != nil && h.oClient != nil {
+		h.oClient.Send(api.RegisterRoomPacket(r.ID), nil)
+	}
+
+	return r, nil
+}
+
+// watchRoom waits for done signal from the room.
+func (h *Handler) watchRoom(r *room.Room) {
+	<-r.Done
+	h.detachRoom(r)
+	// the browsers of the starting room have no room yet,
+	// so the error goes to each session of the room
+	if err := r.Err(); err != nil {
+		for _, id := range r.SessionIDs() {
+			packet := api.RoomErrorPacket(r.ID, roomError(err))
+			packet.SessionID = id
+			h.oClient.Send(packet, nil)
+		}
+	}
+	// send signal to coordinator that the room is closed, coordinator will remove that room
+	h.oClient.Send(api.CloseRoomPacket(r.ID), nil)
+}
+
+// forwardAchievements sends the achievements unlocked in the room
+// to its owner until the room is closed.
+func forwardAchievements(r *room.Room) {
+	for {
+		select {
+		case <-r.Done:
+			return
+		case a := <-r.Achievements():
+			out, err := (&api.ControlReply{Cmd: api.ControlAchievement, Ok: true, Data: api.AchievementEvent{
+				ID:          a.ID,
+				Title:       a.Title,
+				Description: a.Description,
+				Points:      a.Points,
+				Badge:       a.BadgeName,
+				Hardcore:    a.Hardcore,
+			}}).To()
+			if err != nil {
+				continue
+			}
+			owner := r.OwnerSession()
+			if owner == nil || !owner.IsConnected() {
+				continue
+			}
+			if err := owner.SendControl([]byte(out)); err != nil {
+				log.Printf("warn: couldn't send the achievement %v to %v, %v", a.ID, owner.GetId(), err)
+			}
+		}
 	}
+}
+
+// errRoomClosed is the error of the rooms closed before the start of their games.
+var errRoomClosed = errors.New("the room has been closed")
 
-	return room
+// waitRoom waits for the start of the game of the room,
+// the rooms which haven't started in time are closed by themselves.
+func waitRoom(r *room.Room) error {
+	select {
+	case <-r.Ready():
+		return nil
+	case <-r.Done:
+		if err := r.Err(); err != nil {
+			return err
+		}
+		return errRoomClosed
+	}
+}
+
+// roomError returns the room error of the clients for the error of the room,
+// the structured ones for the known reasons.
+func roomError(err error) string {
+	switch {
+	case errors.Is(err, room.ErrRoomFull):
+		return api.RoomFull
+	case errors.Is(err, emulator.ErrNoCore):
+		return api.RoomNoCore
+	case errors.Is(err, emulator.ErrBadGame):
+		return api.RoomBadGame
+	case errors.Is(err, emulator.ErrNoBios):
+		var e *bios.Error
+		if errors.As(err, &e) {
+			return api.RoomNoBios + ": " + e.Error()
+		}
+		return api.RoomNoBios
+	case errors.Is(err, room.ErrCrashed):
+		return api.RoomCrashed
+	case errors.Is(err, room.ErrStartTimeout):
+		return api.RoomStartTimeout
+	case errors.Is(err, room.ErrVideo):
+		return api.RoomVideoFailed
+	case errors.Is(err, room.ErrNoCodec):
+		return api.RoomNoCodec
+	case errors.Is(err, admission.ErrWorkerOverloaded):
+		return api.RoomOverloaded
+	default:
+		return err.Error()
+	}
 }
@@ -0,0 +1,137 @@
+// Package janitor removes the storage dirs of the rooms
+// which have not been played for a while.
+// The rooms with the copies in the cloud storage are kept
+// until their last upload has expired too (see MarkCloud).
+package janitor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/service"
+)
+
+// CloudMark is the file of the room dir which modification time
+// is the time of the last upload of the room files into the cloud storage.
+const CloudMark = ".cloud"
+
+const defaultInterval = 24 * time.Hour
+
+// MarkCloud marks the room dir as having the cloud copies uploaded now.
+func MarkCloud(dir string) error {
+	path := filepath.Join(dir, CloudMark)
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return ioutil.WriteFile(path, nil, 0644)
+}
+
+// Janitor removes the expired room dirs of the storage periodically.
+type Janitor struct {
+	service.RunnableService
+
+	dir      string
+	expiry   time.Duration
+	interval time.Duration
+	// tells if the room is running on the worker,
+	// its dir is kept whatever the time
+	active func(room string) bool
+
+	once sync.Once
+	done chan struct{}
+}
+
+// New returns the janitor of the storage dir of the rooms.
+func New(dir string, conf emulator.StorageCleanup, active func(room string) bool) *Janitor {
+	interval := time.Duration(conf.Interval) * time.Hour
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Janitor{
+		dir:      dir,
+		expiry:   time.Duration(conf.ExpiryDays) * 24 * time.Hour,
+		interval: interval,
+		active:   active,
+		done:     make(chan struct{}),
+	}
+}
+
+// Run cleans the storage at once and then with the interval until the shutdown.
+func (j *Janitor) Run() {
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		if removed := j.Clean(time.Now()); len(removed) > 0 {
+			log.Printf("[janitor] removed %v expired rooms from the storage", len(removed))
+		}
+		select {
+		case <-j.done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (j *Janitor) Shutdown(context.Context) error {
+	j.once.Do(func() { close(j.done) })
+	return nil
+}
+
+// Clean removes the dirs of the rooms which have expired by the time,
+// it returns the removed rooms.
+func (j *Janitor) Clean(now time.Time) (removed []string) {
+	if j.expiry <= 0 {
+		return
+	}
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		log.Printf("warn: couldn't read the storage %v, %v", j.dir, err)
+		return
+	}
+	deadline := now.Add(-j.expiry)
+	for _, f := range files {
+		if !f.IsDir() || (j.active != nil && j.active(f.Name())) {
+			continue
+		}
+		path := filepath.Join(j.dir, f.Name())
+		ok, err := expired(path, deadline)
+		if err != nil {
+			log.Printf("warn: couldn't check the storage of the room %v, %v", f.Name(), err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("error: couldn't remove the storage of the room %v, %v", f.Name(), err)
+			continue
+		}
+		removed = append(removed, f.Name())
+	}
+	return
+}
+
+// expired tells if the room dir and all its files (the cloud mark too)
+// haven't been changed since the deadline.
+func expired(dir string, deadline time.Time) (bool, error) {
+	fresh := false
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(deadline) {
+			fresh = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return !fresh, err
+}
@@ -0,0 +1,119 @@
+package janitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+)
+
+var now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newStorage makes the storage with the room files of the ages in days,
+// e.g. room/file.dat: 3, the dirs get the age of their oldest file.
+func newStorage(t *testing.T, files map[string]int) (string, func()) {
+	dir, err := ioutil.TempDir("", "cloud_game_janitor")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	ages := map[string]int{}
+	for name, age := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte{1}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		ages[path] = age
+		for d := filepath.Dir(path); d != dir; d = filepath.Dir(d) {
+			if old, ok := ages[d]; !ok || old < age {
+				ages[d] = age
+			}
+		}
+	}
+	for path, age := range ages {
+		mtime := now.Add(-time.Duration(age) * 24 * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestClean(t *testing.T) {
+	dir, cleanup := newStorage(t, map[string]int{
+		"old/old.dat":                40,
+		"old/old.srm":                31,
+		"fresh/fresh.dat":            40,
+		"fresh/fresh.1.state":        2,
+		"recorded/recorded.dat":      40,
+		"recorded/recordings/1.webm": 1,
+		"cloud/cloud.dat":            40,
+		"cloud/" + CloudMark:         5,
+		"cloud_old/cloud_old.dat":    40,
+		"cloud_old/" + CloudMark:     35,
+		"active/active.dat":          40,
+		"flat.dat":                   40,
+	})
+	defer cleanup()
+	// the new room without the files yet
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	j := New(dir, emulator.StorageCleanup{ExpiryDays: 30}, func(room string) bool { return room == "active" })
+	removed := j.Clean(now)
+	sort.Strings(removed)
+	if got := strings.Join(removed, ","); got != "cloud_old,old" {
+		t.Errorf("wrong removed rooms %v", got)
+	}
+	for _, room := range []string{"fresh", "recorded", "cloud", "active", "empty", "flat.dat"} {
+		if _, err := os.Stat(filepath.Join(dir, room)); err != nil {
+			t.Errorf("the room %v is not kept, %v", room, err)
+		}
+	}
+	for _, room := range removed {
+		if _, err := os.Stat(filepath.Join(dir, room)); !os.IsNotExist(err) {
+			t.Errorf("the room %v is still there", room)
+		}
+	}
+
+	// never expire
+	if removed := New(dir, emulator.StorageCleanup{}, nil).Clean(now.Add(1000 * 24 * time.Hour)); len(removed) > 0 {
+		t.Errorf("the rooms are removed without the expiry %v", removed)
+	}
+}
+
+func TestMarkCloud(t *testing.T) {
+	dir, cleanup := newStorage(t, map[string]int{"room/room.dat": 40})
+	defer cleanup()
+	room := filepath.Join(dir, "room")
+	j := New(dir, emulator.StorageCleanup{ExpiryDays: 30}, nil)
+
+	if err := MarkCloud(room); err != nil {
+		t.Fatalf("couldn't mark the room, %v", err)
+	}
+	// the upload today
+	if removed := j.Clean(time.Now()); len(removed) > 0 {
+		t.Fatalf("the uploaded room is removed")
+	}
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	for _, path := range []string{filepath.Join(room, CloudMark), room} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MarkCloud(room); err != nil {
+		t.Fatalf("couldn't mark the room again, %v", err)
+	}
+	info, err := os.Stat(filepath.Join(room, CloudMark))
+	if err != nil || time.Since(info.ModTime()) > time.Hour {
+		t.Errorf("the mark is not updated, %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"log"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
+)
+
+// defaultMigrationTimeout is how long the exported room waits for the handoff.
+const defaultMigrationTimeout = time.Minute
+
+// handleRoomExport stops the room moving to another worker and
+// returns its migration descriptor after the upload of its state.
+// Both workers should have the same cloud storage.
+func (h *Handler) handleRoomExport() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a room export request of %v from coordinator", resp.RoomID)
+		req.ID = api.RoomExport
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		r := h.getRoom(resp.RoomID)
+		if r == nil {
+			return req
+		}
+		timeout := h.cfg.Room.MigrationTimeout
+		if timeout <= 0 {
+			timeout = defaultMigrationTimeout
+		}
+		m, err := r.ExportState(timeout)
+		if err != nil {
+			log.Printf("error: couldn't export the room %v, %v", r.ID, err)
+			req.Error = err.Error()
+			return req
+		}
+		migration := roomMigration(m)
+		data, err := migration.To()
+		if err != nil {
+			r.Handoff(false)
+			return req
+		}
+		req.Data = data
+		return req
+	}
+}
+
+// handleRoomFork clones the game of the room of the owner session for a new room,
+// it responds with the descriptor of the new room or the error of the fork.
+// The coordinator starts the new room on another worker from the cloud storage,
+// the libretro cores run one game per worker, so the room keeps running here.
+func (h *Handler) handleRoomFork() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a fork request of the room %v from coordinator", resp.RoomID)
+		req.ID = api.RoomFork
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		session := h.getSession(resp.SessionID)
+		r := h.getRoom(resp.RoomID)
+		if session == nil || r == nil {
+			return req
+		}
+		if !r.IsOwner(session.peerconnection) {
+			req.Error = room.ErrNotRoomOwner.Error()
+			return req
+		}
+		m, err := r.Fork("")
+		if err != nil {
+			log.Printf("warn: couldn't fork the room %v, %v", r.ID, err)
+			req.Error = err.Error()
+			return req
+		}
+		migration := roomMigration(m)
+		if data, err := migration.To(); err == nil {
+			req.Data = data
+		}
+		return req
+	}
+}
+
+// roomMigration returns the descriptor of the room moved or forked to another worker.
+func roomMigration(m room.Migration) api.RoomMigration {
+	return api.RoomMigration{
+		RoomID:       m.RoomID,
+		Name:         m.Game.Name,
+		Base:         m.Game.Base,
+		Path:         m.Game.Path,
+		Type:         m.Game.Type,
+		Overrides:    m.Game.Overrides,
+		Hash:         m.Game.Hash,
+		Players:      m.Players,
+		Spectators:   m.Spectators,
+		PasswordHash: m.PasswordHash,
+		Hardcore:     m.Hardcore,
+	}
+}
+
+// handleRoomImport starts the room moved from another worker,
+// the room picks the exported state from the cloud storage.
+func (h *Handler) handleRoomImport() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a room import request of %v from coordinator", resp.RoomID)
+		req.ID = api.RoomImport
+		req.RoomID = resp.RoomID
+		req.Data = "error"
+
+		migration := api.RoomMigration{}
+		if err := migration.From(resp.Data); err != nil {
+			return req
+		}
+		if h.isDraining() || h.getRoom(migration.RoomID) != nil {
+			log.Printf("warn: the room %v can't move here", migration.RoomID)
+			return req
+		}
+		game := games.GameMetadata{Name: migration.Name, Type: migration.Type, Base: migration.Base, Path: migration.Path,
+			Overrides: migration.Overrides, Hash: migration.Hash}
+		// the room is joinable with its password only
+		r, err := h.createNewRoom(game, "", false, migration.RoomID, func(r *room.Room) {
+			r.ImportState(room.Migration{
+				RoomID:       migration.RoomID,
+				Game:         game,
+				Players:      migration.Players,
+				Spectators:   migration.Spectators,
+				PasswordHash: migration.PasswordHash,
+				Hardcore:     migration.Hardcore,
+			})
+		})
+		if err != nil {
+			log.Printf("warn: the room %v can't move here, %v", migration.RoomID, err)
+			return req
+		}
+		go h.watchRoom(r)
+		if err := waitRoom(r); err != nil {
+			log.Printf("warn: the room %v hasn't started here, %v", migration.RoomID, err)
+			return req
+		}
+		h.oClient.Send(api.RegisterRoomPacket(r.ID), nil)
+		req.Data = "ok"
+		return req
+	}
+}
+
+// handleRoomHandoff closes the room moved to another worker
+// or resumes the room which has failed to move.
+func (h *Handler) handleRoomHandoff() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Printf("Received a room handoff of %v (%v) from coordinator", resp.RoomID, resp.Data)
+		if r := h.getRoom(resp.RoomID); r != nil {
+			r.Handoff(resp.Data == "ok")
+		}
+		return cws.EmptyPacket
+	}
+}
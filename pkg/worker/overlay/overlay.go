@@ -0,0 +1,114 @@
+// Package overlay renders the status banners of the rooms
+// (paused, saving, etc.) over their last video frames,
+// so the peers see why the game has stopped.
+// The text is drawn with the built-in bitmap font.
+package overlay
+
+import (
+	"image"
+	"strings"
+)
+
+// Status is the non-running state of the room,
+// the states of the higher values go over the lower ones.
+type Status int
+
+const (
+	Paused Status = iota
+	Saving
+	Recovering
+	Migrating
+	ShuttingDown
+)
+
+// Statuses are all the states.
+var Statuses = []Status{Paused, Saving, Recovering, Migrating, ShuttingDown}
+
+// String returns the text of the banner of the state.
+func (s Status) String() string {
+	switch s {
+	case Paused:
+		return "PAUSED"
+	case Saving:
+		return "SAVING"
+	case Recovering:
+		return "RECOVERING"
+	case Migrating:
+		return "MIGRATING"
+	case ShuttingDown:
+		return "SHUTTING DOWN"
+	default:
+		return ""
+	}
+}
+
+// Banner returns a copy of the frame with the text banner across its middle:
+// the darkened band with the white upper-case text.
+// The glyphs are scaled up to 4/5 of the frame width and 1/8 of its height,
+// the characters without glyphs are blank.
+func Banner(frame *image.RGBA, text string) *image.RGBA {
+	b := frame.Rect
+	w, h := b.Dx(), b.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		copy(out.Pix[y*out.Stride:y*out.Stride+w*4], frame.Pix[frame.PixOffset(b.Min.X, b.Min.Y+y):])
+	}
+	chars := []rune(strings.ToUpper(text))
+	if len(chars) == 0 || w == 0 || h == 0 {
+		return out
+	}
+
+	tw := len(chars)*(glyphWidth+glyphSpace) - glyphSpace
+	scale := w * 4 / 5 / tw
+	if s := h / 8 / glyphHeight; s < scale {
+		scale = s
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	pad := 2 * scale
+	top := (h - glyphHeight*scale - 2*pad) / 2
+	if top < 0 {
+		top = 0
+	}
+	bottom := top + glyphHeight*scale + 2*pad
+	if bottom > h {
+		bottom = h
+	}
+	for y := top; y < bottom; y++ {
+		line := out.Pix[y*out.Stride : y*out.Stride+w*4]
+		for i := 0; i < len(line); i += 4 {
+			line[i], line[i+1], line[i+2], line[i+3] = line[i]/4, line[i+1]/4, line[i+2]/4, 0xff
+		}
+	}
+
+	x0, y0 := (w-tw*scale)/2, top+pad
+	for i, c := range chars {
+		glyph, ok := glyphs[c]
+		if !ok {
+			continue
+		}
+		gx := x0 + i*(glyphWidth+glyphSpace)*scale
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) != 0 {
+					fill(out, gx+col*scale, y0+row*scale, scale)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// fill paints the white square of the size at x, y clipped to the image.
+func fill(img *image.RGBA, x, y, size int) {
+	for py := y; py < y+size && py < img.Rect.Max.Y; py++ {
+		for px := x; px < x+size && px < img.Rect.Max.X; px++ {
+			if px < 0 || py < 0 {
+				continue
+			}
+			i := img.PixOffset(px, py)
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = 0xff, 0xff, 0xff, 0xff
+		}
+	}
+}
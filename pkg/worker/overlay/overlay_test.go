@@ -0,0 +1,110 @@
+package overlay
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden images of the banners")
+
+// testFrame makes a frame with the color gradients.
+func testFrame(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			img.Pix[i] = uint8(x * 255 / w)
+			img.Pix[i+1] = uint8(y * 255 / h)
+			img.Pix[i+2] = uint8((x + y) % 64 * 4)
+			img.Pix[i+3] = 0xff
+		}
+	}
+	return img
+}
+
+// checkGolden compares the frame with the golden image of the testdata.
+func checkGolden(t *testing.T, name string, img *image.RGBA) {
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no golden image %v, %v", path, err)
+	}
+	golden, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("bad golden image %v, %v", path, err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("wrong %v frame size %v, expected %v", name, img.Bounds(), golden.Bounds())
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b, a := golden.At(x, y).RGBA()
+			if c := img.RGBAAt(x, y); c.R != uint8(r>>8) || c.G != uint8(g>>8) || c.B != uint8(b>>8) || c.A != uint8(a>>8) {
+				t.Fatalf("the %v frame differs from the golden image at %v,%v", name, x, y)
+			}
+		}
+	}
+}
+
+func TestBanner(t *testing.T) {
+	for _, status := range Statuses {
+		name := strings.ReplaceAll(strings.ToLower(status.String()), " ", "_")
+		t.Run(name, func(t *testing.T) {
+			frame := testFrame(320, 240)
+			orig := append([]byte(nil), frame.Pix...)
+			out := Banner(frame, status.String())
+			if !bytes.Equal(frame.Pix, orig) {
+				t.Fatalf("the source frame has been changed")
+			}
+			checkGolden(t, name, out)
+		})
+	}
+}
+
+// Tests the banners of the frames too small for their text
+// and the frames of the sub-images.
+func TestBannerClip(t *testing.T) {
+	tests := []struct {
+		frame *image.RGBA
+		text  string
+	}{
+		{frame: testFrame(8, 4), text: ShuttingDown.String()},
+		{frame: testFrame(64, 48).SubImage(image.Rect(10, 10, 42, 34)).(*image.RGBA), text: "paused"},
+		{frame: testFrame(16, 16), text: "?"},
+		{frame: testFrame(16, 16)},
+		{frame: image.NewRGBA(image.Rect(0, 0, 0, 0)), text: "x"},
+	}
+	for _, test := range tests {
+		out := Banner(test.frame, test.text)
+		if out.Rect.Dx() != test.frame.Rect.Dx() || out.Rect.Dy() != test.frame.Rect.Dy() {
+			t.Errorf("wrong banner size %v of %v", out.Rect, test.frame.Rect)
+		}
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	for _, status := range Statuses {
+		for _, c := range status.String() {
+			if _, ok := glyphs[c]; !ok && c != ' ' {
+				t.Errorf("no glyph of %q of %v", c, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package worker
+
+import "github.com/giongto35/cloud-game/v2/pkg/worker/room"
+
+// passwordHashers is the number of the passwords of the rooms hashed at once,
+// bcrypt takes the CPU of the games otherwise.
+const passwordHashers = 2
+
+var hashers = make(chan struct{}, passwordHashers)
+
+// hashPassword returns the hash of the password of the room (see room.HashPassword)
+// before the room is created or changed. The packet handlers run off the read loop
+// of the coordinator connection, so the hashing doesn't hold the other packets,
+// and the handlers wait for their turn of the hashers.
+func hashPassword(password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	hashers <- struct{}{}
+	defer func() { <-hashers }()
+	return room.HashPassword(password)
+}
@@ -0,0 +1,133 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/giongto35/cloud-game/v2/pkg/achievements"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+)
+
+// ErrHardcore is the error of the actions not allowed in the hardcore rooms.
+var ErrHardcore = errors.New("not allowed in the hardcore mode")
+
+// achievementsBuffer is the number of the unlocked achievements
+// the room keeps until they are taken.
+const achievementsBuffer = 16
+
+// Achievement is the achievement unlocked in the room.
+type Achievement struct {
+	achievements.Achievement
+	// the achievement has been unlocked in the hardcore mode
+	Hardcore bool
+}
+
+// roomAchievements checks the achievements of the room game,
+// the hardcore rooms don't load the states and don't apply the cheats.
+type roomAchievements struct {
+	mu       sync.Mutex
+	hardcore bool
+	// nil without the achievements
+	rt       *achievements.Runtime
+	unlocked chan Achievement
+}
+
+// newAchievementsClient makes the API client of the config.
+var newAchievementsClient = func(conf worker.Achievements) *achievements.Client {
+	return achievements.NewClient(conf.Api, conf.User, conf.Token, conf.Cache)
+}
+
+// SetHardcore turns the hardcore mode of the room on or off,
+// the enabled cheats of the hardcore room are removed from the game.
+func (r *Room) SetHardcore(hardcore bool) {
+	r.achievements.mu.Lock()
+	r.achievements.hardcore = hardcore
+	r.achievements.mu.Unlock()
+
+	r.cheats.mu.Lock()
+	defer r.cheats.mu.Unlock()
+	if r.director == nil || len(r.cheats.list) == 0 {
+		return
+	}
+	if err := r.applyCheats(); err != nil {
+		log.Printf("warn: room %v cheats are not applied, %v", r.ID, err)
+	}
+}
+
+// IsHardcore tells if the room is in the hardcore mode.
+func (r *Room) IsHardcore() bool {
+	r.achievements.mu.Lock()
+	defer r.achievements.mu.Unlock()
+	return r.achievements.hardcore
+}
+
+// Achievements returns the achievements unlocked in the room,
+// they are dropped when nobody takes them.
+func (r *Room) Achievements() <-chan Achievement { return r.achievements.unlocked }
+
+// loadAchievements gets the achievements of the game and starts their checks
+// with the current and the future emulators of the room.
+func (r *Room) loadAchievements(gamePath string, conf worker.Achievements) {
+	if conf.Token == "" {
+		return
+	}
+	hash, err := achievements.Hash(gamePath)
+	if err != nil {
+		log.Printf("warn: room %v has no achievements, %v", r.ID, err)
+		return
+	}
+	game, err := newAchievementsClient(conf).Game(hash)
+	if err != nil {
+		log.Printf("warn: room %v has no achievements, %v", r.ID, err)
+		return
+	}
+	rt := achievements.NewRuntime(game.Achievements)
+	if rt.Len() == 0 {
+		return
+	}
+
+	r.saveLock.Lock()
+	defer r.saveLock.Unlock()
+	r.achievements.mu.Lock()
+	r.achievements.rt = rt
+	r.achievements.mu.Unlock()
+	if r.director != nil {
+		r.director.WatchMemory(r.checkAchievements)
+	}
+	log.Printf("Room %v has loaded %v achievements of %v", r.ID, rt.Len(), game.Title)
+}
+
+// runtime returns the achievements of the room, nil without them.
+func (r *roomAchievements) runtime() *achievements.Runtime {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rt
+}
+
+// resetAchievements makes the achievements wait for their conditions again
+// after the jumps of the game state (the state loads, the rewinds, etc.).
+func (r *Room) resetAchievements() {
+	if rt := r.achievements.runtime(); rt != nil {
+		rt.Reset()
+	}
+}
+
+// checkAchievements checks the achievements after the frame of the game.
+// It's called on the emulator thread.
+func (r *Room) checkAchievements(mem []byte) {
+	r.achievements.mu.Lock()
+	rt, hardcore := r.achievements.rt, r.achievements.hardcore
+	r.achievements.mu.Unlock()
+	if rt == nil {
+		return
+	}
+	for _, a := range rt.Frame(mem) {
+		log.Printf("Room %v achievement %v (%v) has been unlocked", r.ID, a.ID, a.Title)
+		select {
+		case r.achievements.unlocked <- Achievement{Achievement: a, Hardcore: hardcore}:
+		default:
+			log.Printf("warn: room %v achievement %v has been dropped", r.ID, a.ID)
+		}
+	}
+}
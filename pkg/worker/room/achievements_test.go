@@ -0,0 +1,98 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/achievements"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// Tests the achievements of the game loaded from the cache
+// and unlocked by the memory of the emulator.
+func TestRoomAchievements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "room_achievements")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	game := filepath.Join(dir, "game.sfc")
+	if err := ioutil.WriteFile(game, []byte("the game"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := achievements.Hash(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := ioutil.ReadFile("../../achievements/testdata/game.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, hash+".json"), patch, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room := newRoom("test_achievements", nil, nil, worker.Config{})
+	room.director = emu
+
+	room.loadAchievements(game, worker.Achievements{})
+	if emu.memoryWatch != nil {
+		t.Fatalf("the achievements have been loaded without the token")
+	}
+	room.loadAchievements(game, worker.Achievements{Api: "http://localhost:1", Token: "token", Cache: dir})
+	if emu.memoryWatch == nil {
+		t.Fatalf("the memory is not watched")
+	}
+
+	room.SetHardcore(true)
+	mem := make([]byte, 0x40)
+	emu.memoryWatch(mem)
+	mem[0x10] = 1
+	emu.memoryWatch(mem)
+	select {
+	case a := <-room.Achievements():
+		if a.ID != 1 || !a.Hardcore {
+			t.Errorf("wrong achievement %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no achievement")
+	}
+}
+
+func TestRoomHardcore(t *testing.T) {
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room := newRoom("test_hardcore", nil, nil, worker.Config{})
+	room.director = emu
+	room.cheats.list = map[int]emulator.Cheat{0: {Index: 0, Code: "SXIOPO", Enabled: true}}
+	if err := room.applyCheats(); err != nil {
+		t.Fatal(err)
+	}
+
+	room.SetHardcore(true)
+	if !room.IsHardcore() {
+		t.Fatalf("the room is not hardcore")
+	}
+	if len(emu.cheats) > 0 {
+		t.Errorf("the cheats of the hardcore room are applied %+v", emu.cheats)
+	}
+	if err := room.EnableCheat(1, "7E0DBE05"); err != ErrHardcore {
+		t.Errorf("wrong cheat error %v", err)
+	}
+	if err := room.LoadGameSlot(1); err != ErrHardcore {
+		t.Errorf("wrong load error %v", err)
+	}
+	if err := room.Rewind(time.Second); err != ErrHardcore {
+		t.Errorf("wrong rewind error %v", err)
+	}
+
+	room.SetHardcore(false)
+	if len(emu.cheats) != 1 {
+		t.Errorf("the cheats are not applied again %+v", emu.cheats)
+	}
+}
@@ -0,0 +1,94 @@
+package room
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+// storageMock is a cloud storage which counts uploads.
+type storageMock struct {
+	uploads int
+	// the keys of the uploads
+	keys []string
+}
+
+func (s *storageMock) Save(_ context.Context, key string, _ io.Reader, _ int64) error {
+	s.uploads++
+	s.keys = append(s.keys, key)
+	return nil
+}
+func (s *storageMock) Load(context.Context, string) (io.ReadCloser, error) {
+	return nil, os.ErrNotExist
+}
+
+// stateEmulatorMock saves its state into a file.
+type stateEmulatorMock struct {
+	*emulatorMock
+	path  string
+	state []byte
+}
+
+func (e *stateEmulatorMock) SaveGameSlot(int) error { return ioutil.WriteFile(e.path, e.state, 0644) }
+func (e *stateEmulatorMock) GetHashPath() string    { return e.path }
+func (e *stateEmulatorMock) GetSlotPath(int) string { return e.path }
+
+func TestAutosaveDeduplication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_autosave")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := &storageMock{}
+	room := newRoom("test_autosave", make(chan nanoarch.InputEvent, 100), store, worker.Config{})
+	emu := &stateEmulatorMock{
+		emulatorMock: &emulatorMock{closed: make(chan struct{})},
+		path:         filepath.Join(dir, "test_autosave.dat"),
+		state:        []byte{1, 2, 3},
+	}
+	room.director = emu
+
+	if !room.LastAutosave().IsZero() {
+		t.Errorf("unexpected autosave time")
+	}
+
+	steps := []struct {
+		state   []byte
+		save    func()
+		uploads int
+	}{
+		{state: []byte{1, 2, 3}, save: room.autosave, uploads: 1},
+		{state: []byte{1, 2, 3}, save: room.autosave, uploads: 1},
+		{state: []byte{1, 2, 3}, save: room.autosave, uploads: 1},
+		{state: []byte{1, 2, 4}, save: room.autosave, uploads: 2},
+		{state: []byte{1, 2, 4}, save: func() { _ = room.SaveGame() }, uploads: 3},
+		{state: []byte{1, 2, 4}, save: room.autosave, uploads: 3},
+		{state: []byte{1, 2, 3}, save: room.autosave, uploads: 4},
+	}
+	for i, step := range steps {
+		emu.state = step.state
+		step.save()
+		flushUploads(t, room)
+		if store.uploads != step.uploads {
+			t.Errorf("step %v: expected %v uploads, got %v", i, step.uploads, store.uploads)
+		}
+	}
+
+	if room.LastAutosave().IsZero() {
+		t.Errorf("no autosave time")
+	}
+
+	room.Close()
+	<-room.Closed()
+	room.autosave()
+	if store.uploads != 5 {
+		t.Errorf("expected the final save only after close, got %v uploads", store.uploads)
+	}
+}
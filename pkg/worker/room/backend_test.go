@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package room
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/hw"
+)
+
+// cpuTime returns the user and system CPU time of the process.
+func cpuTime(b *testing.B) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatalf("no CPU time, %v", err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// benchmarkRoomsPerCore shows how many 60fps 640x480 H264 rooms
+// one CPU core could encode with the backend (software if empty).
+// The hardware encoders are skipped without the hwenc build tag or GPU.
+func benchmarkRoomsPerCore(b *testing.B, backend string) {
+	const w, h = 640, 480
+	conf := testVideoConfig()
+	conf.Backend = backend
+	var enc encoder.Encoder
+	var err error
+	if backend == "" {
+		enc, err = newVideoEncoder(codec.H264, w, h, conf)
+	} else {
+		enc, err = newHwEncoder(codec.H264, w, h, conf)
+	}
+	if err != nil {
+		b.Skipf("no %v encoder, %v", backend, err)
+	}
+
+	b.ResetTimer()
+	start := cpuTime(b)
+	encodeFrames(enc, w, h, b.N, nil, nil, b)
+	cpu := cpuTime(b) - start
+	b.StopTimer()
+	if cpu > 0 {
+		b.ReportMetric(float64(b.N)/60/cpu.Seconds(), "rooms/core")
+	}
+}
+
+func BenchmarkRoomsPerCoreSoftware(b *testing.B) { benchmarkRoomsPerCore(b, "") }
+func BenchmarkRoomsPerCoreVAAPI(b *testing.B)    { benchmarkRoomsPerCore(b, hw.VAAPI) }
+func BenchmarkRoomsPerCoreNVENC(b *testing.B)    { benchmarkRoomsPerCore(b, hw.NVENC) }
@@ -0,0 +1,95 @@
+package room
+
+import (
+	"log"
+	"time"
+)
+
+// bitrateInterval is the min time between two bitrate changes.
+const bitrateInterval = 2 * time.Second
+
+// bitrateControl adapts the video bitrate to the slowest room peer.
+type bitrateControl struct {
+	min, max uint
+	// the current bitrate (kbit/s)
+	current uint
+	last    time.Time
+	now     func() time.Time
+}
+
+func newBitrateControl(min, max uint) *bitrateControl {
+	return &bitrateControl{min: min, max: max, now: time.Now}
+}
+
+// update returns the new bitrate for the estimates of the peers (kbit/s)
+// if it should be changed. The bitrate is the min estimate clamped to
+// the min/max range and it's changed no more often than bitrateInterval.
+// Unknown (zero) estimates are ignored.
+func (b *bitrateControl) update(estimates ...uint) (uint, bool) {
+	if !b.due() {
+		return 0, false
+	}
+	var target uint
+	for _, e := range estimates {
+		if e > 0 && (target == 0 || e < target) {
+			target = e
+		}
+	}
+	if target == 0 {
+		return 0, false
+	}
+	if target < b.min {
+		target = b.min
+	}
+	if target > b.max {
+		target = b.max
+	}
+	if target == b.current {
+		return 0, false
+	}
+	b.current, b.last = target, b.now()
+	return target, true
+}
+
+// due tells if the bitrate can be changed now.
+func (b *bitrateControl) due() bool {
+	return b.max > 0 && (b.last.IsZero() || b.now().Sub(b.last) >= bitrateInterval)
+}
+
+// adaptBitrate changes the video bitrate to fit the connected peers
+// and the bandwidth cap of the room,
+// the peers of the simulcast low layer have the bitrate of their own.
+func (r *Room) adaptBitrate() {
+	r.assignLayers()
+	limit := r.checkEgress()
+	if !r.bitrate.due() {
+		return
+	}
+	var estimates, lowEstimates []uint
+	r.rtcSessions.ForEach(func(webRTC Session) {
+		if !webRTC.IsConnected() {
+			return
+		}
+		if r.layers.target(webRTC.GetId()) == layerLow {
+			lowEstimates = append(lowEstimates, webRTC.EstimatedBitrate())
+		} else {
+			estimates = append(estimates, webRTC.EstimatedBitrate())
+		}
+	})
+	// the bandwidth cap of the room
+	if limit > 0 {
+		estimates, lowEstimates = append(estimates, limit), append(lowEstimates, limit/2)
+	}
+	prev := r.bitrate.current
+	if kbps, ok := r.bitrate.update(estimates...); ok {
+		log.Printf("Room %v video bitrate %v -> %v kbit/s", r.ID, prev, kbps)
+		r.vPipe.SetBitrate(kbps)
+	}
+	if low := r.lowPipe(); low != nil {
+		if kbps, ok := r.lowBitrate.update(lowEstimates...); ok {
+			low.SetBitrate(kbps)
+		}
+	}
+	// the new scale is logged with the resize of the video
+	r.ladder.update(r.bitrate.current)
+}
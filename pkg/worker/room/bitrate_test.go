@@ -0,0 +1,50 @@
+package room
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBitrateControl(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBitrateControl(300, 5000)
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		after     time.Duration
+		estimates []uint
+		want      uint
+		changed   bool
+	}{
+		// the slowest peer
+		{estimates: []uint{2000, 1500, 3000}, want: 1500, changed: true},
+		// too soon
+		{after: time.Second, estimates: []uint{1000}},
+		{after: time.Second, estimates: []uint{1000}, want: 1000, changed: true},
+		// clamped to max
+		{after: 2 * time.Second, estimates: []uint{9000}, want: 5000, changed: true},
+		// the same
+		{after: 2 * time.Second, estimates: []uint{6000, 7000}},
+		// clamped to min
+		{after: 2 * time.Second, estimates: []uint{100, 4000}, want: 300, changed: true},
+		// unknown estimates
+		{after: 2 * time.Second, estimates: []uint{0, 0}},
+		{after: 2 * time.Second},
+		{after: 2 * time.Second, estimates: []uint{0, 800}, want: 800, changed: true},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.after)
+		kbps, changed := b.update(step.estimates...)
+		if changed != step.changed || kbps != step.want {
+			t.Errorf("step %v: got %v (%v), expected %v (%v)", i, kbps, changed, step.want, step.changed)
+		}
+	}
+}
+
+func TestBitrateControlDisabled(t *testing.T) {
+	b := newBitrateControl(0, 0)
+	if kbps, changed := b.update(1000); changed {
+		t.Errorf("the bitrate has changed to %v", kbps)
+	}
+}
@@ -0,0 +1,205 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+const (
+	defaultChatHistory   = 50
+	defaultChatRate      = 1
+	defaultChatMaxLength = 200
+	// the number of the chat messages a peer can send at once
+	// before the rate limit
+	chatBurst = 3
+)
+
+var (
+	ErrChatEmpty   = errors.New("empty chat message")
+	ErrChatTooLong = errors.New("the chat message is too long")
+	ErrChatRate    = errors.New("too many chat messages")
+)
+
+// roomChat is the text chat of the peers of the room.
+// The room keeps the last messages for the peers who join later.
+type roomChat struct {
+	mu sync.Mutex
+	// the ring buffer of the last messages,
+	// next is the place of the next one
+	history []api.ChatMessage
+	next    int
+	full    bool
+	// the rate limits of the peers by their users (see chatKey)
+	limits    map[string]*chatLimit
+	rate      float64
+	maxLength int
+	// send sends the encoded chat message to the peer,
+	// the data channel by default (tests replace it)
+	send func(peer Session, data []byte) error
+}
+
+// chatLimit is the token bucket of the chat messages of a peer.
+type chatLimit struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRoomChat(conf worker.Chat) roomChat {
+	history, rate, maxLength := conf.History, conf.Rate, conf.MaxLength
+	if history <= 0 {
+		history = defaultChatHistory
+	}
+	if rate <= 0 {
+		rate = defaultChatRate
+	}
+	if maxLength <= 0 {
+		maxLength = defaultChatMaxLength
+	}
+	return roomChat{
+		history:   make([]api.ChatMessage, history),
+		limits:    map[string]*chatLimit{},
+		rate:      rate,
+		maxLength: maxLength,
+	}
+}
+
+// chatKey returns the key of the rate limit of the peer,
+// all the peers (reconnects) of a user share one limit.
+func chatKey(peer Session) string {
+	if user := peer.GetUser(); user != "" {
+		return "user:" + user
+	}
+	return peer.GetId()
+}
+
+// allow takes one message from the bucket of the key.
+// Should be called under the chat lock.
+func (c *roomChat) allow(key string, now time.Time) bool {
+	limit := c.limits[key]
+	if limit == nil {
+		limit = &chatLimit{tokens: chatBurst, last: now}
+		c.limits[key] = limit
+	}
+	limit.refill(now, c.rate)
+	if limit.tokens < 1 {
+		return false
+	}
+	limit.tokens--
+	return true
+}
+
+func (l *chatLimit) refill(now time.Time, rate float64) {
+	l.tokens += now.Sub(l.last).Seconds() * rate
+	if l.tokens > chatBurst {
+		l.tokens = chatBurst
+	}
+	l.last = now
+}
+
+// prune removes the full buckets which are the same as the new ones.
+// Should be called under the chat lock.
+func (c *roomChat) prune(now time.Time) {
+	for key, limit := range c.limits {
+		if limit.refill(now, c.rate); limit.tokens >= chatBurst {
+			delete(c.limits, key)
+		}
+	}
+}
+
+// add puts the message into the history.
+// Should be called under the chat lock.
+func (c *roomChat) add(msg api.ChatMessage) {
+	c.history[c.next] = msg
+	c.next = (c.next + 1) % len(c.history)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// last returns the history messages from the oldest one.
+// Should be called under the chat lock.
+func (c *roomChat) last() []api.ChatMessage {
+	if !c.full {
+		return append([]api.ChatMessage(nil), c.history[:c.next]...)
+	}
+	return append(append([]api.ChatMessage(nil), c.history[c.next:]...), c.history[:c.next]...)
+}
+
+// Chat sends the text message of the peer to all the peers of the room,
+// the spectators included. The sender of the message is set by the room.
+func (r *Room) Chat(peer Session, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ErrChatEmpty
+	}
+	if utf8.RuneCountInString(text) > r.chat.maxLength {
+		return ErrChatTooLong
+	}
+	msg := api.ChatMessage{Player: peer.GetPlayerIndex(), Text: text, Time: time.Now().Unix()}
+	if peer.IsSpectator() {
+		msg.Player, msg.Spectator = -1, true
+	}
+
+	r.chat.mu.Lock()
+	if !r.chat.allow(chatKey(peer), time.Now()) {
+		r.chat.mu.Unlock()
+		return ErrChatRate
+	}
+	r.chat.add(msg)
+	r.chat.mu.Unlock()
+
+	out, err := (&api.ControlReply{Cmd: api.ControlChat, Ok: true, Data: msg}).To()
+	if err != nil {
+		return err
+	}
+	for _, p := range r.rtcSessions.snapshot() {
+		if err := r.sendChat(p, []byte(out)); err != nil {
+			log.Printf("warn: couldn't send the chat message to %v, %v", p.GetId(), err)
+		}
+	}
+	return nil
+}
+
+// sendChatHistory sends the last chat messages to the new peer of the room
+// once its control channel is open.
+func (r *Room) sendChatHistory(peer Session) {
+	r.chat.mu.Lock()
+	history := r.chat.last()
+	r.chat.mu.Unlock()
+	for _, msg := range history {
+		out, err := (&api.ControlReply{Cmd: api.ControlChat, Ok: true, Data: msg}).To()
+		if err != nil {
+			continue
+		}
+		if err := r.sendChat(peer, []byte(out)); err != nil {
+			log.Printf("warn: couldn't send the chat history to %v, %v", peer.GetId(), err)
+			return
+		}
+	}
+}
+
+// forgetChat removes the rate limit of the gone peer,
+// the limits of the users are kept until they refill
+// so they can't be reset with a reconnect.
+func (r *Room) forgetChat(peer Session) {
+	r.chat.mu.Lock()
+	if peer.GetUser() == "" {
+		delete(r.chat.limits, peer.GetId())
+	}
+	r.chat.prune(time.Now())
+	r.chat.mu.Unlock()
+}
+
+func (r *Room) sendChat(peer Session, data []byte) error {
+	if r.chat.send != nil {
+		return r.chat.send(peer, data)
+	}
+	return sendControl(peer, data)
+}
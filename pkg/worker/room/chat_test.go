@@ -0,0 +1,160 @@
+package room
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// chatInbox keeps the chat messages sent to the peers.
+type chatInbox struct {
+	mu   sync.Mutex
+	got  map[string][]api.ChatMessage
+	errs []string
+}
+
+func newChatInbox(room *Room) *chatInbox {
+	in := &chatInbox{got: map[string][]api.ChatMessage{}}
+	room.chat.send = func(peer Session, data []byte) error {
+		var reply struct {
+			ID   uint32          `json:"id"`
+			Cmd  string          `json:"cmd"`
+			Data api.ChatMessage `json:"data"`
+		}
+		err := json.Unmarshal(data, &reply)
+		in.mu.Lock()
+		defer in.mu.Unlock()
+		if err != nil || reply.Cmd != api.ControlChat || reply.ID != 0 {
+			in.errs = append(in.errs, string(data))
+		}
+		in.got[peer.GetId()] = append(in.got[peer.GetId()], reply.Data)
+		return nil
+	}
+	return in
+}
+
+func (in *chatInbox) texts(peer string) (texts []string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, msg := range in.got[peer] {
+		texts = append(texts, msg.Text)
+	}
+	return
+}
+
+func TestRoomChat(t *testing.T) {
+	room, peers := newPlayersRoom(2)
+	defer room.Close()
+	spectator := &webrtc.WebRTC{ID: "s", Spectator: true}
+	_ = room.AddConnectionToRoom(spectator, "")
+	for i, peer := range peers {
+		if err := room.UpdatePlayerIndex(peer, i); err != nil {
+			t.Fatalf("couldn't give the player %v, %v", i, err)
+		}
+	}
+	in := newChatInbox(room)
+
+	if err := room.Chat(peers[1], " hi "); err != nil {
+		t.Fatalf("the message is not sent, %v", err)
+	}
+	if err := room.Chat(spectator, "hello"); err != nil {
+		t.Fatalf("the message of the spectator is not sent, %v", err)
+	}
+	for _, id := range []string{peers[0].ID, peers[1].ID, spectator.ID} {
+		in.mu.Lock()
+		got := in.got[id]
+		in.mu.Unlock()
+		if len(got) != 2 {
+			t.Fatalf("wrong messages of %v %+v", id, got)
+		}
+		if got[0].Text != "hi" || got[0].Player != 1 || got[0].Spectator {
+			t.Errorf("wrong player message %+v", got[0])
+		}
+		if got[1].Text != "hello" || got[1].Player != -1 || !got[1].Spectator {
+			t.Errorf("wrong spectator message %+v", got[1])
+		}
+	}
+	if len(in.errs) > 0 {
+		t.Errorf("wrong chat messages %v", in.errs)
+	}
+
+	for _, text := range []string{"", "   ", strings.Repeat("a", defaultChatMaxLength+1)} {
+		if err := room.Chat(peers[0], text); err == nil {
+			t.Errorf("the message %q has been sent", text)
+		}
+	}
+}
+
+func TestRoomChatHistory(t *testing.T) {
+	room := newRoom("test_chat", nil, nil, worker.Config{Room: worker.Room{Chat: worker.Chat{History: 3, Rate: 100}}})
+	defer room.Close()
+	in := newChatInbox(room)
+	sender := &webrtc.WebRTC{ID: "s", Spectator: true}
+	_ = room.AddConnectionToRoom(sender, "")
+	for _, text := range []string{"1", "2", "3", "4", "5"} {
+		if err := room.Chat(sender, text); err != nil {
+			t.Fatalf("the message is not sent, %v", err)
+		}
+		// under the rate
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	late := newSessionMock("late", true)
+	late.closed = true
+	_ = room.AddConnectionToRoom(late, "")
+	if got := in.texts(late.id); len(got) > 0 {
+		t.Errorf("the history %v has been sent before the control channel", got)
+	}
+	late.openControl()
+	if got := strings.Join(in.texts(late.id), ","); got != "3,4,5" {
+		t.Errorf("wrong history %v", got)
+	}
+}
+
+func TestRoomChatRate(t *testing.T) {
+	room := newRoom("test_chat", nil, nil, worker.Config{})
+	defer room.Close()
+	newChatInbox(room)
+	a, b := &webrtc.WebRTC{ID: "a", Spectator: true}, &webrtc.WebRTC{ID: "b", Spectator: true}
+	_ = room.AddConnectionToRoom(a, "")
+	_ = room.AddConnectionToRoom(b, "")
+
+	for i := 0; i < chatBurst; i++ {
+		if err := room.Chat(a, "spam"); err != nil {
+			t.Fatalf("the message %v of the burst is not sent, %v", i, err)
+		}
+	}
+	if err := room.Chat(a, "spam"); err != ErrChatRate {
+		t.Errorf("wrong error over the rate %v", err)
+	}
+	// the limits are per peer
+	if err := room.Chat(b, "hi"); err != nil {
+		t.Errorf("the message of another peer is not sent, %v", err)
+	}
+
+	// the reconnects of a user share the limit
+	user, again := newSessionMock("u1", true), newSessionMock("u2", true)
+	user.user, again.user = "user", "user"
+	_ = room.AddConnectionToRoom(user, "")
+	for i := 0; i < chatBurst; i++ {
+		_ = room.Chat(user, "spam")
+	}
+	room.RemoveSession(user)
+	_ = room.AddConnectionToRoom(again, "")
+	if err := room.Chat(again, "spam"); err != ErrChatRate {
+		t.Errorf("the limit of the user has been reset with the reconnect, %v", err)
+	}
+
+	// over the control channel
+	out := room.handleControl(a, []byte(`{"id":7,"cmd":"chat","text":"spam"}`))
+	var reply api.ControlReply
+	if err := reply.From(string(out)); err != nil || reply.ID != 7 || reply.Ok || reply.Error != ErrChatRate.Error() {
+		t.Errorf("wrong reply %s", out)
+	}
+}
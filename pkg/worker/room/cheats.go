@@ -0,0 +1,118 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+var ErrNoCheat = errors.New("no such cheat")
+
+// cheatList keeps all the known cheats of the room game by their indices,
+// only the enabled ones are applied.
+type cheatList struct {
+	mu   sync.Mutex
+	list map[int]emulator.Cheat
+}
+
+// loadCheats reads the cheat file of the game with the hash
+// and enables its enabled cheats.
+func (r *Room) loadCheats(hash string, dir string) {
+	if dir == "" || hash == "" {
+		return
+	}
+	cheats, err := emulator.LoadCheats(dir, hash)
+	if err != nil {
+		log.Printf("warn: room %v cheats are not loaded, %v", r.ID, err)
+		return
+	}
+	if len(cheats) == 0 {
+		return
+	}
+
+	r.cheats.mu.Lock()
+	defer r.cheats.mu.Unlock()
+	r.cheats.list = make(map[int]emulator.Cheat, len(cheats))
+	for _, cheat := range cheats {
+		r.cheats.list[cheat.Index] = cheat
+	}
+	if err := r.applyCheats(); err != nil {
+		log.Printf("warn: room %v cheats are not applied, %v", r.ID, err)
+	}
+	log.Printf("Room %v has loaded %v cheats", r.ID, len(cheats))
+}
+
+// EnableCheat enables the cheat with the index.
+// Without the code it enables the cheat loaded from the game cheat file.
+// The hardcore rooms don't enable the cheats.
+func (r *Room) EnableCheat(index int, code string) error {
+	if r.IsHardcore() {
+		return ErrHardcore
+	}
+	r.cheats.mu.Lock()
+	defer r.cheats.mu.Unlock()
+
+	cheat, ok := r.cheats.list[index]
+	if code == "" && !ok {
+		return ErrNoCheat
+	}
+	if code != "" {
+		if err := emulator.ValidateCheat(code); err != nil {
+			return err
+		}
+		cheat = emulator.Cheat{Index: index, Code: code}
+	}
+	cheat.Enabled = true
+	return r.setCheat(cheat, ok)
+}
+
+// DisableCheat disables the cheat with the index.
+func (r *Room) DisableCheat(index int) error {
+	r.cheats.mu.Lock()
+	defer r.cheats.mu.Unlock()
+
+	cheat, ok := r.cheats.list[index]
+	if !ok {
+		return ErrNoCheat
+	}
+	cheat.Enabled = false
+	return r.setCheat(cheat, true)
+}
+
+// setCheat replaces the cheat of the list and applies the list,
+// the previous cheat is restored on errors.
+// Should be called under the cheats lock.
+func (r *Room) setCheat(cheat emulator.Cheat, existed bool) error {
+	if r.cheats.list == nil {
+		r.cheats.list = map[int]emulator.Cheat{}
+	}
+	prev := r.cheats.list[cheat.Index]
+	r.cheats.list[cheat.Index] = cheat
+	if err := r.applyCheats(); err != nil {
+		if existed {
+			r.cheats.list[cheat.Index] = prev
+		} else {
+			delete(r.cheats.list, cheat.Index)
+		}
+		return err
+	}
+	return nil
+}
+
+// applyCheats passes the enabled cheats into the emulator ordered by their indices,
+// the hardcore rooms have no cheats.
+// Should be called under the cheats lock.
+func (r *Room) applyCheats() error {
+	var enabled []emulator.Cheat
+	hardcore := r.IsHardcore()
+	for _, cheat := range r.cheats.list {
+		if cheat.Enabled && !hardcore {
+			enabled = append(enabled, cheat)
+		}
+	}
+	sort.Slice(enabled, func(i, j int) bool { return enabled[i].Index < enabled[j].Index })
+	return r.director.ApplyCheats(enabled)
+}
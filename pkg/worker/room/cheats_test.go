@@ -0,0 +1,73 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+func TestRoomCheats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "room_cheats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	game := filepath.Join(dir, "game.nes")
+	if err := ioutil.WriteFile(game, []byte("NES\x1a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := emulator.GameHash(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "cheats = 2\ncheat0_code = SXIOPO\ncheat0_enable = true\ncheat1_code = AAAA-BBBB\n"
+	if err := ioutil.WriteFile(emulator.CheatFile(dir, hash), []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room := newRoom("test_cheats", nil, nil, worker.Config{})
+	room.director = emu
+
+	room.loadCheats(hash, dir)
+	want := []emulator.Cheat{{Index: 0, Code: "SXIOPO", Enabled: true}}
+	if !reflect.DeepEqual(emu.cheats, want) {
+		t.Errorf("wrong loaded cheats %+v", emu.cheats)
+	}
+
+	if err := room.EnableCheat(1, ""); err != nil {
+		t.Fatalf("file cheat is not enabled, %v", err)
+	}
+	if err := room.EnableCheat(5, "7E0DBE05"); err != nil {
+		t.Fatalf("new cheat is not enabled, %v", err)
+	}
+	if err := room.DisableCheat(0); err != nil {
+		t.Fatalf("cheat is not disabled, %v", err)
+	}
+	want = []emulator.Cheat{
+		{Index: 1, Code: "AAAA-BBBB", Enabled: true},
+		{Index: 5, Code: "7E0DBE05", Enabled: true},
+	}
+	if !reflect.DeepEqual(emu.cheats, want) {
+		t.Errorf("wrong cheats\n got: %+v\nwant: %+v", emu.cheats, want)
+	}
+
+	if err := room.EnableCheat(2, ""); err != ErrNoCheat {
+		t.Errorf("expected no cheat error, got %v", err)
+	}
+	if err := room.DisableCheat(7); err != ErrNoCheat {
+		t.Errorf("expected no cheat error, got %v", err)
+	}
+	if err := room.EnableCheat(3, "bad;code"); err == nil {
+		t.Errorf("malformed cheat is enabled")
+	}
+	if !reflect.DeepEqual(emu.cheats, want) {
+		t.Errorf("errors have changed the cheats %+v", emu.cheats)
+	}
+}
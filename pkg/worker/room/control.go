@@ -0,0 +1,195 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+const (
+	// max size of the control commands,
+	// they are small and anything bigger is garbage
+	maxControlCommandSize = 1024
+	// max size of the replies that fits into one data channel message
+	maxControlReplySize = 64 * 1024
+	screenshotTimeout   = time.Second
+)
+
+var (
+	ErrMalformedCommand = errors.New("malformed command")
+	ErrUnknownCommand   = errors.New("unknown command")
+	ErrTooLarge         = errors.New("the reply is too large")
+)
+
+// controlCommand runs the control command of the peer and
+// returns the reply data.
+type controlCommand struct {
+	// only players, not spectators, can use it
+	players bool
+	run     func(r *Room, peer Session, cmd api.ControlCommand) (interface{}, error)
+}
+
+var controlCommands = map[string]controlCommand{
+	api.ControlSave: {players: true, run: func(r *Room, _ Session, _ api.ControlCommand) (interface{}, error) {
+		return nil, r.SaveGame()
+	}},
+	api.ControlLoad: {players: true, run: func(r *Room, _ Session, _ api.ControlCommand) (interface{}, error) {
+		return nil, r.LoadGame()
+	}},
+	api.ControlSaveSlot: {players: true, run: func(r *Room, _ Session, cmd api.ControlCommand) (interface{}, error) {
+		return nil, r.SaveGameSlot(cmd.Slot)
+	}},
+	api.ControlLoadSlot: {players: true, run: func(r *Room, _ Session, cmd api.ControlCommand) (interface{}, error) {
+		return nil, r.LoadGameSlot(cmd.Slot)
+	}},
+	api.ControlPause: {players: true, run: func(r *Room, peer Session, _ api.ControlCommand) (interface{}, error) {
+		paused, err := r.TogglePause(peer)
+		return api.GamePauseResponse{Paused: paused}, err
+	}},
+	api.ControlMultitap: {players: true, run: func(r *Room, _ Session, _ api.ControlCommand) (interface{}, error) {
+		return nil, r.ToggleMultitap()
+	}},
+	api.ControlPorts: {run: func(r *Room, _ Session, _ api.ControlCommand) (interface{}, error) {
+		return r.Ports(), nil
+	}},
+	api.ControlPortDevice: {players: true, run: func(r *Room, _ Session, cmd api.ControlCommand) (interface{}, error) {
+		if err := r.SetPortDevice(cmd.Port, cmd.Device); err != nil {
+			return nil, err
+		}
+		return r.Ports(), nil
+	}},
+	api.ControlKeyboard: {players: true, run: func(r *Room, peer Session, cmd api.ControlCommand) (interface{}, error) {
+		if !r.IsOwner(peer) {
+			return nil, ErrNotRoomOwner
+		}
+		if err := r.CaptureKeyboard(cmd.Session); err != nil {
+			return nil, err
+		}
+		return api.KeyboardResponse{Holder: r.KeyboardHolder()}, nil
+	}},
+	api.ControlInputDelay: {players: true, run: func(r *Room, peer Session, cmd api.ControlCommand) (interface{}, error) {
+		if !r.IsOwner(peer) {
+			return nil, ErrNotRoomOwner
+		}
+		if err := r.SetInputDelay(cmd.Frames); err != nil {
+			return nil, err
+		}
+		return api.InputDelayResponse{Frames: r.InputDelay()}, nil
+	}},
+	api.ControlScreenshot: {run: func(r *Room, _ Session, _ api.ControlCommand) (interface{}, error) {
+		// the JPEG thumbnail in base64, the full screenshots (PNG)
+		// are too large for the replies, they are on the coordinator
+		return r.ScreenshotThumbnail(screenshotTimeout)
+	}},
+	api.ControlVolume: {run: func(r *Room, peer Session, cmd api.ControlCommand) (interface{}, error) {
+		peer.SetVolume(cmd.Volume)
+		if err := r.SaveProfile(peer); err != nil {
+			log.Printf("warn: room %v couldn't save the profile of the session %v, %v", r.ID, peer.GetId(), err)
+		}
+		return api.AudioVolumeResponse{Volume: peer.Volume(), Muted: peer.Muted()}, nil
+	}},
+	api.ControlChat: {run: func(r *Room, peer Session, cmd api.ControlCommand) (interface{}, error) {
+		return nil, r.Chat(peer, cmd.Text)
+	}},
+	api.ControlLeave: {run: func(r *Room, peer Session, _ api.ControlCommand) (interface{}, error) {
+		// the peer gets the reply if it's still there
+		go r.ReleaseSeat(peer)
+		return nil, nil
+	}},
+	api.ControlMute: {run: func(_ *Room, peer Session, cmd api.ControlCommand) (interface{}, error) {
+		peer.SetMuted(cmd.Muted)
+		return api.AudioVolumeResponse{Volume: peer.Volume(), Muted: peer.Muted()}, nil
+	}},
+}
+
+// peerControls are the stops of the control loops of the peers of the room,
+// the peers switching the rooms keep their control channels.
+type peerControls struct {
+	mu    sync.Mutex
+	stops map[string]chan struct{}
+}
+
+// start returns the stop of the new control loop of the peer,
+// the old loop of the peer is stopped.
+func (c *peerControls) start(id string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stops == nil {
+		c.stops = map[string]chan struct{}{}
+	}
+	if stop, ok := c.stops[id]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	c.stops[id] = stop
+	return stop
+}
+
+// stop stops the control loop of the peer.
+func (c *peerControls) stop(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stop, ok := c.stops[id]; ok {
+		close(stop)
+		delete(c.stops, id)
+	}
+}
+
+// startControl handles the control commands of the peer
+// until the peer leaves or the room is done.
+func (r *Room) startControl(peer Session, stop <-chan struct{}) {
+	for {
+		select {
+		case <-r.Done:
+			return
+		case <-stop:
+			return
+		case data, ok := <-peer.GetControlChannel():
+			if !ok {
+				return
+			}
+			if err := peer.SendControl(r.handleControl(peer, data)); err != nil {
+				log.Printf("warn: couldn't reply to the control command of %v, %v", peer.GetId(), err)
+			}
+		}
+	}
+}
+
+// handleControl runs the encoded control command of the peer,
+// returns the encoded reply.
+func (r *Room) handleControl(peer Session, data []byte) []byte {
+	var cmd api.ControlCommand
+	reply := api.ControlReply{}
+	err := ErrMalformedCommand
+	if len(data) <= maxControlCommandSize && cmd.From(string(data)) == nil {
+		reply.ID, reply.Cmd = cmd.ID, cmd.Cmd
+		reply.Data, err = r.runControl(peer, cmd)
+	}
+	if err != nil {
+		reply.Data, reply.Error = nil, err.Error()
+	}
+	reply.Ok = err == nil
+
+	out, err := reply.To()
+	if err == nil && len(out) > maxControlReplySize {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		out, _ = (&api.ControlReply{ID: reply.ID, Cmd: reply.Cmd, Error: err.Error()}).To()
+	}
+	return []byte(out)
+}
+
+func (r *Room) runControl(peer Session, cmd api.ControlCommand) (interface{}, error) {
+	command, ok := controlCommands[cmd.Cmd]
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+	if command.players && peer.IsSpectator() {
+		return nil, ErrSpectator
+	}
+	return command.run(r, peer, cmd)
+}
@@ -0,0 +1,164 @@
+package room
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestControlCodec(t *testing.T) {
+	cmd := api.ControlCommand{ID: 42, Cmd: api.ControlLoadSlot, Slot: 3}
+	data, err := cmd.To()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != `{"id":42,"cmd":"load_slot","slot":3}` {
+		t.Errorf("wrong encoded command %v", data)
+	}
+	var decoded api.ControlCommand
+	if err := decoded.From(data); err != nil || decoded != cmd {
+		t.Errorf("wrong decoded command %+v, %v", decoded, err)
+	}
+
+	reply := api.ControlReply{ID: 42, Cmd: api.ControlPause, Ok: true, Data: api.GamePauseResponse{Paused: true}}
+	if data, _ := reply.To(); data != `{"id":42,"cmd":"pause","ok":true,"data":{"paused":true}}` {
+		t.Errorf("wrong encoded reply %v", data)
+	}
+}
+
+func TestControlCommands(t *testing.T) {
+	players := map[string]bool{
+		api.ControlSave:       true,
+		api.ControlLoad:       true,
+		api.ControlSaveSlot:   true,
+		api.ControlLoadSlot:   true,
+		api.ControlPause:      true,
+		api.ControlMultitap:   true,
+		api.ControlScreenshot: false,
+		api.ControlPorts:      false,
+		api.ControlPortDevice: true,
+		api.ControlKeyboard:   true,
+		api.ControlVolume:     false,
+		api.ControlMute:       false,
+	}
+	if len(controlCommands) != len(players) {
+		t.Errorf("expected %v commands, got %v", len(players), len(controlCommands))
+	}
+	for name, onlyPlayers := range players {
+		cmd, ok := controlCommands[name]
+		if !ok {
+			t.Errorf("no %v command", name)
+			continue
+		}
+		if cmd.players != onlyPlayers {
+			t.Errorf("wrong %v command authorization", name)
+		}
+	}
+}
+
+func TestControlDispatch(t *testing.T) {
+	room, _, emu := newIdleRoom(0)
+	defer room.Close()
+	emu.ports = []emulator.Port{{Device: 1, Devices: []emulator.Device{{ID: 1, Name: "Joypad"}, {ID: 2, Name: "Mouse"}}}}
+	player := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+	spectator := &webrtc.WebRTC{ID: "2", InputChannel: make(chan []byte, 1), Spectator: true}
+	ports := func(device float64) []interface{} {
+		return []interface{}{map[string]interface{}{"device": device, "devices": []interface{}{
+			map[string]interface{}{"id": 1.0, "name": "Joypad"},
+			map[string]interface{}{"id": 2.0, "name": "Mouse"},
+		}}}
+	}
+
+	control := func(peer *webrtc.WebRTC, cmd string) api.ControlReply {
+		var reply api.ControlReply
+		if err := json.Unmarshal(room.handleControl(peer, []byte(cmd)), &reply); err != nil {
+			t.Fatalf("bad reply, %v", err)
+		}
+		return reply
+	}
+
+	tests := []struct {
+		peer *webrtc.WebRTC
+		cmd  string
+		want api.ControlReply
+	}{
+		{peer: player, cmd: `{"id":1,"cmd":"multitap"}`, want: api.ControlReply{ID: 1, Cmd: "multitap", Ok: true}},
+		{peer: player, cmd: `{"id":2,"cmd":"load_slot","slot":2}`, want: api.ControlReply{ID: 2, Cmd: "load_slot", Ok: true}},
+		{peer: player, cmd: `{"id":3,"cmd":"pause"}`,
+			want: api.ControlReply{ID: 3, Cmd: "pause", Ok: true, Data: map[string]interface{}{"paused": true}}},
+		{peer: spectator, cmd: `{"id":4,"cmd":"save"}`, want: api.ControlReply{ID: 4, Cmd: "save", Error: ErrSpectator.Error()}},
+		{peer: spectator, cmd: `{"id":5,"cmd":"pause"}`, want: api.ControlReply{ID: 5, Cmd: "pause", Error: ErrSpectator.Error()}},
+		{peer: player, cmd: `{"id":6,"cmd":"format_c"}`, want: api.ControlReply{ID: 6, Cmd: "format_c", Error: ErrUnknownCommand.Error()}},
+		{peer: spectator, cmd: `{"id":8,"cmd":"volume","volume":40}`,
+			want: api.ControlReply{ID: 8, Cmd: "volume", Ok: true, Data: map[string]interface{}{"volume": 40.0, "muted": false}}},
+		{peer: spectator, cmd: `{"id":9,"cmd":"mute","muted":true}`,
+			want: api.ControlReply{ID: 9, Cmd: "mute", Ok: true, Data: map[string]interface{}{"volume": 40.0, "muted": true}}},
+		{peer: spectator, cmd: `{"id":10,"cmd":"ports"}`, want: api.ControlReply{ID: 10, Cmd: "ports", Ok: true, Data: ports(1)}},
+		{peer: spectator, cmd: `{"id":11,"cmd":"port_device","device":2}`,
+			want: api.ControlReply{ID: 11, Cmd: "port_device", Error: ErrSpectator.Error()}},
+		{peer: player, cmd: `{"id":12,"cmd":"port_device","port":1,"device":2}`,
+			want: api.ControlReply{ID: 12, Cmd: "port_device", Error: "unsupported device"}},
+		{peer: player, cmd: `{"id":13,"cmd":"port_device","device":2}`,
+			want: api.ControlReply{ID: 13, Cmd: "port_device", Ok: true, Data: ports(2)}},
+		{peer: player, cmd: `{"id":14,"cmd":"keyboard","session":"2"}`,
+			want: api.ControlReply{ID: 14, Cmd: "keyboard", Error: ErrNotRoomOwner.Error()}},
+		{peer: player, cmd: `save`, want: api.ControlReply{Error: ErrMalformedCommand.Error()}},
+		{peer: player, cmd: `{"id":7,"cmd":"` + strings.Repeat("a", 2000) + `"}`, want: api.ControlReply{Error: ErrMalformedCommand.Error()}},
+	}
+	for _, test := range tests {
+		if got := control(test.peer, test.cmd); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrong reply to %.32v\n got: %+v\nwant: %+v", test.cmd, got, test.want)
+		}
+	}
+	if !emu.paused {
+		t.Errorf("the pause command wasn't dispatched")
+	}
+}
+
+// Tests that only the new room of the peer which has switched the rooms
+// runs its control commands.
+func TestControlRoomSwitch(t *testing.T) {
+	from, _, fromEmu := newIdleRoom(0)
+	defer from.Close()
+	to, _, toEmu := newIdleRoom(0)
+	defer to.Close()
+	fromEmu.ports = []emulator.Port{{Device: 1}}
+	toEmu.ports = []emulator.Port{{Device: 2}}
+
+	peer := newSessionMock("1", true)
+	if err := from.AddConnectionToRoom(peer, ""); err != nil {
+		t.Fatal(err)
+	}
+	from.RemoveSession(peer)
+	if err := to.AddConnectionToRoom(peer, ""); err != nil {
+		t.Fatal(err)
+	}
+	const commands = 10
+	for i := 0; i < commands; i++ {
+		peer.control <- []byte(`{"id":1,"cmd":"ports"}`)
+	}
+	var replies [][]byte
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && len(replies) < commands; {
+		time.Sleep(time.Millisecond)
+		peer.mu.Lock()
+		replies = append([][]byte(nil), peer.controls...)
+		peer.mu.Unlock()
+	}
+	if len(replies) != commands {
+		t.Fatalf("%v replies to %v commands", len(replies), commands)
+	}
+	for _, data := range replies {
+		var reply struct {
+			Data []emulator.Port `json:"data"`
+		}
+		if err := json.Unmarshal(data, &reply); err != nil || len(reply.Data) != 1 || reply.Data[0].Device != 2 {
+			t.Errorf("the command has been run by the old room, %s", data)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+// maxInputDelay is the max input delay of the rooms in frames.
+const maxInputDelay = 15
+
+// maxDelayedInputs is the max number of the held events,
+// the frames (and the queue) stop while the game is paused.
+const maxDelayedInputs = 256
+
+var ErrInputDelay = errors.New("wrong input delay")
+
+// delayedInput is the input event waiting for its frame.
+type delayedInput struct {
+	event nanoarch.InputEvent
+	due   uint64
+}
+
+// inputDelay holds the input of the multi-player rooms for the same number
+// of the frames of the game, so all the players get the same latency
+// of their input whatever their network latency is.
+type inputDelay struct {
+	mu sync.Mutex
+	// the delay of the rooms with two or more players, 0 -- none
+	frames int
+	// the last frame of the emulator
+	frame uint64
+	// the held events in the order of their arrival
+	queue []delayedInput
+}
+
+func newInputDelay(roomID string, frames int) inputDelay {
+	if frames < 0 || frames > maxInputDelay {
+		log.Printf("warn: room %v has no input delay, %v frames is out of 0-%v", roomID, frames, maxInputDelay)
+		frames = 0
+	}
+	return inputDelay{frames: frames}
+}
+
+// InputDelay returns the input delay of the room in frames.
+func (r *Room) InputDelay() int {
+	r.delay.mu.Lock()
+	defer r.delay.mu.Unlock()
+	return r.delay.frames
+}
+
+// SetInputDelay sets the input delay of the room in frames,
+// it's used only while the room has two or more players.
+func (r *Room) SetInputDelay(frames int) error {
+	if frames < 0 || frames > maxInputDelay {
+		return ErrInputDelay
+	}
+	r.delay.mu.Lock()
+	r.delay.frames = frames
+	r.delay.mu.Unlock()
+	log.Printf("Room %v input delay is %v frames", r.ID, frames)
+	return nil
+}
+
+// hasPlayers tells if the room has more than one player.
+func (r *Room) hasPlayers() bool {
+	n := 0
+	for _, peer := range r.rtcSessions.snapshot() {
+		if !peer.IsSpectator() {
+			n++
+		}
+	}
+	return n > 1
+}
+
+// queueInput sends the input event to the emulator after the input delay
+// of the room, the events of the rooms without the delay go at once.
+// The events always go in the order of their arrival,
+// the new ones are dropped while the queue is full as with the emulator.
+func (r *Room) queueInput(event nanoarch.InputEvent) {
+	players := r.hasPlayers()
+	r.delay.mu.Lock()
+	delay := r.delay.frames
+	if !players {
+		delay = 0
+	}
+	if delay == 0 && len(r.delay.queue) == 0 {
+		r.delay.mu.Unlock()
+		r.sendInput(event)
+		return
+	}
+	if len(r.delay.queue) >= maxDelayedInputs {
+		r.delay.mu.Unlock()
+		return
+	}
+	r.delay.queue = append(r.delay.queue, delayedInput{event: event, due: r.delay.frame + uint64(delay)})
+	r.delay.mu.Unlock()
+}
+
+// onFrame sends the held events due by the frame of the emulator,
+// they go into the next frame.
+// It's called on the emulator thread after each frame.
+func (r *Room) onFrame(frame uint64) {
+	r.delay.mu.Lock()
+	r.delay.frame = frame
+	n := 0
+	for n < len(r.delay.queue) && r.delay.queue[n].due <= frame {
+		n++
+	}
+	due := r.delay.queue[:n:n]
+	r.delay.queue = r.delay.queue[n:]
+	r.delay.mu.Unlock()
+
+	for _, e := range due {
+		r.sendInput(e.event)
+	}
+}
+
+// resetInputDelay sends all the held events at once
+// and starts counting the frames of the new emulator.
+func (r *Room) resetInputDelay() {
+	r.delay.mu.Lock()
+	due := r.delay.queue
+	r.delay.queue, r.delay.frame = nil, 0
+	r.delay.mu.Unlock()
+
+	for _, e := range due {
+		r.sendInput(e.event)
+	}
+}
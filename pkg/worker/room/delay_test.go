@@ -0,0 +1,143 @@
+package room
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// newDelayRoom makes the room of the players with its input.
+func newDelayRoom(players int) (*Room, []*webrtc.WebRTC, chan nanoarch.InputEvent) {
+	input := make(chan nanoarch.InputEvent, 100)
+	room := newRoom("test_delay", input, nil, worker.Config{})
+	var peers []*webrtc.WebRTC
+	for i := 0; i < players; i++ {
+		peer := &webrtc.WebRTC{ID: strconv.Itoa(i), InputChannel: make(chan []byte, 1)}
+		_ = room.AddConnectionToRoom(peer, "")
+		peers = append(peers, peer)
+	}
+	return room, peers, input
+}
+
+// takeInputs returns the connections of the events the room has sent to the emulator.
+func takeInputs(input chan nanoarch.InputEvent) (ids []string) {
+	for {
+		select {
+		case e := <-input:
+			ids = append(ids, e.ConnID)
+		default:
+			return
+		}
+	}
+}
+
+// Tests that the input of the players goes to the emulator
+// the same number of the frames after its arrival
+// whatever the arrival time within the frames is.
+func TestRoomInputDelay(t *testing.T) {
+	room, _, input := newDelayRoom(2)
+	defer room.Close()
+	const delay = 3
+	if err := room.SetInputDelay(delay); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events arrived after the frames (by their connection IDs)
+	arrivals := map[uint64][]string{
+		1: {"a"},
+		2: {"b", "c"},
+		4: {"d"},
+		5: {"e", "f", "g"},
+		9: {"h"},
+	}
+	expected := map[uint64][]string{}
+	for frame, ids := range arrivals {
+		expected[frame+delay] = ids
+	}
+	for frame := uint64(1); frame <= 15; frame++ {
+		room.onFrame(frame)
+		got := takeInputs(input)
+		if len(got) != len(expected[frame]) {
+			t.Fatalf("frame %v: wrong events %v, expected %v", frame, got, expected[frame])
+		}
+		for i := range got {
+			if got[i] != expected[frame][i] {
+				t.Fatalf("frame %v: wrong events %v, expected %v", frame, got, expected[frame])
+			}
+		}
+		for _, id := range arrivals[frame] {
+			room.queueInput(nanoarch.InputEvent{RawState: []byte{1, 0}, ConnID: id})
+		}
+	}
+}
+
+func TestRoomInputDelayOnePlayer(t *testing.T) {
+	room, peers, input := newDelayRoom(1)
+	defer room.Close()
+	if err := room.SetInputDelay(5); err != nil {
+		t.Fatal(err)
+	}
+	room.onFrame(1)
+	room.queueInput(nanoarch.InputEvent{RawState: []byte{1, 0}, ConnID: peers[0].ID})
+	if got := takeInputs(input); len(got) != 1 {
+		t.Errorf("the input of the single player has been delayed")
+	}
+
+	for _, frames := range []int{-1, maxInputDelay + 1} {
+		if err := room.SetInputDelay(frames); err != ErrInputDelay {
+			t.Errorf("wrong error of the delay %v, %v", frames, err)
+		}
+	}
+	if n := room.InputDelay(); n != 5 {
+		t.Errorf("wrong delay %v", n)
+	}
+}
+
+// Tests that the held events go at once with the new emulator.
+func TestRoomInputDelayReset(t *testing.T) {
+	room, peers, input := newDelayRoom(2)
+	defer room.Close()
+	_ = room.SetInputDelay(10)
+	room.onFrame(100)
+	room.queueInput(nanoarch.InputEvent{RawState: []byte{1, 0}, ConnID: peers[0].ID})
+	room.queueInput(nanoarch.InputEvent{RawState: []byte{1, 0}, ConnID: peers[1].ID})
+	if got := takeInputs(input); len(got) != 0 {
+		t.Fatalf("the input has not been delayed %v", got)
+	}
+
+	room.resetInputDelay()
+	if got := takeInputs(input); len(got) != 2 || got[0] != peers[0].ID {
+		t.Errorf("wrong events after the reset %v", got)
+	}
+	// the frames of the new emulator
+	room.onFrame(1)
+	room.queueInput(nanoarch.InputEvent{RawState: []byte{1, 0}, ConnID: peers[0].ID})
+	room.onFrame(10)
+	if got := takeInputs(input); len(got) != 0 {
+		t.Errorf("the input has gone early %v", got)
+	}
+	room.onFrame(11)
+	if got := takeInputs(input); len(got) != 1 {
+		t.Errorf("the input has not gone %v", got)
+	}
+}
+
+// Tests that the held events of the paused game (no frames) are capped.
+func TestRoomInputDelayPaused(t *testing.T) {
+	room, peers, _ := newDelayRoom(2)
+	defer room.Close()
+	_ = room.SetInputDelay(5)
+	room.onFrame(1)
+	for i := 0; i < maxDelayedInputs*2; i++ {
+		room.queueInput(nanoarch.InputEvent{RawState: []byte{1, 0}, ConnID: peers[0].ID})
+	}
+	room.delay.mu.Lock()
+	n := len(room.delay.queue)
+	room.delay.mu.Unlock()
+	if n != maxDelayedInputs {
+		t.Errorf("wrong number %v of the held events", n)
+	}
+}
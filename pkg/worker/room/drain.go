@@ -0,0 +1,34 @@
+package room
+
+import (
+	"log"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/overlay"
+)
+
+// Drain saves the game and tells the peers of the room
+// that the server is shutting down after that (the game is saved).
+// The room keeps running until it's closed, but its saves are uploaded.
+func (r *Room) Drain() error {
+	r.status.set(overlay.ShuttingDown, true)
+	if err := r.SaveGame(); err != nil {
+		return err
+	}
+	r.sendControlEvent(api.ControlShutdown, nil)
+	return r.uploads.flush(uploadFlushTimeout)
+}
+
+// sendControlEvent sends the event with its data, if any, to all the peers
+// of the room over their control channels as a reply without ID.
+func (r *Room) sendControlEvent(cmd string, data interface{}) {
+	out, err := (&api.ControlReply{Cmd: cmd, Ok: true, Data: data}).To()
+	if err != nil {
+		return
+	}
+	r.rtcSessions.ForEach(func(peer Session) {
+		if err := peer.SendControl([]byte(out)); err != nil {
+			log.Printf("warn: couldn't send %v to %v, %v", cmd, peer.GetId(), err)
+		}
+	})
+}
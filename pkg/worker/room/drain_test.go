@@ -0,0 +1,68 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+func TestRoomDrain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_drain")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := &storageMock{}
+	room := newRoom("test_drain", make(chan nanoarch.InputEvent, 100), store, worker.Config{})
+	defer room.Close()
+	peer := newSessionMock("1", false)
+	_ = room.AddConnectionToRoom(peer, "")
+	// shutdown is sent only with the saved game
+	shutdown := func() bool {
+		peer.mu.Lock()
+		defer peer.mu.Unlock()
+		for _, c := range peer.controls {
+			if strings.Contains(string(c), `"cmd":"`+api.ControlShutdown+`"`) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := room.Drain(); err != ErrNotStarted {
+		t.Errorf("the room without the game has been saved, %v", err)
+	}
+	if shutdown() {
+		t.Errorf("the peer has been told about the saved game without the game")
+	}
+
+	room.director = &stateEmulatorMock{
+		emulatorMock: &emulatorMock{closed: make(chan struct{})},
+		path:         filepath.Join(dir, "test_drain.dat"),
+		state:        []byte{1, 2, 3},
+	}
+	if err := room.Drain(); err != nil {
+		t.Fatalf("couldn't drain the room, %v", err)
+	}
+	if store.uploads != 1 {
+		t.Errorf("the game hasn't been saved, %v uploads", store.uploads)
+	}
+	if !shutdown() {
+		t.Errorf("the peer hasn't been told about the shutdown")
+	}
+	select {
+	case <-room.Done:
+		t.Errorf("the drained room has been closed")
+	default:
+	}
+	if !room.IsPCInRoom(peer) {
+		t.Errorf("the peer has left the drained room")
+	}
+}
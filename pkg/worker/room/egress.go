@@ -0,0 +1,209 @@
+package room
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+const (
+	// egressInterval is the time between two samples of the room egress.
+	egressInterval      = time.Second
+	defaultEgressWindow = 10 * time.Second
+)
+
+// egressSample is the number of all the bytes sent by the room at the time.
+type egressSample struct {
+	at    time.Time
+	bytes uint64
+}
+
+// roomEgress accounts the media bytes sent by the room to its peers
+// and keeps the rate of the room under its bandwidth cap.
+// The rooms over the cap within the window limit the video bitrate
+// of their peers, the limit is lifted when the rate gets well below the cap.
+type roomEgress struct {
+	mu sync.Mutex
+	// the bytes of the sessions which have left the room
+	departed webrtc.Egress
+	// the bytes sent to the sessions before they joined the room by their IDs,
+	// the rooms reuse the connections of the sessions (i.e. the room switch)
+	baselines map[string]webrtc.Egress
+	// the cap (kbit/s) and the min video bitrate of the limit
+	cap, min uint
+	window   time.Duration
+	samples  []egressSample
+	// the video bitrate limit (kbit/s) of each peer, 0 -- none
+	limit uint
+	// the last rate of the room (kbit/s)
+	rate uint
+	last time.Time
+	now  func() time.Time
+}
+
+// newRoomEgress makes the egress of the room with the cap,
+// it limits the adaptive video bitrate within its range (kbit/s).
+func newRoomEgress(conf worker.Bandwidth, min, max uint) *roomEgress {
+	if conf.Cap > 0 && max == 0 {
+		log.Printf("warn: the bandwidth cap %v kbit/s needs the adaptive video bitrate (bitrate max)", conf.Cap)
+	}
+	window := conf.Window
+	if window <= 0 {
+		window = defaultEgressWindow
+	}
+	if min == 0 {
+		min = 1
+	}
+	return &roomEgress{cap: conf.Cap, min: min, window: window, now: time.Now}
+}
+
+// join keeps the bytes sent to the connection of the session before the room.
+func (e *roomEgress) join(id string, sent webrtc.Egress) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.baselines == nil {
+		e.baselines = map[string]webrtc.Egress{}
+	}
+	e.baselines[id] = sent
+}
+
+// sent returns the bytes sent to the session in the room
+// out of all the bytes sent to its connection.
+func (e *roomEgress) sent(id string, total webrtc.Egress) webrtc.Egress {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return total.Since(e.baselines[id])
+}
+
+// leave keeps the bytes sent in the room to the session which has left it.
+func (e *roomEgress) leave(id string, total webrtc.Egress) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.departed = e.departed.Add(total.Since(e.baselines[id]))
+	delete(e.baselines, id)
+}
+
+// gone returns the bytes of the sessions which have left the room.
+func (e *roomEgress) gone() webrtc.Egress {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.departed
+}
+
+// due tells if the egress should be sampled now.
+func (e *roomEgress) due(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.last.IsZero() || now.Sub(e.last) >= egressInterval
+}
+
+// getLimit returns the current video bitrate limit of the peers (kbit/s).
+func (e *roomEgress) getLimit() uint {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.limit
+}
+
+// check samples all the bytes sent by the room to its peers at the time
+// and returns the new video bitrate limit of each peer (kbit/s, 0 -- none)
+// along with the rate of the room if the limit should be changed.
+// The limit goes down when the rate of the whole window is over the cap and
+// it goes up (and away) when the rate is below 70% of the cap,
+// each change starts a new window so the rate of the new bitrate is measured.
+func (e *roomEgress) check(total uint64, peers int, now time.Time) (limit uint, rate uint, changed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.last = now
+	if e.cap == 0 {
+		return 0, 0, false
+	}
+	// the sessions have left between the samples
+	if n := len(e.samples); n > 0 && total < e.samples[n-1].bytes {
+		e.samples = e.samples[:0]
+	}
+	e.samples = append(e.samples, egressSample{at: now, bytes: total})
+	for len(e.samples) > 1 && now.Sub(e.samples[0].at) > e.window {
+		e.samples = e.samples[1:]
+	}
+	first := e.samples[0]
+	span := now.Sub(first.at)
+	if span <= 0 || span < e.window-egressInterval {
+		return 0, 0, false
+	}
+	e.rate = uint(float64(total-first.bytes) * 8 / 1000 / span.Seconds())
+	if peers < 1 {
+		peers = 1
+	}
+	switch {
+	case e.rate > e.cap:
+		base := e.limit
+		if base == 0 {
+			base = e.rate / uint(peers)
+		}
+		// 10% below the cap
+		next := uint(float64(base) * float64(e.cap) / float64(e.rate) * .9)
+		if next < e.min {
+			next = e.min
+		}
+		if next == e.limit {
+			return 0, 0, false
+		}
+		e.limit = next
+	case e.limit > 0 && e.rate < e.cap*7/10:
+		next := e.limit * 5 / 4
+		if next*uint(peers) >= e.cap {
+			next = 0
+		}
+		e.limit = next
+	default:
+		return 0, 0, false
+	}
+	e.samples = append(e.samples[:0], egressSample{at: now, bytes: total})
+	return e.limit, e.rate, true
+}
+
+// Egress returns the media bytes sent by the room to all its peers
+// (including the sessions which have left) and by each of its current sessions.
+func (r *Room) Egress() (webrtc.Egress, map[string]webrtc.Egress) {
+	total := r.egress.gone()
+	sessions := map[string]webrtc.Egress{}
+	r.rtcSessions.ForEach(func(w Session) {
+		sent := r.egress.sent(w.GetId(), w.Egress())
+		sessions[w.GetId()] = sent
+		total = total.Add(sent)
+	})
+	return total, sessions
+}
+
+// checkEgress samples the egress of the room once in egressInterval
+// and returns the video bitrate limit of the peers under the bandwidth cap.
+func (r *Room) checkEgress() uint {
+	now := r.egress.now()
+	if !r.egress.due(now) {
+		return r.egress.getLimit()
+	}
+	total, _ := r.Egress()
+	r.reportEgress(total)
+	peers := 0
+	r.rtcSessions.ForEach(func(w Session) {
+		if w.IsConnected() {
+			peers++
+		}
+	})
+	limit, rate, ok := r.egress.check(total.Total(), peers, now)
+	if !ok {
+		return r.egress.getLimit()
+	}
+	if limit > 0 {
+		log.Printf("warn: room %v, the egress %v kbit/s is over the cap %v, video bitrate limit %v kbit/s",
+			r.ID, rate, r.egress.cap, limit)
+	} else {
+		log.Printf("room %v, the egress %v kbit/s is under the cap %v, no video bitrate limit", r.ID, rate, r.egress.cap)
+	}
+	r.sendControlEvent(api.ControlBandwidth, api.BandwidthEvent{Cap: r.egress.cap, Rate: rate, Limit: limit})
+	return limit
+}
@@ -0,0 +1,169 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// kbits is the number of the bytes of the rate (kbit/s) in a second.
+func kbits(kbps uint64) uint64 { return kbps * 1000 / 8 }
+
+func TestRoomEgressCap(t *testing.T) {
+	now := time.Unix(0, 0)
+	e := newRoomEgress(worker.Bandwidth{Cap: 1000, Window: 4 * time.Second}, 100, 4000)
+
+	var total uint64
+	steps := []struct {
+		// the rate of the room since the last step (kbit/s)
+		rate    uint64
+		limit   uint
+		changed bool
+	}{
+		// the window isn't full yet
+		{rate: 3000}, {rate: 3000}, {rate: 3000},
+		// 1500 of each peer is 3x over the cap
+		{rate: 3000, limit: 450, changed: true},
+		// the new window within the cap
+		{rate: 900}, {rate: 900}, {rate: 900},
+		{rate: 900}, {rate: 1200},
+		// the sliding window is over the cap
+		{rate: 1200, limit: 385, changed: true},
+		// well below the cap
+		{rate: 500}, {rate: 500},
+		{rate: 500, limit: 481, changed: true},
+		// lifted, 601 of each peer would be over the cap
+		{rate: 600}, {rate: 600},
+		{rate: 600, changed: true},
+		{rate: 3000},
+	}
+	for i, step := range steps {
+		if i > 0 {
+			now = now.Add(time.Second)
+		}
+		if !e.due(now) {
+			t.Fatalf("step %v: the egress isn't due", i)
+		}
+		total += kbits(step.rate)
+		limit, _, changed := e.check(total, 2, now)
+		if changed != step.changed || limit != step.limit {
+			t.Errorf("step %v: got %v (%v), expected %v (%v)", i, limit, changed, step.limit, step.changed)
+		}
+	}
+	if e.getLimit() != 0 {
+		t.Errorf("the limit %v hasn't been lifted", e.getLimit())
+	}
+	if e.due(now.Add(egressInterval / 2)) {
+		t.Errorf("the egress is due too soon")
+	}
+}
+
+func TestRoomEgressMinLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	e := newRoomEgress(worker.Bandwidth{Cap: 100, Window: 2 * time.Second}, 500, 4000)
+	var total uint64
+	limits := map[uint]bool{}
+	for i := 0; i < 20; i++ {
+		if limit, _, ok := e.check(total, 1, now); ok {
+			limits[limit] = true
+		}
+		total += kbits(1000)
+		now = now.Add(time.Second)
+	}
+	if len(limits) != 1 || !limits[500] || e.getLimit() != 500 {
+		t.Errorf("the limit %v below the min bitrate, %v", e.getLimit(), limits)
+	}
+}
+
+func TestRoomEgressDisabled(t *testing.T) {
+	now := time.Unix(0, 0)
+	e := newRoomEgress(worker.Bandwidth{}, 0, 0)
+	var total uint64
+	for i := 0; i < 20; i++ {
+		if limit, _, ok := e.check(total, 1, now); ok {
+			t.Fatalf("the egress without the cap is limited to %v", limit)
+		}
+		total += kbits(10000)
+		now = now.Add(time.Second)
+	}
+}
+
+// Tests that the room keeps the egress of its sessions after they leave
+// and the video of the room over the cap goes down the bitrate
+// and the resolution ladder.
+func TestRoomBandwidthCap(t *testing.T) {
+	conf := worker.Config{}
+	conf.Room.Bandwidth = worker.Bandwidth{Cap: 1000, Window: 4 * time.Second}
+	conf.Encoder.Video.Bitrate.Min, conf.Encoder.Video.Bitrate.Max = 300, 4000
+	room := newRoom("test_bandwidth", make(chan nanoarch.InputEvent, 100), nil, conf)
+	defer room.Close()
+
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	room.egress.now = clock
+	room.bitrate = newBitrateControl(300, 4000)
+	room.bitrate.now = clock
+	room.ladder = newResolutionLadder(encoderConfig.Ladder{
+		Steps:      []encoderConfig.LadderStep{{Scale: 0.5, Bitrate: 800}, {Scale: 0.75, Bitrate: 1500}},
+		Hysteresis: 0.25,
+	})
+	room.ladder.now = clock
+	room.vPipe = encoder.NewVideoPipe(nil, 0, 0)
+
+	peers := []*webrtc.WebRTC{{ID: "1"}, {ID: "2"}}
+	for _, peer := range peers {
+		_ = room.AddConnectionToRoom(peer, "")
+	}
+	room.RemoveSession(peers[0])
+	if stats := room.GetStats(); len(stats.SessionEgress) != 1 {
+		t.Errorf("wrong egress of the sessions %v", stats.SessionEgress)
+	}
+
+	// the sessions which have left have sent 2 Mbit/s
+	for i := 0; i < 4; i++ {
+		room.egress.leave("gone", webrtc.Egress{Video: kbits(1800), Audio: kbits(200)})
+		room.adaptBitrate()
+		now = now.Add(time.Second)
+	}
+	room.adaptBitrate()
+
+	stats := room.GetStats()
+	if want := 4 * (kbits(1800) + kbits(200)); stats.Egress.Total() != want || stats.Egress.Audio != 4*kbits(200) {
+		t.Errorf("wrong egress %+v of the room, expected %v", stats.Egress, want)
+	}
+	if stats.EgressLimit != 900 {
+		t.Errorf("wrong limit %v of the room over the cap", stats.EgressLimit)
+	}
+	if room.bitrate.current != 900 || room.ladder.scale() != 0.75 {
+		t.Errorf("the video isn't down, %v kbit/s x%v", room.bitrate.current, room.ladder.scale())
+	}
+}
+
+// Tests that the room accounts only the bytes sent to the sessions
+// in the room, the connections of the sessions come from the other rooms.
+func TestRoomEgressSwitch(t *testing.T) {
+	room := newRoom("test_egress_switch", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	peer := newSessionMock("1", false)
+	peer.setEgress(webrtc.Egress{Video: 1000, Audio: 100})
+	if err := room.AddConnectionToRoom(peer, ""); err != nil {
+		t.Fatal(err)
+	}
+	if total, sessions := room.Egress(); total.Total() != 0 || sessions["1"].Total() != 0 {
+		t.Errorf("the room has the egress %+v (%+v) of another room", total, sessions)
+	}
+
+	peer.setEgress(webrtc.Egress{Video: 1500, Audio: 150})
+	if _, sessions := room.Egress(); sessions["1"] != (webrtc.Egress{Video: 500, Audio: 50}) {
+		t.Errorf("wrong egress of the session %+v", sessions["1"])
+	}
+	room.RemoveSession(peer)
+	if total, _ := room.Egress(); total != (webrtc.Egress{Video: 500, Audio: 50}) {
+		t.Errorf("wrong egress %+v of the room after the session has left", total)
+	}
+}
@@ -0,0 +1,128 @@
+package room
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is the type of the significant transitions of a room.
+type EventType int
+
+const (
+	EventCreated EventType = iota
+	EventStarted
+	EventPeerJoined
+	EventPeerLeft
+	EventSaved
+	EventLoaded
+	EventPaused
+	EventResumed
+	// EventEncoderRestart is the restart of the failed video encoder
+	EventEncoderRestart
+	// EventRecovered is the restart of the hung or exited emulator
+	EventRecovered
+	EventClosed
+)
+
+var eventNames = [...]string{
+	EventCreated:        "created",
+	EventStarted:        "started",
+	EventPeerJoined:     "peer_joined",
+	EventPeerLeft:       "peer_left",
+	EventSaved:          "saved",
+	EventLoaded:         "loaded",
+	EventPaused:         "paused",
+	EventResumed:        "resumed",
+	EventEncoderRestart: "encoder_restart",
+	EventRecovered:      "recovered",
+	EventClosed:         "closed",
+}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventNames) {
+		return fmt.Sprintf("event(%d)", int(t))
+	}
+	return eventNames[t]
+}
+
+func (t EventType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+// Event is a transition of the room at the time.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+	// the session of the peer events
+	Session string `json:"session,omitempty"`
+	// the save slot of the save and load events (the main slot is 0)
+	Slot int `json:"slot,omitempty"`
+	// the error of the encoder restarts and the reason of the abnormal close
+	Reason string `json:"reason,omitempty"`
+}
+
+func (e Event) String() string {
+	var b strings.Builder
+	b.WriteString(e.Time.Format("15:04:05.000 "))
+	b.WriteString(e.Type.String())
+	if e.Session != "" {
+		fmt.Fprintf(&b, " session=%v", e.Session)
+	}
+	if e.Type == EventSaved || e.Type == EventLoaded {
+		fmt.Fprintf(&b, " slot=%v", e.Slot)
+	}
+	if e.Reason != "" {
+		fmt.Fprintf(&b, " reason=%v", e.Reason)
+	}
+	return b.String()
+}
+
+// eventLogSize is the number of the last events kept by a room.
+const eventLogSize = 256
+
+// eventLog keeps the last events of the room.
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+}
+
+func (l *eventLog) add(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) < eventLogSize {
+		l.events = append(l.events, e)
+		return
+	}
+	l.events[l.next] = e
+	l.next = (l.next + 1) % eventLogSize
+}
+
+// get returns the events from the oldest one.
+func (l *eventLog) get() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := make([]Event, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
+
+// Events returns the last events of the room from the oldest one.
+func (r *Room) Events() []Event { return r.events.get() }
+
+// event records the event of the room now.
+func (r *Room) event(e Event) {
+	e.Time = time.Now()
+	r.events.add(e)
+	metrics.events.WithLabelValues(e.Type.String()).Inc()
+}
+
+// dumpEvents logs all the events of the room closed with the error.
+func (r *Room) dumpEvents(err error) {
+	events := r.Events()
+	log.Printf("error: room %v has closed with %v, its last %v events:", r.ID, err, len(events))
+	for _, e := range events {
+		log.Printf("  room %v: %v", r.ID, e)
+	}
+}
@@ -0,0 +1,109 @@
+package room
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestEventLog(t *testing.T) {
+	var l eventLog
+	if events := l.get(); len(events) != 0 {
+		t.Errorf("the new log has events %v", events)
+	}
+	for i := 0; i < eventLogSize+10; i++ {
+		l.add(Event{Type: EventSaved, Slot: i})
+	}
+	events := l.get()
+	if len(events) != eventLogSize {
+		t.Fatalf("wrong number of events %v, expected %v", len(events), eventLogSize)
+	}
+	for i, e := range events {
+		if e.Slot != i+10 {
+			t.Fatalf("wrong event %v at %v, expected the slot %v", e.Slot, i, i+10)
+		}
+	}
+}
+
+func TestEventType(t *testing.T) {
+	tests := []struct {
+		typ  EventType
+		name string
+	}{
+		{typ: EventCreated, name: "created"},
+		{typ: EventPeerLeft, name: "peer_left"},
+		{typ: EventEncoderRestart, name: "encoder_restart"},
+		{typ: EventClosed, name: "closed"},
+		{typ: EventClosed + 1, name: "event(11)"},
+	}
+	for _, test := range tests {
+		if name, _ := test.typ.MarshalText(); string(name) != test.name {
+			t.Errorf("wrong name %q of %d, expected %q", name, int(test.typ), test.name)
+		}
+	}
+}
+
+func TestRoomEvents(t *testing.T) {
+	room := newRoom("test_events", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	peer := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1), Spectator: true}
+	if err := room.AddConnectionToRoom(peer, ""); err != nil {
+		t.Fatalf("couldn't join the room, %v", err)
+	}
+	room.RemoveSession(peer)
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	room.fail(ErrCrashed)
+	<-room.Closed()
+	log.SetOutput(os.Stderr)
+
+	expected := []Event{
+		{Type: EventCreated},
+		{Type: EventPeerJoined, Session: "1"},
+		{Type: EventPeerLeft, Session: "1"},
+		{Type: EventClosed, Reason: ErrCrashed.Error()},
+	}
+	events := room.Events()
+	if len(events) != len(expected) {
+		t.Fatalf("wrong events %v", events)
+	}
+	for i, e := range events {
+		if e.Type != expected[i].Type || e.Session != expected[i].Session || e.Reason != expected[i].Reason {
+			t.Errorf("wrong event %v at %v, expected %v", e, i, expected[i])
+		}
+		if i > 0 && e.Time.Before(events[i-1].Time) {
+			t.Errorf("the event %v is before the previous one", e)
+		}
+	}
+	// the crashed room dumps its events
+	dump := out.String()
+	for _, e := range events {
+		if !strings.Contains(dump, e.String()) {
+			t.Errorf("the event %v is not in the log", e)
+		}
+	}
+}
+
+func TestRoomEventsClose(t *testing.T) {
+	room := newRoom("test_events_close", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	room.Close()
+	<-room.Closed()
+	log.SetOutput(os.Stderr)
+
+	events := room.Events()
+	if last := events[len(events)-1]; last.Type != EventClosed || last.Reason != "" {
+		t.Errorf("wrong last event %v", last)
+	}
+	if strings.Contains(out.String(), events[0].String()) {
+		t.Errorf("the events of the normally closed room are dumped")
+	}
+}
@@ -0,0 +1,42 @@
+package room
+
+import (
+	"log"
+	"sync"
+)
+
+// fastForward keeps the peer that has sped up the game.
+type fastForward struct {
+	mu   sync.Mutex
+	peer string
+}
+
+// SetSpeed changes the speed of the game (fast-forward) by the peer,
+// the speed is clamped by the emulator with the max of the config.
+// The game returns to the normal speed when the peer leaves the room.
+func (r *Room) SetSpeed(peer Session, multiplier float64) error {
+	if peer.IsSpectator() {
+		return ErrSpectator
+	}
+	r.fastForward.mu.Lock()
+	defer r.fastForward.mu.Unlock()
+	r.director.SetSpeedMultiplier(multiplier)
+	if multiplier > 1 {
+		r.fastForward.peer = peer.GetId()
+	} else {
+		r.fastForward.peer = ""
+	}
+	return nil
+}
+
+// resetSpeed returns the game to the normal speed if the peer has sped it up.
+func (r *Room) resetSpeed(peer Session) {
+	r.fastForward.mu.Lock()
+	defer r.fastForward.mu.Unlock()
+	if r.fastForward.peer == "" || r.fastForward.peer != peer.GetId() {
+		return
+	}
+	r.director.SetSpeedMultiplier(1)
+	r.fastForward.peer = ""
+	log.Printf("Room %v speed is reset after the peer %v has left", r.ID, peer.GetId())
+}
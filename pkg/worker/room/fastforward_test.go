@@ -0,0 +1,36 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestSetSpeed(t *testing.T) {
+	room, _, emu := newIdleRoom(time.Hour)
+	defer room.Close()
+	a := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+	b := &webrtc.WebRTC{ID: "2", InputChannel: make(chan []byte, 1)}
+	spectator := &webrtc.WebRTC{ID: "3", InputChannel: make(chan []byte, 1), Spectator: true}
+	for _, peer := range []*webrtc.WebRTC{a, b, spectator} {
+		room.AddConnectionToRoom(peer, "")
+	}
+
+	if err := room.SetSpeed(spectator, 2); err != ErrSpectator {
+		t.Errorf("expected spectator error, got %v", err)
+	}
+	if err := room.SetSpeed(a, 2); err != nil || emu.speed != 2 {
+		t.Fatalf("the speed wasn't changed (%v), %v", emu.speed, err)
+	}
+
+	// only the triggering peer resets the speed
+	room.RemoveSession(b)
+	if emu.speed != 2 {
+		t.Errorf("the speed was reset by another peer")
+	}
+	room.RemoveSession(a)
+	if emu.speed != 1 {
+		t.Errorf("the speed wasn't reset after the peer has left, %v", emu.speed)
+	}
+}
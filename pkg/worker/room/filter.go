@@ -0,0 +1,70 @@
+package room
+
+import (
+	"errors"
+	"log"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
+)
+
+var errNoVideo = errors.New("the room has no video encoder")
+
+// initVideoFilter sets up the video filters of the room for the frames
+// of the encoder (the viewport) and the native frames of the game (nw x nh).
+// The wrong filters are ignored.
+func (r *Room) initVideoFilter(names []string, view viewport.Viewport, nw, nh int, rotated bool) {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	w, h := view.Width, view.Height
+	r.videoWidth, r.videoHeight, r.videoView = w, h, view
+	r.nativeWidth, r.nativeHeight = nw, nh
+	r.videoRotated = rotated
+	chain, err := filter.New(names, w, h, rotated)
+	if err != nil {
+		log.Printf("warn: room %v, no video filters, %v", r.ID, err)
+	}
+	r.videoFilters, r.videoFilterNames = chain, names
+	r.setViewport(r.director)
+}
+
+// SetVideoFilter changes the video filters of the room at runtime,
+// no filters turn them off.
+func (r *Room) SetVideoFilter(names []string) error {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	if r.vPipe == nil {
+		return errNoVideo
+	}
+	chain, err := filter.New(names, r.videoWidth, r.videoHeight, r.videoRotated)
+	if err != nil {
+		return err
+	}
+	r.videoFilters, r.videoFilterNames = chain, names
+	r.setViewport(r.director)
+	r.vPipe.SetFilter(r.pipeFilters())
+	if r.vPipeLow != nil {
+		r.vPipeLow.SetFilter(r.lowFilters())
+	}
+	log.Printf("Room %v video filters %v", r.ID, names)
+	return nil
+}
+
+// setViewport sets the size and the crop of the frames of the emulator.
+// Should be called under videoLock.
+func (r *Room) setViewport(director emulator.CloudEmulator) {
+	director.SetCrop(r.videoView.Crop)
+	director.SetViewport(r.viewport())
+}
+
+// viewport returns the size of the game frames,
+// the upscale filters get the native frames of the game (their cropped part).
+// Should be called under videoLock.
+func (r *Room) viewport() (int, int) {
+	if r.videoFilters.Scales() && r.nativeWidth > 0 && r.nativeHeight > 0 {
+		rect := r.videoView.Crop.Rect(r.nativeWidth, r.nativeHeight)
+		return rect.Dx(), rect.Dy()
+	}
+	return r.videoWidth, r.videoHeight
+}
@@ -0,0 +1,69 @@
+package room
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
+)
+
+// Tests that the upscale filters get the native frames of the game
+// and the filters could be changed at runtime.
+func TestRoomVideoFilter(t *testing.T) {
+	room := newRoom("test_filter", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room.director = emu
+
+	room.initVideoFilter([]string{filter.Bilinear, filter.Scanlines}, viewport.Viewport{Width: 64, Height: 48}, 32, 24, false)
+	if emu.vw != 32 || emu.vh != 24 {
+		t.Errorf("wrong viewport %vx%v of the upscale, expected 32x24", emu.vw, emu.vh)
+	}
+	if err := room.SetVideoFilter(nil); err != errNoVideo {
+		t.Errorf("the filters have been changed without video, %v", err)
+	}
+
+	room.vPipe = encoder.NewVideoPipe(&keyframeEncoderMock{}, 64, 48)
+	go room.vPipe.Start()
+	defer room.vPipe.Stop()
+	if err := room.SetVideoFilter([]string{filter.CRT}); err != nil {
+		t.Fatalf("couldn't change the filters, %v", err)
+	}
+	if emu.vw != 64 || emu.vh != 48 {
+		t.Errorf("wrong viewport %vx%v without the upscale, expected 64x48", emu.vw, emu.vh)
+	}
+	room.vPipe.Input <- encoder.InFrame{Image: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+	select {
+	case <-room.vPipe.Output:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no filtered frame")
+	}
+
+	if err := room.SetVideoFilter([]string{"blur"}); err == nil {
+		t.Errorf("the unknown filter has been set")
+	}
+	if len(room.videoFilters) != 1 || emu.vw != 64 {
+		t.Errorf("the filters have been changed with the error")
+	}
+}
+
+// Tests that the upscale filters of the filled video get the cropped part
+// of the native frames.
+func TestRoomVideoFilterCrop(t *testing.T) {
+	room := newRoom("test_filter_crop", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room.director = emu
+
+	crop := viewport.Crop{X: 0.25, W: 0.5, H: 1}
+	room.initVideoFilter([]string{filter.Bilinear}, viewport.Viewport{Mode: viewport.Fill, Width: 64, Height: 96, Crop: crop},
+		32, 24, false)
+	if emu.vw != 16 || emu.vh != 24 || emu.crop != crop {
+		t.Errorf("wrong viewport %vx%v (%+v) of the upscale, expected 16x24", emu.vw, emu.vh, emu.crop)
+	}
+}
@@ -0,0 +1,84 @@
+package room
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/session"
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+)
+
+// ErrNoCloudStorage is the error of the states which can't go to the other workers,
+// the workers should share the cloud storage.
+var ErrNoCloudStorage = errors.New("no cloud storage shared by the workers")
+
+// hasCloudStorage tells if the states of the room can go to the other workers.
+func (r *Room) hasCloudStorage() bool {
+	return r.onlineStorage != nil && !storage.IsNoop(r.onlineStorage)
+}
+
+// Fork clones the running game of the room for a new room, i.e. for the races
+// from the same point. The snapshot of the game and its save RAM are copied
+// under the new ID locally and in the cloud storage, the returned new room
+// of the same game should start from them on another worker (see ImportState),
+// the libretro cores run one game per worker. The empty ID is generated.
+// The game of the room is blocked for one frame of the snapshot only.
+func (r *Room) Fork(newID string) (Migration, error) {
+	if r.IsHardcore() {
+		return Migration{}, ErrHardcore
+	}
+	if !r.hasCloudStorage() {
+		return Migration{}, ErrNoCloudStorage
+	}
+	if newID == "" {
+		newID = session.GenerateRoomID(r.game.Name)
+	}
+	if newID == r.ID {
+		return Migration{}, ErrRoomExists
+	}
+
+	r.saveLock.Lock()
+	director, files := r.director, r.files
+	r.saveLock.Unlock()
+	if director == nil {
+		return Migration{}, ErrNotStarted
+	}
+	state, sram, err := director.Snapshot()
+	if err != nil {
+		return Migration{}, err
+	}
+	files.MainSave = newID
+	if err := r.writeFork(files, state, sram); err != nil {
+		return Migration{}, err
+	}
+	log.Printf("Room %v has been forked into %v", r.ID, newID)
+	return Migration{RoomID: newID, Game: r.game}, nil
+}
+
+// writeFork writes the state and the save RAM of the fork into its storage
+// and uploads them into the cloud storage before the start of the fork.
+func (r *Room) writeFork(files nanoarch.Storage, state []byte, sram []byte) error {
+	if err := os.MkdirAll(files.Dir(), 0755); err != nil {
+		return err
+	}
+	path := files.GetSavePath()
+	if err := ioutil.WriteFile(path, state, 0644); err != nil {
+		return err
+	}
+	sramPath := files.GetSRAMPath()
+	if len(sram) > 0 {
+		if err := ioutil.WriteFile(sramPath, sram, 0644); err != nil {
+			return err
+		}
+	}
+	if err := r.uploadState(r.ctx, slotKey(files.MainSave, 0), path); err != nil {
+		return err
+	}
+	if len(sram) > 0 {
+		return r.uploadState(r.ctx, sramKey(files.MainSave, files.GameHash), sramPath)
+	}
+	return nil
+}
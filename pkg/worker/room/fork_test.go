@@ -0,0 +1,96 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+)
+
+// forkEmulatorMock is a core with some RAM and save RAM in its snapshots.
+type forkEmulatorMock struct {
+	*ramEmulatorMock
+	sram      []byte
+	snapshots int
+}
+
+func (e *forkEmulatorMock) Snapshot() ([]byte, []byte, error) {
+	e.snapshots++
+	return append([]byte(nil), e.ram...), append([]byte(nil), e.sram...), nil
+}
+
+// Tests that the forked room starts from the state of the original room
+// which keeps running as is.
+func TestRoomFork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_fork")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cloud := &cloudMock{files: map[string][]byte{}}
+
+	room, emu := newMigrationRoom("test_fork", cloud, filepath.Join(dir, "test_fork", "test_fork.dat"))
+	defer room.Close()
+	room.game = games.GameMetadata{Name: "Sushi"}
+	room.gameHash = "hash"
+	room.files = nanoarch.Storage{Path: dir, MainSave: room.ID, GameHash: room.gameHash}
+	core := &forkEmulatorMock{ramEmulatorMock: emu, sram: []byte{0x01}}
+	core.ram = []byte{0x42, 0x13}
+	room.director = core
+
+	fork, err := room.Fork("")
+	if err != nil {
+		t.Fatalf("couldn't fork the room, %v", err)
+	}
+	if fork.RoomID == room.ID || fork.Game.Name != room.game.Name {
+		t.Errorf("wrong fork %v (%v) of the room", fork.RoomID, fork.Game.Name)
+	}
+	files := nanoarch.Storage{Path: dir, MainSave: fork.RoomID, GameHash: room.gameHash}
+	if sram, err := ioutil.ReadFile(files.GetSRAMPath()); err != nil || string(sram) != string(core.sram) {
+		t.Errorf("wrong save RAM %v of the forked game, %v", sram, err)
+	}
+	if sram := cloud.files[sramKey(fork.RoomID, files.GameHash)]; string(sram) != string(core.sram) {
+		t.Errorf("wrong save RAM %v of the fork in the cloud storage", sram)
+	}
+
+	// the fork starts on another worker from the cloud storage
+	to, forked := newMigrationRoom(fork.RoomID, cloud, filepath.Join(dir, "b", fork.RoomID+".dat"))
+	defer to.Close()
+	_ = os.MkdirAll(filepath.Dir(forked.path), 0755)
+	to.ImportState(fork)
+	if err := to.LoadGame(); err != nil {
+		t.Fatalf("couldn't load the forked game, %v", err)
+	}
+	if string(forked.ram) != string([]byte{0x42, 0x13}) {
+		t.Errorf("wrong RAM %v of the forked game", forked.ram)
+	}
+
+	// the original room has been neither paused nor saved
+	if core.snapshots != 1 || core.paused || !room.IsRunning {
+		t.Errorf("the original room has been stopped with %v snapshots", core.snapshots)
+	}
+	if _, err := os.Stat(emu.path); !os.IsNotExist(err) {
+		t.Errorf("the original room has been saved, %v", err)
+	}
+	forked.ram[0] = 0
+	if core.ram[0] != 0x42 {
+		t.Errorf("the fork has changed the original game")
+	}
+
+	if _, err := room.Fork(room.ID); err != ErrRoomExists {
+		t.Errorf("the room has been forked into itself, %v", err)
+	}
+	room.director = nil
+	if _, err := room.Fork(""); err != ErrNotStarted {
+		t.Errorf("the room has been forked before the start, %v", err)
+	}
+	room.director = core
+	room.onlineStorage = nil
+	if _, err := room.Fork(""); err != ErrNoCloudStorage {
+		t.Errorf("the room has been forked without the cloud storage, %v", err)
+	}
+	room.onlineStorage = cloud
+}
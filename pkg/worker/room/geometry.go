@@ -0,0 +1,87 @@
+package room
+
+import (
+	"log"
+
+	emulatorConfig "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
+)
+
+// The resolution changes of the games while running (i.e. 224p/239p of SNES,
+// the interlaced modes of PS1) come with the frames of the emulator.
+// The video of the room follows them: the viewport of the emulator,
+// the filters and the encoder are remade for the new frame size.
+// The new encoder has the same codec and starts with a keyframe,
+// so the peers just go on with the new size without any renegotiation.
+
+// gameGeometry is what the video size of the room is made of.
+type gameGeometry struct {
+	meta emulator.Metadata
+	conf emulatorConfig.Emulator
+}
+
+// follows tells if the video follows the resolution changes of the game.
+func (g gameGeometry) follows() bool { return g.conf.Geometry != emulatorConfig.GeometryKeep }
+
+// change returns the geometry of the new resolution of the game.
+func (g gameGeometry) change(c emulator.Geometry) gameGeometry {
+	g.meta.BaseWidth, g.meta.BaseHeight, g.meta.Ratio = c.BaseWidth, c.BaseHeight, c.Ratio
+	return g
+}
+
+// videoSize returns the viewport of the encoder frames and
+// the size of the native frames of the game (nw x nh) considering its orientation.
+func (g gameGeometry) videoSize() (view viewport.Viewport, nw, nh int) {
+	view = gameViewport(g.meta, g.conf)
+	nw, nh = g.meta.BaseWidth, g.meta.BaseHeight
+	if g.meta.Rotation.IsEven {
+		nw, nh = nh, nw
+	}
+	return
+}
+
+// resizeVideo remakes the video of the room for the new resolution of the game.
+// It returns the encoder of the new frame size (w x h) for the new pipe,
+// nil if the size of the frames is the same or the encoder has failed.
+// Should be called by the video goroutine.
+func (r *Room) resizeVideo(change emulator.Geometry, video encoderConfig.Video) (enc encoder.Encoder, w, h int) {
+	r.geometry = r.geometry.change(change)
+	view, nw, nh := r.geometry.videoSize()
+	w, h = view.Width, view.Height
+	// the emulator restarts change the director
+	r.saveLock.Lock()
+	director := r.director
+	r.saveLock.Unlock()
+
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	r.nativeWidth, r.nativeHeight, r.videoView = nw, nh, view
+	defer func() {
+		if director != nil {
+			r.setViewport(director)
+		}
+	}()
+	if w == r.videoWidth && h == r.videoHeight {
+		// only the upscale filters get the new native frames
+		return nil, w, h
+	}
+
+	// the video stays on its step of the resolution ladder
+	sw, sh := scaledSize(w, h, r.videoScale)
+	enc, err := newVideoEncoder(r.videoCodec, sw, sh, video)
+	if err != nil {
+		log.Printf("error: room %v couldn't resize the video to %vx%v, %v", r.ID, sw, sh, err)
+		return nil, w, h
+	}
+	chain, err := filter.New(r.videoFilterNames, w, h, r.videoRotated)
+	if err != nil {
+		log.Printf("warn: room %v, no video filters, %v", r.ID, err)
+	}
+	log.Printf("Room %v video resize %vx%v -> %vx%v", r.ID, r.videoWidth, r.videoHeight, w, h)
+	r.videoWidth, r.videoHeight, r.videoFilters = w, h, chain
+	return enc, w, h
+}
@@ -0,0 +1,148 @@
+package room
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+	"time"
+
+	emulatorConfig "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	emuImage "github.com/giongto35/cloud-game/v2/pkg/emulator/image"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
+)
+
+func TestGameGeometry(t *testing.T) {
+	g := gameGeometry{meta: emulator.Metadata{BaseWidth: 256, BaseHeight: 224}}
+	if !g.follows() {
+		t.Errorf("the video doesn't follow the geometry by default")
+	}
+	// the odd native sizes are even for the encoder
+	if v, nw, nh := g.change(emulator.Geometry{BaseWidth: 256, BaseHeight: 239}).videoSize(); v.Width != 256 ||
+		v.Height != 238 || nw != 256 || nh != 239 {
+		t.Errorf("wrong video size %vx%v (%vx%v) of 256x239", v.Width, v.Height, nw, nh)
+	}
+
+	g.meta.Rotation = emuImage.GetRotation(emuImage.Angle90)
+	g.conf.Scale = 2
+	if v, nw, nh := g.videoSize(); v.Width != 448 || v.Height != 512 || nw != 224 || nh != 256 {
+		t.Errorf("wrong video size %vx%v (%vx%v) of the rotated game", v.Width, v.Height, nw, nh)
+	}
+
+	// the viewport is of the rotated game
+	g.conf.Scale = 1
+	g.conf.AspectRatio.Keep, g.conf.AspectRatio.Width, g.conf.AspectRatio.Height = true, 640, 480
+	g.conf.AspectRatio.ScalingMode = viewport.Integer
+	if v, _, _ := g.videoSize(); v.Mode != viewport.Integer || v.Width != 224 || v.Height != 256 {
+		t.Errorf("wrong integer video %+v of the rotated game", v)
+	}
+	g.conf.AspectRatio.ScalingMode = viewport.Fill
+	if v, _, _ := g.videoSize(); v.Width != 640 || v.Height != 480 || v.Crop == (viewport.Crop{}) {
+		t.Errorf("wrong filled video %+v of the rotated game", v)
+	}
+	g.conf.AspectRatio.ScalingMode = ""
+
+	g.conf.Geometry = emulatorConfig.GeometryKeep
+	if g.follows() {
+		t.Errorf("the video follows the geometry with the keep mode")
+	}
+}
+
+// Tests that the video of the room follows the resolution changes of the game
+// within one frame and the peers get the keyframes of the new size.
+func TestRoomVideoResize(t *testing.T) {
+	room := newRoom("test_resize", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	defer room.Close()
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room.director = emu
+	// the sent frames are taken by the video goroutine
+	frames := make(chan nanoarch.GameFrame)
+	room.imageChannel = frames
+	room.geometry = gameGeometry{meta: emulator.Metadata{BaseWidth: 64, BaseHeight: 48}}
+	room.initVideoFilter([]string{filter.Scanlines}, viewport.Viewport{Width: 64, Height: 48}, 64, 48, false)
+
+	ended := make(chan struct{})
+	go func() {
+		room.startVideo(64, 48, testVideoConfig())
+		close(ended)
+	}()
+	defer func() {
+		close(frames)
+		<-ended
+	}()
+
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+	// the frame of the old viewport tells about the new resolution
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48)),
+		Geometry: &emulator.Geometry{BaseWidth: 80, BaseHeight: 60}}
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 80, 60))}
+
+	room.videoLock.Lock()
+	w, h, vw, vh, names := room.videoWidth, room.videoHeight, emu.vw, emu.vh, room.videoFilterNames
+	pipe := room.vPipe
+	room.videoLock.Unlock()
+	if w != 80 || h != 60 || vw != 80 || vh != 60 {
+		t.Fatalf("wrong video size %vx%v (viewport %vx%v), expected 80x60", w, h, vw, vh)
+	}
+	if len(names) != 1 || names[0] != filter.Scanlines {
+		t.Errorf("the filters have been lost %v", names)
+	}
+
+	// the keyframes of the new encoder (some are taken by the room fan-out)
+	timeout := time.After(10 * time.Second)
+	for keyframes := 0; keyframes < 2; {
+		select {
+		case frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 80, 60))}:
+		case frame := <-pipe.Output:
+			if w, h, ok := vp8Size(frame.Data); ok {
+				if w != 80 || h != 60 {
+					t.Fatalf("wrong keyframe size %vx%v, expected 80x60", w, h)
+				}
+				keyframes++
+			}
+			frame.Buf.Release()
+		case <-timeout:
+			t.Fatalf("no keyframes of the new size")
+		}
+	}
+}
+
+func TestRoomVideoResizeKeep(t *testing.T) {
+	room := newRoom("test_resize_keep", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	defer room.Close()
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room.director = emu
+	frames := make(chan nanoarch.GameFrame)
+	room.imageChannel = frames
+	var conf emulatorConfig.Emulator
+	conf.Geometry = emulatorConfig.GeometryKeep
+	room.geometry = gameGeometry{meta: emulator.Metadata{BaseWidth: 64, BaseHeight: 48}, conf: conf}
+	room.initVideoFilter(nil, viewport.Viewport{Width: 64, Height: 48}, 64, 48, false)
+
+	ended := make(chan struct{})
+	go func() {
+		room.startVideo(64, 48, testVideoConfig())
+		close(ended)
+	}()
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48)),
+		Geometry: &emulator.Geometry{BaseWidth: 80, BaseHeight: 60}}
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+	close(frames)
+	<-ended
+
+	if room.videoWidth != 64 || room.videoHeight != 48 || emu.vw != 64 || emu.vh != 48 {
+		t.Errorf("the video has been resized to %vx%v (viewport %vx%v)", room.videoWidth, room.videoHeight, emu.vw, emu.vh)
+	}
+}
+
+// vp8Size returns the frame size of the VP8 keyframe,
+// false for the other frames.
+func vp8Size(data []byte) (w, h int, ok bool) {
+	if len(data) < 10 || data[0]&1 != 0 || data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+		return 0, 0, false
+	}
+	return int(binary.LittleEndian.Uint16(data[6:]) & 0x3fff), int(binary.LittleEndian.Uint16(data[8:]) & 0x3fff), true
+}
@@ -0,0 +1,87 @@
+package room
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// afterFunc calls the function after the duration, returns a func to cancel the call
+// (see time.AfterFunc).
+type afterFunc func(d time.Duration, f func()) (stop func() bool)
+
+func timeAfterFunc(d time.Duration, f func()) func() bool { return time.AfterFunc(d, f).Stop }
+
+// idleWatch is a watchdog that fires once after
+// the room has stayed without active peers for some time.
+type idleWatch struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	after   afterFunc
+	stop    func() bool
+	// gen is incremented with each cancel
+	// so the stale timers won't fire
+	gen uint64
+}
+
+func newIdleWatch(timeout time.Duration) idleWatch {
+	return idleWatch{timeout: timeout, after: timeAfterFunc}
+}
+
+// start starts the watchdog timer if it's not running already.
+func (w *idleWatch) start(fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timeout <= 0 || w.stop != nil {
+		return
+	}
+	gen := w.gen
+	w.stop = w.after(w.timeout, func() {
+		w.mu.Lock()
+		fire := gen == w.gen
+		if fire {
+			w.stop = nil
+		}
+		w.mu.Unlock()
+		if fire {
+			fn()
+		}
+	})
+}
+
+// cancel stops the watchdog timer.
+func (w *idleWatch) cancel() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.gen++
+	if w.stop != nil {
+		w.stop()
+		w.stop = nil
+	}
+}
+
+// checkIdle starts the idle watchdog of the room if it has no active peers
+// or its game is paused, the pause time counts as idle.
+func (r *Room) checkIdle() {
+	if r.IsPaused() || r.IsEmpty() || !r.IsRunningSessions() {
+		r.idle.start(r.closeIdle)
+	}
+}
+
+// closeIdle saves and closes the room that has been idle for too long.
+func (r *Room) closeIdle() {
+	select {
+	case <-r.Done:
+		return
+	default:
+	}
+	log.Printf("Room %v has been idle for %v, closing", r.ID, r.idle.timeout)
+	if r.director != nil {
+		if err := r.SaveGame(); err != nil {
+			log.Printf("error: couldn't save the game of idle room %v, %v", r.ID, err)
+		}
+	}
+	r.Close()
+}
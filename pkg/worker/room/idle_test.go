@@ -0,0 +1,138 @@
+package room
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// fakeClock is a manually advanced clock for the idle watchdog.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Duration
+	fn      func()
+	stopped bool
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, fn func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now + d, fn: fn}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		active := !t.stopped
+		t.stopped = true
+		return active
+	}
+}
+
+// Advance moves the clock forward and runs all the expired timers.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now += d
+	var expired []*fakeTimer
+	for _, t := range c.timers {
+		if !t.stopped && t.at <= c.now {
+			t.stopped = true
+			expired = append(expired, t)
+		}
+	}
+	c.mu.Unlock()
+	for _, t := range expired {
+		t.fn()
+	}
+}
+
+func newIdleRoom(timeout time.Duration) (*Room, *fakeClock, *emulatorMock) {
+	store, _ := storage.NewNoopCloudStorage()
+	conf := worker.Config{}
+	conf.Room.IdleTimeout = timeout
+	room := newRoom("test_idle", make(chan nanoarch.InputEvent, 100), store, conf)
+	clock := &fakeClock{}
+	room.idle.after = clock.AfterFunc
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room.director = emu
+	return room, clock, emu
+}
+
+func isClosed(room *Room) bool {
+	select {
+	case <-room.Done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestIdleRoomReconnect(t *testing.T) {
+	room, clock, _ := newIdleRoom(5 * time.Minute)
+	defer room.Close()
+	peer := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+
+	room.checkIdle()
+	clock.Advance(1 * time.Minute)
+	room.AddConnectionToRoom(peer, "")
+	clock.Advance(10 * time.Minute)
+	if isClosed(room) {
+		t.Fatalf("the room was closed with a peer")
+	}
+
+	// quick reconnect
+	room.RemoveSession(peer)
+	clock.Advance(4 * time.Minute)
+	room.AddConnectionToRoom(peer, "")
+	clock.Advance(4 * time.Minute)
+	if isClosed(room) {
+		t.Fatalf("the room was closed after a quick reconnect")
+	}
+}
+
+func TestIdleRoomTimeout(t *testing.T) {
+	room, clock, emu := newIdleRoom(5 * time.Minute)
+	peer := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+
+	room.AddConnectionToRoom(peer, "")
+	room.RemoveSession(peer)
+	clock.Advance(5*time.Minute - time.Second)
+	if isClosed(room) {
+		t.Fatalf("the room was closed before the timeout")
+	}
+	clock.Advance(time.Second)
+	if !isClosed(room) {
+		t.Fatalf("the idle room wasn't closed after the timeout")
+	}
+
+	select {
+	case <-room.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the room wasn't shut down")
+	}
+	select {
+	case <-emu.closed:
+	default:
+		t.Errorf("the emulator wasn't closed")
+	}
+}
+
+func TestIdleRoomDisabled(t *testing.T) {
+	room, clock, _ := newIdleRoom(0)
+	defer room.Close()
+
+	room.checkIdle()
+	clock.Advance(24 * time.Hour)
+	if isClosed(room) {
+		t.Fatalf("the room was closed with the disabled timeout")
+	}
+}
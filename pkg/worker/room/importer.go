@@ -0,0 +1,280 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/frame"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+)
+
+// ShmAddrTmpl is the shared memory of the frame ring of the emulator without game.
+const ShmAddrTmpl = "/dev/shm/cloudretro-retro-%s.shm"
+
+// ErrSocketInUse is the error of the importers of the rooms
+// which socket is taken by another running room.
+var ErrSocketInUse = errors.New("the frame socket is in use")
+
+// the sockets of the running importers of the worker
+var sockets = struct {
+	sync.Mutex
+	addrs map[string]struct{}
+}{addrs: map[string]struct{}{}}
+
+// the frame ring without the config values
+const (
+	defaultImporterSlots     = 4
+	defaultImporterMaxWidth  = 1280
+	defaultImporterMaxHeight = 720
+)
+
+// NewVideoImporter return image Channel from stream.
+// It accepts new connections from the emulator until the done channel is closed,
+// each new connection replaces the previous one.
+// With the shared memory the frames are in the ring (ShmAddrTmpl),
+// the connections have only their slot numbers and
+// the frames go without the copies until their release.
+// The socket and the ring are removed when the done channel is closed,
+// the stale socket of a closed (or crashed) room with the same ID is removed beforehand.
+func NewVideoImporter(roomID string, conf encoderConfig.Importer, done <-chan struct{}) (chan nanoarch.GameFrame, error) {
+	frames, _, err := newVideoImporter(roomID, conf, done, nil)
+	return frames, err
+}
+
+// newVideoImporter is NewVideoImporter which tells about the ends
+// of the streams of the emulators (exited), except the replaced ones.
+// The stop function removes the socket and the ring at once
+// (i.e. before the room with the same ID starts), it's safe to call it many times.
+func newVideoImporter(roomID string, conf encoderConfig.Importer, done <-chan struct{}, exited func()) (
+	chan nanoarch.GameFrame, func(), error) {
+	sockAddr := fmt.Sprintf(SocketAddrTmpl, roomID)
+	imgChan := make(chan nanoarch.GameFrame)
+
+	if err := takeSocket(sockAddr); err != nil {
+		return nil, nil, err
+	}
+
+	var ring *frame.Ring
+	if conf.Shm {
+		r, err := newFrameRing(fmt.Sprintf(ShmAddrTmpl, roomID), conf)
+		if err != nil {
+			log.Printf("warn: no shared memory of the frames, they go over the socket, %v", err)
+		}
+		ring = r
+	}
+
+	l, err := net.Listen("unix", sockAddr)
+	if err != nil {
+		if ring != nil {
+			_ = ring.Close()
+		}
+		releaseSocket(sockAddr)
+		return nil, nil, fmt.Errorf("couldn't listen to the frames, %w", err)
+	}
+
+	log.Println("Creating uds server", sockAddr)
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			// removes the socket file as well
+			_ = l.Close()
+			if ring != nil {
+				_ = ring.Close()
+			}
+			releaseSocket(sockAddr)
+		})
+	}
+	go func() {
+		<-done
+		stop()
+	}()
+	// the number of the current connection
+	var current int32
+	go func(l net.Listener) {
+		var conn net.Conn
+		defer func() {
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}()
+
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				select {
+				case <-done:
+					log.Println("Closed uds server", sockAddr)
+				default:
+					log.Printf("error: uds server accept, %v", err)
+				}
+				return
+			}
+			log.Println("Received new conn")
+			n := atomic.AddInt32(&current, 1)
+			if conn != nil {
+				_ = conn.Close()
+			}
+			conn = c
+
+			log.Println("Spawn Importer")
+			go func(c net.Conn, n int32) {
+				if ring != nil {
+					importRing(c, ring, imgChan, done)
+				} else {
+					importFrames(c, imgChan, done)
+				}
+				if exited == nil || atomic.LoadInt32(&current) != n {
+					return
+				}
+				select {
+				case <-done:
+				default:
+					exited()
+				}
+			}(c, n)
+		}
+	}(l)
+
+	return imgChan, stop, nil
+}
+
+// takeSocket reserves the socket address for the new importer,
+// the socket file without the listener is removed.
+// The sockets of the running importers are never dialed,
+// so their emulators keep their connections.
+func takeSocket(addr string) error {
+	sockets.Lock()
+	defer sockets.Unlock()
+	if _, ok := sockets.addrs[addr]; ok {
+		return fmt.Errorf("%w, %v", ErrSocketInUse, addr)
+	}
+	if _, err := os.Stat(addr); err == nil {
+		// the importer of another worker
+		if conn, err := net.DialTimeout("unix", addr, time.Second); err == nil {
+			_ = conn.Close()
+			return fmt.Errorf("%w, %v", ErrSocketInUse, addr)
+		}
+		log.Printf("warn: removing the stale socket %v", addr)
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("couldn't remove the stale socket, %w", err)
+		}
+	}
+	sockets.addrs[addr] = struct{}{}
+	return nil
+}
+
+func releaseSocket(addr string) {
+	sockets.Lock()
+	defer sockets.Unlock()
+	delete(sockets.addrs, addr)
+}
+
+// roomImporter stops the importer of the room on close.
+type roomImporter struct {
+	mu     sync.Mutex
+	stop   func()
+	closed bool
+}
+
+// importVideo starts the importer of the frames of the emulators without game,
+// it's stopped with the room before the room is closed (see Closed).
+func (r *Room) importVideo(conf encoderConfig.Importer) (<-chan nanoarch.GameFrame, error) {
+	frames, stop, err := newVideoImporter(r.ID, conf, r.Done, r.emulatorExited)
+	if err != nil {
+		return nil, err
+	}
+	r.importer.mu.Lock()
+	defer r.importer.mu.Unlock()
+	if r.importer.closed {
+		stop()
+	}
+	r.importer.stop = stop
+	return frames, nil
+}
+
+// stopImporter removes the socket and the frame ring of the closed room.
+func (r *Room) stopImporter() {
+	r.importer.mu.Lock()
+	defer r.importer.mu.Unlock()
+	r.importer.closed = true
+	if r.importer.stop != nil {
+		r.importer.stop()
+	}
+}
+
+func newFrameRing(path string, conf encoderConfig.Importer) (*frame.Ring, error) {
+	slots, w, h := conf.Slots, conf.MaxWidth, conf.MaxHeight
+	if slots <= 0 {
+		slots = defaultImporterSlots
+	}
+	if w <= 0 || h <= 0 {
+		w, h = defaultImporterMaxWidth, defaultImporterMaxHeight
+	}
+	return frame.CreateShm(path, slots, w*h*4)
+}
+
+// importFrames reads video frames from the stream until it ends.
+// Malformed frames are skipped.
+func importFrames(r io.Reader, imgChan chan<- nanoarch.GameFrame, done <-chan struct{}) {
+	frames := frame.NewReader(r)
+	for {
+		img, duration, err := frames.Read()
+		if err != nil {
+			if err == frame.ErrBadFrame {
+				log.Printf("warn: skipped a bad video frame")
+				continue
+			}
+			if err != io.EOF {
+				log.Printf("warn: video import has stopped, %v", err)
+			}
+			return
+		}
+		select {
+		case imgChan <- nanoarch.GameFrame{Data: img, Duration: duration}:
+		case <-done:
+			return
+		}
+	}
+}
+
+// importRing takes the frames of the slots of the stream from the ring until it ends.
+// The frames are the views of the ring, their slots are freed with the release of their buffers.
+// The stale (overwritten) and malformed frames are skipped.
+func importRing(r io.Reader, ring *frame.Ring, imgChan chan<- nanoarch.GameFrame, done <-chan struct{}) {
+	for {
+		slot, err := frame.ReadSignal(r)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("warn: video import has stopped, %v", err)
+			}
+			return
+		}
+		f, err := ring.Take(slot)
+		switch err {
+		case nil:
+		case frame.ErrStale:
+			continue
+		case frame.ErrBadFrame:
+			log.Printf("warn: skipped a bad video frame")
+			continue
+		default:
+			return
+		}
+		buf := media.NewFrame(f.Image.Pix, f.Release)
+		select {
+		case imgChan <- nanoarch.GameFrame{Data: f.Image, Duration: f.Duration, Buf: buf}:
+		case <-done:
+			buf.Release()
+			return
+		}
+	}
+}
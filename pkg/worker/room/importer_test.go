@@ -0,0 +1,185 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/frame"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+func sendFrame(t *testing.T, conn net.Conn, w, h int) {
+	if err := frame.Write(conn, image.NewRGBA(image.Rect(0, 0, w, h)), time.Millisecond); err != nil {
+		t.Fatalf("couldn't send a frame, %v", err)
+	}
+}
+
+func waitFrame(t *testing.T, frames <-chan nanoarch.GameFrame, w, h int) {
+	select {
+	case f := <-frames:
+		if size := f.Data.Bounds().Size(); size.X != w || size.Y != h {
+			t.Errorf("wrong frame size %v, expected %vx%v", size, w, h)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no frame")
+	}
+}
+
+func TestVideoImporterReconnect(t *testing.T) {
+	roomID := "test_importer_reconnect"
+	done := make(chan struct{})
+	defer close(done)
+	frames, err := NewVideoImporter(roomID, encoderConfig.Importer{}, done)
+	if err != nil {
+		t.Fatalf("couldn't import the frames, %v", err)
+	}
+	addr := fmt.Sprintf(SocketAddrTmpl, roomID)
+
+	conn, err := net.Dial("unix", addr)
+	if err != nil {
+		t.Fatalf("couldn't connect, %v", err)
+	}
+	sendFrame(t, conn, 10, 10)
+	waitFrame(t, frames, 10, 10)
+	_ = conn.Close()
+
+	conn, err = net.Dial("unix", addr)
+	if err != nil {
+		t.Fatalf("couldn't reconnect, %v", err)
+	}
+	defer conn.Close()
+	sendFrame(t, conn, 20, 15)
+	waitFrame(t, frames, 20, 15)
+}
+
+func TestVideoImporterClose(t *testing.T) {
+	roomID := "test_importer_close"
+	done := make(chan struct{})
+	if _, err := NewVideoImporter(roomID, encoderConfig.Importer{}, done); err != nil {
+		t.Fatalf("couldn't import the frames, %v", err)
+	}
+	addr := fmt.Sprintf(SocketAddrTmpl, roomID)
+
+	if _, err := os.Stat(addr); err != nil {
+		t.Fatalf("no socket file, %v", err)
+	}
+	// the socket of the room is taken
+	if _, err := NewVideoImporter(roomID, encoderConfig.Importer{}, done); err == nil {
+		t.Errorf("no error for the taken socket")
+	}
+	close(done)
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(addr); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("the socket file %v wasn't removed", addr)
+}
+
+func TestVideoImporterShm(t *testing.T) {
+	if _, err := os.Stat("/dev/shm"); err != nil {
+		t.Skipf("no shared memory, %v", err)
+	}
+	roomID := "test_importer_shm"
+	done := make(chan struct{})
+	frames, err := NewVideoImporter(roomID, encoderConfig.Importer{Shm: true, Slots: 2, MaxWidth: 32, MaxHeight: 32}, done)
+	if err != nil {
+		t.Fatalf("couldn't import the frames, %v", err)
+	}
+	shm := fmt.Sprintf(ShmAddrTmpl, roomID)
+
+	ring, err := frame.OpenShm(shm)
+	if err != nil {
+		t.Fatalf("couldn't open the frame ring, %v", err)
+	}
+	defer ring.Close()
+	conn, err := net.Dial("unix", fmt.Sprintf(SocketAddrTmpl, roomID))
+	if err != nil {
+		t.Fatalf("couldn't connect, %v", err)
+	}
+	defer conn.Close()
+
+	for _, size := range []int{10, 20, 32} {
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		img.Pix[0] = byte(size)
+		slot, err := ring.Write(img, time.Millisecond)
+		if err != nil {
+			t.Fatalf("couldn't write the frame, %v", err)
+		}
+		if err := frame.WriteSignal(conn, slot); err != nil {
+			t.Fatalf("couldn't send the slot, %v", err)
+		}
+		select {
+		case f := <-frames:
+			if f.Data.Bounds().Dx() != size || f.Data.Pix[0] != byte(size) || f.Buf == nil {
+				t.Errorf("wrong frame %v", f.Data.Bounds())
+			}
+			// frees the slot for the next frames
+			f.Buf.Release()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no frame")
+		}
+	}
+
+	close(done)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(shm); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("the shared memory file %v wasn't removed", shm)
+}
+
+// Tests that the closed room removes its socket before it's closed,
+// so the next room with the same ID takes the socket,
+// and that the stale sockets without the listeners are replaced.
+func TestRoomImporterReuse(t *testing.T) {
+	roomID := "test_importer_reuse"
+	addr := fmt.Sprintf(SocketAddrTmpl, roomID)
+
+	// the socket of the crashed worker
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatalf("couldn't make the stale socket, %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = l.Close()
+	if _, err := os.Stat(addr); err != nil {
+		t.Fatalf("no stale socket, %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		room := newRoom(roomID, make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+		frames, err := room.importVideo(encoderConfig.Importer{})
+		if err != nil {
+			t.Fatalf("room %v couldn't import the frames, %v", i, err)
+		}
+		// the socket of the running room is never taken
+		if _, err := NewVideoImporter(roomID, encoderConfig.Importer{}, room.Done); !errors.Is(err, ErrSocketInUse) {
+			t.Errorf("room %v: no error for the taken socket, %v", i, err)
+		}
+		conn, err := net.Dial("unix", addr)
+		if err != nil {
+			t.Fatalf("room %v: couldn't connect, %v", i, err)
+		}
+		sendFrame(t, conn, 10, 10)
+		waitFrame(t, frames, 10, 10)
+		_ = conn.Close()
+
+		room.Close()
+		<-room.Closed()
+		if _, err := os.Stat(addr); !os.IsNotExist(err) {
+			t.Fatalf("room %v: the socket file is left, %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package room
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// the number of buttons in the input bitmap
+const buttonsNum = 16
+
+// remapInput translates the buttons bitmap (the first two bytes, LE)
+// of the raw user input state with the key mapping.
+// The rest of the state (e.g. axes) is left as is.
+func remapInput(raw []byte, mapping webrtc.KeyMapping) []byte {
+	if len(mapping) == 0 || len(raw) < 2 {
+		return raw
+	}
+	state := uint16(raw[1])<<8 + uint16(raw[0])
+	if state == nanoarch.InputTerminate {
+		return raw
+	}
+
+	var mapped uint16
+	for button := uint8(0); button < buttonsNum; button++ {
+		if (state>>button)&1 == 0 {
+			continue
+		}
+		to, ok := mapping[button]
+		if !ok {
+			to = button
+		}
+		if to < buttonsNum {
+			mapped |= 1 << to
+		}
+	}
+
+	out := make([]byte, len(raw))
+	copy(out, raw)
+	out[0], out[1] = byte(mapped), byte(mapped>>8)
+	return out
+}
+
+// The typed input messages of the peers start with the tag byte
+// followed by the little-endian uint16 values and end with the size
+// of the peer viewport (video element), 11 bytes in total:
+//
+//	mouse:   0x01, dx, dy (int16, the viewport pixels), buttons, viewport width, height
+//	pointer: 0x02, x, y (0-0xffff of the viewport), pressed (0 or 1), viewport width, height
+//	key:     0x03, key code, pressed (bit 0) | location << 8, character (UTF-16), modifiers, 0
+//
+// The key codes and locations are the ones of the browsers, the modifiers are the libretro ones.
+//
+// The joypad states without the tags (2-10 bytes) go as is.
+const (
+	inputTagMouse   = 0x01
+	inputTagPointer = 0x02
+	inputTagKey     = 0x03
+	typedInputSize  = 11
+)
+
+// inputEvent decodes the input message of the peer into the emulator event,
+// the unknown messages are dropped.
+// The typed events keep their messages as the raw state for the input recordings.
+func (r *Room) inputEvent(raw []byte, player int, conn string, mapping webrtc.KeyMapping) (nanoarch.InputEvent, bool) {
+	event := nanoarch.InputEvent{PlayerIdx: player, ConnID: conn}
+	if len(raw) != typedInputSize {
+		event.RawState = remapInput(raw, mapping)
+		return event, true
+	}
+	event.RawState = raw
+	value := func(i int) uint16 { return binary.LittleEndian.Uint16(raw[1+i*2:]) }
+	screen, vw, vh := r.inputScreen(), int(value(3)), int(value(4))
+	switch raw[0] {
+	case inputTagMouse:
+		event.Kind = nanoarch.InputMouse
+		event.Mouse = screen.mouse(int16(value(0)), int16(value(1)), value(2), vw, vh)
+	case inputTagPointer:
+		event.Kind = nanoarch.InputPointer
+		event.Pointer = screen.pointer(value(0), value(1), value(2) != 0, vw, vh)
+	case inputTagKey:
+		key, ok := retroKey(value(0), value(1)>>8)
+		if !ok {
+			return event, false
+		}
+		event.Kind = nanoarch.InputKeyboard
+		event.Keyboard = nanoarch.KeyboardEvent{
+			Down: value(1)&1 == 1,
+			Key:  key,
+			Char: keyChar(value(2)),
+			Mods: value(3) & keyModsMask,
+		}
+	default:
+		return event, false
+	}
+	return event, true
+}
+
+// inputScreen is the game picture the peers point at.
+type inputScreen struct {
+	// the size of the video frames
+	w, h int
+	// the size of the picture in the core pixels
+	coreW, coreH int
+	// the part of the game screen in the picture (cropped with the fill mode)
+	crop viewport.Crop
+}
+
+func (r *Room) inputScreen() inputScreen {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	s := inputScreen{w: r.videoWidth, h: r.videoHeight, coreW: r.nativeWidth, coreH: r.nativeHeight,
+		crop: r.videoView.Crop}
+	if s.coreW <= 0 || s.coreH <= 0 {
+		s.coreW, s.coreH = s.w, s.h
+	}
+	return s
+}
+
+// picture returns the position and the size of the video frames
+// letterboxed in the peer viewport of vw x vh.
+func (s inputScreen) picture(vw, vh int) (x, y, w, h int) {
+	if s.w <= 0 || s.h <= 0 || vw <= 0 || vh <= 0 {
+		return 0, 0, 0, 0
+	}
+	w, h = resizeToAspect(float64(s.w)/float64(s.h), vw, vh)
+	return (vw - w) / 2, (vh - h) / 2, w, h
+}
+
+// mouse scales the mouse motion from the peer viewport into the core pixels.
+func (s inputScreen) mouse(dx, dy int16, buttons uint16, vw, vh int) nanoarch.MouseEvent {
+	m := nanoarch.MouseEvent{Buttons: buttons}
+	if _, _, w, h := s.picture(vw, vh); w > 0 && h > 0 {
+		crop := s.part()
+		m.DX = scaleInt16(float64(dx) * float64(s.coreW) * crop.W / float64(w))
+		m.DY = scaleInt16(float64(dy) * float64(s.coreH) * crop.H / float64(h))
+	}
+	return m
+}
+
+// pointer converts the pointer position (0-0xffff) of the peer viewport
+// into the position on the game screen, outside of the letterboxed picture
+// the pointer is offscreen.
+func (s inputScreen) pointer(x, y uint16, pressed bool, vw, vh int) nanoarch.PointerEvent {
+	p := nanoarch.PointerEvent{X: nanoarch.PointerOffscreen, Y: nanoarch.PointerOffscreen, Pressed: pressed}
+	px, py, w, h := s.picture(vw, vh)
+	if w <= 0 || h <= 0 {
+		return p
+	}
+	fx := (float64(x)/0xffff*float64(vw) - float64(px)) / float64(w)
+	fy := (float64(y)/0xffff*float64(vh) - float64(py)) / float64(h)
+	if fx < 0 || fx > 1 || fy < 0 || fy > 1 {
+		return p
+	}
+	crop := s.part()
+	fx, fy = crop.X+fx*crop.W, crop.Y+fy*crop.H
+	p.X, p.Y = scaleInt16((fx*2-1)*0x7fff), scaleInt16((fy*2-1)*0x7fff)
+	return p
+}
+
+// part returns the part of the game screen in the picture.
+func (s inputScreen) part() viewport.Crop {
+	if s.crop == (viewport.Crop{}) {
+		return viewport.Crop{W: 1, H: 1}
+	}
+	return s.crop
+}
+
+func scaleInt16(v float64) int16 {
+	return int16(math.Max(-0x7fff, math.Min(0x7fff, math.Round(v))))
+}
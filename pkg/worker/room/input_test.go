@@ -0,0 +1,187 @@
+package room
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestRemapInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []byte
+		mapping webrtc.KeyMapping
+		expect  []byte
+	}{
+		{
+			name:   "empty mapping",
+			raw:    []byte{0b0000_0001, 0b0000_0001, 0x10, 0x20},
+			expect: []byte{0b0000_0001, 0b0000_0001, 0x10, 0x20},
+		},
+		{
+			name:    "swap A and B",
+			raw:     []byte{0b0000_0001, 0b0000_0000},
+			mapping: webrtc.KeyMapping{0: 8, 8: 0},
+			expect:  []byte{0b0000_0000, 0b0000_0001},
+		},
+		{
+			name:    "swap A and B pressed together",
+			raw:     []byte{0b0000_0001, 0b0000_0001},
+			mapping: webrtc.KeyMapping{0: 8, 8: 0},
+			expect:  []byte{0b0000_0001, 0b0000_0001},
+		},
+		{
+			name:    "unmapped buttons stay",
+			raw:     []byte{0b1000_0010, 0b1000_0000},
+			mapping: webrtc.KeyMapping{1: 2},
+			expect:  []byte{0b1000_0100, 0b1000_0000},
+		},
+		{
+			name:    "two buttons to one",
+			raw:     []byte{0b0000_0011, 0b0000_0000},
+			mapping: webrtc.KeyMapping{0: 3, 1: 3},
+			expect:  []byte{0b0000_1000, 0b0000_0000},
+		},
+		{
+			name:    "out of range button is dropped",
+			raw:     []byte{0b0000_0001, 0b0000_0000},
+			mapping: webrtc.KeyMapping{0: 16},
+			expect:  []byte{0b0000_0000, 0b0000_0000},
+		},
+		{
+			name:    "axes are kept",
+			raw:     []byte{0b0000_0000, 0b0000_0001, 0x01, 0x02, 0x03, 0x04, 0xFF, 0x7F},
+			mapping: webrtc.KeyMapping{8: 15},
+			expect:  []byte{0b0000_0000, 0b1000_0000, 0x01, 0x02, 0x03, 0x04, 0xFF, 0x7F},
+		},
+		{
+			name:    "terminate signal",
+			raw:     []byte{0xFF, 0xFF},
+			mapping: webrtc.KeyMapping{0: 8, 8: 0},
+			expect:  []byte{0xFF, 0xFF},
+		},
+		{
+			name:    "short state",
+			raw:     []byte{0x01},
+			mapping: webrtc.KeyMapping{0: 8},
+			expect:  []byte{0x01},
+		},
+	}
+
+	for _, test := range tests {
+		raw := append([]byte{}, test.raw...)
+		if out := remapInput(test.raw, test.mapping); !reflect.DeepEqual(out, test.expect) {
+			t.Errorf("%v: expected %08b, got %08b", test.name, test.expect, out)
+		}
+		if !reflect.DeepEqual(raw, test.raw) {
+			t.Errorf("%v: the original state was modified", test.name)
+		}
+	}
+}
+
+// typedInput encodes the typed input message of the peer.
+func typedInput(tag byte, values ...uint16) []byte {
+	raw := make([]byte, 1+len(values)*2)
+	raw[0] = tag
+	for i, v := range values {
+		binary.LittleEndian.PutUint16(raw[1+i*2:], v)
+	}
+	return raw
+}
+
+func TestInputEvents(t *testing.T) {
+	// the 4:3 picture of the 2x upscaled core frames
+	room := &Room{videoWidth: 640, videoHeight: 480, nativeWidth: 320, nativeHeight: 240}
+	// the picture is letterboxed into 800x600 at 100,0 of the 1000x600 viewport
+	vw, vh := uint16(1000), uint16(600)
+	// the viewport position of the pointer (0-0xffff)
+	at := func(x, y float64) (uint16, uint16) {
+		return uint16(x / float64(vw) * 0xffff), uint16(y / float64(vh) * 0xffff)
+	}
+
+	pad, ok := room.inputEvent([]byte{0b0000_0001, 0}, 1, "a", webrtc.KeyMapping{0: 8})
+	if !ok || pad.Kind != nanoarch.InputPad || !reflect.DeepEqual(pad.RawState, []byte{0, 1}) || pad.PlayerIdx != 1 {
+		t.Errorf("wrong joypad event %+v", pad)
+	}
+
+	mouse := typedInput(inputTagMouse, 10, uint16(0x10000-15), nanoarch.MouseLeft, vw, vh)
+	event, ok := room.inputEvent(mouse, 1, "a", nil)
+	if expected := (nanoarch.MouseEvent{DX: 4, DY: -6, Buttons: nanoarch.MouseLeft}); !ok || event.Kind != nanoarch.InputMouse || event.Mouse != expected {
+		t.Errorf("wrong mouse event %+v, expected %+v", event.Mouse, expected)
+	}
+	if !reflect.DeepEqual(event.RawState, mouse) {
+		t.Errorf("the mouse event has lost its message")
+	}
+
+	tests := []struct {
+		name string
+		x, y float64
+		// the expected position, about
+		px, py  int
+		outside bool
+	}{
+		{name: "center", x: 500, y: 300},
+		{name: "top left", x: 100.1, y: 0, px: -0x7fff, py: -0x7fff},
+		{name: "bottom right", x: 899.9, y: 600, px: 0x7fff, py: 0x7fff},
+		{name: "quarter", x: 300, y: 150, px: -0x7fff / 2, py: -0x7fff / 2},
+		{name: "letterbox", x: 50, y: 300, outside: true},
+		{name: "right letterbox", x: 950, y: 10, outside: true},
+	}
+	for _, test := range tests {
+		x, y := at(test.x, test.y)
+		event, ok := room.inputEvent(typedInput(inputTagPointer, x, y, 1, vw, vh), 0, "a", nil)
+		if !ok || event.Kind != nanoarch.InputPointer || !event.Pointer.Pressed {
+			t.Errorf("%v: wrong pointer event %+v", test.name, event)
+			continue
+		}
+		p := event.Pointer
+		if test.outside {
+			if p.X != nanoarch.PointerOffscreen || p.Y != nanoarch.PointerOffscreen {
+				t.Errorf("%v: the pointer %v,%v is not offscreen", test.name, p.X, p.Y)
+			}
+			continue
+		}
+		if abs(int(p.X)-test.px) > 100 || abs(int(p.Y)-test.py) > 100 {
+			t.Errorf("%v: wrong pointer %v,%v, expected about %v,%v", test.name, p.X, p.Y, test.px, test.py)
+		}
+	}
+
+	if _, ok := room.inputEvent(typedInput(0x7f, 1, 2, 3, vw, vh), 0, "a", nil); ok {
+		t.Errorf("the unknown input message has not been dropped")
+	}
+	// no video yet
+	empty := &Room{}
+	if event, _ := empty.inputEvent(typedInput(inputTagPointer, 1, 2, 0, vw, vh), 0, "a", nil); event.Pointer.X != nanoarch.PointerOffscreen {
+		t.Errorf("the pointer is on the screen without the video, %+v", event.Pointer)
+	}
+}
+
+// Tests that the pointer and mouse of the filled (cropped) picture
+// are in the cropped part of the game screen.
+func TestInputEventsCrop(t *testing.T) {
+	// the middle half of the 4:3 core frames fills 640x480
+	room := &Room{videoWidth: 640, videoHeight: 480, nativeWidth: 320, nativeHeight: 240,
+		videoView: viewport.Viewport{Mode: viewport.Fill, Width: 640, Height: 480,
+			Crop: viewport.Crop{X: 0.25, Y: 0.25, W: 0.5, H: 0.5}}}
+	vw, vh := uint16(640), uint16(480)
+
+	event, _ := room.inputEvent(typedInput(inputTagPointer, 0, 0, 1, vw, vh), 0, "a", nil)
+	if p := event.Pointer; abs(int(p.X)+0x7fff/2) > 100 || abs(int(p.Y)+0x7fff/2) > 100 {
+		t.Errorf("wrong pointer %v,%v of the cropped corner", p.X, p.Y)
+	}
+	mouse := typedInput(inputTagMouse, 40, 20, 0, vw, vh)
+	if event, _ := room.inputEvent(mouse, 0, "a", nil); event.Mouse.DX != 10 || event.Mouse.DY != 5 {
+		t.Errorf("wrong mouse motion %+v of the cropped picture", event.Mouse)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,179 @@
+package room
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+const (
+	defaultInputRate  = 1000
+	defaultInputBurst = 200
+	defaultInputKick  = 1000
+	// the max size of the joypad states, the buttons and 4 axes
+	maxJoypadInputSize = 10
+)
+
+// inputLimits keeps the input messages of the peers of the room
+// within their rates, the peers flooding the room with the messages
+// over the rate (or the malformed ones) are disconnected.
+type inputLimits struct {
+	mu    sync.Mutex
+	rate  float64
+	burst float64
+	kick  int
+	// the token buckets of the peers by their IDs
+	peers map[string]*inputLimit
+}
+
+// inputLimit is the token bucket of the input messages of a peer.
+type inputLimit struct {
+	tokens float64
+	last   time.Time
+	// the dropped messages since the start of the current second
+	window  time.Time
+	drops   int
+	dropped uint64
+	kicked  bool
+}
+
+func newInputLimits(conf worker.InputLimit) inputLimits {
+	rate, burst, kick := conf.Rate, conf.Burst, conf.Kick
+	if rate <= 0 {
+		rate = defaultInputRate
+	}
+	if burst <= 0 {
+		burst = defaultInputBurst
+	}
+	if kick <= 0 {
+		kick = defaultInputKick
+	}
+	return inputLimits{rate: rate, burst: float64(burst), kick: kick, peers: map[string]*inputLimit{}}
+}
+
+// allow takes one message from the bucket of the peer.
+func (l *inputLimits) allow(peer string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := l.get(peer, now)
+	limit.tokens += now.Sub(limit.last).Seconds() * l.rate
+	if limit.tokens > l.burst {
+		limit.tokens = l.burst
+	}
+	limit.last = now
+	if limit.tokens < 1 {
+		return false
+	}
+	limit.tokens--
+	return true
+}
+
+// drop counts the dropped message of the peer,
+// it tells once if the peer has dropped too many messages within a second.
+func (l *inputLimits) drop(peer string, now time.Time) (kick bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := l.get(peer, now)
+	limit.dropped++
+	if now.Sub(limit.window) >= time.Second {
+		limit.window, limit.drops = now, 0
+	}
+	limit.drops++
+	if limit.drops > l.kick && !limit.kicked {
+		limit.kicked = true
+		return true
+	}
+	return false
+}
+
+// get returns the bucket of the peer, the new peers start with the full one.
+// Should be called under the lock.
+func (l *inputLimits) get(peer string, now time.Time) *inputLimit {
+	limit := l.peers[peer]
+	if limit == nil {
+		limit = &inputLimit{tokens: l.burst, last: now, window: now}
+		l.peers[peer] = limit
+	}
+	return limit
+}
+
+// dropped returns the numbers of the dropped messages of the peers.
+func (l *inputLimits) dropped() map[string]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var dropped map[string]uint64
+	for id, limit := range l.peers {
+		if limit.dropped == 0 {
+			continue
+		}
+		if dropped == nil {
+			dropped = map[string]uint64{}
+		}
+		dropped[id] = limit.dropped
+	}
+	return dropped
+}
+
+// forget removes the bucket of the gone peer.
+func (l *inputLimits) forget(peer string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.peers, peer)
+}
+
+// validInput tells if the message is of the input sizes,
+// the typed events or the joypad states of the buttons and axes.
+func validInput(raw []byte) bool {
+	if len(raw) == typedInputSize {
+		return true
+	}
+	return len(raw) >= 2 && len(raw) <= maxJoypadInputSize && len(raw)%2 == 0
+}
+
+// allowInput tells if the room takes the input message of the peer,
+// the peers flooding the room are kicked with the reason.
+func (r *Room) allowInput(peer Session, raw []byte) bool {
+	now := time.Now()
+	valid := validInput(raw)
+	if valid && r.inputLimits.allow(peer.GetId(), now) {
+		return true
+	}
+	if valid {
+		metrics.inputDropped.WithLabelValues("rate").Inc()
+	} else {
+		metrics.inputDropped.WithLabelValues("invalid").Inc()
+	}
+	if r.inputLimits.drop(peer.GetId(), now) {
+		// the kick stops the input handler
+		go r.kickFlooder(peer)
+	}
+	return false
+}
+
+// kickFlooder disconnects the peer sending too many input messages.
+func (r *Room) kickFlooder(peer Session) {
+	log.Printf("warn: room %v, the session %v floods the input, disconnecting", r.ID, peer.GetId())
+	r.kickFor(peer, api.KickedInputFlood)
+}
+
+// kickFor tells the peer the reason of its kick and disconnects it
+// after that.
+func (r *Room) kickFor(peer Session, reason string) {
+	if r.findSession(peer.GetId()) == nil {
+		log.Printf("warn: room %v couldn't kick the session %v, %v", r.ID, peer.GetId(), ErrNoSession)
+		return
+	}
+	out, err := (&api.ControlReply{Cmd: api.ControlKicked, Ok: true,
+		Data: api.KickedEvent{Reason: reason}}).To()
+	if err == nil {
+		if err := peer.SendControl([]byte(out)); err != nil {
+			log.Printf("warn: couldn't send %v to %v, %v", api.ControlKicked, peer.GetId(), err)
+		}
+	}
+	log.Printf("Room %v has kicked the session %v (%v)", r.ID, peer.GetId(), reason)
+	r.RemoveSession(peer)
+	peer.StopClient()
+}
@@ -0,0 +1,138 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestValidInput(t *testing.T) {
+	tests := []struct {
+		size  int
+		valid bool
+	}{
+		{size: 0}, {size: 1},
+		{size: 2, valid: true},
+		{size: 3},
+		{size: 6, valid: true},
+		{size: 10, valid: true},
+		{size: typedInputSize, valid: true},
+		{size: 12}, {size: 1024},
+	}
+	for _, test := range tests {
+		if valid := validInput(make([]byte, test.size)); valid != test.valid {
+			t.Errorf("wrong validation %v of %v bytes", valid, test.size)
+		}
+	}
+}
+
+func TestInputLimits(t *testing.T) {
+	l := newInputLimits(worker.InputLimit{Rate: 10, Burst: 2, Kick: 3})
+	now := time.Now()
+	tests := []struct {
+		at    time.Duration
+		allow bool
+	}{
+		{at: 0, allow: true},
+		{at: 0, allow: true},
+		{at: 0, allow: false},
+		{at: 50 * time.Millisecond, allow: false},
+		{at: 100 * time.Millisecond, allow: true},
+		{at: 100 * time.Millisecond, allow: false},
+		{at: time.Second, allow: true},
+		{at: time.Second, allow: true},
+		{at: time.Second, allow: false},
+	}
+	for i, test := range tests {
+		if allow := l.allow("1", now.Add(test.at)); allow != test.allow {
+			t.Errorf("step %v: wrong limit %v at %v", i, allow, test.at)
+		}
+	}
+	// the other peers have their own limits
+	if !l.allow("2", now) {
+		t.Errorf("the peer is limited by the other one")
+	}
+
+	kicks := 0
+	for i := 0; i < 10; i++ {
+		if l.drop("1", now.Add(time.Duration(i)*time.Millisecond)) {
+			kicks++
+		}
+	}
+	if kicks != 1 {
+		t.Errorf("wrong number of the kicks %v, expected once", kicks)
+	}
+	// 1 drop per second
+	for i := 0; i < 5; i++ {
+		if l.drop("2", now.Add(time.Duration(i)*time.Second)) {
+			t.Errorf("the slow peer is kicked")
+		}
+	}
+	if dropped := l.dropped(); dropped["1"] != 10 || dropped["2"] != 5 {
+		t.Errorf("wrong dropped messages %v", dropped)
+	}
+	l.forget("1")
+	if _, ok := l.dropped()["1"]; ok {
+		t.Errorf("the gone peer is in the stats")
+	}
+}
+
+// Tests that the input of the players goes to the emulator
+// while another player floods the room with its messages.
+func TestRoomInputFlood(t *testing.T) {
+	const normal = 120
+	inputs := make(chan nanoarch.InputEvent, 2000)
+	room := newRoom("test_flood", inputs, nil, worker.Config{})
+	defer room.Close()
+	flooder := &webrtc.WebRTC{ID: "flooder", InputChannel: make(chan []byte, 1)}
+	player := &webrtc.WebRTC{ID: "player", InputChannel: make(chan []byte, 1)}
+	_ = room.AddConnectionToRoom(flooder, "")
+	_ = room.AddConnectionToRoom(player, "")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10000; i++ {
+			room.handleInput(flooder, []byte{0x1, 0x0})
+			// and the garbage
+			room.handleInput(flooder, []byte{0x1})
+		}
+	}()
+	for i := 0; i < normal; i++ {
+		room.handleInput(player, []byte{0x2, 0x0})
+	}
+	<-done
+
+	deadline := time.After(time.Second)
+	for room.IsPCInRoom(flooder) {
+		select {
+		case <-deadline:
+			t.Fatalf("the flooder hasn't been kicked")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if !room.IsPCInRoom(player) {
+		t.Errorf("the player has been kicked")
+	}
+
+	got := map[string]int{}
+	for len(inputs) > 0 {
+		e := <-inputs
+		if e.RawState[0] == 0xFF {
+			continue
+		}
+		got[e.ConnID]++
+	}
+	if got[player.ID] != normal {
+		t.Errorf("wrong number of the player inputs %v, expected %v", got[player.ID], normal)
+	}
+	if got[flooder.ID] >= 10000 {
+		t.Errorf("the flooder input is not limited, %v", got[flooder.ID])
+	}
+	if dropped := room.GetStats().InputDropped; dropped[player.ID] != 0 {
+		t.Errorf("the player input has been dropped, %v", dropped)
+	}
+}
@@ -0,0 +1,256 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+var ErrNoKeyboard = errors.New("the game has no keyboard")
+
+// keyboardCapture is the keyboard of the computer cores (DOSBox, Amiga, MSX),
+// only one peer types into the game at a time, the owner by default.
+type keyboardCapture struct {
+	mu sync.Mutex
+	// the keyboard events go to the core
+	enabled bool
+	// the ID of the peer with the keyboard, empty -- the owner
+	holder string
+	// the keys down of the peer (heldBy) typing into the game,
+	// they are released when the keyboard goes to another peer
+	held   map[uint16]bool
+	heldBy string
+}
+
+// releaseKeys returns the key ups of the held keys and forgets them.
+func (k *keyboardCapture) releaseKeys() []nanoarch.InputEvent {
+	var ups []nanoarch.InputEvent
+	for key := range k.held {
+		ups = append(ups, nanoarch.InputEvent{
+			Kind:     nanoarch.InputKeyboard,
+			Keyboard: nanoarch.KeyboardEvent{Key: key},
+			ConnID:   k.heldBy,
+		})
+	}
+	k.held, k.heldBy = nil, ""
+	return ups
+}
+
+// KeyboardHolder returns the ID of the peer typing into the game,
+// empty when the game has no keyboard.
+func (r *Room) KeyboardHolder() string {
+	r.keyboard.mu.Lock()
+	enabled, holder := r.keyboard.enabled, r.keyboard.holder
+	r.keyboard.mu.Unlock()
+	if !enabled {
+		return ""
+	}
+	if holder == "" {
+		return r.Owner()
+	}
+	return holder
+}
+
+// CaptureKeyboard gives the keyboard of the game to the player
+// with the ID (or the user), empty -- to the owner.
+func (r *Room) CaptureKeyboard(id string) error {
+	holder := ""
+	if id != "" {
+		peer := r.findSession(id)
+		if peer == nil {
+			return ErrNoSession
+		}
+		if peer.IsSpectator() {
+			return ErrSpectator
+		}
+		holder = peer.GetId()
+	}
+
+	to := holder
+	if to == "" {
+		to = r.Owner()
+	}
+
+	r.keyboard.mu.Lock()
+	if !r.keyboard.enabled {
+		r.keyboard.mu.Unlock()
+		return ErrNoKeyboard
+	}
+	r.keyboard.holder = holder
+	var ups []nanoarch.InputEvent
+	if r.keyboard.heldBy != to {
+		ups = r.keyboard.releaseKeys()
+	}
+	r.keyboard.mu.Unlock()
+	r.sendKeyUps(ups)
+	log.Printf("Room %v keyboard is captured by %q", r.ID, holder)
+	return nil
+}
+
+// hasKeyboard tells if the keyboard events of the peer go to the game.
+func (r *Room) hasKeyboard(peerconnection Session) bool {
+	return !peerconnection.IsSpectator() && peerconnection.GetId() == r.KeyboardHolder()
+}
+
+// pressKey keeps track of the keys down of the peer with the keyboard,
+// false -- the keyboard events of the peer don't go to the game.
+func (r *Room) pressKey(peerconnection Session, key nanoarch.KeyboardEvent) bool {
+	if !r.hasKeyboard(peerconnection) {
+		return false
+	}
+	r.keyboard.mu.Lock()
+	var ups []nanoarch.InputEvent
+	// the keys of the previous holder (the owner before the transfer)
+	if r.keyboard.heldBy != peerconnection.GetId() {
+		ups = r.keyboard.releaseKeys()
+	}
+	if key.Down {
+		if r.keyboard.held == nil {
+			r.keyboard.held = map[uint16]bool{}
+		}
+		r.keyboard.held[key.Key] = true
+		r.keyboard.heldBy = peerconnection.GetId()
+	} else {
+		delete(r.keyboard.held, key.Key)
+	}
+	r.keyboard.mu.Unlock()
+	r.sendKeyUps(ups)
+	return true
+}
+
+// sendKeyUps sends the key ups of the released keys to the game.
+func (r *Room) sendKeyUps(ups []nanoarch.InputEvent) {
+	for _, event := range ups {
+		event.Time = r.stats.now()
+		r.queueInput(event)
+	}
+}
+
+// releaseKeyboard gives the keyboard of the leaving peer back to the owner
+// and releases the keys it holds.
+func (r *Room) releaseKeyboard(peerconnection Session) {
+	r.keyboard.mu.Lock()
+	if r.keyboard.holder == peerconnection.GetId() {
+		r.keyboard.holder = ""
+	}
+	var ups []nanoarch.InputEvent
+	if r.keyboard.heldBy == peerconnection.GetId() {
+		ups = r.keyboard.releaseKeys()
+	}
+	r.keyboard.mu.Unlock()
+	r.sendKeyUps(ups)
+}
+
+// The locations of the keys of the browsers (KeyboardEvent.location).
+const (
+	keyLocationRight  = 2
+	keyLocationNumpad = 3
+)
+
+// the modifier keys of the keyboard messages (RETROKMOD_*):
+// shift, ctrl, alt, meta, num lock, caps lock, scroll lock
+const keyModsMask = 0x7f
+
+// retroKeys translates the key codes of the browsers (KeyboardEvent.keyCode)
+// into the libretro keys (RETROK_*) of the US layout.
+var retroKeys = func() map[uint16]uint16 {
+	keys := map[uint16]uint16{
+		8:   8,   // backspace
+		9:   9,   // tab
+		12:  12,  // clear
+		13:  13,  // return
+		16:  304, // left shift
+		17:  306, // left ctrl
+		18:  308, // left alt
+		19:  19,  // pause
+		20:  301, // caps lock
+		27:  27,  // escape
+		32:  32,  // space
+		33:  280, // page up
+		34:  281, // page down
+		35:  279, // end
+		36:  278, // home
+		37:  276, // left
+		38:  273, // up
+		39:  275, // right
+		40:  274, // down
+		44:  316, // print
+		45:  277, // insert
+		46:  127, // delete
+		59:  59,  // semicolon (Firefox)
+		61:  61,  // equals (Firefox)
+		91:  311, // left super
+		92:  312, // right super
+		93:  319, // menu
+		106: 268, // keypad multiply
+		107: 270, // keypad plus
+		109: 269, // keypad minus
+		110: 266, // keypad period
+		111: 267, // keypad divide
+		144: 300, // num lock
+		145: 302, // scroll lock
+		173: 45,  // minus (Firefox)
+		186: 59,  // semicolon
+		187: 61,  // equals
+		188: 44,  // comma
+		189: 45,  // minus
+		190: 46,  // period
+		191: 47,  // slash
+		192: 96,  // backquote
+		219: 91,  // left bracket
+		220: 92,  // backslash
+		221: 93,  // right bracket
+		222: 39,  // quote
+	}
+	// the digits
+	for code := uint16('0'); code <= '9'; code++ {
+		keys[code] = code
+	}
+	// the letters are lowercase
+	for code := uint16('A'); code <= 'Z'; code++ {
+		keys[code] = code + 'a' - 'A'
+	}
+	// the keypad digits
+	for code := uint16(96); code <= 105; code++ {
+		keys[code] = 256 + code - 96
+	}
+	// F1-F15
+	for code := uint16(112); code <= 126; code++ {
+		keys[code] = 282 + code - 112
+	}
+	return keys
+}()
+
+// the right keys of the pairs with the same key codes
+var retroKeysRight = map[uint16]uint16{
+	16: 303, // right shift
+	17: 305, // right ctrl
+	18: 307, // right alt
+	91: 312, // right super
+}
+
+// retroKey returns the libretro key of the browser key code
+// at the location of the keyboard.
+func retroKey(code uint16, location uint16) (uint16, bool) {
+	if location == keyLocationRight {
+		if key, ok := retroKeysRight[code]; ok {
+			return key, true
+		}
+	}
+	if location == keyLocationNumpad && code == 13 {
+		return 271, true // keypad enter
+	}
+	key, ok := retroKeys[code]
+	return key, ok
+}
+
+// keyChar returns the character of the key,
+// the surrogates of UTF-16 are not characters.
+func keyChar(c uint16) uint32 {
+	if c >= 0xd800 && c <= 0xdfff {
+		return 0
+	}
+	return uint32(c)
+}
@@ -0,0 +1,177 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestRetroKeys(t *testing.T) {
+	tests := []struct {
+		code, location uint16
+		key            uint16
+	}{
+		{code: 'A', key: 97},
+		{code: 'Z', key: 122},
+		{code: '0', key: 48},
+		{code: '9', key: 57},
+		{code: 13, key: 13},
+		{code: 13, location: keyLocationNumpad, key: 271},
+		{code: 16, location: 1, key: 304},
+		{code: 16, location: keyLocationRight, key: 303},
+		{code: 17, location: keyLocationRight, key: 305},
+		{code: 18, location: 1, key: 308},
+		{code: 91, location: keyLocationRight, key: 312},
+		{code: 32, key: 32},
+		{code: 27, key: 27},
+		{code: 37, key: 276},
+		{code: 38, key: 273},
+		{code: 39, key: 275},
+		{code: 40, key: 274},
+		{code: 96, location: keyLocationNumpad, key: 256},
+		{code: 105, location: keyLocationNumpad, key: 265},
+		{code: 107, location: keyLocationNumpad, key: 270},
+		{code: 112, key: 282},
+		{code: 123, key: 293},
+		{code: 126, key: 296},
+		{code: 189, key: 45},
+		{code: 173, key: 45},
+		{code: 222, key: 39},
+		// only the pairs have the right keys
+		{code: 'A', location: keyLocationRight, key: 97},
+	}
+	for _, test := range tests {
+		if key, ok := retroKey(test.code, test.location); !ok || key != test.key {
+			t.Errorf("wrong key %v (%v) of the key code %v at %v, expected %v", key, ok, test.code, test.location, test.key)
+		}
+	}
+	for _, code := range []uint16{0, 229, 255, 0xffff} {
+		if key, ok := retroKey(code, 0); ok {
+			t.Errorf("the unknown key code %v is the key %v", code, key)
+		}
+	}
+	// RETROK_LAST
+	for code, key := range retroKeys {
+		if key == 0 || key >= 323 {
+			t.Errorf("the key code %v has the wrong key %v", code, key)
+		}
+	}
+}
+
+func TestKeyboardInput(t *testing.T) {
+	room := &Room{}
+	// Shift+A pressed on the right shift, the key codes of the browsers
+	msg := typedInput(inputTagKey, 'A', 1|keyLocationRight<<8, 'A', 0x01|0x80, 0)
+	event, ok := room.inputEvent(msg, 2, "a", webrtc.KeyMapping{0: 8})
+	expected := nanoarch.KeyboardEvent{Down: true, Key: 97, Char: 'A', Mods: 0x01}
+	if !ok || event.Kind != nanoarch.InputKeyboard || event.Keyboard != expected || event.PlayerIdx != 2 {
+		t.Errorf("wrong keyboard event %+v", event)
+	}
+
+	event, ok = room.inputEvent(typedInput(inputTagKey, 16, keyLocationRight<<8, 0, 0, 0), 0, "a", nil)
+	if !ok || event.Keyboard != (nanoarch.KeyboardEvent{Key: 303}) {
+		t.Errorf("wrong keyboard event of the released right shift %+v", event.Keyboard)
+	}
+	// the UTF-16 surrogates
+	if event, _ := room.inputEvent(typedInput(inputTagKey, 'A', 1, 0xd83d, 0, 0), 0, "a", nil); event.Keyboard.Char != 0 {
+		t.Errorf("wrong character %v of the surrogate", event.Keyboard.Char)
+	}
+	if _, ok := room.inputEvent(typedInput(inputTagKey, 229, 1, 0, 0, 0), 0, "a", nil); ok {
+		t.Errorf("the unknown key is not dropped")
+	}
+}
+
+func TestKeyboardCapture(t *testing.T) {
+	room, peers := newPlayersRoom(3)
+	defer room.Close()
+	owner, player := peers[0], peers[1]
+	spectator := &webrtc.WebRTC{ID: "s", Spectator: true}
+	_ = room.AddConnectionToRoom(spectator, "")
+
+	// the games without the keyboard
+	if room.hasKeyboard(owner) || room.KeyboardHolder() != "" {
+		t.Errorf("the game without the keyboard has the holder %q", room.KeyboardHolder())
+	}
+	if err := room.CaptureKeyboard(player.ID); err != ErrNoKeyboard {
+		t.Errorf("captured the missing keyboard, %v", err)
+	}
+
+	room.keyboard.enabled = true
+	if !room.hasKeyboard(owner) || room.hasKeyboard(player) {
+		t.Errorf("the owner should have the keyboard, not %q", room.KeyboardHolder())
+	}
+	if err := room.CaptureKeyboard(player.ID); err != nil {
+		t.Fatalf("couldn't give the keyboard, %v", err)
+	}
+	if room.hasKeyboard(owner) || !room.hasKeyboard(player) {
+		t.Errorf("the player should have the keyboard, not %q", room.KeyboardHolder())
+	}
+	for id, want := range map[string]error{spectator.ID: ErrSpectator, "x": ErrNoSession} {
+		if err := room.CaptureKeyboard(id); err != want {
+			t.Errorf("wrong capture error %v of %v, expected %v", err, id, want)
+		}
+	}
+	if !room.hasKeyboard(player) {
+		t.Errorf("the failed captures have moved the keyboard to %q", room.KeyboardHolder())
+	}
+
+	// back to the owner
+	room.RemoveSession(player)
+	if !room.hasKeyboard(owner) {
+		t.Errorf("the keyboard of the leaving player is not back to the owner, %q", room.KeyboardHolder())
+	}
+	// with the owner
+	room.RemoveSession(owner)
+	if !room.hasKeyboard(peers[2]) {
+		t.Errorf("the keyboard has not moved with the owner, %q", room.KeyboardHolder())
+	}
+}
+
+// Tests that the keys held by the previous holder of the keyboard
+// are released on the handoffs.
+func TestKeyboardHandoff(t *testing.T) {
+	room, peers, input := newDelayRoom(2)
+	defer room.Close()
+	owner, player := peers[0], peers[1]
+	room.keyboard.enabled = true
+
+	ups := func() map[uint16]string {
+		keys := map[uint16]string{}
+		for {
+			select {
+			case event := <-input:
+				if event.Kind == nanoarch.InputKeyboard {
+					if event.Keyboard.Down {
+						t.Errorf("the key %v is pressed on the handoff", event.Keyboard.Key)
+					}
+					keys[event.Keyboard.Key] = event.ConnID
+				}
+			default:
+				return keys
+			}
+		}
+	}
+
+	room.pressKey(owner, nanoarch.KeyboardEvent{Down: true, Key: 97})
+	room.pressKey(owner, nanoarch.KeyboardEvent{Down: true, Key: 304})
+	room.pressKey(owner, nanoarch.KeyboardEvent{Key: 304})
+	if room.pressKey(player, nanoarch.KeyboardEvent{Down: true, Key: 98}) {
+		t.Errorf("the player without the keyboard has pressed the key")
+	}
+	_ = room.CaptureKeyboard(player.ID)
+	if keys := ups(); len(keys) != 1 || keys[97] != owner.ID {
+		t.Errorf("wrong released keys %v of the owner", keys)
+	}
+
+	room.pressKey(player, nanoarch.KeyboardEvent{Down: true, Key: 98})
+	// the same holder
+	_ = room.CaptureKeyboard(player.ID)
+	if keys := ups(); len(keys) != 0 {
+		t.Errorf("the keys %v of the same holder are released", keys)
+	}
+	room.RemoveSession(player)
+	if keys := ups(); len(keys) != 1 || keys[98] != player.ID {
+		t.Errorf("wrong released keys %v of the leaving player", keys)
+	}
+}
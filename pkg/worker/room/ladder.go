@@ -0,0 +1,146 @@
+package room
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
+)
+
+// The bitrate adaptation can't make the large video fit into the slow links,
+// so the video of the room goes down the resolution ladder of the config
+// with the bitrate: the frames are downscaled before their encoding
+// and the encoder is remade for the new size like with the resolution
+// changes of the games. The peers just go on with the new size
+// starting with a keyframe.
+
+// ladderUpInterval is the min time on the step of the ladder
+// before the video goes back up.
+const ladderUpInterval = 10 * time.Second
+
+// resolutionLadder picks the scale of the video for its bitrate.
+//
+// The bitrate goes from the fan-out goroutine
+// and the scale is read by the video one.
+type resolutionLadder struct {
+	mu sync.Mutex
+	// the steps of the descending bitrates
+	steps      []encoderConfig.LadderStep
+	hysteresis float64
+	// the current step, 0 -- the full size
+	level int
+	// the bitrate is above the current step since
+	above time.Time
+	now   func() time.Time
+}
+
+// newResolutionLadder returns the ladder of the config,
+// the steps out of the 0-1 scale are ignored.
+func newResolutionLadder(conf encoderConfig.Ladder) *resolutionLadder {
+	var steps []encoderConfig.LadderStep
+	for _, step := range conf.Steps {
+		if step.Scale <= 0 || step.Scale >= 1 || step.Bitrate == 0 {
+			log.Printf("warn: wrong resolution ladder step %+v", step)
+			continue
+		}
+		steps = append(steps, step)
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Bitrate > steps[j].Bitrate })
+	return &resolutionLadder{steps: steps, hysteresis: math.Max(conf.Hysteresis, 0), now: time.Now}
+}
+
+// update returns the new scale of the video for its bitrate (kbit/s)
+// if it should be changed. The video goes down right away
+// and back up one step at a time when the bitrate has been above the step
+// by the hysteresis share for no less than ladderUpInterval.
+func (l *resolutionLadder) update(kbps uint) (float64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if kbps == 0 || len(l.steps) == 0 {
+		return 0, false
+	}
+	level := l.level
+	for level < len(l.steps) && kbps < l.steps[level].Bitrate {
+		level++
+	}
+	if level == l.level {
+		if level == 0 || float64(kbps) < float64(l.steps[level-1].Bitrate)*(1+l.hysteresis) {
+			l.above = time.Time{}
+			return 0, false
+		}
+		if l.above.IsZero() {
+			l.above = l.now()
+		}
+		if l.now().Sub(l.above) < ladderUpInterval {
+			return 0, false
+		}
+		level--
+	}
+	l.level, l.above = level, time.Time{}
+	return l.scaleOf(level), true
+}
+
+// scale returns the current scale of the video.
+func (l *resolutionLadder) scale() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.scaleOf(l.level)
+}
+
+func (l *resolutionLadder) scaleOf(level int) float64 {
+	if level == 0 {
+		return 1
+	}
+	return l.steps[level-1].Scale
+}
+
+// scaledSize returns the even size of w x h scaled (at least 2x2).
+// The zero scale is the full size.
+func scaledSize(w, h int, scale float64) (int, int) {
+	if scale <= 0 || scale >= 1 {
+		return w, h
+	}
+	even := func(x int) int { return int(math.Max(math.Round(float64(x)*scale/2)*2, 2)) }
+	return even(w), even(h)
+}
+
+// scaleVideo remakes the video of the room for the new scale of the ladder.
+// It returns the encoder of the new frame size for the new pipe
+// of the video of w x h (before the downscale),
+// nil if the size of the frames is the same or the encoder has failed.
+// Should be called by the video goroutine.
+func (r *Room) scaleVideo(scale float64, video encoderConfig.Video) (enc encoder.Encoder, w, h int) {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	w, h = r.videoWidth, r.videoHeight
+	prevW, prevH := scaledSize(w, h, r.videoScale)
+	sw, sh := scaledSize(w, h, scale)
+	if sw == prevW && sh == prevH {
+		r.videoScale = scale
+		return nil, w, h
+	}
+	enc, err := newVideoEncoder(r.videoCodec, sw, sh, video)
+	if err != nil {
+		log.Printf("error: room %v couldn't scale the video to %vx%v, %v", r.ID, sw, sh, err)
+		return nil, w, h
+	}
+	log.Printf("Room %v video scale %vx%v -> %vx%v (%v)", r.ID, prevW, prevH, sw, sh, scale)
+	r.videoScale = scale
+	return enc, w, h
+}
+
+// pipeFilters returns the filters of the video pipe,
+// the video filters and the downscale of the ladder after them.
+// Should be called under videoLock.
+func (r *Room) pipeFilters() filter.Chain {
+	if r.videoScale <= 0 || r.videoScale >= 1 {
+		return r.videoFilters
+	}
+	w, h := scaledSize(r.videoWidth, r.videoHeight, r.videoScale)
+	return append(r.videoFilters[:len(r.videoFilters):len(r.videoFilters)], filter.NewDownscale(w, h))
+}
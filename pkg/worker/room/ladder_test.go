@@ -0,0 +1,155 @@
+package room
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+)
+
+func testLadder() encoderConfig.Ladder {
+	return encoderConfig.Ladder{
+		Steps:      []encoderConfig.LadderStep{{Scale: 0.5, Bitrate: 800}, {Scale: 0.75, Bitrate: 1500}},
+		Hysteresis: 0.25,
+	}
+}
+
+// Tests the switches of the ladder with the bandwidth estimates
+// of the peers going through the bitrate control.
+func TestResolutionLadder(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	b := newBitrateControl(300, 4000)
+	b.now = clock
+	l := newResolutionLadder(testLadder())
+	l.now = clock
+
+	steps := []struct {
+		after    time.Duration
+		estimate uint
+		scale    float64
+		changed  bool
+	}{
+		{estimate: 3000},
+		{after: 2 * time.Second, estimate: 1400, scale: 0.75, changed: true},
+		// right to the bottom
+		{after: 2 * time.Second, estimate: 500, scale: 0.5, changed: true},
+		{after: 2 * time.Second, estimate: 300},
+		// above the step but within the hysteresis (800 * 1.25)
+		{after: 2 * time.Second, estimate: 900},
+		// not long enough above it
+		{after: 2 * time.Second, estimate: 1100},
+		{after: 4 * time.Second, estimate: 1100},
+		{after: 4 * time.Second, estimate: 900},
+		{after: 2 * time.Second, estimate: 1100},
+		{after: 10 * time.Second, estimate: 1100, scale: 0.75, changed: true},
+		// one step at a time
+		{after: 10 * time.Second, estimate: 4000},
+		{after: 10 * time.Second, estimate: 4000, scale: 1, changed: true},
+		// the drops go right away
+		{after: 2 * time.Second, estimate: 1000, scale: 0.75, changed: true},
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		// like adaptBitrate
+		b.update(step.estimate)
+		scale, changed := l.update(b.current)
+		if changed != step.changed || scale != step.scale {
+			t.Errorf("step %v (%v kbit/s): got %v (%v), expected %v (%v)", i, b.current, scale, changed, step.scale, step.changed)
+		}
+	}
+	if s := l.scale(); s != 0.75 {
+		t.Errorf("wrong scale %v", s)
+	}
+}
+
+func TestResolutionLadderDisabled(t *testing.T) {
+	l := newResolutionLadder(encoderConfig.Ladder{Steps: []encoderConfig.LadderStep{{Scale: 1.5, Bitrate: 1000}, {Scale: 0}}})
+	if scale, changed := l.update(100); changed || l.scale() != 1 {
+		t.Errorf("the disabled ladder has changed the scale to %v", scale)
+	}
+}
+
+func TestScaledSize(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		scale  float64
+		sw, sh int
+	}{
+		{w: 1280, h: 720, scale: 0.75, sw: 960, sh: 540},
+		{w: 1920, h: 1080, scale: 0.5, sw: 960, sh: 540},
+		// 256 * 0.75 = 192, 224 * 0.75 = 168
+		{w: 256, h: 224, scale: 0.75, sw: 192, sh: 168},
+		// 214 * 0.75 = 160.5
+		{w: 214, h: 200, scale: 0.75, sw: 160, sh: 150},
+		{w: 4, h: 4, scale: 0.1, sw: 2, sh: 2},
+		{w: 640, h: 480, sw: 640, sh: 480},
+		{w: 640, h: 480, scale: 1, sw: 640, sh: 480},
+	}
+	for _, test := range tests {
+		if w, h := scaledSize(test.w, test.h, test.scale); w != test.sw || h != test.sh {
+			t.Errorf("wrong size %vx%v of %vx%v x%v, expected %vx%v", w, h, test.w, test.h, test.scale, test.sw, test.sh)
+		}
+	}
+}
+
+// Tests that the video of the room goes down the ladder
+// with the keyframes of the downscaled size.
+func TestRoomVideoLadder(t *testing.T) {
+	room := newRoom("test_ladder", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	defer room.Close()
+	room.director = &emulatorMock{closed: make(chan struct{})}
+	frames := make(chan nanoarch.GameFrame)
+	room.imageChannel = frames
+	room.geometry = gameGeometry{meta: emulator.Metadata{BaseWidth: 64, BaseHeight: 48}}
+	room.initVideoFilter(nil, viewport.Viewport{Width: 64, Height: 48}, 64, 48, false)
+
+	conf := testVideoConfig()
+	conf.Ladder = testLadder()
+	ended := make(chan struct{})
+	go func() {
+		room.startVideo(64, 48, conf)
+		close(ended)
+	}()
+	defer func() {
+		close(frames)
+		<-ended
+	}()
+
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+	if scale, ok := room.ladder.update(500); !ok || scale != 0.5 {
+		t.Fatalf("wrong ladder scale %v", scale)
+	}
+	// the second frame goes with the new scale
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+
+	room.videoLock.Lock()
+	w, h, scale, pipe := room.videoWidth, room.videoHeight, room.videoScale, room.vPipe
+	room.videoLock.Unlock()
+	if w != 64 || h != 48 || scale != 0.5 {
+		t.Fatalf("wrong video %vx%v x%v, expected 64x48 x0.5", w, h, scale)
+	}
+
+	timeout := time.After(10 * time.Second)
+	for keyframes := 0; keyframes < 2; {
+		select {
+		case frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}:
+		case frame := <-pipe.Output:
+			if w, h, ok := vp8Size(frame.Data); ok {
+				if w != 32 || h != 24 {
+					t.Fatalf("wrong keyframe size %vx%v, expected 32x24", w, h)
+				}
+				keyframes++
+			}
+			frame.Buf.Release()
+		case <-timeout:
+			t.Fatalf("no keyframes of the downscaled size")
+		}
+	}
+}
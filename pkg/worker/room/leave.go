@@ -0,0 +1,76 @@
+package room
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultLeaveSaveInterval is the min time between the saves of a room
+// after its last player has left.
+const defaultLeaveSaveInterval = time.Minute
+
+// leaveSave limits the saves of the room after its last player has left,
+// so the flapping connections don't save the game all the time.
+type leaveSave struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+func newLeaveSave(seconds int) leaveSave {
+	interval := time.Duration(seconds) * time.Second
+	if interval <= 0 {
+		interval = defaultLeaveSaveInterval
+	}
+	return leaveSave{interval: interval}
+}
+
+// allow tells if the room may save the game now.
+func (s *leaveSave) allow(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.last.IsZero() && now.Sub(s.last) < s.interval {
+		return false
+	}
+	s.last = now
+	return true
+}
+
+// checkLeave saves the game in the background
+// when the peer has been the last player of the room.
+func (r *Room) checkLeave(w Session) {
+	if w.IsSpectator() {
+		return
+	}
+	if players, _ := r.SessionsNum(); players > 0 {
+		return
+	}
+	if !r.leave.allow(time.Now()) {
+		log.Printf("Room %v has been saved recently, skipping the save after the last player", r.ID)
+		return
+	}
+	go r.saveLeft()
+}
+
+// saveLeft saves the game of the room without players,
+// the states are uploaded into the cloud storage only if they have changed.
+func (r *Room) saveLeft() {
+	r.saveLock.Lock()
+	defer r.saveLock.Unlock()
+
+	// the room is saved on close anyway
+	select {
+	case <-r.Done:
+		return
+	default:
+	}
+	if r.director == nil || r.isMoved() {
+		return
+	}
+	if err := r.saveGameSlot(0, true); err != nil {
+		log.Printf("warn: room %v save after the last player has failed, %v", r.ID, err)
+		return
+	}
+	log.Printf("Room %v has been saved after the last player has left", r.ID)
+}
@@ -0,0 +1,131 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestLeaveSave(t *testing.T) {
+	s := newLeaveSave(10)
+	start := time.Now()
+	tests := []struct {
+		at    time.Duration
+		allow bool
+	}{
+		{at: 0, allow: true},
+		{at: 5 * time.Second, allow: false},
+		{at: 10 * time.Second, allow: true},
+		{at: 12 * time.Second, allow: false},
+		{at: 19 * time.Second, allow: false},
+		{at: 30 * time.Second, allow: true},
+	}
+	for _, test := range tests {
+		if allow := s.allow(start.Add(test.at)); allow != test.allow {
+			t.Errorf("wrong save %v at %v", allow, test.at)
+		}
+	}
+	if s := newLeaveSave(0); s.interval != defaultLeaveSaveInterval {
+		t.Errorf("wrong default interval %v", s.interval)
+	}
+}
+
+// newSaveRoom makes the room of the game with the state saved into the dir.
+func newSaveRoom(t *testing.T, id string, store *storageMock, conf worker.Config) (*Room, func()) {
+	dir, err := ioutil.TempDir("", "cloud_game_"+id)
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	room := newRoom(id, make(chan nanoarch.InputEvent, 100), store, conf)
+	room.director = &stateEmulatorMock{
+		emulatorMock: &emulatorMock{closed: make(chan struct{})},
+		path:         filepath.Join(dir, id+".dat"),
+		state:        []byte{1, 2, 3},
+	}
+	return room, func() { _ = os.RemoveAll(dir) }
+}
+
+// waitSaves waits for the number of the saves of the room.
+func waitSaves(t *testing.T, room *Room, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		saves := 0
+		for _, e := range room.Events() {
+			if e.Type == EventSaved {
+				saves++
+			}
+		}
+		if saves == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wrong number of the saves %v, expected %v", saves, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRoomLeaveSave(t *testing.T) {
+	store := &storageMock{}
+	room, cleanup := newSaveRoom(t, "test_leave", store, worker.Config{})
+	defer cleanup()
+	defer room.Close()
+
+	player := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+	spectator := &webrtc.WebRTC{ID: "2", InputChannel: make(chan []byte, 1), Spectator: true}
+	_ = room.AddConnectionToRoom(player, "")
+	_ = room.AddConnectionToRoom(spectator, "")
+
+	room.RemoveSession(spectator)
+	if !room.leave.last.IsZero() {
+		t.Errorf("the room has been saved after the spectator has left")
+	}
+	room.RemoveSession(player)
+	waitSaves(t, room, 1)
+	flushUploads(t, room)
+	if store.uploads != 1 {
+		t.Errorf("the save hasn't been uploaded, %v uploads", store.uploads)
+	}
+
+	// the flapping connection
+	last := room.leave.last
+	player = &webrtc.WebRTC{ID: "3", InputChannel: make(chan []byte, 1)}
+	_ = room.AddConnectionToRoom(player, "")
+	room.RemoveSession(player)
+	if room.leave.last != last {
+		t.Errorf("the room has been saved again within the interval")
+	}
+	// the peer has been removed already
+	room.RemoveSession(player)
+	waitSaves(t, room, 1)
+}
+
+func TestRoomAlwaysSave(t *testing.T) {
+	tests := []struct {
+		always  bool
+		uploads int
+	}{
+		{always: false, uploads: 0},
+		{always: true, uploads: 1},
+	}
+	for _, test := range tests {
+		store := &storageMock{}
+		conf := worker.Config{Emulator: emulator.Emulator{AlwaysCloudSave: test.always}}
+		room, cleanup := newSaveRoom(t, "test_always_save", store, conf)
+		room.Close()
+		<-room.Closed()
+		cleanup()
+		if store.uploads != test.uploads {
+			t.Errorf("wrong number of the uploads %v on close of the new room (always %v), expected %v",
+				store.uploads, test.always, test.uploads)
+		}
+	}
+}
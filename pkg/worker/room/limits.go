@@ -0,0 +1,54 @@
+package room
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrRoomFull = errors.New("the room is full")
+
+// roomLimits caps the numbers of the players and spectators of the room.
+// The limits don't change after the room creation.
+type roomLimits struct {
+	// mu serializes the joins so they don't go over the limits
+	mu sync.Mutex
+	// the players, the emulator ports at most
+	players int
+	// the spectators, 0 -- unlimited
+	spectators int
+}
+
+// playerLimit keeps the number of the players within the emulator ports.
+func playerLimit(players int) int {
+	if players <= 0 || players > maxPlayers {
+		return maxPlayers
+	}
+	return players
+}
+
+// MaxPlayers returns the max number of the players of the room.
+func (r *Room) MaxPlayers() int { return r.limits.players }
+
+// MaxSpectators returns the max number of the spectators of the room,
+// 0 -- unlimited.
+func (r *Room) MaxSpectators() int { return r.limits.spectators }
+
+// isFull tells if the room has no place for the peer,
+// the spectators don't take the places of the players.
+// Should be called under the limits lock.
+func (r *Room) isFull(peerconnection Session) bool {
+	limit := r.limits.players
+	if peerconnection.IsSpectator() {
+		if r.limits.spectators == 0 {
+			return false
+		}
+		limit = r.limits.spectators
+	}
+	n := 0
+	for _, s := range r.rtcSessions.snapshot() {
+		if s.IsSpectator() == peerconnection.IsSpectator() && s.GetId() != peerconnection.GetId() {
+			n++
+		}
+	}
+	return n >= limit
+}
@@ -0,0 +1,61 @@
+package room
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestRoomFull(t *testing.T) {
+	conf := worker.Config{}
+	conf.Room.MaxPlayers = 2
+	conf.Room.MaxSpectators = 1
+	room := newRoom("test_full", make(chan nanoarch.InputEvent, 100), nil, conf)
+	defer room.Close()
+
+	var players []*webrtc.WebRTC
+	for i := 0; i < 2; i++ {
+		peer := &webrtc.WebRTC{ID: strconv.Itoa(i), InputChannel: make(chan []byte, 1)}
+		if err := room.AddConnectionToRoom(peer, ""); err != nil {
+			t.Fatalf("couldn't join the room, %v", err)
+		}
+		players = append(players, peer)
+	}
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "3", InputChannel: make(chan []byte, 1)}, ""); err != ErrRoomFull {
+		t.Errorf("the peer has joined the full room, %v", err)
+	}
+
+	// the spectators have their own limit
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "s1", Spectator: true}, ""); err != nil {
+		t.Errorf("the spectator couldn't join the room, %v", err)
+	}
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "s2", Spectator: true}, ""); err != ErrRoomFull {
+		t.Errorf("the spectator has joined over the limit, %v", err)
+	}
+
+	if stats := room.GetStats(); stats.Players != 2 || stats.MaxPlayers != 2 || stats.MaxSpectators != 1 {
+		t.Errorf("wrong stats %v/%v players, %v spectators", stats.Players, stats.MaxPlayers, stats.MaxSpectators)
+	}
+
+	room.RemoveSession(players[0])
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "3", InputChannel: make(chan []byte, 1)}, ""); err != nil {
+		t.Errorf("the peer couldn't join the room after the leave, %v", err)
+	}
+}
+
+func TestPlayerLimit(t *testing.T) {
+	tests := []struct{ players, limit int }{
+		{players: 0, limit: maxPlayers},
+		{players: -1, limit: maxPlayers},
+		{players: 2, limit: 2},
+		{players: maxPlayers + 1, limit: maxPlayers},
+	}
+	for _, test := range tests {
+		if limit := playerLimit(test.players); limit != test.limit {
+			t.Errorf("wrong limit %v of %v players, expected %v", limit, test.players, test.limit)
+		}
+	}
+}
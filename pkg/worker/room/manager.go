@@ -0,0 +1,139 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoRoom     = errors.New("no such room")
+	ErrRoomExists = errors.New("the room already exists")
+)
+
+// Info is the short description of a room.
+type Info struct {
+	ID         string
+	Game       string
+	Uptime     time.Duration
+	Players    int
+	Spectators int
+	MaxPlayers int
+	Private    bool
+}
+
+// Info returns the short description of the room.
+func (r *Room) Info() Info {
+	info := Info{
+		ID:         r.ID,
+		Game:       r.game.Name,
+		Uptime:     time.Since(r.created),
+		MaxPlayers: r.MaxPlayers(),
+		Private:    r.IsPrivate(),
+	}
+	r.rtcSessions.ForEach(func(peer Session) {
+		if peer.IsSpectator() {
+			info.Spectators++
+		} else {
+			info.Players++
+		}
+	})
+	return info
+}
+
+// Manager keeps the active rooms of the worker by their IDs.
+type Manager struct {
+	mu    sync.Mutex
+	rooms map[string]*Room
+}
+
+func NewManager() *Manager { return &Manager{rooms: map[string]*Room{}} }
+
+// Create makes a new room with the create function,
+// unless there is an open room with the ID already,
+// so two rooms never share their sockets and save files.
+// The empty ID is generated by the function.
+func (m *Manager) Create(id string, create func() *Room) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.rooms[id]; ok && !isDone(r) {
+		return nil, ErrRoomExists
+	}
+	r := create()
+	if old, ok := m.rooms[r.ID]; ok && old != r && !isDone(old) {
+		r.Close()
+		return nil, ErrRoomExists
+	}
+	m.rooms[r.ID] = r
+	return r, nil
+}
+
+// Get returns the room with the ID, nil if there is none.
+func (m *Manager) Get(id string) *Room {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rooms[id]
+}
+
+// Has tells if there is an open room with the ID.
+func (m *Manager) Has(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rooms[id]
+	return ok && !isDone(r)
+}
+
+// List returns the rooms sorted by their IDs.
+func (m *Manager) List() []*Room {
+	m.mu.Lock()
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+	m.mu.Unlock()
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	return rooms
+}
+
+// Len returns the number of the rooms.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.rooms)
+}
+
+// Remove removes the room unless it's been replaced with another one.
+func (m *Manager) Remove(r *Room) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rooms[r.ID] == r {
+		delete(m.rooms, r.ID)
+	}
+}
+
+// Terminate saves and closes the room with the ID,
+// it waits until the room is shut down.
+func (m *Manager) Terminate(id string) error {
+	r := m.Get(id)
+	if r == nil {
+		return ErrNoRoom
+	}
+	if err := r.SaveGame(); err != nil && err != ErrNotStarted {
+		log.Printf("error: couldn't save the terminated room %v, %v", id, err)
+	}
+	r.Close()
+	<-r.Closed()
+	m.Remove(r)
+	return nil
+}
+
+func isDone(r *Room) bool {
+	select {
+	case <-r.Done:
+		return true
+	default:
+		return false
+	}
+}
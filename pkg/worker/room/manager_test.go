@@ -0,0 +1,108 @@
+package room
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+func newManagedRoom(id string) func() *Room {
+	return func() *Room {
+		return newRoom(id, make(chan nanoarch.InputEvent, 100), &storageMock{}, worker.Config{})
+	}
+}
+
+func TestManagerDuplicates(t *testing.T) {
+	m := NewManager()
+	var created, rejected int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Create("test_manager", func() *Room {
+				atomic.AddInt32(&created, 1)
+				return newManagedRoom("test_manager")()
+			})
+			if err == ErrRoomExists {
+				atomic.AddInt32(&rejected, 1)
+			} else if err != nil {
+				t.Errorf("couldn't create the room, %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if created != 1 || rejected != 9 {
+		t.Errorf("wrong number of the rooms, %v created, %v rejected", created, rejected)
+	}
+
+	// the closed rooms are replaced
+	old := m.Get("test_manager")
+	old.Close()
+	if m.Has("test_manager") {
+		t.Errorf("the closed room is still open")
+	}
+	r, err := m.Create("test_manager", newManagedRoom("test_manager"))
+	if err != nil {
+		t.Fatalf("couldn't replace the closed room, %v", err)
+	}
+	defer r.Close()
+	m.Remove(old)
+	if m.Get("test_manager") != r {
+		t.Errorf("the closed room has removed its replacement")
+	}
+}
+
+func TestManagerConcurrency(t *testing.T) {
+	m := NewManager()
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		id := fmt.Sprintf("test_manager_%02d", i)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Create(id, newManagedRoom(id)); err != nil {
+				t.Errorf("couldn't create the room %v, %v", id, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for _, r := range m.List() {
+				_ = r.Info()
+			}
+		}()
+	}
+	wg.Wait()
+
+	rooms := m.List()
+	if len(rooms) != n {
+		t.Fatalf("wrong number of the rooms %v", len(rooms))
+	}
+	for i, r := range rooms {
+		if id := fmt.Sprintf("test_manager_%02d", i); r.ID != id {
+			t.Errorf("wrong room order %v, expected %v", r.ID, id)
+		}
+	}
+
+	for _, r := range rooms {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := m.Terminate(id); err != nil {
+				t.Errorf("couldn't terminate the room %v, %v", id, err)
+			}
+		}(r.ID)
+	}
+	wg.Wait()
+	if m.Len() != 0 {
+		t.Errorf("%v rooms are left", m.Len())
+	}
+	if err := m.Terminate("test_manager_00"); err != ErrNoRoom {
+		t.Errorf("terminated the missing room, %v", err)
+	}
+}
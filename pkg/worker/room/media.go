@@ -1,18 +1,23 @@
 package room
 
 import (
+	"errors"
 	"fmt"
+	"image"
 	"log"
+	"time"
 
 	"github.com/giongto35/cloud-game/v2/pkg/codec"
 	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/av1"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder/h264"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/hw"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder/opus"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder/vpx"
 	"github.com/giongto35/cloud-game/v2/pkg/media"
 	"github.com/giongto35/cloud-game/v2/pkg/recorder"
-	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
 )
 
 //func (r *Room) startVoice() {
@@ -41,105 +46,515 @@ import (
 
 func (r *Room) isRecording() bool { return r.rec != nil && r.rec.Enabled() }
 
-func (r *Room) startAudio(sampleRate int, audio encoderConfig.Audio) {
-	buf := media.NewBuffer(audio.GetFrameSizeFor(sampleRate))
-	resample, resampleSize := sampleRate != audio.Frequency, 0
-	if resample {
-		resampleSize = audio.GetFrameSize()
-	}
-	enc, err := opus.NewEncoder(audio.Frequency, audio.Channels)
+var errNoAudio = errors.New("the room has no audio encoder")
+
+// audioEncoder is the audio encoder of the room.
+type audioEncoder interface {
+	Encode(pcm []int16) ([]byte, error)
+	SetBitrate(bitrate opus.Bitrate) error
+}
+
+// startAudio encodes the audio of the core sample rate
+// resampled into the frames of the encoder frequency.
+func (r *Room) startAudio(sampleRate float64, audio encoderConfig.Audio) {
+	audio, err := audio.Clamp()
 	if err != nil {
+		log.Printf("warn: room %v, %v", r.ID, err)
+	}
+	res := media.NewResampler(audio.Resampler, sampleRate, float64(audio.Frequency), audio.Channels)
+	// the frames of the already resampled audio,
+	// so the fractional rates don't need any integer ratio
+	buf := media.NewBuffer(audio.GetFrameSize())
+	dropped := false
+	enc, err := newOpusEncoder(audio)
+	if enc == nil {
 		log.Fatalf("error: cannot create audio encoder, %v", err)
 	}
+	if err != nil {
+		log.Printf("warn: audio encoder settings, %v", err)
+	}
 	log.Printf("OPUS: %v", enc.GetInfo())
+	r.audioLock.Lock()
+	r.audioEnc, r.audioConf, r.newAudioEnc = enc, audio, newAudioEncoder
+	r.audioLock.Unlock()
 
-	for samples := range r.audioChannel {
+	for batch := range r.audioChannel {
+		samples := batch.Samples
 		if r.isRecording() {
 			r.rec.WriteAudio(recorder.Audio{Samples: &samples})
 		}
-		buf.Write(samples, func(s media.Samples) {
-			if resample {
-				s = media.ResampleStretch(s, resampleSize)
-			}
-			dat, err := enc.Encode(s)
-			if err == nil {
-				r.broadcastAudio(dat)
-			}
+		if len(samples)%audio.Channels != 0 && !dropped {
+			log.Printf("warn: room %v, dropped the audio samples of incomplete frames (%v samples, %v channels)",
+				r.ID, len(samples), audio.Channels)
+			dropped = true
+		}
+		// the media time of the first buffered sample,
+		// the frames go one after another from it
+		ts := batch.Timestamp - samplesTime(buf.Len(), audio)
+		buf.Write(res.Resample(samples), func(pcm media.Samples) {
+			r.encodeAudio(pcm, ts)
+			ts += samplesTime(len(pcm), audio)
 		})
 	}
 	log.Println("Room ", r.ID, " audio channel closed")
 }
 
-func (r *Room) broadcastAudio(audio []byte) {
-	for _, webRTC := range r.rtcSessions {
-		if webRTC.IsConnected() {
-			// NOTE: can block here
-			webRTC.AudioChannel <- audio
+// samplesTime returns the play time of the number of the samples
+// (of all the channels) of the audio.
+func samplesTime(n int, audio encoderConfig.Audio) time.Duration {
+	return time.Duration(float64(n) / float64(audio.Frequency*audio.Channels) * float64(time.Second))
+}
+
+func newOpusEncoder(audio encoderConfig.Audio) (*opus.Encoder, error) {
+	return opus.NewEncoder(audio.Frequency, audio.Channels,
+		opus.WithBitrate(audio.Bitrate),
+		opus.WithComplexity(audio.Complexity),
+		opus.WithFEC(audio.EnableFEC, audio.ExpectedPacketLoss),
+	)
+}
+
+// SetAudioBitrate changes the bitrate (bit/s) of the audio encoder of the room,
+// the wrong values are clamped.
+func (r *Room) SetAudioBitrate(bitrate int) error {
+	audio, err := encoderConfig.Audio{Bitrate: bitrate}.Clamp()
+	if err != nil {
+		log.Printf("warn: room %v, %v", r.ID, err)
+	}
+	r.audioLock.Lock()
+	defer r.audioLock.Unlock()
+	if r.audioEnc == nil {
+		return errNoAudio
+	}
+	r.audioConf.Bitrate = audio.Bitrate
+	for _, enc := range r.volumeEnc {
+		if err := enc.SetBitrate(opus.Bitrate(audio.Bitrate)); err != nil {
+			return err
 		}
 	}
+	return r.audioEnc.SetBitrate(opus.Bitrate(audio.Bitrate))
 }
 
-// startVideo processes imageChannel images with an encoder (codec) then pushes the result to WebRTC.
-func (r *Room) startVideo(width, height int, video encoderConfig.Video) {
-	var enc encoder.Encoder
-	var err error
-
-	log.Println("Video codec:", video.Codec)
-	if video.Codec == string(codec.H264) {
-		enc, err = h264.NewEncoder(width, height, h264.WithOptions(h264.Options{
-			Crf:      video.H264.Crf,
-			Tune:     video.H264.Tune,
-			Preset:   video.H264.Preset,
-			Profile:  video.H264.Profile,
-			LogLevel: int32(video.H264.LogLevel),
+// broadcastVideo sends a frame of the layer to all connected peers of the layer,
+// the sinks of the room get the main layer. Slow peers don't block the others, they just lose frames.
+func (r *Room) broadcastVideo(frame encoder.OutFrame, layer videoLayer) {
+	r.rtcSessions.ForEach(func(webRTC Session) {
+		if !webRTC.IsConnected() || !r.layers.send(webRTC.GetId(), layer, frame.Keyframe) {
+			return
+		}
+		// each peer releases the frame after its write
+		sendVideo(webRTC, frame)
+	})
+	if layer == layerHigh {
+		r.sinks.forEach(func(sink Sink) { sendVideo(sink, frame) })
+	}
+}
+
+// dropWatch periodically checks how many video frames
+// the room peers drop and complains about the slow ones.
+type dropWatch struct {
+	threshold float64
+	last      time.Time
+	// session ID -> the number of sent and dropped frames on the last check
+	seen map[string][2]uint64
+}
+
+func (d *dropWatch) check(roomID string, sessions *Sessions) {
+	if d.threshold <= 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(d.last) < time.Second {
+		return
+	}
+	d.last = now
+
+	seen := make(map[string][2]uint64, len(d.seen))
+	sessions.ForEach(func(webRTC Session) {
+		frames, dropped := webRTC.VideoFrames(), webRTC.DroppedVideoFrames()
+		prev := d.seen[webRTC.GetId()]
+		seen[webRTC.GetId()] = [2]uint64{frames, dropped}
+		if n := frames - prev[0]; n > 0 {
+			if rate := float64(dropped-prev[1]) / float64(n); rate > d.threshold {
+				log.Printf("warn: room %v, peer %v dropped %.0f%% of video frames (%v total)",
+					roomID, webRTC.GetId(), rate*100, dropped)
+			}
+		}
+	})
+	d.seen = seen
+}
+
+// newVideoEncoder creates a new video encoder of the codec.
+// The hardware encoder of the config is used if it's available,
+// otherwise the software one with a warning.
+// The AV1 encoder is available only with the av1 build tag (libaom),
+// otherwise it returns av1.ErrUnavailable.
+func newVideoEncoder(c codec.VideoCodec, width, height int, video encoderConfig.Video) (encoder.Encoder, error) {
+	if video.Backend != "" {
+		enc, err := newHwEncoder(c, width, height, video)
+		if err == nil {
+			return enc, nil
+		}
+		log.Printf("warn: no %v encoder of %v, fallback to software, %v", video.Backend, c, err)
+	}
+	switch c {
+	case codec.H264:
+		conf, err := video.H264.Check()
+		if err != nil {
+			log.Printf("warn: %v", err)
+		}
+		return newH264Encoder(width, height, h264.Options{
+			Crf:           conf.Crf,
+			Tune:          conf.Tune,
+			Preset:        conf.Preset,
+			Profile:       conf.Profile,
+			LogLevel:      int32(conf.LogLevel),
+			Bitrate:       video.Bitrate.Max,
+			Level:         conf.Level,
+			RateControl:   conf.RateControl,
+			TargetBitrate: conf.Bitrate,
+			Entropy:       conf.Entropy,
+			Fps:           video.Fps,
+		})
+	case codec.VP9:
+		return vpx.NewEncoder(width, height, vpx.WithOptions(vpx.Options{
+			Bitrate:     video.Vp9.Bitrate,
+			KeyframeInt: video.Vp9.KeyframeInterval,
+			Vp9:         true,
+			Speed:       video.Vp9.Speed,
+			Fps:         video.Fps,
 		}))
-	} else {
-		enc, err = vpx.NewEncoder(width, height, vpx.WithOptions(vpx.Options{
+	case codec.AV1:
+		return av1.NewEncoder(width, height, av1.WithOptions(av1.Options{
+			Bitrate:     video.Av1.Bitrate,
+			KeyframeInt: video.Av1.KeyframeInterval,
+			Speed:       video.Av1.Speed,
+			Fps:         video.Fps,
+		}))
+	default:
+		return vpx.NewEncoder(width, height, vpx.WithOptions(vpx.Options{
 			Bitrate:     video.Vpx.Bitrate,
 			KeyframeInt: video.Vpx.KeyframeInterval,
+			Fps:         video.Fps,
 		}))
 	}
+}
+
+// newH264Encoder creates the x264 encoder with the options.
+var newH264Encoder = func(width, height int, opts h264.Options) (encoder.Encoder, error) {
+	enc, err := h264.NewEncoder(width, height, h264.WithOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// newHwEncoder creates a new hardware video encoder of the codec.
+// The hardware encoders are available only with the hwenc build tag (FFmpeg),
+// otherwise it returns hw.ErrUnavailable.
+func newHwEncoder(c codec.VideoCodec, width, height int, video encoderConfig.Video) (encoder.Encoder, error) {
+	enc, err := hw.NewEncoder(width, height, hw.WithOptions(hw.Options{
+		Backend: video.Backend,
+		Device:  video.Device,
+		Codec:   string(c),
+		Bitrate: video.Bitrate.Max,
+		Fps:     video.Fps,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// selectVideoCodec picks the most preferred codec supported by all the room peers
+// and creates its encoder. If they don't have a common codec or the encoder
+// of the codec is not available the default codec is used instead.
+// The peers are switched to the codec, and the peers joined later
+// get the same codec in AddConnectionToRoom or are rejected without it.
+func (r *Room) selectVideoCodec(width, height int, video encoderConfig.Video) (encoder.Encoder, error) {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+
+	def := codec.VideoCodec(video.Codec)
+	var peers [][]codec.VideoCodec
+	r.rtcSessions.ForEach(func(webRTC Session) {
+		if codecs := webRTC.VideoCodecs(); len(codecs) > 0 {
+			peers = append(peers, codecs)
+		}
+	})
+	c := codec.Select(def, peers...)
 
+	enc, err := newVideoEncoder(c, width, height, video)
+	if err != nil && c != def {
+		log.Printf("warn: room %v, no %v encoder (%v), fallback to %v", r.ID, c, err, def)
+		c = def
+		enc, err = newVideoEncoder(c, width, height, video)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Room %v video codec: %v", r.ID, c)
+	r.videoCodec = c
+	r.rtcSessions.ForEach(r.setPeerCodec)
+	return enc, nil
+}
+
+// setPeerCodec switches the peer video to the room codec.
+// Should be called under videoLock.
+func (r *Room) setPeerCodec(webRTC Session) {
+	if r.videoCodec == "" {
+		return
+	}
+	if err := webRTC.SetVideoCodec(r.videoCodec); err != nil {
+		log.Printf("warn: room %v, peer %v, %v", r.ID, webRTC.GetId(), err)
+	}
+}
+
+// joinCodec switches the video of the joining peer to the codec of the room,
+// the peers which haven't negotiated the codec are rejected with ErrNoCodec
+// since the running encoder isn't switched for them.
+// The peers without the negotiated codecs get the codec as is.
+func (r *Room) joinCodec(webRTC Session) error {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	if r.videoCodec == "" {
+		return nil
+	}
+	if codecs := webRTC.VideoCodecs(); len(codecs) > 0 && !codec.Has(codecs, r.videoCodec) {
+		log.Printf("warn: room %v, peer %v has no %v video (%v)", r.ID, webRTC.GetId(), r.videoCodec, codecs)
+		return ErrNoCodec
+	}
+	if err := webRTC.SetVideoCodec(r.videoCodec); err != nil {
+		log.Printf("warn: room %v, peer %v, %v", r.ID, webRTC.GetId(), err)
+		return ErrNoCodec
+	}
+	return nil
+}
+
+// forceKeyframe asks the video encoders for a keyframe (rate-limited).
+func (r *Room) forceKeyframe() {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	if r.vPipe != nil {
+		r.vPipe.ForceKeyframe()
+	}
+	if r.vPipeLow != nil {
+		r.vPipeLow.ForceKeyframe()
+	}
+}
+
+// copyImage returns a copy of the image.
+func copyImage(img *image.RGBA) *image.RGBA {
+	if img == nil {
+		return nil
+	}
+	return &image.RGBA{Pix: append([]byte(nil), img.Pix...), Stride: img.Stride, Rect: img.Rect}
+}
+
+// startVideo processes imageChannel images with an encoder (codec) then pushes the result to WebRTC.
+// The video is resized with the resolution changes of the game.
+func (r *Room) startVideo(width, height int, video encoderConfig.Video) {
+	enc, err := r.selectVideoCodec(width, height, video)
 	if err != nil {
 		fmt.Println("error create new encoder", err)
 		return
 	}
+	r.encodeVideo(enc, width, height, video)
+}
+
+// encodeVideo pushes the frames of imageChannel into the encoder.
+// The frames are skipped when the encoder can't keep up, see frameSkip.
+// Without the frames of the game the status banners of the room go instead.
+func (r *Room) encodeVideo(enc encoder.Encoder, width, height int, video encoderConfig.Video) {
+	r.bitrate = newBitrateControl(video.Bitrate.Min, video.Bitrate.Max)
+	r.lowBitrate = newBitrateControl(video.Bitrate.Min/2, video.Bitrate.Max/2)
+	r.ladder = newResolutionLadder(video.Ladder)
+	r.videoLock.Lock()
+	r.videoScale = 1
+	r.videoLock.Unlock()
+	scale := 1.0
+	pipe, low, stop := r.startVideoPipes(enc, width, height, video)
+	defer func() { stop() }()
+
+	status := time.NewTicker(statusInterval)
+	defer status.Stop()
+	// the time of the last frame of the game and its media time
+	live := time.Now()
+	var liveTs time.Duration
+
+	// the input of the skipped frames goes with the next frame
+	var input time.Time
+	// the frames are pooled, each of their holders releases them
+	for {
+		var frame nanoarch.GameFrame
+		var ok bool
+		select {
+		case frame, ok = <-r.imageChannel:
+		case now := <-status.C:
+			if now.Sub(live) >= statusInterval {
+				// the banners go on with the media time of the game
+				r.sendStatus(pipe, low, liveTs+now.Sub(live))
+			}
+			continue
+		}
+		if !ok {
+			break
+		}
+		live, liveTs = time.Now(), frame.Timestamp
+		if frame.Geometry != nil && r.geometry.follows() {
+			// the frames of the old size are dropped by the new pipe
+			if enc, w, h := r.resizeVideo(*frame.Geometry, video); enc != nil {
+				stop()
+				pipe, low, stop = r.startVideoPipes(enc, w, h, video)
+			}
+		}
+		if s := r.ladder.scale(); s != scale {
+			scale = s
+			if enc, w, h := r.scaleVideo(s, video); enc != nil {
+				stop()
+				pipe, low, stop = r.startVideoPipes(enc, w, h, video)
+				pipe.ForceKeyframe()
+			}
+		}
+		if enc, w, h := r.restartStalledVideo(video); enc != nil {
+			r.stopStalled(stop)
+			pipe, low, stop = r.startVideoPipes(enc, w, h, video)
+		}
+		r.stats.frame()
+		if !frame.Input.IsZero() {
+			r.stats.input(frame.InputWait)
+			metrics.input("core", frame.InputWait)
+			if input.IsZero() {
+				input = frame.Input
+			}
+		}
+		r.tickFrame()
+		r.screenshots.tee(frame.Data, frame.Buf)
+		skipped := r.skips.skip(len(r.imageChannel), frame.Duration)
+		if skipped {
+			r.stats.skip()
+			metrics.skipped.Inc()
+		} else {
+			if r.isRecording() {
+				// the recorder keeps the frames longer than the pool
+				go r.rec.WriteVideo(recorder.Video{Image: copyImage(frame.Data), Duration: frame.Duration})
+			}
+			// the latest frame replaces the one the encoder hasn't taken yet
+			select {
+			case old := <-pipe.Input:
+				old.Buf.Release()
+				if !old.Input.IsZero() {
+					input = old.Input
+				}
+				r.stats.drop()
+				metrics.dropped.Inc()
+				skipped = true
+				r.encoderTaken(false)
+			default:
+				r.encoderTaken(true)
+			}
+			frame.Buf.Retain()
+			pipe.Input <- encoder.InFrame{Image: frame.Data, Duration: frame.Duration, Time: time.Now(), Buf: frame.Buf, Input: input,
+				Timestamp: frame.Timestamp}
+			input = time.Time{}
+			if low != nil {
+				select {
+				case old := <-low.Input:
+					old.Buf.Release()
+				default:
+				}
+				frame.Buf.Retain()
+				low.Input <- encoder.InFrame{Image: frame.Data, Duration: frame.Duration, Time: time.Now(), Buf: frame.Buf,
+					Timestamp: frame.Timestamp}
+			}
+		}
+		if rate, ok := r.skips.count(skipped); ok {
+			log.Printf("warn: room %v, the video encoder is overloaded, %.0f%% of frames skipped", r.ID, rate*100)
+		}
+		frame.Buf.Release()
+	}
+	log.Println("Room ", r.ID, " video channel closed")
+}
 
-	r.vPipe = encoder.NewVideoPipe(enc, width, height)
-	einput, eoutput := r.vPipe.Input, r.vPipe.Output
+// newVideoPipe makes the encoder pipe of the room video of w x h
+// with the current filters, scale and bitrate of the room.
+// The encoder should be of the scaled size.
+func (r *Room) newVideoPipe(enc encoder.Encoder, w, h int) *encoder.VideoPipe {
+	r.videoLock.Lock()
+	sw, sh := scaledSize(w, h, r.videoScale)
+	r.videoLock.Unlock()
+	pipe := encoder.NewVideoPipe(enc, sw, sh)
+	if kbps := r.bitrate.current; kbps > 0 {
+		pipe.SetBitrate(kbps)
+	}
+	pipe.OnRestart(func(err error) { r.event(Event{Type: EventEncoderRestart, Reason: err.Error()}) })
+	pipe.OnFailure(func(err error) {
+		log.Printf("error: room %v video encoder keeps failing, closing, %v", r.ID, err)
+		// the pipe is stopped with the room
+		go r.fail(ErrVideo)
+	})
+	r.watchPipeStalls(pipe)
+	r.videoLock.Lock()
+	r.vPipe = pipe
+	r.videoWidth, r.videoHeight = w, h
+	pipe.SetFilter(r.pipeFilters())
+	r.videoLock.Unlock()
+	return pipe
+}
 
-	go r.vPipe.Start()
-	defer r.vPipe.Stop()
+// startVideoPipes makes and starts the video pipe of the encoder for the video of w x h,
+// and the pipe of the low layer with the simulcast (or nil), stop stops them all.
+func (r *Room) startVideoPipes(enc encoder.Encoder, w, h int, video encoderConfig.Video) (
+	pipe, low *encoder.VideoPipe, stop func()) {
+	pipe = r.newVideoPipe(enc, w, h)
+	stopHigh := r.runVideoPipe(pipe, layerHigh)
+	if low = r.newLowPipe(w, h, video); low == nil {
+		return pipe, nil, stopHigh
+	}
+	stopLow := r.runVideoPipe(low, layerLow)
+	return pipe, low, func() {
+		stopHigh()
+		stopLow()
+	}
+}
 
+// runVideoPipe starts the pipe and the fan-out of its frames to the peers of the layer,
+// stop stops them both. The stats, the recording and the bitrate adaptation
+// go with the high layer.
+func (r *Room) runVideoPipe(pipe *encoder.VideoPipe, layer videoLayer) (stop func()) {
+	fanout := make(chan struct{})
+	go pipe.Start()
 	go func() {
+		defer close(fanout)
 		defer func() {
-			if r := recover(); r != nil {
-				fmt.Println("Recovered when sent to close Image Channel")
+			if err := recover(); err != nil {
+				log.Printf("Warn: room %v recovered when sent to close the video channel, %v", r.ID, err)
 			}
 		}()
 
 		// fanout Screen
-		for data := range eoutput {
-			// TODO: r.rtcSessions is rarely updated. Lock will hold down perf
-			for _, webRTC := range r.rtcSessions {
-				if !webRTC.IsConnected() {
-					continue
-				}
-				// encode frame
-				// fanout imageChannel
-				// NOTE: can block here
-				webRTC.ImageChannel <- webrtc.WebFrame{Data: data.Data, Duration: data.Duration}
+		for data := range pipe.Output {
+			if layer == layerLow {
+				r.broadcastVideo(data, layer)
+				data.Buf.Release()
+				continue
 			}
-		}
-	}()
-
-	for frame := range r.imageChannel {
-		if len(einput) < cap(einput) {
-			if r.isRecording() {
-				go r.rec.WriteVideo(recorder.Video{Image: frame.Data, Duration: frame.Duration})
+			r.stats.encode(data.Time)
+			r.stats.video(data.Timestamp)
+			r.skips.encoded(time.Since(data.Time))
+			metrics.encode("video", data.Time)
+			r.broadcastVideo(data, layer)
+			if !data.Input.IsZero() {
+				metrics.input("send", r.stats.sent(data.Input))
 			}
-			einput <- encoder.InFrame{Image: frame.Data, Duration: frame.Duration}
+			r.recordVideo(data)
+			data.Buf.Release()
+			r.drops.check(r.ID, r.rtcSessions)
+			r.adaptBitrate()
 		}
+	}()
+	return func() {
+		pipe.Stop()
+		<-fanout
 	}
-	log.Println("Room ", r.ID, " video channel closed")
 }
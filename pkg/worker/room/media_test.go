@@ -1,15 +1,24 @@
 package room
 
 import (
+	"errors"
 	"image"
 	"math/rand"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/av1"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder/h264"
-	"github.com/giongto35/cloud-game/v2/pkg/encoder/vpx"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/hw"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/opus"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
 )
 
 func TestEncoders(t *testing.T) {
@@ -32,17 +41,270 @@ func TestEncoders(t *testing.T) {
 	}
 }
 
+type keyframeEncoderMock struct {
+	keyframes int32
+}
+
+func (e *keyframeEncoderMock) Encode([]byte) []byte { return []byte{0} }
+func (e *keyframeEncoderMock) Shutdown() error      { return nil }
+func (e *keyframeEncoderMock) ForceKeyframe()       { atomic.AddInt32(&e.keyframes, 1) }
+
+// brokenEncoderMock fails all the frames.
+type brokenEncoderMock struct{}
+
+func (e *brokenEncoderMock) Encode([]byte) []byte { return nil }
+func (e *brokenEncoderMock) Err() error           { return errors.New("broken encoder") }
+func (e *brokenEncoderMock) Reset() error         { return nil }
+func (e *brokenEncoderMock) Shutdown() error      { return nil }
+
+// Tests that the room of the video encoder which keeps failing
+// after its restarts is closed with the error.
+func TestRoomVideoFailure(t *testing.T) {
+	room := newRoom("test_video_failure", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	defer room.Close()
+	room.director = &emulatorMock{closed: make(chan struct{})}
+	frames := make(chan nanoarch.GameFrame)
+	room.imageChannel = frames
+	ended := make(chan struct{})
+	go func() {
+		room.encodeVideo(&brokenEncoderMock{}, 16, 16, testVideoConfig())
+		close(ended)
+	}()
+	defer func() {
+		close(frames)
+		<-ended
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for done := false; !done; {
+		select {
+		case frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 16, 16))}:
+		case <-room.Done:
+			done = true
+		case <-timeout:
+			t.Fatalf("the room of the failed video hasn't been closed")
+		}
+	}
+	if err := room.Err(); err != ErrVideo {
+		t.Errorf("wrong error %v of the room, expected %v", err, ErrVideo)
+	}
+}
+
+// Tests that peers joining a running room
+// get a keyframe, but only one for a burst of joins.
+func TestRoomForceKeyframe(t *testing.T) {
+	room := newRoom("test_keyframe", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	enc := &keyframeEncoderMock{}
+	room.vPipe = encoder.NewVideoPipe(enc, 16, 16)
+	go room.vPipe.Start()
+	defer room.vPipe.Stop()
+
+	stream := func(frames int) {
+		for i := 0; i < frames; i++ {
+			room.vPipe.Input <- encoder.InFrame{Image: image.NewRGBA(image.Rect(0, 0, 16, 16))}
+			select {
+			case <-room.vPipe.Output:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("encoder didn't produce an image")
+			}
+		}
+	}
+
+	stream(10)
+	for i := 0; i < 3; i++ {
+		room.AddConnectionToRoom(&webrtc.WebRTC{ID: strconv.Itoa(i), InputChannel: make(chan []byte, 1)}, "")
+	}
+	stream(10)
+
+	if n := atomic.LoadInt32(&enc.keyframes); n != 1 {
+		t.Errorf("expected exactly 1 keyframe request, got %v", n)
+	}
+}
+
+// Tests that the peers joining the running room
+// without its video codec are rejected.
+func TestRoomJoinCodec(t *testing.T) {
+	room := newRoom("test_join_codec", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	room.videoCodec = codec.H264
+
+	tests := []struct {
+		codecs []codec.VideoCodec
+		err    error
+	}{
+		{codecs: []codec.VideoCodec{codec.VP9, codec.H264}},
+		{codecs: []codec.VideoCodec{codec.VPX}, err: ErrNoCodec},
+		// the peer without the negotiated codecs
+		{},
+	}
+	for i, test := range tests {
+		peer := newSessionMock(strconv.Itoa(i), true)
+		peer.codecs = test.codecs
+		if err := room.AddConnectionToRoom(peer, ""); err != test.err {
+			t.Errorf("wrong join of the peer of %v, %v, expected %v", test.codecs, err, test.err)
+		}
+		if in := room.IsPCInRoom(peer); in != (test.err == nil) {
+			t.Errorf("the peer of %v is in the room: %v", test.codecs, in)
+		}
+	}
+}
+
+type audioEncoderMock struct {
+	bitrate opus.Bitrate
+	// the encoded frame data
+	frame byte
+	// the last encoded samples
+	pcm []int16
+}
+
+func (e *audioEncoderMock) Encode(pcm []int16) ([]byte, error) {
+	e.pcm = pcm
+	return []byte{e.frame}, nil
+}
+func (e *audioEncoderMock) SetBitrate(bitrate opus.Bitrate) error {
+	e.bitrate = bitrate
+	return nil
+}
+
+func TestSetAudioBitrate(t *testing.T) {
+	room := newRoom("test_audio", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	if err := room.SetAudioBitrate(64000); err != errNoAudio {
+		t.Errorf("expected no audio error, got %v", err)
+	}
+
+	enc := &audioEncoderMock{}
+	room.audioEnc = enc
+	tests := []struct {
+		bitrate int
+		want    opus.Bitrate
+	}{
+		{bitrate: 64000, want: 64000},
+		{bitrate: 0, want: encoderConfig.DefaultAudioBitrate},
+		{bitrate: 1, want: encoderConfig.MinAudioBitrate},
+		{bitrate: 10000000, want: encoderConfig.MaxAudioBitrate},
+	}
+	for _, test := range tests {
+		if err := room.SetAudioBitrate(test.bitrate); err != nil {
+			t.Errorf("couldn't set the %v bitrate, %v", test.bitrate, err)
+		}
+		if enc.bitrate != test.want {
+			t.Errorf("wrong encoder bitrate %v for %v, expected %v", enc.bitrate, test.bitrate, test.want)
+		}
+	}
+}
+
+// Tests that the rooms get the software encoder
+// when the hardware one is not available.
+func TestVideoEncoderFallback(t *testing.T) {
+	tests := []struct {
+		backend, device string
+	}{
+		{backend: hw.VAAPI, device: "/dev/dri/renderD-none"},
+		{backend: hw.NVENC, device: "99"},
+		{backend: "quicksync"},
+	}
+	for _, test := range tests {
+		conf := testVideoConfig()
+		conf.Backend, conf.Device = test.backend, test.device
+		enc, err := newVideoEncoder(codec.H264, 64, 48, conf)
+		if err != nil {
+			t.Fatalf("no %v fallback encoder, %v", test.backend, err)
+		}
+		if _, ok := enc.(*h264.H264); !ok {
+			t.Errorf("wrong %v fallback encoder %T", test.backend, enc)
+		}
+		_ = enc.Shutdown()
+	}
+}
+
+// Tests that the x264 settings of the config go into the encoder
+// with the wrong combinations fixed.
+func TestH264EncoderOptions(t *testing.T) {
+	var got h264.Options
+	newEncoder := newH264Encoder
+	newH264Encoder = func(_, _ int, opts h264.Options) (encoder.Encoder, error) {
+		got = opts
+		return &keyframeEncoderMock{}, nil
+	}
+	defer func() { newH264Encoder = newEncoder }()
+
+	tests := []struct {
+		name string
+		conf encoderConfig.H264
+		fps  float64
+		want h264.Options
+	}{
+		{
+			name: "crf",
+			conf: encoderConfig.H264{Crf: 20, Preset: "veryfast", Profile: "main", Tune: "zerolatency", Level: "3.1", LogLevel: 1},
+			want: h264.Options{Crf: 20, Preset: "veryfast", Profile: "main", Tune: "zerolatency", Level: "3.1", LogLevel: 1, Bitrate: 4000},
+		},
+		{
+			name: "cbr",
+			conf: encoderConfig.H264{Preset: "faster", Profile: "high", RateControl: encoderConfig.H264Cbr, Bitrate: 2500,
+				Entropy: encoderConfig.H264Cabac},
+			want: h264.Options{Preset: "faster", Profile: "high", RateControl: encoderConfig.H264Cbr, TargetBitrate: 2500,
+				Entropy: encoderConfig.H264Cabac, Bitrate: 4000},
+		},
+		{
+			name: "baseline cabac",
+			conf: encoderConfig.H264{Profile: encoderConfig.H264Baseline, Entropy: encoderConfig.H264Cabac},
+			want: h264.Options{Profile: encoderConfig.H264Baseline, Entropy: encoderConfig.H264Cavlc, Bitrate: 4000},
+		},
+		{
+			name: "pal",
+			conf: encoderConfig.H264{Crf: 20},
+			fps:  50,
+			want: h264.Options{Crf: 20, Bitrate: 4000, Fps: 50},
+		},
+	}
+	for _, test := range tests {
+		var conf encoderConfig.Video
+		conf.Bitrate.Max = 4000
+		conf.H264 = test.conf
+		conf.Fps = test.fps
+		if _, err := newVideoEncoder(codec.H264, 64, 48, conf); err != nil {
+			t.Fatalf("%v: no encoder, %v", test.name, err)
+		}
+		if got != test.want {
+			t.Errorf("%v: wrong options %+v, expected %+v", test.name, got, test.want)
+		}
+	}
+}
+
 func BenchmarkH264(b *testing.B) { run(1920, 1080, codec.H264, b.N, nil, nil, b) }
 func BenchmarkVP8(b *testing.B)  { run(1920, 1080, codec.VPX, b.N, nil, nil, b) }
 
+// Encode time per frame at 640x480
+func BenchmarkEncode640x480H264(b *testing.B) { run(640, 480, codec.H264, b.N, nil, nil, b) }
+func BenchmarkEncode640x480VP8(b *testing.B)  { run(640, 480, codec.VPX, b.N, nil, nil, b) }
+func BenchmarkEncode640x480VP9(b *testing.B)  { run(640, 480, codec.VP9, b.N, nil, nil, b) }
+func BenchmarkEncode640x480AV1(b *testing.B)  { run(640, 480, codec.AV1, b.N, nil, nil, b) }
+
+// testVideoConfig returns the encoder defaults.
+func testVideoConfig() (conf encoderConfig.Video) {
+	conf.H264.Crf, conf.H264.Tune, conf.H264.Preset, conf.H264.Profile = 12, "zerolatency", "superfast", "baseline"
+	conf.Vpx.Bitrate, conf.Vpx.KeyframeInterval = 1200, 5
+	conf.Vp9.Bitrate, conf.Vp9.KeyframeInterval = 1200, 5
+	conf.Av1.Bitrate, conf.Av1.KeyframeInterval = 1200, 5
+	return
+}
+
 func run(w, h int, cod codec.VideoCodec, count int, a *image.RGBA, b *image.RGBA, backend testing.TB) {
-	var enc encoder.Encoder
-	if cod == codec.H264 {
-		enc, _ = h264.NewEncoder(w, h)
-	} else {
-		enc, _ = vpx.NewEncoder(w, h)
+	enc, err := newVideoEncoder(cod, w, h, testVideoConfig())
+	if err == av1.ErrUnavailable {
+		backend.Skip(err)
 	}
+	if err != nil {
+		backend.Fatalf("couldn't create %v encoder, %v", cod, err)
+	}
+	encodeFrames(enc, w, h, count, a, b, backend)
+}
 
+// encodeFrames encodes the count frames alternating a and b (random if nil).
+func encodeFrames(enc encoder.Encoder, w, h int, count int, a *image.RGBA, b *image.RGBA, backend testing.TB) {
 	pipe := encoder.NewVideoPipe(enc, w, h)
 	go pipe.Start()
 	defer pipe.Stop()
@@ -0,0 +1,183 @@
+package room
+
+import (
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// roomLabelLength is the length of the room IDs in the metric labels,
+// enough to tell the rooms apart.
+const roomLabelLength = 8
+
+// metrics are the Prometheus metrics of the rooms of the worker
+// exposed by its monitoring server.
+var metrics = newRoomMetrics(prometheus.DefaultRegisterer)
+
+type roomMetrics struct {
+	rooms          prometheus.Gauge
+	sessions       prometheus.Gauge
+	encoded        *prometheus.CounterVec
+	encodeDuration *prometheus.HistogramVec
+	dropped        prometheus.Counter
+	skipped        prometheus.Counter
+	inputs         prometheus.Counter
+	inputDropped   *prometheus.CounterVec
+	inputLatency   *prometheus.HistogramVec
+	uploads        *prometheus.CounterVec
+	events         *prometheus.CounterVec
+	stalls         *prometheus.CounterVec
+	// the sessions of each room, the room label is dropped with the room
+	players    *prometheus.GaugeVec
+	spectators *prometheus.GaugeVec
+	egress     *prometheus.GaugeVec
+}
+
+func newRoomMetrics(reg prometheus.Registerer) *roomMetrics {
+	m := &roomMetrics{
+		rooms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "worker", Name: "rooms_active", Help: "The number of the running rooms.",
+		}),
+		sessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "worker", Name: "sessions_connected", Help: "The number of the sessions in the rooms.",
+		}),
+		encoded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "worker", Name: "frames_encoded_total", Help: "The number of the encoded media frames.",
+		}, []string{"media"}),
+		encodeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "worker", Name: "encode_duration_seconds", Help: "The encoding time of the media frames.",
+			Buckets: []float64{.001, .002, .004, .008, .016, .032, .064, .128},
+		}, []string{"media"}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "worker", Name: "frames_dropped_total", Help: "The number of the video frames dropped before encoding.",
+		}),
+		skipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "worker", Name: "frames_skipped_total", Help: "The number of the video frames skipped by the overloaded encoder.",
+		}),
+		inputs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "worker", Name: "input_events_total", Help: "The number of the input events of the players.",
+		}),
+		inputDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "worker", Name: "input_events_dropped_total",
+			Help: "The number of the input messages of the peers over the rate limit or malformed.",
+		}, []string{"reason"}),
+		inputLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "worker", Name: "input_latency_seconds",
+			Help:    "The time from the arrival of the player inputs to their use by the core or the video frame sending.",
+			Buckets: []float64{.001, .002, .004, .008, .016, .032, .064, .128, .256},
+		}, []string{"stage"}),
+		uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "worker", Name: "save_uploads_total", Help: "The number of the game save uploads into the cloud storage.",
+		}, []string{"result"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "worker", Name: "room_events_total", Help: "The number of the events of the rooms.",
+		}, []string{"type"}),
+		stalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "worker", Name: "media_stalls_total",
+			Help: "The number of the media sends of the rooms stalled by their consumers.",
+		}, []string{"boundary", "action"}),
+		players: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "worker", Name: "room_players", Help: "The number of the players of the room.",
+		}, []string{"room"}),
+		spectators: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "worker", Name: "room_spectators", Help: "The number of the spectators of the room.",
+		}, []string{"room"}),
+		egress: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "worker", Name: "room_egress_bytes",
+			Help: "The number of the media bytes sent by the room to all its peers.",
+		}, []string{"room", "media"}),
+	}
+	reg.MustRegister(m.rooms, m.sessions, m.encoded, m.encodeDuration, m.dropped, m.skipped, m.inputs, m.inputDropped, m.inputLatency, m.uploads,
+		m.events, m.stalls, m.players, m.spectators, m.egress)
+	return m
+}
+
+// encode registers the media frame encoded since the start time.
+func (m *roomMetrics) encode(media string, start time.Time) {
+	m.encoded.WithLabelValues(media).Inc()
+	m.encodeDuration.WithLabelValues(media).Observe(time.Since(start).Seconds())
+}
+
+// input registers the latency of the player input at the stage
+// (core -- used by the core, send -- sent with the video).
+func (m *roomMetrics) input(stage string, latency time.Duration) {
+	m.inputLatency.WithLabelValues(stage).Observe(latency.Seconds())
+}
+
+// upload registers the save upload with its error, if any.
+func (m *roomMetrics) upload(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.uploads.WithLabelValues(result).Inc()
+}
+
+// sessionMetrics keeps the sessions of the room reported last time.
+type sessionMetrics struct {
+	mu                  sync.Mutex
+	players, spectators int
+	closed              bool
+}
+
+func roomLabel(id string) string {
+	if len(id) > roomLabelLength {
+		return id[:roomLabelLength]
+	}
+	return id
+}
+
+// updateSessionMetrics reports the sessions of the room
+// after they have changed.
+func (r *Room) updateSessionMetrics() {
+	players, spectators := r.SessionsNum()
+
+	r.sessionMetrics.mu.Lock()
+	defer r.sessionMetrics.mu.Unlock()
+	if r.sessionMetrics.closed {
+		return
+	}
+	r.reportSessions(players, spectators)
+}
+
+// reportEgress updates the egress metrics of the room.
+func (r *Room) reportEgress(e webrtc.Egress) {
+	r.sessionMetrics.mu.Lock()
+	defer r.sessionMetrics.mu.Unlock()
+	if r.sessionMetrics.closed {
+		return
+	}
+	label := roomLabel(r.ID)
+	metrics.egress.WithLabelValues(label, "video").Set(float64(e.Video))
+	metrics.egress.WithLabelValues(label, "audio").Set(float64(e.Audio))
+}
+
+// closeMetrics drops the metrics of the closed room.
+func (r *Room) closeMetrics() {
+	r.sessionMetrics.mu.Lock()
+	defer r.sessionMetrics.mu.Unlock()
+	if r.sessionMetrics.closed {
+		return
+	}
+	r.sessionMetrics.closed = true
+	r.reportSessions(0, 0)
+	label := roomLabel(r.ID)
+	metrics.players.DeleteLabelValues(label)
+	metrics.spectators.DeleteLabelValues(label)
+	metrics.egress.DeleteLabelValues(label, "video")
+	metrics.egress.DeleteLabelValues(label, "audio")
+	metrics.rooms.Dec()
+}
+
+// reportSessions updates the session metrics with the new numbers.
+// Should be called under the session metrics lock.
+func (r *Room) reportSessions(players, spectators int) {
+	s := &r.sessionMetrics
+	metrics.sessions.Add(float64(players + spectators - s.players - s.spectators))
+	s.players, s.spectators = players, spectators
+	label := roomLabel(r.ID)
+	metrics.players.WithLabelValues(label).Set(float64(players))
+	metrics.spectators.WithLabelValues(label).Set(float64(spectators))
+}
@@ -0,0 +1,87 @@
+package room
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRoomMetrics(t *testing.T) {
+	room := getRoomMock(roomMockConfig{
+		gamesPath: whereIsGames,
+		game:      games.GameMetadata{Name: "Super Mario Bros", Type: "nes", Path: "Super Mario Bros.nes"},
+		vCodec:    codec.VPX,
+	})
+	label := roomLabel(room.ID)
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "metrics", InputChannel: make(chan []byte, 1)}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the frames go through the encoder
+	deadline := time.Now().Add(10 * time.Second)
+	for testutil.ToFloat64(metrics.encoded.WithLabelValues("video")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no encoded frames in the metrics")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, name := range []string{
+		"worker_rooms_active",
+		"worker_sessions_connected",
+		"worker_frames_encoded_total",
+		"worker_encode_duration_seconds",
+		"worker_frames_dropped_total",
+		"worker_frames_skipped_total",
+		"worker_input_events_total",
+		"worker_room_players",
+		"worker_room_spectators",
+	} {
+		if n, err := testutil.GatherAndCount(prometheus.DefaultGatherer, name); err != nil || n == 0 {
+			t.Errorf("no %v series in the registry, %v", name, err)
+		}
+	}
+	if rooms := testutil.ToFloat64(metrics.rooms); rooms < 1 {
+		t.Errorf("wrong number of the rooms %v", rooms)
+	}
+	if players := testutil.ToFloat64(metrics.players.WithLabelValues(label)); players != 1 {
+		t.Errorf("wrong number of the room players %v", players)
+	}
+	sessions := testutil.ToFloat64(metrics.sessions)
+	if sessions < 1 {
+		t.Errorf("wrong number of the sessions %v", sessions)
+	}
+
+	room.Close()
+	select {
+	case <-room.Closed():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the room hasn't been closed")
+	}
+	if left := testutil.ToFloat64(metrics.sessions); left != sessions-1 {
+		t.Errorf("the sessions of the closed room are in the metrics, %v -> %v", sessions, left)
+	}
+	if metrics.players.DeleteLabelValues(label) || metrics.spectators.DeleteLabelValues(label) {
+		t.Errorf("the closed room %v is in the metrics", label)
+	}
+}
+
+func TestSaveUploadMetrics(t *testing.T) {
+	m := newRoomMetrics(prometheus.NewRegistry())
+	m.upload(nil)
+	m.upload(nil)
+	m.upload(errors.New("no storage"))
+
+	if ok := testutil.ToFloat64(m.uploads.WithLabelValues("success")); ok != 2 {
+		t.Errorf("wrong number of the uploads %v", ok)
+	}
+	if failed := testutil.ToFloat64(m.uploads.WithLabelValues("failure")); failed != 1 {
+		t.Errorf("wrong number of the failed uploads %v", failed)
+	}
+}
@@ -0,0 +1,196 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/overlay"
+)
+
+var ErrMigrating = errors.New("the room is moving to another server")
+
+// Migration describes the room moving to another worker.
+// The state of the game is in the cloud storage under the room ID,
+// the new room of the same ID pulls it at start.
+type Migration struct {
+	RoomID string
+	Game   games.GameMetadata
+	// the player indices by the session (user) of the peers
+	Players map[string]int
+	// the sessions of the spectators
+	Spectators []string
+	// the password hash of the private room
+	PasswordHash []byte
+	// the room is in the hardcore mode of the achievements
+	Hardcore bool
+}
+
+// roomMigration keeps the handoff of the room to another worker.
+type roomMigration struct {
+	mu sync.Mutex
+	// exporting is set from the export until the handoff
+	exporting bool
+	// moved rooms are closed without the final save,
+	// it would overwrite the state of the new room
+	moved bool
+	// timeout resumes the room without the handoff
+	timeout *time.Timer
+	// seats are the places of the sessions of the imported room,
+	// they join it without the password
+	seats map[string]seat
+}
+
+type seat struct {
+	player    int
+	spectator bool
+}
+
+// ExportState stops the game and uploads its state into the cloud storage
+// for the migration of the room to another worker.
+// The workers should share the cloud storage (see ErrNoCloudStorage).
+// The peers stay connected, but their input is dropped and they get no frames
+// until the handoff or the timeout, after which the game goes on.
+func (r *Room) ExportState(timeout time.Duration) (Migration, error) {
+	r.migration.mu.Lock()
+	defer r.migration.mu.Unlock()
+	if r.migration.exporting || r.migration.moved {
+		return Migration{}, ErrMigrating
+	}
+	if !r.hasCloudStorage() {
+		return Migration{}, ErrNoCloudStorage
+	}
+	if r.director == nil {
+		return Migration{}, ErrNotStarted
+	}
+
+	r.freeze(true)
+	// the new room gets the state from the cloud storage
+	err := r.SaveGame()
+	if err == nil {
+		err = r.uploads.flush(uploadFlushTimeout)
+	}
+	if err != nil {
+		r.freeze(false)
+		return Migration{}, err
+	}
+	r.migration.exporting = true
+	r.migration.timeout = time.AfterFunc(timeout, func() {
+		log.Printf("warn: room %v hasn't moved in %v", r.ID, timeout)
+		r.Handoff(false)
+	})
+
+	m := Migration{RoomID: r.ID, Game: r.game, Players: map[string]int{}}
+	r.rtcSessions.ForEach(func(peer Session) {
+		if peer.IsSpectator() {
+			m.Spectators = append(m.Spectators, peer.GetUser())
+		} else {
+			m.Players[peer.GetUser()] = peer.GetPlayerIndex()
+		}
+	})
+	r.password.mu.RLock()
+	m.PasswordHash = r.password.hash
+	r.password.mu.RUnlock()
+	m.Hardcore = r.IsHardcore()
+	log.Printf("Room %v has been exported with %v players", r.ID, len(m.Players))
+	return m, nil
+}
+
+// Handoff ends the migration of the exported room.
+// The moved room is closed, otherwise the game goes on.
+func (r *Room) Handoff(moved bool) {
+	r.migration.mu.Lock()
+	if !r.migration.exporting {
+		r.migration.mu.Unlock()
+		return
+	}
+	r.migration.exporting = false
+	r.migration.moved = moved
+	r.migration.timeout.Stop()
+	r.migration.mu.Unlock()
+
+	if moved {
+		log.Printf("Room %v has moved to another server", r.ID)
+		r.Close()
+		return
+	}
+	select {
+	case <-r.Done:
+		return
+	default:
+	}
+	r.freeze(false)
+	log.Printf("Room %v stays on the server", r.ID)
+}
+
+// ImportState gives the room the places of the sessions and
+// the password of the migrated room.
+// The sessions keep their players there and don't need the password.
+func (r *Room) ImportState(m Migration) {
+	r.SetPasswordHash(m.PasswordHash)
+	r.SetHardcore(m.Hardcore)
+
+	r.migration.mu.Lock()
+	defer r.migration.mu.Unlock()
+	r.migration.seats = map[string]seat{}
+	for user, player := range m.Players {
+		r.migration.seats[user] = seat{player: player}
+	}
+	for _, user := range m.Spectators {
+		r.migration.seats[user] = seat{spectator: true}
+	}
+}
+
+// takeSeat moves the peer into the place of its session in the imported room,
+// returns false without it.
+func (r *Room) takeSeat(peer Session) bool {
+	if peer.GetUser() == "" {
+		return false
+	}
+	r.migration.mu.Lock()
+	s, ok := r.migration.seats[peer.GetUser()]
+	if ok {
+		delete(r.migration.seats, peer.GetUser())
+	}
+	r.migration.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	peer.SetSpectator(s.spectator)
+	if !peer.IsSpectator() {
+		if err := r.UpdatePlayerIndex(peer, s.player); err != nil {
+			log.Printf("warn: the migrated player %v is not available, %v", s.player, err)
+		}
+	}
+	return true
+}
+
+// isMoved tells if the room has moved to another worker.
+func (r *Room) isMoved() bool {
+	r.migration.mu.Lock()
+	defer r.migration.mu.Unlock()
+	return r.migration.moved
+}
+
+// freeze stops or resumes the game of the room during the migration
+// keeping the pause of the players.
+func (r *Room) freeze(frozen bool) {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	r.status.set(overlay.Migrating, frozen)
+	if frozen {
+		atomic.StoreUint32(&r.frozen, 1)
+		r.director.Pause()
+		return
+	}
+	if !r.paused {
+		r.director.Resume()
+	}
+	atomic.StoreUint32(&r.frozen, 0)
+}
+
+func (r *Room) isFrozen() bool { return atomic.LoadUint32(&r.frozen) == 1 }
@@ -0,0 +1,236 @@
+package room
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/emulatortest"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// cloudMock is a cloud storage shared by the rooms of two workers.
+type cloudMock struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	uploads int
+}
+
+func (s *cloudMock) Save(_ context.Context, key string, r io.Reader, _ int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[key] = data
+	s.uploads++
+	return nil
+}
+
+func (s *cloudMock) Load(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ramEmulatorMock is a core with some RAM saved into and loaded from its state file.
+type ramEmulatorMock struct {
+	*emulatorMock
+	path string
+	ram  []byte
+}
+
+func (e *ramEmulatorMock) SaveGameSlot(int) error { return ioutil.WriteFile(e.path, e.ram, 0644) }
+func (e *ramEmulatorMock) LoadGameSlot(int) (err error) {
+	e.ram, err = ioutil.ReadFile(e.path)
+	return
+}
+func (e *ramEmulatorMock) Snapshot() ([]byte, []byte, error) {
+	return append([]byte(nil), e.ram...), nil, nil
+}
+func (e *ramEmulatorMock) Restore(state []byte, _ []byte) error {
+	e.ram = append([]byte(nil), state...)
+	return ioutil.WriteFile(e.path, e.ram, 0644)
+}
+func (e *ramEmulatorMock) GetHashPath() string    { return e.path }
+func (e *ramEmulatorMock) GetSlotPath(int) string { return e.path }
+
+func newMigrationRoom(id string, cloud *cloudMock, path string) (*Room, *ramEmulatorMock) {
+	room := newRoom(id, make(chan nanoarch.InputEvent, 100), cloud, worker.Config{})
+	emu := &ramEmulatorMock{emulatorMock: &emulatorMock{closed: make(chan struct{})}, path: path}
+	room.director = emu
+	return room, emu
+}
+
+// Tests that the state of the game and the players survive
+// the migration of the room between two workers.
+func TestRoomMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_migration")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cloud := &cloudMock{files: map[string][]byte{}}
+
+	from, fromEmu := newMigrationRoom("test_migration", cloud, filepath.Join(dir, "a", "test_migration.dat"))
+	_ = os.MkdirAll(filepath.Dir(fromEmu.path), 0755)
+	fromEmu.ram = []byte{0x42, 0x13}
+	if err := from.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	player := &webrtc.WebRTC{ID: "1", User: "session", InputChannel: make(chan []byte, 1), PlayerIndex: 1}
+	if err := from.AddConnectionToRoom(player, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := from.ExportState(time.Minute)
+	if err != nil {
+		t.Fatalf("couldn't export the room, %v", err)
+	}
+	if !fromEmu.paused || !from.isFrozen() {
+		t.Errorf("the exported room is running")
+	}
+	if _, err := from.TogglePause(&webrtc.WebRTC{ID: "0"}); err != ErrMigrating {
+		t.Errorf("the exported room has been resumed, %v", err)
+	}
+	if _, err := from.ExportState(time.Minute); err != ErrMigrating {
+		t.Errorf("the room has been exported twice, %v", err)
+	}
+	if index, ok := m.Players["session"]; !ok || index != 1 {
+		t.Errorf("wrong players of the migration %v", m.Players)
+	}
+	uploads := cloud.uploads
+
+	from.Handoff(true)
+	<-from.Closed()
+	if cloud.uploads != uploads {
+		t.Errorf("the moved room has been saved after the export")
+	}
+
+	// the new room of the same ID gets the state from the cloud storage
+	to, toEmu := newMigrationRoom(m.RoomID, cloud, filepath.Join(dir, "b", "test_migration.dat"))
+	defer to.Close()
+	_ = os.MkdirAll(filepath.Dir(toEmu.path), 0755)
+	to.ImportState(m)
+	if err := to.LoadGame(); err != nil {
+		t.Fatalf("couldn't load the migrated game, %v", err)
+	}
+	if string(toEmu.ram) != string([]byte{0x42, 0x13}) {
+		t.Errorf("wrong RAM %v of the migrated game", toEmu.ram)
+	}
+
+	// the session has its player and doesn't need the password
+	moved := &webrtc.WebRTC{ID: "2", User: "session", InputChannel: make(chan []byte, 1)}
+	if err := to.AddConnectionToRoom(moved, ""); err != nil {
+		t.Fatalf("the migrated session couldn't join, %v", err)
+	}
+	if moved.PlayerIndex != 1 {
+		t.Errorf("wrong player %v of the migrated session", moved.PlayerIndex)
+	}
+	stranger := &webrtc.WebRTC{ID: "3", User: "another", InputChannel: make(chan []byte, 1)}
+	if err := to.AddConnectionToRoom(stranger, ""); err != ErrWrongPassword {
+		t.Errorf("the stranger has joined the private room, %v", err)
+	}
+}
+
+// Tests that the room of the game moves with its state
+// to another worker with the same cloud storage.
+func TestRoomMigrationFakeEmulator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_migration")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cloud := &cloudMock{files: map[string][]byte{}}
+	f := &emulatortest.Factory{}
+
+	var conf worker.Config
+	conf.Emulator.Storage = filepath.Join(dir, "a")
+	from := newCloudFakeRoom(t, "test_fake_migration", f, cloud, conf)
+	fake := f.Last()
+	for i := 0; fake.Frames() == 0 && i < 500; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	m, err := from.ExportState(time.Minute)
+	if err != nil {
+		t.Fatalf("couldn't export the room, %v", err)
+	}
+	state, err := cloud.Load(context.Background(), slotKey(from.ID, 0))
+	if err != nil {
+		t.Fatalf("no state of the exported room in the cloud storage, %v", err)
+	}
+	_ = state.Close()
+	exported, err := ioutil.ReadFile(from.director.GetSlotPath(0))
+	if err != nil || len(exported) == 0 {
+		t.Fatalf("no state of the exported room, %v", err)
+	}
+	from.Handoff(true)
+	select {
+	case <-from.Closed():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the moved room hasn't been closed")
+	}
+
+	// the new worker has no local files
+	conf.Emulator.Storage = filepath.Join(dir, "b")
+	to := newCloudFakeRoom(t, m.RoomID, f, cloud, conf)
+	defer closeRoom(t, to)
+	to.ImportState(m)
+	if f.Last() == fake {
+		t.Fatalf("the room has moved with the same emulator")
+	}
+	if data, err := ioutil.ReadFile(to.director.GetSlotPath(0)); err != nil || string(data) != string(exported) {
+		t.Errorf("wrong state %q of the migrated room, expected %q, %v", data, exported, err)
+	}
+	if err := to.LoadGame(); err != nil {
+		t.Errorf("couldn't load the migrated game, %v", err)
+	}
+
+	// the states of the room without the cloud storage stay on the worker
+	local := newFakeRoom(t, "test_fake_migration_local", f, worker.Config{})
+	defer closeRoom(t, local)
+	if _, err := local.ExportState(time.Minute); err != ErrNoCloudStorage {
+		t.Errorf("the room has been exported without the cloud storage, %v", err)
+	}
+}
+
+// Tests that the room goes on without the handoff.
+func TestRoomMigrationTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_migration")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	room, emu := newMigrationRoom("test_migration", &cloudMock{files: map[string][]byte{}}, filepath.Join(dir, "test_migration.dat"))
+	defer room.Close()
+	if _, err := room.ExportState(10 * time.Millisecond); err != nil {
+		t.Fatalf("couldn't export the room, %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for room.isFrozen() {
+		if time.Now().After(deadline) {
+			t.Fatalf("the room hasn't been resumed after the timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if emu.paused {
+		t.Errorf("the emulator hasn't been resumed")
+	}
+	if _, err := room.ExportState(time.Minute); err != nil {
+		t.Errorf("couldn't export the resumed room, %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package room
+
+import (
+	"log"
+
+	emulatorConfig "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+)
+
+// gameConfig returns the emulator (core) name of the game and
+// the worker config with the overrides of the game over it.
+// The game overrides win over the core config and the core one
+// over the global config.
+func gameConfig(game games.GameMetadata, cfg worker.Config) (string, worker.Config) {
+	emuName := cfg.Emulator.GetEmulator(game.Type, game.Path)
+	o := game.Overrides
+	if o == nil {
+		return emuName, cfg
+	}
+
+	if o.Emulator != "" {
+		if _, ok := cfg.Emulator.Libretro.Cores.List[o.Emulator]; ok {
+			emuName = o.Emulator
+		} else {
+			log.Printf("warn: the game %v has unknown core %v in the overrides", game.Name, o.Emulator)
+		}
+	}
+	if o.AspectRatio != nil {
+		ar := &cfg.Emulator.AspectRatio
+		ar.Keep, ar.Width, ar.Height = o.AspectRatio.Keep, o.AspectRatio.Width, o.AspectRatio.Height
+		if o.AspectRatio.ScalingMode != "" {
+			ar.ScalingMode = o.AspectRatio.ScalingMode
+		}
+	}
+	if o.Scale > 0 {
+		cfg.Emulator.Scale = o.Scale
+	}
+	if h := o.H264; h != nil {
+		cfg.Encoder.Video.H264 = cfg.Encoder.Video.H264.Override(encoderConfig.H264{
+			Crf:         h.Crf,
+			Preset:      h.Preset,
+			Profile:     h.Profile,
+			Tune:        h.Tune,
+			Level:       h.Level,
+			RateControl: h.RateControl,
+			Bitrate:     h.Bitrate,
+			Entropy:     h.Entropy,
+		})
+	}
+
+	if o.MaxPlayers == 0 && len(o.CoreOptions) == 0 && len(o.Devices) == 0 && o.Region == "" {
+		return emuName, cfg
+	}
+	// the core list is shared by all the rooms
+	list := make(map[string]emulatorConfig.LibretroCoreConfig, len(cfg.Emulator.Libretro.Cores.List))
+	for name, core := range cfg.Emulator.Libretro.Cores.List {
+		list[name] = core
+	}
+	core := list[emuName]
+	if o.MaxPlayers > 0 {
+		core.Players = o.MaxPlayers
+	}
+	if o.Region != "" {
+		core.Region = o.Region
+	}
+	if len(o.CoreOptions) > 0 {
+		options := make(map[string]string, len(core.CoreOptions)+len(o.CoreOptions))
+		for k, v := range core.CoreOptions {
+			options[k] = v
+		}
+		for k, v := range o.CoreOptions {
+			options[k] = v
+		}
+		core.CoreOptions = options
+	}
+	if len(o.Devices) > 0 {
+		devices := make(map[int]string, len(core.Devices)+len(o.Devices))
+		for k, v := range core.Devices {
+			devices[k] = v
+		}
+		for k, v := range o.Devices {
+			devices[k] = v
+		}
+		core.Devices = devices
+	}
+	list[emuName] = core
+	cfg.Emulator.Libretro.Cores.List = list
+	return emuName, cfg
+}
+
+// the video size of the estimates without the aspect ratio size
+const (
+	estimatedWidth  = 320
+	estimatedHeight = 240
+)
+
+// VideoEstimate returns the core (emulator) name of the game and the size of its video
+// before the start of the game, that is the aspect ratio size of the config
+// with the scale (the native size of the game is known after the start only).
+func VideoEstimate(game games.GameMetadata, cfg worker.Config) (core string, width int, height int) {
+	core, cfg = gameConfig(game, cfg)
+	width, height = cfg.Emulator.AspectRatio.Width, cfg.Emulator.AspectRatio.Height
+	if width <= 0 || height <= 0 {
+		width, height = estimatedWidth, estimatedHeight
+	}
+	if scale := cfg.Emulator.Scale; scale > 1 {
+		width, height = width*scale, height*scale
+	}
+	return
+}
+
+// gameViewport returns the WebRTC output size of the game
+// after its rotation with the scaling mode of the config.
+func gameViewport(meta emulator.Metadata, emu emulatorConfig.Emulator) viewport.Viewport {
+	ar := emu.AspectRatio
+	mode := viewport.Native
+	if ar.Keep {
+		mode = ar.ScalingMode
+	}
+	game := viewport.Game{Width: meta.BaseWidth, Height: meta.BaseHeight, Ratio: meta.Ratio, Rotated: meta.Rotation.IsEven}
+	view, err := viewport.New(mode, game, ar.Width, ar.Height)
+	if err != nil {
+		log.Printf("warn: viewport of %vx%v, %v", ar.Width, ar.Height, err)
+	}
+	view = view.Scale(emu.Scale)
+	log.Printf("Viewport size %dx%d (%v) of %dx%d", view.Width, view.Height, view.Mode,
+		meta.BaseWidth, meta.BaseHeight)
+	return view
+}
@@ -0,0 +1,96 @@
+package room
+
+import (
+	"reflect"
+	"testing"
+
+	emulatorConfig "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+)
+
+func overridesConfig() worker.Config {
+	conf := worker.Config{}
+	conf.Emulator.Scale = 3
+	conf.Emulator.AspectRatio.Width, conf.Emulator.AspectRatio.Height = 640, 480
+	conf.Encoder.Video.H264 = encoderConfig.H264{Crf: 17, Preset: "veryfast", Profile: "main", Tune: "zerolatency"}
+	conf.Emulator.Libretro.Cores.List = map[string]emulatorConfig.LibretroCoreConfig{
+		"nes":  {Lib: "nes.so", Roms: []string{"nes"}, Players: 4, CoreOptions: map[string]string{"fceumm_region": "NTSC", "fceumm_sound": "hq"}},
+		"nes2": {Lib: "nes2.so"},
+	}
+	return conf
+}
+
+func TestGameOverrides(t *testing.T) {
+	lib := games.NewLib(games.Config{BasePath: "../../games/testdata/overrides", Supported: []string{"nes"}})
+	lib.Scan()
+	meta := emulator.Metadata{BaseWidth: 256, BaseHeight: 240}
+
+	tests := []struct {
+		game    string
+		core    string
+		players int
+		options map[string]string
+		devices map[int]string
+		w, h    int
+		h264    encoderConfig.H264
+		region  string
+	}{
+		{
+			game: "Super Mario Bros", core: "nes", players: 1,
+			options: map[string]string{"fceumm_region": "PAL", "fceumm_sound": "hq", "fceumm_palette": "raw"},
+			w:       256, h: 240,
+			h264: encoderConfig.H264{Crf: 17, Preset: "veryfast", Profile: "main", Tune: "zerolatency"},
+		},
+		// 256x240 fit into 320x200, 200 * 256 / 240 = 213.3
+		{
+			game: "Contra", core: "nes2", devices: map[int]string{1: "Zapper"}, w: 214 * 3, h: 200 * 3,
+			h264:   encoderConfig.H264{Crf: 17, Preset: "faster", Profile: "high", Tune: "zerolatency"},
+			region: "pal",
+		},
+		{
+			game: "Tetris", core: "nes", players: 4,
+			options: map[string]string{"fceumm_region": "NTSC", "fceumm_sound": "hq"},
+			w:       256 * 3, h: 240 * 3,
+			h264: encoderConfig.H264{Crf: 17, Preset: "veryfast", Profile: "main", Tune: "zerolatency"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.game, func(t *testing.T) {
+			conf := overridesConfig()
+			game := lib.FindGameByName(test.game)
+			if game.Path == "" {
+				t.Fatalf("no game %v", test.game)
+			}
+			core, cfg := gameConfig(game, conf)
+			if core != test.core {
+				t.Errorf("wrong core %v, expected %v", core, test.core)
+			}
+			coreConf := cfg.Emulator.GetLibretroCoreConfig(core)
+			if coreConf.Players != test.players {
+				t.Errorf("wrong players %v, expected %v", coreConf.Players, test.players)
+			}
+			if !reflect.DeepEqual(coreConf.CoreOptions, test.options) {
+				t.Errorf("wrong core options %v, expected %v", coreConf.CoreOptions, test.options)
+			}
+			if coreConf.Region != test.region {
+				t.Errorf("wrong region %v, expected %v", coreConf.Region, test.region)
+			}
+			if !reflect.DeepEqual(coreConf.Devices, test.devices) {
+				t.Errorf("wrong devices %v, expected %v", coreConf.Devices, test.devices)
+			}
+			if v := gameViewport(meta, cfg.Emulator); v.Width != test.w || v.Height != test.h {
+				t.Errorf("wrong viewport %vx%v, expected %vx%v", v.Width, v.Height, test.w, test.h)
+			}
+			if cfg.Encoder.Video.H264 != test.h264 {
+				t.Errorf("wrong h264 settings %+v, expected %+v", cfg.Encoder.Video.H264, test.h264)
+			}
+			// the global config stays the same
+			if !reflect.DeepEqual(conf, overridesConfig()) {
+				t.Errorf("the worker config has been changed")
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+)
+
+var (
+	ErrNotRoomOwner = errors.New("only the room owner can do that")
+	ErrNoSession    = errors.New("no such session in the room")
+	ErrBanned       = errors.New("the session is banned from the room")
+)
+
+// roomOwner keeps the owner of the room (the creating session)
+// and the sessions banned by the owner for the room lifetime.
+type roomOwner struct {
+	mu sync.Mutex
+	// the ID of the owner peer
+	id string
+	// the banned peer IDs and users
+	banned map[string]struct{}
+}
+
+// Owner returns the ID of the owner peer of the room,
+// empty when the room has no peers.
+func (r *Room) Owner() string {
+	r.owner.mu.Lock()
+	defer r.owner.mu.Unlock()
+	return r.owner.id
+}
+
+// OwnerSession returns the owner peer of the room, nil without it.
+func (r *Room) OwnerSession() Session { return r.findSession(r.Owner()) }
+
+// IsOwner tells if the peer is the owner of the room.
+func (r *Room) IsOwner(peerconnection Session) bool {
+	return peerconnection != nil && peerconnection.GetId() == r.Owner()
+}
+
+// KickSession removes the peer with the ID (or the user) from the room
+// and closes its connection.
+func (r *Room) KickSession(id string) error {
+	peer := r.findSession(id)
+	if peer == nil {
+		return ErrNoSession
+	}
+	r.kickFor(peer, api.KickedOwner)
+	return nil
+}
+
+// BanSession kicks the peer with the ID (or the user) from the room
+// and doesn't let it in again.
+func (r *Room) BanSession(id string) error {
+	peer := r.findSession(id)
+
+	r.owner.mu.Lock()
+	if r.owner.banned == nil {
+		r.owner.banned = map[string]struct{}{}
+	}
+	r.owner.banned[id] = struct{}{}
+	if peer != nil {
+		r.owner.banned[peer.GetId()] = struct{}{}
+		if peer.GetUser() != "" {
+			r.owner.banned[peer.GetUser()] = struct{}{}
+		}
+	}
+	r.owner.mu.Unlock()
+
+	if peer == nil {
+		return nil
+	}
+	r.kickFor(peer, api.KickedBanned)
+	return nil
+}
+
+// isBanned tells if the peer or its user is banned from the room.
+func (r *Room) isBanned(peerconnection Session) bool {
+	r.owner.mu.Lock()
+	defer r.owner.mu.Unlock()
+	if _, ok := r.owner.banned[peerconnection.GetId()]; ok {
+		return true
+	}
+	_, ok := r.owner.banned[peerconnection.GetUser()]
+	return ok && peerconnection.GetUser() != ""
+}
+
+// findSession returns the peer of the room with the ID or the user.
+func (r *Room) findSession(id string) Session {
+	if id == "" {
+		return nil
+	}
+	for _, s := range r.rtcSessions.snapshot() {
+		if s.GetId() == id || s.GetUser() == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// claimOwner makes the peer the owner of the room without one.
+func (r *Room) claimOwner(peerconnection Session) {
+	r.owner.mu.Lock()
+	defer r.owner.mu.Unlock()
+	if r.owner.id == "" {
+		r.owner.id = peerconnection.GetId()
+	}
+}
+
+// transferOwner gives the room of the leaving owner to the next oldest player
+// or, without players, to the oldest spectator.
+func (r *Room) transferOwner(peerconnection Session) {
+	r.owner.mu.Lock()
+	defer r.owner.mu.Unlock()
+	if r.owner.id != peerconnection.GetId() {
+		return
+	}
+	r.owner.id = ""
+	for _, s := range r.rtcSessions.snapshot() {
+		if !s.IsSpectator() {
+			r.owner.id = s.GetId()
+			break
+		}
+		if r.owner.id == "" {
+			r.owner.id = s.GetId()
+		}
+	}
+	if r.owner.id != "" {
+		log.Printf("Room %v owner is %v now", r.ID, r.owner.id)
+	}
+}
@@ -0,0 +1,158 @@
+package room
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestRoomOwnerTransfer(t *testing.T) {
+	room, _ := newPlayersRoom(0)
+	defer room.Close()
+	spectator := &webrtc.WebRTC{ID: "s", Spectator: true}
+	owner := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+	player := &webrtc.WebRTC{ID: "2", InputChannel: make(chan []byte, 1)}
+	for _, peer := range []*webrtc.WebRTC{owner, spectator, player} {
+		_ = room.AddConnectionToRoom(peer, "")
+	}
+
+	if !room.IsOwner(owner) || room.IsOwner(player) {
+		t.Fatalf("the first peer should own the room, not %v", room.Owner())
+	}
+	// the next oldest player rather than the older spectator
+	room.RemoveSession(owner)
+	if !room.IsOwner(player) {
+		t.Errorf("the next player should own the room, not %v", room.Owner())
+	}
+	room.RemoveSession(player)
+	if !room.IsOwner(spectator) {
+		t.Errorf("the spectator should own the room without players, not %v", room.Owner())
+	}
+	room.RemoveSession(spectator)
+	if room.Owner() != "" {
+		t.Errorf("the empty room has the owner %v", room.Owner())
+	}
+	_ = room.AddConnectionToRoom(player, "")
+	if !room.IsOwner(player) {
+		t.Errorf("the new peer should own the empty room, not %v", room.Owner())
+	}
+}
+
+// Tests that the kicks of the peers during streaming
+// don't break the media fan-out.
+func TestKickSessionWhileStreaming(t *testing.T) {
+	room, peers := newPlayersRoom(10)
+	defer room.Close()
+	room.audioEnc = &audioEncoderMock{}
+
+	done := make(chan struct{})
+	streaming := make(chan struct{})
+	go func() {
+		defer close(streaming)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				room.broadcastVideo(encoder.OutFrame{Data: []byte{1}}, layerHigh)
+				room.encodeAudio(media.Samples{1}, 0)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, peer := range peers[1:] {
+		wg.Add(1)
+		go func(peer *webrtc.WebRTC) {
+			defer wg.Done()
+			if err := room.KickSession(peer.ID); err != nil {
+				t.Errorf("couldn't kick %v, %v", peer.ID, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+	close(done)
+	<-streaming
+
+	if n := room.rtcSessions.Len(); n != 1 || !room.IsOwner(peers[0]) {
+		t.Errorf("the room has %v sessions with the owner %v after the kicks", n, room.Owner())
+	}
+	if err := room.KickSession("1"); err != ErrNoSession {
+		t.Errorf("expected no session error, got %v", err)
+	}
+	if err := room.AddConnectionToRoom(peers[1], ""); err != nil {
+		t.Errorf("the kicked peer should be able to reconnect, %v", err)
+	}
+}
+
+func TestBanSession(t *testing.T) {
+	room, peers := newPlayersRoom(2)
+	defer room.Close()
+	peers[1].User = "browser"
+
+	if err := room.BanSession("browser"); err != nil {
+		t.Fatalf("couldn't ban the session, %v", err)
+	}
+	if room.IsPCInRoom(peers[1]) {
+		t.Fatalf("the banned peer is still in the room")
+	}
+
+	// the same peer or the new connections of the user
+	for i, peer := range []*webrtc.WebRTC{
+		peers[1],
+		{ID: "new", User: "browser", InputChannel: make(chan []byte, 1)},
+		{ID: "1", InputChannel: make(chan []byte, 1)},
+	} {
+		for attempt := 0; attempt < 3; attempt++ {
+			if err := room.AddConnectionToRoom(peer, ""); err != ErrBanned {
+				t.Errorf("the banned peer %v has joined the room, %v", i, err)
+			}
+		}
+		if room.IsPCInRoom(peer) {
+			t.Errorf("the banned peer %v is in the room", i)
+		}
+	}
+
+	// the peers are told why they are disconnected
+	kicked, banned := newSessionMock("kicked", false), newSessionMock("banned", true)
+	for _, p := range []*sessionMock{kicked, banned} {
+		if err := room.AddConnectionToRoom(p, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = room.KickSession(kicked.id)
+	_ = room.BanSession(banned.id)
+	for reason, p := range map[string]*sessionMock{api.KickedOwner: kicked, api.KickedBanned: banned} {
+		var reply struct {
+			Cmd  string          `json:"cmd"`
+			Data api.KickedEvent `json:"data"`
+		}
+		p.mu.Lock()
+		controls := p.controls
+		p.mu.Unlock()
+		if len(controls) == 0 || json.Unmarshal(controls[len(controls)-1], &reply) != nil ||
+			reply.Cmd != api.ControlKicked || reply.Data.Reason != reason {
+			t.Errorf("the peer %v hasn't been told about the kick, %q", p.id, controls)
+		}
+		if p.IsConnected() {
+			t.Errorf("the kicked peer %v is still connected", p.id)
+		}
+	}
+
+	// bans of the sessions not in the room
+	if err := room.BanSession("later"); err != nil {
+		t.Errorf("couldn't ban the session, %v", err)
+	}
+	later := &webrtc.WebRTC{ID: "42", User: "later", InputChannel: make(chan []byte, 1)}
+	if err := room.AddConnectionToRoom(later, ""); err != ErrBanned {
+		t.Errorf("the banned user has joined the room, %v", err)
+	}
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "ok", InputChannel: make(chan []byte, 1)}, ""); err != nil {
+		t.Errorf("the other peers should join the room, %v", err)
+	}
+}
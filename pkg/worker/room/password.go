@@ -0,0 +1,68 @@
+package room
+
+import (
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrWrongPassword = errors.New("wrong password")
+
+// roomPassword keeps the bcrypt hash of the passphrase of the private room,
+// the rooms without it are public.
+type roomPassword struct {
+	mu   sync.RWMutex
+	hash []byte
+}
+
+// HashPassword returns the hash of the passphrase of the room,
+// the empty passphrase has the empty hash.
+func HashPassword(password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// SetPassword changes the passphrase of the room,
+// the empty one makes the room public.
+// The peers already in the room stay there.
+func (r *Room) SetPassword(password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	r.SetPasswordHash(hash)
+	return nil
+}
+
+// SetPasswordHash changes the passphrase of the room to the one of the hash (see HashPassword),
+// the empty hash makes the room public.
+func (r *Room) SetPasswordHash(hash []byte) {
+	r.password.mu.Lock()
+	r.password.hash = hash
+	r.password.mu.Unlock()
+}
+
+// IsPrivate tells if the room has a passphrase.
+func (r *Room) IsPrivate() bool {
+	r.password.mu.RLock()
+	defer r.password.mu.RUnlock()
+	return len(r.password.hash) > 0
+}
+
+// VerifyPassword checks the passphrase of the private room,
+// any passphrase is fine for the public rooms.
+func (r *Room) VerifyPassword(password string) error {
+	r.password.mu.RLock()
+	hash := r.password.hash
+	r.password.mu.RUnlock()
+	if len(hash) == 0 {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
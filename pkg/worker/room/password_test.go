@@ -0,0 +1,72 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestPrivateRoom(t *testing.T) {
+	room, _ := newPlayersRoom(0)
+	defer room.Close()
+	if err := room.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if !room.IsPrivate() {
+		t.Fatalf("the room with the password isn't private")
+	}
+
+	peer := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+	for _, password := range []string{"", "Secret", "secret "} {
+		if err := room.AddConnectionToRoom(peer, password); err != ErrWrongPassword {
+			t.Errorf("the wrong password %q has been accepted, %v", password, err)
+		}
+	}
+	if room.IsPCInRoom(peer) {
+		t.Fatalf("the peer with the wrong password is in the room")
+	}
+
+	if err := room.AddConnectionToRoom(peer, "secret"); err != nil {
+		t.Fatalf("the right password hasn't been accepted, %v", err)
+	}
+	if !room.IsPCInRoom(peer) {
+		t.Errorf("the peer with the right password isn't in the room")
+	}
+}
+
+// Tests that the new password is required only for the new peers.
+func TestRoomPasswordRotation(t *testing.T) {
+	room, _ := newPlayersRoom(0)
+	defer room.Close()
+	if err := room.SetPassword("old"); err != nil {
+		t.Fatal(err)
+	}
+	owner := &webrtc.WebRTC{ID: "owner", InputChannel: make(chan []byte, 1)}
+	if err := room.AddConnectionToRoom(owner, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := room.SetPassword("new"); err != nil {
+		t.Fatal(err)
+	}
+	if !room.IsPCInRoom(owner) || !room.IsOwner(owner) {
+		t.Errorf("the peer has lost the room after the password change")
+	}
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "2"}, "old"); err != ErrWrongPassword {
+		t.Errorf("the old password has been accepted, %v", err)
+	}
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "3", InputChannel: make(chan []byte, 1)}, "new"); err != nil {
+		t.Errorf("the new password hasn't been accepted, %v", err)
+	}
+
+	// back to public
+	if err := room.SetPassword(""); err != nil {
+		t.Fatal(err)
+	}
+	if room.IsPrivate() {
+		t.Errorf("the room without the password is private")
+	}
+	if err := room.AddConnectionToRoom(&webrtc.WebRTC{ID: "4", InputChannel: make(chan []byte, 1)}, "whatever"); err != nil {
+		t.Errorf("the public room has rejected the peer, %v", err)
+	}
+}
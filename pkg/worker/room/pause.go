@@ -0,0 +1,57 @@
+package room
+
+import (
+	"errors"
+	"log"
+
+	"github.com/giongto35/cloud-game/v2/pkg/worker/overlay"
+)
+
+var ErrNotOwner = errors.New("only the first player can pause the game")
+
+// TogglePause pauses or resumes the game of the room,
+// returns the new pause state.
+// Only the peer of the first player is allowed to do that.
+// Paused rooms don't close when idle.
+func (r *Room) TogglePause(peer Session) (bool, error) {
+	if peer.IsSpectator() {
+		return r.IsPaused(), ErrSpectator
+	}
+	if peer.GetPlayerIndex() != 0 {
+		return r.IsPaused(), ErrNotOwner
+	}
+
+	r.pauseLock.Lock()
+	if r.isFrozen() {
+		r.pauseLock.Unlock()
+		return r.paused, ErrMigrating
+	}
+	r.paused = !r.paused
+	paused := r.paused
+	if paused {
+		r.director.Pause()
+	} else {
+		r.director.Resume()
+	}
+	r.status.set(overlay.Paused, paused)
+	r.pauseLock.Unlock()
+
+	if paused {
+		r.checkIdle()
+		r.event(Event{Type: EventPaused, Session: peer.GetId()})
+		log.Printf("Room %v is paused", r.ID)
+	} else {
+		r.idle.cancel()
+		r.checkIdle()
+		r.event(Event{Type: EventResumed, Session: peer.GetId()})
+		log.Printf("Room %v is resumed", r.ID)
+	}
+	return paused, nil
+}
+
+// IsPaused tells if the game of the room is paused.
+func (r *Room) IsPaused() bool {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	return r.paused
+}
@@ -0,0 +1,81 @@
+package room
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestTogglePause(t *testing.T) {
+	room, clock, emu := newIdleRoom(5 * time.Minute)
+	defer room.Close()
+	owner := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+	guest := &webrtc.WebRTC{ID: "2", InputChannel: make(chan []byte, 1), PlayerIndex: 1}
+	room.AddConnectionToRoom(owner, "")
+	room.AddConnectionToRoom(guest, "")
+
+	if _, err := room.TogglePause(guest); err != ErrNotOwner {
+		t.Errorf("expected not owner error, got %v", err)
+	}
+	if emu.paused || room.IsPaused() {
+		t.Fatalf("the room was paused by the guest")
+	}
+
+	paused, err := room.TogglePause(owner)
+	if err != nil || !paused || !emu.paused || !room.IsPaused() {
+		t.Fatalf("the room wasn't paused, %v", err)
+	}
+
+	// the pause time counts as idle, even with the peers
+	clock.Advance(4 * time.Minute)
+	room.AddConnectionToRoom(newSessionMock("3", true), "")
+	paused, err = room.TogglePause(owner)
+	if err != nil || paused || emu.paused || room.IsPaused() {
+		t.Fatalf("the room wasn't resumed, %v", err)
+	}
+	clock.Advance(time.Hour)
+	if isClosed(room) {
+		t.Fatalf("the resumed room with the peers was closed")
+	}
+
+	if _, err := room.TogglePause(owner); err != nil {
+		t.Fatalf("the room wasn't paused again, %v", err)
+	}
+	clock.Advance(5*time.Minute - time.Second)
+	if isClosed(room) {
+		t.Fatalf("the paused room was closed before the timeout")
+	}
+	room.AddConnectionToRoom(newSessionMock("4", true), "")
+	clock.Advance(time.Second)
+	if !isClosed(room) {
+		t.Errorf("the paused room wasn't closed after the idle timeout")
+	}
+}
+
+func TestPausedScreenshot(t *testing.T) {
+	room, _, _ := newIdleRoom(0)
+	defer room.Close()
+	owner := &webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}
+
+	frame := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	room.screenshots.tee(frame, nil)
+	if _, err := room.TogglePause(owner); err != nil {
+		t.Fatal(err)
+	}
+	// no new frames while paused
+	data, err := room.Screenshot(10 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("no screenshot of the paused room, %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("bad PNG, %v", err)
+	}
+	if img.Bounds() != frame.Bounds() {
+		t.Errorf("wrong screenshot size %v", img.Bounds())
+	}
+}
@@ -0,0 +1,101 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"sync"
+)
+
+// maxPlayers is the number of the emulator controllers (ports).
+const maxPlayers = 4
+
+var (
+	ErrPlayerIndex  = errors.New("wrong player index")
+	ErrPlayerTaken  = errors.New("the player is taken by another peer")
+	ErrNoFreePlayer = errors.New("no free players")
+)
+
+// playerSlots keeps the peers (their session IDs) of each player index
+// so only one peer controls each player.
+type playerSlots struct {
+	mu    sync.Mutex
+	slots map[int]string
+}
+
+// UpdatePlayerIndex gives the player with the index to the peer.
+// It fails with ErrPlayerTaken when some other peer of the room has that player.
+func (r *Room) UpdatePlayerIndex(peerconnection Session, playerIndex int) error {
+	if peerconnection.IsSpectator() {
+		return ErrSpectator
+	}
+	if playerIndex < 0 || playerIndex >= maxPlayers {
+		return ErrPlayerIndex
+	}
+
+	r.players.mu.Lock()
+	defer r.players.mu.Unlock()
+	if r.isPlayerTaken(playerIndex, peerconnection) {
+		return ErrPlayerTaken
+	}
+	r.takePlayer(playerIndex, peerconnection)
+	log.Println("Updated player Index to: ", playerIndex)
+	return nil
+}
+
+// ClaimFreePlayerIndex gives the lowest free player index to the peer
+// (i.e. for a new peer of the room) and returns that index.
+func (r *Room) ClaimFreePlayerIndex(peerconnection Session) (int, error) {
+	if peerconnection.IsSpectator() {
+		return 0, ErrSpectator
+	}
+
+	r.players.mu.Lock()
+	defer r.players.mu.Unlock()
+	for i := 0; i < maxPlayers; i++ {
+		if !r.isPlayerTaken(i, peerconnection) {
+			r.takePlayer(i, peerconnection)
+			return i, nil
+		}
+	}
+	return 0, ErrNoFreePlayer
+}
+
+// isPlayerTaken tells if the player index belongs to another peer of the room.
+// The players of the peers that have left the room are free.
+// Should be called under the players lock.
+func (r *Room) isPlayerTaken(playerIndex int, peerconnection Session) bool {
+	id, ok := r.players.slots[playerIndex]
+	if !ok || id == peerconnection.GetId() {
+		return false
+	}
+	for _, s := range r.rtcSessions.snapshot() {
+		if s.GetId() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// takePlayer moves the peer into the player slot.
+// Should be called under the players lock.
+func (r *Room) takePlayer(playerIndex int, peerconnection Session) {
+	if r.players.slots == nil {
+		r.players.slots = map[int]string{}
+	}
+	for i, id := range r.players.slots {
+		if id == peerconnection.GetId() {
+			delete(r.players.slots, i)
+		}
+	}
+	r.players.slots[playerIndex] = peerconnection.GetId()
+	peerconnection.SetPlayerIndex(playerIndex)
+}
+
+// freePlayer frees the player slot of the peer.
+func (r *Room) freePlayer(peerconnection Session) {
+	r.players.mu.Lock()
+	defer r.players.mu.Unlock()
+	if id, ok := r.players.slots[peerconnection.GetPlayerIndex()]; ok && id == peerconnection.GetId() {
+		delete(r.players.slots, peerconnection.GetPlayerIndex())
+	}
+}
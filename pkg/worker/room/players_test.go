@@ -0,0 +1,128 @@
+package room
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func newPlayersRoom(peers int) (*Room, []*webrtc.WebRTC) {
+	room := newRoom("test_players", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	// more peers than players for the concurrency tests
+	if peers > room.limits.players {
+		room.limits.players = peers
+	}
+	var list []*webrtc.WebRTC
+	for i := 0; i < peers; i++ {
+		peer := &webrtc.WebRTC{ID: strconv.Itoa(i), InputChannel: make(chan []byte, 1)}
+		room.AddConnectionToRoom(peer, "")
+		list = append(list, peer)
+	}
+	return room, list
+}
+
+func TestConcurrentPlayerClaims(t *testing.T) {
+	room, peers := newPlayersRoom(2 * maxPlayers)
+	defer room.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed, failed := map[int]string{}, 0
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer *webrtc.WebRTC) {
+			defer wg.Done()
+			idx, err := room.ClaimFreePlayerIndex(peer)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				return
+			}
+			if other, ok := claimed[idx]; ok {
+				t.Errorf("player %v is claimed by %v and %v", idx, other, peer.ID)
+			}
+			claimed[idx] = peer.ID
+		}(peer)
+	}
+	wg.Wait()
+
+	if len(claimed) != maxPlayers || failed != maxPlayers {
+		t.Errorf("expected %v claimed players, got %v (%v failed)", maxPlayers, len(claimed), failed)
+	}
+	for i := 0; i < maxPlayers; i++ {
+		if _, ok := claimed[i]; !ok {
+			t.Errorf("player %v is not claimed", i)
+		}
+	}
+}
+
+func TestConcurrentPlayerUpdates(t *testing.T) {
+	room, peers := newPlayersRoom(10)
+	defer room.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var winners []string
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer *webrtc.WebRTC) {
+			defer wg.Done()
+			err := room.UpdatePlayerIndex(peer, 1)
+			if err != nil && err != ErrPlayerTaken {
+				t.Errorf("unexpected error %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				winners = append(winners, peer.ID)
+				mu.Unlock()
+			}
+		}(peer)
+	}
+	wg.Wait()
+	if len(winners) != 1 {
+		t.Errorf("player 1 is taken by %v peers", winners)
+	}
+}
+
+func TestPlayerRecycling(t *testing.T) {
+	room, peers := newPlayersRoom(3)
+	defer room.Close()
+	a, b, c := peers[0], peers[1], peers[2]
+
+	if err := room.UpdatePlayerIndex(a, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UpdatePlayerIndex(b, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UpdatePlayerIndex(c, 0); err != ErrPlayerTaken {
+		t.Errorf("expected taken player error, got %v", err)
+	}
+	if idx, err := room.ClaimFreePlayerIndex(c); err != nil || idx != 2 {
+		t.Errorf("wrong free player %v, %v", idx, err)
+	}
+	if err := room.UpdatePlayerIndex(a, 5); err != ErrPlayerIndex {
+		t.Errorf("expected wrong player error, got %v", err)
+	}
+
+	// the player is free after disconnect
+	room.RemoveSession(a)
+	newcomer := &webrtc.WebRTC{ID: "new", InputChannel: make(chan []byte, 1)}
+	room.AddConnectionToRoom(newcomer, "")
+	if idx, err := room.ClaimFreePlayerIndex(newcomer); err != nil || idx != 0 {
+		t.Errorf("player 0 is not recycled, got %v, %v", idx, err)
+	}
+
+	// switching frees the previous player
+	if err := room.UpdatePlayerIndex(b, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UpdatePlayerIndex(c, 1); err != nil {
+		t.Errorf("the previous player of the peer is not free, %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package room
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+const (
+	// profileSaveDelay coalesces the quick changes of the profiles (i.e. the volume)
+	// into one save
+	profileSaveDelay = 2 * time.Second
+	// profileTimeout is how long the reads and writes of the profiles
+	// in the cloud storage may take
+	profileTimeout = 10 * time.Second
+)
+
+// Profile is the preferences of the user (the signed user ID of the peers)
+// kept in the cloud storage, the peers of the user get them in any room.
+type Profile struct {
+	KeyMapping webrtc.KeyMapping `json:"key_mapping,omitempty"`
+	// the audio volume, nil -- the full one
+	Volume *int `json:"volume,omitempty"`
+}
+
+// userKey returns the prefix of the cloud storage keys of the user,
+// the opaque user IDs are hashed to be safe in the keys.
+func userKey(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return "user-" + hex.EncodeToString(sum[:16])
+}
+
+// profileKey returns the cloud storage key of the profile of the user.
+func profileKey(user string) string { return userKey(user) + ".profile" }
+
+// userSlotKey returns the cloud storage key of the save slot of the game of the user,
+// it's shared by all the rooms of the game the user owns.
+func userSlotKey(user string, game string, slot int) string {
+	return slotKey(userKey(user)+"."+game, slot)
+}
+
+// profileSaves is the debounce of the saves of the profiles by their users.
+type profileSaves struct {
+	mu      sync.Mutex
+	pending map[string][]byte
+	delay   time.Duration
+	// the scheduled and running saves
+	wg sync.WaitGroup
+}
+
+// restoreProfile gives the peer the key mapping and volume of its user
+// in the background, the anonymous peers and the new users keep theirs.
+func (r *Room) restoreProfile(peerconnection Session) {
+	user := peerconnection.GetProfile()
+	if user == "" || r.onlineStorage == nil {
+		return
+	}
+	go r.loadProfile(peerconnection, user)
+}
+
+func (r *Room) loadProfile(peerconnection Session, user string) {
+	ctx, cancel := context.WithTimeout(r.ctx, profileTimeout)
+	defer cancel()
+	data, err := r.states.LoadData(ctx, r.onlineStorage, profileKey(user))
+	if err != nil || len(data) == 0 {
+		return
+	}
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		log.Printf("warn: room %v couldn't read the profile of the session %v, %v", r.ID, peerconnection.GetId(), err)
+		return
+	}
+	if profile.KeyMapping != nil {
+		peerconnection.SetKeyMapping(profile.KeyMapping)
+	}
+	if profile.Volume != nil {
+		peerconnection.SetVolume(*profile.Volume)
+	}
+}
+
+// SaveProfile keeps the key mapping and volume of the peer for its user,
+// the anonymous peers are skipped. The profile is saved in the background
+// after the save delay with its last changes.
+func (r *Room) SaveProfile(peerconnection Session) error {
+	user := peerconnection.GetProfile()
+	if user == "" || r.onlineStorage == nil {
+		return nil
+	}
+	volume := peerconnection.Volume()
+	data, err := json.Marshal(Profile{KeyMapping: peerconnection.GetKeyMapping(), Volume: &volume})
+	if err != nil {
+		return err
+	}
+	r.profiles.mu.Lock()
+	defer r.profiles.mu.Unlock()
+	if _, ok := r.profiles.pending[user]; !ok {
+		r.profiles.wg.Add(1)
+		time.AfterFunc(r.profiles.delay, func() { r.writeProfile(user) })
+	}
+	r.profiles.pending[user] = data
+	return nil
+}
+
+// writeProfile saves the pending profile of the user.
+func (r *Room) writeProfile(user string) {
+	defer r.profiles.wg.Done()
+	r.profiles.mu.Lock()
+	data := r.profiles.pending[user]
+	delete(r.profiles.pending, user)
+	r.profiles.mu.Unlock()
+
+	// the profile outlives the room
+	ctx, cancel := context.WithTimeout(context.Background(), profileTimeout)
+	defer cancel()
+	if err := r.states.SaveData(ctx, r.onlineStorage, profileKey(user), data); err != nil {
+		log.Printf("warn: room %v couldn't save the profile, %v", r.ID, err)
+	}
+}
+
+// ownerProfile returns the user of the owner of the room, empty -- anonymous,
+// the user owns the saves of the room.
+func (r *Room) ownerProfile() string {
+	if owner := r.OwnerSession(); owner != nil {
+		return owner.GetProfile()
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestUserSlotKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{name: "the user save is apart from the room one",
+			a: userSlotKey("alice", "Sushi", 0), b: slotKey("room1___Sushi", 0)},
+		{name: "the users have their own saves",
+			a: userSlotKey("alice", "Sushi", 1), b: userSlotKey("bob", "Sushi", 1)},
+		{name: "the games have their own saves",
+			a: userSlotKey("alice", "Sushi", 1), b: userSlotKey("alice", "Mario", 1)},
+		{name: "the slots have their own saves",
+			a: userSlotKey("alice", "Sushi", 0), b: userSlotKey("alice", "Sushi", 1)},
+		{name: "the profile is apart from the saves",
+			a: profileKey("alice"), b: userSlotKey("alice", "profile", 0)},
+		{name: "the same save", a: userSlotKey("alice", "Sushi", 2), b: userSlotKey("alice", "Sushi", 2), same: true},
+	}
+	for _, test := range tests {
+		if same := test.a == test.b; same != test.same {
+			t.Errorf("%v: the keys %v and %v", test.name, test.a, test.b)
+		}
+	}
+	if key := userSlotKey("../alice@example.com", "Sushi", 0); strings.Contains(key, "alice") {
+		t.Errorf("the key %v has the user ID", key)
+	}
+}
+
+// newProfileRoom returns the room of the game with the state file in the dir.
+func newProfileRoom(id string, cloud *cloudMock, dir string) (*Room, *ramEmulatorMock) {
+	room := newRoom(id, make(chan nanoarch.InputEvent, 100), cloud, worker.Config{})
+	room.game = games.GameMetadata{Name: "Sushi"}
+	emu := &ramEmulatorMock{emulatorMock: &emulatorMock{closed: make(chan struct{})}, path: filepath.Join(dir, id+".dat")}
+	room.director = emu
+	return room, emu
+}
+
+// Tests that the saves of the rooms of the users go under their keys as well,
+// so the user gets them in another room of the game and the other users don't.
+func TestProfileSaves(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_profile")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cloud := &cloudMock{files: map[string][]byte{}}
+
+	room, emu := newProfileRoom("room1___Sushi", cloud, dir)
+	defer room.Close()
+	owner := newSessionMock("1", false)
+	owner.profile = "alice"
+	if err := room.AddConnectionToRoom(owner, ""); err != nil {
+		t.Fatal(err)
+	}
+	emu.ram = []byte{0x42}
+	if err := room.SaveGameSlot(1); err != nil {
+		t.Fatalf("couldn't save, %v", err)
+	}
+	if err := room.SaveGameSlot(-1); err != ErrSlot {
+		t.Errorf("the negative slot has been saved, %v", err)
+	}
+	if err := room.LoadGameSlot(-1); err != ErrSlot {
+		t.Errorf("the negative slot has been loaded, %v", err)
+	}
+	if err := room.uploads.flush(time.Second); err != nil {
+		t.Fatalf("couldn't upload the save, %v", err)
+	}
+	for _, key := range []string{slotKey(room.ID, 1), userSlotKey("alice", "Sushi", 1)} {
+		if _, ok := cloud.files[key]; !ok {
+			t.Errorf("no save %v in %v", key, cloud.files)
+		}
+	}
+
+	tests := []struct {
+		room string
+		user string
+		ram  []byte
+	}{
+		{room: "room2___Sushi", user: "alice", ram: []byte{0x42}},
+		{room: "room3___Sushi", user: "bob"},
+		{room: "room4___Sushi", user: ""},
+	}
+	for _, test := range tests {
+		other, otherEmu := newProfileRoom(test.room, cloud, dir)
+		peer := newSessionMock("1", false)
+		peer.profile = test.user
+		if err := other.AddConnectionToRoom(peer, ""); err != nil {
+			t.Fatal(err)
+		}
+		_ = other.LoadGameSlot(1)
+		if !reflect.DeepEqual(otherEmu.ram, test.ram) {
+			t.Errorf("the user %q has got the state %v, expected %v", test.user, otherEmu.ram, test.ram)
+		}
+		other.Close()
+	}
+}
+
+// Tests that the user gets its key mapping and volume back in another room,
+// the anonymous peers don't keep theirs.
+func TestProfileRestore(t *testing.T) {
+	cloud := &cloudMock{files: map[string][]byte{}}
+	first := newRoom("room1___Sushi", make(chan nanoarch.InputEvent, 100), cloud, worker.Config{})
+	defer first.Close()
+	first.profiles.delay = 10 * time.Millisecond
+	mapping := webrtc.KeyMapping{0: 8, 8: 0}
+
+	peer, anonymous := newSessionMock("1", false), newSessionMock("2", false)
+	peer.profile = "alice"
+	for _, p := range []*sessionMock{peer, anonymous} {
+		if err := first.AddConnectionToRoom(p, ""); err != nil {
+			t.Fatal(err)
+		}
+		p.SetKeyMapping(mapping)
+		if err := first.SaveProfile(p); err != nil {
+			t.Fatalf("couldn't save the profile, %v", err)
+		}
+	}
+	first.handleControl(peer, []byte(`{"id": 1, "cmd": "volume", "volume": 30}`))
+	// the changes are saved at once
+	first.profiles.wg.Wait()
+	if len(cloud.files) != 1 || cloud.uploads != 1 {
+		t.Errorf("wrong profiles %v (%v saves)", cloud.files, cloud.uploads)
+	}
+
+	second := newRoom("room2___Mario", make(chan nanoarch.InputEvent, 100), cloud, worker.Config{})
+	defer second.Close()
+	back, stranger := newSessionMock("3", false), newSessionMock("4", false)
+	back.profile = "alice"
+	for _, p := range []*sessionMock{back, stranger} {
+		if err := second.AddConnectionToRoom(p, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the profile comes in the background
+	for deadline := time.Now().Add(time.Second); back.Volume() != 30 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !reflect.DeepEqual(back.GetKeyMapping(), mapping) || back.Volume() != 30 {
+		t.Errorf("the user has got the mapping %v and volume %v", back.GetKeyMapping(), back.Volume())
+	}
+	if stranger.GetKeyMapping() != nil || stranger.Volume() != webrtc.MaxVolume {
+		t.Errorf("the anonymous peer has got the mapping %v and volume %v", stranger.GetKeyMapping(), stranger.Volume())
+	}
+}
@@ -0,0 +1,110 @@
+package room
+
+import (
+	"log"
+	"sync"
+)
+
+// ReconnectSession replaces the dead peer of the returning session (i.e. a reloaded tab)
+// with its new peer, which gets the player, the user and the ownership of the old one.
+// The old peer is removed first so its player is free for the new one.
+// The old peer released by the room (see ReleaseSeat) gives only its player,
+// if nobody has taken it.
+func (r *Room) ReconnectSession(old, peer Session) error {
+	if !r.rtcSessions.Has(old) {
+		if r.released.take(old) {
+			return r.rejoin(old, peer)
+		}
+		return ErrNoSession
+	}
+	owner := r.IsOwner(old)
+	r.RemoveSession(old)
+	old.StopClient()
+
+	peer.SetSpectator(old.IsSpectator())
+	peer.SetUser(old.GetUser())
+	peer.SetProfile(old.GetProfile())
+	if !peer.IsSpectator() {
+		if err := r.UpdatePlayerIndex(peer, old.GetPlayerIndex()); err != nil {
+			return err
+		}
+	}
+	// forces a keyframe for the new peer as well,
+	// the peer has been let in already
+	if err := r.addConnection(peer); err != nil {
+		return err
+	}
+	if owner {
+		r.owner.mu.Lock()
+		r.owner.id = peer.GetId()
+		r.owner.mu.Unlock()
+	}
+	log.Printf("Room %v session %v has reconnected as %v", r.ID, old.GetId(), peer.GetId())
+	return nil
+}
+
+// releasedSeats are the peers the room has released the seats of
+// (i.e. the closed tabs) by their IDs.
+// They are forgotten when their sessions reconnect or end.
+type releasedSeats struct {
+	mu    sync.Mutex
+	peers map[string]Session
+}
+
+func (s *releasedSeats) add(w Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peers == nil {
+		s.peers = map[string]Session{}
+	}
+	s.peers[w.GetId()] = w
+}
+
+// take tells if the seat of the peer has been released and forgets the peer.
+func (s *releasedSeats) take(w Session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if released, ok := s.peers[w.GetId()]; ok && released == w {
+		delete(s.peers, w.GetId())
+		return true
+	}
+	return false
+}
+
+// ReleaseSeat removes the gone peer (i.e. of the closed tab) from the room
+// right away, so its player is free for the others and the room isn't kept
+// running for it. The session of the peer may still reconnect
+// and gets its player back if it's free.
+func (r *Room) ReleaseSeat(w Session) {
+	if !r.rtcSessions.Has(w) {
+		return
+	}
+	r.RemoveSession(w)
+	w.StopClient()
+	r.released.add(w)
+	log.Printf("Room %v has released the seat of the session %v", r.ID, w.GetId())
+}
+
+// rejoin lets the peer of the returning session into the room
+// in place of its old peer without the seat.
+func (r *Room) rejoin(old, peer Session) error {
+	peer.SetSpectator(old.IsSpectator())
+	peer.SetUser(old.GetUser())
+	peer.SetProfile(old.GetProfile())
+	if !peer.IsSpectator() {
+		if err := r.UpdatePlayerIndex(peer, old.GetPlayerIndex()); err != nil {
+			if _, err := r.ClaimFreePlayerIndex(peer); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.addConnection(peer); err != nil {
+		r.freePlayer(peer)
+		return err
+	}
+	log.Printf("Room %v session %v has come back as %v", r.ID, old.GetId(), peer.GetId())
+	return nil
+}
+
+// ForgetSeat forgets the released seat of the peer of the ended session.
+func (r *Room) ForgetSeat(w Session) { r.released.take(w) }
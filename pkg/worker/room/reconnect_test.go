@@ -0,0 +1,165 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestReconnectSession(t *testing.T) {
+	room, peers := newPlayersRoom(2)
+	defer room.Close()
+	owner, player := peers[0], peers[1]
+	owner.User = "user"
+	if err := room.UpdatePlayerIndex(owner, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := room.ClaimFreePlayerIndex(player); err != nil {
+		t.Fatal(err)
+	}
+
+	back := &webrtc.WebRTC{ID: "back", InputChannel: make(chan []byte, 1)}
+	if err := room.ReconnectSession(owner, back); err != nil {
+		t.Fatalf("couldn't reconnect, %v", err)
+	}
+	if room.IsPCInRoom(owner) || !room.IsPCInRoom(back) {
+		t.Errorf("the old peer hasn't been replaced")
+	}
+	if back.PlayerIndex != 2 || back.User != "user" {
+		t.Errorf("wrong player %v of the user %v", back.PlayerIndex, back.User)
+	}
+	if !room.IsOwner(back) {
+		t.Errorf("the reconnected peer should own the room, not %v", room.Owner())
+	}
+	// the old peer doesn't hold the player anymore
+	if err := room.UpdatePlayerIndex(player, 2); err != ErrPlayerTaken {
+		t.Errorf("the player of the reconnected peer isn't taken, %v", err)
+	}
+
+	if err := room.ReconnectSession(owner, &webrtc.WebRTC{ID: "again"}); err != ErrNoSession {
+		t.Errorf("the gone peer has reconnected, %v", err)
+	}
+}
+
+// Tests that the dead peer of the full room
+// doesn't keep its player from the returning session.
+func TestReconnectSessionFullRoom(t *testing.T) {
+	room, peers := newPlayersRoom(maxPlayers)
+	defer room.Close()
+	for _, peer := range peers {
+		if _, err := room.ClaimFreePlayerIndex(peer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := peers[1]
+
+	back := &webrtc.WebRTC{ID: "back", InputChannel: make(chan []byte, 1)}
+	if err := room.ReconnectSession(old, back); err != nil {
+		t.Fatalf("couldn't reconnect, %v", err)
+	}
+	if players, _ := room.SessionsNum(); players != maxPlayers || back.PlayerIndex != 1 {
+		t.Errorf("wrong players %v, player %v", players, back.PlayerIndex)
+	}
+	if _, err := room.ClaimFreePlayerIndex(&webrtc.WebRTC{ID: "late"}); err != ErrNoFreePlayer {
+		t.Errorf("the player of the dead peer is free, %v", err)
+	}
+}
+
+// newSeatsRoom returns the room with the players of the mock peers.
+func newSeatsRoom(t *testing.T, peers ...*sessionMock) *Room {
+	room := newRoom("test_seats", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	for _, peer := range peers {
+		if err := room.AddConnectionToRoom(peer, ""); err != nil {
+			t.Fatalf("peer %v couldn't join, %v", peer.id, err)
+		}
+		if _, err := room.ClaimFreePlayerIndex(peer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return room
+}
+
+// Tests that the peer which has left with the leave command (the closed tab)
+// frees its player right away.
+func TestReleaseSeatLeave(t *testing.T) {
+	left, other := newSessionMock("left", false), newSessionMock("other", false)
+	room := newSeatsRoom(t, left, other)
+	defer room.Close()
+
+	start := time.Now()
+	room.handleControl(left, []byte(`{"id": 1, "cmd": "leave"}`))
+	for time.Since(start) < time.Second && room.IsPCInRoom(left) {
+		time.Sleep(time.Millisecond)
+	}
+	if room.IsPCInRoom(left) {
+		t.Fatalf("the seat of the left peer hasn't been released")
+	}
+	if released := time.Since(start); released > 100*time.Millisecond {
+		t.Errorf("the seat has been released after %v", released)
+	}
+	if left.IsConnected() {
+		t.Errorf("the left peer hasn't been stopped")
+	}
+	newcomer := newSessionMock("new", false)
+	if err := room.AddConnectionToRoom(newcomer, ""); err != nil {
+		t.Fatal(err)
+	}
+	if player, err := room.ClaimFreePlayerIndex(newcomer); err != nil || player != 0 {
+		t.Errorf("the newcomer has got the player %v instead of the free one, %v", player, err)
+	}
+}
+
+// Tests that the silently gone peer frees its player after the seat timeout
+// and its session gets the player back with the reconnect if it's free.
+func TestReleaseSeatGone(t *testing.T) {
+	gone, other := newSessionMock("gone", false), newSessionMock("other", false)
+	gone.SetUser("user")
+	room := newSeatsRoom(t, gone, other)
+	defer room.Close()
+
+	gone.disappear()
+	if room.IsPCInRoom(gone) {
+		t.Fatalf("the seat of the gone peer hasn't been released")
+	}
+	if players, _ := room.SessionsNum(); players != 1 {
+		t.Errorf("wrong number %v of the players", players)
+	}
+
+	back := newSessionMock("back", false)
+	if err := room.ReconnectSession(gone, back); err != nil {
+		t.Fatalf("couldn't reconnect, %v", err)
+	}
+	if !room.IsPCInRoom(back) || back.GetPlayerIndex() != 0 || back.GetUser() != "user" {
+		t.Errorf("wrong player %v of the user %v after the reconnect", back.GetPlayerIndex(), back.GetUser())
+	}
+	if err := room.ReconnectSession(gone, newSessionMock("again", false)); err != ErrNoSession {
+		t.Errorf("the released seat has been taken twice, %v", err)
+	}
+
+	// the player of the released seat is taken by then
+	back.disappear()
+	newcomer := newSessionMock("new", false)
+	if err := room.AddConnectionToRoom(newcomer, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UpdatePlayerIndex(newcomer, 0); err != nil {
+		t.Fatal(err)
+	}
+	late := newSessionMock("late", false)
+	if err := room.ReconnectSession(back, late); err != nil {
+		t.Fatalf("couldn't reconnect, %v", err)
+	}
+	if late.GetPlayerIndex() == 0 || late.GetPlayerIndex() == other.GetPlayerIndex() {
+		t.Errorf("the reconnected peer has got the taken player %v", late.GetPlayerIndex())
+	}
+
+	// the ended sessions don't come back
+	late.disappear()
+	room.ForgetSeat(late)
+	if err := room.ReconnectSession(late, newSessionMock("never", false)); err != ErrNoSession {
+		t.Errorf("the ended session has reconnected, %v", err)
+	}
+}
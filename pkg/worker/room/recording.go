@@ -0,0 +1,137 @@
+package room
+
+import (
+	"errors"
+	"log"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/recorder/webm"
+)
+
+var (
+	ErrRecording    = errors.New("already recording")
+	ErrNotRecording = errors.New("not recording")
+	// ErrNoVideo is returned when the room video
+	// has not started yet or the room is closed.
+	ErrNoVideo = errors.New("no video")
+)
+
+// recording is the WebM recording of the room streams.
+type recording struct {
+	opts  webm.Options
+	audio webm.AudioTrack
+	rec   *webm.Recorder
+	// the room is closed
+	closed bool
+}
+
+func newRecording(roomID string, cfg worker.Config) recording {
+	store := roomStorage(roomID, "", cfg)
+	return recording{
+		opts: webm.Options{
+			Dir:         recordingDir(cfg.Room.Recording.Folder, store),
+			MaxDuration: cfg.Room.Recording.MaxDuration,
+			MaxSize:     cfg.Room.Recording.MaxSize * 1024 * 1024,
+		},
+		audio: webm.AudioTrack{Channels: cfg.Encoder.Audio.Channels, Frequency: cfg.Encoder.Audio.Frequency},
+	}
+}
+
+// active tells if the recording is still going,
+// it stops by itself on reaching its limits.
+func (r *recording) active() bool {
+	if r.rec == nil {
+		return false
+	}
+	select {
+	case <-r.rec.Finished():
+		return false
+	default:
+		return true
+	}
+}
+
+// StartRecording starts the recording of the room video and audio
+// into a new WebM file and returns its path.
+// Only the VP8 and VP9 video can be recorded.
+func (r *Room) StartRecording() (string, error) {
+	r.videoLock.Lock()
+	video := webm.VideoTrack{Codec: r.videoCodec, Width: r.videoWidth, Height: r.videoHeight}
+	r.videoLock.Unlock()
+	if video.Codec == "" {
+		return "", ErrNoVideo
+	}
+
+	r.recordingLock.Lock()
+	defer r.recordingLock.Unlock()
+	if r.recording.closed {
+		return "", ErrNoVideo
+	}
+	if r.recording.active() {
+		return "", ErrRecording
+	}
+	if r.recording.rec != nil {
+		// finished by its limits
+		_ = r.recording.rec.Stop()
+	}
+	rec, err := webm.NewRecorder(r.ID, video, r.recording.audio, r.recording.opts)
+	if err != nil {
+		return "", err
+	}
+	r.recording.rec = rec
+	log.Printf("Room %v recording into %v", r.ID, rec.Path())
+	// the recording starts with the next keyframe
+	r.forceKeyframe()
+	return rec.Path(), nil
+}
+
+// StopRecording finalizes the recording of the room and returns its file path.
+func (r *Room) StopRecording() (string, error) {
+	r.recordingLock.Lock()
+	defer r.recordingLock.Unlock()
+	return r.stopRecording()
+}
+
+// stopRecording should be called under recordingLock.
+func (r *Room) stopRecording() (string, error) {
+	rec := r.recording.rec
+	if rec == nil {
+		return "", ErrNotRecording
+	}
+	r.recording.rec = nil
+	err := rec.Stop()
+	log.Printf("Room %v recording %v has been stopped", r.ID, rec.Path())
+	return rec.Path(), err
+}
+
+// closeRecording finalizes any active recording of the closed room.
+func (r *Room) closeRecording() {
+	r.recordingLock.Lock()
+	defer r.recordingLock.Unlock()
+	r.recording.closed = true
+	if r.recording.rec == nil {
+		return
+	}
+	if _, err := r.stopRecording(); err != nil {
+		log.Printf("error: room %v recording, %v", r.ID, err)
+	}
+}
+
+// recordVideo queues the encoded frame into the recording, it doesn't block.
+func (r *Room) recordVideo(frame encoder.OutFrame) {
+	r.recordingLock.RLock()
+	if r.recording.rec != nil {
+		r.recording.rec.WriteVideo(frame)
+	}
+	r.recordingLock.RUnlock()
+}
+
+// recordAudio queues the Opus packet into the recording, it doesn't block.
+func (r *Room) recordAudio(packet []byte) {
+	r.recordingLock.RLock()
+	if r.recording.rec != nil {
+		r.recording.rec.WriteAudio(packet)
+	}
+	r.recordingLock.RUnlock()
+}
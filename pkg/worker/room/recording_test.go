@@ -0,0 +1,85 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+)
+
+func newRecordingRoom(t *testing.T) (*Room, func()) {
+	dir, err := ioutil.TempDir("", "room_recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := worker.Config{}
+	cfg.Room.Recording.Folder = dir
+	cfg.Encoder.Audio.Channels, cfg.Encoder.Audio.Frequency = 2, 48000
+	room := newRoom("test_recording", make(chan nanoarch.InputEvent, 1), nil, cfg)
+	return room, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestRoomRecording(t *testing.T) {
+	room, cleanup := newRecordingRoom(t)
+	defer cleanup()
+
+	if _, err := room.StartRecording(); err != ErrNoVideo {
+		t.Fatalf("expected no video error, got %v", err)
+	}
+	room.videoCodec, room.videoWidth, room.videoHeight = codec.VPX, 320, 240
+
+	path, err := room.StartRecording()
+	if err != nil {
+		t.Fatalf("recording is not started, %v", err)
+	}
+	if _, err := room.StartRecording(); err != ErrRecording {
+		t.Errorf("expected already recording error, got %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		// VP8 keyframe tag
+		room.recordVideo(encoder.OutFrame{Data: []byte{0x00, byte(i)}, Time: now.Add(time.Duration(i) * 16 * time.Millisecond)})
+		room.recordAudio([]byte{0xfc})
+	}
+	file, err := room.StopRecording()
+	if err != nil || file != path {
+		t.Fatalf("recording is not stopped (%v), %v", file, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("empty recording, %v", err)
+	}
+	if _, err := room.StopRecording(); err != ErrNotRecording {
+		t.Errorf("expected not recording error, got %v", err)
+	}
+}
+
+func TestRoomRecordingWithUnsupportedCodec(t *testing.T) {
+	room, cleanup := newRecordingRoom(t)
+	defer cleanup()
+	room.videoCodec = codec.H264
+	if _, err := room.StartRecording(); err == nil {
+		t.Errorf("expected unsupported codec error")
+	}
+}
+
+func TestRoomRecordingOnClose(t *testing.T) {
+	room, cleanup := newRecordingRoom(t)
+	defer cleanup()
+	room.videoCodec, room.videoWidth, room.videoHeight = codec.VP9, 320, 240
+	if _, err := room.StartRecording(); err != nil {
+		t.Fatalf("recording is not started, %v", err)
+	}
+
+	room.closeRecording()
+	if room.recording.rec != nil {
+		t.Errorf("recording is not finalized")
+	}
+	if _, err := room.StartRecording(); err != ErrNoVideo {
+		t.Errorf("expected no recording in the closed room, got %v", err)
+	}
+}
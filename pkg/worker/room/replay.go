@@ -0,0 +1,148 @@
+package room
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/recorder/input"
+)
+
+var (
+	ErrLivePeers = errors.New("the room has live peers")
+	ErrReplaying = errors.New("already replaying")
+)
+
+// inputRecording logs the input events of the room
+// with the frames counted from its start.
+type inputRecording struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *input.Writer
+	start uint64
+}
+
+// inputReplay sends the recorded events into the room
+// at the same frames from its start.
+type inputReplay struct {
+	mu     sync.Mutex
+	events []input.Event
+	start  uint64
+}
+
+// tickFrame counts the game frames and replays the inputs of the frame.
+func (r *Room) tickFrame() {
+	frame := atomic.AddUint64(&r.frames, 1)
+
+	r.replay.mu.Lock()
+	var due []input.Event
+	for len(r.replay.events) > 0 && r.replay.start+r.replay.events[0].Frame <= frame {
+		due = append(due, r.replay.events[0])
+		r.replay.events = r.replay.events[1:]
+	}
+	finished := len(due) > 0 && len(r.replay.events) == 0
+	r.replay.mu.Unlock()
+
+	for _, e := range due {
+		// the recorded joypad states are already remapped
+		if event, ok := r.inputEvent(e.RawState, e.PlayerIdx, e.ConnID, nil); ok {
+			r.sendInput(event)
+		}
+	}
+	if finished {
+		log.Printf("Room %v input replay has finished", r.ID)
+	}
+}
+
+// StartInputRecording starts logging of all the input events of the room into the file.
+func (r *Room) StartInputRecording(path string) error {
+	r.inputRec.mu.Lock()
+	defer r.inputRec.mu.Unlock()
+	if r.inputRec.w != nil {
+		return ErrRecording
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w, err := input.NewWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.inputRec.file, r.inputRec.w = file, w
+	r.inputRec.start = atomic.LoadUint64(&r.frames)
+	log.Printf("Room %v input recording into %v", r.ID, path)
+	return nil
+}
+
+// StopInputRecording writes the logged input events and closes the file.
+func (r *Room) StopInputRecording() error {
+	r.inputRec.mu.Lock()
+	defer r.inputRec.mu.Unlock()
+	if r.inputRec.w == nil {
+		return ErrNotRecording
+	}
+	err := r.inputRec.w.Flush()
+	if cerr := r.inputRec.file.Close(); err == nil {
+		err = cerr
+	}
+	r.inputRec.file, r.inputRec.w = nil, nil
+	return err
+}
+
+// recordInput logs the input event sent to the emulator.
+func (r *Room) recordInput(event nanoarch.InputEvent) {
+	r.inputRec.mu.Lock()
+	defer r.inputRec.mu.Unlock()
+	if r.inputRec.w == nil {
+		return
+	}
+	err := r.inputRec.w.Write(input.Event{
+		Frame:     atomic.LoadUint64(&r.frames) - r.inputRec.start,
+		PlayerIdx: event.PlayerIdx,
+		ConnID:    event.ConnID,
+		RawState:  event.RawState,
+	})
+	if err != nil {
+		log.Printf("error: room %v input recording, %v", r.ID, err)
+	}
+}
+
+// ReplayInputs plays the recorded input events of the file back into the room
+// with the same player indices and frame offsets from the next frame.
+// The room should be a fresh one started from the same save state as the recorded one,
+// even then the emulation is not guaranteed to be identical.
+// It's not possible to replay inputs while some peers are connected.
+func (r *Room) ReplayInputs(path string) error {
+	if r.IsRunningSessions() {
+		return ErrLivePeers
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	events, err := input.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	r.replay.mu.Lock()
+	defer r.replay.mu.Unlock()
+	if len(r.replay.events) > 0 {
+		return ErrReplaying
+	}
+	r.replay.events = events
+	// the first events go with the next frame
+	r.replay.start = atomic.LoadUint64(&r.frames) + 1
+	log.Printf("Room %v replays %v input events from %v", r.ID, len(events), path)
+	return nil
+}
@@ -0,0 +1,84 @@
+package room
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+func TestInputReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "input_replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "inputs", "test.bin")
+
+	type sent struct {
+		frame uint64
+		event nanoarch.InputEvent
+	}
+	script := []sent{
+		{3, nanoarch.InputEvent{RawState: []byte{0x01, 0x00}, PlayerIdx: 0, ConnID: "a"}},
+		{3, nanoarch.InputEvent{RawState: []byte{0x02, 0x00}, PlayerIdx: 1, ConnID: "b"}},
+		{10, nanoarch.InputEvent{RawState: []byte{0x00, 0x00}, PlayerIdx: 0, ConnID: "a"}},
+		{25, nanoarch.InputEvent{RawState: []byte{0x00, 0x00, 0x10, 0x00}, PlayerIdx: 1, ConnID: "b"}},
+	}
+
+	// record
+	in := make(chan nanoarch.InputEvent, 10)
+	room := newRoom("test_input_record", in, nil, worker.Config{})
+	for i := 0; i < 5; i++ {
+		room.tickFrame()
+	}
+	if err := room.StartInputRecording(path); err != nil {
+		t.Fatalf("no input recording, %v", err)
+	}
+	var recorded []sent
+	for frame, i := uint64(0), 0; i < len(script); frame++ {
+		for ; i < len(script) && script[i].frame == frame; i++ {
+			room.sendInput(script[i].event)
+			recorded = append(recorded, sent{frame, <-in})
+		}
+		room.tickFrame()
+	}
+	if err := room.StopInputRecording(); err != nil {
+		t.Fatalf("input recording is not stopped, %v", err)
+	}
+
+	// replay into another room
+	out := make(chan nanoarch.InputEvent, 10)
+	replay := newRoom("test_input_replay", out, nil, worker.Config{})
+	replay.tickFrame()
+	if err := replay.ReplayInputs(path); err != nil {
+		t.Fatalf("no replay, %v", err)
+	}
+	if err := replay.ReplayInputs(path); err != ErrReplaying {
+		t.Errorf("expected already replaying error, got %v", err)
+	}
+	var replayed []sent
+	for frame := uint64(0); frame < 30; frame++ {
+		replay.tickFrame()
+		for len(out) > 0 {
+			replayed = append(replayed, sent{frame, <-out})
+		}
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("wrong replay\n got: %v\nwant: %v", replayed, recorded)
+	}
+}
+
+func TestInputReplayWithoutRecording(t *testing.T) {
+	room := newRoom("test_input_replay_none", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	if err := room.ReplayInputs(filepath.Join(os.TempDir(), "no_such_input_recording")); err == nil {
+		t.Errorf("expected an error")
+	}
+	if err := room.StopInputRecording(); err != ErrNotRecording {
+		t.Errorf("expected not recording error, got %v", err)
+	}
+}
@@ -1,39 +1,57 @@
 package room
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"math"
-	"net"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
 	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
 	"github.com/giongto35/cloud-game/v2/pkg/games"
 	"github.com/giongto35/cloud-game/v2/pkg/recorder"
 	"github.com/giongto35/cloud-game/v2/pkg/session"
 	"github.com/giongto35/cloud-game/v2/pkg/storage"
-	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/overlay"
 )
 
 // Room is a game session. multi webRTC sessions can connect to a same game.
 // A room stores all the channel for interaction between all webRTCs session and emulator
 type Room struct {
+	// frames is the number of the game frames,
+	// first for 64-bit alignment of the atomic operations
+	frames uint64
+
 	ID string
+	// the game of the room
+	game games.GameMetadata
+	// the content hash of the game file and the library of the emulator core,
+	// the save files of the room are only for them
+	gameHash string
+	core     string
+	// the storage of the local files of the room, set with the start of the room
+	files nanoarch.Storage
+	// the start time of the room
+	created time.Time
 
 	// imageChannel is image stream received from director
 	imageChannel <-chan nanoarch.GameFrame
 	// audioChannel is audio stream received from director
-	audioChannel <-chan []int16
+	audioChannel <-chan nanoarch.GameAudio
 	// inputChannel is input stream send to director. This inputChannel is combined
 	// input from webRTC + connection info (player index)
 	inputChannel chan<- nanoarch.InputEvent
@@ -47,190 +65,263 @@ type Room struct {
 	// Done channel is to fire exit event when room is closed
 	Done chan struct{}
 	// List of peer connections in the room
-	rtcSessions []*webrtc.WebRTC
-	// NOTE: Not in use, lock rtcSessions
-	sessionsLock *sync.Mutex
+	rtcSessions *Sessions
 	// Director is emulator
 	director emulator.CloudEmulator
 	// Cloud storage to store room state online
 	onlineStorage storage.CloudStorage
+	// ctx is cancelled with the room, it stops the downloads of the cloud storage,
+	// the uploads of the final save go on after that
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the format of the uploaded save states
+	states storage.StateCodec
+	// err is the reason of the failed room start
+	err error
+	// ready is closed when the game has started
+	ready chan struct{}
+	// emulator restarts the hung or exited emulators
+	emulator emulatorWatch
+	// newEmulator makes the emulators of the room
+	newEmulator EmulatorFactory
 
 	rec *recorder.Recording
 
 	vPipe *encoder.VideoPipe
+	// vPipeLow is the low layer of the simulcast, nil without it
+	vPipeLow *encoder.VideoPipe
+	// layers are the simulcast video layers of the peers
+	layers *peerLayers
+	// drops tracks slow peers
+	drops dropWatch
+	// stalls watches the media sends the consumers don't take
+	stalls stallWatch
+	stats  *statsCollector
+	// skips decides which video frames are not encoded
+	skips *frameSkip
+	// bitrate adapts the video bitrate to the peers
+	bitrate *bitrateControl
+	// ladder downscales the video with the bitrate
+	ladder *resolutionLadder
+	// lowBitrate adapts the bitrate of the low layer to its peers
+	lowBitrate *bitrateControl
+	// screenshots gets the video frames for Screenshot
+	screenshots screenshots
+	// controls stop the control loops of the peers leaving the room
+	controls peerControls
+	// achievements are the achievements of the game
+	achievements roomAchievements
+	// status is the non-running state of the room shown over its video
+	status roomStatus
+	// idle closes the room without active peers
+	idle idleWatch
+
+	// saveLock serializes the game saves
+	saveLock sync.Mutex
+	// uploads is the queue of the saves into the cloud storage
+	uploads *uploadQueue
+	// lastAutosave is the time of the last successful autosave
+	lastAutosave atomic.Value
+	// fps of the game
+	fps float64
+
+	// audioLock guards the audio encoders
+	audioLock sync.Mutex
+	audioEnc  audioEncoder
+	// the settings of the audio encoders
+	audioConf encoderConfig.Audio
+	// newAudioEnc creates the audio encoders of the peer volumes
+	newAudioEnc func(audio encoderConfig.Audio) (audioEncoder, error)
+	// the audio encoders of the peer volumes except the full one
+	volumeEnc map[int]audioEncoder
+
+	// videoLock guards the video codec and pipe
+	videoLock sync.Mutex
+	// the video codec of the room, chosen at start
+	videoCodec codec.VideoCodec
+	// the encoded frame size
+	videoWidth, videoHeight int
+	// the viewport of the encoded frames (the scaling mode, the crop)
+	videoView viewport.Viewport
+	// the scale of the encoded frames on the resolution ladder,
+	// they are downscaled from the video size after the filters
+	videoScale float64
+	// the native frame size of the game for the upscale filters
+	nativeWidth, nativeHeight int
+	// the game is rotated by 90 or 270 degrees
+	videoRotated bool
+	// the video filters (and their names) of the frames before the encoding
+	videoFilters     filter.Chain
+	videoFilterNames []string
+	// the resolution of the game the video size is made of,
+	// used by the video goroutine
+	geometry gameGeometry
+
+	// recordingLock guards the WebM recording
+	recordingLock sync.RWMutex
+	recording     recording
+	// inputRec logs the input events and replay plays them back
+	inputRec inputRecording
+	replay   inputReplay
+	// cheats of the game
+	cheats cheatList
+	// pauseLock guards the pause state of the game
+	pauseLock sync.Mutex
+	paused    bool
+	// frozen is set while the room is moving to another worker
+	frozen uint32
+	// the peer that has sped up the game
+	fastForward fastForward
+	// the peers of the players
+	players playerSlots
+	// the gone peers without their seats, they may reconnect
+	released releasedSeats
+	// the owner and the banned sessions of the room
+	owner roomOwner
+	// the keyboard of the computer cores
+	keyboard keyboardCapture
+	// the rumble of the controllers of the players
+	rumble roomRumble
+	// the text chat of the peers
+	chat roomChat
+	// the input delay of the players
+	delay inputDelay
+	// the pending saves of the profiles of the users
+	profiles profileSaves
+	// the passphrase of the private room
+	password roomPassword
+	// the max numbers of the players and spectators
+	limits roomLimits
+	// the sessions in the metrics
+	sessionMetrics sessionMetrics
+	// the handoff to another worker
+	migration roomMigration
+	// the last events of the room
+	events eventLog
+	// the frames of the emulators without game
+	importer roomImporter
+	// the saves after the last player has left
+	leave leaveSave
+	// the rate limits of the input of the peers
+	inputLimits inputLimits
+	// the media bytes sent to the peers under the bandwidth cap
+	egress *roomEgress
+	// the media consumers besides the peers
+	sinks sinks
+	// save the game on close even if the room hasn't been saved before
+	alwaysSave bool
+
+	closeOnce sync.Once
+	// closed is closed when the room has completely shut down
+	// (including the final save of the game)
+	closed chan struct{}
+	// inputs tracks running peer input handlers
+	inputs sync.WaitGroup
+	// inputLock guards inputChannel and input handlers against close
+	inputLock    sync.RWMutex
+	inputStopped bool
 }
 
-const (
-	bufSize        = 245969
-	SocketAddrTmpl = "/tmp/cloudretro-retro-%s.sock"
-)
-
-// NewVideoImporter return image Channel from stream
-func NewVideoImporter(roomID string) chan nanoarch.GameFrame {
-	sockAddr := fmt.Sprintf(SocketAddrTmpl, roomID)
-	imgChan := make(chan nanoarch.GameFrame)
-
-	l, err := net.Listen("unix", sockAddr)
-	if err != nil {
-		log.Fatal("listen error:", err)
-	}
-
-	log.Println("Creating uds server", sockAddr)
-	go func(l net.Listener) {
-		defer l.Close()
+const SocketAddrTmpl = "/tmp/cloudretro-retro-%s.sock"
 
-		conn, err := l.Accept()
-		if err != nil {
-			log.Fatal("Accept error: ", err)
-		}
-		defer conn.Close()
-
-		log.Println("Received new conn")
-		log.Println("Spawn Importer")
-
-		fullBuf := make([]byte, bufSize*2)
-		fullBuf = fullBuf[:0]
-
-		for {
-			// TODO: Not reallocate
-			buf := make([]byte, bufSize)
-			l, err := conn.Read(buf)
-			if err != nil {
-				if err != io.EOF {
-					log.Printf("error: %v", err)
-				}
-				continue
-			}
-
-			buf = buf[:l]
-			fullBuf = append(fullBuf, buf...)
-			if len(fullBuf) >= bufSize {
-				buff := bytes.NewBuffer(fullBuf)
-				dec := gob.NewDecoder(buff)
+var (
+	ErrSpectator  = errors.New("spectators can't control players")
+	ErrNotStarted = errors.New("the game hasn't started yet")
+	ErrNoCodec    = errors.New("the peer can't decode the video of the room")
+	ErrSlot       = errors.New("wrong save slot")
+)
 
-				frame := nanoarch.GameFrame{}
-				err := dec.Decode(&frame)
-				if err != nil {
-					log.Fatalf("%v", err)
-				}
-				imgChan <- frame
-				fullBuf = fullBuf[bufSize:]
-			}
-		}
-	}(l)
+// CoreInstaller downloads the missing emulator cores.
+type CoreInstaller interface {
+	Install(emulator string) error
+}
 
-	return imgChan
+// NewRoom creates a new room.
+// The missing cores of the room are installed by the optional cores installer.
+// The game is loaded in the background, Ready tells when it has started.
+func NewRoom(roomID string, game games.GameMetadata, recUser string, rec bool, onlineStorage storage.CloudStorage, cores CoreInstaller, cfg worker.Config) *Room {
+	return NewRoomWithEmulator(nil, roomID, game, recUser, rec, onlineStorage, cores, cfg)
 }
 
-// NewRoom creates a new room
-func NewRoom(roomID string, game games.GameMetadata, recUser string, rec bool, onlineStorage storage.CloudStorage, cfg worker.Config) *Room {
+// NewRoomWithEmulator creates a new room with the emulators of the factory,
+// nil -- the libretro ones (see NewRoom).
+func NewRoomWithEmulator(emulators EmulatorFactory, roomID string, game games.GameMetadata, recUser string, rec bool,
+	onlineStorage storage.CloudStorage, cores CoreInstaller, cfg worker.Config) *Room {
 	if roomID == "" {
 		roomID = session.GenerateRoomID(game.Name)
 	}
 
 	log.Println("New room: ", roomID, game)
 	inputChannel := make(chan nanoarch.InputEvent, 100)
+	room := newRoom(roomID, inputChannel, onlineStorage, cfg)
+	room.game = game
+	if emulators != nil {
+		room.newEmulator = emulators
+	}
+	emuName, cfg := gameConfig(game, cfg)
+	coreConf := cfg.Emulator.GetLibretroCoreConfig(emuName)
+	if coreConf.Players > 0 {
+		room.limits.players = playerLimit(coreConf.Players)
+	}
+	room.keyboard.enabled = coreConf.Keyboard
+	room.core = filepath.Base(coreConf.Lib)
+
+	go room.watchStart(cfg.Room.StartTimeout)
+	go room.start(game, emuName, inputChannel, cores, recUser, rec, cfg)
+	room.checkIdle()
+	return room
+}
 
+func newRoom(roomID string, inputChannel chan nanoarch.InputEvent, onlineStorage storage.CloudStorage, cfg worker.Config) *Room {
+	metrics.rooms.Inc()
+	ctx, cancel := context.WithCancel(context.Background())
+	// the storage config is checked on the worker start,
+	// the codec of the bad one fails the saves
+	states, _ := storage.NewStateCodec(cfg.Storage)
+	uploads := newUploadQueue()
+	uploads.mark = !storage.IsNoop(onlineStorage) && !cfg.Emulator.IsFlatStorage()
 	room := &Room{
-		ID: roomID,
+		ID:      roomID,
+		created: time.Now(),
 
 		inputChannel: inputChannel,
 		imageChannel: nil,
 		//voiceInChannel:  make(chan []byte, 1),
 		//voiceOutChannel: make(chan []byte, 1),
-		rtcSessions:   []*webrtc.WebRTC{},
-		sessionsLock:  &sync.Mutex{},
+		rtcSessions:   NewSessions(),
 		IsRunning:     true,
 		onlineStorage: onlineStorage,
-
-		Done: make(chan struct{}, 1),
+		ctx:           ctx,
+		cancel:        cancel,
+		states:        states,
+		drops:         dropWatch{threshold: cfg.Room.DropWarnThreshold},
+		stalls:        newStallWatch(cfg.Room.Stalls),
+		idle:          newIdleWatch(cfg.Room.IdleTimeout),
+		uploads:       uploads,
+		stats:         newStatsCollector(),
+		skips:         newFrameSkip(),
+		layers:        newPeerLayers(cfg.Encoder.Video),
+		recording:     newRecording(roomID, cfg),
+		emulator:      newEmulatorWatch(cfg.Room.Watchdog),
+		newEmulator:   initEmulator,
+		achievements:  roomAchievements{unlocked: make(chan Achievement, achievementsBuffer)},
+		chat:          newRoomChat(cfg.Room.Chat),
+		delay:         newInputDelay(roomID, cfg.Room.InputDelay),
+		profiles:      profileSaves{pending: map[string][]byte{}, delay: profileSaveDelay},
+		leave:         newLeaveSave(cfg.Emulator.LeaveSaveInterval),
+		inputLimits:   newInputLimits(cfg.Room.InputLimit),
+		egress:        newRoomEgress(cfg.Room.Bandwidth, cfg.Encoder.Video.Bitrate.Min, cfg.Encoder.Video.Bitrate.Max),
+		alwaysSave:    cfg.Emulator.AlwaysCloudSave,
+		limits: roomLimits{
+			players:    playerLimit(cfg.Room.MaxPlayers),
+			spectators: cfg.Room.MaxSpectators,
+		},
+
+		Done:   make(chan struct{}, 1),
+		ready:  make(chan struct{}),
+		closed: make(chan struct{}),
 	}
-
-	// Check if room is on local storage, if not, pull from GCS to local storage
-	go func(game games.GameMetadata, roomID string) {
-		store := nanoarch.Storage{
-			Path:     cfg.Emulator.Storage,
-			MainSave: roomID,
-		}
-
-		// Check room is on local or fetch from server
-		log.Printf("Check for %s in the online storage", roomID)
-		if err := room.saveOnlineRoomToLocal(roomID, store.GetSavePath()); err != nil {
-			log.Printf("warn: room %s is not in the online storage, error %s", roomID, err)
-		}
-
-		// If not then load room or create room from local.
-		log.Printf("Room %s started. GameName: %s, WithGame: %t", roomID, game.Name, cfg.Encoder.WithoutGame)
-
-		// Spawn new emulator and plug-in all channels
-		emuName := cfg.Emulator.GetEmulator(game.Type, game.Path)
-		libretroConfig := cfg.Emulator.GetLibretroCoreConfig(emuName)
-
-		if cfg.Encoder.WithoutGame {
-			// Run without game, image stream is communicated over a unix socket
-			imageChannel := NewVideoImporter(roomID)
-			director, _, audioChannel := nanoarch.Init(roomID, false, inputChannel, store, libretroConfig)
-			room.imageChannel = imageChannel
-			room.director = director
-			room.audioChannel = audioChannel
-		} else {
-			// Run without game, image stream is communicated over image channel
-			director, imageChannel, audioChannel := nanoarch.Init(roomID, true, inputChannel, store, libretroConfig)
-			room.imageChannel = imageChannel
-			room.director = director
-			room.audioChannel = audioChannel
-		}
-
-		gameMeta := room.director.LoadMeta(filepath.Join(game.Base, game.Path))
-
-		// nwidth, nheight are the WebRTC output size
-		var nwidth, nheight int
-		emu, ar := cfg.Emulator, cfg.Emulator.AspectRatio
-
-		if ar.Keep {
-			baseAspectRatio := float64(gameMeta.BaseWidth) / float64(ar.Height)
-			nwidth, nheight = resizeToAspect(baseAspectRatio, ar.Width, ar.Height)
-			log.Printf("Viewport size will be changed from %dx%d (%f) -> %dx%d", ar.Width, ar.Height,
-				baseAspectRatio, nwidth, nheight)
-		} else {
-			nwidth, nheight = gameMeta.BaseWidth, gameMeta.BaseHeight
-			log.Printf("Viewport custom size is disabled, base size will be used instead %dx%d", nwidth, nheight)
-		}
-
-		if emu.Scale > 1 {
-			nwidth, nheight = nwidth*emu.Scale, nheight*emu.Scale
-			log.Printf("Viewport size has scaled to %dx%d", nwidth, nheight)
-		}
-
-		// set game frame size considering its orientation
-		encoderW, encoderH := nwidth, nheight
-		if gameMeta.Rotation.IsEven {
-			encoderW, encoderH = nheight, nwidth
-		}
-
-		if cfg.Recording.Enabled {
-			room.rec = recorder.NewRecording(
-				recorder.Meta{UserName: recUser},
-				recorder.Options{
-					Dir:                   cfg.Recording.Folder,
-					Fps:                   gameMeta.Fps,
-					Frequency:             gameMeta.AudioSampleRate,
-					Game:                  game.Name,
-					ImageCompressionLevel: cfg.Recording.CompressLevel,
-					Name:                  cfg.Recording.Name,
-					Zip:                   cfg.Recording.Zip,
-				})
-			room.ToggleRecording(rec, recUser)
-		}
-
-		room.director.SetViewport(encoderW, encoderH)
-
-		// Spawn video and audio encoding for webRTC
-		go room.startVideo(encoderW, encoderH, cfg.Encoder.Video)
-		go room.startAudio(gameMeta.AudioSampleRate, cfg.Encoder.Audio)
-		//go room.startVoice()
-		room.director.Start()
-	}(game, roomID)
+	room.event(Event{Type: EventCreated})
 	return room
 }
 
@@ -255,19 +346,74 @@ func isGameOnLocal(path string) bool {
 	return !errors.Is(err, os.ErrNotExist)
 }
 
-func (r *Room) AddConnectionToRoom(peerconnection *webrtc.WebRTC) {
-	peerconnection.AttachRoomID(r.ID)
-	r.rtcSessions = append(r.rtcSessions, peerconnection)
-
-	go r.startWebRTCSession(peerconnection)
+// AddConnectionToRoom adds the peer into the room,
+// the first peer of the room becomes its owner.
+// The banned peers are rejected with ErrBanned,
+// the peers without the password of the private room with ErrWrongPassword
+// the peers over the limits of the room with ErrRoomFull
+// and the peers without the video codec of the room with ErrNoCodec.
+// The sessions of the migrated room get their places without the password.
+func (r *Room) AddConnectionToRoom(peerconnection Session, password string) error {
+	if r.takeSeat(peerconnection) {
+		return r.addConnection(peerconnection)
+	}
+	if err := r.VerifyPassword(password); err != nil {
+		return err
+	}
+	return r.addConnection(peerconnection)
 }
 
-func (r *Room) UpdatePlayerIndex(peerconnection *webrtc.WebRTC, playerIndex int) {
-	log.Println("Updated player Index to: ", playerIndex)
-	peerconnection.PlayerIndex = playerIndex
+// addConnection adds the peer into the room without the password.
+func (r *Room) addConnection(peerconnection Session) error {
+	if r.isBanned(peerconnection) {
+		return ErrBanned
+	}
+	if err := r.joinCodec(peerconnection); err != nil {
+		return err
+	}
+	r.limits.mu.Lock()
+	if r.isFull(peerconnection) {
+		r.limits.mu.Unlock()
+		return ErrRoomFull
+	}
+	peerconnection.SetRoom(r.ID)
+	r.egress.join(peerconnection.GetId(), peerconnection.Egress())
+	r.rtcSessions.Add(peerconnection)
+	r.limits.mu.Unlock()
+	r.updateSessionMetrics()
+	r.event(Event{Type: EventPeerJoined, Session: peerconnection.GetId()})
+	r.claimOwner(peerconnection)
+	// the paused rooms stay idle with the new peers
+	if !r.IsPaused() {
+		r.idle.cancel()
+	}
+	r.restoreProfile(peerconnection)
+
+	// the new peer can't decode the stream until the next keyframe
+	peerconnection.OnKeyframeRequest(r.forceKeyframe)
+	r.forceKeyframe()
+	peerconnection.OnGone(func() { r.ReleaseSeat(peerconnection) })
+	r.watchPeerStalls(peerconnection)
+	go r.startControl(peerconnection, r.controls.start(peerconnection.GetId()))
+	// the history is lost until the control channel opens
+	peerconnection.OnControlOpen(func() { r.sendChatHistory(peerconnection) })
+
+	if peerconnection.IsSpectator() {
+		return nil
+	}
+
+	r.inputLock.RLock()
+	defer r.inputLock.RUnlock()
+	if r.inputStopped {
+		return nil
+	}
+	r.inputs.Add(1)
+	go r.startWebRTCSession(peerconnection)
+	return nil
 }
 
-func (r *Room) startWebRTCSession(peerconnection *webrtc.WebRTC) {
+func (r *Room) startWebRTCSession(peerconnection Session) {
+	defer r.inputs.Done()
 	defer func() {
 		if r := recover(); r != nil {
 			log.Println("Warn: Recovered when sent to close inputChannel")
@@ -280,7 +426,7 @@ func (r *Room) startWebRTCSession(peerconnection *webrtc.WebRTC) {
 	//	// set up voice input and output. A room has multiple voice input and only one combined voice output.
 	//	for voiceInput := range peerconnection.VoiceInChannel {
 	//		// NOTE: when room is no longer running. InputChannel needs to have extra event to go inside the loop
-	//		if peerconnection.Done || !peerconnection.IsConnected() || !r.IsRunning {
+	//		if peerconnection.IsDone() || !peerconnection.IsConnected() || !r.IsRunning {
 	//			break
 	//		}
 	//
@@ -292,144 +438,470 @@ func (r *Room) startWebRTCSession(peerconnection *webrtc.WebRTC) {
 	//}()
 
 	// bug: when input channel here = nil, skip and finish
-	for input := range peerconnection.InputChannel {
-		// NOTE: when room is no longer running. InputChannel needs to have extra event to go inside the loop
-		if peerconnection.Done || !peerconnection.IsConnected() || !r.IsRunning {
-			break
-		}
-
-		if peerconnection.IsConnected() {
-			select {
-			case r.inputChannel <- nanoarch.InputEvent{RawState: input, PlayerIdx: peerconnection.PlayerIndex, ConnID: peerconnection.ID}:
-			default:
+	for {
+		select {
+		case <-r.Done:
+			log.Printf("[worker] peer connection is done (room closed)")
+			return
+		case input, ok := <-peerconnection.GetInputChannel():
+			if !ok || peerconnection.IsDone() || !isPresent(peerconnection) {
+				log.Printf("[worker] peer connection is done")
+				r.checkIdle()
+				return
 			}
+			r.handleInput(peerconnection, input)
 		}
 	}
-	log.Printf("[worker] peer connection is done")
 }
 
-// RemoveSession removes a peerconnection from room and return true if there is no more room
-func (r *Room) RemoveSession(w *webrtc.WebRTC) {
-	log.Println("Cleaning session: ", w.ID)
-	// TODO: get list of r.rtcSessions in lock
-	for i, s := range r.rtcSessions {
-		log.Println("found session: ", w.ID)
-		if s.ID == w.ID {
-			r.rtcSessions = append(r.rtcSessions[:i], r.rtcSessions[i+1:]...)
-			s.RoomID = ""
-			log.Println("Removed session ", s.ID, " from room: ", r.ID)
-			break
-		}
+// handleInput sends the input message of the peer to the emulator.
+func (r *Room) handleInput(peerconnection Session, input []byte) {
+	if !r.allowInput(peerconnection, input) {
+		return
+	}
+	// the input of the moving room is dropped
+	if r.isFrozen() {
+		return
+	}
+	event, ok := r.inputEvent(input, peerconnection.GetPlayerIndex(), peerconnection.GetId(), peerconnection.GetKeyMapping())
+	// the keys of the peers without the keyboard are dropped
+	if ok && event.Kind == nanoarch.InputKeyboard && !r.pressKey(peerconnection, event.Keyboard) {
+		return
+	}
+	if ok {
+		event.Time = r.stats.now()
+		r.queueInput(event)
+		metrics.inputs.Inc()
+	}
+}
+
+// sendInput pushes an input event to the emulator without blocking.
+// The events are silently dropped when the room is closed.
+func (r *Room) sendInput(event nanoarch.InputEvent) {
+	r.inputLock.RLock()
+	defer r.inputLock.RUnlock()
+
+	if r.inputStopped {
+		return
 	}
-	// Detach input. Send end signal
 	select {
-	case r.inputChannel <- nanoarch.InputEvent{RawState: []byte{0xFF, 0xFF}, ConnID: w.ID}:
+	case r.inputChannel <- event:
+		r.recordInput(event)
 	default:
 	}
 }
 
-// TODO: Reuse for remove Session
-func (r *Room) IsPCInRoom(w *webrtc.WebRTC) bool {
-	if r == nil {
-		return false
+// RemoveSession removes a peerconnection from room and return true if there is no more room
+func (r *Room) RemoveSession(w Session) {
+	log.Println("Cleaning session: ", w.GetId())
+	s := r.rtcSessions.Remove(w)
+	if s != nil {
+		s.SetRoom("")
+		r.egress.leave(s.GetId(), s.Egress())
+		log.Println("Removed session ", s.GetId(), " from room: ", r.ID)
+		r.updateSessionMetrics()
+		r.event(Event{Type: EventPeerLeft, Session: s.GetId()})
 	}
-	for _, s := range r.rtcSessions {
-		if s.ID == w.ID {
-			return true
-		}
+	r.layers.remove(w.GetId())
+	r.controls.stop(w.GetId())
+	r.transferOwner(w)
+	r.releaseKeyboard(w)
+	r.resetSpeed(w)
+	r.freePlayer(w)
+	r.forgetChat(w)
+	r.inputLimits.forget(w.GetId())
+	r.released.take(w)
+	// Detach input. Send end signal
+	if !w.IsSpectator() {
+		r.queueInput(nanoarch.InputEvent{RawState: []byte{0xFF, 0xFF}, ConnID: w.GetId()})
 	}
-	return false
+	if s != nil {
+		r.checkLeave(w)
+	}
+	r.checkIdle()
 }
 
-func (r *Room) Close() {
-	if !r.IsRunning {
-		return
+func (r *Room) IsPCInRoom(w Session) bool {
+	if r == nil {
+		return false
 	}
+	return r.rtcSessions.Has(w)
+}
+
+// Close shuts down the room.
+// It's safe to call it multiple times from different goroutines.
+// The room may still save its state in the background after that,
+// use Closed to wait for the complete shutdown.
+func (r *Room) Close() { r.closeOnce.Do(r.close) }
+
+// Err returns the reason of the failed room start, if any.
+// Should be called after the room is done, the reasons are
+// emulator.ErrNoCore, emulator.ErrBadGame, ErrCrashed or ErrStartTimeout,
+// the running rooms are closed with ErrCrashed or ErrVideo.
+func (r *Room) Err() error { return r.err }
+
+// Closed returns a channel which will be closed when the room
+// has completely shut down, including the final save of the game.
+func (r *Room) Closed() <-chan struct{} { return r.closed }
 
+func (r *Room) close() {
 	r.IsRunning = false
 	log.Println("Closing room and director of room ", r.ID)
-
-	// Save game before quit. Only save for game which was previous saved to avoid flooding database
-	if r.isRoomExisted() {
-		log.Println("Saved Game before closing room")
-		// use goroutine here because SaveGame attempt to acquire a emulator lock.
-		// the lock is holding before coming to close, so it will cause deadlock if SaveGame is synchronous
-		go func() {
-			// Save before close, so save can have correct state (Not sure) may again cause deadlock
-			if err := r.SaveGame(); err != nil {
-				log.Println("[error] couldn't save the game during closing")
-			}
-			r.director.Close()
-		}()
+	r.idle.cancel()
+	if r.err != nil {
+		r.event(Event{Type: EventClosed, Reason: r.err.Error()})
+		r.dumpEvents(r.err)
 	} else {
-		r.director.Close()
+		r.event(Event{Type: EventClosed})
 	}
-	log.Println("Closing input of room ", r.ID)
-	close(r.inputChannel)
-	//close(r.voiceOutChannel)
-	//close(r.voiceInChannel)
+	r.closeMetrics()
+
+	// stop and wait all peer input handlers
+	r.inputLock.Lock()
+	r.inputStopped = true
+	r.inputLock.Unlock()
 	close(r.Done)
-	// Close here is a bit wrong because this read channel
-	// Just dont close it, let it be gc
-	//close(r.imageChannel)
-	//close(r.audioChannel)
-	if r.rec != nil {
-		if err := r.rec.Stop(); err != nil {
-			log.Printf("record close err, %v", err)
+	r.cancel()
+	r.inputs.Wait()
+
+	// Save game before quit. Only save for game which was previous saved to avoid flooding database.
+	// The final save and its upload go in the background,
+	// Closed tells when they're done.
+	go func() {
+		defer close(r.closed)
+		// the director of the starting room is set under the lock too
+		r.saveLock.Lock()
+		if r.director != nil {
+			// the moved room has given its state to the new one
+			if !r.isMoved() && (r.alwaysSave || r.isRoomExisted()) {
+				log.Println("Saved Game before closing room")
+				// Save before close, so save can have correct state (Not sure) may again cause deadlock
+				if err := r.saveGameSlot(0, false); err != nil {
+					log.Println("[error] couldn't save the game during closing")
+				}
+			}
+			r.director.Close()
 		}
-	}
+		r.saveLock.Unlock()
+		// the room with the same ID may take the socket
+		r.stopImporter()
+		if err := r.uploads.flush(uploadFlushTimeout); err != nil {
+			log.Printf("error: room %v cloud saves on close, %v", r.ID, err)
+		}
+		r.uploads.stop()
+		log.Println("Closing input of room ", r.ID)
+		close(r.inputChannel)
+		//close(r.voiceOutChannel)
+		//close(r.voiceInChannel)
+		// Close here is a bit wrong because this read channel
+		// Just dont close it, let it be gc
+		//close(r.imageChannel)
+		//close(r.audioChannel)
+		if r.rec != nil {
+			if err := r.rec.Stop(); err != nil {
+				log.Printf("record close err, %v", err)
+			}
+		}
+		r.closeRecording()
+		if err := r.StopInputRecording(); err != nil && err != ErrNotRecording {
+			log.Printf("error: room %v input recording, %v", r.ID, err)
+		}
+	}()
 }
 
 func (r *Room) isRoomExisted() bool {
-	// Check if room is in online storage
-	_, err := r.onlineStorage.Load(r.ID)
-	if err == nil {
+	// Check if room is in online storage,
+	// it's checked on close, so the room context is done
+	if content, err := r.onlineStorage.Load(context.Background(), r.ID); err == nil {
+		_ = content.Close()
 		return true
 	}
 	return isGameOnLocal(r.director.GetHashPath())
 }
 
-// SaveGame writes save state on the disk as well as
-// uploads it to a cloud storage.
-func (r *Room) SaveGame() error {
+// SaveGame writes save state on the disk and
+// queues its upload into a cloud storage.
+func (r *Room) SaveGame() error { return r.SaveGameSlot(0) }
+
+// SaveGameSlot writes save state of the slot on the disk and
+// queues its upload into a cloud storage.
+func (r *Room) SaveGameSlot(slot int) error {
+	if slot < 0 {
+		return ErrSlot
+	}
+	r.saveLock.Lock()
+	defer r.saveLock.Unlock()
+	return r.saveGameSlot(slot, false)
+}
+
+// saveGameSlot saves the game state of the slot and queues its upload into a cloud storage.
+// With the onlyChanged flag the state will be uploaded only if it differs from
+// the last uploaded one.
+// Should be called under the saveLock.
+func (r *Room) saveGameSlot(slot int, onlyChanged bool) error {
+	if r.director == nil {
+		return ErrNotStarted
+	}
+	r.status.set(overlay.Saving, true)
+	defer r.status.set(overlay.Saving, false)
 	// TODO: Move to game view
-	if err := r.director.SaveGame(); err != nil {
+	if err := r.director.SaveGameSlot(slot); err != nil {
 		return err
 	}
-	if err := r.onlineStorage.Save(r.ID, r.director.GetHashPath()); err != nil {
+	queued, err := r.uploads.add(slotKey(r.ID, slot), r.director.GetSlotPath(slot), onlyChanged, r.uploadState)
+	if err != nil {
+		return err
+	}
+	// the owner gets the save in the other rooms of the game as well
+	if user := r.ownerProfile(); user != "" {
+		if _, err := r.uploads.add(userSlotKey(user, r.game.Name, slot), r.director.GetSlotPath(slot), onlyChanged, r.uploadState); err != nil {
+			return err
+		}
+	}
+	if queued {
+		r.saveThumbnail(slot)
+	}
+	if err := r.saveSRAM(onlyChanged); err != nil {
 		return err
 	}
-	log.Printf("success, cloud save")
+	r.event(Event{Type: EventSaved, Slot: slot})
 	return nil
 }
 
+// saveSRAM queues the upload of the game save RAM file (battery save) written
+// along with the states into a cloud storage.
+// Games without the save RAM are skipped.
+// Should be called under the saveLock.
+func (r *Room) saveSRAM(onlyChanged bool) error {
+	path := r.director.GetSRAMPath()
+	if !isGameOnLocal(path) {
+		return nil
+	}
+	_, err := r.uploads.add(sramKey(r.ID, r.gameHash), path, onlyChanged, r.uploadState)
+	return err
+}
+
+// startAutosave periodically saves the game until the room is closed.
+func (r *Room) startAutosave(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Done:
+			return
+		case <-ticker.C:
+			r.autosave()
+		}
+	}
+}
+
+// autosave saves the game uploading only changed states into the cloud storage.
+func (r *Room) autosave() {
+	r.saveLock.Lock()
+	defer r.saveLock.Unlock()
+
+	// the director may be closed already
+	select {
+	case <-r.Done:
+		return
+	default:
+	}
+	if err := r.saveGameSlot(0, true); err != nil {
+		log.Printf("warn: room %v autosave has failed, %v", r.ID, err)
+		return
+	}
+	r.lastAutosave.Store(time.Now())
+}
+
+// LastAutosave returns the time of the last successful autosave or zero time.
+func (r *Room) LastAutosave() time.Time {
+	t, _ := r.lastAutosave.Load().(time.Time)
+	return t
+}
+
+// fileHash returns the hash of the file content.
+func fileHash(path string) (hash [sha256.Size]byte, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return sha256.Sum256(data), nil
+}
+
 // saveOnlineRoomToLocal save online room to local.
+// The save is streamed to the disk until the room is closed,
+// the compressed and encrypted states are checked before that.
 // !Supports only one file of main save state.
 func (r *Room) saveOnlineRoomToLocal(roomID string, savePath string) error {
-	data, err := r.onlineStorage.Load(roomID)
+	if err := r.states.Load(r.ctx, r.onlineStorage, roomID, savePath); err != nil {
+		return err
+	}
+	log.Printf("successfully downloaded cloud save")
+	return nil
+}
+
+func (r *Room) LoadGame() error { return r.LoadGameSlot(0) }
+
+// running returns the emulator of the room which has started its game,
+// the emulator restarts change it.
+func (r *Room) running() (emulator.CloudEmulator, error) {
+	r.saveLock.Lock()
+	director := r.director
+	r.saveLock.Unlock()
+	if director == nil {
+		return nil, ErrNotStarted
+	}
+	return director, nil
+}
+
+// LoadGameSlot restores save state of the slot.
+// Missing local save files will be fetched from the cloud storage,
+// the saves of the owner's user come after the room ones.
+// The hardcore rooms don't load the states.
+func (r *Room) LoadGameSlot(slot int) error {
+	if slot < 0 {
+		return ErrSlot
+	}
+	if r.IsHardcore() {
+		return ErrHardcore
+	}
+	director, err := r.running()
 	if err != nil {
 		return err
 	}
-	// Save the data fetched from a cloud provider to the local server
-	if data != nil {
-		if err := ioutil.WriteFile(savePath, data, 0644); err != nil {
-			return err
+	if path := director.GetSlotPath(slot); !isGameOnLocal(path) {
+		err := r.saveOnlineRoomToLocal(slotKey(r.ID, slot), path)
+		if user := r.ownerProfile(); err != nil && user != "" {
+			err = r.saveOnlineRoomToLocal(userSlotKey(user, r.game.Name, slot), path)
+		}
+		if err != nil {
+			log.Printf("warn: room %s slot %d is not in the online storage, error %s", r.ID, slot, err)
 		}
-		log.Printf("successfully downloaded cloud save")
 	}
+	if err := director.LoadGameSlot(slot); err != nil {
+		return err
+	}
+	r.resetAchievements()
+	r.event(Event{Type: EventLoaded, Slot: slot})
 	return nil
 }
 
-func (r *Room) LoadGame() error { return r.director.LoadGame() }
+// GetSlots returns the list of save slots of the room with saved states.
+func (r *Room) GetSlots() []int {
+	director, err := r.running()
+	if err != nil {
+		return nil
+	}
+	return director.GetSlots()
+}
 
-func (r *Room) ToggleMultitap() error { return r.director.ToggleMultitap() }
+// slotKey returns the cloud storage key of the room save slot.
+// Slot 0 is the main save stored under the room ID.
+func slotKey(roomID string, slot int) string {
+	if slot == 0 {
+		return roomID
+	}
+	return fmt.Sprintf("%s.%d", roomID, slot)
+}
+
+// sramKey returns the cloud storage key of the game save RAM file of the room,
+// e.g. abc<...>293.<game sha1>.srm, or abc<...>293.srm of the games without the hash,
+// the .srm suffix is distinct from the slots.
+// The rooms of the game have their own keys so they won't overwrite each other.
+func sramKey(roomID string, hash string) string {
+	if hash == "" {
+		return roomID + ".srm"
+	}
+	return roomID + "." + hash + ".srm"
+}
 
-func (r *Room) IsEmpty() bool { return len(r.rtcSessions) == 0 }
+// loadSRAM fetches the game save RAM from the cloud storage.
+// The room save RAM of the older versions without the game hash
+// is fetched when the room has no other one.
+// The local files of the older versions are moved with MoveLegacyFiles.
+func (r *Room) loadSRAM(store nanoarch.Storage) error {
+	path := store.GetSRAMPath()
+	err := r.saveOnlineRoomToLocal(sramKey(r.ID, store.GameHash), path)
+	if err == nil || isGameOnLocal(path) || store.GameHash == "" {
+		return err
+	}
+	if key := sramKey(r.ID, ""); r.saveOnlineRoomToLocal(key, path) == nil && isGameOnLocal(path) {
+		log.Printf("Room %v has the legacy save RAM %v from the online storage", r.ID, key)
+		return nil
+	}
+	return err
+}
+
+func (r *Room) ToggleMultitap() error {
+	director, err := r.running()
+	if err != nil {
+		return err
+	}
+	return director.ToggleMultitap()
+}
+
+// SetPortDevice plugs the device of the core into the controller port.
+func (r *Room) SetPortDevice(port int, device uint32) error {
+	director, err := r.running()
+	if err != nil {
+		return err
+	}
+	return director.SetPortDevice(port, device)
+}
+
+// Ports returns the controller ports of the room emulator
+// with the devices supported by them, none before the game start.
+func (r *Room) Ports() []emulator.Port {
+	director, err := r.running()
+	if err != nil {
+		return nil
+	}
+	return director.GetPorts()
+}
+
+// SetCoreOption changes the core option (variable) of the room emulator.
+func (r *Room) SetCoreOption(key, value string) error {
+	director, err := r.running()
+	if err != nil {
+		return err
+	}
+	return director.SetCoreOption(key, value)
+}
+
+// SwapDisc changes the disc of the multi-disc game of the room.
+func (r *Room) SwapDisc(index int) error {
+	director, err := r.running()
+	if err != nil {
+		return err
+	}
+	return director.SwapDisc(index)
+}
+
+// Rewind jumps back in the game for some time.
+func (r *Room) Rewind(d time.Duration) error {
+	if r.IsHardcore() {
+		return ErrHardcore
+	}
+	r.saveLock.Lock()
+	director, fps := r.director, r.fps
+	r.saveLock.Unlock()
+	if director == nil {
+		return ErrNotStarted
+	}
+	if err := director.Rewind(int(math.Round(d.Seconds() * fps))); err != nil {
+		return err
+	}
+	r.resetAchievements()
+	return nil
+}
+
+func (r *Room) IsEmpty() bool { return r.rtcSessions.Len() == 0 }
 
 func (r *Room) IsRunningSessions() bool {
 	// If there is running session
-	for _, s := range r.rtcSessions {
-		if s.IsConnected() {
+	for _, s := range r.rtcSessions.snapshot() {
+		if isPresent(s) {
 			return true
 		}
 	}
@@ -437,6 +909,29 @@ func (r *Room) IsRunningSessions() bool {
 	return false
 }
 
+// isPresent tells if the peer is connected to the room
+// or is restarting its broken connection (i.e. network change)
+// and keeps its seat in the room until then.
+func isPresent(w Session) bool { return w.IsConnected() || w.IsRestarting() }
+
+// SessionIDs returns the IDs of the sessions of the room.
+func (r *Room) SessionIDs() (ids []string) {
+	r.rtcSessions.ForEach(func(w Session) { ids = append(ids, w.GetId()) })
+	return
+}
+
+// SessionsNum returns the number of players and spectators in the room.
+func (r *Room) SessionsNum() (players int, spectators int) {
+	r.rtcSessions.ForEach(func(w Session) {
+		if w.IsSpectator() {
+			spectators++
+		} else {
+			players++
+		}
+	})
+	return
+}
+
 func (r *Room) ToggleRecording(active bool, user string) {
 	if r.rec == nil {
 		return
@@ -1,6 +1,7 @@
 package room
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"hash/crc32"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -20,11 +22,16 @@ import (
 	"github.com/giongto35/cloud-game/v2/pkg/codec"
 	"github.com/giongto35/cloud-game/v2/pkg/config"
 	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
 	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/manager/remotehttp"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
 	"github.com/giongto35/cloud-game/v2/pkg/encoder"
 	"github.com/giongto35/cloud-game/v2/pkg/games"
 	"github.com/giongto35/cloud-game/v2/pkg/storage"
 	"github.com/giongto35/cloud-game/v2/pkg/thread"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"go.uber.org/goleak"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
 	"golang.org/x/image/math/fixed"
@@ -37,7 +44,7 @@ var (
 )
 
 type roomMock struct {
-	Room
+	*Room
 }
 
 type roomMockConfig struct {
@@ -175,6 +182,135 @@ func TestAllEmulatorRooms(t *testing.T) {
 	}
 }
 
+// Tests that the room can be closed simultaneously
+// from multiple places while peers still send their input.
+func TestRoomConcurrentClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	store, _ := storage.NewNoopCloudStorage()
+	inputs := make(chan nanoarch.InputEvent, 100)
+	room := newRoom("test_concurrent_close", inputs, store, worker.Config{})
+	emu := &emulatorMock{closed: make(chan struct{})}
+	room.director = emu
+
+	// the emulator input handler
+	go func() {
+		for range inputs {
+		}
+	}()
+
+	stop := make(chan struct{})
+	var feeders sync.WaitGroup
+	var peers []*webrtc.WebRTC
+	for i := 0; i < 3; i++ {
+		peer := &webrtc.WebRTC{ID: strconv.Itoa(i), InputChannel: make(chan []byte, 100)}
+		peers = append(peers, peer)
+		room.AddConnectionToRoom(peer, "")
+		feeders.Add(1)
+		go func() {
+			defer feeders.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case peer.InputChannel <- []byte{0x1, 0x0}:
+				}
+				room.sendInput(nanoarch.InputEvent{RawState: []byte{0x1, 0x0}, ConnID: peer.ID})
+			}
+		}()
+	}
+
+	var closers sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		closers.Add(1)
+		go func() {
+			defer closers.Done()
+			room.Close()
+		}()
+	}
+	closers.Wait()
+
+	select {
+	case <-room.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the room wasn't closed")
+	}
+	close(stop)
+	feeders.Wait()
+
+	// late session removal shouldn't send into the closed input
+	for _, peer := range peers {
+		room.RemoveSession(peer)
+	}
+
+	select {
+	case <-emu.closed:
+	default:
+		t.Errorf("the emulator wasn't closed")
+	}
+}
+
+// emulatorMock is a dummy room emulator (director).
+type emulatorMock struct {
+	closed chan struct{}
+	// the last applied cheats
+	cheats []emulator.Cheat
+	paused bool
+	speed  float64
+	// the viewport size
+	vw, vh int
+	crop   viewport.Crop
+	// the controller ports
+	ports []emulator.Port
+	// the memory watch of the achievements
+	memoryWatch func(mem []byte)
+	// the frame hook of the input delay
+	frameHook func(frame uint64)
+	runTime   time.Duration
+}
+
+func (e *emulatorMock) LoadMeta(string) (emulator.Metadata, error) {
+	return emulator.Metadata{}, nil
+}
+func (e *emulatorMock) Start()                             {}
+func (e *emulatorMock) SetViewport(w, h int)               { e.vw, e.vh = w, h }
+func (e *emulatorMock) SetCrop(crop viewport.Crop)         { e.crop = crop }
+func (e *emulatorMock) SaveGame() error                    { return nil }
+func (e *emulatorMock) LoadGame() error                    { return nil }
+func (e *emulatorMock) SaveGameSlot(int) error             { return nil }
+func (e *emulatorMock) LoadGameSlot(int) error             { return nil }
+func (e *emulatorMock) Snapshot() ([]byte, []byte, error)  { return nil, nil, nil }
+func (e *emulatorMock) Restore([]byte, []byte) error       { return nil }
+func (e *emulatorMock) GetHashPath() string                { return "" }
+func (e *emulatorMock) GetSlotPath(int) string             { return "" }
+func (e *emulatorMock) GetSRAMPath() string                { return "" }
+func (e *emulatorMock) GetSlots() []int                    { return nil }
+func (e *emulatorMock) Rewind(int) error                   { return nil }
+func (e *emulatorMock) Pause()                             { e.paused = true }
+func (e *emulatorMock) Resume()                            { e.paused = false }
+func (e *emulatorMock) SetSpeedMultiplier(m float64)       { e.speed = m }
+func (e *emulatorMock) Close()                             { close(e.closed) }
+func (e *emulatorMock) ToggleMultitap() error              { return nil }
+func (e *emulatorMock) SetCoreOption(string, string) error { return nil }
+func (e *emulatorMock) SwapDisc(int) error                 { return nil }
+func (e *emulatorMock) GetPorts() []emulator.Port          { return e.ports }
+func (e *emulatorMock) SetPortDevice(port int, device uint32) error {
+	if port < 0 || port >= len(e.ports) || !e.ports[port].Supports(device) {
+		return errors.New("unsupported device")
+	}
+	e.ports[port].Device = device
+	return nil
+}
+
+func (e *emulatorMock) Rumble() <-chan emulator.Rumble  { return nil }
+func (e *emulatorMock) WatchMemory(fn func(mem []byte)) { e.memoryWatch = fn }
+func (e *emulatorMock) OnFrame(fn func(frame uint64))   { e.frameHook = fn }
+func (e *emulatorMock) RunTime() time.Duration          { return e.runTime }
+func (e *emulatorMock) ApplyCheats(cheats []emulator.Cheat) error {
+	e.cheats = cheats
+	return nil
+}
+
 func dumpCanvas(f *image.RGBA, name string, caption string, path string) {
 	frame := *f
 
@@ -229,26 +365,19 @@ func getRoomMock(cfg roomMockConfig) roomMock {
 	conf.Encoder.Video.Codec = string(cfg.vCodec)
 
 	cloudStore, _ := storage.NewNoopCloudStorage()
-	room := NewRoom(cfg.roomName, cfg.game, "", false, cloudStore, conf)
+	room := NewRoom(cfg.roomName, cfg.game, "", false, cloudStore, nil, conf)
 
-	// loop-wait the room initialization
-	var init sync.WaitGroup
-	init.Add(1)
-	wasted := 0
-	go func() {
-		sleepDeltaMs := 10
-		for room.director == nil || room.vPipe == nil {
-			time.Sleep(time.Duration(sleepDeltaMs) * time.Millisecond)
-			wasted++
-			if wasted > 1000 {
-				break
-			}
-		}
-		init.Done()
-	}()
-	init.Wait()
+	// wait the room initialization, the video pipe goes a bit later
+	select {
+	case <-room.Ready():
+	case <-room.Done:
+		panic(room.Err())
+	}
+	for wasted := 0; room.vPipe == nil && wasted < 1000; wasted++ {
+		time.Sleep(10 * time.Millisecond)
+	}
 
-	return roomMock{*room}
+	return roomMock{room}
 }
 
 // fixEmulators makes absolute game paths in global GameList and passes GL context config.
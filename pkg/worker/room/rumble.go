@@ -0,0 +1,88 @@
+package room
+
+import (
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+)
+
+// rumbleInterval is the time of coalescing of the rumble changes of the game
+// into one message per motor, about a frame.
+const rumbleInterval = 16 * time.Millisecond
+
+// roomRumble sends the rumble of the controllers to the players of their ports.
+type roomRumble struct {
+	// send sends the encoded rumble event to the peer,
+	// the control channel of the peer if nil
+	send func(peer Session, data []byte) error
+}
+
+// startRumble sends the rumble changes of the game to the players
+// until the room or the changes are done.
+func (r *Room) startRumble(changes <-chan emulator.Rumble) {
+	if changes == nil {
+		return
+	}
+	var pending []emulator.Rumble
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-r.Done:
+			return
+		case rumble, ok := <-changes:
+			if !ok {
+				return
+			}
+			pending = coalesceRumble(pending, rumble)
+			if flush == nil {
+				flush = time.After(rumbleInterval)
+			}
+		case <-flush:
+			r.sendRumble(pending)
+			pending, flush = nil, nil
+		}
+	}
+}
+
+// coalesceRumble replaces the pending rumble of the same motor of the port.
+func coalesceRumble(pending []emulator.Rumble, rumble emulator.Rumble) []emulator.Rumble {
+	for i := range pending {
+		if pending[i].Port == rumble.Port && pending[i].Effect == rumble.Effect {
+			pending[i].Strength = rumble.Strength
+			return pending
+		}
+	}
+	return append(pending, rumble)
+}
+
+// sendRumble sends the rumble to the players of the ports,
+// the spectators and the disconnected players get nothing.
+func (r *Room) sendRumble(rumble []emulator.Rumble) {
+	send := r.rumble.send
+	if send == nil {
+		send = sendControl
+	}
+	for _, peer := range r.rtcSessions.snapshot() {
+		if peer.IsSpectator() {
+			continue
+		}
+		for _, e := range rumble {
+			if e.Port != peer.GetPlayerIndex() {
+				continue
+			}
+			out, err := (&api.ControlReply{Cmd: api.ControlRumble, Ok: true, Data: e}).To()
+			if err != nil {
+				continue
+			}
+			_ = send(peer, []byte(out))
+		}
+	}
+}
+
+func sendControl(peer Session, data []byte) error {
+	if !peer.IsConnected() {
+		return nil
+	}
+	return peer.SendControl(data)
+}
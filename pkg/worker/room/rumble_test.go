@@ -0,0 +1,75 @@
+package room
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestRoomRumble(t *testing.T) {
+	room, peers := newPlayersRoom(2)
+	defer room.Close()
+	spectator := &webrtc.WebRTC{ID: "s", Spectator: true}
+	_ = room.AddConnectionToRoom(spectator, "")
+	for i, peer := range peers {
+		if err := room.UpdatePlayerIndex(peer, i); err != nil {
+			t.Fatalf("couldn't give the player %v, %v", i, err)
+		}
+	}
+
+	var mu sync.Mutex
+	got := map[string][]emulator.Rumble{}
+	sent := make(chan struct{}, 10)
+	room.rumble.send = func(peer Session, data []byte) error {
+		var reply api.ControlReply
+		if err := reply.From(string(data)); err != nil || reply.Cmd != api.ControlRumble || reply.ID != 0 {
+			t.Errorf("wrong rumble message %s", data)
+		}
+		r, _ := reply.Data.(map[string]interface{})
+		mu.Lock()
+		got[peer.GetId()] = append(got[peer.GetId()], emulator.Rumble{
+			Port: int(r["port"].(float64)), Effect: r["effect"].(string), Strength: uint16(r["strength"].(float64)),
+		})
+		mu.Unlock()
+		sent <- struct{}{}
+		return nil
+	}
+
+	changes := make(chan emulator.Rumble, 10)
+	go room.startRumble(changes)
+	// a burst of the changes within one frame
+	changes <- emulator.Rumble{Port: 1, Effect: emulator.RumbleStrong, Strength: 100}
+	changes <- emulator.Rumble{Port: 1, Effect: emulator.RumbleWeak, Strength: 50}
+	changes <- emulator.Rumble{Port: 1, Effect: emulator.RumbleStrong, Strength: 0xffff}
+	// the port without the player
+	changes <- emulator.Rumble{Port: 3, Effect: emulator.RumbleStrong, Strength: 1}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sent:
+		case <-time.After(time.Second):
+			t.Fatalf("no rumble has been sent")
+		}
+	}
+	// the rest is dropped
+	time.Sleep(2 * rumbleInterval)
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []emulator.Rumble{
+		{Port: 1, Effect: emulator.RumbleStrong, Strength: 0xffff},
+		{Port: 1, Effect: emulator.RumbleWeak, Strength: 50},
+	}
+	if len(got) != 1 || len(got[peers[1].ID]) != len(expected) {
+		t.Fatalf("wrong rumble messages %+v", got)
+	}
+	for i, want := range expected {
+		if got[peers[1].ID][i] != want {
+			t.Errorf("wrong rumble %+v, expected %+v", got[peers[1].ID][i], want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package room
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// saveFileVersion is the version of the format of the save files.
+const saveFileVersion = 1
+
+// maxSaveFileSize is the limit of the unpacked save files.
+const maxSaveFileSize = 64 << 20
+
+var (
+	ErrSaveFileBroken  = errors.New("the save file is broken")
+	ErrSaveFileVersion = errors.New("unsupported version of the save file")
+	ErrSaveFileGame    = errors.New("the save file is of another game")
+	ErrSaveFileCore    = errors.New("the save file is of another emulator core")
+	ErrSaveFileSize    = errors.New("the save file is too large")
+)
+
+// SaveFile is the self-contained save of the game of a room,
+// the players move their progress between the servers or share it with the files.
+type SaveFile struct {
+	Version int `json:"version"`
+	// the name of the game, only for the players
+	Game string `json:"game"`
+	// the content hash of the game file
+	GameHash string `json:"game_hash"`
+	// the library of the emulator core (i.e. nestopia_libretro)
+	Core    string    `json:"core"`
+	Created time.Time `json:"created"`
+	// the save state of the main slot
+	State []byte `json:"state"`
+	// the save RAM (battery save) of the game, if any
+	SRAM []byte `json:"sram,omitempty"`
+}
+
+// encodeSaveFile packs the save file into gzipped JSON.
+func encodeSaveFile(file SaveFile) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(file); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeSaveFile unpacks the save file of the supported version.
+func decodeSaveFile(data []byte) (SaveFile, error) {
+	var file SaveFile
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return file, ErrSaveFileBroken
+	}
+	defer func() { _ = r.Close() }()
+	raw, err := ioutil.ReadAll(io.LimitReader(r, maxSaveFileSize+1))
+	if err != nil {
+		return file, ErrSaveFileBroken
+	}
+	if len(raw) > maxSaveFileSize {
+		return file, ErrSaveFileSize
+	}
+	if err := json.Unmarshal(raw, &file); err != nil || len(file.State) == 0 {
+		return SaveFile{}, ErrSaveFileBroken
+	}
+	if file.Version != saveFileVersion {
+		return SaveFile{}, fmt.Errorf("%w %v", ErrSaveFileVersion, file.Version)
+	}
+	return file, nil
+}
+
+// ExportSave returns the save file of the current state of the game of the room
+// with its save RAM, the saves of the room stay as they are.
+func (r *Room) ExportSave() ([]byte, error) {
+	r.saveLock.Lock()
+	director := r.director
+	r.saveLock.Unlock()
+	if director == nil {
+		return nil, ErrNotStarted
+	}
+	state, sram, err := director.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return encodeSaveFile(SaveFile{
+		Version:  saveFileVersion,
+		Game:     r.game.Name,
+		GameHash: r.gameHash,
+		Core:     r.core,
+		Created:  time.Now().UTC(),
+		State:    state,
+		SRAM:     sram,
+	})
+}
+
+// ImportSave loads the save file exported from a room of the same game
+// and emulator core into the room of the owner peer,
+// the save file replaces the main save of the room.
+func (r *Room) ImportSave(peerconnection Session, data []byte) error {
+	if !r.IsOwner(peerconnection) {
+		return ErrNotRoomOwner
+	}
+	if r.IsHardcore() {
+		return ErrHardcore
+	}
+	file, err := decodeSaveFile(data)
+	if err != nil {
+		return err
+	}
+
+	r.saveLock.Lock()
+	if r.director == nil {
+		r.saveLock.Unlock()
+		return ErrNotStarted
+	}
+	if file.GameHash != r.gameHash {
+		r.saveLock.Unlock()
+		return fmt.Errorf("%w, the save is for %v (%.8s), the room has %v (%.8s)",
+			ErrSaveFileGame, file.Game, file.GameHash, r.game.Name, r.gameHash)
+	}
+	if file.Core != r.core {
+		r.saveLock.Unlock()
+		return fmt.Errorf("%w, the save is for %v, the room has %v", ErrSaveFileCore, file.Core, r.core)
+	}
+	err = r.restoreSaveFile(file)
+	r.saveLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Room %v has imported the save of %v", r.ID, file.Created)
+	r.resetAchievements()
+	r.event(Event{Type: EventLoaded, Slot: 0})
+	return nil
+}
+
+// restoreSaveFile loads the state and the save RAM of the save file into the game,
+// they replace the main save, and queues their uploads.
+// Should be called under the saveLock, so the autosave doesn't overwrite them.
+func (r *Room) restoreSaveFile(file SaveFile) error {
+	sram := file.SRAM
+	if r.director.GetSRAMPath() == "" {
+		sram = nil
+	}
+	if err := r.director.Restore(file.State, sram); err != nil {
+		return err
+	}
+	if _, err := r.uploads.add(slotKey(r.ID, 0), r.director.GetSlotPath(0), false, r.uploadState); err != nil {
+		return err
+	}
+	if len(sram) > 0 {
+		path := r.director.GetSRAMPath()
+		if _, err := r.uploads.add(sramKey(r.ID, r.gameHash), path, false, r.uploadState); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package room
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newSaveFileRoom returns the room of the game and core with its owner.
+func newSaveFileRoom(t *testing.T, id string, hash string, core string, dir string) (*Room, *ramEmulatorMock, Session) {
+	room, emu := newProfileRoom(id, &cloudMock{files: map[string][]byte{}}, dir)
+	room.gameHash, room.core = hash, core
+	owner := newSessionMock("owner-"+id, false)
+	if err := room.AddConnectionToRoom(owner, ""); err != nil {
+		t.Fatal(err)
+	}
+	return room, emu, owner
+}
+
+// Tests that the save file exported from one room
+// brings the state of the game into another one.
+func TestSaveFileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_save_file")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	from, fromEmu, _ := newSaveFileRoom(t, "room1___Sushi", "hash", "nestopia_libretro", dir)
+	defer from.Close()
+	fromEmu.ram = []byte{0x42, 0x13}
+	save, err := from.ExportSave()
+	if err != nil {
+		t.Fatalf("couldn't export the save, %v", err)
+	}
+	file, err := decodeSaveFile(save)
+	if err != nil {
+		t.Fatalf("couldn't read the save file, %v", err)
+	}
+	if file.Game != "Sushi" || file.GameHash != "hash" || file.Core != "nestopia_libretro" ||
+		time.Since(file.Created) > time.Minute {
+		t.Errorf("wrong save file %+v", file)
+	}
+	if _, err := os.Stat(fromEmu.path); !os.IsNotExist(err) {
+		t.Errorf("the export has overwritten the main save, %v", err)
+	}
+
+	to, toEmu, owner := newSaveFileRoom(t, "room2___Sushi", "hash", "nestopia_libretro", dir)
+	defer to.Close()
+	if err := to.ImportSave(owner, save); err != nil {
+		t.Fatalf("couldn't import the save, %v", err)
+	}
+	if !reflect.DeepEqual(toEmu.ram, fromEmu.ram) {
+		t.Errorf("the room has got the state %v, expected %v", toEmu.ram, fromEmu.ram)
+	}
+	if err := to.uploads.flush(time.Second); err != nil {
+		t.Errorf("couldn't upload the imported save, %v", err)
+	}
+}
+
+// Tests that the save files of other games, cores and versions,
+// and the save files of the other peers are rejected.
+func TestSaveFileImportRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_save_reject")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	from, fromEmu, _ := newSaveFileRoom(t, "room1___Sushi", "hash", "nestopia_libretro", dir)
+	defer from.Close()
+	fromEmu.ram = []byte{0x42}
+	save, err := from.ExportSave()
+	if err != nil {
+		t.Fatal(err)
+	}
+	future, _ := encodeSaveFile(SaveFile{Version: saveFileVersion + 1, GameHash: "hash", Core: "nestopia_libretro",
+		State: []byte{1}})
+
+	tests := []struct {
+		name     string
+		room     string
+		hash     string
+		core     string
+		save     []byte
+		stranger bool
+		hardcore bool
+		err      error
+	}{
+		{name: "another game", room: "room2___Sushi", hash: "another", core: "nestopia_libretro",
+			save: save, err: ErrSaveFileGame},
+		{name: "another core", room: "room3___Sushi", hash: "hash", core: "fceumm_libretro",
+			save: save, err: ErrSaveFileCore},
+		{name: "not the owner", room: "room4___Sushi", hash: "hash", core: "nestopia_libretro",
+			save: save, stranger: true, err: ErrNotRoomOwner},
+		{name: "hardcore", room: "room5___Sushi", hash: "hash", core: "nestopia_libretro",
+			save: save, hardcore: true, err: ErrHardcore},
+		{name: "broken", room: "room6___Sushi", hash: "hash", core: "nestopia_libretro",
+			save: []byte("save"), err: ErrSaveFileBroken},
+		{name: "future version", room: "room7___Sushi", hash: "hash", core: "nestopia_libretro",
+			save: future, err: ErrSaveFileVersion},
+	}
+	for _, test := range tests {
+		room, emu, owner := newSaveFileRoom(t, test.room, test.hash, test.core, dir)
+		room.SetHardcore(test.hardcore)
+		peer := owner
+		if test.stranger {
+			peer = newSessionMock("stranger", false)
+			if err := room.AddConnectionToRoom(peer, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := room.ImportSave(peer, test.save); !errors.Is(err, test.err) {
+			t.Errorf("%v: got %v, expected %v", test.name, err, test.err)
+		}
+		if _, err := os.Stat(emu.path); !os.IsNotExist(err) || emu.ram != nil {
+			t.Errorf("%v: the rejected save has been loaded", test.name)
+		}
+		room.Close()
+	}
+}
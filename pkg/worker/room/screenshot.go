@@ -0,0 +1,128 @@
+package room
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+)
+
+// ErrNoFrame is returned when the room doesn't produce frames
+// (i.e. the emulator is paused or closed).
+var ErrNoFrame = errors.New("no frame")
+
+// screenshots hands out the video frames to the screenshot waiters.
+// The frames are pooled, so each of their holders retains them.
+type screenshots struct {
+	mu      sync.Mutex
+	waiters []chan screenshotFrame
+	// the last frame of the room
+	last screenshotFrame
+}
+
+// screenshotFrame is the frame with its pooled buffer (may be nil).
+type screenshotFrame struct {
+	img *image.RGBA
+	buf *media.Frame
+}
+
+func (s *screenshots) wait() chan screenshotFrame {
+	ch := make(chan screenshotFrame, 1)
+	s.mu.Lock()
+	s.waiters = append(s.waiters, ch)
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *screenshots) cancel(ch chan screenshotFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.waiters {
+		if w == ch {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return
+		}
+	}
+	// the frame has come already
+	select {
+	case frame := <-ch:
+		frame.buf.Release()
+	default:
+	}
+}
+
+// lastFrame returns the retained last frame.
+func (s *screenshots) lastFrame() screenshotFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last.buf.Retain()
+	return s.last
+}
+
+// tee gives the frame to all the waiters.
+// The frame should not be modified after that.
+func (s *screenshots) tee(frame *image.RGBA, buf *media.Frame) {
+	s.mu.Lock()
+	waiters := s.waiters
+	s.waiters = nil
+	s.last.buf.Release()
+	s.last = screenshotFrame{img: frame, buf: buf}
+	buf.Retain()
+	s.mu.Unlock()
+	for _, w := range waiters {
+		buf.Retain()
+		w <- screenshotFrame{img: frame, buf: buf}
+	}
+}
+
+// Screenshot returns the next video frame of the room in PNG.
+// The frames are already upright since the emulator
+// undoes the rotation of the game (gameMeta.Rotation) for the encoder.
+// The paused rooms return their last frame.
+// It fails with ErrNoFrame when there is no frame during the timeout.
+func (r *Room) Screenshot(timeout time.Duration) ([]byte, error) {
+	return r.screenshot(timeout, encodePNG)
+}
+
+// ScreenshotThumbnail returns the next video frame of the room
+// downscaled into the thumbnail in JPEG (see Screenshot),
+// it fits into the control replies.
+func (r *Room) ScreenshotThumbnail(timeout time.Duration) ([]byte, error) {
+	return r.screenshot(timeout, encodeThumbnail)
+}
+
+// screenshot returns the next video frame of the room with the encoder.
+func (r *Room) screenshot(timeout time.Duration, encode func(*image.RGBA) ([]byte, error)) ([]byte, error) {
+	if r.IsPaused() {
+		frame := r.screenshots.lastFrame()
+		defer frame.buf.Release()
+		if frame.img != nil {
+			return encode(frame.img)
+		}
+	}
+	ch := r.screenshots.wait()
+	select {
+	case frame := <-ch:
+		defer frame.buf.Release()
+		return encode(frame.img)
+	case <-time.After(timeout):
+		r.screenshots.cancel(ch)
+		return nil, ErrNoFrame
+	case <-r.Done:
+		r.screenshots.cancel(ch)
+		return nil, ErrNoFrame
+	}
+}
+
+func encodePNG(img *image.RGBA) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,106 @@
+package room
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	emuImage "github.com/giongto35/cloud-game/v2/pkg/emulator/image"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+// screenshot takes a screenshot of the frame streamed into the room.
+func screenshot(t *testing.T, frame *image.RGBA) image.Image {
+	room := newRoom("test_screenshot", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				room.screenshots.tee(frame, nil)
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	data, err := room.Screenshot(5 * time.Second)
+	if err != nil {
+		t.Fatalf("no screenshot, %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("bad PNG, %v", err)
+	}
+	return img
+}
+
+func TestScreenshot(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			frame.SetRGBA(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8(x ^ y), A: 0xff})
+		}
+	}
+
+	img := screenshot(t, frame)
+	if img.Bounds() != frame.Bounds() {
+		t.Fatalf("wrong screenshot size %v, expected %v", img.Bounds(), frame.Bounds())
+	}
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			if got, want := color.RGBAModel.Convert(img.At(x, y)), frame.RGBAAt(x, y); got != want {
+				t.Fatalf("wrong pixel (%v, %v) %v, expected %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// Tests that the screenshots of rotated games are upright.
+func TestScreenshotRotation(t *testing.T) {
+	// a 3x2 RGB565 frame of the game rotated 90° CCW
+	//  R G B
+	//  W K R
+	red, green, blue, white, black := []byte{0x00, 0xF8}, []byte{0xE0, 0x07}, []byte{0x1F, 0x00}, []byte{0xFF, 0xFF}, []byte{0, 0}
+	var raw []byte
+	for _, px := range [][]byte{red, green, blue, white, black, red} {
+		raw = append(raw, px...)
+	}
+	frame := emuImage.DrawRgbaImage(emuImage.Rgb565Row, emuImage.GetRotation(emuImage.Angle90),
+		emuImage.ScaleNearestNeighbour, false, 3, 2, 3, 2, raw, 2, 3, make([]byte, 2*3*4))
+
+	img := screenshot(t, frame)
+	if size := img.Bounds().Size(); size.X != 2 || size.Y != 3 {
+		t.Fatalf("wrong screenshot size %v, expected 2x3", size)
+	}
+	// upright
+	//  B R
+	//  G K
+	//  R W
+	r, g, b := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{G: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}
+	w, k := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, color.RGBA{A: 0xff}
+	want := [3][2]color.RGBA{{b, r}, {g, k}, {r, w}}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 2; x++ {
+			if got := color.RGBAModel.Convert(img.At(x, y)); got != want[y][x] {
+				t.Errorf("wrong pixel (%v, %v) %v, expected %v", x, y, got, want[y][x])
+			}
+		}
+	}
+}
+
+func TestScreenshotTimeout(t *testing.T) {
+	room := newRoom("test_screenshot_timeout", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	if _, err := room.Screenshot(10 * time.Millisecond); err != ErrNoFrame {
+		t.Errorf("expected no frame error, got %v", err)
+	}
+	if n := len(room.screenshots.waiters); n != 0 {
+		t.Errorf("%v screenshot waiters left", n)
+	}
+}
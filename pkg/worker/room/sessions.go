@@ -0,0 +1,133 @@
+package room
+
+import (
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// Session is a peer of the room, i.e. *webrtc.WebRTC,
+// so the room works (and is tested) without the real connections.
+type Session interface {
+	Sink
+
+	GetId() string
+	// the user of the peer between its connections
+	GetUser() string
+	SetUser(user string)
+	// the signed user ID of the peer, empty -- anonymous
+	GetProfile() string
+	SetProfile(profile string)
+	GetPlayerIndex() int
+	SetPlayerIndex(index int)
+	IsSpectator() bool
+	SetSpectator(spectator bool)
+	SetRoom(roomID string)
+
+	IsRestarting() bool
+	IsDone() bool
+	StopClient()
+
+	GetInputChannel() <-chan []byte
+	GetControlChannel() <-chan []byte
+	SendControl(data []byte) error
+	// OnControlOpen is called when the control channel of the peer opens,
+	// right away if it's open
+	OnControlOpen(fn func())
+	GetKeyMapping() webrtc.KeyMapping
+	SetKeyMapping(mapping webrtc.KeyMapping)
+
+	VideoCodecs() []codec.VideoCodec
+	SetVideoCodec(c codec.VideoCodec) error
+	OnKeyframeRequest(fn func())
+	// OnGone is called when the broken connection of the peer
+	// hasn't come back for the seat timeout
+	OnGone(fn func())
+	// OnStall is called when the media queue (video or audio) of the peer
+	// has been full for the threshold
+	OnStall(threshold time.Duration, fn func(kind string))
+	EstimatedBitrate() uint
+
+	Volume() int
+	SetVolume(volume int)
+	Muted() bool
+	SetMuted(muted bool)
+
+	Stats() webrtc.ConnectionStats
+	Egress() webrtc.Egress
+	VideoFrames() uint64
+	DroppedVideoFrames() uint64
+}
+
+// Sessions is a concurrency-safe list of the sessions (peers) of a room.
+//
+// The list is copy-on-write: every modification replaces the underlying slice,
+// so readers may iterate a snapshot without holding the lock, which keeps
+// the media fan-out loops lock-free while peers join or leave.
+type Sessions struct {
+	mu   sync.RWMutex
+	list []Session
+}
+
+func NewSessions() *Sessions { return &Sessions{list: []Session{}} }
+
+// Add appends a session into the list.
+func (s *Sessions) Add(w Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Session, len(s.list), len(s.list)+1)
+	copy(list, s.list)
+	s.list = append(list, w)
+}
+
+// Remove deletes a session with the same ID from the list.
+// Returns the removed session or nil if there was no such session.
+func (s *Sessions) Remove(w Session) Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, ss := range s.list {
+		if ss.GetId() == w.GetId() {
+			list := make([]Session, 0, len(s.list)-1)
+			list = append(list, s.list[:i]...)
+			s.list = append(list, s.list[i+1:]...)
+			return ss
+		}
+	}
+	return nil
+}
+
+// Has checks if the list contains a session with the same ID.
+func (s *Sessions) Has(w Session) bool {
+	for _, ss := range s.snapshot() {
+		if ss.GetId() == w.GetId() {
+			return true
+		}
+	}
+	return false
+}
+
+// ForEach calls the function for each session from the current snapshot of the list.
+// The function is called without the lock, so it is safe to modify the list from it.
+func (s *Sessions) ForEach(fn func(w Session)) {
+	for _, ss := range s.snapshot() {
+		fn(ss)
+	}
+}
+
+// Len returns the number of sessions in the list.
+func (s *Sessions) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.list)
+}
+
+// snapshot returns the current immutable list of sessions.
+func (s *Sessions) snapshot() []Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list
+}
@@ -0,0 +1,466 @@
+package room
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+	"go.uber.org/goleak"
+)
+
+func TestSessionsAddRemove(t *testing.T) {
+	s := NewSessions()
+	a, b, c := &webrtc.WebRTC{ID: "a"}, &webrtc.WebRTC{ID: "b"}, &webrtc.WebRTC{ID: "c"}
+
+	s.Add(a)
+	s.Add(b)
+	s.Add(c)
+	snapshot := s.snapshot()
+
+	if removed := s.Remove(&webrtc.WebRTC{ID: "b"}); removed != b {
+		t.Errorf("wrong session has been removed: %v", removed)
+	}
+	if removed := s.Remove(b); removed != nil {
+		t.Errorf("removed nonexistent session: %v", removed)
+	}
+	if s.Len() != 2 || !s.Has(a) || s.Has(b) || !s.Has(c) {
+		t.Errorf("wrong sessions after removal: %v", s.snapshot())
+	}
+	// old snapshots shouldn't change
+	if len(snapshot) != 3 || snapshot[1] != b {
+		t.Errorf("snapshot has been modified: %v", snapshot)
+	}
+}
+
+// Tests that concurrent peer joins and leaves
+// don't race with the media fan-out.
+// Should be run with the -race flag.
+func TestRoomConcurrentSessions(t *testing.T) {
+	room := newRoom("test_concurrent_sessions", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	room.audioEnc = &audioEncoderMock{}
+	// all the peers may be there at once
+	room.limits.players = 50
+
+	stop := make(chan struct{})
+	var frames sync.WaitGroup
+	frames.Add(1)
+	go func() {
+		defer frames.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				room.broadcastVideo(encoder.OutFrame{Data: []byte{0x1}}, layerHigh)
+				room.encodeAudio(media.Samples{0x1}, 0)
+				_ = room.IsRunningSessions()
+			}
+		}
+	}()
+
+	var peers sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		peers.Add(1)
+		go func(id string) {
+			defer peers.Done()
+			peer := &webrtc.WebRTC{ID: id, InputChannel: make(chan []byte, 1)}
+			room.AddConnectionToRoom(peer, "")
+			if !room.IsPCInRoom(peer) {
+				t.Errorf("peer %v is not in the room", id)
+			}
+			room.RemoveSession(peer)
+			close(peer.InputChannel)
+		}(strconv.Itoa(i))
+	}
+	peers.Wait()
+	close(stop)
+	frames.Wait()
+
+	if !room.IsEmpty() {
+		t.Errorf("room should be empty, but it has %v sessions", room.rtcSessions.Len())
+	}
+}
+
+func TestSpectatorInput(t *testing.T) {
+	inputs := make(chan nanoarch.InputEvent, 100)
+	room := newRoom("test_spectator", inputs, nil, worker.Config{})
+	defer room.Close()
+
+	spectator := &webrtc.WebRTC{ID: "spectator", InputChannel: make(chan []byte, 10), Spectator: true}
+	player := &webrtc.WebRTC{ID: "player", InputChannel: make(chan []byte, 10)}
+	room.AddConnectionToRoom(spectator, "")
+	room.AddConnectionToRoom(player, "")
+
+	if players, spectators := room.SessionsNum(); players != 1 || spectators != 1 {
+		t.Errorf("expected 1 player and 1 spectator, got %v and %v", players, spectators)
+	}
+	if err := room.UpdatePlayerIndex(spectator, 1); err != ErrSpectator {
+		t.Errorf("spectator player index update should fail, got %v", err)
+	}
+	if err := room.UpdatePlayerIndex(player, 1); err != nil {
+		t.Errorf("player index update has failed, %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		spectator.InputChannel <- []byte{0x1, 0x0}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := len(spectator.InputChannel); n != 5 {
+		t.Errorf("spectator input was read (%v left)", n)
+	}
+
+	room.RemoveSession(spectator)
+	if n := len(inputs); n != 0 {
+		t.Errorf("spectator input has reached the emulator (%v events)", n)
+	}
+}
+
+// sessionMock is a peer of the room without the connection,
+// its connectivity and media channels are controlled by the tests.
+type sessionMock struct {
+	mu        sync.Mutex
+	id, user  string
+	profile   string
+	mapping   webrtc.KeyMapping
+	room      string
+	player    int
+	spectator bool
+	connected bool
+	// blocked drops the media as the slow peer does
+	blocked  bool
+	video    int
+	audio    int
+	controls [][]byte
+	// closed keeps the control channel closed until openControl
+	closed   bool
+	opened   func()
+	keyframe func()
+	gone     func()
+	// the watch of the blocked media
+	stall   *media.SendWatch
+	stalled func(kind string)
+	volume  int
+	muted   bool
+	egress  webrtc.Egress
+	codecs  []codec.VideoCodec
+
+	input   chan []byte
+	control chan []byte
+}
+
+func newSessionMock(id string, spectator bool) *sessionMock {
+	return &sessionMock{
+		id:        id,
+		spectator: spectator,
+		connected: true,
+		volume:    webrtc.MaxVolume,
+		input:     make(chan []byte),
+		control:   make(chan []byte, 1),
+	}
+}
+
+func (s *sessionMock) GetId() string { return s.id }
+
+func (s *sessionMock) GetUser() string       { s.mu.Lock(); defer s.mu.Unlock(); return s.user }
+func (s *sessionMock) SetUser(user string)   { s.mu.Lock(); defer s.mu.Unlock(); s.user = user }
+func (s *sessionMock) GetProfile() string    { s.mu.Lock(); defer s.mu.Unlock(); return s.profile }
+func (s *sessionMock) SetProfile(p string)   { s.mu.Lock(); defer s.mu.Unlock(); s.profile = p }
+func (s *sessionMock) GetPlayerIndex() int   { s.mu.Lock(); defer s.mu.Unlock(); return s.player }
+func (s *sessionMock) SetPlayerIndex(i int)  { s.mu.Lock(); defer s.mu.Unlock(); s.player = i }
+func (s *sessionMock) IsSpectator() bool     { s.mu.Lock(); defer s.mu.Unlock(); return s.spectator }
+func (s *sessionMock) SetSpectator(sp bool)  { s.mu.Lock(); defer s.mu.Unlock(); s.spectator = sp }
+func (s *sessionMock) SetRoom(roomID string) { s.mu.Lock(); defer s.mu.Unlock(); s.room = roomID }
+func (s *sessionMock) roomID() string        { s.mu.Lock(); defer s.mu.Unlock(); return s.room }
+
+func (s *sessionMock) IsConnected() bool  { s.mu.Lock(); defer s.mu.Unlock(); return s.connected }
+func (s *sessionMock) IsRestarting() bool { return false }
+func (s *sessionMock) IsDone() bool       { return false }
+func (s *sessionMock) StopClient()        { s.setConnected(false) }
+
+// disappear drops the connection of the peer silently (i.e. the closed tab)
+// and ends its seat timeout.
+func (s *sessionMock) disappear() {
+	s.setConnected(false)
+	s.mu.Lock()
+	gone := s.gone
+	s.mu.Unlock()
+	if gone != nil {
+		gone()
+	}
+}
+
+func (s *sessionMock) setConnected(connected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = connected
+}
+
+func (s *sessionMock) GetInputChannel() <-chan []byte   { return s.input }
+func (s *sessionMock) GetControlChannel() <-chan []byte { return s.control }
+func (s *sessionMock) GetKeyMapping() webrtc.KeyMapping {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mapping
+}
+func (s *sessionMock) SetKeyMapping(mapping webrtc.KeyMapping) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mapping = mapping
+}
+
+func (s *sessionMock) SendControl(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.controls = append(s.controls, data)
+	return nil
+}
+
+func (s *sessionMock) OnControlOpen(fn func()) {
+	s.mu.Lock()
+	closed := s.closed
+	if closed {
+		s.opened = fn
+	}
+	s.mu.Unlock()
+	if !closed {
+		fn()
+	}
+}
+
+// openControl opens the closed control channel of the peer.
+func (s *sessionMock) openControl() {
+	s.mu.Lock()
+	s.closed = false
+	fn := s.opened
+	s.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+func (s *sessionMock) SendVideo(frame webrtc.WebFrame) bool {
+	if frame.Release != nil {
+		defer frame.Release()
+	}
+	return s.send("video", &s.video)
+}
+
+func (s *sessionMock) SendAudio(webrtc.AudioFrame) bool { return s.send("audio", &s.audio) }
+
+// send counts the media frame of the peer,
+// the frames of the blocked peer stall as in its full queue.
+func (s *sessionMock) send(kind string, n *int) bool {
+	s.mu.Lock()
+	if !s.blocked {
+		*n++
+		s.stall.Sent()
+		s.mu.Unlock()
+		return true
+	}
+	stalled := s.stall.Full()
+	fn := s.stalled
+	s.mu.Unlock()
+	if stalled && fn != nil {
+		fn(kind)
+	}
+	return false
+}
+
+func (s *sessionMock) OnStall(threshold time.Duration, fn func(kind string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stall, s.stalled = media.NewSendWatch(threshold), fn
+}
+
+// media returns the numbers of the video and audio frames of the peer.
+func (s *sessionMock) media() (video, audio int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.video, s.audio
+}
+
+func (s *sessionMock) VideoCodecs() []codec.VideoCodec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.codecs
+}
+func (s *sessionMock) SetVideoCodec(codec.VideoCodec) error { return nil }
+func (s *sessionMock) OnKeyframeRequest(fn func())          { s.mu.Lock(); s.keyframe = fn; s.mu.Unlock() }
+func (s *sessionMock) OnGone(fn func())                     { s.mu.Lock(); s.gone = fn; s.mu.Unlock() }
+func (s *sessionMock) EstimatedBitrate() uint               { return 0 }
+func (s *sessionMock) Volume() int                          { s.mu.Lock(); defer s.mu.Unlock(); return s.volume }
+func (s *sessionMock) SetVolume(volume int)                 { s.mu.Lock(); defer s.mu.Unlock(); s.volume = volume }
+func (s *sessionMock) Muted() bool                          { s.mu.Lock(); defer s.mu.Unlock(); return s.muted }
+func (s *sessionMock) SetMuted(muted bool)                  { s.mu.Lock(); defer s.mu.Unlock(); s.muted = muted }
+func (s *sessionMock) Stats() webrtc.ConnectionStats        { return webrtc.ConnectionStats{} }
+func (s *sessionMock) Egress() webrtc.Egress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.egress
+}
+func (s *sessionMock) setEgress(e webrtc.Egress) {
+	s.mu.Lock()
+	s.egress = e
+	s.mu.Unlock()
+}
+func (s *sessionMock) VideoFrames() uint64        { return 0 }
+func (s *sessionMock) DroppedVideoFrames() uint64 { return 0 }
+
+// takeInput returns the next event the room has sent to the emulator.
+func takeInput(t *testing.T, inputs chan nanoarch.InputEvent) nanoarch.InputEvent {
+	t.Helper()
+	select {
+	case e := <-inputs:
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("no input event")
+	}
+	return nanoarch.InputEvent{}
+}
+
+// Tests that the peers joined the room get its ID, the ownership
+// and the keyframe requests, and the leaving peers release them.
+func TestRoomSessionJoinLeave(t *testing.T) {
+	inputs := make(chan nanoarch.InputEvent, 100)
+	room := newRoom("test_join", inputs, nil, worker.Config{})
+	defer room.Close()
+
+	first, spectator, second := newSessionMock("1", false), newSessionMock("s", true), newSessionMock("2", false)
+	for _, peer := range []*sessionMock{first, spectator, second} {
+		if err := room.AddConnectionToRoom(peer, ""); err != nil {
+			t.Fatalf("peer %v couldn't join, %v", peer.id, err)
+		}
+		if !room.IsPCInRoom(peer) || peer.roomID() != room.ID {
+			t.Errorf("peer %v is not in the room", peer.id)
+		}
+		if peer.keyframe == nil {
+			t.Errorf("peer %v can't request the keyframes", peer.id)
+		}
+	}
+	if players, spectators := room.SessionsNum(); players != 2 || spectators != 1 {
+		t.Errorf("wrong sessions %v/%v, expected 2/1", players, spectators)
+	}
+	if owner := room.Owner(); owner != first.id {
+		t.Errorf("wrong owner %v, expected %v", owner, first.id)
+	}
+
+	room.RemoveSession(first)
+	if room.IsPCInRoom(first) || first.roomID() != "" {
+		t.Errorf("the gone peer is still in the room")
+	}
+	if owner := room.Owner(); owner != second.id {
+		t.Errorf("wrong owner %v after the leave, expected %v", owner, second.id)
+	}
+	// the gone player releases its buttons
+	if e := takeInput(t, inputs); e.ConnID != first.id || !bytes.Equal(e.RawState, []byte{0xFF, 0xFF}) {
+		t.Errorf("wrong leave event %+v", e)
+	}
+
+	room.RemoveSession(spectator)
+	room.RemoveSession(second)
+	if !room.IsEmpty() {
+		t.Errorf("the room has %v sessions", room.rtcSessions.Len())
+	}
+}
+
+// Tests that the input of the connected players goes to the emulator
+// and the input handler of the disconnected ones stops.
+func TestRoomSessionInput(t *testing.T) {
+	inputs := make(chan nanoarch.InputEvent, 100)
+	room := newRoom("test_input", inputs, nil, worker.Config{})
+	defer room.Close()
+
+	player := newSessionMock("1", false)
+	player.player = 1
+	if err := room.AddConnectionToRoom(player, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	player.input <- []byte{0x1, 0x0}
+	if e := takeInput(t, inputs); e.ConnID != player.id || e.PlayerIdx != 1 || !bytes.Equal(e.RawState, []byte{0x1, 0x0}) {
+		t.Errorf("wrong input event %+v", e)
+	}
+
+	// the message of the disconnected peer ends its handler
+	player.setConnected(false)
+	player.input <- []byte{0x2, 0x0}
+	select {
+	case player.input <- []byte{0x3, 0x0}:
+		t.Errorf("the input of the disconnected peer is still read")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := len(inputs); n != 0 {
+		t.Errorf("the input of the disconnected peer has reached the emulator (%v events)", n)
+	}
+}
+
+// Tests that the media goes to the connected peers only
+// and the slow peers don't block the others.
+func TestRoomSessionFanOut(t *testing.T) {
+	room := newRoom("test_fan_out", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	room.audioEnc = &audioEncoderMock{}
+	room.audioConf = encoderConfig.Audio{Channels: 2, Frequency: 48000}
+
+	connected, slow, gone := newSessionMock("1", false), newSessionMock("2", false), newSessionMock("s", true)
+	slow.blocked = true
+	for _, peer := range []*sessionMock{connected, slow, gone} {
+		if err := room.AddConnectionToRoom(peer, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gone.setConnected(false)
+
+	for i := 0; i < 3; i++ {
+		room.broadcastVideo(encoder.OutFrame{Data: []byte{byte(i)}}, layerHigh)
+		room.encodeAudio(media.Samples{1000, -1000}, 0)
+	}
+	if video, audio := connected.media(); video != 3 || audio != 3 {
+		t.Errorf("wrong media of the peer %v/%v, expected 3/3", video, audio)
+	}
+	for _, peer := range []*sessionMock{slow, gone} {
+		if video, audio := peer.media(); video != 0 || audio != 0 {
+			t.Errorf("peer %v has got the media %v/%v", peer.id, video, audio)
+		}
+	}
+}
+
+// Tests that the closed room stops the input handlers of its peers.
+func TestRoomSessionClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	inputs := make(chan nanoarch.InputEvent, 100)
+	room := newRoom("test_session_close", inputs, nil, worker.Config{})
+	peers := []*sessionMock{newSessionMock("1", false), newSessionMock("2", false)}
+	for _, peer := range peers {
+		if err := room.AddConnectionToRoom(peer, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	room.Close()
+	select {
+	case <-room.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the room wasn't closed")
+	}
+	for _, peer := range peers {
+		select {
+		case peer.input <- []byte{0x1, 0x0}:
+			t.Errorf("the input of peer %v is read after the close", peer.id)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if _, ok := <-inputs; ok {
+		t.Errorf("the emulator input is still open")
+	}
+}
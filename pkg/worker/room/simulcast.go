@@ -0,0 +1,249 @@
+package room
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/filter"
+)
+
+// With the simulcast the room encodes its video twice: the high layer
+// of the full settings and the low layer of half the size and bitrate.
+// The slow peers get the low layer, so they don't drag the bitrate
+// of the shared video down for everyone. The peers switch the layers
+// on the keyframes of their new layer, so their video doesn't break.
+
+// videoLayer is the layer of the video of the room.
+type videoLayer int
+
+const (
+	layerHigh videoLayer = iota
+	layerLow
+)
+
+func (l videoLayer) String() string {
+	if l == layerLow {
+		return "low"
+	}
+	return "high"
+}
+
+const (
+	// layerInterval is the min time between the layer assignments
+	layerInterval = time.Second
+	// layerHysteresis is the share of the simulcast bitrate above it
+	// the peers of the low layer go back to the high one
+	layerHysteresis = 0.25
+)
+
+// peerLayers are the video layers of the room peers,
+// the peers without a layer get the high one.
+type peerLayers struct {
+	mu sync.Mutex
+	// the bandwidth estimate (kbit/s) of the peers of the low layer
+	threshold uint
+	// session ID -> the layer of the peer and the layer it switches to
+	current, next map[string]videoLayer
+	last          time.Time
+	now           func() time.Time
+}
+
+// newPeerLayers returns the layers of the simulcast config,
+// the threshold is half of the max bitrate by default.
+func newPeerLayers(conf encoderConfig.Video) *peerLayers {
+	threshold := conf.Simulcast.Bitrate
+	if threshold == 0 {
+		threshold = conf.Bitrate.Max / 2
+	}
+	return &peerLayers{
+		threshold: threshold,
+		current:   make(map[string]videoLayer),
+		next:      make(map[string]videoLayer),
+		now:       time.Now,
+	}
+}
+
+// due tells if the layers can be assigned now.
+func (l *peerLayers) due() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() && now.Sub(l.last) < layerInterval {
+		return false
+	}
+	l.last = now
+	return true
+}
+
+// assign picks the layer of the peer for its bandwidth estimate (kbit/s),
+// it returns the new layer if the peer should switch to it.
+// The peers go down below the threshold and back up above it
+// by layerHysteresis, the unknown (zero) estimates are ignored.
+func (l *peerLayers) assign(id string, kbps uint) (videoLayer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cur, want := l.current[id], l.targetOf(id)
+	next := want
+	switch {
+	case kbps == 0 || l.threshold == 0:
+	case kbps < l.threshold:
+		next = layerLow
+	case float64(kbps) >= float64(l.threshold)*(1+layerHysteresis):
+		next = layerHigh
+	}
+	if next == want {
+		return want, false
+	}
+	if next == cur {
+		delete(l.next, id)
+	} else {
+		l.next[id] = next
+	}
+	return next, next != cur
+}
+
+// target returns the layer of the peer after its switch.
+func (l *peerLayers) target(id string) videoLayer {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.targetOf(id)
+}
+
+func (l *peerLayers) targetOf(id string) videoLayer {
+	if next, ok := l.next[id]; ok {
+		return next
+	}
+	return l.current[id]
+}
+
+// send tells if the frame of the layer goes to the peer,
+// the peer switches to its new layer with the keyframe of the layer.
+func (l *peerLayers) send(id string, layer videoLayer, keyframe bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if next, ok := l.next[id]; ok && next == layer && keyframe {
+		delete(l.next, id)
+		if layer == layerHigh {
+			delete(l.current, id)
+		} else {
+			l.current[id] = layer
+		}
+	}
+	return l.current[id] == layer
+}
+
+// pending tells if the peers wait for the keyframes of the layers.
+func (l *peerLayers) pending() (high, low bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, layer := range l.next {
+		high, low = high || layer == layerHigh, low || layer == layerLow
+	}
+	return
+}
+
+// remove forgets the layer of the peer.
+func (l *peerLayers) remove(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.current, id)
+	delete(l.next, id)
+}
+
+// reset moves all the peers to the high layer right away.
+func (l *peerLayers) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = make(map[string]videoLayer)
+	l.next = make(map[string]videoLayer)
+}
+
+// lowVideo returns the encoder settings of the low layer of half the bitrate.
+func lowVideo(video encoderConfig.Video) encoderConfig.Video {
+	video.Bitrate.Min, video.Bitrate.Max = video.Bitrate.Min/2, video.Bitrate.Max/2
+	video.H264.Bitrate /= 2
+	video.Vpx.Bitrate /= 2
+	video.Vp9.Bitrate /= 2
+	video.Av1.Bitrate /= 2
+	return video
+}
+
+// lowSize returns the frame size of the low layer of the video of w x h.
+// Should be called under videoLock.
+func (r *Room) lowSize(w, h int) (int, int) {
+	w, h = scaledSize(w, h, r.videoScale)
+	return scaledSize(w, h, 0.5)
+}
+
+// newLowPipe makes the encoder pipe of the low layer of the room video of w x h,
+// nil without the simulcast or if its encoder has failed,
+// the peers of the low layer go back to the high one then.
+func (r *Room) newLowPipe(w, h int, video encoderConfig.Video) *encoder.VideoPipe {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	r.vPipeLow = nil
+	if !video.Simulcast.Enabled {
+		return nil
+	}
+	lw, lh := r.lowSize(w, h)
+	enc, err := newVideoEncoder(r.videoCodec, lw, lh, lowVideo(video))
+	if err != nil {
+		log.Printf("error: room %v, no low video layer of %vx%v, %v", r.ID, lw, lh, err)
+		r.layers.reset()
+		return nil
+	}
+	pipe := encoder.NewVideoPipe(enc, lw, lh)
+	if kbps := r.lowBitrate.current; kbps > 0 {
+		pipe.SetBitrate(kbps)
+	}
+	pipe.SetFilter(r.lowFilters())
+	r.watchPipeStalls(pipe)
+	r.vPipeLow = pipe
+	return pipe
+}
+
+// lowFilters returns the filters of the low layer pipe,
+// the video filters and the downscale to its size after them.
+// Should be called under videoLock.
+func (r *Room) lowFilters() filter.Chain {
+	lw, lh := r.lowSize(r.videoWidth, r.videoHeight)
+	return append(r.videoFilters[:len(r.videoFilters):len(r.videoFilters)], filter.NewDownscale(lw, lh))
+}
+
+// lowPipe returns the pipe of the low layer, nil without it.
+func (r *Room) lowPipe() *encoder.VideoPipe {
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	return r.vPipeLow
+}
+
+// assignLayers moves the peers between the video layers with their bandwidth,
+// the layers of the switching peers are asked for keyframes (rate-limited).
+func (r *Room) assignLayers() {
+	low := r.lowPipe()
+	if low == nil || !r.layers.due() {
+		return
+	}
+	r.rtcSessions.ForEach(func(webRTC Session) {
+		if !webRTC.IsConnected() {
+			return
+		}
+		if layer, ok := r.layers.assign(webRTC.GetId(), webRTC.EstimatedBitrate()); ok {
+			log.Printf("Room %v peer %v switches to the %v video layer", r.ID, webRTC.GetId(), layer)
+		}
+	})
+	toHigh, toLow := r.layers.pending()
+	if toLow {
+		low.ForceKeyframe()
+	}
+	if toHigh {
+		r.videoLock.Lock()
+		if r.vPipe != nil {
+			r.vPipe.ForceKeyframe()
+		}
+		r.videoLock.Unlock()
+	}
+}
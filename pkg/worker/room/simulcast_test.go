@@ -0,0 +1,164 @@
+package room
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+)
+
+func TestPeerLayersAssign(t *testing.T) {
+	var conf encoderConfig.Video
+	conf.Bitrate.Max = 4000
+	l := newPeerLayers(conf)
+
+	steps := []struct {
+		kbps    uint
+		layer   videoLayer
+		changed bool
+	}{
+		{kbps: 3000},
+		{kbps: 0},
+		// below half of the max bitrate
+		{kbps: 1500, layer: layerLow, changed: true},
+		{kbps: 1000, layer: layerLow},
+		// within the hysteresis (2000 * 1.25)
+		{kbps: 2400, layer: layerLow},
+		{kbps: 2500, layer: layerHigh},
+	}
+	for i, step := range steps {
+		layer, changed := l.assign("a", step.kbps)
+		if layer != step.layer || changed != step.changed {
+			t.Errorf("step %v (%v kbit/s): got %v (%v), expected %v (%v)", i, step.kbps, layer, changed, step.layer, step.changed)
+		}
+	}
+	// the peer has gone back before its switch
+	if high, low := l.pending(); high || low {
+		t.Errorf("wrong pending switches %v %v", high, low)
+	}
+}
+
+// Tests that the peers get only the frames of their layers
+// and switch the layers on their keyframes.
+func TestPeerLayersSend(t *testing.T) {
+	var conf encoderConfig.Video
+	conf.Simulcast.Bitrate = 1000
+	l := newPeerLayers(conf)
+
+	type frame struct {
+		layer    videoLayer
+		keyframe bool
+	}
+	// the fan-out of the frames of both layers
+	fanout := func(id string, frames ...frame) (got []frame) {
+		for _, f := range frames {
+			if l.send(id, f.layer, f.keyframe) {
+				got = append(got, f)
+			}
+		}
+		return
+	}
+	check := func(name string, got []frame, want ...frame) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%v: wrong frames %v, expected %v", name, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%v: wrong frames %v, expected %v", name, got, want)
+			}
+		}
+	}
+	high, highKf, low, lowKf := frame{layerHigh, false}, frame{layerHigh, true}, frame{layerLow, false}, frame{layerLow, true}
+
+	check("new peer", fanout("slow", highKf, lowKf, high, low), highKf, high)
+
+	l.assign("slow", 500)
+	l.assign("fast", 5000)
+	if toHigh, toLow := l.pending(); toHigh || !toLow {
+		t.Errorf("wrong pending switches %v %v", toHigh, toLow)
+	}
+	// the high layer until the keyframe of the low one
+	check("switch down", fanout("slow", high, low, high, low, lowKf, high, low), high, high, lowKf, low)
+	check("fast peer", fanout("fast", high, low, lowKf, highKf), high, highKf)
+	if l.target("slow") != layerLow || l.target("fast") != layerHigh {
+		t.Errorf("wrong layers %v %v", l.target("slow"), l.target("fast"))
+	}
+
+	l.assign("slow", 2000)
+	check("switch up", fanout("slow", low, high, lowKf, highKf, low, high), low, lowKf, highKf, high)
+
+	l.assign("slow", 500)
+	l.remove("slow")
+	check("removed peer", fanout("slow", lowKf, highKf), highKf)
+
+	l.assign("slow", 500)
+	fanout("slow", lowKf)
+	l.reset()
+	check("reset", fanout("slow", low, high), high)
+}
+
+func TestLowVideo(t *testing.T) {
+	video := testVideoConfig()
+	video.Bitrate.Min, video.Bitrate.Max, video.H264.Bitrate = 300, 4000, 2000
+	low := lowVideo(video)
+	if low.Bitrate.Min != 150 || low.Bitrate.Max != 2000 || low.H264.Bitrate != 1000 || low.Vpx.Bitrate != 600 ||
+		low.Vp9.Bitrate != 600 || low.Av1.Bitrate != 600 {
+		t.Errorf("wrong low layer settings %+v", low)
+	}
+	if low.Vpx.KeyframeInterval != video.Vpx.KeyframeInterval || low.H264.Crf != video.H264.Crf {
+		t.Errorf("the low layer has changed the other settings %+v", low)
+	}
+}
+
+// Tests that the room of the simulcast encodes the low layer of half the size.
+func TestRoomVideoSimulcast(t *testing.T) {
+	room := newRoom("test_simulcast", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	defer room.Close()
+	room.director = &emulatorMock{closed: make(chan struct{})}
+	frames := make(chan nanoarch.GameFrame)
+	room.imageChannel = frames
+	room.geometry = gameGeometry{meta: emulator.Metadata{BaseWidth: 64, BaseHeight: 48}}
+	room.initVideoFilter(nil, viewport.Viewport{Width: 64, Height: 48}, 64, 48, false)
+
+	conf := testVideoConfig()
+	conf.Simulcast.Enabled = true
+	ended := make(chan struct{})
+	go func() {
+		room.startVideo(64, 48, conf)
+		close(ended)
+	}()
+	defer func() {
+		close(frames)
+		<-ended
+	}()
+
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+	low := room.lowPipe()
+	if low == nil {
+		t.Fatalf("no low video layer")
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}:
+		case frame := <-low.Output:
+			w, h, ok := vp8Size(frame.Data)
+			frame.Buf.Release()
+			if !ok {
+				continue
+			}
+			if w != 32 || h != 24 {
+				t.Fatalf("wrong low layer size %vx%v, expected 32x24", w, h)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("no keyframes of the low layer")
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package room
+
+import (
+	"sync"
+
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// Sink is a consumer of the media of the room besides its peers,
+// i.e. the headless benchmarks. The peers (Session) are sinks too.
+// The sinks get the video of the main layer and the audio of the full volume,
+// they shouldn't block and should release the video frames they have taken.
+type Sink interface {
+	IsConnected() bool
+	SendVideo(frame webrtc.WebFrame) bool
+	SendAudio(frame webrtc.AudioFrame) bool
+}
+
+// sinks is the list of the media sinks of the room.
+type sinks struct {
+	mu   sync.RWMutex
+	list []Sink
+}
+
+func (s *sinks) add(sink Sink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, sink)
+}
+
+func (s *sinks) remove(sink Sink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, ss := range s.list {
+		if ss == sink {
+			s.list = append(s.list[:i:i], s.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// forEach calls the function for the connected sinks.
+func (s *sinks) forEach(fn func(sink Sink)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sink := range s.list {
+		if sink.IsConnected() {
+			fn(sink)
+		}
+	}
+}
+
+// AddSink attaches the media sink to the room.
+func (r *Room) AddSink(sink Sink) { r.sinks.add(sink) }
+
+// RemoveSink detaches the media sink from the room.
+func (r *Room) RemoveSink(sink Sink) { r.sinks.remove(sink) }
+
+// sendVideo sends the encoded frame to the sink,
+// the sink releases the frame after its write.
+func sendVideo(sink Sink, frame encoder.OutFrame) {
+	frame.Buf.Retain()
+	if !sink.SendVideo(webrtc.WebFrame{Data: frame.Data, Duration: frame.Duration, Timestamp: frame.Timestamp,
+		Release: frame.Buf.Releaser()}) {
+		frame.Buf.Release()
+	}
+}
@@ -0,0 +1,58 @@
+package room
+
+import (
+	"testing"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+type sinkMock struct {
+	disconnected bool
+	video, audio int
+}
+
+func (s *sinkMock) IsConnected() bool { return !s.disconnected }
+
+func (s *sinkMock) SendVideo(frame webrtc.WebFrame) bool {
+	s.video++
+	if frame.Release != nil {
+		frame.Release()
+	}
+	return true
+}
+
+func (s *sinkMock) SendAudio(webrtc.AudioFrame) bool { s.audio++; return true }
+
+// Tests that the connected sinks of the room get
+// the main video layer and the audio.
+func TestRoomSinks(t *testing.T) {
+	room := newRoom("test_sinks", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	room.audioEnc = &audioEncoderMock{}
+	room.audioConf = encoderConfig.Audio{Channels: 2, Frequency: 48000}
+
+	sink, gone, disconnected := &sinkMock{}, &sinkMock{}, &sinkMock{disconnected: true}
+	for _, s := range []Sink{sink, gone, disconnected} {
+		room.AddSink(s)
+	}
+	room.RemoveSink(gone)
+
+	for i := 0; i < 3; i++ {
+		room.broadcastVideo(encoder.OutFrame{Data: []byte{byte(i)}}, layerHigh)
+		room.broadcastVideo(encoder.OutFrame{Data: []byte{byte(i)}}, layerLow)
+		room.encodeAudio(media.Samples{1000, -1000}, 0)
+	}
+	if sink.video != 3 || sink.audio != 3 {
+		t.Errorf("wrong media of the sink %v/%v, expected 3/3", sink.video, sink.audio)
+	}
+	for _, s := range []*sinkMock{gone, disconnected} {
+		if s.video != 0 || s.audio != 0 {
+			t.Errorf("the detached sink has got the media %v/%v", s.video, s.audio)
+		}
+	}
+}
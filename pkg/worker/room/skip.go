@@ -0,0 +1,81 @@
+package room
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// When the video encoder can't keep up with the emulator (i.e. the starved CPU
+// of the worker), the video frames are skipped instead of being encoded
+// in order, so the latency of the video stays within a couple of frames.
+// The latest frames are always kept, the audio goes on as is.
+
+// frameBacklog is the max number of the emulator frames waiting
+// for the video of the room, the older frames above it are skipped.
+const frameBacklog = 2
+
+const (
+	// skipSustained is the number of seconds in a row with the most of frames
+	// skipped after which the overload is logged
+	skipSustained = 3
+	// skipLogInterval is the number of seconds between the logs of the overload
+	skipLogInterval = 30
+)
+
+// frameSkip decides which video frames of the room are not encoded.
+//
+// The frames should be reported from the video goroutine,
+// the encoding time from the fan-out one.
+type frameSkip struct {
+	// the last encoding time of the frames, should be 64-bit aligned for atomic access
+	encode int64
+
+	now func() time.Time
+
+	// the frames and the skipped ones over the current second
+	frames, skipped int
+	since           time.Time
+	// the seconds of the overload in a row
+	overloaded int
+}
+
+func newFrameSkip() *frameSkip { return &frameSkip{now: time.Now} }
+
+// encoded registers the time of the last frame from its handoff to the encoder
+// to its output.
+func (s *frameSkip) encoded(d time.Duration) { atomic.StoreInt64(&s.encode, int64(d)) }
+
+// skip tells if the frame of the duration (the frame budget) should be skipped
+// with the number of the newer frames pending after it.
+// The frames above the backlog are skipped, and the frames with the newer ones
+// while the encoder is slower than the frames.
+func (s *frameSkip) skip(pending int, budget time.Duration) bool {
+	if pending > frameBacklog {
+		return true
+	}
+	return pending > 0 && budget > 0 && time.Duration(atomic.LoadInt64(&s.encode)) > budget
+}
+
+// count registers the frame, skipped or not, it returns the share of the
+// skipped frames of the last second when the overload should be logged.
+func (s *frameSkip) count(skipped bool) (rate float64, sustained bool) {
+	now := s.now()
+	if s.since.IsZero() {
+		s.since = now
+	}
+	s.frames++
+	if skipped {
+		s.skipped++
+	}
+	if now.Sub(s.since) < time.Second {
+		return 0, false
+	}
+	rate = float64(s.skipped) / float64(s.frames)
+	s.frames, s.skipped, s.since = 0, 0, now
+	if rate <= 0.5 {
+		s.overloaded = 0
+		return rate, false
+	}
+	s.overloaded++
+	return rate, s.overloaded == skipSustained || s.overloaded%skipLogInterval == 0
+}
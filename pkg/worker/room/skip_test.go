@@ -0,0 +1,139 @@
+package room
+
+import (
+	"encoding/binary"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+func TestFrameSkip(t *testing.T) {
+	budget := time.Second / 60
+	tests := []struct {
+		name    string
+		encode  time.Duration
+		pending int
+		budget  time.Duration
+		skip    bool
+	}{
+		{name: "no backlog", encode: time.Millisecond, pending: 0, budget: budget},
+		{name: "small backlog", encode: time.Millisecond, pending: frameBacklog, budget: budget},
+		{name: "backlog", encode: time.Millisecond, pending: frameBacklog + 1, budget: budget, skip: true},
+		{name: "slow encoder", encode: 2 * budget, pending: 1, budget: budget, skip: true},
+		// the latest frame is always encoded
+		{name: "slow encoder latest", encode: 2 * budget, pending: 0, budget: budget},
+		{name: "no budget", encode: 2 * budget, pending: 1},
+	}
+	for _, test := range tests {
+		s := newFrameSkip()
+		s.encoded(test.encode)
+		if skip := s.skip(test.pending, test.budget); skip != test.skip {
+			t.Errorf("%v: wrong skip %v, expected %v", test.name, skip, test.skip)
+		}
+	}
+}
+
+// Tests that the sustained skipping is reported once in a while.
+func TestFrameSkipSustained(t *testing.T) {
+	s := newFrameSkip()
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+
+	var reports []int
+	for sec := 0; sec < 2*skipLogInterval; sec++ {
+		for i := 0; i < 50; i++ {
+			// the overload stops for a second
+			skipped := sec != 10 && i%4 != 0
+			if _, ok := s.count(skipped); ok {
+				reports = append(reports, sec)
+			}
+			now = now.Add(time.Second / 50)
+		}
+	}
+	// the seconds are counted by their first frames,
+	// the overload goes from 0 and from 11 again
+	expected := []int{skipSustained, 11 + skipSustained, 11 + skipLogInterval}
+	if len(reports) != len(expected) {
+		t.Fatalf("wrong reports %v, expected %v", reports, expected)
+	}
+	for i := range expected {
+		if reports[i] != expected[i] {
+			t.Errorf("wrong reports %v, expected %v", reports, expected)
+		}
+	}
+}
+
+// slowEncoderMock is an encoder slower than the frames,
+// it measures the latency of the frames from their making
+// (the time in their first pixels) to the encoding end.
+type slowEncoderMock struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	encoded int
+	// the worst latency after the first frames
+	latency time.Duration
+}
+
+func (e *slowEncoderMock) Encode([]byte) []byte { return nil }
+func (e *slowEncoderMock) Shutdown() error      { return nil }
+
+func (e *slowEncoderMock) EncodeRGBA(img *image.RGBA) []byte {
+	time.Sleep(e.delay)
+	latency := time.Since(time.Unix(0, int64(binary.LittleEndian.Uint64(img.Pix))))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.encoded++
+	if e.encoded > 3 && latency > e.latency {
+		e.latency = latency
+	}
+	return []byte{0}
+}
+
+// Tests that the latency of the video of the overloaded encoder
+// is bounded to a couple of frames instead of growing.
+func TestRoomVideoOverload(t *testing.T) {
+	room := newRoom("test_overload", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	defer room.Close()
+	room.director = &emulatorMock{closed: make(chan struct{})}
+	frames := make(chan nanoarch.GameFrame, mediaBuffer)
+	room.imageChannel = frames
+
+	const interval, encodeTime = 10 * time.Millisecond, 25 * time.Millisecond
+	enc := &slowEncoderMock{delay: encodeTime}
+	ended := make(chan struct{})
+	go func() {
+		room.encodeVideo(enc, 16, 16, testVideoConfig())
+		close(ended)
+	}()
+
+	// the emulator of 100 fps drops the frames of the full channel
+	for i := 0; i < 100; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		binary.LittleEndian.PutUint64(img.Pix, uint64(time.Now().UnixNano()))
+		select {
+		case frames <- nanoarch.GameFrame{Data: img, Duration: interval}:
+		default:
+		}
+		time.Sleep(interval)
+	}
+	close(frames)
+	<-ended
+
+	enc.mu.Lock()
+	encoded, latency := enc.encoded, enc.latency
+	enc.mu.Unlock()
+	if encoded < 10 {
+		t.Fatalf("too few encoded frames %v", encoded)
+	}
+	if latency-encodeTime > 3*interval {
+		t.Errorf("the latency %v of the frames is above %v", latency, encodeTime+3*interval)
+	}
+	if stats := room.GetStats(); stats.SkippedFrames+stats.DroppedFrames == 0 {
+		t.Errorf("no skipped frames of the overloaded encoder")
+	}
+}
@@ -0,0 +1,164 @@
+package room
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+// memoryStorage is a cloud storage which keeps the files in memory.
+type memoryStorage struct {
+	files   map[string][]byte
+	uploads map[string]int
+}
+
+func (s *memoryStorage) Save(_ context.Context, key string, r io.Reader, _ int64) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.files[key] = data
+	s.uploads[key]++
+	return nil
+}
+
+func (s *memoryStorage) Load(_ context.Context, key string) (io.ReadCloser, error) {
+	if data, ok := s.files[key]; ok {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// sramEmulatorMock writes the save RAM along with its state.
+type sramEmulatorMock struct {
+	*stateEmulatorMock
+	sramPath string
+	sram     []byte
+}
+
+func (e *sramEmulatorMock) SaveGameSlot(slot int) error {
+	if e.sram != nil {
+		if err := ioutil.WriteFile(e.sramPath, e.sram, 0644); err != nil {
+			return err
+		}
+	}
+	return e.stateEmulatorMock.SaveGameSlot(slot)
+}
+func (e *sramEmulatorMock) GetSRAMPath() string { return e.sramPath }
+
+func TestSRAMCloudSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_sram")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cloud := &memoryStorage{files: map[string][]byte{}, uploads: map[string]int{}}
+	room := newRoom("test_sram", make(chan nanoarch.InputEvent, 100), cloud, worker.Config{})
+	store := nanoarch.Storage{Path: dir, MainSave: room.ID, GameHash: "a9993e36", Flat: true}
+	emu := &sramEmulatorMock{
+		stateEmulatorMock: &stateEmulatorMock{
+			emulatorMock: &emulatorMock{closed: make(chan struct{})},
+			path:         store.GetSavePath(),
+			state:        []byte{1, 2, 3},
+		},
+		sramPath: store.GetSRAMPath(),
+	}
+	room.director = emu
+	key := sramKey(room.ID, store.GameHash)
+	if key == slotKey(room.ID, 0) {
+		t.Fatalf("the save RAM key %v is the same as the main save one", key)
+	}
+	if other := sramKey("test_sram_2", store.GameHash); key == other {
+		t.Fatalf("the save RAM key %v is shared by the rooms of the game", key)
+	}
+
+	// no save RAM
+	if err := room.SaveGame(); err != nil {
+		t.Fatalf("couldn't save the game, %v", err)
+	}
+	flushUploads(t, room)
+	if _, ok := cloud.files[key]; ok {
+		t.Errorf("the save RAM is uploaded for the game without it")
+	}
+
+	emu.sram = []byte("battery save")
+	if err := room.SaveGame(); err != nil {
+		t.Fatalf("couldn't save the game, %v", err)
+	}
+	flushUploads(t, room)
+	if !bytes.Equal(cloud.files[key], emu.sram) {
+		t.Errorf("wrong uploaded save RAM %v", cloud.files[key])
+	}
+	room.autosave()
+	flushUploads(t, room)
+	if cloud.uploads[key] != 1 {
+		t.Errorf("unchanged save RAM is uploaded %v times", cloud.uploads[key])
+	}
+	emu.sram = []byte("battery save 2")
+	room.autosave()
+	flushUploads(t, room)
+	if cloud.uploads[key] != 2 {
+		t.Errorf("changed save RAM is not uploaded")
+	}
+
+	// a new worker without the local files
+	if err := os.Remove(store.GetSRAMPath()); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.saveOnlineRoomToLocal(key, store.GetSRAMPath()); err != nil {
+		t.Fatalf("couldn't download the save RAM, %v", err)
+	}
+	if data, err := ioutil.ReadFile(store.GetSRAMPath()); err != nil || !bytes.Equal(data, emu.sram) {
+		t.Errorf("wrong downloaded save RAM %v, %v", data, err)
+	}
+}
+
+func TestSRAMLegacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_sram_legacy")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cloud := &memoryStorage{files: map[string][]byte{}, uploads: map[string]int{}}
+	room := newRoom("test_sram_legacy", make(chan nanoarch.InputEvent, 100), cloud, worker.Config{})
+	store := nanoarch.Storage{Path: dir, MainSave: room.ID, GameHash: "a9993e36"}
+	path := store.GetSRAMPath()
+	if sramKey(room.ID, store.GameHash) != room.ID+".a9993e36.srm" || sramKey(room.ID, "") != room.ID+".srm" {
+		t.Fatalf("wrong save RAM keys %v", sramKey(room.ID, store.GameHash))
+	}
+	if err := os.MkdirAll(store.Dir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the save RAM of the game shared by the rooms isn't the one of the room
+	cloud.files["a9993e36.srm"] = []byte("game")
+	if err := room.loadSRAM(store); err == nil || isGameOnLocal(path) {
+		t.Errorf("the room has loaded the shared save RAM, %v", err)
+	}
+
+	// the room save RAM without the game hash in the cloud storage
+	cloud.files[sramKey(room.ID, "")] = []byte("cloud")
+	if err := room.loadSRAM(store); err != nil {
+		t.Errorf("couldn't load the legacy save RAM, %v", err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "cloud" {
+		t.Errorf("wrong downloaded save RAM %q, %v", data, err)
+	}
+
+	// the save RAM of the room wins
+	cloud.files[sramKey(room.ID, store.GameHash)] = []byte("room")
+	if err := room.loadSRAM(store); err != nil {
+		t.Errorf("couldn't load the save RAM, %v", err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "room" {
+		t.Errorf("wrong save RAM %q", data)
+	}
+}
@@ -0,0 +1,165 @@
+package room
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+)
+
+// The watch of the media sends of the room whose consumers have stopped taking them.
+// The video encoder which doesn't take the frames of the room is found
+// by the video loop, the fan-out which doesn't take the encoded frames by the encoder pipe,
+// and the peers which don't take their video or audio by their media queues.
+// Such sends are dropped instead of blocking the room, and the stalled peers
+// are disconnected or the stalled encoder pipe is restarted as the config tells.
+// The stuck goroutines of the replaced pipes are left as is.
+
+// the actions of the stalls
+const (
+	stallDrop       = "drop"
+	stallDisconnect = "disconnect"
+	stallRestart    = "restart"
+)
+
+// the boundaries of the media pipeline in the stall metrics
+const (
+	// the frames of the room into the video encoder
+	stallEncoder = "encoder"
+	// the encoded frames into the peers
+	stallWebrtc = "webrtc"
+	// the audio fan-out into the peers
+	stallAudio = "audio"
+)
+
+// stallWatch is the watch of the stalled media sends of the room.
+type stallWatch struct {
+	threshold time.Duration
+	// the actions of the stalled peers and encoders
+	peer    string
+	encoder string
+	// input watches the frames of the room the video encoder doesn't take,
+	// it's used by the video loop only
+	input *media.SendWatch
+	// 1 if the video loop should restart the encoder pipe
+	restart uint32
+}
+
+func newStallWatch(conf worker.Stalls) stallWatch {
+	return stallWatch{
+		threshold: conf.Threshold,
+		peer:      stallAction(conf.Peer, stallDisconnect),
+		encoder:   stallAction(conf.Encoder, stallRestart),
+		input:     media.NewSendWatch(conf.Threshold),
+	}
+}
+
+// stallAction returns the action of the config,
+// drop or the other action of the boundary.
+func stallAction(action string, other string) string {
+	switch action {
+	case "", stallDrop:
+		return stallDrop
+	case other:
+		return other
+	default:
+		log.Printf("warn: unknown stall action %v, fallback to %v", action, stallDrop)
+		return stallDrop
+	}
+}
+
+// watchPeerStalls watches the media queues of the peer.
+func (r *Room) watchPeerStalls(peer Session) {
+	peer.OnStall(r.stalls.threshold, func(kind string) { r.peerStalled(peer, kind) })
+}
+
+// peerStalled takes the action for the peer which hasn't taken its media.
+// It's called with the media sends.
+func (r *Room) peerStalled(peer Session, kind string) {
+	boundary := stallWebrtc
+	if kind == "audio" {
+		boundary = stallAudio
+	}
+	action := r.stalls.peer
+	metrics.stalls.WithLabelValues(boundary, action).Inc()
+	log.Printf("warn: room %v, the session %v hasn't taken its %v for %v, %v",
+		r.ID, peer.GetId(), kind, r.stalls.threshold, action)
+	if action == stallDisconnect {
+		// the kick stops the media of the peer
+		go r.kickFor(peer, api.KickedStalled)
+	}
+}
+
+// watchPipeStalls watches the encoded frames of the pipe.
+// Should be called before the start of the pipe.
+func (r *Room) watchPipeStalls(pipe *encoder.VideoPipe) {
+	pipe.OnStall(r.stalls.threshold, func() { r.encoderStalled(stallWebrtc) })
+}
+
+// encoderStalled takes the action for the video encoder pipe
+// which hasn't taken the frames or whose frames haven't been taken.
+// Only the encoder itself is restarted, the frames it has encoded
+// are dropped since the new pipe would stall on the same fan-out.
+func (r *Room) encoderStalled(boundary string) {
+	action := r.stalls.encoder
+	if boundary != stallEncoder {
+		action = stallDrop
+	}
+	metrics.stalls.WithLabelValues(boundary, action).Inc()
+	log.Printf("warn: room %v, the video encoder has stalled (%v) for %v, %v",
+		r.ID, boundary, r.stalls.threshold, action)
+	if action == stallRestart {
+		atomic.StoreUint32(&r.stalls.restart, 1)
+	}
+}
+
+// encoderTaken tells the watch if the video encoder has taken the last frame of the room.
+// It's called by the video loop.
+func (r *Room) encoderTaken(taken bool) {
+	if taken {
+		r.stalls.input.Sent()
+		return
+	}
+	if r.stalls.input.Full() {
+		r.encoderStalled(stallEncoder)
+	}
+}
+
+// restartStalledVideo returns the new encoder of the current video of the room
+// when its stalled pipe should be restarted, nil otherwise.
+func (r *Room) restartStalledVideo(video encoderConfig.Video) (enc encoder.Encoder, w, h int) {
+	if atomic.SwapUint32(&r.stalls.restart, 0) == 0 {
+		return nil, 0, 0
+	}
+	r.stalls.input.Sent()
+	r.videoLock.Lock()
+	defer r.videoLock.Unlock()
+	w, h = r.videoWidth, r.videoHeight
+	sw, sh := scaledSize(w, h, r.videoScale)
+	enc, err := newVideoEncoder(r.videoCodec, sw, sh, video)
+	if err != nil {
+		log.Printf("error: room %v couldn't restart the video encoder, %v", r.ID, err)
+		return nil, w, h
+	}
+	log.Printf("warn: room %v video encoder has been restarted", r.ID)
+	return enc, w, h
+}
+
+// stopStalled stops the stalled video pipes waiting no longer than endGrace.
+func (r *Room) stopStalled(stop func()) {
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(endGrace):
+		log.Printf("warn: room %v stalled video encoder hasn't stopped", r.ID)
+	}
+}
@@ -0,0 +1,170 @@
+package room
+
+import (
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/encoder/h264"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+const stallThreshold = 20 * time.Millisecond
+
+func newStallRoom(id string, peer, enc string) *Room {
+	conf := worker.Config{}
+	conf.Room.Stalls = worker.Stalls{Threshold: stallThreshold, Peer: peer, Encoder: enc}
+	room := newRoom(id, make(chan nanoarch.InputEvent, 100), nil, conf)
+	room.audioEnc = &audioEncoderMock{}
+	room.audioConf = encoderConfig.Audio{Channels: 2, Frequency: 48000}
+	return room
+}
+
+// Tests that the peers which don't take their video or audio
+// are disconnected (or lose their media) after the stall threshold.
+func TestStallPeer(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		audio  bool
+	}{
+		{name: "video, disconnect", action: stallDisconnect},
+		{name: "audio, disconnect", action: stallDisconnect, audio: true},
+		{name: "video, drop", action: stallDrop},
+		{name: "audio, drop", action: stallDrop, audio: true},
+	}
+	for _, test := range tests {
+		room := newStallRoom("test_stall_peer", test.action, "")
+		peer, healthy := newSessionMock("wedged", true), newSessionMock("healthy", true)
+		for _, p := range []*sessionMock{peer, healthy} {
+			if err := room.AddConnectionToRoom(p, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		peer.mu.Lock()
+		peer.blocked = true
+		peer.mu.Unlock()
+
+		start := time.Now()
+		var gone time.Duration
+		for deadline := start.Add(time.Second); time.Now().Before(deadline) && gone == 0; {
+			if test.audio {
+				room.encodeAudio(media.Samples{1000, -1000}, 0)
+			} else {
+				room.broadcastVideo(encoder.OutFrame{Data: []byte{0}, Keyframe: true}, layerHigh)
+			}
+			if !peer.IsConnected() {
+				gone = time.Since(start)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		switch {
+		case test.action == stallDrop && gone > 0:
+			t.Errorf("%v: the peer has been disconnected", test.name)
+		case test.action == stallDisconnect && gone == 0:
+			t.Errorf("%v: the wedged peer hasn't been disconnected", test.name)
+		case test.action == stallDisconnect && gone < stallThreshold:
+			t.Errorf("%v: the peer has been disconnected after %v, expected %v", test.name, gone, stallThreshold)
+		}
+		if !healthy.IsConnected() {
+			t.Errorf("%v: the healthy peer has been disconnected", test.name)
+		}
+		if video, audio := healthy.media(); video == 0 && audio == 0 {
+			t.Errorf("%v: the healthy peer hasn't got the media", test.name)
+		}
+		room.Close()
+	}
+}
+
+// wedgedEncoderMock doesn't return from the encoding until it's released.
+type wedgedEncoderMock struct{ release chan struct{} }
+
+func (e *wedgedEncoderMock) Encode([]byte) []byte { <-e.release; return []byte{0} }
+func (e *wedgedEncoderMock) Shutdown() error      { return nil }
+
+// wedgedSink doesn't return from the video sends until it's released.
+type wedgedSink struct{ release chan struct{} }
+
+func (s *wedgedSink) IsConnected() bool { return true }
+func (s *wedgedSink) SendVideo(frame webrtc.WebFrame) bool {
+	<-s.release
+	if frame.Release != nil {
+		frame.Release()
+	}
+	return true
+}
+func (s *wedgedSink) SendAudio(webrtc.AudioFrame) bool { return true }
+
+// Tests that the room restarts (or not) the video encoder pipe
+// which doesn't take the frames of the room, and drops the frames
+// of the encoder pipe whose frames aren't taken.
+func TestStallEncoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		// the encoder doesn't take the frames, otherwise the fan-out
+		wedged  bool
+		restart bool
+	}{
+		{name: "the encoder, restart", action: stallRestart, wedged: true, restart: true},
+		{name: "the fan-out, restart", action: stallRestart},
+		{name: "the encoder, drop", action: stallDrop, wedged: true},
+		{name: "the fan-out, drop", action: stallDrop},
+	}
+	newEncoder := newH264Encoder
+	defer func() { newH264Encoder = newEncoder }()
+	for _, test := range tests {
+		var restarted int64
+		newH264Encoder = func(int, int, h264.Options) (encoder.Encoder, error) {
+			atomic.CompareAndSwapInt64(&restarted, 0, time.Now().UnixNano())
+			return &keyframeEncoderMock{}, nil
+		}
+		room := newStallRoom("test_stall_encoder", "", test.action)
+		room.videoCodec = codec.H264
+		room.director = &emulatorMock{closed: make(chan struct{})}
+		release := make(chan struct{})
+		var enc encoder.Encoder = &keyframeEncoderMock{}
+		if test.wedged {
+			enc = &wedgedEncoderMock{release: release}
+		} else {
+			room.AddSink(&wedgedSink{release: release})
+		}
+		frames := make(chan nanoarch.GameFrame)
+		room.imageChannel = frames
+		ended := make(chan struct{})
+		go func() {
+			room.encodeVideo(enc, 16, 16, testVideoConfig())
+			close(ended)
+		}()
+
+		start := time.Now()
+		for deadline := start.Add(time.Second); time.Now().Before(deadline) && atomic.LoadInt64(&restarted) == 0; {
+			select {
+			case frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 16, 16))}:
+			case <-time.After(time.Second):
+				t.Fatalf("%v: the room doesn't take the frames", test.name)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		at := atomic.LoadInt64(&restarted)
+		switch d := time.Unix(0, at).Sub(start); {
+		case !test.restart && at != 0:
+			t.Errorf("%v: the encoder has been restarted", test.name)
+		case test.restart && at == 0:
+			t.Errorf("%v: the stalled encoder hasn't been restarted", test.name)
+		case test.restart && d < stallThreshold:
+			t.Errorf("%v: the encoder has been restarted after %v, expected %v", test.name, d, stallThreshold)
+		}
+		close(release)
+		close(frames)
+		<-ended
+		room.Close()
+	}
+}
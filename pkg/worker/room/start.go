@@ -0,0 +1,269 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	emulatorConfig "github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/recorder"
+)
+
+// The start errors of the rooms besides the load errors
+// of the emulators (emulator.ErrNoCore, emulator.ErrBadGame, emulator.ErrNoBios).
+var (
+	// ErrCrashed is the start error of the emulators which have crashed.
+	ErrCrashed = errors.New("the emulator has crashed")
+	// ErrStartTimeout is the start error of the rooms
+	// which haven't loaded their games in time.
+	ErrStartTimeout = errors.New("the game hasn't started in time")
+	// ErrVideo is the error of the rooms closed by the video encoders
+	// which keep failing after their restarts.
+	ErrVideo = errors.New("the video encoder has failed")
+)
+
+// defaultStartTimeout is how long the new rooms may load their games.
+const defaultStartTimeout = time.Minute
+
+// EmulatorFactory makes a new emulator of the room with its video and audio (see nanoarch.Init),
+// the video of the emulators without the image channel goes into the socket of the room.
+type EmulatorFactory func(roomID string, withImageChannel bool, inputChannel <-chan nanoarch.InputEvent,
+	store nanoarch.Storage, conf emulatorConfig.LibretroCoreConfig) (emulator.CloudEmulator, <-chan nanoarch.GameFrame, <-chan nanoarch.GameAudio)
+
+// initEmulator makes the libretro emulators of the rooms.
+func initEmulator(roomID string, withImageChannel bool, inputChannel <-chan nanoarch.InputEvent,
+	store nanoarch.Storage, conf emulatorConfig.LibretroCoreConfig) (emulator.CloudEmulator, <-chan nanoarch.GameFrame, <-chan nanoarch.GameAudio) {
+	emu, video, audio := nanoarch.Init(roomID, withImageChannel, inputChannel, store, conf)
+	return emu, video, audio
+}
+
+// Ready returns a channel which will be closed when the game of the room has started.
+// The rooms which fail to start are closed instead, Err tells why.
+func (r *Room) Ready() <-chan struct{} { return r.ready }
+
+// fail closes the room which couldn't start with the reason.
+// The error is kept only if the room hasn't been closed already.
+func (r *Room) fail(err error) {
+	r.closeOnce.Do(func() {
+		r.err = err
+		r.close()
+	})
+}
+
+// watchStart closes the room which hasn't started in time.
+func (r *Room) watchStart(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultStartTimeout
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-r.ready:
+	case <-r.Done:
+	case <-t.C:
+		log.Printf("error: room %v hasn't started in %v", r.ID, timeout)
+		r.fail(ErrStartTimeout)
+	}
+}
+
+// roomStorage returns the storage of the files of the room in the layout of the config.
+func roomStorage(roomID string, hash string, cfg worker.Config) nanoarch.Storage {
+	return nanoarch.Storage{
+		Path:     cfg.Emulator.Storage,
+		MainSave: roomID,
+		GameHash: hash,
+		Flat:     cfg.Emulator.IsFlatStorage(),
+	}
+}
+
+// recordingDir returns the dir of the recordings of the room,
+// the recordings without the folder go into the storage of the room.
+func recordingDir(folder string, store nanoarch.Storage) string {
+	if folder != "" {
+		return folder
+	}
+	return filepath.Join(store.Dir(), "recordings")
+}
+
+// start loads the game of the room and runs it until the room is closed.
+// The room which couldn't load the game is closed with the reason,
+// all that has been started for it is stopped with the room.
+func (r *Room) start(game games.GameMetadata, emuName string, inputChannel chan nanoarch.InputEvent,
+	cores CoreInstaller, recUser string, rec bool, cfg worker.Config) {
+	gamePath := filepath.Join(game.Base, game.Path)
+	if err := checkGame(gamePath); err != nil {
+		log.Printf("error: room %v has no game, %v", r.ID, err)
+		r.fail(err)
+		return
+	}
+
+	// the hash is from the library scan
+	hash := game.Hash
+	if hash == "" {
+		var err error
+		if hash, err = emulator.GameHash(gamePath); err != nil {
+			log.Printf("warn: room %v has no game hash, %v", r.ID, err)
+		}
+	}
+	r.gameHash = hash
+	store := roomStorage(r.ID, hash, cfg)
+	r.files = store
+	if n, err := store.MoveLegacyFiles(); err != nil {
+		log.Printf("warn: room %v couldn't move the files of the flat storage, %v", r.ID, err)
+	} else if n > 0 {
+		log.Printf("Room %v has moved %v files of the flat storage into %v", r.ID, n, store.Dir())
+	}
+
+	// Check room is on local or fetch from server
+	log.Printf("Check for %s in the online storage", r.ID)
+	if err := r.saveOnlineRoomToLocal(r.ID, store.GetSavePath()); err != nil {
+		log.Printf("warn: room %s is not in the online storage, error %s", r.ID, err)
+	}
+	// the save RAM should be on the disk before the emulator start
+	if err := r.loadSRAM(store); err != nil {
+		log.Printf("warn: room %s save RAM is not in the online storage, error %s", r.ID, err)
+	}
+
+	// the room closed meanwhile (i.e. the start timeout) won't load the game
+	select {
+	case <-r.Done:
+		return
+	default:
+	}
+
+	// If not then load room or create room from local.
+	log.Printf("Room %s started. GameName: %s, WithGame: %t", r.ID, game.Name, cfg.Encoder.WithoutGame)
+
+	// the video of the emulators without game goes over the socket
+	var imported <-chan nanoarch.GameFrame
+	if cfg.Encoder.WithoutGame {
+		video, err := r.importVideo(cfg.Encoder.Importer)
+		if err != nil {
+			log.Printf("error: room %v couldn't import the frames, %v", r.ID, err)
+			r.fail(err)
+			return
+		}
+		imported = video
+	}
+	spawn := func() (emulatorRun, error) {
+		return r.load(gamePath, emuName, store, inputChannel, imported, cores, cfg)
+	}
+	run, err := spawn()
+	if err != nil {
+		log.Printf("error: room %v couldn't load the game, %v", r.ID, err)
+		r.fail(err)
+		return
+	}
+
+	// the room closed while loading won't run the game
+	r.saveLock.Lock()
+	select {
+	case <-r.Done:
+		r.saveLock.Unlock()
+		log.Printf("warn: room %v has been closed before the game start", r.ID)
+		discard(run.director)
+		return
+	default:
+	}
+	r.imageChannel, r.audioChannel = r.emulator.video, r.emulator.audio
+	r.emulator.spawn = spawn
+	r.fps = run.meta.Fps
+	r.attach(run)
+	r.saveLock.Unlock()
+
+	gameMeta := run.meta
+	r.loadCheats(hash, cfg.Emulator.Cheats)
+	go r.loadAchievements(gamePath, cfg.Room.Achievements)
+
+	// set game frame size considering its orientation
+	r.geometry = gameGeometry{meta: gameMeta, conf: cfg.Emulator}
+	view, nativeW, nativeH := r.geometry.videoSize()
+
+	if cfg.Recording.Enabled {
+		r.rec = recorder.NewRecording(
+			recorder.Meta{UserName: recUser},
+			recorder.Options{
+				Dir:                   recordingDir(cfg.Recording.Folder, store),
+				Fps:                   gameMeta.Fps,
+				Frequency:             int(math.Round(gameMeta.AudioSampleRate)),
+				Game:                  game.Name,
+				ImageCompressionLevel: cfg.Recording.CompressLevel,
+				Name:                  cfg.Recording.Name,
+				Zip:                   cfg.Recording.Zip,
+			})
+		r.ToggleRecording(rec, recUser)
+	}
+
+	r.initVideoFilter(cfg.Encoder.Video.Filters, view, nativeW, nativeH, gameMeta.Rotation.IsEven)
+
+	// Spawn video and audio encoding for webRTC
+	// the encoders follow the frame rate of the region of the game
+	video := cfg.Encoder.Video
+	video.Fps = gameMeta.Fps
+	go r.startVideo(view.Width, view.Height, video)
+	go r.startAudio(gameMeta.AudioSampleRate, cfg.Encoder.Audio.Override(gameMeta.Audio).WithFps(gameMeta.Fps))
+	go r.startRumble(run.director.Rumble())
+	if cfg.Emulator.AutosaveInterval > 0 {
+		go r.startAutosave(time.Duration(cfg.Emulator.AutosaveInterval) * time.Second)
+	}
+	//go room.startVoice()
+	go r.watchEmulator(gameMeta.Fps)
+	r.event(Event{Type: EventStarted})
+	close(r.ready)
+	r.runEmulator(run)
+}
+
+// load installs the core and loads the game into a new emulator,
+// the emulators without game get the imported video.
+// The emulator crashes (panics) while loading are errors.
+func (r *Room) load(gamePath string, emuName string, store nanoarch.Storage, inputChannel chan nanoarch.InputEvent,
+	imported <-chan nanoarch.GameFrame, cores CoreInstaller, cfg worker.Config) (run emulatorRun, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%w, %v", ErrCrashed, e)
+		}
+	}()
+
+	if cores != nil {
+		if err := cores.Install(emuName); err != nil {
+			return run, fmt.Errorf("%w, couldn't get the %v emulator, %v", emulator.ErrNoCore, emuName, err)
+		}
+	}
+	libretroConfig := cfg.Emulator.GetLibretroCoreConfig(emuName)
+
+	run.ended = make(chan struct{})
+	if imported != nil {
+		// Run without game, image stream is communicated over a unix socket
+		emu, _, audioChannel := r.newEmulator(r.ID, false, inputChannel, store, libretroConfig)
+		run.director, run.video, run.audio, run.imported = emu, imported, audioChannel, true
+	} else {
+		// Run without game, image stream is communicated over image channel
+		emu, imageChannel, audioChannel := r.newEmulator(r.ID, true, inputChannel, store, libretroConfig)
+		run.director, run.video, run.audio = emu, imageChannel, audioChannel
+	}
+
+	if run.meta, err = run.director.LoadMeta(gamePath); err != nil {
+		run.director.Close()
+		return emulatorRun{}, err
+	}
+	return run, nil
+}
+
+// checkGame tells if the game file (or the archive of the game) exists.
+func checkGame(path string) error {
+	if archive, _ := emulator.SplitArchivePath(path); archive != "" {
+		path = archive
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%w, %v", emulator.ErrBadGame, err)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/codec"
+	"github.com/giongto35/cloud-game/v2/pkg/config/emulator"
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	emu "github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/emulatortest"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/core"
+	"github.com/giongto35/cloud-game/v2/pkg/games"
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+	"go.uber.org/goleak"
+)
+
+var testGame = games.GameMetadata{Name: "Super Mario Bros", Type: "nes", Path: "Super Mario Bros.nes"}
+
+// testStartConfig keeps the storage of the rooms in the temp dir.
+var testStartConfig = worker.Config{Emulator: emulator.Emulator{Storage: testTempDir}}
+
+// coresMock installs the cores with the error or panic.
+type coresMock struct {
+	err   error
+	crash bool
+}
+
+func (c coresMock) Install(string) error {
+	if c.crash {
+		panic("the core has crashed")
+	}
+	return c.err
+}
+
+func TestRoomStartNoGame(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	store, _ := storage.NewNoopCloudStorage()
+	game := games.GameMetadata{Name: "No game", Type: "nes", Base: testTempDir, Path: "no game.nes"}
+	room := NewRoom("test_start_no_game", game, "", false, store, nil, testStartConfig)
+	waitStartError(t, room, emu.ErrBadGame)
+}
+
+func TestRoomStartNoCore(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	store, _ := storage.NewNoopCloudStorage()
+	game := testGame
+	game.Base = whereIsGames
+	room := NewRoom("test_start_no_core", game, "", false, store, coresMock{err: errors.New("no core")}, testStartConfig)
+	waitStartError(t, room, emu.ErrNoCore)
+}
+
+func TestRoomStartCrash(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	store, _ := storage.NewNoopCloudStorage()
+	game := testGame
+	game.Base = whereIsGames
+	room := NewRoom("test_start_crash", game, "", false, store, coresMock{crash: true}, testStartConfig)
+	waitStartError(t, room, ErrCrashed)
+}
+
+// Tests that the room of the broken core removes the socket
+// of the frames and stops everything started for the core.
+func TestRoomStartBadCore(t *testing.T) {
+	arch, err := core.GetCoreExt()
+	if err != nil {
+		t.Skipf("no cores, %v", err)
+	}
+	dir, err := ioutil.TempDir("", "cloud_game_bad_core")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad_libretro"+arch.LibExt), []byte("not a lib"), 0644); err != nil {
+		t.Fatalf("couldn't make the core, %v", err)
+	}
+
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var conf worker.Config
+	conf.Emulator.Storage = dir
+	conf.Emulator.Libretro.Cores.Paths.Libs = dir
+	conf.Emulator.Libretro.Cores.List = map[string]emulator.LibretroCoreConfig{
+		"nes": {Lib: "bad_libretro", Roms: []string{"nes"}},
+	}
+	conf.Encoder.WithoutGame = true
+	store, _ := storage.NewNoopCloudStorage()
+	game := testGame
+	game.Base = whereIsGames
+	room := NewRoom("test_start_bad_core", game, "", false, store, nil, conf)
+	waitStartError(t, room, emu.ErrNoCore)
+
+	addr := fmt.Sprintf(SocketAddrTmpl, room.ID)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(addr); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("the socket file %v wasn't removed", addr)
+}
+
+func TestRoomStartTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	conf := testStartConfig
+	conf.Room.StartTimeout = 100 * time.Millisecond
+	game := testGame
+	game.Base = whereIsGames
+	// the saves of the room are never downloaded
+	room := NewRoom("test_start_timeout", game, "", false, &blockingStorage{}, nil, conf)
+	waitStartError(t, room, ErrStartTimeout)
+}
+
+// waitStartError waits for the room to fail with the error
+// and to shut down completely.
+func waitStartError(t *testing.T, room *Room, expected error) {
+	t.Helper()
+	select {
+	case <-room.Ready():
+		t.Fatalf("the room has started")
+	case <-room.Done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the room hasn't failed")
+	}
+	if err := room.Err(); !errors.Is(err, expected) {
+		t.Errorf("wrong start error %v, expected %v", err, expected)
+	}
+	select {
+	case <-room.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the room hasn't been closed")
+	}
+}
+
+// newFakeRoom starts the room of the test game with the fake emulators.
+func newFakeRoom(t *testing.T, id string, f *emulatortest.Factory, conf worker.Config) *Room {
+	t.Helper()
+	conf.Emulator.Storage = testTempDir
+	store, _ := storage.NewNoopCloudStorage()
+	return newCloudFakeRoom(t, id, f, store, conf)
+}
+
+// newCloudFakeRoom starts the room of the test game with the fake emulators
+// and the cloud storage, the storage of the config should be set.
+func newCloudFakeRoom(t *testing.T, id string, f *emulatortest.Factory, store storage.CloudStorage, conf worker.Config) *Room {
+	t.Helper()
+	conf.Encoder.Video = testVideoConfig()
+	conf.Encoder.Video.Codec = string(codec.VPX)
+	conf.Encoder.Audio = encoderConfig.Audio{Channels: 2, Frequency: 48000}
+	game := testGame
+	game.Base = whereIsGames
+	room := NewRoomWithEmulator(f.Init, id, game, "", false, store, nil, conf)
+	select {
+	case <-room.Ready():
+	case <-room.Closed():
+		t.Fatalf("the room hasn't started, %v", room.Err())
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the room hasn't started in time")
+	}
+	return room
+}
+
+// closeRoom closes the room and waits for its shutdown.
+func closeRoom(t *testing.T, room *Room) {
+	t.Helper()
+	room.Close()
+	select {
+	case <-room.Closed():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the room hasn't been closed")
+	}
+}
+
+// Tests that the room of the fake emulator sets the viewport of the game,
+// starts the encoders and passes the media and the input of its peers.
+func TestRoomStartFakeEmulator(t *testing.T) {
+	f := &emulatortest.Factory{Meta: emu.Metadata{AudioSampleRate: 48000, Fps: 60, BaseWidth: 256, BaseHeight: 224}}
+	var conf worker.Config
+	conf.Emulator.Scale = 2
+	room := newFakeRoom(t, "test_fake_start", f, conf)
+	defer closeRoom(t, room)
+
+	fake := f.Last()
+	if calls := fake.Calls(); len(calls) == 0 || calls[0] != "LoadMeta "+testGame.Path {
+		t.Errorf("the game hasn't been loaded, %v", calls)
+	}
+	if w, h := fake.Viewport(); w != 512 || h != 448 {
+		t.Errorf("wrong viewport %vx%v, expected 512x448", w, h)
+	}
+
+	peer := newSessionMock("1", false)
+	peer.player = 1
+	if err := room.AddConnectionToRoom(peer, ""); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		if video, audio := peer.media(); video > 0 && audio > 0 {
+			break
+		}
+		select {
+		case <-timeout:
+			video, audio := peer.media()
+			t.Fatalf("no media of the encoders (video %v, audio %v)", video, audio)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	room.videoLock.Lock()
+	w, h := room.videoWidth, room.videoHeight
+	room.videoLock.Unlock()
+	if w != 512 || h != 448 {
+		t.Errorf("wrong video %vx%v, expected 512x448", w, h)
+	}
+
+	peer.input <- []byte{0x1, 0x0}
+	for i := 0; len(fake.Inputs()) == 0; i++ {
+		if i == 100 {
+			t.Fatalf("the input hasn't reached the emulator")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e := fake.Inputs()[0]; e.ConnID != peer.id || e.PlayerIdx != 1 {
+		t.Errorf("wrong input event %+v", e)
+	}
+}
+
+// Tests that the room saves the game of the emulator before its close.
+func TestRoomFakeSaveOnClose(t *testing.T) {
+	f := &emulatortest.Factory{}
+	var conf worker.Config
+	conf.Emulator.AlwaysCloudSave = true
+	room := newFakeRoom(t, "test_fake_save", f, conf)
+	fake := f.Last()
+	defer func() { _ = os.Remove(fake.GetSlotPath(0)) }()
+	closeRoom(t, room)
+
+	calls := fake.Calls()
+	save, closed := -1, -1
+	for i, call := range calls {
+		switch call {
+		case "SaveGameSlot 0":
+			save = i
+		case "Close":
+			closed = i
+		}
+	}
+	if save < 0 || closed < save {
+		t.Errorf("the game hasn't been saved before the close, %v", calls)
+	}
+	if _, err := os.Stat(fake.GetSlotPath(0)); err != nil {
+		t.Errorf("no save, %v", err)
+	}
+	select {
+	case <-fake.Ended():
+	case <-time.After(5 * time.Second):
+		t.Errorf("the emulator hasn't stopped")
+	}
+}
+
+// Tests that the room of the game the emulator couldn't load is closed
+// with the load error and closes the emulator.
+func TestRoomStartFakeLoadError(t *testing.T) {
+	f := &emulatortest.Factory{LoadErr: emu.ErrBadGame}
+	store, _ := storage.NewNoopCloudStorage()
+	game := testGame
+	game.Base = whereIsGames
+	room := NewRoomWithEmulator(f.Init, "test_fake_load_error", game, "", false, store, nil, testStartConfig)
+	waitStartError(t, room, emu.ErrBadGame)
+	if fake := f.Last(); fake == nil || !fake.IsClosed() {
+		t.Errorf("the emulator hasn't been closed")
+	}
+}
+
+// Tests that the game commands of the starting room fail
+// until the game has loaded.
+func TestRoomNotStarted(t *testing.T) {
+	room := newRoom("test_not_started", nil, nil, worker.Config{})
+	defer room.Close()
+
+	commands := map[string]func() error{
+		"load":     room.LoadGame,
+		"multitap": room.ToggleMultitap,
+		"device":   func() error { return room.SetPortDevice(0, 1) },
+		"option":   func() error { return room.SetCoreOption("key", "value") },
+		"disc":     func() error { return room.SwapDisc(1) },
+		"rewind":   func() error { return room.Rewind(time.Second) },
+	}
+	for name, command := range commands {
+		if err := command(); err != ErrNotStarted {
+			t.Errorf("%v: got %v, expected %v", name, err, ErrNotStarted)
+		}
+	}
+	if room.GetSlots() != nil || room.Ports() != nil {
+		t.Errorf("the room has the slots and ports before the start")
+	}
+}
@@ -0,0 +1,291 @@
+package room
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/viewport"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// Stats contains the runtime stats of a room.
+type Stats struct {
+	// emulator frames per second
+	Fps float64
+	// the frame rate of the game reported by the core
+	TargetFps float64
+	// the average time of video frame encoding
+	EncodeLatency time.Duration
+	// the percentiles of the time of video frame encoding
+	EncodeTime Latency
+	Players    int
+	Spectators int
+	// the limits of the room, 0 spectators -- unlimited
+	MaxPlayers    int
+	MaxSpectators int
+	// the number of video frames dropped before encoding
+	DroppedFrames uint64
+	// the number of video frames skipped by the overloaded encoder
+	SkippedFrames uint64
+	// the number of video frames dropped by slow peers
+	PeerDroppedFrames uint64
+	// the number of the saves not uploaded into the cloud storage yet
+	PendingUploads int
+	// the number of the restarts of the hung or exited emulator
+	Recoveries int
+	// the worst round-trip time and packet loss (0-1) of the peers
+	MaxRTT        time.Duration
+	MaxPacketLoss float64
+	// the connection stats of the peers by the session ID
+	Connections map[string]webrtc.ConnectionStats
+	// the number of the input messages of the peers over the rate limit
+	// or malformed by the session ID
+	InputDropped map[string]uint64
+	// the media bytes sent by the room (including the sessions which have left)
+	// and by its sessions by the session ID
+	Egress        webrtc.Egress
+	SessionEgress map[string]webrtc.Egress
+	// the video bitrate limit (kbit/s) of the room over its bandwidth cap, 0 -- none
+	EgressLimit uint
+	// the time from the arrival of the player inputs to their use by the core
+	InputLatency Latency
+	// the time from the arrival of the player inputs
+	// to the sending of the first video frame with them
+	InputToSend Latency
+	// the scaling mode and the size of the video frames
+	Viewport viewport.Viewport
+	// the drift of the media time of the sent video from the sent audio
+	// (positive -- the video is ahead)
+	AVDrift time.Duration
+}
+
+// Latency contains the percentiles of a latency.
+type Latency struct {
+	P50, P95, P99 time.Duration
+}
+
+// latencySamples is the number of the last samples
+// the latency percentiles are computed from.
+const latencySamples = 512
+
+// latencyWindow keeps the last latency samples.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.samples) < latencySamples {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencySamples
+}
+
+// get returns the percentiles of the samples, zeros without them.
+func (w *latencyWindow) get() (l Latency) {
+	w.mu.Lock()
+	sorted := append([]time.Duration(nil), w.samples...)
+	w.mu.Unlock()
+	if len(sorted) == 0 {
+		return
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	// the nearest-rank percentiles
+	rank := func(p float64) time.Duration { return sorted[int(math.Ceil(p*float64(len(sorted))))-1] }
+	return Latency{P50: rank(.5), P95: rank(.95), P99: rank(.99)}
+}
+
+// addConnection adds the connection stats of the peer into the room stats.
+func (s *Stats) addConnection(id string, c webrtc.ConnectionStats) {
+	if c.Updated.IsZero() {
+		return
+	}
+	if s.Connections == nil {
+		s.Connections = make(map[string]webrtc.ConnectionStats)
+	}
+	s.Connections[id] = c
+	for _, track := range []webrtc.TrackStats{c.Video, c.Audio} {
+		if track.RTT > s.MaxRTT {
+			s.MaxRTT = track.RTT
+		}
+		if track.FractionLost > s.MaxPacketLoss {
+			s.MaxPacketLoss = track.FractionLost
+		}
+	}
+}
+
+// statsCollector gathers the video stats of a room
+// over (at least) one second windows.
+//
+// Frames and encoded frames should be reported from one goroutine each,
+// the stats can be read from any goroutine.
+type statsCollector struct {
+	// should be 64-bit aligned for atomic access
+	fps     uint64
+	latency int64
+	dropped uint64
+	skipped uint64
+	drift   int64
+	// the total time of the video encoding
+	encodeTime int64
+
+	now func() time.Time
+
+	frames      int
+	framesSince time.Time
+
+	encoded      int
+	latencySum   time.Duration
+	encodedSince time.Time
+
+	inputCore, inputSend latencyWindow
+	encodeTimes          latencyWindow
+
+	// the media times of the last sent video and audio frames
+	avMu                 sync.Mutex
+	lastVideo, lastAudio mediaStamp
+}
+
+// mediaStamp is the media time of a frame sent at the time.
+type mediaStamp struct {
+	ts time.Duration
+	at time.Time
+}
+
+func newStatsCollector() *statsCollector { return &statsCollector{now: time.Now} }
+
+// frame registers a new emulator frame.
+func (s *statsCollector) frame() {
+	now := s.now()
+	if s.framesSince.IsZero() {
+		s.framesSince = now
+		return
+	}
+	s.frames++
+	if elapsed := now.Sub(s.framesSince); elapsed >= time.Second {
+		atomic.StoreUint64(&s.fps, math.Float64bits(float64(s.frames)/elapsed.Seconds()))
+		s.frames, s.framesSince = 0, now
+	}
+}
+
+// drop registers a dropped frame.
+func (s *statsCollector) drop() { atomic.AddUint64(&s.dropped, 1) }
+
+// skip registers a skipped frame.
+func (s *statsCollector) skip() { atomic.AddUint64(&s.skipped, 1) }
+
+// encode registers a new encoded frame received at the start time.
+func (s *statsCollector) encode(start time.Time) {
+	now := s.now()
+	if s.encodedSince.IsZero() {
+		s.encodedSince = now
+	}
+	s.encoded++
+	s.latencySum += now.Sub(start)
+	s.encodeTimes.add(now.Sub(start))
+	atomic.AddInt64(&s.encodeTime, int64(now.Sub(start)))
+	if now.Sub(s.encodedSince) >= time.Second {
+		atomic.StoreInt64(&s.latency, int64(s.latencySum)/int64(s.encoded))
+		s.encoded, s.latencySum, s.encodedSince = 0, 0, now
+	}
+}
+
+// input registers the player input that has waited for the core.
+func (s *statsCollector) input(wait time.Duration) { s.inputCore.add(wait) }
+
+// sent registers the video frame sent with the player input arrived at the time
+// and returns the latency of the input.
+func (s *statsCollector) sent(arrived time.Time) time.Duration {
+	latency := s.now().Sub(arrived)
+	s.inputSend.add(latency)
+	return latency
+}
+
+// video registers the sent video frame of the media time.
+func (s *statsCollector) video(ts time.Duration) { s.stamp(&s.lastVideo, ts) }
+
+// audio registers the sent audio frame of the media time.
+func (s *statsCollector) audio(ts time.Duration) { s.stamp(&s.lastAudio, ts) }
+
+// stamp updates the last media time of the stream and the drift
+// between the media times of the streams minus the time between their frames.
+func (s *statsCollector) stamp(last *mediaStamp, ts time.Duration) {
+	s.avMu.Lock()
+	defer s.avMu.Unlock()
+	*last = mediaStamp{ts: ts, at: s.now()}
+	if s.lastVideo.at.IsZero() || s.lastAudio.at.IsZero() {
+		return
+	}
+	drift := s.lastVideo.ts - s.lastAudio.ts - s.lastVideo.at.Sub(s.lastAudio.at)
+	atomic.StoreInt64(&s.drift, int64(drift))
+}
+
+func (s *statsCollector) getDrift() time.Duration { return time.Duration(atomic.LoadInt64(&s.drift)) }
+
+func (s *statsCollector) getFps() float64 { return math.Float64frombits(atomic.LoadUint64(&s.fps)) }
+
+func (s *statsCollector) getLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.latency))
+}
+
+func (s *statsCollector) getDropped() uint64 { return atomic.LoadUint64(&s.dropped) }
+
+func (s *statsCollector) getSkipped() uint64 { return atomic.LoadUint64(&s.skipped) }
+
+// CPUTime returns the total time the room has spent on running its game
+// and encoding its video, it goes back with the restarted emulators.
+func (r *Room) CPUTime() time.Duration {
+	cpu := time.Duration(atomic.LoadInt64(&r.stats.encodeTime))
+	r.saveLock.Lock()
+	if r.director != nil {
+		cpu += r.director.RunTime()
+	}
+	r.saveLock.Unlock()
+	return cpu
+}
+
+// GetStats returns the current runtime stats of the room.
+func (r *Room) GetStats() Stats {
+	r.saveLock.Lock()
+	fps := r.fps
+	r.saveLock.Unlock()
+	stats := Stats{
+		Fps:           r.stats.getFps(),
+		TargetFps:     fps,
+		EncodeLatency: r.stats.getLatency(),
+		EncodeTime:    r.stats.encodeTimes.get(),
+		InputLatency:  r.stats.inputCore.get(),
+		InputToSend:   r.stats.inputSend.get(),
+		DroppedFrames: r.stats.getDropped(),
+		SkippedFrames: r.stats.getSkipped(),
+		AVDrift:       r.stats.getDrift(),
+		MaxPlayers:    r.MaxPlayers(),
+		MaxSpectators: r.MaxSpectators(),
+	}
+	stats.PendingUploads = r.PendingUploads()
+	stats.Recoveries = r.Recoveries()
+	stats.InputDropped = r.inputLimits.dropped()
+	stats.Egress, stats.SessionEgress = r.Egress()
+	stats.EgressLimit = r.egress.getLimit()
+	r.videoLock.Lock()
+	stats.Viewport = r.videoView
+	r.videoLock.Unlock()
+	r.rtcSessions.ForEach(func(w Session) {
+		if w.IsSpectator() {
+			stats.Spectators++
+		} else {
+			stats.Players++
+		}
+		stats.PeerDroppedFrames += w.DroppedVideoFrames()
+		stats.addConnection(w.GetId(), w.Stats())
+	})
+	return stats
+}
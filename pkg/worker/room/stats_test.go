@@ -0,0 +1,122 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestRoomStats(t *testing.T) {
+	room := newRoom("test_stats", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	room.AddConnectionToRoom(&webrtc.WebRTC{ID: "1", InputChannel: make(chan []byte, 1)}, "")
+	room.AddConnectionToRoom(&webrtc.WebRTC{ID: "2", InputChannel: make(chan []byte, 1), Spectator: true}, "")
+
+	// a synthetic 60 fps frame source with 5ms encoding
+	now := time.Unix(0, 0)
+	room.stats.now = func() time.Time { return now }
+	frameTime, encodeTime := time.Second/60, 5*time.Millisecond
+	for i := 0; i < 60*3; i++ {
+		room.stats.frame()
+		start := now
+		now = now.Add(encodeTime)
+		if i%10 == 0 {
+			room.stats.drop()
+		} else {
+			room.stats.encode(start)
+		}
+		now = now.Add(frameTime - encodeTime)
+	}
+
+	stats := room.GetStats()
+	if stats.Fps < 59 || stats.Fps > 61 {
+		t.Errorf("wrong fps %v", stats.Fps)
+	}
+	if stats.EncodeLatency < 4*time.Millisecond || stats.EncodeLatency > 6*time.Millisecond {
+		t.Errorf("wrong encode latency %v", stats.EncodeLatency)
+	}
+	if stats.EncodeTime.P95 != encodeTime {
+		t.Errorf("wrong encode time %+v", stats.EncodeTime)
+	}
+	if stats.DroppedFrames != 18 {
+		t.Errorf("wrong dropped frames %v", stats.DroppedFrames)
+	}
+	if stats.Players != 1 || stats.Spectators != 1 {
+		t.Errorf("wrong peers %v/%v", stats.Players, stats.Spectators)
+	}
+
+	// 162 encoded frames and the frames of the core
+	room.director = &emulatorMock{closed: make(chan struct{}), runTime: time.Second}
+	if cpu := room.CPUTime(); cpu != 162*encodeTime+time.Second {
+		t.Errorf("wrong CPU time %v", cpu)
+	}
+}
+
+func TestRoomInputLatency(t *testing.T) {
+	room := newRoom("test_input_latency", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+
+	if stats := room.GetStats(); stats.InputLatency != (Latency{}) || stats.InputToSend != (Latency{}) {
+		t.Errorf("the input latency %v/%v without inputs", stats.InputLatency, stats.InputToSend)
+	}
+
+	// the inputs of 1..100ms of waiting and 10ms more until their sending
+	now := time.Unix(0, 0)
+	room.stats.now = func() time.Time { return now }
+	for i := 100; i > 0; i-- {
+		arrived := now
+		wait := time.Duration(i) * time.Millisecond
+		room.stats.input(wait)
+		now = now.Add(wait + 10*time.Millisecond)
+		room.stats.sent(arrived)
+	}
+
+	stats := room.GetStats()
+	expected := Latency{P50: 50 * time.Millisecond, P95: 95 * time.Millisecond, P99: 99 * time.Millisecond}
+	if stats.InputLatency != expected {
+		t.Errorf("wrong input latency %+v, expected %+v", stats.InputLatency, expected)
+	}
+	expected = Latency{P50: 60 * time.Millisecond, P95: 105 * time.Millisecond, P99: 109 * time.Millisecond}
+	if stats.InputToSend != expected {
+		t.Errorf("wrong input to send latency %+v, expected %+v", stats.InputToSend, expected)
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	var w latencyWindow
+	w.add(time.Second)
+	if l := w.get(); l.P50 != time.Second || l.P99 != time.Second {
+		t.Errorf("wrong latency of one sample %+v", l)
+	}
+	// only the last samples count
+	for i := 0; i < latencySamples; i++ {
+		w.add(time.Millisecond)
+	}
+	if l := w.get(); l.P99 != time.Millisecond {
+		t.Errorf("the old samples stay in the window %+v", l)
+	}
+}
+
+func TestRoomConnectionStats(t *testing.T) {
+	var stats Stats
+	stats.addConnection("none", webrtc.ConnectionStats{})
+	stats.addConnection("1", webrtc.ConnectionStats{
+		Video:   webrtc.TrackStats{RTT: 40 * time.Millisecond, FractionLost: 0.01},
+		Audio:   webrtc.TrackStats{RTT: 45 * time.Millisecond},
+		Updated: time.Unix(1, 0),
+	})
+	stats.addConnection("2", webrtc.ConnectionStats{
+		Video:   webrtc.TrackStats{RTT: 20 * time.Millisecond, FractionLost: 0.2},
+		Updated: time.Unix(1, 0),
+	})
+
+	if len(stats.Connections) != 2 {
+		t.Errorf("expected the stats of 2 connections, got %v", len(stats.Connections))
+	}
+	if stats.MaxRTT != 45*time.Millisecond || stats.MaxPacketLoss != 0.2 {
+		t.Errorf("wrong aggregated stats %v, %v", stats.MaxRTT, stats.MaxPacketLoss)
+	}
+}
@@ -0,0 +1,83 @@
+package room
+
+import (
+	"image"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/overlay"
+)
+
+// The peers of the stopped rooms (paused, saving, etc.) would see
+// the frozen frame without any reason, so the video of such rooms goes on
+// with the status banner over their last frame at the low frame rate.
+// The banners go only when the game doesn't make frames,
+// so they stop by themselves with the live frames.
+
+// statusInterval is the interval of the frames of the status banners.
+var statusInterval = 500 * time.Millisecond
+
+// roomStatus is the set of the non-running states of the room.
+type roomStatus struct {
+	mu     sync.Mutex
+	states map[overlay.Status]bool
+}
+
+// set turns the state on or off.
+func (s *roomStatus) set(status overlay.Status, on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states == nil {
+		s.states = make(map[overlay.Status]bool)
+	}
+	if on {
+		s.states[status] = true
+	} else {
+		delete(s.states, status)
+	}
+}
+
+// current returns the top state of the room, false if it's running.
+func (s *roomStatus) current() (overlay.Status, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	top, ok := overlay.Status(0), false
+	for status := range s.states {
+		if !ok || status > top {
+			top, ok = status, true
+		}
+	}
+	return top, ok
+}
+
+// sendStatus pushes the frame of the status banner of the stopped room
+// over its last frame (or a black one) into the video pipes
+// with the media time of the banner.
+func (r *Room) sendStatus(pipe, low *encoder.VideoPipe, ts time.Duration) {
+	status, ok := r.status.current()
+	if !ok {
+		return
+	}
+	last := r.screenshots.lastFrame()
+	img := last.img
+	if img == nil {
+		r.videoLock.Lock()
+		img = image.NewRGBA(image.Rect(0, 0, r.videoWidth, r.videoHeight))
+		r.videoLock.Unlock()
+	}
+	// the banner is a new frame, so it isn't pooled
+	frame := overlay.Banner(img, status.String())
+	last.buf.Release()
+	for _, p := range []*encoder.VideoPipe{pipe, low} {
+		if p == nil {
+			continue
+		}
+		select {
+		case old := <-p.Input:
+			old.Buf.Release()
+		default:
+		}
+		p.Input <- encoder.InFrame{Image: frame, Duration: statusInterval, Time: time.Now(), Timestamp: ts}
+	}
+}
@@ -0,0 +1,108 @@
+package room
+
+import (
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/overlay"
+)
+
+func TestRoomStatus(t *testing.T) {
+	var s roomStatus
+	if status, ok := s.current(); ok {
+		t.Fatalf("the new room has the status %v", status)
+	}
+	s.set(overlay.Paused, true)
+	s.set(overlay.Saving, true)
+	if status, ok := s.current(); !ok || status != overlay.Saving {
+		t.Errorf("wrong status %v, expected %v", status, overlay.Saving)
+	}
+	s.set(overlay.Saving, false)
+	if status, ok := s.current(); !ok || status != overlay.Paused {
+		t.Errorf("wrong status %v, expected %v", status, overlay.Paused)
+	}
+	s.set(overlay.Paused, false)
+	if status, ok := s.current(); ok {
+		t.Errorf("the running room has the status %v", status)
+	}
+}
+
+// bannerEncoderMock counts the frames with the white pixels of the banners.
+type bannerEncoderMock struct {
+	mu      sync.Mutex
+	banners int
+}
+
+func (e *bannerEncoderMock) Encode([]byte) []byte { return nil }
+func (e *bannerEncoderMock) Shutdown() error      { return nil }
+
+func (e *bannerEncoderMock) EncodeRGBA(img *image.RGBA) []byte {
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] == 0xff {
+			e.mu.Lock()
+			e.banners++
+			e.mu.Unlock()
+			break
+		}
+	}
+	return []byte{0}
+}
+
+func (e *bannerEncoderMock) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.banners
+}
+
+// Tests that the paused room encodes the banners at the status rate
+// without the frames of the game and stops with the live frames.
+func TestRoomVideoStatus(t *testing.T) {
+	interval := statusInterval
+	statusInterval = 50 * time.Millisecond
+	defer func() { statusInterval = interval }()
+
+	room := newRoom("test_status", make(chan nanoarch.InputEvent, 1), nil, worker.Config{})
+	defer room.Close()
+	room.director = &emulatorMock{closed: make(chan struct{})}
+	frames := make(chan nanoarch.GameFrame)
+	room.imageChannel = frames
+
+	enc := &bannerEncoderMock{}
+	ended := make(chan struct{})
+	go func() {
+		room.encodeVideo(enc, 64, 48, testVideoConfig())
+		close(ended)
+	}()
+	defer func() {
+		close(frames)
+		<-ended
+	}()
+
+	frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48))}
+	time.Sleep(200 * time.Millisecond)
+	if n := enc.count(); n != 0 {
+		t.Fatalf("%v banners of the running room", n)
+	}
+
+	room.status.set(overlay.Paused, true)
+	const wait = 500 * time.Millisecond
+	time.Sleep(wait)
+	max := int(wait / statusInterval)
+	if n := enc.count(); n < max/2 || n > max+1 {
+		t.Fatalf("%v banners in %v, expected about %v", n, wait, max)
+	}
+
+	// the live frames of the game with the status
+	before := enc.count()
+	for i := 0; i < 30; i++ {
+		frames <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 64, 48)), Duration: 10 * time.Millisecond}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := enc.count() - before; n > 1 {
+		t.Errorf("%v banners with the live frames", n)
+	}
+}
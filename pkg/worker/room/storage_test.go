@@ -0,0 +1,87 @@
+package room
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	storageConfig "github.com/giongto35/cloud-game/v2/pkg/config/storage"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+)
+
+func TestS3StorageErrorPropagation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+	}))
+	defer server.Close()
+
+	_ = os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	_ = os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	defer func() {
+		_ = os.Unsetenv("AWS_ACCESS_KEY_ID")
+		_ = os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	}()
+
+	s3, err := storage.NewS3Client(storageConfig.S3{
+		Endpoint:  server.URL,
+		Bucket:    "test-bucket",
+		Region:    "us-east-1",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create S3 client, %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "cloud_game_s3")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	room := newRoom("test_s3", make(chan nanoarch.InputEvent, 100), s3, worker.Config{})
+	path := filepath.Join(dir, "test_s3.dat")
+	if err := room.saveOnlineRoomToLocal(room.ID, path); err == nil {
+		t.Errorf("expected the storage error")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the save shouldn't be written on error")
+	}
+}
+
+// blockingStorage never ends its downloads until they're cancelled.
+type blockingStorage struct{ storageMock }
+
+func (s *blockingStorage) Load(ctx context.Context, _ string) (io.ReadCloser, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestStorageDownloadCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_download")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	room := newRoom("test_download", make(chan nanoarch.InputEvent, 100), &blockingStorage{}, worker.Config{})
+	done := make(chan error, 1)
+	go func() { done <- room.saveOnlineRoomToLocal(room.ID, filepath.Join(dir, "test_download.dat")) }()
+	room.Close()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("wrong error of the download of the closed room, %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the download is not cancelled with the room")
+	}
+}
@@ -0,0 +1,115 @@
+package room
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"log"
+	"math"
+
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+)
+
+// The max size of the save state thumbnails,
+// the thumbnails keep the aspect ratio of the video.
+const (
+	thumbWidth   = 160
+	thumbHeight  = 120
+	thumbQuality = 75
+)
+
+var ErrNoThumbnail = errors.New("the save slot has no thumbnail")
+
+// thumbKey returns the cloud storage key of the thumbnail of the room save slot.
+func thumbKey(roomID string, slot int) string { return slotKey(roomID, slot) + "-thumb" }
+
+// thumbPath returns the path of the thumbnail next to the save state file.
+func thumbPath(statePath string) string { return statePath + "-thumb.jpg" }
+
+// saveThumbnail writes the thumbnail of the save slot
+// from the last video frame of the room and queues its upload,
+// the frames are already upright (see Screenshot).
+// The thumbnails are optional, so they don't fail the saves.
+// Should be called under the saveLock.
+func (r *Room) saveThumbnail(slot int) {
+	frame := r.screenshots.lastFrame()
+	defer frame.buf.Release()
+	if frame.img == nil {
+		return
+	}
+	data, err := encodeThumbnail(frame.img)
+	if err != nil {
+		log.Printf("warn: couldn't make the slot %v thumbnail of the room %v, %v", slot, r.ID, err)
+		return
+	}
+	path := thumbPath(r.director.GetSlotPath(slot))
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		log.Printf("warn: couldn't write the slot %v thumbnail of the room %v, %v", slot, r.ID, err)
+		return
+	}
+	if _, err := r.uploads.add(thumbKey(r.ID, slot), path, false, r.uploadFile); err != nil {
+		log.Printf("warn: couldn't upload the slot %v thumbnail of the room %v, %v", slot, r.ID, err)
+	}
+}
+
+// GetSaveThumbnail returns the thumbnail (JPEG) of the save slot.
+// Missing local thumbnails are fetched from the cloud storage.
+func (r *Room) GetSaveThumbnail(slot int) ([]byte, error) {
+	if r.director == nil {
+		return nil, ErrNotStarted
+	}
+	if data, err := ioutil.ReadFile(thumbPath(r.director.GetSlotPath(slot))); err == nil {
+		return data, nil
+	}
+	data, err := storage.LoadData(r.ctx, r.onlineStorage, thumbKey(r.ID, slot))
+	if err != nil || len(data) == 0 {
+		return nil, ErrNoThumbnail
+	}
+	return data, nil
+}
+
+// encodeThumbnail downscales the frame into the thumbnail in JPEG.
+func encodeThumbnail(frame *image.RGBA) ([]byte, error) {
+	img := thumbnail(frame)
+	if img == nil {
+		return nil, ErrNoFrame
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbnail downscales the frame to fit into the thumbnail size
+// with the average colors of the frame pixels (box filter).
+// The small frames are left as is.
+func thumbnail(frame *image.RGBA) *image.RGBA {
+	b := frame.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	scale := math.Min(1, math.Min(float64(thumbWidth)/float64(w), float64(thumbHeight)/float64(h)))
+	tw, th := int(math.Max(1, math.Round(float64(w)*scale))), int(math.Max(1, math.Round(float64(h)*scale)))
+
+	img := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy++ {
+				i := frame.PixOffset(b.Min.X+x0, b.Min.Y+sy)
+				for sx := x0; sx < x1; sx, i = sx+1, i+4 {
+					r, g, bl, n = r+int(frame.Pix[i]), g+int(frame.Pix[i+1]), bl+int(frame.Pix[i+2]), n+1
+				}
+			}
+			o := img.PixOffset(x, y)
+			img.Pix[o], img.Pix[o+1], img.Pix[o+2], img.Pix[o+3] = uint8(r/n), uint8(g/n), uint8(bl/n), 0xff
+		}
+	}
+	return img
+}
@@ -0,0 +1,133 @@
+package room
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+// halfFrame returns the frame with the left half red and the right half blue.
+func halfFrame(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 0xff, A: 0xff}
+			if x >= w/2 {
+				c = color.RGBA{B: 0xff, A: 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		tw, th int
+	}{
+		{w: 640, h: 480, tw: 160, th: 120},
+		{w: 320, h: 240, tw: 160, th: 120},
+		// the 8:7 aspect ratio of SNES
+		{w: 256, h: 224, tw: 137, th: 120},
+		// the rotated (vertical) games
+		{w: 224, h: 256, tw: 105, th: 120},
+		{w: 960, h: 240, tw: 160, th: 40},
+		// the small frames aren't upscaled
+		{w: 100, h: 50, tw: 100, th: 50},
+	}
+	for _, test := range tests {
+		img := thumbnail(halfFrame(test.w, test.h))
+		if b := img.Bounds(); b.Dx() != test.tw || b.Dy() != test.th {
+			t.Errorf("wrong thumbnail size %vx%v of %vx%v, expected %vx%v", b.Dx(), b.Dy(), test.w, test.h, test.tw, test.th)
+			continue
+		}
+		if left, right := img.RGBAAt(1, test.th/2), img.RGBAAt(test.tw-2, test.th/2); left.R != 0xff || left.B != 0 || right.B != 0xff || right.R != 0 {
+			t.Errorf("wrong thumbnail colors %v %v of %vx%v", left, right, test.w, test.h)
+		}
+	}
+
+	data, err := encodeThumbnail(halfFrame(256, 224))
+	if err != nil {
+		t.Fatalf("couldn't encode the thumbnail, %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("the thumbnail is not JPEG, %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 137 || b.Dy() != 120 {
+		t.Errorf("wrong JPEG thumbnail size %v", b)
+	}
+	if _, err := encodeThumbnail(image.NewRGBA(image.Rect(0, 0, 0, 0))); err != ErrNoFrame {
+		t.Errorf("encoded the empty frame, %v", err)
+	}
+}
+
+func TestThumbKey(t *testing.T) {
+	for slot, key := range map[int]string{0: "room-thumb", 2: "room.2-thumb"} {
+		if got := thumbKey("room", slot); got != key {
+			t.Errorf("wrong thumbnail key %v of the slot %v, expected %v", got, slot, key)
+		}
+	}
+	if path := thumbPath("/saves/room.dat"); path != "/saves/room.dat-thumb.jpg" {
+		t.Errorf("wrong thumbnail path %v", path)
+	}
+}
+
+func TestSaveThumbnail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_thumbnail")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := &storageMock{}
+	room := newRoom("test_thumbnail", make(chan nanoarch.InputEvent, 100), store, worker.Config{})
+	defer room.Close()
+	if _, err := room.GetSaveThumbnail(0); err != ErrNotStarted {
+		t.Errorf("got the thumbnail of the room without the game, %v", err)
+	}
+	emu := &stateEmulatorMock{
+		emulatorMock: &emulatorMock{closed: make(chan struct{})},
+		path:         filepath.Join(dir, "test_thumbnail.dat"),
+		state:        []byte{1, 2, 3},
+	}
+	room.director = emu
+
+	// no frames yet
+	if err := room.SaveGame(); err != nil {
+		t.Fatalf("the save without the thumbnail has failed, %v", err)
+	}
+	flushUploads(t, room)
+	if !reflect.DeepEqual(store.keys, []string{"test_thumbnail"}) {
+		t.Errorf("wrong uploads %v", store.keys)
+	}
+	if _, err := room.GetSaveThumbnail(0); err != ErrNoThumbnail {
+		t.Errorf("got the missing thumbnail, %v", err)
+	}
+
+	room.screenshots.tee(halfFrame(320, 240), nil)
+	if err := room.SaveGameSlot(2); err != nil {
+		t.Fatalf("couldn't save the game, %v", err)
+	}
+	flushUploads(t, room)
+	if !reflect.DeepEqual(store.keys, []string{"test_thumbnail", "test_thumbnail.2", "test_thumbnail.2-thumb"}) {
+		t.Errorf("wrong uploads %v", store.keys)
+	}
+	data, err := room.GetSaveThumbnail(2)
+	if err != nil {
+		t.Fatalf("no thumbnail, %v", err)
+	}
+	if img, err := jpeg.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != thumbWidth {
+		t.Errorf("wrong thumbnail, %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package room
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/janitor"
+)
+
+// uploadFlushTimeout is how long the closing rooms wait for their uploads.
+const uploadFlushTimeout = 30 * time.Second
+
+// the attempts of the failed uploads and the first pause between them,
+// it doubles with each attempt
+const (
+	uploadAttempts = 3
+	uploadBackoff  = time.Second
+)
+
+var ErrUploadTimeout = errors.New("the uploads haven't finished in time")
+
+// uploadFunc uploads the file with the key into the cloud storage.
+type uploadFunc func(ctx context.Context, key string, path string) error
+
+type upload struct {
+	key string
+	// the copy of the file made with the save,
+	// so the next saves don't change it during the upload
+	path string
+	hash [sha256.Size]byte
+	save uploadFunc
+}
+
+// uploadQueue uploads the saved files of the room into the cloud storage
+// in the background, so the saves only write them on the disk.
+// The pending uploads of the same key are coalesced into the last one.
+type uploadQueue struct {
+	mu      sync.Mutex
+	pending map[string]upload
+	keys    []string
+	active  int
+	// the hashes of the uploaded or pending files by their keys
+	hashes map[string][sha256.Size]byte
+	// done is closed when all the uploads have ended,
+	// nil -- no uploads
+	done chan struct{}
+	// the first failed upload since the last flush
+	err error
+	// the dirs of the uploaded files get the cloud mark,
+	// so the janitor keeps them while the cloud copies are fresh
+	mark bool
+	// the uploads of the queue stop with the context (the closed room)
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the failed uploads are retried after the backoff
+	attempts int
+	backoff  time.Duration
+}
+
+func newUploadQueue() *uploadQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &uploadQueue{pending: map[string]upload{}, hashes: map[string][sha256.Size]byte{},
+		ctx: ctx, cancel: cancel, attempts: uploadAttempts, backoff: uploadBackoff}
+}
+
+// add queues the upload of the copy of the file with the key.
+// With onlyChanged the files of the same content as the last upload are skipped,
+// it returns false for them.
+func (q *uploadQueue) add(key string, path string, onlyChanged bool, save uploadFunc) (bool, error) {
+	hash, err := fileHash(path)
+	if err != nil {
+		return false, err
+	}
+	q.mu.Lock()
+	last, ok := q.hashes[key]
+	q.mu.Unlock()
+	if onlyChanged && ok && last == hash {
+		return false, nil
+	}
+	snapshot, err := copyFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if old, ok := q.pending[key]; ok {
+		_ = os.Remove(old.path)
+	} else {
+		q.keys = append(q.keys, key)
+	}
+	q.pending[key] = upload{key: key, path: snapshot, hash: hash, save: save}
+	q.hashes[key] = hash
+	if q.done == nil {
+		q.done = make(chan struct{})
+		go q.run(q.done)
+	}
+	return true, nil
+}
+
+// run uploads the files until the queue is empty.
+func (q *uploadQueue) run(done chan struct{}) {
+	for {
+		q.mu.Lock()
+		if len(q.keys) == 0 {
+			q.done = nil
+			q.mu.Unlock()
+			close(done)
+			return
+		}
+		key := q.keys[0]
+		q.keys = q.keys[1:]
+		u := q.pending[key]
+		delete(q.pending, key)
+		q.active++
+		q.mu.Unlock()
+
+		err := q.upload(u)
+		metrics.upload(err)
+		_ = os.Remove(u.path)
+
+		q.mu.Lock()
+		q.active--
+		if err != nil {
+			log.Printf("error: couldn't upload %v into the cloud storage, %v", key, err)
+			// the next saves will upload it again
+			if _, ok := q.pending[key]; !ok && q.hashes[key] == u.hash {
+				delete(q.hashes, key)
+			}
+			if q.err == nil {
+				q.err = err
+			}
+		} else {
+			log.Printf("success, cloud save %v", key)
+		}
+		mark := err == nil && q.mark
+		q.mu.Unlock()
+		if mark {
+			if err := janitor.MarkCloud(filepath.Dir(u.path)); err != nil {
+				log.Printf("warn: couldn't mark the cloud save %v, %v", key, err)
+			}
+		}
+	}
+}
+
+// upload uploads the file retrying the failures with the backoff,
+// the file replaced by a newer pending one isn't retried.
+func (q *uploadQueue) upload(u upload) error {
+	backoff := q.backoff
+	for attempt := 1; ; attempt++ {
+		err := u.save(q.ctx, u.key, u.path)
+		if err == nil || attempt >= q.attempts || q.ctx.Err() != nil || q.replaced(u.key) {
+			return err
+		}
+		log.Printf("warn: upload %v has failed (attempt %v of %v), %v", u.key, attempt, q.attempts, err)
+		select {
+		case <-q.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// replaced tells if there is a newer pending upload of the key.
+func (q *uploadQueue) replaced(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.pending[key]
+	return ok
+}
+
+// stop aborts the running uploads, i.e. after the last flush of the closed room.
+func (q *uploadQueue) stop() { q.cancel() }
+
+// flush waits for the uploads until the timeout,
+// it returns the first upload error since the last flush.
+func (q *uploadQueue) flush(timeout time.Duration) error {
+	q.mu.Lock()
+	done := q.done
+	q.mu.Unlock()
+	if done != nil {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			return ErrUploadTimeout
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := q.err
+	q.err = nil
+	return err
+}
+
+// len returns the number of the pending and running uploads.
+func (q *uploadQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.keys) + q.active
+}
+
+// PendingUploads returns the number of the saves
+// not uploaded into the cloud storage yet.
+func (r *Room) PendingUploads() int { return r.uploads.len() }
+
+// uploadState uploads the save state (or save RAM) file in the format of the storage config.
+func (r *Room) uploadState(ctx context.Context, key string, path string) error {
+	return r.states.Save(ctx, r.onlineStorage, key, path)
+}
+
+// uploadFile uploads the file as is.
+func (r *Room) uploadFile(ctx context.Context, key string, path string) error {
+	return storage.SaveFile(ctx, r.onlineStorage, key, path)
+}
+
+// copyFile copies the file into a temp file next to it.
+func copyFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.pending")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
@@ -0,0 +1,238 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+)
+
+// slowStorage is a cloud storage which blocks the uploads until released.
+type slowStorage struct {
+	mu      sync.Mutex
+	keys    []string
+	release chan struct{}
+	fail    error
+}
+
+func (s *slowStorage) Save(ctx context.Context, key string, r io.Reader, _ int64) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+func (s *slowStorage) Load(context.Context, string) (io.ReadCloser, error) {
+	return nil, os.ErrNotExist
+}
+
+func (s *slowStorage) uploaded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.keys...)
+}
+
+// frameEmulatorMock shares the lock of its state with the frame loop.
+type frameEmulatorMock struct {
+	*stateEmulatorMock
+	mu sync.Mutex
+}
+
+func (e *frameEmulatorMock) SaveGameSlot(slot int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stateEmulatorMock.SaveGameSlot(slot)
+}
+
+func flushUploads(t *testing.T, room *Room) {
+	t.Helper()
+	if err := room.uploads.flush(time.Second); err != nil {
+		t.Fatalf("couldn't upload the saves, %v", err)
+	}
+}
+
+// Tests that the saves don't wait for the slow cloud storage,
+// so the frames of the game go on, and the uploads end later.
+func TestUploadQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_upload")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store := &slowStorage{release: make(chan struct{})}
+	room := newRoom("test_upload", make(chan nanoarch.InputEvent, 100), store, worker.Config{})
+	defer room.Close()
+	emu := &frameEmulatorMock{stateEmulatorMock: &stateEmulatorMock{
+		emulatorMock: &emulatorMock{closed: make(chan struct{})},
+		path:         filepath.Join(dir, "test_upload.dat"),
+	}}
+	room.director = emu
+
+	// the frame loop of the emulator
+	var slowest time.Duration
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			start := time.Now()
+			emu.mu.Lock()
+			emu.mu.Unlock()
+			if d := time.Since(start); d > slowest {
+				slowest = d
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		emu.state = []byte{byte(i)}
+		start := time.Now()
+		if err := room.SaveGame(); err != nil {
+			t.Fatalf("couldn't save the game, %v", err)
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Errorf("the save has waited for the upload %v", d)
+		}
+	}
+	close(stop)
+	<-stopped
+	if slowest > 500*time.Millisecond {
+		t.Errorf("the frame loop has been blocked by the saves for %v", slowest)
+	}
+	if n := room.PendingUploads(); n == 0 || n > 2 {
+		t.Errorf("wrong number %v of the pending uploads, expected the coalesced ones", n)
+	}
+	if err := room.uploads.flush(10 * time.Millisecond); err != ErrUploadTimeout {
+		t.Errorf("the blocked uploads have been flushed, %v", err)
+	}
+
+	close(store.release)
+	flushUploads(t, room)
+	if keys := store.uploaded(); len(keys) == 0 || len(keys) > 2 || keys[len(keys)-1] != "test_upload" {
+		t.Errorf("wrong uploads %v", keys)
+	}
+	if n := room.PendingUploads(); n != 0 {
+		t.Errorf("%v uploads are still pending", n)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.pending")); len(files) > 0 {
+		t.Errorf("the upload copies are left %v", files)
+	}
+}
+
+func TestUploadQueueRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_upload")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	release := make(chan struct{})
+	close(release)
+	errStorage := errors.New("no storage")
+	store := &slowStorage{release: release, fail: errStorage}
+	room := newRoom("test_upload_retry", make(chan nanoarch.InputEvent, 100), store, worker.Config{})
+	defer room.Close()
+	room.uploads.backoff = time.Millisecond
+	room.director = &stateEmulatorMock{
+		emulatorMock: &emulatorMock{closed: make(chan struct{})},
+		path:         filepath.Join(dir, "test_upload_retry.dat"),
+		state:        []byte{1, 2, 3},
+	}
+
+	room.autosave()
+	if err := room.uploads.flush(time.Second); err != errStorage {
+		t.Errorf("wrong upload error %v", err)
+	}
+
+	// the same state again after the failed upload
+	store.mu.Lock()
+	store.fail = nil
+	store.mu.Unlock()
+	room.autosave()
+	flushUploads(t, room)
+	if keys := store.uploaded(); len(keys) != 1 {
+		t.Errorf("the failed upload hasn't been retried, %v", keys)
+	}
+}
+
+// Tests that the failed uploads are retried a few times and
+// the uploads of the stopped queue are aborted.
+func TestUploadQueueAttempts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloud_game_upload")
+	if err != nil {
+		t.Fatalf("couldn't make a temp dir, %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "test_upload_attempts.dat")
+	if err := ioutil.WriteFile(path, []byte{1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	errStorage := errors.New("no storage")
+
+	tests := []struct {
+		name     string
+		failures int
+		calls    int
+		err      error
+	}{
+		{name: "the temporary failures", failures: uploadAttempts - 1, calls: uploadAttempts},
+		{name: "the permanent failure", failures: uploadAttempts + 1, calls: uploadAttempts, err: errStorage},
+	}
+	for _, test := range tests {
+		q := newUploadQueue()
+		q.backoff = time.Millisecond
+		calls := 0
+		save := func(context.Context, string, string) error {
+			calls++
+			if calls <= test.failures {
+				return errStorage
+			}
+			return nil
+		}
+		if _, err := q.add("key", path, false, save); err != nil {
+			t.Fatalf("%v: couldn't queue the upload, %v", test.name, err)
+		}
+		if err := q.flush(time.Second); err != test.err {
+			t.Errorf("%v: wrong upload error %v", test.name, err)
+		}
+		if calls != test.calls {
+			t.Errorf("%v: %v upload attempts, expected %v", test.name, calls, test.calls)
+		}
+	}
+
+	// the closed room doesn't wait for the backoff
+	q := newUploadQueue()
+	q.backoff = time.Hour
+	if _, err := q.add("key", path, false, func(context.Context, string, string) error { return errStorage }); err != nil {
+		t.Fatal(err)
+	}
+	q.stop()
+	if err := q.flush(time.Second); err != errStorage {
+		t.Errorf("the upload of the stopped queue hasn't been aborted, %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package room
+
+import (
+	"image"
+	"testing"
+
+	"github.com/giongto35/cloud-game/v2/pkg/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// videoEncoderMock returns the encoded frames from its memory like the codecs do,
+// or copies them into the new slices.
+type videoEncoderMock struct {
+	data  []byte
+	alloc bool
+}
+
+func (e *videoEncoderMock) Encode([]byte) []byte {
+	if e.alloc {
+		return append([]byte(nil), e.data...)
+	}
+	return e.data
+}
+func (e *videoEncoderMock) Shutdown() error { return nil }
+
+// BenchmarkRoomVideoPath streams the 640x480 frames of the emulator
+// through the encoder pipe to the peers.
+// The alloc path makes new images and encoded frames as it used to be,
+// the pool path reuses the frame buffers.
+func BenchmarkRoomVideoPath(b *testing.B) {
+	b.Run("alloc", func(b *testing.B) { benchmarkVideoPath(b, true) })
+	b.Run("pool", func(b *testing.B) { benchmarkVideoPath(b, false) })
+}
+
+func benchmarkVideoPath(b *testing.B, alloc bool) {
+	const w, h, peers = 640, 480, 4
+	pipe := encoder.NewVideoPipe(&videoEncoderMock{data: make([]byte, 32<<10), alloc: alloc}, w, h)
+	go pipe.Start()
+
+	// the peers write the frames and release them
+	sessions := make([]*webrtc.WebRTC, peers)
+	written := make(chan struct{}, peers)
+	for i := range sessions {
+		sessions[i] = &webrtc.WebRTC{ImageChannel: make(chan webrtc.WebFrame, 30)}
+		go func(frames chan webrtc.WebFrame) {
+			for frame := range frames {
+				if frame.Release != nil {
+					frame.Release()
+				}
+				written <- struct{}{}
+			}
+		}(sessions[i].ImageChannel)
+	}
+
+	var frames media.FramePool
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in := encoder.InFrame{}
+		if alloc {
+			in.Image = image.NewRGBA(image.Rect(0, 0, w, h))
+		} else {
+			in.Buf = frames.Get(w * h * 4)
+			in.Image = &image.RGBA{Pix: in.Buf.Data, Stride: w * 4, Rect: image.Rect(0, 0, w, h)}
+		}
+		pipe.Input <- in
+		out := <-pipe.Output
+		for _, s := range sessions {
+			out.Buf.Retain()
+			frame := webrtc.WebFrame{Data: out.Data, Duration: out.Duration, Release: out.Buf.Releaser()}
+			if alloc {
+				frame.Data, frame.Release = append([]byte(nil), out.Data...), nil
+			}
+			if !s.SendVideo(frame) {
+				out.Buf.Release()
+			}
+		}
+		out.Buf.Release()
+		for range sessions {
+			<-written
+		}
+	}
+	b.StopTimer()
+	pipe.Stop()
+	for _, s := range sessions {
+		close(s.ImageChannel)
+	}
+}
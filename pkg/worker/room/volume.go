@@ -0,0 +1,129 @@
+package room
+
+import (
+	"log"
+	"time"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+// volumeStep is the step of the peer volumes sharing one audio encoder,
+// so there are at most 100 / volumeStep extra encoders in the room.
+const volumeStep = 10
+
+// volumeBucket returns the peer volume rounded to the step,
+// 0 means the peer doesn't get any audio.
+// Only the muted peers and the zero volume are silent,
+// the volumes under the half of the step get the step.
+func volumeBucket(peer Session) int {
+	v := peer.Volume()
+	if peer.Muted() || v <= 0 {
+		return 0
+	}
+	if v = (v + volumeStep/2) / volumeStep * volumeStep; v < volumeStep {
+		return volumeStep
+	}
+	return v
+}
+
+// encodeAudio encodes the audio frame of the media time and sends it to the peers.
+// The peers with the full volume share one encoded frame and
+// the quieter ones get the frame encoded by the encoder of their volume.
+func (r *Room) encodeAudio(pcm media.Samples, ts time.Duration) {
+	r.audioLock.Lock()
+	defer r.audioLock.Unlock()
+
+	start := time.Now()
+	dat, err := r.audioEnc.Encode(pcm)
+	if err != nil {
+		return
+	}
+	metrics.encode("audio", start)
+	r.recordAudio(dat)
+	r.stats.audio(ts)
+	duration := samplesTime(len(pcm), r.audioConf)
+
+	var quiet quietPeers
+	r.rtcSessions.ForEach(func(peer Session) {
+		if peer.IsConnected() {
+			quiet = quiet.send(peer, webrtc.AudioFrame{Data: dat, Timestamp: ts, Duration: duration})
+		}
+	})
+	r.sinks.forEach(func(sink Sink) { sink.SendAudio(webrtc.AudioFrame{Data: dat, Timestamp: ts, Duration: duration}) })
+	r.sendQuiet(pcm, ts, duration, quiet)
+}
+
+// quietPeers is the peers with the lower volume by their volume,
+// allocated only if somebody has changed it.
+type quietPeers map[int][]Session
+
+// send sends the encoded frame to the peer of the full volume
+// or keeps the quieter peer for its own frame.
+func (q quietPeers) send(peer Session, frame webrtc.AudioFrame) quietPeers {
+	switch v := volumeBucket(peer); v {
+	case 0:
+	case webrtc.MaxVolume:
+		peer.SendAudio(frame)
+	default:
+		if q == nil {
+			q = make(quietPeers)
+		}
+		q[v] = append(q[v], peer)
+	}
+	return q
+}
+
+// sendQuiet sends the audio frame encoded with the volume of the quiet peers.
+// Should be called under the audio lock.
+func (r *Room) sendQuiet(pcm media.Samples, ts, duration time.Duration, quiet quietPeers) {
+	for v, peers := range quiet {
+		dat, err := r.encodeVolume(pcm, v)
+		if err != nil {
+			continue
+		}
+		for _, peer := range peers {
+			peer.SendAudio(webrtc.AudioFrame{Data: dat, Timestamp: ts, Duration: duration})
+		}
+	}
+	// the encoders of the volumes nobody listens to anymore
+	for v := range r.volumeEnc {
+		if _, ok := quiet[v]; !ok {
+			delete(r.volumeEnc, v)
+		}
+	}
+}
+
+// encodeVolume encodes the audio frame scaled to the volume
+// with the encoder of the volume.
+// Should be called under the audio lock.
+func (r *Room) encodeVolume(pcm media.Samples, volume int) ([]byte, error) {
+	enc, ok := r.volumeEnc[volume]
+	if !ok {
+		var err error
+		if enc, err = r.newAudioEnc(r.audioConf); err != nil {
+			log.Printf("error: room %v, couldn't create the audio encoder of %v%% volume, %v", r.ID, volume, err)
+			return nil, err
+		}
+		if r.volumeEnc == nil {
+			r.volumeEnc = make(map[int]audioEncoder)
+		}
+		r.volumeEnc[volume] = enc
+	}
+	scaled := make(media.Samples, len(pcm))
+	for i, s := range pcm {
+		scaled[i] = int16(int(s) * volume / webrtc.MaxVolume)
+	}
+	return enc.Encode(scaled)
+}
+
+// newAudioEncoder creates the audio encoder of the room with the settings.
+func newAudioEncoder(audio encoderConfig.Audio) (audioEncoder, error) {
+	enc, err := newOpusEncoder(audio)
+	if enc == nil {
+		return nil, err
+	}
+	// the wrong settings have been reported by the main encoder
+	return enc, nil
+}
@@ -0,0 +1,112 @@
+package room
+
+import (
+	"testing"
+
+	encoderConfig "github.com/giongto35/cloud-game/v2/pkg/config/encoder"
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/media"
+	"github.com/giongto35/cloud-game/v2/pkg/webrtc"
+)
+
+func TestAudioVolume(t *testing.T) {
+	room := newRoom("test_volume", make(chan nanoarch.InputEvent, 100), nil, worker.Config{})
+	defer room.Close()
+	room.audioEnc = &audioEncoderMock{}
+	var created []*audioEncoderMock
+	room.newAudioEnc = func(encoderConfig.Audio) (audioEncoder, error) {
+		enc := &audioEncoderMock{frame: 1}
+		created = append(created, enc)
+		return enc, nil
+	}
+
+	peer := func(id string) *webrtc.WebRTC {
+		return &webrtc.WebRTC{ID: id, AudioChannel: make(chan webrtc.AudioFrame, 10)}
+	}
+	full, muted, half, almostHalf := peer("full"), peer("muted"), peer("half"), peer("almost half")
+	muted.SetMuted(true)
+	half.SetVolume(50)
+	almostHalf.SetVolume(52)
+	peers := []*webrtc.WebRTC{full, muted, half, almostHalf}
+
+	// the room fan-out of the connected peers
+	send := func(pcm media.Samples) {
+		room.audioLock.Lock()
+		defer room.audioLock.Unlock()
+		dat, _ := room.audioEnc.Encode(pcm)
+		var quiet quietPeers
+		for _, p := range peers {
+			quiet = quiet.send(p, webrtc.AudioFrame{Data: dat})
+		}
+		room.sendQuiet(pcm, 0, 0, quiet)
+	}
+
+	frames := 3
+	for i := 0; i < frames; i++ {
+		send(media.Samples{1000, -1000})
+	}
+
+	if n := len(muted.AudioChannel); n != 0 {
+		t.Errorf("the muted peer has received %v audio frames", n)
+	}
+	for _, p := range []*webrtc.WebRTC{full, half, almostHalf} {
+		if n := len(p.AudioChannel); n != frames {
+			t.Errorf("the %v peer has received %v audio frames instead of %v", p.ID, n, frames)
+		}
+	}
+	if frame := <-full.AudioChannel; frame.Data[0] != 0 {
+		t.Errorf("the full volume peer should get the frames of the main encoder")
+	}
+	if len(created) != 1 {
+		t.Fatalf("expected one encoder for the close volumes, got %v", len(created))
+	}
+	if frame := <-half.AudioChannel; frame.Data[0] != 1 {
+		t.Errorf("the quiet peer should get the frames of its volume encoder")
+	}
+	if pcm := created[0].pcm; pcm[0] != 500 || pcm[1] != -500 {
+		t.Errorf("wrong scaled samples %v", pcm)
+	}
+
+	if err := room.SetAudioBitrate(64000); err != nil || created[0].bitrate != 64000 {
+		t.Errorf("the volume encoders should have the new bitrate, %v", err)
+	}
+
+	// the default path again
+	half.SetVolume(webrtc.MaxVolume)
+	almostHalf.SetVolume(webrtc.MaxVolume)
+	muted.SetMuted(false)
+	send(media.Samples{1000, -1000})
+	if len(room.volumeEnc) != 0 {
+		t.Errorf("the unused volume encoders should be removed")
+	}
+	if n := len(muted.AudioChannel); n != 1 {
+		t.Errorf("the unmuted peer has received %v audio frames", n)
+	}
+}
+
+func TestVolumeBucket(t *testing.T) {
+	tests := []struct {
+		volume int
+		muted  bool
+		bucket int
+	}{
+		{volume: 0, bucket: 0},
+		{volume: 1, bucket: volumeStep},
+		{volume: 4, bucket: volumeStep},
+		{volume: 5, bucket: volumeStep},
+		{volume: 14, bucket: volumeStep},
+		{volume: 15, bucket: 2 * volumeStep},
+		{volume: 52, bucket: 50},
+		{volume: webrtc.MaxVolume, bucket: webrtc.MaxVolume},
+		{volume: 50, muted: true, bucket: 0},
+	}
+	for _, test := range tests {
+		peer := &webrtc.WebRTC{}
+		peer.SetVolume(test.volume)
+		peer.SetMuted(test.muted)
+		if bucket := volumeBucket(peer); bucket != test.bucket {
+			t.Errorf("the volume %v (muted: %v) has got the bucket %v, expected %v", test.volume, test.muted, bucket, test.bucket)
+		}
+	}
+}
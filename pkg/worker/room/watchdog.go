@@ -0,0 +1,303 @@
+package room
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/overlay"
+)
+
+// The watchdog of the emulators of the rooms.
+// The emulator is hung when it hasn't made new frames for some number
+// of the frame intervals of the game (not paused), the emulator without game
+// has exited when its frame stream has ended (or it has panicked).
+// Such emulators are replaced with the new ones which load the last save (autosave)
+// of the game, the peers of the room get a keyframe and go on.
+// The cgo crashes (segfaults) of the cores in the worker process can't be caught,
+// the hung cores are left as is (their goroutines are lost).
+
+const (
+	// defaultRecoveries is the max number of the emulator restarts of a room.
+	defaultRecoveries = 3
+	// mediaBuffer is the size of the media channels of the room.
+	mediaBuffer = 30
+	// endGrace is how long the replaced emulator may take to stop.
+	endGrace = time.Second
+)
+
+// emulatorRun is the emulator of the room with its media.
+type emulatorRun struct {
+	director emulator.CloudEmulator
+	meta     emulator.Metadata
+	video    <-chan nanoarch.GameFrame
+	audio    <-chan nanoarch.GameAudio
+	// the video is imported, it's the same for all the emulators of the room
+	imported bool
+	// ended is closed when the emulator has stopped
+	ended chan struct{}
+}
+
+// emulatorWatch restarts the hung or exited emulators of the room.
+type emulatorWatch struct {
+	// the number of the frame intervals without frames of the hung emulators,
+	// 0 -- no watch of the hangs
+	frames int
+	// the max number of the restarts
+	max int
+	// recoveries is the number of the restarts so far
+	recoveries int32
+	// relayed is the number of the frames of the emulators
+	relayed uint64
+	// exits gets the exits of the emulators
+	exits chan struct{}
+	// spawn makes a new emulator of the game
+	spawn func() (emulatorRun, error)
+	// the current emulator and the stop of its media relay,
+	// relaying is closed when the relay stops
+	current  emulatorRun
+	stop     chan struct{}
+	relaying chan struct{}
+	// the media of the room fed by the emulators
+	video   chan nanoarch.GameFrame
+	audio   chan nanoarch.GameAudio
+	endOnce sync.Once
+}
+
+func newEmulatorWatch(conf worker.Watchdog) emulatorWatch {
+	max := conf.Recoveries
+	if max <= 0 {
+		max = defaultRecoveries
+	}
+	return emulatorWatch{
+		frames: conf.Frames,
+		max:    max,
+		exits:  make(chan struct{}, 1),
+		video:  make(chan nanoarch.GameFrame, mediaBuffer),
+		audio:  make(chan nanoarch.GameAudio, mediaBuffer),
+	}
+}
+
+// Recoveries returns the number of the emulator restarts of the room.
+func (r *Room) Recoveries() int { return int(atomic.LoadInt32(&r.emulator.recoveries)) }
+
+// attach makes the emulator the director of the room whose media go into the room.
+// Should be called under the saveLock.
+func (r *Room) attach(run emulatorRun) {
+	stop, relaying := make(chan struct{}), make(chan struct{})
+	r.emulator.current, r.emulator.stop, r.emulator.relaying = run, stop, relaying
+	r.director = run.director
+	r.resetInputDelay()
+	run.director.OnFrame(r.onFrame)
+	// the new emulators go on from the last save
+	if rt := r.achievements.runtime(); rt != nil {
+		rt.Reset()
+		run.director.WatchMemory(r.checkAchievements)
+	}
+	go r.relay(run, stop, relaying)
+}
+
+// runEmulator runs the emulator until it is closed,
+// the panics of the emulator are its exits.
+func (r *Room) runEmulator(run emulatorRun) {
+	defer close(run.ended)
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("error: room %v emulator has crashed, %v", r.ID, err)
+			r.emulatorExited()
+		}
+	}()
+	run.director.Start()
+}
+
+// emulatorExited tells the watchdog about the exit of the current emulator.
+func (r *Room) emulatorExited() {
+	select {
+	case r.emulator.exits <- struct{}{}:
+	default:
+	}
+}
+
+// relay passes the media of the emulator into the room until the emulator stops,
+// then the media of the room end. The media of the replaced emulators (stop)
+// are dropped until they stop.
+func (r *Room) relay(run emulatorRun, stop <-chan struct{}, relaying chan<- struct{}) {
+	w := &r.emulator
+	stopped := func() {
+		close(relaying)
+		drain(run)
+	}
+	for {
+		select {
+		case <-stop:
+			stopped()
+			return
+		case frame, ok := <-run.video:
+			if !ok {
+				w.end()
+				close(relaying)
+				return
+			}
+			atomic.AddUint64(&w.relayed, 1)
+			select {
+			case w.video <- frame:
+			case <-stop:
+				frame.Buf.Release()
+				stopped()
+				return
+			}
+		case samples, ok := <-run.audio:
+			if !ok {
+				w.end()
+				close(relaying)
+				return
+			}
+			select {
+			case w.audio <- samples:
+			case <-stop:
+				stopped()
+				return
+			}
+		}
+	}
+}
+
+// end closes the media of the room.
+func (w *emulatorWatch) end() {
+	w.endOnce.Do(func() {
+		close(w.video)
+		close(w.audio)
+	})
+}
+
+// drain drops the media of the emulator until it stops.
+// The imported video goes on with the next emulator.
+func drain(run emulatorRun) {
+	video := run.video
+	if run.imported {
+		video = nil
+	}
+	for {
+		select {
+		case frame, ok := <-video:
+			if !ok {
+				return
+			}
+			frame.Buf.Release()
+		case _, ok := <-run.audio:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// watchEmulator restarts the emulator of the room
+// which has hung or exited until the room is closed.
+func (r *Room) watchEmulator(fps float64) {
+	w := &r.emulator
+	if fps <= 0 {
+		fps = 60
+	}
+	limit := time.Duration(float64(w.frames) * float64(time.Second) / fps)
+	var tick <-chan time.Time
+	if w.frames > 0 {
+		ticker := time.NewTicker(limit / 4)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	last, progress := atomic.LoadUint64(&w.relayed), time.Now()
+	for {
+		select {
+		case <-r.Done:
+			return
+		case <-w.exits:
+			log.Printf("error: room %v emulator has exited", r.ID)
+		case now := <-tick:
+			frames := atomic.LoadUint64(&w.relayed)
+			if frames != last || r.IsPaused() || r.isFrozen() {
+				last, progress = frames, now
+				continue
+			}
+			if now.Sub(progress) < limit {
+				continue
+			}
+			log.Printf("error: room %v emulator has hung for %v", r.ID, now.Sub(progress))
+		}
+		if !r.recoverEmulator() {
+			return
+		}
+		// the stream of the replaced emulator without game has ended too
+		select {
+		case <-w.exits:
+		default:
+		}
+		last, progress = atomic.LoadUint64(&w.relayed), time.Now()
+	}
+}
+
+// recoverEmulator replaces the emulator of the room with a new one
+// which goes on from the last save of the game.
+// The room is closed after too many restarts or if there is no new emulator.
+func (r *Room) recoverEmulator() bool {
+	w := &r.emulator
+	n := int(atomic.AddInt32(&w.recoveries, 1))
+	if n > w.max {
+		log.Printf("error: room %v emulator has failed %v times, closing", r.ID, n)
+		r.fail(ErrCrashed)
+		return false
+	}
+	r.status.set(overlay.Recovering, true)
+	defer r.status.set(overlay.Recovering, false)
+
+	r.saveLock.Lock()
+	defer r.saveLock.Unlock()
+	select {
+	case <-r.Done:
+		return false
+	default:
+	}
+
+	old := w.current
+	close(w.stop)
+	<-w.relaying
+	old.director.Close()
+	// the hung emulator may never stop
+	select {
+	case <-old.ended:
+	case <-time.After(endGrace):
+		log.Printf("warn: room %v emulator hasn't stopped", r.ID)
+	}
+
+	run, err := w.spawn()
+	if err != nil {
+		log.Printf("error: room %v couldn't restart the emulator, %v", r.ID, err)
+		r.director = nil
+		w.end()
+		r.fail(err)
+		return false
+	}
+	// the new emulator makes the frames of the room size
+	r.videoLock.Lock()
+	r.setViewport(run.director)
+	r.videoLock.Unlock()
+	r.attach(run)
+	go r.runEmulator(run)
+	go r.startRumble(run.director.Rumble())
+	r.forceKeyframe()
+	r.event(Event{Type: EventRecovered})
+	log.Printf("warn: room %v emulator has been restarted (%v/%v)", r.ID, n, w.max)
+	return true
+}
+
+// discard stops the emulator which won't run,
+// the closed emulator ends after the first frame and unloads the game.
+func discard(director emulator.CloudEmulator) {
+	director.Close()
+	director.Start()
+}
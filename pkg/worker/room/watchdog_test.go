@@ -0,0 +1,182 @@
+package room
+
+import (
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
+	"github.com/giongto35/cloud-game/v2/pkg/emulator/libretro/nanoarch"
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+)
+
+// hangingEmulator is a room emulator which makes the frames
+// of 60 FPS until it hangs after some of them.
+type hangingEmulator struct {
+	emulatorMock
+	video chan nanoarch.GameFrame
+	audio chan nanoarch.GameAudio
+	// the number of the frames before the hang, 0 -- never hangs
+	hangAfter int
+	done      chan struct{}
+	// release frees the hung emulator (the end of the test)
+	release <-chan struct{}
+}
+
+func newHangingEmulator(hangAfter int, release <-chan struct{}) *hangingEmulator {
+	return &hangingEmulator{
+		video:     make(chan nanoarch.GameFrame, 1),
+		audio:     make(chan nanoarch.GameAudio, 1),
+		hangAfter: hangAfter,
+		done:      make(chan struct{}),
+		release:   release,
+	}
+}
+
+func (e *hangingEmulator) run() emulatorRun {
+	return emulatorRun{director: e, video: e.video, audio: e.audio, ended: make(chan struct{})}
+}
+
+func (e *hangingEmulator) Start() {
+	defer close(e.audio)
+	defer close(e.video)
+	ticker := time.NewTicker(time.Second / 60)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		if e.hangAfter > 0 && n > e.hangAfter {
+			// the hung emulator doesn't see the close
+			<-e.release
+			return
+		}
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		}
+		select {
+		case e.video <- nanoarch.GameFrame{Data: image.NewRGBA(image.Rect(0, 0, 1, 1))}:
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *hangingEmulator) Close() { close(e.done) }
+
+// startHangingRoom starts the room with the emulator and the watchdog,
+// the new emulators of the room are made with spawn.
+func startHangingRoom(id string, conf worker.Watchdog, emu *hangingEmulator,
+	spawn func() (emulatorRun, error)) *Room {
+	store, _ := storage.NewNoopCloudStorage()
+	var cfg worker.Config
+	cfg.Room.Watchdog = conf
+	room := newRoom(id, make(chan nanoarch.InputEvent, 1), store, cfg)
+	room.emulator.spawn = spawn
+	room.imageChannel, room.audioChannel = room.emulator.video, room.emulator.audio
+	run := emu.run()
+	room.saveLock.Lock()
+	room.attach(run)
+	room.saveLock.Unlock()
+	go room.runEmulator(run)
+	go room.watchEmulator(60)
+	return room
+}
+
+func TestEmulatorWatchdog(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	spawned := make(chan struct{}, 1)
+	room := startHangingRoom("test_watchdog", worker.Watchdog{Frames: 6, Recoveries: 1},
+		newHangingEmulator(5, release), func() (emulatorRun, error) {
+			spawned <- struct{}{}
+			return newHangingEmulator(0, release).run(), nil
+		})
+
+	// the frames before the hang and after the restart
+	frames := 0
+	timeout := time.After(10 * time.Second)
+	for frames < 20 {
+		select {
+		case _, ok := <-room.imageChannel:
+			if !ok {
+				t.Fatalf("the video of the room has ended after %v frames", frames)
+			}
+			frames++
+		case <-timeout:
+			t.Fatalf("the room has stopped serving frames after %v frames", frames)
+		}
+	}
+	select {
+	case <-spawned:
+	default:
+		t.Fatalf("the watchdog hasn't restarted the emulator")
+	}
+	if n := room.GetStats().Recoveries; n != 1 {
+		t.Errorf("wrong number of the recoveries %v", n)
+	}
+
+	room.Close()
+	select {
+	case <-room.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the room wasn't closed")
+	}
+	// the video of the room ends with the new emulator
+	for range room.imageChannel {
+	}
+}
+
+func TestEmulatorWatchdogLimit(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	var spawns int32
+	room := startHangingRoom("test_watchdog_limit", worker.Watchdog{Frames: 6, Recoveries: 2},
+		newHangingEmulator(2, release), func() (emulatorRun, error) {
+			atomic.AddInt32(&spawns, 1)
+			return newHangingEmulator(2, release).run(), nil
+		})
+	go func() {
+		for range room.imageChannel {
+		}
+	}()
+
+	select {
+	case <-room.Done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the room of the always hung emulator wasn't closed")
+	}
+	if err := room.Err(); err != ErrCrashed {
+		t.Errorf("wrong error of the room %v", err)
+	}
+	if n := atomic.LoadInt32(&spawns); n != 2 {
+		t.Errorf("wrong number of the restarts %v", n)
+	}
+}
+
+func TestEmulatorWatchdogExit(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	spawned := make(chan struct{}, 1)
+	// without the hang checks
+	room := startHangingRoom("test_watchdog_exit", worker.Watchdog{},
+		newHangingEmulator(0, release), func() (emulatorRun, error) {
+			spawned <- struct{}{}
+			return newHangingEmulator(0, release).run(), nil
+		})
+	defer room.Close()
+	go func() {
+		for range room.imageChannel {
+		}
+	}()
+
+	room.emulatorExited()
+	select {
+	case <-spawned:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the exited emulator hasn't been restarted")
+	}
+}
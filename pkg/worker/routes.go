@@ -8,16 +8,46 @@ func (h *Handler) routes() {
 	}
 
 	h.oClient.Receive(api.ServerId, h.handleServerId())
+	h.oClient.Receive(api.WorkerDrain, h.handleWorkerDrain())
 	h.oClient.Receive(api.TerminateSession, h.handleTerminateSession())
+	h.oClient.Receive(api.SessionLeave, h.handleSessionLeave())
+	h.oClient.Receive(api.RoomStats, h.handleRoomStats())
+	h.oClient.Receive(api.RoomScreenshot, h.handleRoomScreenshot())
+	h.oClient.Receive(api.RoomSaveThumbnail, h.handleRoomSaveThumbnail())
+	h.oClient.Receive(api.RoomExportSave, h.handleRoomExportSave())
+	h.oClient.Receive(api.RoomRecording, h.handleRoomRecording())
+	h.oClient.Receive(api.RoomCoreOption, h.handleRoomCoreOption())
+	h.oClient.Receive(api.RoomCheat, h.handleRoomCheat())
+	h.oClient.Receive(api.RoomSwapDisc, h.handleRoomSwapDisc())
+	h.oClient.Receive(api.RoomAudioBitrate, h.handleRoomAudioBitrate())
+	h.oClient.Receive(api.RoomVideoFilter, h.handleRoomVideoFilter())
+	h.oClient.Receive(api.RoomExport, h.handleRoomExport())
+	h.oClient.Receive(api.RoomImport, h.handleRoomImport())
+	h.oClient.Receive(api.RoomHandoff, h.handleRoomHandoff())
+	h.oClient.Receive(api.RoomFork, h.handleRoomFork())
 	h.oClient.Receive(api.InitWebrtc, h.handleInitWebrtc())
 	h.oClient.Receive(api.Answer, h.handleAnswer())
 	h.oClient.Receive(api.IceCandidate, h.handleIceCandidate())
 
 	h.oClient.Receive(api.GameStart, h.handleGameStart())
+	h.oClient.Receive(api.GameReconnect, h.handleGameReconnect())
 	h.oClient.Receive(api.GameQuit, h.handleGameQuit())
 	h.oClient.Receive(api.GameSave, h.handleGameSave())
 	h.oClient.Receive(api.GameLoad, h.handleGameLoad())
+	h.oClient.Receive(api.GameSaveSlot, h.handleGameSaveSlot())
+	h.oClient.Receive(api.GameLoadSlot, h.handleGameLoadSlot())
+	h.oClient.Receive(api.GameSlots, h.handleGameSlots())
 	h.oClient.Receive(api.GamePlayerSelect, h.handleGamePlayerSelect())
 	h.oClient.Receive(api.GameMultitap, h.handleGameMultitap())
+	h.oClient.Receive(api.GameKeyMapping, h.handleGameKeyMapping())
+	h.oClient.Receive(api.GameImportSave, h.handleGameImportSave())
+	h.oClient.Receive(api.GameRewind, h.handleGameRewind())
+	h.oClient.Receive(api.GamePause, h.handleGamePause())
+	h.oClient.Receive(api.GameFastForward, h.handleGameFastForward())
 	h.oClient.Receive(api.GameRecording, h.handleGameRecording())
+	h.oClient.Receive(api.GameKick, h.handleGameKick())
+	h.oClient.Receive(api.GameBan, h.handleGameBan())
+	h.oClient.Receive(api.GamePassword, h.handleGamePassword())
+	h.oClient.Receive(api.GameInvite, h.handleGameInvite())
+	h.oClient.Receive(api.GameConnectionStats, h.handleGameConnectionStats())
 }
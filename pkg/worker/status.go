@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"log"
+	"time"
+
+	"github.com/giongto35/cloud-game/v2/pkg/cws/api"
+	"github.com/giongto35/cloud-game/v2/pkg/os"
+)
+
+// roomStatusPeriod is how often the worker reports its rooms to the coordinator.
+const roomStatusPeriod = 10 * time.Second
+
+// reportRooms sends the rooms of the worker to the coordinator
+// (i.e. for its lobby) until the connection is closed.
+func (h *Handler) reportRooms(c *CoordinatorClient) {
+	t := time.NewTicker(roomStatusPeriod)
+	defer t.Stop()
+	for {
+		h.measureRooms()
+		h.sendRoomStatus(c)
+		select {
+		case <-c.Done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// load returns the load of the worker for its heartbeats,
+// the coordinator gives the new rooms to the workers with capacity.
+func (h *Handler) load() string {
+	rooms := h.rooms.List()
+	load := api.WorkerLoad{Rooms: len(rooms), MaxRooms: h.cfg.Worker.MaxRooms}
+	for _, r := range rooms {
+		info := r.Info()
+		load.Sessions += info.Players + info.Spectators
+	}
+	// no load on the systems without it
+	load.LoadAvg, _ = os.LoadAverage()
+	load.FreeMemory, _ = os.FreeMemory()
+	load.Overloaded = h.admission.Overloaded()
+	data, err := load.To()
+	if err != nil {
+		return ""
+	}
+	return data
+}
+
+// measureRooms gives the CPU times of the rooms to the admission control,
+// their costs are measured between the reports.
+func (h *Handler) measureRooms() {
+	now := time.Now()
+	for _, r := range h.rooms.List() {
+		h.admission.Observe(r.ID, r.CPUTime(), now)
+	}
+}
+
+// announceRooms registers the rooms of the worker
+// on the coordinator after the reconnect.
+func (h *Handler) announceRooms(c *CoordinatorClient) {
+	for _, r := range h.rooms.List() {
+		c.Send(api.RegisterRoomPacket(r.ID), nil)
+	}
+}
+
+func (h *Handler) sendRoomStatus(c *CoordinatorClient) {
+	status := api.RoomStatusRequest{Rooms: []api.RoomInfo{}}
+	for _, r := range h.rooms.List() {
+		status.Rooms = append(status.Rooms, roomInfo(r.Info()))
+	}
+	data, err := status.To()
+	if err != nil {
+		log.Printf("error: couldn't make the room status, %v", err)
+		return
+	}
+	c.Send(api.RoomStatusPacket(data), nil)
+}
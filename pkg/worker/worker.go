@@ -6,20 +6,42 @@ import (
 	"github.com/giongto35/cloud-game/v2/pkg/config/worker"
 	"github.com/giongto35/cloud-game/v2/pkg/monitoring"
 	"github.com/giongto35/cloud-game/v2/pkg/service"
+	"github.com/giongto35/cloud-game/v2/pkg/storage"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/janitor"
+	"github.com/giongto35/cloud-game/v2/pkg/worker/room"
 )
 
-func New(conf worker.Config) (services service.Group) {
-	httpSrv, err := NewHTTPServer(conf)
+type Worker struct {
+	service.Group
+
+	handler *Handler
+}
+
+func New(conf worker.Config) *Worker {
+	// the rooms can't save the states without the keys
+	if _, err := storage.NewStateCodec(conf.Storage); err != nil {
+		log.Fatalf("storage init fail: %v", err)
+	}
+	rooms := room.NewManager()
+	httpSrv, err := NewHTTPServer(conf, rooms)
 	if err != nil {
 		log.Fatalf("http init fail: %v", err)
 	}
 
-	mainHandler := NewHandler(conf, httpSrv.Addr)
+	mainHandler := NewHandler(conf, httpSrv.Addr, rooms)
 	mainHandler.Prepare()
 
-	services.Add(httpSrv, mainHandler)
+	w := &Worker{handler: mainHandler}
+	w.Add(httpSrv, mainHandler)
+	if cleanup := conf.Emulator.StorageCleanup; cleanup.ExpiryDays > 0 && !conf.Emulator.IsFlatStorage() {
+		w.Add(janitor.New(conf.Emulator.Storage, cleanup, func(id string) bool { return rooms.Get(id) != nil }))
+	}
 	if conf.Worker.Monitoring.IsEnabled() {
-		services.Add(monitoring.New(conf.Worker.Monitoring, httpSrv.GetHost(), "worker"))
+		w.Add(monitoring.New(conf.Worker.Monitoring, httpSrv.GetHost(), "worker"))
 	}
-	return
+	return w
 }
+
+// Drained returns a channel which is closed when the worker
+// has drained all its rooms (i.e. on the coordinator request).
+func (w *Worker) Drained() <-chan struct{} { return w.handler.Drained() }
@@ -61,11 +61,36 @@
 
     const onGameRoomAvailable = () => {
         message.show('Now you can share you game!');
+        // the devices of the ports for the mouse input
+        rtcp.control('ports');
+        // the invite of the shared link
+        socket.invite();
+    };
+
+    // the room is moving to another worker
+    let migrating = false;
+
+    const onGameMigrated = (data) => {
+        message.show('Moving the game to another server...');
+        migrating = true;
+        input.poll().disable();
+        rtcp.stop();
+        rtcp.start(data.stunturn);
     };
 
     const onConnectionReady = () => {
+        // join the moved room on its new worker
+        if (migrating) {
+            migrating = false;
+            startGame();
+            return;
+        }
+        // get back into the room of the reloaded page,
         // start a game right away or show the menu
-        if (room.getId()) {
+        const seat = room.seat();
+        if (seat && seat.roomId === room.getId()) {
+            startGame(seat.token);
+        } else if (room.getId()) {
             startGame();
         } else {
             state.menuReady();
@@ -118,7 +143,35 @@
         setState(app.state.menu);
     };
 
-    const startGame = () => {
+    // the password of the private room
+    let roomPassword = '';
+    // the room error of the worker for the wrong password
+    const WRONG_PASSWORD = 'wrong password';
+    // the server of the room is gone
+    const ROOM_GONE = 'room_gone';
+    // the room errors of the games which have failed to start
+    const START_ERRORS = {
+        'no_core': 'The emulator of the game is not available',
+        'bad_game': 'The game file is missing or broken',
+        'emulator_crash': 'The emulator has crashed while loading the game',
+        'start_timeout': 'The game takes too long to load, try again later',
+        'video_failure': 'The video of the game has failed, try again later',
+        'overloaded': 'The servers are too busy, try again later',
+        'no_codec': 'Your browser can\'t play the video of the room',
+    };
+    // the room error of the cores without their BIOS files
+    const NO_BIOS = 'no_bios';
+    // the room errors of the join tokens,
+    // the expired and invalid tokens are requested again
+    const TOKEN_EXPIRED = 'token_expired';
+    const TOKEN_INVALID = 'token_invalid';
+    const FORBIDDEN = 'forbidden';
+    // the new tokens after the token errors of one start
+    const JOIN_RETRIES = 1;
+    let joinRetries = 0;
+
+    // startGame starts the game or reconnects to the room with the token
+    const startGame = (reconnectToken) => {
         if (!rtcp.isConnected()) {
             message.show('Game cannot load. Please refresh');
             return;
@@ -140,13 +193,12 @@
         // currently it's a game with the index 1
         // on the server this game is ignored and the actual game will be extracted from the share link
         // so there's no point in doing this and this' really confusing
-        socket.startGame(
-            gameList.getCurrentGame(),
-            env.isMobileDevice(),
-            room.getId(),
-            recording.isActive(),
-            recording.getUser(),
-            +playerIndex.value - 1);
+        if (reconnectToken) {
+            socket.reconnectGame(reconnectToken);
+        } else {
+            joinRetries = 0;
+            socket.joinToken(room.getId(), false, room.getInvite());
+        }
 
         // clear menu screen
         input.poll().disable();
@@ -158,8 +210,31 @@
         input.poll().enable();
     };
 
-    const saveGame = utils.debounce(socket.saveGame, 1000);
-    const loadGame = utils.debounce(socket.loadGame, 1000);
+    // joinGame starts the game with the join token of the room
+    const joinGame = (token) => {
+        if (token === 'error') {
+            message.show('Game cannot start: no join token');
+            return;
+        }
+        socket.startGame(
+            gameList.getCurrentGame(),
+            env.isMobileDevice(),
+            room.getId(),
+            recording.isActive(),
+            recording.getUser(),
+            +playerIndex.value - 1,
+            roomPassword,
+            token);
+    };
+
+    // the hotkeys go over the control channel when it's there
+    const saveGame = utils.debounce(() => rtcp.control('save') || socket.saveGame(), 1000);
+    const loadGame = utils.debounce(() => rtcp.control('load') || socket.loadGame(), 1000);
+    const rewindGame = utils.debounce(() => socket.rewind(5), 500);
+    const pauseGame = utils.debounce(() => rtcp.control('pause') || socket.togglePause(), 500);
+    // the speed of the game while the fast-forward key is held
+    const FAST_FORWARD_SPEED = 2;
+    let fastForward = false;
 
     const _dpadArrowKeys = [KEY.UP, KEY.DOWN, KEY.LEFT, KEY.RIGHT];
 
@@ -350,6 +425,12 @@
                 },
                 keyPress: key => {
                     input.setKeyState(key, true);
+
+                    // fast-forward while the key is held
+                    if (key === KEY.FAST && !fastForward) {
+                        fastForward = true;
+                        socket.fastForward(FAST_FORWARD_SPEED);
+                    }
                 },
                 keyRelease: function (key) {
                     input.setKeyState(key, false);
@@ -360,6 +441,8 @@
                             saveGame();
                             room.copyToClipboard();
                             message.show('Shared link copied to the clipboard!');
+                            // a fresh invite for the next link
+                            socket.invite();
                             break;
                         case KEY.SAVE:
                             saveGame();
@@ -367,6 +450,16 @@
                         case KEY.LOAD:
                             loadGame();
                             break;
+                        case KEY.REWIND:
+                            rewindGame();
+                            break;
+                        case KEY.PAUSE:
+                            pauseGame();
+                            break;
+                        case KEY.FAST:
+                            fastForward = false;
+                            socket.fastForward(1);
+                            break;
                         case KEY.FULL:
                             stream.video.toggleFullscreen();
                             break;
@@ -387,7 +480,7 @@
 
                         // toggle multitap
                         case KEY.MULTITAP:
-                            socket.toggleMultitap();
+                            rtcp.control('multitap') || socket.toggleMultitap();
                             break;
 
                         // quit
@@ -418,13 +511,100 @@
 
     // subscriptions
     event.sub(GAME_ROOM_AVAILABLE, onGameRoomAvailable, 2);
+    // the seat is gone, join the room as a new player
+    event.sub(GAME_RECONNECT_FAILED, () => startGame(), 2);
+    event.sub(GAME_JOIN_TOKEN, joinGame);
+    event.sub(GAME_MIGRATED, onGameMigrated);
     event.sub(GAME_SAVED, () => message.show('Saved'));
     event.sub(GAME_LOADED, () => message.show('Loaded'));
+    event.sub(GAME_PAUSED, paused => message.show(paused ? 'Paused' : 'Resumed'));
+    event.sub(GAME_ERROR, err => {
+        // ask for the password of the private room and try again
+        if (err === WRONG_PASSWORD) {
+            const password = prompt(roomPassword ? 'Wrong password, try again' : 'The room is private, enter the password');
+            if (password) {
+                roomPassword = password;
+                startGame();
+                return;
+            }
+        }
+        // get a new join token and try again
+        if ((err === TOKEN_EXPIRED || err === TOKEN_INVALID) && joinRetries < JOIN_RETRIES) {
+            joinRetries++;
+            socket.joinToken(room.getId(), false, room.getInvite());
+            return;
+        }
+        if (err === FORBIDDEN) {
+            message.show('You are not allowed to join the room');
+            return;
+        }
+        // join the room again on another server (from the last save)
+        if (err === ROOM_GONE) {
+            message.show('The server is gone, restarting the game...');
+            setTimeout(() => window.location = room.getLink(), 2000);
+            return;
+        }
+        if (START_ERRORS[err]) {
+            message.show(START_ERRORS[err]);
+            return;
+        }
+        // the missing BIOS files of the emulator, i.e. no_bios: core X requires Y
+        if (err.startsWith(NO_BIOS)) {
+            message.show(`The emulator is missing its system files ${err.slice(NO_BIOS.length)}`);
+            return;
+        }
+        message.show(`Game cannot start: ${err}`);
+    });
+    event.sub(ROOM_PASSWORD_CHANGED, () => message.show('Room password changed'));
+    event.sub(CONTROL_REPLY, reply => {
+        if (!reply.ok) {
+            message.show(`Couldn't ${reply.cmd}: ${reply.error}`);
+            return;
+        }
+        switch (reply.cmd) {
+            case 'save':
+            case 'save_slot':
+                event.pub(GAME_SAVED);
+                break;
+            case 'load':
+            case 'load_slot':
+                event.pub(GAME_LOADED);
+                break;
+            case 'pause':
+                event.pub(GAME_PAUSED, reply.data.paused);
+                break;
+            case 'rumble':
+                event.pub(GAMEPAD_RUMBLE, reply.data);
+                break;
+            case 'chat':
+                message.show(`${reply.data.spectator ? 'Spectator' : `Player ${reply.data.player + 1}`}: ${reply.data.text}`);
+                break;
+            case 'achievement':
+                message.show(`Achievement unlocked: ${reply.data.title} (${reply.data.points})`);
+                break;
+            case 'shutdown':
+                message.show('The server is shutting down, the game has been saved');
+                break;
+            case 'kicked':
+                if (reply.data.reason === 'owner' || reply.data.reason === 'banned') {
+                    message.show(`You've been ${reply.data.reason === 'owner' ? 'kicked' : 'banned'} by the room owner`);
+                } else {
+                    message.show(`Disconnected by the server: ${reply.data.reason}`);
+                }
+                break;
+            case 'volume':
+            case 'mute':
+                message.show(reply.data.muted ? 'Muted' : `Volume ${reply.data.volume}%`);
+                break;
+        }
+    });
     event.sub(GAME_PLAYER_IDX_CHANGE, data => {
         updatePlayerIndex(data.index);
     });
     event.sub(GAME_PLAYER_IDX, idx => {
-        if (!isNaN(+idx)) message.show(+idx + 1);
+        if (isNaN(+idx)) return;
+        playerIndex.value = +idx + 1;
+        message.show(+idx + 1);
     });
 
     event.sub(MEDIA_STREAM_INITIALIZED, (data) => {
@@ -432,6 +612,10 @@
         rtcp.start(data.stunturn);
         gameList.set(data.games);
     });
+    event.sub(GAME_LIST_CHANGED, (games) => {
+        gameList.set(games);
+        if (state === app.state.menu) gameList.show();
+    });
     event.sub(MEDIA_STREAM_SDP_AVAILABLE, (data) => rtcp.setRemoteDescription(data.sdp, stream.video.el()));
     event.sub(MEDIA_STREAM_CANDIDATE_ADD, (data) => rtcp.addCandidate(data.candidate));
     event.sub(MEDIA_STREAM_CANDIDATE_FLUSH, () => rtcp.flushCandidate());
@@ -458,6 +642,8 @@
     });
     event.sub(AXIS_CHANGED, onAxisChanged);
     event.sub(CONTROLLER_UPDATED, data => rtcp.input(data));
+    event.sub(POINTER_UPDATED, data => rtcp.isInputReady() && rtcp.input(data));
+    event.sub(KEYBOARD_UPDATED, data => rtcp.isInputReady() && rtcp.input(data));
     // recording
     event.sub(RECORDING_TOGGLED, handleRecording);
     event.sub(RECORDING_STATUS_CHANGED, handleRecordingStatus);
@@ -469,6 +655,17 @@
         }
     });
 
+    // the seat of the closed tab is released right away (it may be a reload,
+    // the seat comes back with the reconnect token then),
+    // the beacon to the coordinator goes if the control channel doesn't make it
+    window.addEventListener('pagehide', () => {
+        rtcp.control('leave');
+        const seat = room.seat();
+        if (seat && seat.token && navigator.sendBeacon) {
+            navigator.sendBeacon('/leave', seat.token);
+        }
+    });
+
     // initial app state
     setState(app.state.eden);
 })(document, event, env, gameList, input, KEY, log, message, recording, room, rtcp, settings, socket, stats, stream, utils, workerManager);
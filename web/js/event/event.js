@@ -63,6 +63,22 @@ const GET_SERVER_LIST = 'getServerList';
 const GAME_ROOM_AVAILABLE = 'gameRoomAvailable';
 const GAME_SAVED = 'gameSaved';
 const GAME_LOADED = 'gameLoaded';
+const GAME_SLOTS = 'gameSlots';
+const GAME_PAUSED = 'gamePaused';
+const GAME_ERROR = 'gameError';
+const GAME_RECONNECT_FAILED = 'gameReconnectFailed';
+// the token to join the room with
+const GAME_JOIN_TOKEN = 'gameJoinToken';
+// the room has moved to another worker
+const GAME_MIGRATED = 'gameMigrated';
+// the games of the library have changed
+const GAME_LIST_CHANGED = 'gameListChanged';
+const ROOM_PASSWORD_CHANGED = 'roomPasswordChanged';
+// the game of the room has been cloned into the new room with the ID
+const ROOM_FORKED = 'roomForked';
+// the invite of the new players of the owned room
+const ROOM_INVITE = 'roomInvite';
+const CONTROL_REPLY = 'controlReply';
 // used to transfer the index value between touch and controller
 const GAME_PLAYER_IDX_CHANGE = 'gamePlayerIndexChange';
 const GAME_PLAYER_IDX = 'gamePlayerIndex';
@@ -90,9 +106,13 @@ const KEYBOARD_TOGGLE_FILTER_MODE = 'keyboardToggleFilterMode';
 const KEYBOARD_KEY_PRESSED = 'keyboardKeyPressed';
 const AXIS_CHANGED = 'axisChanged';
 const CONTROLLER_UPDATED = 'controllerUpdated';
+const POINTER_UPDATED = 'pointerUpdated';
+const GAMEPAD_RUMBLE = 'gamepadRumble';
+const KEYBOARD_UPDATED = 'keyboardUpdated';
 
 const DPAD_TOGGLE = 'dpadToggle';
 const STATS_TOGGLE = 'statsToggle';
+const CONNECTION_STATS = 'connectionStats';
 const HELP_OVERLAY_TOGGLED = 'helpOverlayToggled';
 
 const SETTINGS_CHANGED = 'settingsChanged';
@@ -16,7 +16,11 @@ const gameList = (() => {
     let menuTop = MENU_TOP_POSITION;
 
     const setGames = (gameList) => {
+        // keep the picked game of the updated list
+        const current = games[gameIndex];
         games = gameList.sort((a, b) => a > b ? 1 : -1);
+        const idx = games.indexOf(current);
+        if (idx >= 0) gameIndex = idx;
     };
 
     const render = () => {
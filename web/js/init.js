@@ -17,6 +17,7 @@ settings.init();
 keyboard.init();
 joystick.init();
 touch.init();
+pointer.init();
 stream.init();
 
 [roomId, zone] = room.loadMaybe();
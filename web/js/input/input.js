@@ -74,8 +74,9 @@ const input = (() => {
      *
      * @returns {Uint16Array} The controller state.
      * First uint16 is the controller state bitmap.
-     * The other uint16 are the axes values.
-     * Truncated to the last value changed.
+     * The other uint16 are the axes values (int16) of the left and the right stick.
+     * Truncated to the last non-centered axis, the missing axes are centered on the server,
+     * so the digital-only state is just the bitmap.
      *
      * @private
      */
@@ -83,7 +84,9 @@ const input = (() => {
         controllerEncoded[0] = 0;
         for (let i = 0, len = keys.length; i < len; i++) controllerEncoded[0] += controllerState[keys[i]] ? 1 << i : 0;
 
-        return new Uint16Array(controllerEncoded.slice(0, controllerChangedIndex+1));
+        let last = controllerEncoded.length - 1;
+        while (last > 0 && controllerEncoded[last] === 0) last--;
+        return new Uint16Array(controllerEncoded.slice(0, last+1));
     }
 
     return {
@@ -94,6 +94,30 @@ const joystick = (() => {
         }
     }
 
+    // the rumble motors of the game (0-0xffff),
+    // the games only tell when they change, so the effects last until the next change
+    const rumble = {strong: 0, weak: 0};
+    const RUMBLE_DURATION_MS = 5000;
+
+    const onRumble = (data) => {
+        if (!(data.effect in rumble)) return;
+        rumble[data.effect] = data.strength || 0;
+        const gamepad = navigator.getGamepads()[joystickIdx];
+        const actuator = gamepad && gamepad.vibrationActuator;
+        if (!actuator) return;
+        if (rumble.strong === 0 && rumble.weak === 0) {
+            actuator.reset && actuator.reset();
+            return;
+        }
+        actuator.playEffect('dual-rumble', {
+            duration: RUMBLE_DURATION_MS,
+            strongMagnitude: rumble.strong / 0xffff,
+            weakMagnitude: rumble.weak / 0xffff,
+        }).catch(() => {});
+    }
+
+    event.sub(GAMEPAD_RUMBLE, onRumble);
+
     // we only capture the last plugged joystick
     const onGamepadConnected = (e) => {
         let gamepad = e.gamepad;
@@ -1,7 +1,12 @@
 /**
  * Keyboard controls.
  *
- * @version 1
+ * Besides the joypad keys, the keys go to the computer cores as is (the server drops them
+ * for the rest of the games) with the messages of the tag byte followed by
+ * the little-endian uint16 values:
+ *  key: 0x03, key code, pressed | location << 8, character (UTF-16), modifiers (libretro), 0
+ *
+ * @version 2
  */
 const keyboard = (() => {
     // default keyboard bindings
@@ -23,6 +28,9 @@ const keyboard = (() => {
         KeyW: KEY.JOIN,
         KeyK: KEY.SAVE,
         KeyL: KEY.LOAD,
+        KeyR: KEY.REWIND,
+        KeyP: KEY.PAUSE,
+        Space: KEY.FAST,
         Digit1: KEY.PAD1,
         Digit2: KEY.PAD2,
         Digit3: KEY.PAD3,
@@ -103,6 +111,27 @@ const keyboard = (() => {
 
     event.sub(DPAD_TOGGLE, (data) => onDpadToggle(data.checked));
 
+    const TAG_KEY = 0x03;
+    // the modifiers of libretro (RETROKMOD_*)
+    const modifiers = [['Shift', 0x01], ['Control', 0x02], ['Alt', 0x04], ['Meta', 0x08],
+        ['NumLock', 0x10], ['CapsLock', 0x20], ['ScrollLock', 0x40]];
+
+    const encodeKey = (e, pressed) => {
+        const char = e.key.length === 1 ? e.key.charCodeAt(0) : 0;
+        let mods = 0;
+        modifiers.forEach(([name, bit]) => mods |= e.getModifierState(name) ? bit : 0);
+        const values = [e.keyCode, (pressed ? 1 : 0) | e.location << 8, char, mods, 0];
+        const view = new DataView(new ArrayBuffer(1 + values.length * 2));
+        view.setUint8(0, TAG_KEY);
+        values.forEach((v, i) => view.setUint16(1 + i * 2, v & 0xffff, true));
+        return new Uint8Array(view.buffer);
+    }
+
+    const sendKey = (e, pressed) => {
+        if (e.repeat || !e.keyCode) return;
+        event.pub(KEYBOARD_UPDATED, encodeKey(e, pressed));
+    }
+
     return {
         init: () => {
             keyMap = settings.loadOr(opts.INPUT_KEYBOARD_MAP, defaultMap);
@@ -111,6 +140,7 @@ const keyboard = (() => {
             body.addEventListener('keyup', e => {
                 e.stopPropagation();
                 if (isKeysFilteredMode) {
+                    sendKey(e, false);
                     onKey(e.code, key => event.pub(KEY_RELEASED, {key: key}));
                 } else {
                     event.pub(KEYBOARD_KEY_PRESSED, {key: e.code});
@@ -119,6 +149,7 @@ const keyboard = (() => {
             body.addEventListener('keydown', e => {
                 e.stopPropagation();
                 if (isKeysFilteredMode) {
+                    sendKey(e, true);
                     onKey(e.code, key => event.pub(KEY_PRESSED, {key: key}), true)
                 } else {
                     event.pub(KEYBOARD_KEY_PRESSED, {key: e.code});
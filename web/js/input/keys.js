@@ -31,5 +31,8 @@ const KEY = (() => {
         R3: 'r3',
         MULTITAP: 'multitap',
         REC: 'rec',
+        REWIND: 'rewind',
+        PAUSE: 'pause',
+        FAST: 'fast',
     }
 })();
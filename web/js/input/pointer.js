@@ -0,0 +1,79 @@
+/**
+ * Mouse and pointer controls of the game screen.
+ *
+ * The messages are the tag byte followed by the little-endian uint16 values
+ * and the size of the screen element:
+ *  mouse:   0x01, dx, dy, buttons, width, height
+ *  pointer: 0x02, x, y (0-0xffff of the element), pressed, width, height
+ * Only the messages of the device of the controller port of the player are sent,
+ * the pointer of the pointers and lightguns and the mouse of the rest.
+ *
+ * @version 2
+ */
+const pointer = (() => {
+    const TAG_MOUSE = 0x01;
+    const TAG_POINTER = 0x02;
+
+    // the libretro device types of the ports
+    const RETRO_DEVICE_MASK = 0xff;
+    const RETRO_DEVICE_LIGHTGUN = 4;
+    const RETRO_DEVICE_POINTER = 6;
+
+    // the controller ports of the game and the port of the player
+    let ports = [];
+    let player = 0;
+
+    const isPointer = () => {
+        const port = ports[player];
+        if (!port) return false;
+        const type = port.device & RETRO_DEVICE_MASK;
+        return type === RETRO_DEVICE_POINTER || type === RETRO_DEVICE_LIGHTGUN;
+    }
+
+    const encode = (tag, values) => {
+        const view = new DataView(new ArrayBuffer(1 + values.length * 2));
+        view.setUint8(0, tag);
+        values.forEach((v, i) => view.setUint16(1 + i * 2, v & 0xffff, true));
+        return new Uint8Array(view.buffer);
+    }
+
+    const clamp = (v) => Math.max(0, Math.min(0xffff, Math.round(v)));
+
+    const handle = (e) => {
+        const screen = e.target;
+        const w = screen.clientWidth, h = screen.clientHeight;
+        if (w < 1 || h < 1) return;
+
+        if (isPointer()) {
+            const x = clamp(e.offsetX / w * 0xffff), y = clamp(e.offsetY / h * 0xffff);
+            event.pub(POINTER_UPDATED, encode(TAG_POINTER, [x, y, e.buttons & 1, w, h]));
+            return;
+        }
+        if (e.type === 'mousemove' && (e.movementX || e.movementY)) {
+            event.pub(POINTER_UPDATED, encode(TAG_MOUSE, [e.movementX, e.movementY, e.buttons, w, h]));
+        }
+        if (e.type !== 'mousemove') {
+            // the buttons of the mouse
+            event.pub(POINTER_UPDATED, encode(TAG_MOUSE, [0, 0, e.buttons, w, h]));
+        }
+    }
+
+    // the ports of the ports and port_device commands
+    event.sub(CONTROL_REPLY, reply => {
+        if (reply.ok && (reply.cmd === 'ports' || reply.cmd === 'port_device') && Array.isArray(reply.data)) {
+            ports = reply.data;
+        }
+    });
+    event.sub(GAME_PLAYER_IDX, idx => {
+        if (!isNaN(+idx)) player = +idx;
+    });
+
+    return {
+        init: () => {
+            const screen = document.getElementById('stream');
+            ['mousemove', 'mousedown', 'mouseup'].forEach(name => screen.addEventListener(name, handle));
+            screen.addEventListener('contextmenu', e => e.preventDefault());
+            log.info('[input] mouse input has been initialized');
+        }
+    }
+})(event, log);
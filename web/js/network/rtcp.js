@@ -5,6 +5,8 @@
 const rtcp = (() => {
     let connection;
     let inputChannel;
+    let controlChannel;
+    let controlId = 0;
     let mediaStream;
     let candidates = Array();
     let isAnswered = false;
@@ -27,6 +29,13 @@ const rtcp = (() => {
         // recv dataChannel from worker
         connection.ondatachannel = e => {
             log.debug(`[rtcp] ondatachannel: ${e.channel.label}`)
+            // the control commands with their replies
+            if (e.channel.label === 'control') {
+                controlChannel = e.channel;
+                controlChannel.onmessage = m => event.pub(CONTROL_REPLY, JSON.parse(m.data));
+                controlChannel.onclose = () => log.debug('[rtcp] the control channel has closed');
+                return;
+            }
             inputChannel = e.channel;
             inputChannel.onopen = () => {
                 log.debug('[rtcp] the input channel has opened');
@@ -84,13 +93,32 @@ const rtcp = (() => {
             inputChannel.close();
             inputChannel = null;
         }
+        if (controlChannel) {
+            controlChannel.close();
+            controlChannel = null;
+        }
         candidates = Array();
         log.info('[rtcp] WebRTC has been closed');
     }
 
     const ice = (() => {
         const ICE_TIMEOUT = 2000;
+        // the time the worker has for the ICE restart of the broken connection,
+        // it should be the same as the iceRestartTimeout of the worker
+        const ICE_RESTART_TIMEOUT = 10000;
         let timeForIceGathering;
+        let timeForIceRestart;
+
+        // waitRestart waits the worker's offer of the ICE restart
+        // and closes the connection if there was none
+        const waitRestart = () => {
+            if (timeForIceRestart) return;
+            timeForIceRestart = setTimeout(() => {
+                log.info(`[rtcp] no ICE restart in ${ICE_RESTART_TIMEOUT}ms`);
+                timeForIceRestart = null;
+                event.pub(CONNECTION_CLOSED);
+            }, ICE_RESTART_TIMEOUT);
+        }
 
         return {
             onIcecandidate: event => {
@@ -122,20 +150,22 @@ const rtcp = (() => {
                     case 'connected': {
                         log.info('[rtcp] connected...');
                         connected = true;
+                        if (timeForIceRestart) {
+                            clearTimeout(timeForIceRestart);
+                            timeForIceRestart = null;
+                        }
                         break;
                     }
                     case 'disconnected': {
-                        log.info('[rtcp] disconnected...');
+                        log.info('[rtcp] disconnected, waiting for ICE restart...');
                         connected = false;
-                        event.pub(CONNECTION_CLOSED);
+                        waitRestart();
                         break;
                     }
                     case 'failed': {
-                        log.error('[rtcp] connection failed, retry...');
+                        log.error('[rtcp] connection failed, waiting for ICE restart...');
                         connected = false;
-                        connection.createOffer({iceRestart: true})
-                            .then(description => connection.setLocalDescription(description).catch(log.error))
-                            .catch(log.error);
+                        waitRestart();
                         break;
                     }
                 }
@@ -179,9 +209,18 @@ const rtcp = (() => {
                 log.debug('[rtcp] add candidate: ' + d);
                 connection.addIceCandidate(candidate);
             });
+            // the candidates of the next (ICE restart) offer
+            candidates = Array();
             isFlushing = false;
         },
         input: (data) => inputChannel.send(data),
+        // control sends a control command (save, load, pause, etc.),
+        // returns false if there is no control channel
+        control: (cmd, params = {}) => {
+            if (!controlChannel || controlChannel.readyState !== 'open') return false;
+            controlChannel.send(JSON.stringify({id: ++controlId, cmd: cmd, ...params}));
+            return true;
+        },
         isConnected: () => connected,
         isInputReady: () => inputReady,
         getConnection: () => connection,
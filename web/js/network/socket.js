@@ -72,7 +72,10 @@ const socket = (() => {
                     event.pub(PING_RESPONSE);
                     break;
                 case 'start':
-                    event.pub(GAME_ROOM_AVAILABLE, {roomId: data.room_id});
+                    // with the reconnect token of the room seat
+                    event.pub(GAME_ROOM_AVAILABLE, {roomId: data.room_id, token: data.data});
+                    // the player may differ from the requested one
+                    event.pub(GAME_PLAYER_IDX, data.player_index);
                     break;
                 case 'save':
                     event.pub(GAME_SAVED);
@@ -80,6 +83,48 @@ const socket = (() => {
                 case 'load':
                     event.pub(GAME_LOADED);
                     break;
+                case 'save_slot':
+                    event.pub(GAME_SAVED);
+                    break;
+                case 'load_slot':
+                    event.pub(GAME_LOADED);
+                    break;
+                case 'slots':
+                    event.pub(GAME_SLOTS, data.data !== 'error' ? JSON.parse(data.data).slots : []);
+                    break;
+                case 'pause':
+                    if (data.data !== 'error') event.pub(GAME_PAUSED, JSON.parse(data.data).paused);
+                    break;
+                case 'password':
+                    event.pub(data.data !== 'error' ? ROOM_PASSWORD_CHANGED : GAME_ERROR, 'password change failed');
+                    break;
+                case 'import_save':
+                    // the errors tell why the save file doesn't fit the room
+                    event.pub(data.data === 'ok' ? GAME_LOADED : GAME_ERROR, data.data);
+                    break;
+                case 'fork':
+                    // the forked room is shared with its ID
+                    event.pub(data.data === 'ok' ? ROOM_FORKED : GAME_ERROR, data.data === 'ok' ? data.room_id : data.data);
+                    break;
+                case 'reconnect':
+                    event.pub(GAME_RECONNECT_FAILED);
+                    break;
+                case 'invite':
+                    // only the room owners of the new workers get the invites
+                    if (data.data && data.data !== 'error' && !data.data.startsWith('unsupported')) {
+                        event.pub(ROOM_INVITE, data.data);
+                    }
+                    break;
+                case 'join_token':
+                    event.pub(GAME_JOIN_TOKEN, data.data);
+                    break;
+                case 'migrate':
+                    // with the STUN/TURN servers of the new worker
+                    event.pub(GAME_MIGRATED, {stunturn: data.data});
+                    break;
+                case 'room_error':
+                    event.pub(GAME_ERROR, data.data);
+                    break;
                 case 'player_index':
                     event.pub(GAME_PLAYER_IDX, data.data);
                     break;
@@ -89,9 +134,15 @@ const socket = (() => {
                 case 'recording':
                     event.pub(RECORDING_STATUS_CHANGED, data.data);
                     break;
+                case 'connection_stats':
+                    if (data.data !== 'error') event.pub(CONNECTION_STATS, JSON.parse(data.data));
+                    break;
                 case 'get_server_list':
                     event.pub(GET_SERVER_LIST, JSON.parse(data.data));
                     break;
+                case 'game_list':
+                    event.pub(GAME_LIST_CHANGED, JSON.parse(data.data) || []);
+                    break;
             }
         };
     };
@@ -125,23 +176,49 @@ const socket = (() => {
     });
     const saveGame = () => send({"id": "save", "data": ""});
     const loadGame = () => send({"id": "load", "data": ""});
+    const saveGameSlot = (slot) => send({"id": "save_slot", "data": JSON.stringify({"slot": slot})});
+    const loadGameSlot = (slot) => send({"id": "load_slot", "data": JSON.stringify({"slot": slot})});
+    const getGameSlots = () => send({"id": "slots", "data": ""});
     const updatePlayerIndex = (idx) => send({"id": "player_index", "data": idx.toString()});
-    const startGame = (gameName, isMobile, roomId, record, recordUser, playerIndex) => send({
+    const startGame = (gameName, isMobile, roomId, record, recordUser, playerIndex, password = '', token = '') => send({
         "id": "start",
         "data": JSON.stringify({
             "game_name": gameName,
             "record": record,
             "record_user": recordUser,
+            "password": password,
+            "token": token,
         }),
         "room_id": roomId != null ? roomId : '',
         "player_index": playerIndex
     });
+    const reconnectGame = (token) => send({"id": "reconnect", "data": token});
+    // asks the token to join the room (the empty one -- a new room) as a player or spectator,
+    // the new players of the running rooms need the invites of their owners
+    const joinToken = (roomId, spectator = false, invite = '') => send({
+        "id": "join_token",
+        "data": JSON.stringify({"spectator": spectator, "invite": invite}),
+        "room_id": roomId != null ? roomId : ''
+    });
+    // asks the invite of the new players of the owned room
+    const invite = () => send({"id": "invite", "data": ""});
+    // sets the password of the owned room, the empty one makes it public
+    const setRoomPassword = (password = '') => send({"id": "password", "data": JSON.stringify({"password": password})});
+    // loads the save file (base64) downloaded from /save-export?room=&token= (the seat token) into the owned room
+    const importSave = (save = '') => send({"id": "import_save", "data": JSON.stringify({"save": save})});
+    // clones the game of the owned room into a new room
+    const forkRoom = () => send({"id": "fork", "data": ""});
     const quitGame = (roomId) => send({"id": "quit", "data": "", "room_id": roomId});
     const toggleMultitap = () => send({"id": "multitap", "data": ""});
+    const rewind = (seconds = 5) => send({"id": "rewind", "data": JSON.stringify({"seconds": seconds})});
+    const togglePause = () => send({"id": "pause", "data": ""});
+    const fastForward = (speed = 1) => send({"id": "fast_forward", "data": JSON.stringify({"speed": speed})});
+    const setKeyMapping = (mapping = {}) => send({"id": "key_mapping", "data": JSON.stringify({"mapping": mapping})});
     const toggleRecording = (active = false, userName = '') => send({
         "id": "recording", "data": JSON.stringify({"active": active, "user": userName,})
     })
     const getServerList = () => send({"id": "get_server_list", "data": "{}"})
+    const getConnectionStats = () => send({"id": "connection_stats", "data": ""});
 
     return {
         init: init,
@@ -150,11 +227,25 @@ const socket = (() => {
         latency: latency,
         saveGame: saveGame,
         loadGame: loadGame,
+        saveGameSlot,
+        loadGameSlot,
+        getGameSlots,
         updatePlayerIndex: updatePlayerIndex,
         startGame: startGame,
+        reconnectGame,
+        joinToken,
+        invite,
+        setRoomPassword,
+        importSave,
+        forkRoom,
         quitGame: quitGame,
         toggleMultitap: toggleMultitap,
+        setKeyMapping,
+        rewind,
+        togglePause,
+        fastForward,
         toggleRecording: toggleRecording,
         getServerList,
+        getConnectionStats,
     }
 })(event, log);
@@ -4,6 +4,12 @@
  */
 const room = (() => {
     let id = '';
+    // the invite of the owner of the room the new players join with
+    let invite = '';
+
+    // the reconnect token of the room seat,
+    // kept through the page reloads of the tab
+    const SEAT_KEY = 'seat';
 
     // UI
     const roomLabel = document.getElementById('room-txt');
@@ -25,6 +31,9 @@ const room = (() => {
         if (typeof queryDict.id === 'string') {
             room = decodeURIComponent(queryDict.id);
         }
+        if (typeof queryDict.invite === 'string') {
+            invite = decodeURIComponent(queryDict.invite);
+        }
 
         return [room, zone];
     };
@@ -32,23 +41,34 @@ const room = (() => {
     event.sub(GAME_ROOM_AVAILABLE, data => {
         room.setId(data.roomId);
         room.save(data.roomId);
+        if (data.token) {
+            sessionStorage.setItem(SEAT_KEY, JSON.stringify({roomId: data.roomId, token: data.token}));
+        }
     }, 1);
+    event.sub(ROOM_INVITE, invite_ => invite = invite_);
+    event.sub(GAME_RECONNECT_FAILED, () => sessionStorage.removeItem(SEAT_KEY), 1);
 
     return {
         getId: () => id,
+        getInvite: () => invite,
         setId: (id_) => {
             id = id_;
             roomLabel.value = id;
         },
         reset: () => {
             id = '';
+            invite = '';
             roomLabel.value = id;
+            sessionStorage.removeItem(SEAT_KEY);
         },
+        // seat returns the saved {roomId, token} seat of the previous session of the tab
+        seat: () => JSON.parse(sessionStorage.getItem(SEAT_KEY)),
         save: (roomIndex) => {
             localStorage.setItem('roomID', roomIndex);
         },
         load: () => localStorage.getItem('roomID'),
-        getLink: () => window.location.href.split('?')[0] + `?id=${encodeURIComponent(room.getId())}`,
+        getLink: () => window.location.href.split('?')[0] + `?id=${encodeURIComponent(room.getId())}` +
+            (invite ? `&invite=${encodeURIComponent(invite)}` : ''),
         loadMaybe: () => {
             // localStorage first
             //roomID = loadRoomID();
@@ -58,6 +78,11 @@ const room = (() => {
             if (parsedId !== null) {
                 id = parsedId;
             }
+            // the room of the reloaded page
+            const seat = room.seat();
+            if (!id && seat) {
+                id = seat.roomId;
+            }
             if (czone !== null) {
                 zone = czone;
             }
@@ -73,4 +98,4 @@ const room = (() => {
             document.body.removeChild(el);
         }
     }
-})(document, event, location, localStorage, window);
+})(document, event, location, localStorage, sessionStorage, window);
@@ -359,6 +359,44 @@ const stats = (() => {
         return {get, enable, disable, render}
     })(moduleUi, rtcp, window);
 
+    /**
+     * The connection quality of the stream measured by the worker.
+     *
+     * Events:
+     * <- CONNECTION_STATS
+     *
+     * @version 1
+     */
+    const connectionQuality = (() => {
+        let value = 0;
+        let listener;
+        let interval = null;
+
+        const ui = moduleUi('Loss(w)', true, () => '%');
+
+        const get = () => ui.el;
+
+        const enable = () => {
+            listener = event.sub(CONNECTION_STATS, onStats);
+            socket.getConnectionStats();
+            interval = window.setInterval(socket.getConnectionStats, 5000);
+        }
+
+        const disable = () => {
+            value = 0;
+            window.clearInterval(interval);
+            if (listener) listener.unsub();
+        }
+
+        const render = () => ui.update(value);
+
+        function onStats(stats) {
+            value = Math.round(Math.max(stats.video.packet_loss, stats.audio.packet_loss) * 100);
+        }
+
+        return {get, enable, disable, render}
+    })(moduleUi, socket, window);
+
     const modules = (fn, force = true) => {
         _modules.forEach(m => {
                 if (force || !m.internal) {
@@ -429,7 +467,8 @@ const stats = (() => {
         latency,
         clientMemory,
         webRTCStats_,
-        webRTCFrameStats
+        webRTCFrameStats,
+        connectionQuality
     );
     modules(m => statsOverlayEl.append(m.get()), false);
 
@@ -437,4 +476,4 @@ const stats = (() => {
     event.sub(HELP_OVERLAY_TOGGLED, onHelpOverlayToggle)
 
     return {enable, disable}
-})(document, env, event, log, rtcp, window);
+})(document, env, event, log, rtcp, socket, window);